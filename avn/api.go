@@ -33,6 +33,7 @@ import (
 	"github.com/avalanria/go-avalanria/core"
 	"github.com/avalanria/go-avalanria/core/rawdb"
 	"github.com/avalanria/go-avalanria/core/state"
+	"github.com/avalanria/go-avalanria/core/state/pruner"
 	"github.com/avalanria/go-avalanria/core/types"
 	"github.com/avalanria/go-avalanria/internal/avnapi"
 	"github.com/avalanria/go-avalanria/rlp"
@@ -256,6 +257,16 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// SyncFromCheckpoint schedules a sync of the state at the given trusted block
+// hash, backfilling the chain behind it. The block needs to be recent enough for
+// its state to still be available from the network.
+func (api *PrivateAdminAPI) SyncFromCheckpoint(hash common.Hash) (bool, error) {
+	if err := api.avn.handler.syncFromCheckpoint(hash); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // PublicDebugAPI is the collection of Avalanria full node APIs exposed
 // over the public debugging endpoint.
 type PublicDebugAPI struct {
@@ -545,3 +556,47 @@ func (api *PrivateDebugAPI) getModifiedAccounts(startBlock, endBlock *types.Bloc
 	}
 	return dirty, nil
 }
+
+// PruneState starts pruning the stale state of the node in the background,
+// without interrupting its operation. The progress can be tracked by the
+// PruneStateStatus mavnod.
+func (api *PrivateDebugAPI) PruneState() error {
+	if api.avn.config.NoPruning {
+		return errors.New("state pruning is not available in archive mode")
+	}
+	return api.avn.pruner.Start(api.avn.BlockChain())
+}
+
+// PruneStateStatus returns the progress of the running or last state pruning.
+func (api *PrivateDebugAPI) PruneStateStatus() pruner.OnlineStatus {
+	return api.avn.pruner.Status()
+}
+
+// ExecutionWitness re-executes the given block, returning the RLP encoded
+// witness needed to execute it without access to the state.
+func (api *PrivateDebugAPI) ExecutionWitness(blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	var block *types.Block
+	if number, ok := blockNrOrHash.Number(); ok {
+		switch number {
+		case rpc.PendingBlockNumber:
+			return nil, errors.New("witness of the pending block is not available")
+		case rpc.LatestBlockNumber:
+			block = api.avn.blockchain.CurrentBlock()
+		default:
+			block = api.avn.blockchain.GetBlockByNumber(uint64(number))
+		}
+	} else if hash, ok := blockNrOrHash.Hash(); ok {
+		block = api.avn.blockchain.GetBlockByHash(hash)
+	}
+	if block == nil {
+		return nil, errors.New("block not found")
+	}
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis is not executable")
+	}
+	witness, err := api.avn.blockchain.ExecutionWitness(block)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(witness)
+}
@@ -151,7 +151,7 @@ func (b *EthAPIBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.B
 	if header == nil {
 		return nil, nil, errors.New("header not found")
 	}
-	stateDb, err := b.avn.BlockChain().StateAt(header.Root)
+	stateDb, err := b.stateAt(header)
 	return stateDb, header, err
 }
 
@@ -170,12 +170,23 @@ func (b *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockN
 		if blockNrOrHash.RequireCanonical && b.avn.blockchain.GetCanonicalHash(header.Number.Uint64()) != hash {
 			return nil, nil, errors.New("hash is not currently canonical")
 		}
-		stateDb, err := b.avn.BlockChain().StateAt(header.Root)
+		stateDb, err := b.stateAt(header)
 		return stateDb, header, err
 	}
 	return nil, nil, errors.New("invalid arguments; neither block nor hash specified")
 }
 
+// stateAt returns the state of the given block, falling back to rebuilding it
+// from the recorded state diffs if its trie is not available anymore and state
+// diff recording is enabled.
+func (b *EthAPIBackend) stateAt(header *types.Header) (*state.StateDB, error) {
+	stateDb, err := b.avn.BlockChain().StateAt(header.Root)
+	if err == nil || !b.avn.config.StateDiffs {
+		return stateDb, err
+	}
+	return b.avn.BlockChain().HistoricState(header)
+}
+
 func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
 	return b.avn.blockchain.GetReceiptsByHash(hash), nil
 }
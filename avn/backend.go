@@ -29,8 +29,10 @@ import (
 	"github.com/avalanria/go-avalanria/accounts"
 	"github.com/avalanria/go-avalanria/common"
 	"github.com/avalanria/go-avalanria/common/hexutil"
+	"github.com/avalanria/go-avalanria/common/mclock"
 	"github.com/avalanria/go-avalanria/consensus"
 	"github.com/avalanria/go-avalanria/consensus/clique"
+	"github.com/avalanria/go-avalanria/consensus/ibft"
 	"github.com/avalanria/go-avalanria/core"
 	"github.com/avalanria/go-avalanria/core/bloombits"
 	"github.com/avalanria/go-avalanria/core/rawdb"
@@ -47,6 +49,7 @@ import (
 	"github.com/avalanria/go-avalanria/event"
 	"github.com/avalanria/go-avalanria/internal/avnapi"
 	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/metrics"
 	"github.com/avalanria/go-avalanria/miner"
 	"github.com/avalanria/go-avalanria/node"
 	"github.com/avalanria/go-avalanria/p2p"
@@ -71,9 +74,11 @@ type Avalanria struct {
 	handler            *handler
 	avnDialCandidates  enode.Iterator
 	snapDialCandidates enode.Iterator
+	snapServeLimiter   *snap.ServeLimiter // Budgets limiting the data served to snap syncers
 
 	// DB interfaces
-	chainDb avndb.Database // Block chain database
+	chainDb avndb.Database       // Block chain database
+	pruner  *pruner.OnlinePruner // Background pruner of the stale chain state
 
 	eventMux       *event.TypeMux
 	engine         consensus.Engine
@@ -131,6 +136,29 @@ func New(stack *node.Node, config *avnconfig.Config) (*Avalanria, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Resolve the scheme the state is stored with and record it before the genesis
+	// state is written, so it's already stored with the right one
+	scheme, err := rawdb.ParseStateScheme(config.StateScheme, chainDb)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == rawdb.PathScheme {
+		if config.NoPruning {
+			return nil, errors.New("archive mode is unsupported with the path-based state scheme")
+		}
+		if config.SyncMode != downloader.FullSync {
+			log.Warn("Switching to full sync, state sync is unsupported with the path-based state scheme", "provided", config.SyncMode)
+			config.SyncMode = downloader.FullSync
+		}
+	}
+	if config.StateDiffs && config.SnapshotCache == 0 {
+		return nil, errors.New("state diff recording requires the snapshot")
+	}
+	if rawdb.ReadStateScheme(chainDb) == "" {
+		rawdb.WriteStateScheme(chainDb, scheme)
+	}
+	log.Info("Initialised state storage", "scheme", scheme)
+
 	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.OverrideLondon)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
@@ -140,9 +168,15 @@ func New(stack *node.Node, config *avnconfig.Config) (*Avalanria, error) {
 	if err := pruner.RecoverPruning(stack.ResolvePath(""), chainDb, stack.ResolvePath(config.TrieCleanCacheJournal)); err != nil {
 		log.Error("Failed to recover state", "error", err)
 	}
+	// Route all database writes through the online pruner, so the state written
+	// by the chain is never swept by a pruning running in the background
+	onlinePruner := pruner.NewOnlinePruner(chainDb, pruner.DefaultOnlineConfig)
+	chainDb = onlinePruner.Database()
+
 	avn := &Avalanria{
 		config:            config,
 		chainDb:           chainDb,
+		pruner:            onlinePruner,
 		eventMux:          stack.EventMux(),
 		accountManager:    stack.AccountManager(),
 		engine:            avnconfig.CreateConsensusEngine(stack, chainConfig, &avnashConfig, config.Miner.Notify, config.Miner.Noverify, chainDb),
@@ -186,6 +220,10 @@ func New(stack *node.Node, config *avnconfig.Config) (*Avalanria, error) {
 			TrieTimeLimit:       config.TrieTimeout,
 			SnapshotLimit:       config.SnapshotCache,
 			Preimages:           config.Preimages,
+			StateScheme:         scheme,
+			StateHistory:        config.StateHistory,
+			StateDiffs:          config.StateDiffs,
+			StateDiffHistory:    config.StateDiffHistory,
 		}
 	)
 	avn.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, chainConfig, avn.engine, vmConfig, avn.shouldPreserve, &config.TxLookupLimit)
@@ -200,6 +238,10 @@ func New(stack *node.Node, config *avnconfig.Config) (*Avalanria, error) {
 	}
 	avn.bloomIndexer.Start(avn.blockchain)
 
+	if err := avn.pruner.Resume(avn.blockchain); err != nil {
+		log.Error("Failed to resume state pruning", "err", err)
+	}
+
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
@@ -221,6 +263,8 @@ func New(stack *node.Node, config *avnconfig.Config) (*Avalanria, error) {
 		EventMux:   avn.eventMux,
 		Checkpoint: checkpoint,
 		Whitelist:  config.Whitelist,
+
+		SyncCheckpoint: config.SyncCheckpoint,
 	}); err != nil {
 		return nil, err
 	}
@@ -239,7 +283,7 @@ func New(stack *node.Node, config *avnconfig.Config) (*Avalanria, error) {
 	avn.APIBackend.gpo = gasprice.NewOracle(avn.APIBackend, gpoParams)
 
 	// Setup DNS discovery iterators.
-	dnsclient := dnsdisc.NewClient(dnsdisc.Config{})
+	dnsclient := dnsdisc.NewClient(dnsdisc.Config{ResolverAddr: config.DiscoveryDNSResolver})
 	avn.avnDialCandidates, err = dnsclient.NewIterator(avn.config.EthDiscoveryURLs...)
 	if err != nil {
 		return nil, err
@@ -248,6 +292,11 @@ func New(stack *node.Node, config *avnconfig.Config) (*Avalanria, error) {
 	if err != nil {
 		return nil, err
 	}
+	avn.snapServeLimiter = snap.NewServeLimiter(snap.ServeConfig{
+		PeerBytes:    config.SnapServePeerBytes,
+		PeerRequests: config.SnapServePeerRequests,
+		TotalBytes:   config.SnapServeTotalBytes,
+	}, mclock.System{})
 
 	// Start the RPC service
 	avn.netRPCService = avnapi.NewPublicNetAPI(avn.p2pServer, config.NetworkId)
@@ -473,6 +522,14 @@ func (s *Avalanria) StartMining(threads int) error {
 			}
 			clique.Authorize(eb, wallet.SignData)
 		}
+		if ibft, ok := s.engine.(*ibft.Engine); ok {
+			wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+			if wallet == nil || err != nil {
+				log.Error("Etherbase account unavailable locally", "err", err)
+				return fmt.Errorf("validator missing: %v", err)
+			}
+			ibft.Authorize(eb, wallet.SignData)
+		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
 		atomic.StoreUint32(&s.handler.acceptTxs, 1)
@@ -516,7 +573,10 @@ func (s *Avalanria) BloomIndexer() *core.ChainIndexer   { return s.bloomIndexer
 func (s *Avalanria) Protocols() []p2p.Protocol {
 	protos := avn.MakeProtocols((*avnHandler)(s.handler), s.networkID, s.avnDialCandidates)
 	if s.config.SnapshotCache > 0 {
-		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.handler), s.snapDialCandidates)...)
+		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.handler), s.snapDialCandidates, s.snapServeLimiter)...)
+	}
+	if engine, ok := s.engine.(*ibft.Engine); ok {
+		protos = append(protos, engine.Protocols()...)
 	}
 	return protos
 }
@@ -539,9 +599,57 @@ func (s *Avalanria) Start() error {
 	}
 	// Start the networking layer and the light server if requested
 	s.handler.Start(maxPeers)
+
+	// Import the blocks finalized by the validators without waiting for their propagation
+	if engine, ok := s.engine.(*ibft.Engine); ok {
+		go s.importCommitted(engine)
+	}
+	// Track the activity of the clique signers along the canonical chain
+	if engine, ok := s.engine.(*clique.Clique); ok && metrics.Enabled {
+		go s.reportLiveness(engine)
+	}
 	return nil
 }
 
+// reportLiveness updates the clique signer liveness metrics whenever a new block
+// becomes the canonical chain head.
+func (s *Avalanria) reportLiveness(engine *clique.Clique) {
+	headCh := make(chan core.ChainHeadEvent, 16)
+	sub := s.blockchain.SubscribeChainHeadEvent(headCh)
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-headCh:
+			engine.ReportLiveness(s.blockchain, ev.Block.Header())
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+// importCommitted inserts the blocks the IBFT validators agreed upon into the
+// local chain as soon as they are committed.
+func (s *Avalanria) importCommitted(engine *ibft.Engine) {
+	committedCh := make(chan *types.Block, 16)
+	sub := engine.SubscribeCommitted(committedCh)
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case block := <-committedCh:
+			if s.blockchain.HasBlock(block.Hash(), block.NumberU64()) {
+				continue
+			}
+			if _, err := s.blockchain.InsertChain(types.Blocks{block}); err != nil {
+				log.Warn("Failed to import committed block", "number", block.Number(), "hash", block.Hash(), "err", err)
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
 // Stop implements node.Lifecycle, terminating all internal goroutines used by the
 // Avalanria protocol.
 func (s *Avalanria) Stop() error {
@@ -555,6 +663,7 @@ func (s *Avalanria) Stop() error {
 	close(s.closeBloomHandler)
 	s.txPool.Stop()
 	s.miner.Stop()
+	s.pruner.Stop()
 	s.blockchain.Stop()
 	s.engine.Close()
 	rawdb.PopUncleanShutdownMarker(s.chainDb)
@@ -146,7 +146,7 @@ func (api *consensusAPI) AssembleBlock(params assembleBlockParams) (*executableD
 		Extra:      []byte{},
 		Time:       params.Timestamp,
 	}
-	if config := api.avn.BlockChain().Config(); config.IsLondon(header.Number) {
+	if config := api.avn.BlockChain().Config(); config.IsLondon(header.Number, header.Time) {
 		header.BaseFee = misc.CalcBaseFee(config, parent.Header())
 	}
 	err = api.avn.Engine().Prepare(bc, header)
@@ -160,7 +160,7 @@ func (api *consensusAPI) AssembleBlock(params assembleBlockParams) (*executableD
 	}
 
 	var (
-		signer       = types.MakeSigner(bc.Config(), header.Number)
+		signer       = types.MakeSigner(bc.Config(), header.Number, header.Time)
 		txHeap       = types.NewTransactionsByPriceAndNonce(signer, pending, nil)
 		transactions []*types.Transaction
 	)
@@ -272,7 +272,7 @@ func insertBlockParamsToBlock(config *chainParams.ChainConfig, parent *types.Hea
 		GasUsed:     params.GasUsed,
 		Time:        params.Timestamp,
 	}
-	if config.IsLondon(number) {
+	if config.IsLondon(number, header.Time) {
 		header.BaseFee = misc.CalcBaseFee(config, parent)
 	}
 	block := types.NewBlockWithHeader(header).WithBody(txs, nil /* uncles */)
@@ -58,6 +58,7 @@ func (avn *Avalanria) startEthEntryUpdate(ln *enode.LocalNode) {
 }
 
 func (avn *Avalanria) currentEthEntry() *avnEntry {
+	head := avn.blockchain.CurrentHeader()
 	return &avnEntry{ForkID: forkid.NewID(avn.blockchain.Config(), avn.blockchain.Genesis().Hash(),
-		avn.blockchain.CurrentHeader().Number.Uint64())}
+		head.Number.Uint64(), head.Time)}
 }
@@ -0,0 +1,271 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/log"
+)
+
+// SetTrustedCheckpoint sets the hash of an operator trusted block to sync from.
+// The next fast sync cycle retrieves the state at that block instead of a pivot
+// derived from the head advertised by the remote peer, and backfills the chain
+// behind it by walking its ancestry backwards, linking it to the local chain.
+//
+// A zero hash clears the checkpoint.
+func (d *Downloader) SetTrustedCheckpoint(hash common.Hash) {
+	d.trustedLock.Lock()
+	defer d.trustedLock.Unlock()
+
+	d.trusted = hash
+}
+
+// TrustedCheckpoint retrieves the hash of the operator trusted block to sync
+// from, or a zero hash if none was set.
+func (d *Downloader) TrustedCheckpoint() common.Hash {
+	d.trustedLock.RLock()
+	defer d.trustedLock.RUnlock()
+
+	return d.trusted
+}
+
+// pendingCheckpoint returns the hash of the trusted checkpoint to sync from in
+// the given mode, or a zero hash if none was set or it was already reached by
+// the local chain.
+func (d *Downloader) pendingCheckpoint(mode SyncMode) common.Hash {
+	hash := d.TrustedCheckpoint()
+	if mode != FastSync || hash == (common.Hash{}) {
+		return common.Hash{}
+	}
+	if header := d.lightchain.GetHeaderByHash(hash); header != nil && d.blockchain.CurrentBlock().NumberU64() >= header.Number.Uint64() {
+		d.SetTrustedCheckpoint(common.Hash{})
+		return common.Hash{}
+	}
+	return hash
+}
+
+// fetchCheckpoint retrieves the header of the trusted checkpoint, asking the
+// origin peer first and falling back to the other peers if it doesn't know the
+// checkpoint. The peer delivering the checkpoint is returned along with it, to
+// backfill the ancestry from.
+func (d *Downloader) fetchCheckpoint(p *peerConnection, hash common.Hash) (*peerConnection, *types.Header, error) {
+	peers := []*peerConnection{p}
+	for _, peer := range d.peers.AllPeers() {
+		if peer.id != p.id {
+			peers = append(peers, peer)
+		}
+	}
+	for _, peer := range peers {
+		peer.log.Debug("Retrieving trusted checkpoint", "hash", hash)
+
+		headers, err := d.fetchAncestry(peer, hash, 1)
+		if err == nil && headers[0].Hash() != hash {
+			err = fmt.Errorf("%w: checkpoint hash mismatch: have %x, want %x", errBadPeer, headers[0].Hash(), hash)
+		}
+		switch {
+		case err == nil:
+			if headers[0].Number.Uint64() == 0 {
+				return nil, nil, fmt.Errorf("%w: checkpoint is a genesis block", errInvalidAncestor)
+			}
+			return peer, headers[0], nil
+
+		case errors.Is(err, errCheckpointUnavailable):
+			peer.log.Debug("Peer doesn't know the trusted checkpoint", "hash", hash)
+
+		case peer == p || errors.Is(err, errCanceled):
+			return nil, nil, err
+
+		default:
+			d.dropCheckpointSource(peer, err)
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: %x unknown to all %d peers", errCheckpointUnavailable, hash, len(peers))
+}
+
+// dropCheckpointSource penalises and drops a peer, other than the one synced
+// with, which failed to deliver the trusted checkpoint or its ancestry.
+func (d *Downloader) dropCheckpointSource(p *peerConnection, err error) {
+	p.log.Warn("Trusted checkpoint retrieval failed, dropping peer", "err", err)
+	d.report(p.id, errorScore(err))
+	if d.dropPeer != nil {
+		d.dropPeer(p.id)
+	}
+}
+
+// fetchAncestry retrieves a batch of headers from a remote peer, walking the
+// chain backwards starting with the block of the given hash.
+func (d *Downloader) fetchAncestry(p *peerConnection, hash common.Hash, amount int) ([]*types.Header, error) {
+	go p.peer.RequestHeadersByHash(hash, amount, 0, true)
+
+	ttl := d.peers.rates.TargetTimeout()
+	timeout := time.After(ttl)
+	for {
+		select {
+		case <-d.cancelCh:
+			return nil, errCanceled
+
+		case packet := <-d.headerCh:
+			// Discard anything not from the origin peer
+			if packet.PeerId() != p.id {
+				log.Debug("Received headers from incorrect peer", "peer", packet.PeerId())
+				break
+			}
+			// Peers not knowing the block reply with nothing, which is not a
+			// fault of theirs as the checkpoint might be on a chain they don't
+			// follow (yet)
+			headers := packet.(*headerPack).headers
+			if len(headers) == 0 {
+				return nil, fmt.Errorf("%w: ancestry of %x unavailable", errCheckpointUnavailable, hash)
+			}
+			if len(headers) > amount {
+				return nil, fmt.Errorf("%w: returned headers %d > requested %d", errBadPeer, len(headers), amount)
+			}
+			return headers, nil
+
+		case <-timeout:
+			p.log.Debug("Waiting for checkpoint ancestry timed out", "elapsed", ttl)
+			return nil, errTimeout
+
+		case <-d.bodyCh:
+		case <-d.receiptCh:
+			// Out of bounds delivery, ignore
+		}
+	}
+}
+
+// backfillCheckpoint walks the ancestry of the trusted checkpoint backwards from
+// a remote peer, until linking it to the local chain, and returns the number of
+// the local block it was linked to.
+//
+// The headers are only verified to be linked by their hashes, as the ancestry of
+// the trusted block is implicitly trusted too. They are staged in the database,
+// which allows an interrupted backfill to be resumed, and imported later in
+// ascending order.
+func (d *Downloader) backfillCheckpoint(p *peerConnection, checkpoint *types.Header) (uint64, error) {
+	var (
+		head    = d.blockchain.CurrentFastBlock().NumberU64()
+		batch   = d.stateDB.NewBatch()
+		next    = checkpoint
+		pending []*types.Header
+
+		start  = time.Now()
+		logged = time.Now()
+	)
+	rawdb.WriteCheckpointHeader(batch, checkpoint)
+	for {
+		number := next.Number.Uint64()
+		if number == 0 {
+			return 0, fmt.Errorf("%w: checkpoint not on the local chain", errInvalidAncestor)
+		}
+		// If the parent is part of the local chain, the checkpoint is linked
+		if number-1 <= head && d.blockchain.HasFastBlock(next.ParentHash, number-1) {
+			if err := batch.Write(); err != nil {
+				return 0, err
+			}
+			log.Info("Backfilled checkpoint ancestry", "checkpoint", checkpoint.Number, "linked", number-1, "elapsed", common.PrettyDuration(time.Since(start)))
+			return number - 1, nil
+		}
+		// Reuse the parent if it was already staged by a previous run, otherwise
+		// retrieve it from the remote peer
+		parent := rawdb.ReadCheckpointHeader(d.stateDB, number-1)
+		if parent == nil || parent.Hash() != next.ParentHash {
+			if len(pending) == 0 {
+				headers, err := d.fetchAncestry(p, next.ParentHash, MaxHeaderFetch)
+				if err != nil {
+					return 0, err
+				}
+				pending = headers
+			}
+			parent, pending = pending[0], pending[1:]
+			if parent.Hash() != next.ParentHash || parent.Number.Uint64() != number-1 {
+				return 0, fmt.Errorf("%w: checkpoint ancestry broken at #%d [%x..]", errInvalidChain, number-1, next.ParentHash[:4])
+			}
+			rawdb.WriteCheckpointHeader(batch, parent)
+			if batch.ValueSize() > avndb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					return 0, err
+				}
+				batch.Reset()
+			}
+		} else {
+			pending = nil
+		}
+		next = parent
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Backfilling checkpoint ancestry", "checkpoint", checkpoint.Number, "number", number-1, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+}
+
+// fetchCheckpointHeaders feeds the staged ancestry of the trusted checkpoint to
+// the header processor in ascending order, starting with the given number.
+func (d *Downloader) fetchCheckpointHeaders(from uint64, checkpoint *types.Header) error {
+	number := checkpoint.Number.Uint64()
+	for from <= number {
+		headers := make([]*types.Header, 0, MaxHeaderFetch)
+		for ; len(headers) < MaxHeaderFetch && from <= number; from++ {
+			header := rawdb.ReadCheckpointHeader(d.stateDB, from)
+			if header == nil {
+				return fmt.Errorf("checkpoint ancestry #%d missing", from)
+			}
+			headers = append(headers, header)
+		}
+		select {
+		case d.headerProcCh <- headers:
+		case <-d.cancelCh:
+			return errCanceled
+		}
+	}
+	// Notify the content fetchers that no more headers are inbound
+	select {
+	case d.headerProcCh <- nil:
+		return nil
+	case <-d.cancelCh:
+		return errCanceled
+	}
+}
+
+// completeCheckpoint removes the staged ancestry of the trusted checkpoint after
+// it was imported, and clears the checkpoint.
+func (d *Downloader) completeCheckpoint(origin uint64, checkpoint *types.Header) {
+	batch := d.stateDB.NewBatch()
+	for number := origin + 1; number <= checkpoint.Number.Uint64(); number++ {
+		rawdb.DeleteCheckpointHeader(batch, number)
+		if batch.ValueSize() > avndb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				log.Error("Failed to delete checkpoint ancestry", "err", err)
+				return
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to delete checkpoint ancestry", "err", err)
+		return
+	}
+	d.SetTrustedCheckpoint(common.Hash{})
+	log.Info("Synced from trusted checkpoint", "number", checkpoint.Number, "hash", checkpoint.Hash())
+}
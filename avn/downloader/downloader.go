@@ -36,6 +36,7 @@ import (
 	"github.com/avalanria/go-avalanria/event"
 	"github.com/avalanria/go-avalanria/log"
 	"github.com/avalanria/go-avalanria/metrics"
+	"github.com/avalanria/go-avalanria/p2p"
 	"github.com/avalanria/go-avalanria/params"
 	"github.com/avalanria/go-avalanria/trie"
 )
@@ -83,6 +84,7 @@ var (
 	errNoSyncActive            = errors.New("no sync active")
 	errTooOld                  = errors.New("peer's protocol version too old")
 	errNoAncestorFound         = errors.New("no common ancestor found")
+	errCheckpointUnavailable   = errors.New("trusted checkpoint unavailable")
 )
 
 type Downloader struct {
@@ -107,7 +109,8 @@ type Downloader struct {
 	blockchain BlockChain
 
 	// Callbacks
-	dropPeer peerDropFn // Drops a peer for misbehaving
+	dropPeer   peerDropFn   // Drops a peer for misbehaving
+	reportPeer peerReportFn // Reports events affecting the reputation of a peer
 
 	// Status
 	synchroniseMock func(id string, hash common.Hash) error // Replacement for synchronise during testing
@@ -128,6 +131,9 @@ type Downloader struct {
 	pivotHeader *types.Header // Pivot block header to dynamically push the syncing state root
 	pivotLock   sync.RWMutex  // Lock protecting pivot header reads from updates
 
+	trusted     common.Hash  // Operator trusted block hash to sync from (zero if none)
+	trustedLock sync.RWMutex // Lock protecting the trusted checkpoint
+
 	snapSync       bool         // Whavner to run state sync over the snap protocol
 	SnapSyncer     *snap.Syncer // TODO(karalabe): make private! hack for now
 	stateSyncStart chan *stateSync
@@ -237,6 +243,36 @@ func New(checkpoint uint64, stateDb avndb.Database, stateBloom *trie.SyncBloom,
 	return dl
 }
 
+// SetPeerReporter sets the callback to report the events affecting the reputation
+// of the peers to. It must be called before synchronising.
+func (d *Downloader) SetPeerReporter(reportPeer peerReportFn) {
+	d.reportPeer = reportPeer
+}
+
+// report notifies the peer reporter, if set, of an event affecting the reputation
+// of a peer.
+func (d *Downloader) report(id string, event p2p.ScoreEvent) {
+	if d.reportPeer != nil {
+		d.reportPeer(id, event)
+	}
+}
+
+// errorScore returns the reputation event caused by a failed synchronisation.
+func errorScore(err error) p2p.ScoreEvent {
+	switch {
+	case errors.Is(err, errTimeout) || errors.Is(err, errStallingPeer):
+		return p2p.ScoreTimeout
+	case errors.Is(err, errUnsyncedPeer) || errors.Is(err, errEmptyHeaderSet) || errors.Is(err, errPeersUnavailable) || errors.Is(err, errTooOld):
+		return p2p.ScoreUseless
+	case errors.Is(err, errInvalidAncestor):
+		// The peer's chain forked off below our checkpoint or the reorg allowance,
+		// it's on a different chain, but didn't deliver anything invalid
+		return p2p.ScoreUseless
+	default:
+		return p2p.ScoreInvalid
+	}
+}
+
 // Progress retrieves the synchronisation boundaries, specifically the origin
 // block where synchronisation started at (may have failed/suspended); the block
 // or header sync is currently at; and the latest known block which the sync targets.
@@ -326,13 +362,23 @@ func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode
 	err := d.synchronise(id, head, td, mode)
 
 	switch err {
-	case nil, errBusy, errCanceled:
+	case nil:
+		d.report(id, p2p.ScoreUseful)
+		return nil
+	case errBusy, errCanceled:
+		return err
+	}
+	if errors.Is(err, errCheckpointUnavailable) {
+		// None of the peers could deliver the trusted checkpoint, which is not a
+		// fault of theirs, keep them and retry later
+		log.Warn("Trusted checkpoint not available from any peer, waiting for more", "checkpoint", d.TrustedCheckpoint(), "peers", d.peers.Len(), "err", err)
 		return err
 	}
 	if errors.Is(err, errInvalidChain) || errors.Is(err, errBadPeer) || errors.Is(err, errTimeout) ||
 		errors.Is(err, errStallingPeer) || errors.Is(err, errUnsyncedPeer) || errors.Is(err, errEmptyHeaderSet) ||
 		errors.Is(err, errPeersUnavailable) || errors.Is(err, errTooOld) || errors.Is(err, errInvalidAncestor) {
 		log.Warn("Synchronisation failed, dropping peer", "peer", id, "err", err)
+		d.report(id, errorScore(err))
 		if d.dropPeer == nil {
 			// The dropPeer mavnod is nil when `--copydb` is used for a local copy.
 			// Timeouts can occur if e.g. compaction hits at the wrong time, and can be ignored
@@ -459,23 +505,45 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 	}(time.Now())
 
 	// Look up the sync boundaries: the common ancestor and the target block
-	latest, pivot, err := d.fetchHead(p)
-	if err != nil {
-		return err
-	}
-	if mode == FastSync && pivot == nil {
-		// If no pivot block was returned, the head is below the min full block
-		// threshold (i.e. new chian). In that case we won't really fast sync
-		// anyway, but still need a valid pivot block to avoid some code hitting
-		// nil panics on an access.
-		pivot = d.blockchain.CurrentBlock().Header()
+	var (
+		latest, pivot *types.Header
+		origin        uint64
+		checkpoint    = d.pendingCheckpoint(mode)
+	)
+	if checkpoint != (common.Hash{}) {
+		// Syncing from a trusted checkpoint, pin it as both the target and the
+		// pivot block and link it to the local chain through its ancestry. The
+		// origin peer might not know the checkpoint, so it's retrieved from any
+		// peer that does.
+		var source *peerConnection
+		if source, latest, err = d.fetchCheckpoint(p, checkpoint); err != nil {
+			return err
+		}
+		if origin, err = d.backfillCheckpoint(source, latest); err != nil {
+			if source != p && !errors.Is(err, errCanceled) {
+				d.dropCheckpointSource(source, err)
+				return fmt.Errorf("%w: ancestry retrieval from %s failed", errCheckpointUnavailable, source.id)
+			}
+			return err
+		}
+		pivot = latest
+	} else {
+		if latest, pivot, err = d.fetchHead(p); err != nil {
+			return err
+		}
+		if mode == FastSync && pivot == nil {
+			// If no pivot block was returned, the head is below the min full block
+			// threshold (i.e. new chian). In that case we won't really fast sync
+			// anyway, but still need a valid pivot block to avoid some code hitting
+			// nil panics on an access.
+			pivot = d.blockchain.CurrentBlock().Header()
+		}
+		if origin, err = d.findAncestor(p, latest); err != nil {
+			return err
+		}
 	}
 	height := latest.Number.Uint64()
 
-	origin, err := d.findAncestor(p, latest)
-	if err != nil {
-		return err
-	}
 	d.syncStatsLock.Lock()
 	if d.syncStatsChainHeight <= origin || d.syncStatsChainOrigin > origin {
 		d.syncStatsChainOrigin = origin
@@ -485,7 +553,7 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 
 	// Ensure our origin point is below any fast sync pivot point
 	if mode == FastSync {
-		if height <= uint64(fsMinFullBlocks) {
+		if height <= uint64(fsMinFullBlocks) && checkpoint == (common.Hash{}) {
 			origin = 0
 		} else {
 			pivotNumber := pivot.Number.Uint64()
@@ -516,7 +584,12 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		// The peer would start to feed us valid blocks until head, resulting in all of
 		// the blocks might be written into the ancient store. A following mini-reorg
 		// could cause issues.
-		if d.checkpoint != 0 && d.checkpoint > fullMaxForkAncestry+1 {
+		//
+		// When syncing from a trusted checkpoint, its entire ancestry is final and
+		// can be written into the ancient store directly.
+		if checkpoint != (common.Hash{}) {
+			d.ancientLimit = height - 1
+		} else if d.checkpoint != 0 && d.checkpoint > fullMaxForkAncestry+1 {
 			d.ancientLimit = d.checkpoint
 		} else if height > fullMaxForkAncestry+1 {
 			d.ancientLimit = height - fullMaxForkAncestry - 1
@@ -551,6 +624,13 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		func() error { return d.fetchReceipts(origin + 1) }, // Receipts are retrieved during fast sync
 		func() error { return d.processHeaders(origin+1, td) },
 	}
+	if checkpoint != (common.Hash{}) {
+		// The headers up to the checkpoint are already staged locally, and the
+		// remote chain beyond it is not synced, so the peer's total difficulty
+		// can't be checked against the imported headers.
+		fetchers[0] = func() error { return d.fetchCheckpointHeaders(origin+1, latest) }
+		fetchers[3] = func() error { return d.processHeaders(origin+1, new(big.Int)) }
+	}
 	if mode == FastSync {
 		d.pivotLock.Lock()
 		d.pivotHeader = pivot
@@ -560,7 +640,13 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 	} else if mode == FullSync {
 		fetchers = append(fetchers, d.processFullSyncContent)
 	}
-	return d.spawnSync(fetchers)
+	if err := d.spawnSync(fetchers); err != nil {
+		return err
+	}
+	if checkpoint != (common.Hash{}) {
+		d.completeCheckpoint(origin, latest)
+	}
+	return nil
 }
 
 // spawnSync runs d.process and all given fetcher functions to completion in
@@ -1217,7 +1303,7 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 			case d.headerProcCh <- nil:
 			case <-d.cancelCh:
 			}
-			return fmt.Errorf("%w: header request timed out", errBadPeer)
+			return fmt.Errorf("%w: header request timed out", errTimeout)
 		}
 	}
 }
@@ -1440,6 +1526,7 @@ func (d *Downloader) fetchParts(deliveryCh chan dataPack, deliver func(dataPack)
 								d.cancel()
 								return errTimeout
 							}
+							d.report(pid, p2p.ScoreTimeout)
 						}
 					}
 				}
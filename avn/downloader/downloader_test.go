@@ -1711,3 +1711,61 @@ func testCheckpointEnforcement(t *testing.T, protocol uint, mode SyncMode) {
 		assertOwnChain(t, tester, chain.len())
 	}
 }
+
+// Tests that syncing from a trusted checkpoint retrieves the chain up to the
+// checkpoint, linking it to the local chain through its ancestry, and that the
+// chain beyond it is synced afterwards. Peers not knowing the checkpoint must
+// not be dropped, it should be retrieved from the other peers instead.
+func TestTrustedCheckpointSync65(t *testing.T) { testTrustedCheckpointSync(t, avn.AVN65) }
+func TestTrustedCheckpointSync66(t *testing.T) { testTrustedCheckpointSync(t, avn.AVN66) }
+
+func testTrustedCheckpointSync(t *testing.T, protocol uint) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	chain := testChainBase.shorten(blockCacheMaxItems - 15)
+	tester.newPeer("peer", protocol, chain)
+
+	// A checkpoint unknown to all peers must fail the sync, but keep the peers
+	tester.downloader.SetTrustedCheckpoint(common.Hash{0x01})
+	if err := tester.sync("peer", nil, FastSync); !errors.Is(err, errCheckpointUnavailable) {
+		t.Fatalf("unknown checkpoint sync error mismatch: have %v, want %v", err, errCheckpointUnavailable)
+	}
+	if tester.downloader.peers.Peer("peer") == nil {
+		t.Fatalf("peer dropped for not knowing the checkpoint")
+	}
+	assertOwnChain(t, tester, 1)
+
+	// Sync from a checkpoint whose ancestry spans multiple header batches, with
+	// a peer not knowing it, which should retrieve it from the other peer
+	number := chain.len() / 2
+	checkpoint := chain.chain[number]
+	tester.newPeer("behind", protocol, chain.shorten(number))
+
+	tester.downloader.SetTrustedCheckpoint(checkpoint)
+	if err := tester.sync("behind", nil, FastSync); err != nil {
+		t.Fatalf("failed to sync from checkpoint: %v", err)
+	}
+	if tester.downloader.peers.Peer("behind") == nil {
+		t.Fatalf("peer dropped for not knowing the checkpoint")
+	}
+	assertOwnChain(t, tester, number+1)
+	if head := tester.CurrentBlock(); head.Hash() != checkpoint {
+		t.Fatalf("head block mismatch: have #%d [%x..], want #%d [%x..]", head.Number(), head.Hash().Bytes()[:4], number, checkpoint[:4])
+	}
+	if hash := tester.downloader.TrustedCheckpoint(); hash != (common.Hash{}) {
+		t.Fatalf("checkpoint not cleared after sync: %x", hash)
+	}
+	for i := 1; i <= number; i++ {
+		if rawdb.ReadCheckpointHeader(tester.stateDb, uint64(i)) != nil {
+			t.Fatalf("staged checkpoint header #%d not removed", i)
+		}
+	}
+	// Sync the chain beyond the checkpoint
+	if err := tester.sync("peer", nil, FullSync); err != nil {
+		t.Fatalf("failed to sync beyond checkpoint: %v", err)
+	}
+	assertOwnChain(t, tester, chain.len())
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/avalanria/go-avalanria/crypto"
 	"github.com/avalanria/go-avalanria/avndb"
 	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/p2p"
 	"github.com/avalanria/go-avalanria/trie"
 	"golang.org/x/crypto/sha3"
 )
@@ -394,6 +395,7 @@ func (s *stateSync) loop() (err error) {
 						s.d.cancel()
 						return errTimeout
 					}
+					s.d.report(req.peer.id, p2p.ScoreTimeout)
 				}
 			}
 			// Process all the received blobs and check for stale delivery
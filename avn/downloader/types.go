@@ -20,11 +20,16 @@ import (
 	"fmt"
 
 	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/p2p"
 )
 
 // peerDropFn is a callback type for dropping a peer detected as malicious.
 type peerDropFn func(id string)
 
+// peerReportFn is a callback type for reporting an event affecting the reputation
+// of a peer.
+type peerReportFn func(id string, event p2p.ScoreEvent)
+
 // dataPack is a data message returned by a peer for some query.
 type dataPack interface {
 	PeerId() string
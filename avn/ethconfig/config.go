@@ -28,6 +28,7 @@ import (
 	"github.com/avalanria/go-avalanria/common"
 	"github.com/avalanria/go-avalanria/consensus"
 	"github.com/avalanria/go-avalanria/consensus/clique"
+	"github.com/avalanria/go-avalanria/consensus/ibft"
 	"github.com/avalanria/go-avalanria/consensus/avnash"
 	"github.com/avalanria/go-avalanria/core"
 	"github.com/avalanria/go-avalanria/avn/downloader"
@@ -126,11 +127,23 @@ type Config struct {
 	NetworkId uint64 // Network ID to use for selecting peers to connect to
 	SyncMode  downloader.SyncMode
 
+	// Operator trusted block hash to sync the state at, backfilling the chain
+	// behind it, instead of syncing from the genesis.
+	SyncCheckpoint common.Hash `toml:",omitempty"`
+
 	// This can be set to list of enrtree:// URLs which will be queried for
 	// for nodes to connect to.
 	EthDiscoveryURLs  []string
 	SnapDiscoveryURLs []string
 
+	// DNS server queried for the discovery trees instead of the system resolver.
+	DiscoveryDNSResolver string `toml:",omitempty"`
+
+	// Budgets limiting the data served to remote `snap` syncers, 0 = unlimited.
+	SnapServePeerBytes    uint64 `toml:",omitempty"` // Maximum bytes served to a single peer per second
+	SnapServePeerRequests uint64 `toml:",omitempty"` // Maximum requests served to a single peer per second
+	SnapServeTotalBytes   uint64 `toml:",omitempty"` // Maximum bytes served to all peers per second
+
 	NoPruning  bool // Whavner to disable pruning and flush everything to disk
 	NoPrefetch bool // Whavner to disable prefetching and only load state on demand
 
@@ -166,6 +179,10 @@ type Config struct {
 	TrieTimeout             time.Duration
 	SnapshotCache           int
 	Preimages               bool
+	StateScheme             string `toml:",omitempty"` // Scheme used to store the trie nodes of the state (hash or path)
+	StateHistory            uint64 `toml:",omitempty"` // Number of recent states to retain reverse diffs for with the path-based scheme
+	StateDiffs              bool   `toml:",omitempty"` // Whavner to record the reverse state diffs of blocks to serve historical state
+	StateDiffHistory        uint64 `toml:",omitempty"` // Number of recent blocks to retain state diffs for (0 = entire chain)
 
 	// Mining options
 	Miner miner.Config
@@ -208,6 +225,10 @@ func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, co
 	if chainConfig.Clique != nil {
 		return clique.New(chainConfig.Clique, db)
 	}
+	// If byzantine fault tolerance is requested, set it up
+	if chainConfig.IBFT != nil {
+		return ibft.New(chainConfig.IBFT, db)
+	}
 	// Otherwise assume proof-of-work
 	switch config.PowMode {
 	case avnash.ModeFake:
@@ -21,8 +21,13 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               uint64
 		SyncMode                downloader.SyncMode
+		SyncCheckpoint          common.Hash `toml:",omitempty"`
 		EthDiscoveryURLs        []string
 		SnapDiscoveryURLs       []string
+		DiscoveryDNSResolver    string `toml:",omitempty"`
+		SnapServePeerBytes      uint64 `toml:",omitempty"`
+		SnapServePeerRequests   uint64 `toml:",omitempty"`
+		SnapServeTotalBytes     uint64 `toml:",omitempty"`
 		NoPruning               bool
 		NoPrefetch              bool
 		TxLookupLimit           uint64                 `toml:",omitempty"`
@@ -48,6 +53,10 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		TrieTimeout             time.Duration
 		SnapshotCache           int
 		Preimages               bool
+		StateScheme             string `toml:",omitempty"`
+		StateHistory            uint64 `toml:",omitempty"`
+		StateDiffs              bool   `toml:",omitempty"`
+		StateDiffHistory        uint64 `toml:",omitempty"`
 		Miner                   miner.Config
 		Ethash                  avnash.Config
 		TxPool                  core.TxPoolConfig
@@ -64,8 +73,13 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Genesis = c.Genesis
 	enc.NetworkId = c.NetworkId
 	enc.SyncMode = c.SyncMode
+	enc.SyncCheckpoint = c.SyncCheckpoint
 	enc.EthDiscoveryURLs = c.EthDiscoveryURLs
 	enc.SnapDiscoveryURLs = c.SnapDiscoveryURLs
+	enc.DiscoveryDNSResolver = c.DiscoveryDNSResolver
+	enc.SnapServePeerBytes = c.SnapServePeerBytes
+	enc.SnapServePeerRequests = c.SnapServePeerRequests
+	enc.SnapServeTotalBytes = c.SnapServeTotalBytes
 	enc.NoPruning = c.NoPruning
 	enc.NoPrefetch = c.NoPrefetch
 	enc.TxLookupLimit = c.TxLookupLimit
@@ -91,6 +105,10 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.TrieTimeout = c.TrieTimeout
 	enc.SnapshotCache = c.SnapshotCache
 	enc.Preimages = c.Preimages
+	enc.StateScheme = c.StateScheme
+	enc.StateHistory = c.StateHistory
+	enc.StateDiffs = c.StateDiffs
+	enc.StateDiffHistory = c.StateDiffHistory
 	enc.Miner = c.Miner
 	enc.Ethash = c.Ethash
 	enc.TxPool = c.TxPool
@@ -111,8 +129,13 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               *uint64
 		SyncMode                *downloader.SyncMode
+		SyncCheckpoint          *common.Hash `toml:",omitempty"`
 		EthDiscoveryURLs        []string
 		SnapDiscoveryURLs       []string
+		DiscoveryDNSResolver    *string `toml:",omitempty"`
+		SnapServePeerBytes      *uint64 `toml:",omitempty"`
+		SnapServePeerRequests   *uint64 `toml:",omitempty"`
+		SnapServeTotalBytes     *uint64 `toml:",omitempty"`
 		NoPruning               *bool
 		NoPrefetch              *bool
 		TxLookupLimit           *uint64                `toml:",omitempty"`
@@ -138,6 +161,10 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		TrieTimeout             *time.Duration
 		SnapshotCache           *int
 		Preimages               *bool
+		StateScheme             *string `toml:",omitempty"`
+		StateHistory            *uint64 `toml:",omitempty"`
+		StateDiffs              *bool   `toml:",omitempty"`
+		StateDiffHistory        *uint64 `toml:",omitempty"`
 		Miner                   *miner.Config
 		Ethash                  *avnash.Config
 		TxPool                  *core.TxPoolConfig
@@ -163,12 +190,27 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.SyncMode != nil {
 		c.SyncMode = *dec.SyncMode
 	}
+	if dec.SyncCheckpoint != nil {
+		c.SyncCheckpoint = *dec.SyncCheckpoint
+	}
 	if dec.EthDiscoveryURLs != nil {
 		c.EthDiscoveryURLs = dec.EthDiscoveryURLs
 	}
 	if dec.SnapDiscoveryURLs != nil {
 		c.SnapDiscoveryURLs = dec.SnapDiscoveryURLs
 	}
+	if dec.DiscoveryDNSResolver != nil {
+		c.DiscoveryDNSResolver = *dec.DiscoveryDNSResolver
+	}
+	if dec.SnapServePeerBytes != nil {
+		c.SnapServePeerBytes = *dec.SnapServePeerBytes
+	}
+	if dec.SnapServePeerRequests != nil {
+		c.SnapServePeerRequests = *dec.SnapServePeerRequests
+	}
+	if dec.SnapServeTotalBytes != nil {
+		c.SnapServeTotalBytes = *dec.SnapServeTotalBytes
+	}
 	if dec.NoPruning != nil {
 		c.NoPruning = *dec.NoPruning
 	}
@@ -244,6 +286,18 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.Preimages != nil {
 		c.Preimages = *dec.Preimages
 	}
+	if dec.StateScheme != nil {
+		c.StateScheme = *dec.StateScheme
+	}
+	if dec.StateHistory != nil {
+		c.StateHistory = *dec.StateHistory
+	}
+	if dec.StateDiffs != nil {
+		c.StateDiffs = *dec.StateDiffs
+	}
+	if dec.StateDiffHistory != nil {
+		c.StateDiffHistory = *dec.StateDiffHistory
+	}
 	if dec.Miner != nil {
 		c.Miner = *dec.Miner
 	}
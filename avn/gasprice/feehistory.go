@@ -85,7 +85,8 @@ func (oracle *Oracle) processBlock(bf *blockFees, percentiles []float64) {
 	if bf.baseFee = bf.header.BaseFee; bf.baseFee == nil {
 		bf.baseFee = new(big.Int)
 	}
-	if chainconfig.IsLondon(big.NewInt(int64(bf.blockNumber + 1))) {
+	// The next block's timestamp is unknown, assume the earliest one possible
+	if chainconfig.IsLondon(big.NewInt(int64(bf.blockNumber+1)), bf.header.Time+1) {
 		bf.nextBaseFee = misc.CalcBaseFee(chainconfig, bf.header)
 	} else {
 		bf.nextBaseFee = new(big.Int)
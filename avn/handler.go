@@ -85,6 +85,8 @@ type handlerConfig struct {
 	EventMux   *event.TypeMux            // Legacy event mux, deprecate for `feed`
 	Checkpoint *params.TrustedCheckpoint // Hard coded checkpoint for sync challenges
 	Whitelist  map[uint64]common.Hash    // Hard coded whitelist for sync challenged
+
+	SyncCheckpoint common.Hash // Operator trusted block hash to sync from
 }
 
 type handler struct {
@@ -185,6 +187,12 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		h.stateBloom = trie.NewSyncBloom(config.BloomCache, config.Database)
 	}
 	h.downloader = downloader.New(h.checkpointNumber, config.Database, h.stateBloom, h.eventMux, h.chain, nil, h.removePeer)
+	h.downloader.SetPeerReporter(h.reportPeer)
+	if config.SyncCheckpoint != (common.Hash{}) {
+		if err := h.syncFromCheckpoint(config.SyncCheckpoint); err != nil {
+			return nil, err
+		}
+	}
 
 	// Construct the fetcher (short sync)
 	validator := func(header *types.Header) error {
@@ -219,7 +227,7 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		}
 		return n, err
 	}
-	h.blockFetcher = fetcher.NewBlockFetcher(false, nil, h.chain.GetBlockByHash, validator, h.BroadcastBlock, heighter, nil, inserter, h.removePeer)
+	h.blockFetcher = fetcher.NewBlockFetcher(false, nil, h.chain.GetBlockByHash, validator, h.BroadcastBlock, heighter, nil, inserter, h.dropInvalidPeer)
 
 	fetchTx := func(peer string, hashes []common.Hash) error {
 		p := h.peers.peer(peer)
@@ -258,7 +266,7 @@ func (h *handler) runEthPeer(peer *avn.Peer, handler avn.Handler) error {
 		number  = head.Number.Uint64()
 		td      = h.chain.GetTd(hash, number)
 	)
-	forkID := forkid.NewID(h.chain.Config(), h.chain.Genesis().Hash(), h.chain.CurrentHeader().Number.Uint64())
+	forkID := forkid.NewID(h.chain.Config(), genesis.Hash(), number, head.Time)
 	if err := peer.Handshake(h.networkID, td, hash, genesis.Hash(), forkID, h.forkFilter); err != nil {
 		peer.Log().Debug("Avalanria handshake failed", "err", err)
 		return err
@@ -319,6 +327,7 @@ func (h *handler) runEthPeer(peer *avn.Peer, handler avn.Handler) error {
 		// Start a timer to disconnect if the peer doesn't reply in time
 		p.syncDrop = time.AfterFunc(syncChallengeTimeout, func() {
 			peer.Log().Warn("Checkpoint challenge timed out, dropping", "addr", peer.RemoteAddr(), "type", peer.Name())
+			peer.Report(p2p.ScoreTimeout)
 			h.removePeer(peer.ID())
 		})
 		// Make sure it's cleaned up if the peer dies off
@@ -362,6 +371,21 @@ func (h *handler) removePeer(id string) {
 	}
 }
 
+// dropInvalidPeer lowers the reputation of a peer which delivered invalid data and
+// requests its disconnection.
+func (h *handler) dropInvalidPeer(id string) {
+	h.reportPeer(id, p2p.ScoreInvalid)
+	h.removePeer(id)
+}
+
+// reportPeer reports an event affecting the reputation of a peer.
+func (h *handler) reportPeer(id string, event p2p.ScoreEvent) {
+	peer := h.peers.peer(id)
+	if peer != nil {
+		peer.Peer.Report(event)
+	}
+}
+
 // unregisterPeer removes a peer from the downloader, fetchers and main peer set.
 func (h *handler) unregisterPeer(id string) {
 	// Create a custom logger to avoid printing the entire id
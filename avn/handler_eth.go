@@ -28,6 +28,7 @@ import (
 	"github.com/avalanria/go-avalanria/core/types"
 	"github.com/avalanria/go-avalanria/avn/protocols/avn"
 	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/p2p"
 	"github.com/avalanria/go-avalanria/p2p/enode"
 	"github.com/avalanria/go-avalanria/trie"
 )
@@ -122,6 +123,7 @@ func (h *avnHandler) handleHeaders(peer *avn.Peer, headers []*types.Header) erro
 		// joining the network
 		if atomic.LoadUint32(&h.fastSync) == 1 {
 			peer.Log().Warn("Dropping unsynced node during sync", "addr", peer.RemoteAddr(), "type", peer.Name())
+			peer.Report(p2p.ScoreUseless)
 			return errors.New("unsynced node cannot serve sync")
 		}
 	}
@@ -136,6 +138,7 @@ func (h *avnHandler) handleHeaders(peer *avn.Peer, headers []*types.Header) erro
 
 			// Validate the header and either drop the peer or continue
 			if headers[0].Hash() != h.checkpointHash {
+				peer.Report(p2p.ScoreUseless)
 				return errors.New("checkpoint hash mismatch")
 			}
 			return nil
@@ -144,6 +147,7 @@ func (h *avnHandler) handleHeaders(peer *avn.Peer, headers []*types.Header) erro
 		if want, ok := h.whitelist[headers[0].Number.Uint64()]; ok {
 			if hash := headers[0].Hash(); want != hash {
 				peer.Log().Info("Whitelist mismatch, dropping peer", "number", headers[0].Number.Uint64(), "hash", hash, "want", want)
+				peer.Report(p2p.ScoreUseless)
 				return errors.New("whitelist block mismatch")
 			}
 			peer.Log().Debug("Whitelist block verified", "number", headers[0].Number.Uint64(), "hash", want)
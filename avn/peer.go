@@ -57,7 +57,8 @@ func (p *avnPeer) info() *avnPeerInfo {
 // snapPeerInfo represents a short summary of the `snap` sub-protocol metadata known
 // about a connected peer.
 type snapPeerInfo struct {
-	Version uint `json:"version"` // Snapshot protocol version negotiated
+	Version uint            `json:"version"` // Snapshot protocol version negotiated
+	Serving snap.ServeStats `json:"serving"` // Statistics of the data served to the peer
 }
 
 // snapPeer is a wrapper around snap.Peer to maintain a few extra metadata.
@@ -69,5 +70,6 @@ type snapPeer struct {
 func (p *snapPeer) info() *snapPeerInfo {
 	return &snapPeerInfo{
 		Version: p.Version(),
+		Serving: p.ServeStats(),
 	}
 }
@@ -17,6 +17,7 @@
 package avn
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
@@ -208,12 +209,19 @@ var avn66 = map[uint64]msgHandler{
 
 // handleMessage is invoked whenever an inbound message is received from a remote
 // peer. The remote connection is torn down upon returning any error.
-func handleMessage(backend Backend, peer *Peer) error {
+func handleMessage(backend Backend, peer *Peer) (err error) {
 	// Read the next message from the remote peer, and ensure it's fully consumed
 	msg, err := peer.rw.ReadMsg()
 	if err != nil {
 		return err
 	}
+	// Lower the reputation of peers violating the protocol. Failures of the backend
+	// to handle a message are left for the backend to judge.
+	defer func() {
+		if errors.Is(err, errMsgTooLarge) || errors.Is(err, errDecode) || errors.Is(err, errInvalidMsgCode) {
+			peer.Report(p2p.ScoreInvalid)
+		}
+	}()
 	if msg.Size > maxMessageSize {
 		return fmt.Errorf("%w: %v > %v", errMsgTooLarge, msg.Size, maxMessageSize)
 	}
@@ -17,6 +17,7 @@
 package avn
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
@@ -51,7 +52,15 @@ func (p *Peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis
 		})
 	}()
 	go func() {
-		errc <- p.readStatus(network, &status, genesis, forkFilter)
+		err := p.readStatus(network, &status, genesis, forkFilter)
+		switch {
+		case errors.Is(err, errNetworkIDMismatch) || errors.Is(err, errGenesisMismatch) || errors.Is(err, errForkIDRejected):
+			// Peers on other chains are of no use, avoid reconnecting to them
+			p.Report(p2p.ScoreUseless)
+		case errors.Is(err, errNoStatusMsg) || errors.Is(err, errMsgTooLarge) || errors.Is(err, errDecode):
+			p.Report(p2p.ScoreInvalid)
+		}
+		errc <- err
 	}()
 	timeout := time.NewTimer(handshakeTimeout)
 	defer timeout.Stop()
@@ -82,8 +82,9 @@ type Backend interface {
 	Handle(peer *Peer, packet Packet) error
 }
 
-// MakeProtocols constructs the P2P protocol definitions for `snap`.
-func MakeProtocols(backend Backend, dnsdisc enode.Iterator) []p2p.Protocol {
+// MakeProtocols constructs the P2P protocol definitions for `snap`. The data
+// served to remote peers is limited by the limiter, or unlimited if it's nil.
+func MakeProtocols(backend Backend, dnsdisc enode.Iterator, limiter *ServeLimiter) []p2p.Protocol {
 	// Filter the discovery iterator for nodes advertising snap support.
 	dnsdisc = enode.Filter(dnsdisc, func(n *enode.Node) bool {
 		var snap enrEntry
@@ -99,7 +100,10 @@ func MakeProtocols(backend Backend, dnsdisc enode.Iterator) []p2p.Protocol {
 			Version: version,
 			Length:  protocolLengths[version],
 			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
-				return backend.RunPeer(newPeer(version, p, rw), func(peer *Peer) error {
+				peer := newPeer(version, p, rw, limiter)
+				defer peer.serve.close()
+
+				return backend.RunPeer(peer, func(peer *Peer) error {
 					return handle(backend, peer)
 				})
 			},
@@ -130,12 +134,19 @@ func handle(backend Backend, peer *Peer) error {
 // handleMessage is invoked whenever an inbound message is received from a
 // remote peer on the `snap` protocol. The remote connection is torn down upon
 // returning any error.
-func handleMessage(backend Backend, peer *Peer) error {
+func handleMessage(backend Backend, peer *Peer) (err error) {
 	// Read the next message from the remote peer, and ensure it's fully consumed
 	msg, err := peer.rw.ReadMsg()
 	if err != nil {
 		return err
 	}
+	// Failing to handle a message is either a protocol violation or an invalid
+	// delivery, lower the reputation of the peer either way
+	defer func() {
+		if err != nil {
+			peer.Report(p2p.ScoreInvalid)
+		}
+	}()
 	if msg.Size > maxMessageSize {
 		return fmt.Errorf("%w: %v > %v", errMsgTooLarge, msg.Size, maxMessageSize)
 	}
@@ -164,61 +175,11 @@ func handleMessage(backend Backend, peer *Peer) error {
 		if req.Bytes > softResponseLimit {
 			req.Bytes = softResponseLimit
 		}
-		// Retrieve the requested state and bail out if non existent
-		tr, err := trie.New(req.Root, backend.Chain().StateCache().TrieDB())
-		if err != nil {
-			return p2p.Send(peer.rw, AccountRangeMsg, &AccountRangePacket{ID: req.ID})
-		}
-		it, err := backend.Chain().Snapshots().AccountIterator(req.Root, req.Origin)
-		if err != nil {
-			return p2p.Send(peer.rw, AccountRangeMsg, &AccountRangePacket{ID: req.ID})
-		}
-		// Iterate over the requested range and pile accounts up
-		var (
-			accounts []*AccountData
-			size     uint64
-			last     common.Hash
-		)
-		for it.Next() && size < req.Bytes {
-			hash, account := it.Hash(), common.CopyBytes(it.Account())
-
-			// Track the returned interval for the Merkle proofs
-			last = hash
-
-			// Assemble the reply item
-			size += uint64(common.HashLength + len(account))
-			accounts = append(accounts, &AccountData{
-				Hash: hash,
-				Body: account,
-			})
-			// If we've exceeded the request threshold, abort
-			if bytes.Compare(hash[:], req.Limit[:]) >= 0 {
-				break
-			}
-		}
-		it.Release()
-
-		// Generate the Merkle proofs for the first and last account
-		proof := light.NewNodeSet()
-		if err := tr.Prove(req.Origin[:], 0, proof); err != nil {
-			log.Warn("Failed to prove account range", "origin", req.Origin, "err", err)
-			return p2p.Send(peer.rw, AccountRangeMsg, &AccountRangePacket{ID: req.ID})
-		}
-		if last != (common.Hash{}) {
-			if err := tr.Prove(last[:], 0, proof); err != nil {
-				log.Warn("Failed to prove account range", "last", last, "err", err)
-				return p2p.Send(peer.rw, AccountRangeMsg, &AccountRangePacket{ID: req.ID})
-			}
-		}
-		var proofs [][]byte
-		for _, blob := range proof.NodeList() {
-			proofs = append(proofs, blob)
-		}
-		// Send back anything accumulated
-		return p2p.Send(peer.rw, AccountRangeMsg, &AccountRangePacket{
-			ID:       req.ID,
-			Accounts: accounts,
-			Proof:    proofs,
+		req.Bytes = peer.serve.limit(req.Bytes)
+		return peer.serve.schedule(func() error {
+			return serveAccountRange(backend, peer, &req)
+		}, func() error {
+			return reply(peer, AccountRangeMsg, &AccountRangePacket{ID: req.ID})
 		})
 
 	case msg.Code == AccountRangeMsg:
@@ -234,6 +195,8 @@ func handleMessage(backend Backend, peer *Peer) error {
 			}
 		}
 		requestTracker.Fulfil(peer.id, peer.version, AccountRangeMsg, res.ID)
+		peer.serve.delivery()
+		peer.Report(p2p.ScoreUseful)
 
 		return backend.Handle(peer, res)
 
@@ -246,112 +209,11 @@ func handleMessage(backend Backend, peer *Peer) error {
 		if req.Bytes > softResponseLimit {
 			req.Bytes = softResponseLimit
 		}
-		// TODO(karalabe): Do we want to enforce > 0 accounts and 1 account if origin is set?
-		// TODO(karalabe):   - Logging locally is not ideal as remote faulst annoy the local user
-		// TODO(karalabe):   - Dropping the remote peer is less flexible wrt client bugs (slow is better than non-functional)
-
-		// Calculate the hard limit at which to abort, even if mid storage trie
-		hardLimit := uint64(float64(req.Bytes) * (1 + stateLookupSlack))
-
-		// Retrieve storage ranges until the packet limit is reached
-		var (
-			slots  [][]*StorageData
-			proofs [][]byte
-			size   uint64
-		)
-		for _, account := range req.Accounts {
-			// If we've exceeded the requested data limit, abort without opening
-			// a new storage range (that we'd need to prove due to exceeded size)
-			if size >= req.Bytes {
-				break
-			}
-			// The first account might start from a different origin and end sooner
-			var origin common.Hash
-			if len(req.Origin) > 0 {
-				origin, req.Origin = common.BytesToHash(req.Origin), nil
-			}
-			var limit = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
-			if len(req.Limit) > 0 {
-				limit, req.Limit = common.BytesToHash(req.Limit), nil
-			}
-			// Retrieve the requested state and bail out if non existent
-			it, err := backend.Chain().Snapshots().StorageIterator(req.Root, account, origin)
-			if err != nil {
-				return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
-			}
-			// Iterate over the requested range and pile slots up
-			var (
-				storage []*StorageData
-				last    common.Hash
-				abort   bool
-			)
-			for it.Next() {
-				if size >= hardLimit {
-					abort = true
-					break
-				}
-				hash, slot := it.Hash(), common.CopyBytes(it.Slot())
-
-				// Track the returned interval for the Merkle proofs
-				last = hash
-
-				// Assemble the reply item
-				size += uint64(common.HashLength + len(slot))
-				storage = append(storage, &StorageData{
-					Hash: hash,
-					Body: slot,
-				})
-				// If we've exceeded the request threshold, abort
-				if bytes.Compare(hash[:], limit[:]) >= 0 {
-					break
-				}
-			}
-			slots = append(slots, storage)
-			it.Release()
-
-			// Generate the Merkle proofs for the first and last storage slot, but
-			// only if the response was capped. If the entire storage trie included
-			// in the response, no need for any proofs.
-			if origin != (common.Hash{}) || abort {
-				// Request started at a non-zero hash or was capped prematurely, add
-				// the endpoint Merkle proofs
-				accTrie, err := trie.New(req.Root, backend.Chain().StateCache().TrieDB())
-				if err != nil {
-					return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
-				}
-				var acc state.Account
-				if err := rlp.DecodeBytes(accTrie.Get(account[:]), &acc); err != nil {
-					return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
-				}
-				stTrie, err := trie.New(acc.Root, backend.Chain().StateCache().TrieDB())
-				if err != nil {
-					return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
-				}
-				proof := light.NewNodeSet()
-				if err := stTrie.Prove(origin[:], 0, proof); err != nil {
-					log.Warn("Failed to prove storage range", "origin", req.Origin, "err", err)
-					return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
-				}
-				if last != (common.Hash{}) {
-					if err := stTrie.Prove(last[:], 0, proof); err != nil {
-						log.Warn("Failed to prove storage range", "last", last, "err", err)
-						return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
-					}
-				}
-				for _, blob := range proof.NodeList() {
-					proofs = append(proofs, blob)
-				}
-				// Proof terminates the reply as proofs are only added if a node
-				// refuses to serve more data (exception when a contract fetch is
-				// finishing, but that's that).
-				break
-			}
-		}
-		// Send back anything accumulated
-		return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{
-			ID:    req.ID,
-			Slots: slots,
-			Proof: proofs,
+		req.Bytes = peer.serve.limit(req.Bytes)
+		return peer.serve.schedule(func() error {
+			return serveStorageRanges(backend, peer, &req)
+		}, func() error {
+			return reply(peer, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
 		})
 
 	case msg.Code == StorageRangesMsg:
@@ -369,6 +231,8 @@ func handleMessage(backend Backend, peer *Peer) error {
 			}
 		}
 		requestTracker.Fulfil(peer.id, peer.version, StorageRangesMsg, res.ID)
+		peer.serve.delivery()
+		peer.Report(p2p.ScoreUseful)
 
 		return backend.Handle(peer, res)
 
@@ -381,31 +245,11 @@ func handleMessage(backend Backend, peer *Peer) error {
 		if req.Bytes > softResponseLimit {
 			req.Bytes = softResponseLimit
 		}
-		if len(req.Hashes) > maxCodeLookups {
-			req.Hashes = req.Hashes[:maxCodeLookups]
-		}
-		// Retrieve bytecodes until the packet size limit is reached
-		var (
-			codes [][]byte
-			bytes uint64
-		)
-		for _, hash := range req.Hashes {
-			if hash == emptyCode {
-				// Peers should not request the empty code, but if they do, at
-				// least sent them back a correct response without db lookups
-				codes = append(codes, []byte{})
-			} else if blob, err := backend.Chain().ContractCode(hash); err == nil {
-				codes = append(codes, blob)
-				bytes += uint64(len(blob))
-			}
-			if bytes > req.Bytes {
-				break
-			}
-		}
-		// Send back anything accumulated
-		return p2p.Send(peer.rw, ByteCodesMsg, &ByteCodesPacket{
-			ID:    req.ID,
-			Codes: codes,
+		req.Bytes = peer.serve.limit(req.Bytes)
+		return peer.serve.schedule(func() error {
+			return serveByteCodes(backend, peer, &req)
+		}, func() error {
+			return reply(peer, ByteCodesMsg, &ByteCodesPacket{ID: req.ID})
 		})
 
 	case msg.Code == ByteCodesMsg:
@@ -415,6 +259,8 @@ func handleMessage(backend Backend, peer *Peer) error {
 			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
 		}
 		requestTracker.Fulfil(peer.id, peer.version, ByteCodesMsg, res.ID)
+		peer.serve.delivery()
+		peer.Report(p2p.ScoreUseful)
 
 		return backend.Handle(peer, res)
 
@@ -427,80 +273,17 @@ func handleMessage(backend Backend, peer *Peer) error {
 		if req.Bytes > softResponseLimit {
 			req.Bytes = softResponseLimit
 		}
-		// Make sure we have the state associated with the request
-		triedb := backend.Chain().StateCache().TrieDB()
-
-		accTrie, err := trie.NewSecure(req.Root, triedb)
-		if err != nil {
-			// We don't have the requested state available, bail out
-			return p2p.Send(peer.rw, TrieNodesMsg, &TrieNodesPacket{ID: req.ID})
-		}
-		snap := backend.Chain().Snapshots().Snapshot(req.Root)
-		if snap == nil {
-			// We don't have the requested state snapshotted yet, bail out.
-			// In reality we could still serve using the account and storage
-			// tries only, but let's protect the node a bit while it's doing
-			// snapshot generation.
-			return p2p.Send(peer.rw, TrieNodesMsg, &TrieNodesPacket{ID: req.ID})
-		}
-		// Retrieve trie nodes until the packet size limit is reached
-		var (
-			nodes [][]byte
-			bytes uint64
-			loads int // Trie hash expansions to cound database reads
-		)
+		// Ensure we penalize invalid requests before deferring any work
 		for _, pathset := range req.Paths {
-			switch len(pathset) {
-			case 0:
-				// Ensure we penalize invalid requests
+			if len(pathset) == 0 {
 				return fmt.Errorf("%w: zero-item pathset requested", errBadRequest)
-
-			case 1:
-				// If we're only retrieving an account trie node, fetch it directly
-				blob, resolved, err := accTrie.TryGetNode(pathset[0])
-				loads += resolved // always account database reads, even for failures
-				if err != nil {
-					break
-				}
-				nodes = append(nodes, blob)
-				bytes += uint64(len(blob))
-
-			default:
-				// Storage slots requested, open the storage trie and retrieve from there
-				account, err := snap.Account(common.BytesToHash(pathset[0]))
-				loads++ // always account database reads, even for failures
-				if err != nil {
-					break
-				}
-				stTrie, err := trie.NewSecure(common.BytesToHash(account.Root), triedb)
-				loads++ // always account database reads, even for failures
-				if err != nil {
-					break
-				}
-				for _, path := range pathset[1:] {
-					blob, resolved, err := stTrie.TryGetNode(path)
-					loads += resolved // always account database reads, even for failures
-					if err != nil {
-						break
-					}
-					nodes = append(nodes, blob)
-					bytes += uint64(len(blob))
-
-					// Sanity check limits to avoid DoS on the store trie loads
-					if bytes > req.Bytes || loads > maxTrieNodeLookups || time.Since(start) > maxTrieNodeTimeSpent {
-						break
-					}
-				}
-			}
-			// Abort request processing if we've exceeded our limits
-			if bytes > req.Bytes || loads > maxTrieNodeLookups || time.Since(start) > maxTrieNodeTimeSpent {
-				break
 			}
 		}
-		// Send back anything accumulated
-		return p2p.Send(peer.rw, TrieNodesMsg, &TrieNodesPacket{
-			ID:    req.ID,
-			Nodes: nodes,
+		req.Bytes = peer.serve.limit(req.Bytes)
+		return peer.serve.schedule(func() error {
+			return serveTrieNodes(backend, peer, &req)
+		}, func() error {
+			return reply(peer, TrieNodesMsg, &TrieNodesPacket{ID: req.ID})
 		})
 
 	case msg.Code == TrieNodesMsg:
@@ -510,6 +293,8 @@ func handleMessage(backend Backend, peer *Peer) error {
 			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
 		}
 		requestTracker.Fulfil(peer.id, peer.version, TrieNodesMsg, res.ID)
+		peer.serve.delivery()
+		peer.Report(p2p.ScoreUseful)
 
 		return backend.Handle(peer, res)
 
@@ -518,6 +303,288 @@ func handleMessage(backend Backend, peer *Peer) error {
 	}
 }
 
+// serveAccountRange retrieves a range of accounts and their Merkle proofs from
+// the snapshot, replying with them to the peer.
+func serveAccountRange(backend Backend, peer *Peer, req *GetAccountRangePacket) error {
+	// Retrieve the requested state and bail out if non existent
+	tr, err := trie.New(req.Root, backend.Chain().StateCache().TrieDB())
+	if err != nil {
+		return reply(peer, AccountRangeMsg, &AccountRangePacket{ID: req.ID})
+	}
+	it, err := backend.Chain().Snapshots().AccountIterator(req.Root, req.Origin)
+	if err != nil {
+		return reply(peer, AccountRangeMsg, &AccountRangePacket{ID: req.ID})
+	}
+	// Iterate over the requested range and pile accounts up
+	var (
+		accounts []*AccountData
+		size     uint64
+		last     common.Hash
+	)
+	for it.Next() && size < req.Bytes {
+		hash, account := it.Hash(), common.CopyBytes(it.Account())
+
+		// Track the returned interval for the Merkle proofs
+		last = hash
+
+		// Assemble the reply item
+		size += uint64(common.HashLength + len(account))
+		accounts = append(accounts, &AccountData{
+			Hash: hash,
+			Body: account,
+		})
+		// If we've exceeded the request threshold, abort
+		if bytes.Compare(hash[:], req.Limit[:]) >= 0 {
+			break
+		}
+	}
+	it.Release()
+
+	// Generate the Merkle proofs for the first and last account
+	proof := light.NewNodeSet()
+	if err := tr.Prove(req.Origin[:], 0, proof); err != nil {
+		log.Warn("Failed to prove account range", "origin", req.Origin, "err", err)
+		return reply(peer, AccountRangeMsg, &AccountRangePacket{ID: req.ID})
+	}
+	if last != (common.Hash{}) {
+		if err := tr.Prove(last[:], 0, proof); err != nil {
+			log.Warn("Failed to prove account range", "last", last, "err", err)
+			return reply(peer, AccountRangeMsg, &AccountRangePacket{ID: req.ID})
+		}
+	}
+	var proofs [][]byte
+	for _, blob := range proof.NodeList() {
+		proofs = append(proofs, blob)
+	}
+	// Send back anything accumulated
+	return reply(peer, AccountRangeMsg, &AccountRangePacket{
+		ID:       req.ID,
+		Accounts: accounts,
+		Proof:    proofs,
+	})
+}
+
+// serveStorageRanges retrieves the storage slot ranges of a batch of accounts
+// from the snapshot, replying with them to the peer.
+func serveStorageRanges(backend Backend, peer *Peer, req *GetStorageRangesPacket) error {
+	// TODO(karalabe): Do we want to enforce > 0 accounts and 1 account if origin is set?
+	// TODO(karalabe):   - Logging locally is not ideal as remote faulst annoy the local user
+	// TODO(karalabe):   - Dropping the remote peer is less flexible wrt client bugs (slow is better than non-functional)
+
+	// Calculate the hard limit at which to abort, even if mid storage trie
+	hardLimit := uint64(float64(req.Bytes) * (1 + stateLookupSlack))
+
+	// Retrieve storage ranges until the packet limit is reached
+	var (
+		slots  [][]*StorageData
+		proofs [][]byte
+		size   uint64
+	)
+	for _, account := range req.Accounts {
+		// If we've exceeded the requested data limit, abort without opening
+		// a new storage range (that we'd need to prove due to exceeded size)
+		if size >= req.Bytes {
+			break
+		}
+		// The first account might start from a different origin and end sooner
+		var origin common.Hash
+		if len(req.Origin) > 0 {
+			origin, req.Origin = common.BytesToHash(req.Origin), nil
+		}
+		var limit = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+		if len(req.Limit) > 0 {
+			limit, req.Limit = common.BytesToHash(req.Limit), nil
+		}
+		// Retrieve the requested state and bail out if non existent
+		it, err := backend.Chain().Snapshots().StorageIterator(req.Root, account, origin)
+		if err != nil {
+			return reply(peer, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
+		}
+		// Iterate over the requested range and pile slots up
+		var (
+			storage []*StorageData
+			last    common.Hash
+			abort   bool
+		)
+		for it.Next() {
+			if size >= hardLimit {
+				abort = true
+				break
+			}
+			hash, slot := it.Hash(), common.CopyBytes(it.Slot())
+
+			// Track the returned interval for the Merkle proofs
+			last = hash
+
+			// Assemble the reply item
+			size += uint64(common.HashLength + len(slot))
+			storage = append(storage, &StorageData{
+				Hash: hash,
+				Body: slot,
+			})
+			// If we've exceeded the request threshold, abort
+			if bytes.Compare(hash[:], limit[:]) >= 0 {
+				break
+			}
+		}
+		slots = append(slots, storage)
+		it.Release()
+
+		// Generate the Merkle proofs for the first and last storage slot, but
+		// only if the response was capped. If the entire storage trie included
+		// in the response, no need for any proofs.
+		if origin != (common.Hash{}) || abort {
+			// Request started at a non-zero hash or was capped prematurely, add
+			// the endpoint Merkle proofs
+			accTrie, err := trie.New(req.Root, backend.Chain().StateCache().TrieDB())
+			if err != nil {
+				return reply(peer, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
+			}
+			var acc state.Account
+			if err := rlp.DecodeBytes(accTrie.Get(account[:]), &acc); err != nil {
+				return reply(peer, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
+			}
+			stTrie, err := trie.NewWithOwner(account, acc.Root, backend.Chain().StateCache().TrieDB())
+			if err != nil {
+				return reply(peer, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
+			}
+			proof := light.NewNodeSet()
+			if err := stTrie.Prove(origin[:], 0, proof); err != nil {
+				log.Warn("Failed to prove storage range", "origin", req.Origin, "err", err)
+				return reply(peer, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
+			}
+			if last != (common.Hash{}) {
+				if err := stTrie.Prove(last[:], 0, proof); err != nil {
+					log.Warn("Failed to prove storage range", "last", last, "err", err)
+					return reply(peer, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
+				}
+			}
+			for _, blob := range proof.NodeList() {
+				proofs = append(proofs, blob)
+			}
+			// Proof terminates the reply as proofs are only added if a node
+			// refuses to serve more data (exception when a contract fetch is
+			// finishing, but that's that).
+			break
+		}
+	}
+	// Send back anything accumulated
+	return reply(peer, StorageRangesMsg, &StorageRangesPacket{
+		ID:    req.ID,
+		Slots: slots,
+		Proof: proofs,
+	})
+}
+
+// serveByteCodes retrieves a batch of contract codes from the database,
+// replying with them to the peer.
+func serveByteCodes(backend Backend, peer *Peer, req *GetByteCodesPacket) error {
+	if len(req.Hashes) > maxCodeLookups {
+		req.Hashes = req.Hashes[:maxCodeLookups]
+	}
+	// Retrieve bytecodes until the packet size limit is reached
+	var (
+		codes [][]byte
+		bytes uint64
+	)
+	for _, hash := range req.Hashes {
+		if hash == emptyCode {
+			// Peers should not request the empty code, but if they do, at
+			// least sent them back a correct response without db lookups
+			codes = append(codes, []byte{})
+		} else if blob, err := backend.Chain().ContractCode(hash); err == nil {
+			codes = append(codes, blob)
+			bytes += uint64(len(blob))
+		}
+		if bytes > req.Bytes {
+			break
+		}
+	}
+	// Send back anything accumulated
+	return reply(peer, ByteCodesMsg, &ByteCodesPacket{
+		ID:    req.ID,
+		Codes: codes,
+	})
+}
+
+// serveTrieNodes retrieves a batch of state trie nodes from the database,
+// replying with them to the peer.
+func serveTrieNodes(backend Backend, peer *Peer, req *GetTrieNodesPacket) error {
+	start := time.Now()
+
+	// Make sure we have the state associated with the request
+	triedb := backend.Chain().StateCache().TrieDB()
+
+	accTrie, err := trie.NewSecure(req.Root, triedb)
+	if err != nil {
+		// We don't have the requested state available, bail out
+		return reply(peer, TrieNodesMsg, &TrieNodesPacket{ID: req.ID})
+	}
+	snap := backend.Chain().Snapshots().Snapshot(req.Root)
+	if snap == nil {
+		// We don't have the requested state snapshotted yet, bail out.
+		// In reality we could still serve using the account and storage
+		// tries only, but let's protect the node a bit while it's doing
+		// snapshot generation.
+		return reply(peer, TrieNodesMsg, &TrieNodesPacket{ID: req.ID})
+	}
+	// Retrieve trie nodes until the packet size limit is reached
+	var (
+		nodes [][]byte
+		bytes uint64
+		loads int // Trie hash expansions to cound database reads
+	)
+	for _, pathset := range req.Paths {
+		switch len(pathset) {
+		case 1:
+			// If we're only retrieving an account trie node, fetch it directly
+			blob, resolved, err := accTrie.TryGetNode(pathset[0])
+			loads += resolved // always account database reads, even for failures
+			if err != nil {
+				break
+			}
+			nodes = append(nodes, blob)
+			bytes += uint64(len(blob))
+
+		default:
+			// Storage slots requested, open the storage trie and retrieve from there
+			account, err := snap.Account(common.BytesToHash(pathset[0]))
+			loads++ // always account database reads, even for failures
+			if err != nil {
+				break
+			}
+			stTrie, err := trie.NewSecureWithOwner(common.BytesToHash(pathset[0]), common.BytesToHash(account.Root), triedb)
+			loads++ // always account database reads, even for failures
+			if err != nil {
+				break
+			}
+			for _, path := range pathset[1:] {
+				blob, resolved, err := stTrie.TryGetNode(path)
+				loads += resolved // always account database reads, even for failures
+				if err != nil {
+					break
+				}
+				nodes = append(nodes, blob)
+				bytes += uint64(len(blob))
+
+				// Sanity check limits to avoid DoS on the store trie loads
+				if bytes > req.Bytes || loads > maxTrieNodeLookups || time.Since(start) > maxTrieNodeTimeSpent {
+					break
+				}
+			}
+		}
+		// Abort request processing if we've exceeded our limits
+		if bytes > req.Bytes || loads > maxTrieNodeLookups || time.Since(start) > maxTrieNodeTimeSpent {
+			break
+		}
+	}
+	// Send back anything accumulated
+	return reply(peer, TrieNodesMsg, &TrieNodesPacket{
+		ID:    req.ID,
+		Nodes: nodes,
+	})
+}
+
 // NodeInfo represents a short summary of the `snap` sub-protocol metadata
 // known about the host peer.
 type NodeInfo struct{}
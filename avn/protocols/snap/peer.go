@@ -29,21 +29,26 @@ type Peer struct {
 	*p2p.Peer                   // The embedded P2P package peer
 	rw        p2p.MsgReadWriter // Input/output streams for snap
 	version   uint              // Protocol version negotiated
+	serve     *servePeer        // Serving budgets and statistics, nil if unlimited
 
 	logger log.Logger // Contextual logger with the peer id injected
 }
 
 // newPeer create a wrapper for a network connection and negotiated  protocol
-// version.
-func newPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter) *Peer {
+// version. Data served to the peer is limited by the limiter, if one is given.
+func newPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter, limiter *ServeLimiter) *Peer {
 	id := p.ID().String()
-	return &Peer{
+	peer := &Peer{
 		id:      id,
 		Peer:    p,
 		rw:      rw,
 		version: version,
 		logger:  log.New("peer", id[:8]),
 	}
+	if limiter != nil {
+		peer.serve = limiter.newPeer(peer.logger)
+	}
+	return peer
 }
 
 // ID retrieves the peer's unique identifier.
@@ -0,0 +1,327 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common/mclock"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/metrics"
+	"github.com/avalanria/go-avalanria/p2p"
+	"github.com/avalanria/go-avalanria/rlp"
+)
+
+const (
+	// maxServeDelay is the maximum time a request is deferred to enforce the
+	// serving budgets. It's kept well below the request timeouts of the remote
+	// syncers, so throttled peers get slow responses instead of timeouts.
+	// Requests which would need to wait longer are rejected.
+	maxServeDelay = 3 * time.Second
+
+	// maxDeferredServes is the maximum number of requests of a single peer that
+	// are deferred at the same time. Further requests are rejected until some
+	// of the deferred ones are served.
+	maxDeferredServes = 8
+
+	// servePriorityTTL is the time a peer remains prioritised after delivering
+	// data to one of our own sync requests.
+	servePriorityTTL = 30 * time.Second
+)
+
+var (
+	serveRequestMeter   = metrics.NewRegisteredMeter("snap/serve/requests", nil)
+	serveBytesMeter     = metrics.NewRegisteredMeter("snap/serve/bytes", nil)
+	serveThrottledMeter = metrics.NewRegisteredMeter("snap/serve/throttled", nil)
+	serveRejectedMeter  = metrics.NewRegisteredMeter("snap/serve/rejected", nil)
+	serveDelayTimer     = metrics.NewRegisteredTimer("snap/serve/delay", nil)
+)
+
+// ServeConfig contains the budgets limiting the data served to remote peers, to
+// prevent aggressively syncing peers from saturating the disk IO of the node.
+// Zero values leave the corresponding budget unlimited.
+type ServeConfig struct {
+	PeerBytes    uint64 // Maximum number of bytes served to a single peer per second
+	PeerRequests uint64 // Maximum number of requests served to a single peer per second
+	TotalBytes   uint64 // Maximum number of bytes served to all peers together per second
+}
+
+// ServeStats contains the serving statistics of a single peer.
+type ServeStats struct {
+	Requests  uint64        `json:"requests"`  // Number of requests served
+	Bytes     uint64        `json:"bytes"`     // Number of bytes served
+	Throttled uint64        `json:"throttled"` // Number of requests deferred by the budgets
+	Rejected  uint64        `json:"rejected"`  // Number of requests rejected by the budgets
+	Delay     time.Duration `json:"delay"`     // Total time requests were deferred
+	Priority  bool          `json:"priority"`  // Whether the peer is prioritised as a data source of ours
+}
+
+// bucket is a token bucket refilling at a fixed rate, which a single request
+// is allowed to overdraw. Overdrawn buckets delay the subsequent requests until
+// refilled.
+type bucket struct {
+	rate   float64 // Tokens added per second
+	limit  float64 // Maximum number of tokens stored
+	tokens float64 // Currently available tokens, negative if overdrawn
+	last   mclock.AbsTime
+}
+
+// newBucket creates a full token bucket, storing up to one second of tokens.
+func newBucket(rate uint64, now mclock.AbsTime) *bucket {
+	return &bucket{
+		rate:   float64(rate),
+		limit:  float64(rate),
+		tokens: float64(rate),
+		last:   now,
+	}
+}
+
+// refill adds the tokens accumulated since the last update.
+func (b *bucket) refill(now mclock.AbsTime) {
+	b.tokens += b.rate * time.Duration(now-b.last).Seconds()
+	if b.tokens > b.limit {
+		b.tokens = b.limit
+	}
+	b.last = now
+}
+
+// wait returns the time needed for the bucket to contain the given amount of
+// tokens.
+func (b *bucket) wait(now mclock.AbsTime, need float64) time.Duration {
+	b.refill(now)
+	if b.tokens >= need {
+		return 0
+	}
+	return time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take removes some tokens from the bucket, possibly overdrawing it.
+func (b *bucket) take(now mclock.AbsTime, amount float64) {
+	b.refill(now)
+	b.tokens -= amount
+}
+
+// ServeLimiter enforces the serving budgets of a ServeConfig across all the
+// connected `snap` peers.
+type ServeLimiter struct {
+	config ServeConfig
+	clock  mclock.Clock
+	total  *bucket    // Global byte budget, nil if unlimited
+	lock   sync.Mutex // Lock protecting the global budget
+}
+
+// NewServeLimiter creates a limiter enforcing the given serving budgets.
+func NewServeLimiter(config ServeConfig, clock mclock.Clock) *ServeLimiter {
+	l := &ServeLimiter{
+		config: config,
+		clock:  clock,
+	}
+	if config.TotalBytes > 0 {
+		l.total = newBucket(config.TotalBytes, clock.Now())
+	}
+	return l
+}
+
+// newPeer creates the serving state tracking the budgets of a single peer.
+func (l *ServeLimiter) newPeer(logger log.Logger) *servePeer {
+	p := &servePeer{limiter: l, logger: logger}
+	if l.config.PeerBytes > 0 {
+		p.bytes = newBucket(l.config.PeerBytes, l.clock.Now())
+	}
+	if l.config.PeerRequests > 0 {
+		p.requests = newBucket(l.config.PeerRequests, l.clock.Now())
+	}
+	return p
+}
+
+// servePeer tracks the serving budgets and statistics of a single peer. A nil
+// servePeer serves everything without limits.
+type servePeer struct {
+	limiter  *ServeLimiter
+	logger   log.Logger
+	bytes    *bucket // Byte budget of the peer, nil if unlimited
+	requests *bucket // Request budget of the peer, nil if unlimited
+
+	prioritised mclock.AbsTime // Time until which the peer is prioritised as a data source
+	deferred    int            // Number of requests waiting for the budgets to refill
+	closed      bool           // Whether the peer disconnected, dropping deferred requests
+	stats       ServeStats     // Serving statistics of the peer
+	lock        sync.Mutex     // Lock protecting the budgets and statistics
+}
+
+// close drops the requests still deferred when the peer disconnects.
+func (p *servePeer) close() {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+}
+
+// delivery notes that the peer delivered data to one of our requests, making it
+// a priority peer for a while.
+func (p *servePeer) delivery() {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.prioritised = p.limiter.clock.Now().Add(servePriorityTTL)
+}
+
+// priority returns whether the peer is currently a data source of ours, which
+// exempts it from the global serving cap. The caller must hold the lock.
+func (p *servePeer) priority(now mclock.AbsTime) bool {
+	return now < p.prioritised
+}
+
+// limit caps the response size of a request to one second worth of the peer's
+// byte budget.
+func (p *servePeer) limit(bytes uint64) uint64 {
+	if p == nil || p.bytes == nil {
+		return bytes
+	}
+	if limit := uint64(p.bytes.limit); bytes > limit {
+		return limit
+	}
+	return bytes
+}
+
+// schedule serves a data retrieval request of the peer within its budgets. If
+// the budgets are exhausted, the request is deferred until they refill without
+// blocking the message loop of the peer. Requests which would need to wait too
+// long, or arrive while too many others are deferred, are answered by reject.
+func (p *servePeer) schedule(serve func() error, reject func() error) error {
+	if p == nil {
+		return serve()
+	}
+	l := p.limiter
+
+	p.lock.Lock()
+	now := l.clock.Now()
+
+	var delay time.Duration
+	if p.requests != nil {
+		delay = p.requests.wait(now, 1)
+	}
+	if p.bytes != nil {
+		if wait := p.bytes.wait(now, 0); wait > delay {
+			delay = wait
+		}
+	}
+	priority := p.priority(now)
+	p.stats.Priority = priority
+	p.lock.Unlock()
+
+	if l.total != nil && !priority {
+		l.lock.Lock()
+		if wait := l.total.wait(now, 0); wait > delay {
+			delay = wait
+		}
+		l.lock.Unlock()
+	}
+	p.lock.Lock()
+	if delay > maxServeDelay || (delay > 0 && p.deferred >= maxDeferredServes) {
+		p.stats.Rejected++
+		p.lock.Unlock()
+
+		serveRejectedMeter.Mark(1)
+		return reject()
+	}
+	if p.requests != nil {
+		p.requests.take(now, 1)
+	}
+	if delay == 0 {
+		p.lock.Unlock()
+		return serve()
+	}
+	p.deferred++
+	p.stats.Throttled++
+	p.stats.Delay += delay
+	p.lock.Unlock()
+
+	serveThrottledMeter.Mark(1)
+	serveDelayTimer.Update(delay)
+
+	l.clock.AfterFunc(delay, func() {
+		p.lock.Lock()
+		p.deferred--
+		closed := p.closed
+		p.lock.Unlock()
+
+		if closed {
+			return
+		}
+		if err := serve(); err != nil {
+			p.logger.Debug("Failed to serve deferred `snap` request", "err", err)
+		}
+	})
+	return nil
+}
+
+// charge accounts a response served to the peer against the budgets.
+func (p *servePeer) charge(size int) {
+	serveRequestMeter.Mark(1)
+	serveBytesMeter.Mark(int64(size))
+	if p == nil {
+		return
+	}
+	l := p.limiter
+	now := l.clock.Now()
+
+	p.lock.Lock()
+	if p.bytes != nil {
+		p.bytes.take(now, float64(size))
+	}
+	p.stats.Requests++
+	p.stats.Bytes += uint64(size)
+	p.lock.Unlock()
+
+	if l.total != nil {
+		l.lock.Lock()
+		l.total.take(now, float64(size))
+		l.lock.Unlock()
+	}
+}
+
+// ServeStats retrieves the serving statistics of the peer.
+func (p *Peer) ServeStats() ServeStats {
+	if p.serve == nil {
+		return ServeStats{}
+	}
+	p.serve.lock.Lock()
+	defer p.serve.lock.Unlock()
+
+	stats := p.serve.stats
+	stats.Priority = p.serve.priority(p.serve.limiter.clock.Now())
+	return stats
+}
+
+// reply sends the response to a data retrieval request, charging its size to
+// the serving budgets of the peer.
+func reply(peer *Peer, msgcode uint64, packet interface{}) error {
+	size, r, err := rlp.EncodeToReader(packet)
+	if err != nil {
+		return err
+	}
+	peer.serve.charge(size)
+	return peer.rw.WriteMsg(p2p.Msg{Code: msgcode, Size: uint32(size), Payload: r})
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common/mclock"
+	"github.com/avalanria/go-avalanria/log"
+)
+
+// serveResult is the outcome of a request scheduled by a servePeer.
+type serveResult struct {
+	served   bool
+	rejected bool
+}
+
+// scheduleServe schedules a request on the peer, tracking its outcome.
+func scheduleServe(t *testing.T, peer *servePeer) *serveResult {
+	t.Helper()
+
+	res := new(serveResult)
+	err := peer.schedule(func() error {
+		res.served = true
+		return nil
+	}, func() error {
+		res.rejected = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to schedule request: %v", err)
+	}
+	return res
+}
+
+// checkServe schedules a request on the peer and checks that it's served after
+// the expected delay, advancing the simulated clock.
+func checkServe(t *testing.T, clock *mclock.Simulated, peer *servePeer, delay time.Duration) {
+	t.Helper()
+
+	res := scheduleServe(t, peer)
+	if res.rejected {
+		t.Fatalf("request rejected, want %v delay", delay)
+	}
+	if delay > 0 {
+		if res.served {
+			t.Fatalf("request served without %v delay", delay)
+		}
+		clock.Run(delay - time.Millisecond)
+		if res.served {
+			t.Fatalf("request served before %v delay", delay)
+		}
+		clock.Run(time.Millisecond)
+	}
+	if !res.served {
+		t.Fatalf("request not served after %v delay", delay)
+	}
+}
+
+// Tests that the per-peer budgets defer and cap the served requests.
+func TestServePeerLimits(t *testing.T) {
+	clock := new(mclock.Simulated)
+	limiter := NewServeLimiter(ServeConfig{PeerBytes: 1000, PeerRequests: 2}, clock)
+	peer := limiter.newPeer(log.Root())
+
+	// Fresh budgets serve immediately, capping the response size
+	if allowed := peer.limit(5000); allowed != 1000 {
+		t.Fatalf("response size mismatch: have %d, want %d", allowed, 1000)
+	}
+	checkServe(t, clock, peer, 0)
+
+	// Overdrawing the byte budget defers the next request until refilled
+	peer.charge(2000)
+	checkServe(t, clock, peer, time.Second)
+
+	// Exhausting the request budget defers the next request too
+	peer.charge(0)
+	checkServe(t, clock, peer, 0)
+	checkServe(t, clock, peer, 0)
+	checkServe(t, clock, peer, 500*time.Millisecond)
+
+	stats := peer.stats
+	if stats.Throttled != 2 || stats.Delay != 1500*time.Millisecond {
+		t.Errorf("throttling stats mismatch: have %d/%v, want %d/%v", stats.Throttled, stats.Delay, 2, 1500*time.Millisecond)
+	}
+	if stats.Requests != 2 || stats.Bytes != 2000 {
+		t.Errorf("serving stats mismatch: have %d/%d, want %d/%d", stats.Requests, stats.Bytes, 2, 2000)
+	}
+}
+
+// Tests that the global budget is shared by all peers, except the ones we are
+// syncing from, and that requests needing too long a delay are rejected.
+func TestServeGlobalLimit(t *testing.T) {
+	clock := new(mclock.Simulated)
+	limiter := NewServeLimiter(ServeConfig{TotalBytes: 1000}, clock)
+
+	var (
+		a = limiter.newPeer(log.Root())
+		b = limiter.newPeer(log.Root())
+		c = limiter.newPeer(log.Root())
+	)
+	checkServe(t, clock, a, 0)
+	a.charge(1500)
+
+	// Another peer has to wait for the shared budget to refill
+	checkServe(t, clock, b, 500*time.Millisecond)
+	b.charge(10000)
+
+	// Peers delivering data to us are exempt from the global budget
+	c.delivery()
+	checkServe(t, clock, c, 0)
+
+	// Requests would time out remotely, reject them instead
+	if res := scheduleServe(t, a); !res.rejected || res.served {
+		t.Errorf("request not rejected: %+v", res)
+	}
+	if a.stats.Rejected != 1 {
+		t.Errorf("rejection stats mismatch: have %d, want %d", a.stats.Rejected, 1)
+	}
+	// Priority is lost after a while without deliveries
+	clock.Run(servePriorityTTL)
+	if c.priority(clock.Now()) {
+		t.Errorf("priority not expired")
+	}
+}
+
+// Tests that the number of deferred requests is capped, and that deferred
+// requests are dropped when the peer disconnects.
+func TestServeDeferLimit(t *testing.T) {
+	clock := new(mclock.Simulated)
+	limiter := NewServeLimiter(ServeConfig{PeerRequests: 10}, clock)
+	peer := limiter.newPeer(log.Root())
+
+	for i := 0; i < 10; i++ {
+		checkServe(t, clock, peer, 0)
+	}
+	var deferred []*serveResult
+	for i := 0; i < maxDeferredServes; i++ {
+		res := scheduleServe(t, peer)
+		if res.served || res.rejected {
+			t.Fatalf("request %d not deferred: %+v", i, res)
+		}
+		deferred = append(deferred, res)
+	}
+	if res := scheduleServe(t, peer); !res.rejected {
+		t.Fatalf("request over the deferral limit not rejected: %+v", res)
+	}
+	// Serve the first deferred request, drop the rest on disconnect
+	clock.Run(100 * time.Millisecond)
+	if !deferred[0].served {
+		t.Fatalf("deferred request not served")
+	}
+	peer.close()
+	clock.Run(maxServeDelay)
+	for i, res := range deferred[1:] {
+		if res.served {
+			t.Errorf("deferred request %d served after disconnect", i+1)
+		}
+	}
+	if peer.deferred != 0 {
+		t.Errorf("deferred requests not released: %d", peer.deferred)
+	}
+}
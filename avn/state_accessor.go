@@ -159,7 +159,7 @@ func (avn *Avalanria) stateAtTransaction(block *types.Block, txIndex int, reexec
 		return nil, vm.BlockContext{}, statedb, nil
 	}
 	// Recompute transactions up to the target index.
-	signer := types.MakeSigner(avn.blockchain.Config(), block.Number())
+	signer := types.MakeSigner(avn.blockchain.Config(), block.Number(), block.Time())
 	for idx, tx := range block.Transactions() {
 		// Assemble the transaction call message and return if the requested offset
 		msg, _ := tx.AsMessage(signer, block.BaseFee())
@@ -17,6 +17,7 @@
 package avn
 
 import (
+	"errors"
 	"math/big"
 	"math/rand"
 	"sync/atomic"
@@ -354,3 +355,26 @@ func (h *handler) doSync(op *chainSyncOp) error {
 	}
 	return nil
 }
+
+// syncFromCheckpoint schedules a state sync from an operator trusted block hash
+// on the next sync cycle, backfilling the chain behind it. It's a noop if the
+// block is already part of the local chain.
+func (h *handler) syncFromCheckpoint(hash common.Hash) error {
+	if rawdb.ReadStateScheme(h.database) == rawdb.PathScheme {
+		return errors.New("checkpoint sync is unsupported with the path-based state scheme")
+	}
+	if header := h.chain.GetHeaderByHash(hash); header != nil && h.chain.CurrentBlock().NumberU64() >= header.Number.Uint64() {
+		log.Info("Trusted checkpoint already synced", "number", header.Number, "hash", hash)
+		return nil
+	}
+	h.downloader.SetTrustedCheckpoint(hash)
+
+	// Checkpoint sync retrieves the state at the trusted block, so force a fast
+	// sync cycle, on top of the snap protocol if the snapshots are maintained
+	atomic.StoreUint32(&h.fastSync, 1)
+	if h.chain.Snapshots() != nil {
+		atomic.StoreUint32(&h.snapSync, 1)
+	}
+	log.Info("Scheduled sync from trusted checkpoint", "hash", hash)
+	return nil
+}
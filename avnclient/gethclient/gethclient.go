@@ -118,6 +118,87 @@ func (ec *Client) GetProof(ctx context.Context, account common.Address, keys []s
 	return &result, err
 }
 
+// MultiProofRequest selects an account, and optionally some of its storage keys,
+// to be proven by GetMultiProof.
+type MultiProofRequest struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []string       `json:"storageKeys"`
+}
+
+// MultiProofResult is the result of a GetMultiProof operation, holding a single
+// set of trie nodes proving all the requested accounts and storage slots.
+type MultiProofResult struct {
+	Nodes    [][]byte
+	Accounts []MultiAccountResult
+}
+
+// MultiAccountResult is an account proven by a MultiProofResult.
+type MultiAccountResult struct {
+	Address     common.Address
+	Balance     *big.Int
+	CodeHash    common.Hash
+	Nonce       uint64
+	StorageHash common.Hash
+	Storage     []MultiStorageResult
+}
+
+// MultiStorageResult is a storage slot proven by a MultiProofResult.
+type MultiStorageResult struct {
+	Key   string
+	Value *big.Int
+}
+
+// GetMultiProof returns the values of multiple accounts and their storage keys,
+// along with the Merkle-proof of all of them. The nodes shared by the proofs are
+// only contained once, they can be verified with trie.VerifyMultiProof.
+// The block number can be nil, in which case the value is taken from the latest known block.
+func (ec *Client) GetMultiProof(ctx context.Context, requests []MultiProofRequest, blockNumber *big.Int) (*MultiProofResult, error) {
+	type storageResult struct {
+		Key   string       `json:"key"`
+		Value *hexutil.Big `json:"value"`
+	}
+
+	type accountResult struct {
+		Address     common.Address  `json:"address"`
+		Balance     *hexutil.Big    `json:"balance"`
+		CodeHash    common.Hash     `json:"codeHash"`
+		Nonce       hexutil.Uint64  `json:"nonce"`
+		StorageHash common.Hash     `json:"storageHash"`
+		Storage     []storageResult `json:"storage"`
+	}
+
+	var res struct {
+		Nodes    []hexutil.Bytes `json:"nodes"`
+		Accounts []accountResult `json:"accounts"`
+	}
+	if err := ec.c.CallContext(ctx, &res, "avn_getMultiProof", requests, toBlockNumArg(blockNumber)); err != nil {
+		return nil, err
+	}
+	// Turn hexutils back to normal datatypes
+	result := &MultiProofResult{
+		Nodes:    make([][]byte, len(res.Nodes)),
+		Accounts: make([]MultiAccountResult, len(res.Accounts)),
+	}
+	for i, node := range res.Nodes {
+		result.Nodes[i] = node
+	}
+	for i, acc := range res.Accounts {
+		storage := make([]MultiStorageResult, len(acc.Storage))
+		for j, st := range acc.Storage {
+			storage[j] = MultiStorageResult{Key: st.Key, Value: st.Value.ToInt()}
+		}
+		result.Accounts[i] = MultiAccountResult{
+			Address:     acc.Address,
+			Balance:     acc.Balance.ToInt(),
+			CodeHash:    acc.CodeHash,
+			Nonce:       uint64(acc.Nonce),
+			StorageHash: acc.StorageHash,
+			Storage:     storage,
+		}
+	}
+	return result, nil
+}
+
 // OverrideAccount specifies the state of an account to be overridden.
 type OverrideAccount struct {
 	Nonce     uint64                      `json:"nonce"`
@@ -27,6 +27,7 @@ import (
 	"github.com/avalanria/go-avalanria/consensus/avnash"
 	"github.com/avalanria/go-avalanria/core"
 	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/state"
 	"github.com/avalanria/go-avalanria/core/types"
 	"github.com/avalanria/go-avalanria/crypto"
 	"github.com/avalanria/go-avalanria/avn"
@@ -34,7 +35,9 @@ import (
 	"github.com/avalanria/go-avalanria/avnclient"
 	"github.com/avalanria/go-avalanria/node"
 	"github.com/avalanria/go-avalanria/params"
+	"github.com/avalanria/go-avalanria/rlp"
 	"github.com/avalanria/go-avalanria/rpc"
+	"github.com/avalanria/go-avalanria/trie"
 )
 
 var (
@@ -106,6 +109,9 @@ func TestGavnClient(t *testing.T) {
 		"TestGetProof": {
 			func(t *testing.T) { testGetProof(t, client) },
 		},
+		"TestGetMultiProof": {
+			func(t *testing.T) { testGetMultiProof(t, client) },
+		},
 		"TestGCStats": {
 			func(t *testing.T) { testGCStats(t, client) },
 		},
@@ -207,6 +213,43 @@ func testGetProof(t *testing.T, client *rpc.Client) {
 	}
 }
 
+func testGetMultiProof(t *testing.T, client *rpc.Client) {
+	ec := New(client)
+	avncl := avnclient.NewClient(client)
+
+	// Prove the genesis state, which is retained regardless of the head
+	missing := common.Address{0xff}
+	result, err := ec.GetMultiProof(context.Background(), []MultiProofRequest{
+		{Address: testAddr, StorageKeys: []string{"0x00"}},
+		{Address: missing},
+	}, big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Accounts) != 2 {
+		t.Fatalf("invalid account count, want: 2 got: %d", len(result.Accounts))
+	}
+	header, err := avncl.HeaderByNumber(context.Background(), big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := [][]byte{crypto.Keccak256(testAddr[:]), crypto.Keccak256(missing[:])}
+	values, err := trie.VerifyMultiProof(header.Root, keys, trie.NewMultiProofFromNodes(result.Nodes))
+	if err != nil {
+		t.Fatalf("failed to verify multiproof: %v", err)
+	}
+	var account state.Account
+	if err := rlp.DecodeBytes(values[0], &account); err != nil {
+		t.Fatalf("failed to decode proven account: %v", err)
+	}
+	if account.Balance.Cmp(result.Accounts[0].Balance) != 0 || account.Balance.Cmp(testBalance) != 0 {
+		t.Fatalf("invalid balance, want: %v got: %v", testBalance, result.Accounts[0].Balance)
+	}
+	if values[1] != nil {
+		t.Fatalf("missing account proven present")
+	}
+}
+
 func testGCStats(t *testing.T, client *rpc.Client) {
 	ec := New(client)
 	_, err := ec.GCStats(context.Background())
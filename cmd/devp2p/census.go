@@ -0,0 +1,616 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of go-avalanria.
+//
+// go-avalanria is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-avalanria is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-avalanria. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/avalanria/go-avalanria/avn/protocols/avn"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/avndb/leveldb"
+	"github.com/avalanria/go-avalanria/cmd/devp2p/internal/avntest"
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/p2p"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/rlpx"
+	"github.com/avalanria/go-avalanria/rlp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	censusWorkers         = 16               // number of concurrent RLPx probes
+	censusQueueSize       = 1024             // number of nodes waiting to be probed
+	censusRecheckInterval = 30 * time.Minute // minimum time between probes of a node
+	censusNodeLifetime    = 24 * time.Hour   // nodes not seen for this long are removed
+	censusProbeTimeout    = 15 * time.Second // time limit for a single probe
+)
+
+var (
+	censusHTTPFlag = cli.StringFlag{
+		Name:  "http",
+		Usage: "Listening address of the HTTP API",
+		Value: "127.0.0.1:8570",
+	}
+	censusSnapshotFlag = cli.DurationFlag{
+		Name:  "snapshot-interval",
+		Usage: "Time between stored census snapshots",
+		Value: time.Hour,
+	}
+)
+
+// Database keys.
+var (
+	censusNodePrefix     = []byte("node:") // node ID -> censusNode
+	censusSnapshotPrefix = []byte("snap:") // big endian unix time -> censusStats
+)
+
+// censusNode is the information gathered about a single node.
+type censusNode struct {
+	N         *enode.Node `json:"record"`
+	FirstSeen time.Time   `json:"firstSeen"`
+	LastSeen  time.Time   `json:"lastSeen"`
+
+	// These track the RLPx probes. Error is the failure of the last probe.
+	LastCheck    time.Time `json:"lastCheck,omitempty"`
+	LastResponse time.Time `json:"lastResponse,omitempty"`
+	Error        string    `json:"error,omitempty"`
+
+	// Information from the protocol handshake.
+	Name   string        `json:"name,omitempty"`
+	Caps   []string      `json:"caps,omitempty"`
+	Status *censusStatus `json:"status,omitempty"`
+}
+
+// censusStatus is the avn protocol status of a node.
+type censusStatus struct {
+	ProtocolVersion uint32      `json:"protocolVersion"`
+	NetworkID       uint64      `json:"networkId"`
+	TD              *big.Int    `json:"td"`
+	Head            common.Hash `json:"head"`
+	Genesis         common.Hash `json:"genesis"`
+	ForkHash        string      `json:"forkHash"`
+	ForkNext        uint64      `json:"forkNext"`
+}
+
+// censusStats is a summary of all reachable nodes at a point in time.
+type censusStats struct {
+	Time     time.Time      `json:"time"`
+	Nodes    int            `json:"nodes"`
+	Clients  map[string]int `json:"clients"`  // client name -> count
+	Versions map[string]int `json:"versions"` // client name and version -> count
+	Caps     map[string]int `json:"caps"`     // capability -> count
+	Networks map[uint64]int `json:"networks"` // network ID -> count
+	ForkIDs  map[string]int `json:"forkIds"`  // network ID, fork hash and next -> count
+}
+
+// census probes nodes found by the crawler via RLPx and keeps
+// track of their client software and chain status.
+type census struct {
+	db    avndb.KeyValueStore
+	key   *ecdsa.PrivateKey
+	probe func(*ecdsa.PrivateKey, *enode.Node) (*avntest.Hello, *avn.StatusPacket, error)
+	queue chan *enode.Node
+	quit  chan struct{}
+	wg    sync.WaitGroup
+
+	mu    sync.Mutex
+	nodes map[enode.ID]*censusNode
+}
+
+func newCensus(db avndb.KeyValueStore) (*census, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	c := &census{
+		db:    db,
+		key:   key,
+		probe: probeNode,
+		queue: make(chan *enode.Node, censusQueueSize),
+		quit:  make(chan struct{}),
+		nodes: make(map[enode.ID]*censusNode),
+	}
+	it := db.NewIterator(censusNodePrefix, nil)
+	defer it.Release()
+	for it.Next() {
+		var n censusNode
+		if err := json.Unmarshal(it.Value(), &n); err != nil {
+			return nil, fmt.Errorf("invalid node %x in census database: %v", it.Key(), err)
+		}
+		c.nodes[n.N.ID()] = &n
+	}
+	return c, it.Error()
+}
+
+// start launches the probe workers.
+func (c *census) start() {
+	c.wg.Add(censusWorkers)
+	for i := 0; i < censusWorkers; i++ {
+		go c.probeLoop()
+	}
+}
+
+// stop terminates the probe workers.
+func (c *census) stop() {
+	close(c.quit)
+	c.wg.Wait()
+}
+
+// knownNodes returns the records of all nodes in the census.
+func (c *census) knownNodes() []*enode.Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]*enode.Node, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		result = append(result, n.N)
+	}
+	return result
+}
+
+// add records that a node was seen by the crawler and queues it for probing.
+func (c *census) add(n *enode.Node) {
+	now := truncNow()
+	c.mu.Lock()
+	cn := c.nodes[n.ID()]
+	if cn == nil {
+		cn = &censusNode{FirstSeen: now}
+		c.nodes[n.ID()] = cn
+	}
+	cn.N = n
+	cn.LastSeen = now
+	recheck := now.Sub(cn.LastCheck) >= censusRecheckInterval
+	c.storeNode(cn)
+	c.mu.Unlock()
+
+	if !recheck || n.TCP() == 0 {
+		return
+	}
+	select {
+	case c.queue <- n:
+	default:
+		log.Debug("Census queue full, skipping node", "id", n.ID())
+	}
+}
+
+func (c *census) probeLoop() {
+	defer c.wg.Done()
+	for {
+		select {
+		case n := <-c.queue:
+			c.update(n)
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// update probes a node and stores the result.
+func (c *census) update(n *enode.Node) {
+	hello, status, err := c.probe(c.key, n)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cn := c.nodes[n.ID()]
+	if cn == nil {
+		return // removed while probing
+	}
+	cn.LastCheck = truncNow()
+	if hello == nil {
+		log.Debug("Census probe failed", "id", n.ID(), "err", err)
+		cn.Error = err.Error()
+		c.storeNode(cn)
+		return
+	}
+	cn.LastResponse = cn.LastCheck
+	cn.Error = ""
+	if err != nil {
+		cn.Error = err.Error()
+	}
+	cn.Name = hello.Name
+	cn.Caps = make([]string, len(hello.Caps))
+	for i, capability := range hello.Caps {
+		cn.Caps[i] = capability.String()
+	}
+	cn.Status = nil
+	if status != nil {
+		cn.Status = &censusStatus{
+			ProtocolVersion: status.ProtocolVersion,
+			NetworkID:       status.NetworkID,
+			TD:              status.TD,
+			Head:            status.Head,
+			Genesis:         status.Genesis,
+			ForkHash:        fmt.Sprintf("%#x", status.ForkID.Hash),
+			ForkNext:        status.ForkID.Next,
+		}
+	}
+	log.Info("Updated census node", "id", n.ID(), "name", cn.Name, "err", err)
+	c.storeNode(cn)
+}
+
+// storeNode writes a node to the database. It must be called with c.mu held.
+func (c *census) storeNode(cn *censusNode) {
+	enc, err := json.Marshal(cn)
+	if err != nil {
+		panic(err)
+	}
+	key := append(common.CopyBytes(censusNodePrefix), cn.N.ID().Bytes()...)
+	if err := c.db.Put(key, enc); err != nil {
+		log.Warn("Failed to store census node", "id", cn.N.ID(), "err", err)
+	}
+}
+
+// expire removes nodes which haven't been seen by the crawler for a while.
+func (c *census) expire(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, cn := range c.nodes {
+		if now.Sub(cn.LastSeen) < censusNodeLifetime {
+			continue
+		}
+		delete(c.nodes, id)
+		key := append(common.CopyBytes(censusNodePrefix), id.Bytes()...)
+		if err := c.db.Delete(key); err != nil {
+			log.Warn("Failed to delete census node", "id", id, "err", err)
+		}
+	}
+}
+
+// list returns all nodes in the census, sorted by ID.
+func (c *census) list() []censusNode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]censusNode, 0, len(c.nodes))
+	for _, cn := range c.nodes {
+		result = append(result, *cn)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].N.ID().Bytes(), result[j].N.ID().Bytes()) < 0
+	})
+	return result
+}
+
+// stats summarizes the nodes which responded to their last probe.
+func (c *census) stats(now time.Time) *censusStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := &censusStats{
+		Time:     now,
+		Clients:  make(map[string]int),
+		Versions: make(map[string]int),
+		Caps:     make(map[string]int),
+		Networks: make(map[uint64]int),
+		ForkIDs:  make(map[string]int),
+	}
+	for _, cn := range c.nodes {
+		if cn.LastResponse.IsZero() || cn.LastResponse.Before(cn.LastCheck) {
+			continue
+		}
+		s.Nodes++
+		client, version := parseClientName(cn.Name)
+		s.Clients[client]++
+		s.Versions[client+"/"+version]++
+		for _, capability := range cn.Caps {
+			s.Caps[capability]++
+		}
+		if st := cn.Status; st != nil {
+			s.Networks[st.NetworkID]++
+			s.ForkIDs[fmt.Sprintf("%d/%s/%d", st.NetworkID, st.ForkHash, st.ForkNext)]++
+		}
+	}
+	return s
+}
+
+// snapshot stores the current stats in the database.
+func (c *census) snapshot(now time.Time) error {
+	enc, err := json.Marshal(c.stats(now))
+	if err != nil {
+		return err
+	}
+	return c.db.Put(censusSnapshotKey(now), enc)
+}
+
+// snapshots returns the stored snapshots taken in the time range [from, to).
+func (c *census) snapshots(from, to time.Time) ([]*censusStats, error) {
+	it := c.db.NewIterator(censusSnapshotPrefix, censusSnapshotKey(from)[len(censusSnapshotPrefix):])
+	defer it.Release()
+
+	result := make([]*censusStats, 0)
+	end := censusSnapshotKey(to)
+	for it.Next() && bytes.Compare(it.Key(), end) < 0 {
+		s := new(censusStats)
+		if err := json.Unmarshal(it.Value(), s); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, it.Error()
+}
+
+func censusSnapshotKey(t time.Time) []byte {
+	key := make([]byte, len(censusSnapshotPrefix)+8)
+	copy(key, censusSnapshotPrefix)
+	binary.BigEndian.PutUint64(key[len(censusSnapshotPrefix):], uint64(t.Unix()))
+	return key
+}
+
+// parseClientName splits a client identifier like "Geth/v1.10.3-stable/linux-amd64/go1.16"
+// into the client name and its version number.
+func parseClientName(name string) (client, version string) {
+	parts := strings.Split(name, "/")
+	client = parts[0]
+	if client == "" {
+		client = "unknown"
+	}
+	version = "unknown"
+	for _, p := range parts[1:] {
+		// Some clients put an instance name before the version.
+		if strings.HasPrefix(p, "v") && len(p) > 1 && p[1] >= '0' && p[1] <= '9' {
+			version = p
+			if i := strings.IndexByte(version, '-'); i > 0 {
+				version = version[:i]
+			}
+			break
+		}
+	}
+	return client, version
+}
+
+// probeNode connects to a node via RLPx and performs the protocol handshake.
+// If the node supports the avn protocol, it also waits for the node's status
+// message. When the handshake succeeds but the status can't be read, probeNode
+// returns the hello message along with the error.
+func probeNode(key *ecdsa.PrivateKey, n *enode.Node) (*avntest.Hello, *avn.StatusPacket, error) {
+	addr := &net.TCPAddr{IP: n.IP(), Port: n.TCP()}
+	fd, err := net.DialTimeout("tcp", addr.String(), censusProbeTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn := rlpx.NewConn(fd, n.Pubkey())
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(censusProbeTimeout))
+	if _, err := conn.Handshake(key); err != nil {
+		return nil, nil, err
+	}
+
+	// Exchange hello messages.
+	ourHello := &avntest.Hello{
+		Version: 5,
+		Caps:    []p2p.Cap{{Name: avn.ProtocolName, Version: 64}, {Name: avn.ProtocolName, Version: 65}, {Name: avn.ProtocolName, Version: 66}},
+		ID:      crypto.FromECDSAPub(&key.PublicKey)[1:],
+	}
+	if err := writeMsg(conn, 0x00, ourHello); err != nil {
+		return nil, nil, err
+	}
+	code, data, _, err := conn.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	switch code {
+	case 0x00:
+	case 0x01:
+		return nil, nil, decodeDisconnect(data)
+	default:
+		return nil, nil, fmt.Errorf("invalid message code %d, expected handshake (code zero)", code)
+	}
+	hello := new(avntest.Hello)
+	if err := rlp.DecodeBytes(data, hello); err != nil {
+		return nil, nil, fmt.Errorf("invalid handshake: %v", err)
+	}
+	if hello.Version >= 5 {
+		conn.SetSnappy(true)
+	}
+	defer writeMsg(conn, 0x01, []p2p.DiscReason{p2p.DiscQuitting})
+
+	supported := false
+	for _, capability := range hello.Caps {
+		if capability.Name == avn.ProtocolName && capability.Version >= 64 && capability.Version <= 66 {
+			supported = true
+		}
+	}
+	if !supported {
+		return hello, nil, nil
+	}
+
+	// Wait for the status message. The avn protocol is the only one we have
+	// in common, so its messages start at the first code after the base protocol.
+	const statusCode = 0x10
+	for {
+		code, data, _, err := conn.Read()
+		if err != nil {
+			return hello, nil, err
+		}
+		switch code {
+		case 0x01:
+			return hello, nil, decodeDisconnect(data)
+		case 0x02:
+			writeMsg(conn, 0x03, []interface{}{})
+		case statusCode:
+			status := new(avn.StatusPacket)
+			if err := rlp.DecodeBytes(data, status); err != nil {
+				return hello, nil, fmt.Errorf("invalid status: %v", err)
+			}
+			return hello, status, nil
+		}
+	}
+}
+
+func writeMsg(conn *rlpx.Conn, code uint64, msg interface{}) error {
+	payload, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(code, payload)
+	return err
+}
+
+func decodeDisconnect(data []byte) error {
+	var msg []p2p.DiscReason
+	if rlp.DecodeBytes(data, &msg); len(msg) == 0 {
+		return fmt.Errorf("invalid disconnect message")
+	}
+	return fmt.Errorf("received disconnect message: %v", msg[0])
+}
+
+// censusAPI serves the census over HTTP.
+type censusAPI struct {
+	c *census
+}
+
+func (api *censusAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nodes", api.serveNodes)
+	mux.HandleFunc("/stats", api.serveStats)
+	mux.HandleFunc("/snapshots", api.serveSnapshots)
+	return mux
+}
+
+// serveNodes returns all nodes. The 'client' query parameter
+// can be used to select nodes by client name.
+func (api *censusAPI) serveNodes(w http.ResponseWriter, r *http.Request) {
+	nodes := api.c.list()
+	if client := r.URL.Query().Get("client"); client != "" {
+		filtered := nodes[:0]
+		for _, n := range nodes {
+			if name, _ := parseClientName(n.Name); strings.EqualFold(name, client) {
+				filtered = append(filtered, n)
+			}
+		}
+		nodes = filtered
+	}
+	serveJSON(w, nodes)
+}
+
+// serveStats returns the current stats.
+func (api *censusAPI) serveStats(w http.ResponseWriter, r *http.Request) {
+	serveJSON(w, api.c.stats(truncNow()))
+}
+
+// serveSnapshots returns stored snapshots. The optional 'from' and 'to'
+// query parameters restrict the time range and are given as unix time.
+func (api *censusAPI) serveSnapshots(w http.ResponseWriter, r *http.Request) {
+	from, to := time.Unix(0, 0), time.Unix(1<<62, 0)
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := r.URL.Query().Get(name); v != "" {
+			sec, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid '%s' parameter: %v", name, err), http.StatusBadRequest)
+				return
+			}
+			*t = time.Unix(sec, 0)
+		}
+	}
+	snaps, err := api.c.snapshots(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveJSON(w, snaps)
+}
+
+func serveJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", jsonIndent)
+	if err := enc.Encode(v); err != nil {
+		log.Debug("Failed to write HTTP response", "err", err)
+	}
+}
+
+// runCensus runs the crawler until interrupted, probing all live nodes
+// via RLPx and serving the results over HTTP.
+func runCensus(ctx *cli.Context, disc resolver, closeDisc func(), iters ...enode.Iterator) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need database directory as argument")
+	}
+	db, err := leveldb.New(ctx.Args().First(), 16, 16, "", false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	c, err := newCensus(db)
+	if err != nil {
+		return err
+	}
+	c.start()
+	defer c.stop()
+
+	// Start the HTTP API.
+	listener, err := net.Listen("tcp", ctx.String(censusHTTPFlag.Name))
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: (&censusAPI{c}).handler()}
+	go srv.Serve(listener)
+	defer srv.Close()
+	log.Info("Census HTTP API started", "addr", listener.Addr())
+
+	// Run the crawler. It stops when discovery is closed.
+	iters = append(iters, enode.IterNodes(c.knownNodes()))
+	cr := newCrawler(nil, disc, iters...)
+	cr.revalidateInterval = 10 * time.Minute
+	cr.nodeLifetime = censusNodeLifetime
+	cr.onResponse = c.add
+	done := make(chan struct{})
+	go func() {
+		cr.run(0)
+		close(done)
+	}()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+	snapshot := time.NewTicker(ctx.Duration(censusSnapshotFlag.Name))
+	defer snapshot.Stop()
+	for {
+		select {
+		case <-snapshot.C:
+			now := truncNow()
+			c.expire(now)
+			if err := c.snapshot(now); err != nil {
+				log.Error("Failed to store census snapshot", "err", err)
+			}
+		case <-sigc:
+			log.Info("Got interrupt, shutting down...")
+			closeDisc()
+			<-done
+			return nil
+		case <-done:
+			return nil
+		}
+	}
+}
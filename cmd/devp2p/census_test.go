@@ -0,0 +1,241 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of go-avalanria.
+//
+// go-avalanria is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-avalanria is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-avalanria. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/avn/protocols/avn"
+	"github.com/avalanria/go-avalanria/avndb/memorydb"
+	"github.com/avalanria/go-avalanria/cmd/devp2p/internal/avntest"
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/forkid"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/p2p"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+)
+
+func TestParseClientName(t *testing.T) {
+	tests := []struct {
+		name, client, version string
+	}{
+		{"Geth/v1.10.3-stable-991384a7/linux-amd64/go1.16.3", "Geth", "v1.10.3"},
+		{"Geth/mynode/v1.10.2-stable/linux-amd64/go1.16", "Geth", "v1.10.2"},
+		{"Nethermind/v1.10.73-0-cd2b4b3bd-20210513/X64-Linux/5.0.5", "Nethermind", "v1.10.73"},
+		{"erigon/v2021.05.2/linux-amd64/go1.16.3", "erigon", "v2021.05.2"},
+		{"besu", "besu", "unknown"},
+		{"", "unknown", "unknown"},
+	}
+	for _, test := range tests {
+		client, version := parseClientName(test.name)
+		if client != test.client || version != test.version {
+			t.Errorf("%q: got (%q, %q), want (%q, %q)", test.name, client, version, test.client, test.version)
+		}
+	}
+}
+
+// This test checks that probeNode reads the hello and status messages of a node.
+func TestCensusProbe(t *testing.T) {
+	status := &avn.StatusPacket{
+		ProtocolVersion: 66,
+		NetworkID:       5,
+		TD:              big.NewInt(100),
+		Head:            common.Hash{1},
+		Genesis:         common.Hash{2},
+		ForkID:          forkid.ID{Hash: [4]byte{0xa0, 0xb1, 0xc2, 0xd3}, Next: 1000},
+	}
+	key, _ := crypto.GenerateKey()
+	srv := &p2p.Server{Config: p2p.Config{
+		PrivateKey:  key,
+		Name:        "test/v1.2.3",
+		MaxPeers:    10,
+		ListenAddr:  "127.0.0.1:0",
+		NoDiscovery: true,
+		Protocols: []p2p.Protocol{{
+			Name:    avn.ProtocolName,
+			Version: 66,
+			Length:  17,
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				if err := p2p.Send(rw, 0, status); err != nil {
+					return err
+				}
+				_, err := rw.ReadMsg()
+				return err
+			},
+		}},
+	}}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	addr, _ := net.ResolveTCPAddr("tcp", srv.ListenAddr)
+	n := enode.NewV4(&key.PublicKey, addr.IP, addr.Port, 0)
+	ourKey, _ := crypto.GenerateKey()
+	hello, gotStatus, err := probeNode(ourKey, n)
+	if err != nil {
+		t.Fatal("probe failed:", err)
+	}
+	if hello.Name != "test/v1.2.3" {
+		t.Errorf("wrong client name %q", hello.Name)
+	}
+	if !reflect.DeepEqual(gotStatus, status) {
+		t.Errorf("wrong status:\nhave %+v\nwant %+v", gotStatus, status)
+	}
+}
+
+// This test checks census stats, snapshots and the HTTP API.
+func TestCensusAPI(t *testing.T) {
+	db := memorydb.New()
+	c, err := newCensus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		keys  = make([]*ecdsa.PrivateKey, 3)
+		nodes = make([]*enode.Node, 3)
+	)
+	for i := range nodes {
+		keys[i], _ = crypto.GenerateKey()
+		nodes[i] = enode.NewV4(&keys[i].PublicKey, net.IP{10, 0, 0, byte(i)}, 30303, 30303)
+	}
+	c.probe = func(_ *ecdsa.PrivateKey, n *enode.Node) (*avntest.Hello, *avn.StatusPacket, error) {
+		switch n.ID() {
+		case nodes[0].ID():
+			return &avntest.Hello{Name: "Geth/v1.10.3-stable/linux-amd64/go1.16", Caps: []p2p.Cap{{Name: "avn", Version: 66}}},
+				&avn.StatusPacket{NetworkID: 1, TD: big.NewInt(1), ForkID: forkid.ID{Hash: [4]byte{1, 2, 3, 4}}}, nil
+		case nodes[1].ID():
+			return &avntest.Hello{Name: "Nethermind/v1.10.73-0/X64-Linux"}, nil, nil
+		default:
+			return nil, nil, errors.New("connection refused")
+		}
+	}
+	for _, n := range nodes {
+		c.add(n)
+		c.update(<-c.queue)
+	}
+
+	// Nodes are persisted.
+	c2, err := newCensus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, _ := json.Marshal(c2.list())
+	want, _ := json.Marshal(c.list())
+	if string(have) != string(want) {
+		t.Fatalf("nodes not persisted:\nhave %s\nwant %s", have, want)
+	}
+
+	// Take two snapshots.
+	t0 := time.Unix(1000, 0)
+	if err := c.snapshot(t0); err != nil {
+		t.Fatal(err)
+	}
+	c.update(nodes[1]) // no change
+	if err := c.snapshot(t0.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer((&censusAPI{c}).handler())
+	defer srv.Close()
+	get := func(path string, result interface{}) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: status %s", path, resp.Status)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stats censusStats
+	get("/stats", &stats)
+	wantClients := map[string]int{"Geth": 1, "Nethermind": 1}
+	wantVersions := map[string]int{"Geth/v1.10.3": 1, "Nethermind/v1.10.73": 1}
+	wantForks := map[string]int{"1/0x01020304/0": 1}
+	if stats.Nodes != 2 {
+		t.Errorf("wrong node count %d", stats.Nodes)
+	}
+	if !reflect.DeepEqual(stats.Clients, wantClients) {
+		t.Errorf("wrong clients %v", stats.Clients)
+	}
+	if !reflect.DeepEqual(stats.Versions, wantVersions) {
+		t.Errorf("wrong versions %v", stats.Versions)
+	}
+	if !reflect.DeepEqual(stats.ForkIDs, wantForks) {
+		t.Errorf("wrong fork IDs %v", stats.ForkIDs)
+	}
+
+	var list []censusNode
+	get("/nodes?client=geth", &list)
+	if len(list) != 1 || list[0].N.ID() != nodes[0].ID() || list[0].Status.NetworkID != 1 {
+		t.Errorf("wrong nodes for client filter: %+v", list)
+	}
+
+	var snaps []censusStats
+	get("/snapshots", &snaps)
+	if len(snaps) != 2 || !snaps[0].Time.Equal(t0) || snaps[0].Nodes != 2 {
+		t.Errorf("wrong snapshots: %+v", snaps)
+	}
+	get("/snapshots?from=1001", &snaps)
+	if len(snaps) != 1 || !snaps[0].Time.Equal(t0.Add(time.Hour)) {
+		t.Errorf("wrong snapshots for time range: %+v", snaps)
+	}
+
+	// Nodes which are not seen anymore expire.
+	c.expire(time.Now().Add(censusNodeLifetime))
+	if n := len(c.list()); n != 0 {
+		t.Errorf("%d nodes left after expiry", n)
+	}
+	if c2, _ := newCensus(db); len(c2.list()) != 0 {
+		t.Error("expired nodes not deleted from database")
+	}
+}
+
+// This test checks that the crawler output is pruned in census mode, so it
+// doesn't grow without bound while the crawler runs.
+func TestCrawlerPrune(t *testing.T) {
+	now := truncNow()
+	c := newCrawler(nil, nil)
+	c.nodeLifetime = censusNodeLifetime
+
+	live, gone := enode.ID{1}, enode.ID{2}
+	c.output[live] = nodeJSON{Score: 1, LastResponse: now.Add(-time.Hour)}
+	c.output[gone] = nodeJSON{Score: 5, LastResponse: now.Add(-censusNodeLifetime)}
+
+	c.prune(now)
+	if _, ok := c.output[live]; !ok {
+		t.Error("live node was pruned")
+	}
+	if _, ok := c.output[gone]; ok {
+		t.Error("stale node was not pruned")
+	}
+}
@@ -34,6 +34,8 @@ type crawler struct {
 
 	// settings
 	revalidateInterval time.Duration
+	nodeLifetime       time.Duration     // if set, nodes not responding for this long are dropped from output
+	onResponse         func(*enode.Node) // called for nodes that respond to ENR requests
 }
 
 type resolver interface {
@@ -65,8 +67,15 @@ func (c *crawler) run(timeout time.Duration) nodeSet {
 		timeoutCh    <-chan time.Time
 		doneCh       = make(chan enode.Iterator, len(c.iters))
 		liveIters    = len(c.iters)
+		pruneCh      <-chan time.Time
 	)
 	defer timeoutTimer.Stop()
+	if c.nodeLifetime > 0 {
+		// Nodes are pruned as often as they are revalidated.
+		pruneTicker := time.NewTicker(c.revalidateInterval)
+		defer pruneTicker.Stop()
+		pruneCh = pruneTicker.C
+	}
 	for _, it := range c.iters {
 		go c.runIterator(doneCh, it)
 	}
@@ -89,6 +98,8 @@ loop:
 			}
 		case <-timeoutCh:
 			break loop
+		case <-pruneCh:
+			c.prune(truncNow())
 		}
 	}
 
@@ -139,6 +150,9 @@ func (c *crawler) updateNode(n *enode.Node) {
 			node.FirstResponse = node.LastCheck
 		}
 		node.LastResponse = node.LastCheck
+		if c.onResponse != nil {
+			c.onResponse(nn)
+		}
 	}
 
 	// Store/update node in output set.
@@ -151,6 +165,17 @@ func (c *crawler) updateNode(n *enode.Node) {
 	}
 }
 
+// prune removes nodes which haven't responded for longer than the node lifetime
+// from the output set.
+func (c *crawler) prune(now time.Time) {
+	for id, node := range c.output {
+		if now.Sub(node.LastResponse) >= c.nodeLifetime {
+			log.Debug("Pruning node", "id", id, "lastResponse", node.LastResponse)
+			delete(c.output, id)
+		}
+	}
+}
+
 func truncNow() time.Time {
 	return time.Now().UTC().Truncate(1 * time.Second)
 }
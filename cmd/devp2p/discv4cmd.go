@@ -76,6 +76,13 @@ var (
 		Action: discv4Crawl,
 		Flags:  []cli.Flag{bootnodesFlag, crawlTimeoutFlag},
 	}
+	discv4CensusCommand = cli.Command{
+		Name:      "census",
+		Usage:     "Crawls the DHT continuously and collects client and chain information via RLPx",
+		ArgsUsage: "<database-directory>",
+		Action:    discv4Census,
+		Flags:     []cli.Flag{bootnodesFlag, censusHTTPFlag, censusSnapshotFlag},
+	}
 	discv4TestCommand = cli.Command{
 		Name:   "test",
 		Usage:  "Runs tests against a node",
@@ -203,6 +210,13 @@ func discv4Crawl(ctx *cli.Context) error {
 	return nil
 }
 
+// discv4Census runs the crawler in census mode.
+func discv4Census(ctx *cli.Context) error {
+	disc := startV4(ctx)
+	defer disc.Close()
+	return runCensus(ctx, disc, disc.Close, disc.RandomNodes())
+}
+
 // discv4Test runs the protocol test suite.
 func discv4Test(ctx *cli.Context) error {
 	// Configure test package globals.
@@ -23,6 +23,7 @@ import (
 	"github.com/avalanria/go-avalanria/cmd/devp2p/internal/v5test"
 	"github.com/avalanria/go-avalanria/common"
 	"github.com/avalanria/go-avalanria/p2p/discover"
+	"github.com/avalanria/go-avalanria/p2p/enode"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -36,6 +37,8 @@ var (
 			discv5CrawlCommand,
 			discv5TestCommand,
 			discv5ListenCommand,
+			discv5TopicRegisterCommand,
+			discv5TopicSearchCommand,
 		},
 	}
 	discv5PingCommand = cli.Command{
@@ -55,6 +58,13 @@ var (
 		Action: discv5Crawl,
 		Flags:  []cli.Flag{bootnodesFlag, crawlTimeoutFlag},
 	}
+	discv5CensusCommand = cli.Command{
+		Name:      "census",
+		Usage:     "Crawls the DHT continuously and collects client and chain information via RLPx",
+		ArgsUsage: "<database-directory>",
+		Action:    discv5Census,
+		Flags:     []cli.Flag{bootnodesFlag, censusHTTPFlag, censusSnapshotFlag},
+	}
 	discv5TestCommand = cli.Command{
 		Name:   "test",
 		Usage:  "Runs protocol tests against a node",
@@ -77,6 +87,30 @@ var (
 			listenAddrFlag,
 		},
 	}
+	discv5TopicRegisterCommand = cli.Command{
+		Name:      "topic-register",
+		Usage:     "Runs a node advertising itself under a topic",
+		ArgsUsage: "<topic>",
+		Action:    discv5TopicRegister,
+		Flags: []cli.Flag{
+			bootnodesFlag,
+			nodekeyFlag,
+			nodedbFlag,
+			listenAddrFlag,
+		},
+	}
+	discv5TopicSearchCommand = cli.Command{
+		Name:      "topic-search",
+		Usage:     "Finds nodes advertising a topic",
+		ArgsUsage: "<topic>",
+		Action:    discv5TopicSearch,
+		Flags:     []cli.Flag{bootnodesFlag, topicSearchTimeoutFlag},
+	}
+	topicSearchTimeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "Time limit for the search.",
+		Value: time.Minute,
+	}
 )
 
 func discv5Ping(ctx *cli.Context) error {
@@ -116,6 +150,13 @@ func discv5Crawl(ctx *cli.Context) error {
 	return nil
 }
 
+// discv5Census runs the crawler in census mode.
+func discv5Census(ctx *cli.Context) error {
+	disc := startV5(ctx)
+	defer disc.Close()
+	return runCensus(ctx, disc, disc.Close, disc.RandomNodes())
+}
+
 // discv5Test runs the protocol test suite.
 func discv5Test(ctx *cli.Context) error {
 	suite := &v5test.Suite{
@@ -134,6 +175,43 @@ func discv5Listen(ctx *cli.Context) error {
 	select {}
 }
 
+func discv5TopicRegister(ctx *cli.Context) error {
+	topic := getTopicArg(ctx)
+	disc := startV5(ctx)
+	defer disc.Close()
+
+	disc.RegisterTopic(topic)
+	fmt.Println(disc.Self())
+	select {}
+}
+
+func discv5TopicSearch(ctx *cli.Context) error {
+	topic := getTopicArg(ctx)
+	disc := startV5(ctx)
+	defer disc.Close()
+
+	it := disc.TopicSearch(topic)
+	timeout := time.AfterFunc(ctx.Duration(topicSearchTimeoutFlag.Name), it.Close)
+	defer timeout.Stop()
+
+	seen := make(map[enode.ID]bool)
+	for it.Next() {
+		if n := it.Node(); !seen[n.ID()] {
+			seen[n.ID()] = true
+			fmt.Println(n)
+		}
+	}
+	return nil
+}
+
+// getTopicArg returns the topic named by the first argument.
+func getTopicArg(ctx *cli.Context) discover.Topic {
+	if ctx.NArg() < 1 {
+		exit("missing topic as command-line argument")
+	}
+	return discover.NewTopic(ctx.Args().First())
+}
+
 // startV5 starts an ephemeral discovery v5 node.
 func startV5(ctx *cli.Context) *discover.UDPv5 {
 	ln, config := makeDiscoveryConfig(ctx)
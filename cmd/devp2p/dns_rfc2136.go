@@ -0,0 +1,713 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of go-avalanria.
+//
+// go-avalanria is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-avalanria is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-avalanria. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/p2p/dnsdisc"
+	"golang.org/x/net/dns/dnsmessage"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// Updates are sent over TCP, which limits messages to 64KB. The limit leaves room
+	// for the message header and the TSIG record.
+	rfc2136ChangeSizeLimit = 60000
+	rfc2136Timeout         = 30 * time.Second
+
+	tsigFudge = 300 // permitted clock skew in seconds
+
+	opcodeUpdate = dnsmessage.OpCode(5)
+	typeTSIG     = dnsmessage.Type(250)
+	classNONE    = dnsmessage.Class(254)
+)
+
+var (
+	rfc2136ServerFlag = cli.StringFlag{
+		Name:  "server",
+		Usage: "Address of the authoritative DNS server (host:port)",
+	}
+	rfc2136ZoneFlag = cli.StringFlag{
+		Name:  "zone",
+		Usage: "DNS zone containing the tree (defaults to the tree domain)",
+	}
+	tsigKeyFlag = cli.StringFlag{
+		Name:  "tsig-key",
+		Usage: "Name of the TSIG key authenticating the updates",
+	}
+	tsigSecretFlag = cli.StringFlag{
+		Name:   "tsig-secret",
+		Usage:  "Base64-encoded TSIG secret",
+		EnvVar: "DNS_TSIG_SECRET",
+	}
+	tsigAlgorithmFlag = cli.StringFlag{
+		Name:  "tsig-algorithm",
+		Usage: "TSIG algorithm (hmac-sha256, hmac-sha384, hmac-sha512)",
+		Value: "hmac-sha256",
+	}
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha256.": sha256.New,
+	"hmac-sha384.": sha512.New384,
+	"hmac-sha512.": sha512.New,
+}
+
+// Response codes defined for dynamic updates and TSIG.
+var rfc2136RCodes = map[dnsmessage.RCode]string{
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+}
+
+var (
+	errTSIGMissing = errors.New("missing TSIG record")
+	errTSIGKey     = errors.New("TSIG record signed with unknown key")
+	errTSIGMAC     = errors.New("invalid TSIG signature")
+	errTSIGTime    = errors.New("TSIG time outside of permitted skew")
+)
+
+// rfc2136Client deploys trees to an authoritative DNS server using dynamic updates.
+type rfc2136Client struct {
+	server   string
+	zone     string
+	key      *tsigKey // nil if updates are not signed
+	resolver dnsdisc.Resolver
+}
+
+// rfc2136Change replaces the TXT record of a name.
+type rfc2136Change struct {
+	name     string
+	ttl      uint32
+	oldValue string // value to delete, empty if the name is new
+	newValue string // value to add, empty if the name is removed
+}
+
+// newRFC2136Client sets up a dynamic update client from command line flags.
+func newRFC2136Client(ctx *cli.Context) *rfc2136Client {
+	server := ctx.String(rfc2136ServerFlag.Name)
+	if server == "" {
+		exit(fmt.Errorf("need DNS server address to proceed"))
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	c := &rfc2136Client{
+		server:   server,
+		zone:     ctx.String(rfc2136ZoneFlag.Name),
+		resolver: dnsdisc.NewServerResolver(server),
+	}
+	if name := ctx.String(tsigKeyFlag.Name); name != "" {
+		key, err := newTSIGKey(name, ctx.String(tsigAlgorithmFlag.Name), ctx.String(tsigSecretFlag.Name))
+		if err != nil {
+			exit(err)
+		}
+		c.key = key
+	}
+	return c
+}
+
+// deploy uploads the given tree to the DNS server.
+func (c *rfc2136Client) deploy(name string, t *dnsdisc.Tree) error {
+	name = strings.ToLower(name)
+	if c.zone == "" {
+		c.zone = name
+	}
+	if !isSubdomain(name, c.zone) {
+		return fmt.Errorf("tree domain %s is not in zone %s", name, c.zone)
+	}
+
+	// Compute DNS changes.
+	existing, err := c.collectRecords(name)
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("Found %d TXT records", len(existing)))
+	changes := c.computeChanges(name, t.ToTXT(name), existing)
+	return c.submitChanges(changes)
+}
+
+// collectRecords resolves the records of the tree currently published at name.
+func (c *rfc2136Client) collectRecords(name string) (map[string]string, error) {
+	existing := make(map[string]string)
+	log.Info("Loading existing TXT records", "name", name, "server", c.server)
+	root, err := c.lookupTXT(name, "enrtree-root:")
+	if err != nil || root == "" {
+		return existing, err
+	}
+	existing[name] = root
+
+	var queue []string
+	for _, field := range strings.Fields(root) {
+		if strings.HasPrefix(field, "e=") || strings.HasPrefix(field, "l=") {
+			queue = append(queue, field[2:])
+		}
+	}
+	for len(queue) > 0 {
+		path := strings.ToLower(queue[0]) + "." + name
+		queue = queue[1:]
+		if _, ok := existing[path]; ok {
+			continue
+		}
+		txt, err := c.lookupTXT(path, "")
+		if err != nil {
+			return nil, err
+		}
+		if txt == "" {
+			continue
+		}
+		existing[path] = txt
+		if strings.HasPrefix(txt, "enrtree-branch:") {
+			for _, hash := range strings.Split(strings.TrimPrefix(txt, "enrtree-branch:"), ",") {
+				if hash != "" {
+					queue = append(queue, hash)
+				}
+			}
+		}
+	}
+	return existing, nil
+}
+
+// lookupTXT returns the first TXT record of name with the given prefix, or the empty
+// string if there is none.
+func (c *rfc2136Client) lookupTXT(name, prefix string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rfc2136Timeout)
+	defer cancel()
+
+	txts, err := c.resolver.LookupTXT(ctx, name+".")
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	for _, txt := range txts {
+		if strings.HasPrefix(txt, prefix) {
+			return txt, nil
+		}
+	}
+	return "", nil
+}
+
+// computeChanges creates DNS changes for the given set of DNS discovery records.
+// The 'existing' arg is the set of records that are currently published.
+func (c *rfc2136Client) computeChanges(name string, records map[string]string, existing map[string]string) []rfc2136Change {
+	// Convert all names to lowercase.
+	lrecords := make(map[string]string, len(records))
+	for name, r := range records {
+		lrecords[strings.ToLower(name)] = r
+	}
+	records = lrecords
+
+	var changes []rfc2136Change
+	for path, newValue := range records {
+		ttl := uint32(treeNodeTTL)
+		if path == name {
+			ttl = rootTTL
+		}
+		prevValue, exists := existing[path]
+		switch {
+		case !exists:
+			log.Info(fmt.Sprintf("Creating %s = %q", path, newValue))
+			changes = append(changes, rfc2136Change{name: path, ttl: ttl, newValue: newValue})
+		case prevValue != newValue:
+			log.Info(fmt.Sprintf("Updating %s from %q to %q", path, prevValue, newValue))
+			changes = append(changes, rfc2136Change{name: path, ttl: ttl, oldValue: prevValue, newValue: newValue})
+		default:
+			log.Debug(fmt.Sprintf("Skipping %s = %q", path, newValue))
+		}
+	}
+	for path, value := range existing {
+		if _, ok := records[path]; ok {
+			continue
+		}
+		log.Info(fmt.Sprintf("Deleting %s = %q", path, value))
+		changes = append(changes, rfc2136Change{name: path, oldValue: value})
+	}
+
+	// Ensure changes are in leaf-added -> root-changed -> leaf-deleted order.
+	score := func(ch rfc2136Change) int {
+		switch {
+		case ch.oldValue == "":
+			return 1
+		case ch.newValue != "":
+			return 2
+		default:
+			return 3
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if si, sj := score(changes[i]), score(changes[j]); si != sj {
+			return si < sj
+		}
+		return changes[i].name < changes[j].name
+	})
+	return changes
+}
+
+// submitChanges sends the changes to the DNS server. Each update message is applied
+// atomically by the server.
+func (c *rfc2136Client) submitChanges(changes []rfc2136Change) error {
+	if len(changes) == 0 {
+		log.Info("No DNS changes needed")
+		return nil
+	}
+	batches := splitRFC2136Changes(changes, rfc2136ChangeSizeLimit)
+	for i, batch := range batches {
+		log.Info(fmt.Sprintf("Submitting %d changes to %s (%d/%d)", len(batch), c.server, i+1, len(batches)))
+		msg, err := c.makeUpdate(batch)
+		if err != nil {
+			return err
+		}
+		if err := c.update(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitRFC2136Changes splits up DNS changes such that each update message stays
+// below the given size.
+func splitRFC2136Changes(changes []rfc2136Change, sizeLimit int) [][]rfc2136Change {
+	var (
+		batches   [][]rfc2136Change
+		batchSize int
+	)
+	for _, ch := range changes {
+		// Each record carries the name, type, class, TTL and RDATA length.
+		size := 2*(len(ch.name)+12) + len(ch.oldValue) + len(ch.newValue) + 2*(len(ch.oldValue)+len(ch.newValue))/255 + 2
+		if len(batches) == 0 || batchSize+size > sizeLimit {
+			batches = append(batches, nil)
+			batchSize = 0
+		}
+		batches[len(batches)-1] = append(batches[len(batches)-1], ch)
+		batchSize += size
+	}
+	return batches
+}
+
+// makeUpdate creates an update message applying the given changes.
+func (c *rfc2136Client) makeUpdate(changes []rfc2136Change) ([]byte, error) {
+	zone, err := dnsmessage.NewName(c.zone + ".")
+	if err != nil {
+		return nil, err
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: uint16(rand.Uint32()), OpCode: opcodeUpdate})
+	b.StartQuestions()
+	if err := b.Question(dnsmessage.Question{Name: zone, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	b.StartAuthorities()
+	for _, ch := range changes {
+		name, err := dnsmessage.NewName(ch.name + ".")
+		if err != nil {
+			return nil, err
+		}
+		if ch.oldValue != "" {
+			// The tree root may share its name with other TXT records, so only the
+			// root record itself is deleted. Tree entries own their names.
+			h := dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassANY}
+			r := dnsmessage.TXTResource{}
+			if strings.HasPrefix(ch.oldValue, "enrtree-root:") {
+				h.Class, r.TXT = classNONE, splitTXTStrings(ch.oldValue)
+			}
+			if err := b.TXTResource(h, r); err != nil {
+				return nil, err
+			}
+		}
+		if ch.newValue != "" {
+			h := dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: ch.ttl}
+			if err := b.TXTResource(h, dnsmessage.TXTResource{TXT: splitTXTStrings(ch.newValue)}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+// update sends an update message to the server and checks the response.
+func (c *rfc2136Client) update(msg []byte) error {
+	var mac []byte
+	if c.key != nil {
+		msg, mac = c.key.sign(msg, nil, time.Now())
+	}
+	resp, err := c.exchange(msg)
+	if err != nil {
+		return err
+	}
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return fmt.Errorf("invalid response from %s: %v", c.server, err)
+	}
+	if !h.Response || h.ID != binary.BigEndian.Uint16(msg) {
+		return fmt.Errorf("invalid response from %s: request ID mismatch", c.server)
+	}
+	if h.RCode != dnsmessage.RCodeSuccess {
+		rcode := h.RCode.String()
+		if name, ok := rfc2136RCodes[h.RCode]; ok {
+			rcode = name
+		}
+		return fmt.Errorf("update rejected by %s: %s", c.server, rcode)
+	}
+	if c.key != nil {
+		if _, _, err := c.key.verify(resp, mac, time.Now()); err != nil {
+			return fmt.Errorf("invalid response from %s: %v", c.server, err)
+		}
+	}
+	return nil
+}
+
+// exchange sends a message to the server over TCP and reads the response.
+func (c *rfc2136Client) exchange(msg []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", c.server, rfc2136Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(rfc2136Timeout))
+
+	if err := writeTCPMessage(conn, msg); err != nil {
+		return nil, err
+	}
+	return readTCPMessage(conn)
+}
+
+// writeTCPMessage writes a length-prefixed DNS message.
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readTCPMessage reads a length-prefixed DNS message.
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// splitTXTStrings splits value into the 255-byte character strings of a TXT record.
+func splitTXTStrings(value string) []string {
+	var result []string
+	for len(value) > 0 {
+		n := len(value)
+		if n > 255 {
+			n = 255
+		}
+		result = append(result, value[:n])
+		value = value[n:]
+	}
+	return result
+}
+
+// tsigKey authenticates DNS messages with a shared secret (RFC 8945).
+type tsigKey struct {
+	name      string // key name in canonical form
+	algorithm string // algorithm name in canonical form
+	hash      func() hash.Hash
+	secret    []byte
+}
+
+// tsigRecord is the RDATA of a TSIG record.
+type tsigRecord struct {
+	algorithm  string
+	timeSigned uint64 // 48 bits
+	fudge      uint16
+	mac        []byte
+	origID     uint16
+	err        uint16
+	other      []byte
+}
+
+func newTSIGKey(name, algorithm, secret string) (*tsigKey, error) {
+	algorithm = canonicalName(algorithm)
+	h, ok := tsigAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TSIG algorithm %q", algorithm)
+	}
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TSIG secret: %v", err)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("empty TSIG secret")
+	}
+	return &tsigKey{name: canonicalName(name), algorithm: algorithm, hash: h, secret: key}, nil
+}
+
+// sign appends a TSIG record to msg. When signing a response, requestMAC is the MAC
+// of the request. It returns the signed message and its MAC.
+func (k *tsigKey) sign(msg, requestMAC []byte, now time.Time) ([]byte, []byte) {
+	rec := tsigRecord{
+		algorithm:  k.algorithm,
+		timeSigned: uint64(now.Unix()),
+		fudge:      tsigFudge,
+		origID:     binary.BigEndian.Uint16(msg),
+	}
+	rec.mac = k.mac(msg, requestMAC, &rec)
+
+	rdata := rec.encode()
+	signed := make([]byte, len(msg), len(msg)+len(rdata)+64)
+	copy(signed, msg)
+	signed = append(signed, packName(k.name)...)
+	signed = append(signed, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	fixed := signed[len(signed)-10:]
+	binary.BigEndian.PutUint16(fixed[0:], uint16(typeTSIG))
+	binary.BigEndian.PutUint16(fixed[2:], uint16(dnsmessage.ClassANY))
+	binary.BigEndian.PutUint16(fixed[8:], uint16(len(rdata)))
+	signed = append(signed, rdata...)
+
+	// Increment the additional record count.
+	binary.BigEndian.PutUint16(signed[10:], binary.BigEndian.Uint16(signed[10:])+1)
+	return signed, rec.mac
+}
+
+// verify checks the TSIG record at the end of msg. When verifying a response,
+// requestMAC is the MAC of the request. It returns the message without the TSIG
+// record and the MAC.
+func (k *tsigKey) verify(msg, requestMAC []byte, now time.Time) ([]byte, []byte, error) {
+	off, err := lastRecordOffset(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	name, pos, err := unpackName(msg, off)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pos+10 > len(msg) || dnsmessage.Type(binary.BigEndian.Uint16(msg[pos:])) != typeTSIG {
+		return nil, nil, errTSIGMissing
+	}
+	rdlen := int(binary.BigEndian.Uint16(msg[pos+8:]))
+	if pos+10+rdlen != len(msg) {
+		return nil, nil, errTSIGMissing
+	}
+	rec, err := decodeTSIGRecord(msg[pos+10:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if name != k.name || rec.algorithm != k.algorithm {
+		return nil, nil, errTSIGKey
+	}
+	if rec.err != 0 {
+		return nil, nil, fmt.Errorf("TSIG error %d", rec.err)
+	}
+
+	// Restore the message as it was before signing.
+	stripped := make([]byte, off)
+	copy(stripped, msg)
+	binary.BigEndian.PutUint16(stripped[0:], rec.origID)
+	binary.BigEndian.PutUint16(stripped[10:], binary.BigEndian.Uint16(stripped[10:])-1)
+	if !hmac.Equal(rec.mac, k.mac(stripped, requestMAC, rec)) {
+		return nil, nil, errTSIGMAC
+	}
+	if skew := now.Unix() - int64(rec.timeSigned); skew > int64(rec.fudge) || -skew > int64(rec.fudge) {
+		return nil, nil, errTSIGTime
+	}
+	return stripped, rec.mac, nil
+}
+
+// mac computes the MAC of a message.
+func (k *tsigKey) mac(msg, requestMAC []byte, rec *tsigRecord) []byte {
+	h := hmac.New(k.hash, k.secret)
+	if requestMAC != nil {
+		var size [2]byte
+		binary.BigEndian.PutUint16(size[:], uint16(len(requestMAC)))
+		h.Write(size[:])
+		h.Write(requestMAC)
+	}
+	h.Write(msg)
+
+	// TSIG variables: key name, class, TTL, algorithm, time, fudge, error, other data.
+	vars := packName(k.name)
+	vars = append(vars, 0, byte(dnsmessage.ClassANY), 0, 0, 0, 0)
+	vars = append(vars, packName(rec.algorithm)...)
+	var fixed [12]byte
+	putUint48(fixed[0:], rec.timeSigned)
+	binary.BigEndian.PutUint16(fixed[6:], rec.fudge)
+	binary.BigEndian.PutUint16(fixed[8:], rec.err)
+	binary.BigEndian.PutUint16(fixed[10:], uint16(len(rec.other)))
+	vars = append(vars, fixed[:]...)
+	vars = append(vars, rec.other...)
+	h.Write(vars)
+	return h.Sum(nil)
+}
+
+func (rec *tsigRecord) encode() []byte {
+	enc := packName(rec.algorithm)
+	fixed := make([]byte, 10+len(rec.mac)+6)
+	putUint48(fixed[0:], rec.timeSigned)
+	binary.BigEndian.PutUint16(fixed[6:], rec.fudge)
+	binary.BigEndian.PutUint16(fixed[8:], uint16(len(rec.mac)))
+	copy(fixed[10:], rec.mac)
+	rest := fixed[10+len(rec.mac):]
+	binary.BigEndian.PutUint16(rest[0:], rec.origID)
+	binary.BigEndian.PutUint16(rest[2:], rec.err)
+	binary.BigEndian.PutUint16(rest[4:], uint16(len(rec.other)))
+	enc = append(enc, fixed...)
+	return append(enc, rec.other...)
+}
+
+func decodeTSIGRecord(rdata []byte) (*tsigRecord, error) {
+	var (
+		rec    = new(tsigRecord)
+		errBad = errors.New("invalid TSIG record")
+		err    error
+		pos    int
+	)
+	if rec.algorithm, pos, err = unpackName(rdata, 0); err != nil {
+		return nil, err
+	}
+	if pos+10 > len(rdata) {
+		return nil, errBad
+	}
+	rec.timeSigned = uint64(binary.BigEndian.Uint16(rdata[pos:]))<<32 | uint64(binary.BigEndian.Uint32(rdata[pos+2:]))
+	rec.fudge = binary.BigEndian.Uint16(rdata[pos+6:])
+	macSize := int(binary.BigEndian.Uint16(rdata[pos+8:]))
+	pos += 10
+	if pos+macSize+6 > len(rdata) {
+		return nil, errBad
+	}
+	rec.mac = rdata[pos : pos+macSize]
+	pos += macSize
+	rec.origID = binary.BigEndian.Uint16(rdata[pos:])
+	rec.err = binary.BigEndian.Uint16(rdata[pos+2:])
+	otherLen := int(binary.BigEndian.Uint16(rdata[pos+4:]))
+	pos += 6
+	if pos+otherLen != len(rdata) {
+		return nil, errBad
+	}
+	rec.other = rdata[pos:]
+	return rec, nil
+}
+
+// lastRecordOffset returns the offset of the last resource record in msg.
+func lastRecordOffset(msg []byte) (int, error) {
+	if len(msg) < 12 {
+		return 0, errors.New("message too short")
+	}
+	var (
+		qdcount = int(binary.BigEndian.Uint16(msg[4:]))
+		rrcount = int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+		off     = 12
+		last    = -1
+		err     error
+	)
+	for i := 0; i < qdcount; i++ {
+		if off, err = skipName(msg, off); err != nil {
+			return 0, err
+		}
+		off += 4
+	}
+	for i := 0; i < rrcount; i++ {
+		last = off
+		if off, err = skipName(msg, off); err != nil {
+			return 0, err
+		}
+		if off+10 > len(msg) {
+			return 0, errors.New("truncated record")
+		}
+		off += 10 + int(binary.BigEndian.Uint16(msg[off+8:]))
+	}
+	if last < 0 || off != len(msg) {
+		return 0, errTSIGMissing
+	}
+	return last, nil
+}
+
+// skipName returns the offset after the (possibly compressed) name at off.
+func skipName(msg []byte, off int) (int, error) {
+	for off < len(msg) {
+		switch l := int(msg[off]); {
+		case l == 0:
+			return off + 1, nil
+		case l&0xC0 == 0xC0:
+			return off + 2, nil
+		default:
+			off += 1 + l
+		}
+	}
+	return 0, errors.New("truncated name")
+}
+
+// unpackName decodes an uncompressed name, as required for TSIG records.
+func unpackName(msg []byte, off int) (string, int, error) {
+	var name strings.Builder
+	for off < len(msg) {
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			if name.Len() == 0 {
+				return ".", off + 1, nil
+			}
+			return strings.ToLower(name.String()), off + 1, nil
+		case l&0xC0 != 0 || off+1+l > len(msg):
+			return "", 0, errors.New("invalid name in TSIG record")
+		}
+		name.Write(msg[off+1 : off+1+l])
+		name.WriteByte('.')
+		off += 1 + l
+	}
+	return "", 0, errors.New("truncated name")
+}
+
+// packName encodes a name in canonical wire format.
+func packName(name string) []byte {
+	var enc []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label != "" {
+			enc = append(enc, byte(len(label)))
+			enc = append(enc, strings.ToLower(label)...)
+		}
+	}
+	return append(enc, 0)
+}
+
+// canonicalName returns name in lowercase with a trailing dot.
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+func putUint48(b []byte, v uint64) {
+	binary.BigEndian.PutUint16(b, uint16(v>>32))
+	binary.BigEndian.PutUint32(b[2:], uint32(v))
+}
@@ -0,0 +1,419 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of go-avalanria.
+//
+// go-avalanria is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-avalanria is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-avalanria. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/p2p/dnsdisc"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/enr"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// This test deploys trees to an in-process DNS server and checks that they can be
+// synced from it.
+func TestRFC2136Deploy(t *testing.T) {
+	key := testTSIGKey(t, "secret")
+	srv := newTestDNSServer(t, "example.org", key)
+	defer srv.close()
+
+	// Other TXT records at the tree root must survive deployments.
+	srv.setRecords(map[string][]string{"nodes.example.org": {"unrelated"}})
+
+	var (
+		signer = testDNSKey(t)
+		nodes  = testDNSNodes(t, 8)
+		client = &rfc2136Client{server: srv.addr(), zone: "example.org", key: key, resolver: dnsdisc.NewServerResolver(srv.addr())}
+	)
+	tree1, url := testDNSTree(t, 1, nodes[:5], signer)
+	if err := client.deploy("nodes.example.org", tree1); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	checkDNSSync(t, srv.addr(), url, nodes[:5])
+
+	// The second tree replaces the first one.
+	tree2, url := testDNSTree(t, 2, nodes[3:], signer)
+	if err := client.deploy("nodes.example.org", tree2); err != nil {
+		t.Fatalf("deploy failed: %v", err)
+	}
+	checkDNSSync(t, srv.addr(), url, nodes[3:])
+
+	want := map[string][]string{"nodes.example.org": {"unrelated"}}
+	for name, value := range tree2.ToTXT("nodes.example.org") {
+		name = strings.ToLower(name)
+		want[name] = append(want[name], value)
+	}
+	for _, values := range want {
+		sort.Strings(values)
+	}
+	if have := srv.getRecords(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("wrong records on server after update:\nhave %v\nwant %v", have, want)
+	}
+}
+
+// This test checks that updates signed with the wrong key are rejected.
+func TestRFC2136DeployUnauthorized(t *testing.T) {
+	srv := newTestDNSServer(t, "example.org", testTSIGKey(t, "secret"))
+	defer srv.close()
+
+	client := &rfc2136Client{
+		server:   srv.addr(),
+		zone:     "example.org",
+		key:      testTSIGKey(t, "wrong secret"),
+		resolver: dnsdisc.NewServerResolver(srv.addr()),
+	}
+	tree, _ := testDNSTree(t, 1, testDNSNodes(t, 2), testDNSKey(t))
+	err := client.deploy("nodes.example.org", tree)
+	if err == nil || !strings.Contains(err.Error(), "NOTAUTH") {
+		t.Fatalf("wrong error for unauthorized update: %v", err)
+	}
+	if records := srv.getRecords(); len(records) != 0 {
+		t.Fatalf("unauthorized update applied: %v", records)
+	}
+}
+
+// This test checks the zone file output.
+func TestZoneFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-zonefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tree, _ := testDNSTree(t, 1, testDNSNodes(t, 3), testDNSKey(t))
+	file := filepath.Join(dir, "zone")
+	writeZoneFile(file, "nodes.example.org", tree)
+	zone, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(zone)), "\n")
+	if lines[1] != "$ORIGIN nodes.example.org." {
+		t.Fatalf("wrong origin line %q", lines[1])
+	}
+	records := tree.ToTXT("nodes.example.org")
+	if len(lines) != 2+len(records) {
+		t.Fatalf("wrong number of lines %d, want %d", len(lines), 2+len(records))
+	}
+	if want := "@\t1800\tIN\tTXT\t\"" + records["nodes.example.org"] + "\""; lines[2] != want {
+		t.Fatalf("wrong root record:\nhave %q\nwant %q", lines[2], want)
+	}
+	for _, line := range lines[3:] {
+		fields := strings.Split(line, "\t")
+		value := strings.Replace(strings.Trim(fields[4], `"`), `" "`, "", -1)
+		if name := strings.ToUpper(fields[0]) + ".nodes.example.org"; records[name] != value {
+			t.Errorf("wrong record %q", line)
+		}
+	}
+}
+
+func checkDNSSync(t *testing.T, server, url string, want []*enode.Node) {
+	t.Helper()
+
+	client := dnsdisc.NewClient(dnsdisc.Config{ResolverAddr: server, RateLimit: 1000})
+	tree, err := client.SyncTree(url)
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	have := tree.Nodes()
+	sortByID(have)
+	sortByID(want)
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("wrong nodes in synced tree:\nhave %v\nwant %v", have, want)
+	}
+}
+
+func testTSIGKey(t *testing.T, secret string) *tsigKey {
+	key, err := newTSIGKey("deploy-key", "hmac-sha256", base64.StdEncoding.EncodeToString([]byte(secret)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testDNSKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testDNSNodes(t *testing.T, n int) []*enode.Node {
+	nodes := make([]*enode.Node, n)
+	for i := range nodes {
+		var r enr.Record
+		r.Set(enr.IP(net.IP{10, 0, 0, byte(i)}))
+		if err := enode.SignV4(&r, testDNSKey(t)); err != nil {
+			t.Fatal(err)
+		}
+		node, err := enode.New(enode.ValidSchemes, &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = node
+	}
+	return nodes
+}
+
+func testDNSTree(t *testing.T, seq uint, nodes []*enode.Node, key *ecdsa.PrivateKey) (*dnsdisc.Tree, string) {
+	tree, err := dnsdisc.MakeTree(seq, nodes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := tree.Sign(key, "nodes.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree, url
+}
+
+func sortByID(nodes []*enode.Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return string(nodes[i].ID().Bytes()) < string(nodes[j].ID().Bytes())
+	})
+}
+
+// testDNSServer is an authoritative DNS server for a single zone. It answers TXT
+// queries and applies dynamic updates.
+type testDNSServer struct {
+	t    *testing.T
+	zone string
+	key  *tsigKey
+	udp  net.PacketConn
+	tcp  net.Listener
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+func newTestDNSServer(t *testing.T, zone string, key *tsigKey) *testDNSServer {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		t.Fatal(err)
+	}
+	s := &testDNSServer{t: t, zone: zone, key: key, udp: udp, tcp: tcp, records: make(map[string][]string)}
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return s
+}
+
+func (s *testDNSServer) addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+func (s *testDNSServer) getRecords() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records
+}
+
+func (s *testDNSServer) setRecords(records map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = records
+}
+
+func (s *testDNSServer) close() {
+	s.udp.Close()
+	s.tcp.Close()
+	s.wg.Wait()
+}
+
+func (s *testDNSServer) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.handle(buf[:n]); resp != nil {
+			s.udp.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *testDNSServer) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			for {
+				msg, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				if resp := s.handle(msg); resp != nil {
+					writeTCPMessage(conn, resp)
+				}
+			}
+		}()
+	}
+}
+
+func (s *testDNSServer) handle(msg []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	if h.OpCode == opcodeUpdate {
+		return s.handleUpdate(msg, h)
+	}
+	s.mu.Lock()
+	values := s.records[strings.ToLower(strings.TrimSuffix(q.Name.String(), "."))]
+	s.mu.Unlock()
+
+	resp := dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, RecursionDesired: h.RecursionDesired}
+	if len(values) == 0 {
+		resp.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, resp)
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	if q.Type == dnsmessage.TypeTXT {
+		for _, value := range values {
+			rh := dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 60}
+			b.TXTResource(rh, dnsmessage.TXTResource{TXT: splitTXTStrings(value)})
+		}
+	}
+	enc, _ := b.Finish()
+	return enc
+}
+
+func (s *testDNSServer) handleUpdate(msg []byte, h dnsmessage.Header) []byte {
+	var requestMAC []byte
+	if s.key != nil {
+		stripped, mac, err := s.key.verify(msg, nil, time.Now())
+		if err != nil {
+			s.t.Logf("rejecting update: %v", err)
+			return s.updateResponse(h.ID, 9, nil) // NOTAUTH
+		}
+		msg, requestMAC = stripped, mac
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Apply the update to a copy, making it atomic.
+	records := make(map[string][]string, len(s.records))
+	for name, values := range s.records {
+		records[name] = append([]string{}, values...)
+	}
+	var p dnsmessage.Parser
+	p.Start(msg)
+	zone, _ := p.Question()
+	if !strings.EqualFold(zone.Name.String(), s.zone+".") {
+		return s.updateResponse(h.ID, 10, requestMAC) // NOTZONE
+	}
+	p.SkipAllQuestions()
+	p.SkipAllAnswers()
+	for {
+		rh, err := p.AuthorityHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil || rh.Type != dnsmessage.TypeTXT {
+			return s.updateResponse(h.ID, dnsmessage.RCodeFormatError, requestMAC)
+		}
+		txt, err := p.TXTResource()
+		if err != nil {
+			return s.updateResponse(h.ID, dnsmessage.RCodeFormatError, requestMAC)
+		}
+		name := strings.ToLower(strings.TrimSuffix(rh.Name.String(), "."))
+		if !isSubdomain(name, s.zone) {
+			return s.updateResponse(h.ID, 10, requestMAC) // NOTZONE
+		}
+		value := strings.Join(txt.TXT, "")
+		switch rh.Class {
+		case dnsmessage.ClassINET:
+			if !containsString(records[name], value) {
+				records[name] = append(records[name], value)
+				sort.Strings(records[name])
+			}
+		case dnsmessage.ClassANY:
+			delete(records, name)
+		case classNONE:
+			var keep []string
+			for _, v := range records[name] {
+				if v != value {
+					keep = append(keep, v)
+				}
+			}
+			records[name] = keep
+			if len(keep) == 0 {
+				delete(records, name)
+			}
+		}
+	}
+	s.records = records
+	return s.updateResponse(h.ID, dnsmessage.RCodeSuccess, requestMAC)
+}
+
+func (s *testDNSServer) updateResponse(id uint16, rcode dnsmessage.RCode, requestMAC []byte) []byte {
+	zone, _ := dnsmessage.NewName(s.zone + ".")
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, OpCode: opcodeUpdate, RCode: rcode})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: zone, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET})
+	enc, _ := b.Finish()
+	if requestMAC != nil {
+		enc, _ = s.key.sign(enc, requestMAC, time.Now())
+	}
+	return enc
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -17,12 +17,15 @@
 package main
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/avalanria/go-avalanria/accounts/keystore"
@@ -44,6 +47,8 @@ var (
 			dnsCloudflareCommand,
 			dnsRoute53Command,
 			dnsRoute53NukeCommand,
+			dnsZoneFileCommand,
+			dnsRFC2136Command,
 		},
 	}
 	dnsSyncCommand = cli.Command{
@@ -51,7 +56,7 @@ var (
 		Usage:     "Download a DNS discovery tree",
 		ArgsUsage: "<url> [ <directory> ]",
 		Action:    dnsSync,
-		Flags:     []cli.Flag{dnsTimeoutFlag},
+		Flags:     []cli.Flag{dnsTimeoutFlag, dnsResolverFlag},
 	}
 	dnsSignCommand = cli.Command{
 		Name:      "sign",
@@ -97,6 +102,25 @@ var (
 			route53RegionFlag,
 		},
 	}
+	dnsZoneFileCommand = cli.Command{
+		Name:      "to-zonefile",
+		Usage:     "Create a BIND zone file for a discovery tree",
+		ArgsUsage: "<tree-directory> <output-file>",
+		Action:    dnsToZoneFile,
+	}
+	dnsRFC2136Command = cli.Command{
+		Name:      "to-rfc2136",
+		Usage:     "Deploy DNS TXT records to an authoritative server using dynamic updates",
+		ArgsUsage: "<tree-directory>",
+		Action:    dnsToRFC2136,
+		Flags: []cli.Flag{
+			rfc2136ServerFlag,
+			rfc2136ZoneFlag,
+			tsigKeyFlag,
+			tsigSecretFlag,
+			tsigAlgorithmFlag,
+		},
+	}
 )
 
 var (
@@ -104,6 +128,10 @@ var (
 		Name:  "timeout",
 		Usage: "Timeout for DNS lookups",
 	}
+	dnsResolverFlag = cli.StringFlag{
+		Name:  "resolver",
+		Usage: "DNS server to query instead of the system resolver (host:port)",
+	}
 	dnsDomainFlag = cli.StringFlag{
 		Name:  "domain",
 		Usage: "Domain name of the tree",
@@ -241,6 +269,36 @@ func dnsToRoute53(ctx *cli.Context) error {
 	return client.deploy(domain, t)
 }
 
+// dnsToZoneFile performs dnsZoneFileCommand.
+func dnsToZoneFile(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need tree definition directory as argument")
+	}
+	output := ctx.Args().Get(1)
+	if output == "" {
+		output = "-" // default to stdout
+	}
+	domain, t, err := loadTreeDefinitionForExport(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	writeZoneFile(output, domain, t)
+	return nil
+}
+
+// dnsToRFC2136 performs dnsRFC2136Command.
+func dnsToRFC2136(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("need tree definition directory as argument")
+	}
+	domain, t, err := loadTreeDefinitionForExport(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	client := newRFC2136Client(ctx)
+	return client.deploy(domain, t)
+}
+
 // dnsNukeRoute53 performs dnsRoute53NukeCommand.
 func dnsNukeRoute53(ctx *cli.Context) error {
 	if ctx.NArg() != 1 {
@@ -270,6 +328,9 @@ func dnsClient(ctx *cli.Context) *dnsdisc.Client {
 	if commandHasFlag(ctx, dnsTimeoutFlag) {
 		cfg.Timeout = ctx.Duration(dnsTimeoutFlag.Name)
 	}
+	if commandHasFlag(ctx, dnsResolverFlag) {
+		cfg.ResolverAddr = ctx.String(dnsResolverFlag.Name)
+	}
 	return dnsdisc.NewClient(cfg)
 }
 
@@ -414,3 +475,42 @@ func writeTXTJSON(file string, txt map[string]string) {
 		exit(err)
 	}
 }
+
+// writeZoneFile writes TXT records in BIND zone file format. The output can be
+// included into the zone containing the tree domain.
+func writeZoneFile(file, domain string, t *dnsdisc.Tree) {
+	domain = strings.ToLower(domain)
+	records := t.ToTXT(domain)
+	names := make([]string, 0, len(records))
+	for name := range records {
+		if name != domain {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var zone bytes.Buffer
+	fmt.Fprintf(&zone, "; DNS discovery tree %s at seq %d\n", domain, t.Seq())
+	fmt.Fprintf(&zone, "$ORIGIN %s.\n", domain)
+	fmt.Fprintf(&zone, "@\t%d\tIN\tTXT\t%s\n", rootTTL, zoneTXT(records[domain]))
+	for _, name := range names {
+		label := strings.ToLower(strings.TrimSuffix(name, "."+domain))
+		fmt.Fprintf(&zone, "%s\t%d\tIN\tTXT\t%s\n", label, treeNodeTTL, zoneTXT(records[name]))
+	}
+	if file == "-" {
+		os.Stdout.Write(zone.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(file, zone.Bytes(), 0644); err != nil {
+		exit(err)
+	}
+}
+
+// zoneTXT formats a TXT record value as quoted 255-byte character strings.
+func zoneTXT(value string) string {
+	var quoted []string
+	for _, s := range splitTXTStrings(value) {
+		quoted = append(quoted, `"`+s+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
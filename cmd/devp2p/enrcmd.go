@@ -174,6 +174,7 @@ var attrFormatters = map[string]func(rlp.RawValue) (string, bool){
 	"id":   formatAttrString,
 	"ip":   formatAttrIP,
 	"ip6":  formatAttrIP,
+	"quic": formatAttrUint,
 	"tcp":  formatAttrUint,
 	"tcp6": formatAttrUint,
 	"udp":  formatAttrUint,
@@ -18,6 +18,7 @@ package v5test
 
 import (
 	"bytes"
+	crand "crypto/rand"
 	"net"
 	"sync"
 	"time"
@@ -55,6 +56,8 @@ func (s *Suite) AllTests() []utesting.Test {
 		{Name: "TalkRequest", Fn: s.TestTalkRequest},
 		{Name: "FindnodeZeroDistance", Fn: s.TestFindnodeZeroDistance},
 		{Name: "FindnodeResults", Fn: s.TestFindnodeResults},
+		{Name: "TopicQueryEmpty", Fn: s.TestTopicQueryEmpty},
+		{Name: "TopicRegistration", Fn: s.TestTopicRegistration},
 	}
 }
 
@@ -232,6 +235,69 @@ func (s *Suite) TestFindnodeZeroDistance(t *utesting.T) {
 	}
 }
 
+// This test sends TOPICQUERY for a topic nobody registered and expects an empty
+// NODES response.
+func (s *Suite) TestTopicQueryEmpty(t *utesting.T) {
+	conn, l1 := s.listen1(t)
+	defer conn.close()
+
+	nodes, err := conn.topicQuery(l1, randomTopic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 0 {
+		t.Fatalf("remote returned %d nodes for unknown topic", len(nodes))
+	}
+}
+
+// This test registers the test node for a topic using REQUESTTICKET and REGTOPIC,
+// and checks that the remote node returns it for TOPICQUERY.
+func (s *Suite) TestTopicRegistration(t *utesting.T) {
+	conn, l1 := s.listen1(t)
+	defer conn.close()
+	conn.setEndpoint(l1)
+
+	topic := randomTopic()
+	var ticket *v5wire.Ticket
+	switch resp := conn.reqresp(l1, &v5wire.RequestTicket{ReqID: conn.nextReqID(), Topic: topic}).(type) {
+	case *v5wire.Ticket:
+		ticket = resp
+	default:
+		t.Fatal("expected TICKET, got", resp.Name())
+	}
+	if ticket.WaitTime > 0 {
+		t.Logf("waiting %ds for ticket", ticket.WaitTime)
+		time.Sleep(time.Duration(ticket.WaitTime) * time.Second)
+	}
+
+	regtopic := &v5wire.Regtopic{ReqID: conn.nextReqID(), Ticket: ticket.Ticket, ENR: conn.localNode.Node().Record()}
+	switch resp := conn.reqresp(l1, regtopic).(type) {
+	case *v5wire.Regconfirmation:
+		if !bytes.Equal(resp.ReqID, regtopic.ReqID) {
+			t.Fatalf("wrong request ID %x in REGCONFIRMATION, want %x", resp.ReqID, regtopic.ReqID)
+		}
+		if !resp.Registered {
+			t.Fatal("remote rejected topic registration")
+		}
+	default:
+		t.Fatal("expected REGCONFIRMATION, got", resp.Name())
+	}
+
+	nodes, err := conn.topicQuery(l1, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].ID() != conn.localNode.ID() {
+		t.Fatalf("remote returned %v for TOPICQUERY, want the registered node", nodes)
+	}
+}
+
+func randomTopic() []byte {
+	topic := make([]byte, 32)
+	crand.Read(topic)
+	return topic
+}
+
 // In this test, multiple nodes ping the node under test. After waiting for them to be
 // accepted into the remote table, the test checks that they are returned by FINDNODE.
 func (s *Suite) TestFindnodeResults(t *utesting.T) {
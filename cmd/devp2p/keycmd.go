@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"net"
 
+	"github.com/avalanria/go-avalanria/common/hexutil"
 	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/p2p"
 	"github.com/avalanria/go-avalanria/p2p/enode"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -32,6 +34,7 @@ var (
 		Subcommands: []cli.Command{
 			keyGenerateCommand,
 			keyToNodeCommand,
+			keySignAllowlistCommand,
 		},
 	}
 	keyGenerateCommand = cli.Command{
@@ -47,6 +50,12 @@ var (
 		Action:    keyToURL,
 		Flags:     []cli.Flag{hostFlag, tcpPortFlag, udpPortFlag},
 	}
+	keySignAllowlistCommand = cli.Command{
+		Name:      "sign-allowlist",
+		Usage:     "Signs a private network allowlist file with an admin key",
+		ArgsUsage: "keyfile allowlist.json",
+		Action:    signAllowlist,
+	}
 )
 
 var (
@@ -103,3 +112,30 @@ func keyToURL(ctx *cli.Context) error {
 	fmt.Println(node.URLv4())
 	return nil
 }
+
+func signAllowlist(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("need key file and allowlist file as arguments")
+	}
+	var (
+		keyfile  = ctx.Args().Get(0)
+		listfile = ctx.Args().Get(1)
+	)
+	key, err := crypto.LoadECDSA(keyfile)
+	if err != nil {
+		return err
+	}
+	list, err := p2p.LoadAllowlist(listfile)
+	if err != nil {
+		return err
+	}
+	if err := list.Sign(key); err != nil {
+		return err
+	}
+	if err := p2p.SaveAllowlist(listfile, list); err != nil {
+		return err
+	}
+	fmt.Printf("Signed allowlist seq %d with %d nodes\n", list.Seq, len(list.Nodes))
+	fmt.Println("Admin key:", hexutil.Encode(crypto.FromECDSAPub(&key.PublicKey)))
+	return nil
+}
@@ -87,10 +87,18 @@ var (
 		utils.TxPoolGlobalQueueFlag,
 		utils.TxPoolLifetimeFlag,
 		utils.SyncModeFlag,
+		utils.SyncCheckpointFlag,
 		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
 		utils.SnapshotFlag,
 		utils.TxLookupLimitFlag,
+		utils.StateSchemeFlag,
+		utils.StateHistoryFlag,
+		utils.StateDiffsFlag,
+		utils.StateDiffHistoryFlag,
+		utils.SnapServePeerBytesFlag,
+		utils.SnapServePeerRequestsFlag,
+		utils.SnapServeTotalBytesFlag,
 		utils.LightServeFlag,
 		utils.LightIngressFlag,
 		utils.LightEgressFlag,
@@ -113,6 +121,7 @@ var (
 		utils.CacheNoPrefetchFlag,
 		utils.CachePreimagesFlag,
 		utils.ListenPortFlag,
+		utils.QUICPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
 		utils.MiningEnabledFlag,
@@ -129,9 +138,14 @@ var (
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
 		utils.NetrestrictFlag,
+		utils.UploadRateFlag,
+		utils.UploadWeightsFlag,
+		utils.AllowlistFlag,
+		utils.AllowlistKeyFlag,
 		utils.NodeKeyFileFlag,
 		utils.NodeKeyHexFlag,
 		utils.DNSDiscoveryFlag,
+		utils.DNSResolverFlag,
 		utils.MainnetFlag,
 		utils.DeveloperFlag,
 		utils.DeveloperPeriodFlag,
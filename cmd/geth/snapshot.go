@@ -20,7 +20,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/avalanria/go-avalanria/cmd/utils"
@@ -169,6 +171,56 @@ as the backend data source, making this command a lot faster.
 
 The argument is interpreted as block number or hash. If none is provided, the latest
 block is used.
+`,
+			},
+			{
+				Name:      "export",
+				Usage:     "Export the state of a block into portable chunk files",
+				ArgsUsage: "<directory> [? <blockHash> | <blockNum>]",
+				Action:    utils.MigrateFlags(exportSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+gavn snapshot export <directory> [? <blockHash> | <blockNum>]
+will write the whole state of the given block into chunk files in the directory,
+using the snapshot as the data source. The accounts and storage slots are split
+into ranges, each accompanied by the Merkle proofs of its boundaries, similarly
+to the snap protocol. The latest block is used if none is specified.
+`,
+			},
+			{
+				Name:      "import",
+				Usage:     "Import the state of a block from exported chunk files",
+				ArgsUsage: "<directory> <blockHash>",
+				Action:    utils.MigrateFlags(importSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+gavn snapshot import <directory> <blockHash>
+will import the state exported by 'gavn snapshot export' into the database,
+rebuilding both the snapshot and the state trie. The exported block must match
+the given trusted hash, and every range is verified against its state root,
+making it safe to bootstrap nodes from untrusted files, even offline.
+
+The imported block becomes the head of the chain, and the node continues from
+it on its next start. The export carries the headers of the last 256 blocks,
+reaching back to the latest checkpoint of the consensus engine. Older blocks
+are missing from the chain, which is therefore never moved into the ancient
+store. The database must hold a fresh chain, initialized with the genesis but
+not synced any further, unless the given block is already the head. Importing replaces the current snapshot of the database. It's only
+supported for databases storing the state with the hash-based scheme.
 `,
 			},
 		},
@@ -214,7 +266,7 @@ func verifyState(ctx *cli.Context) error {
 		log.Error("Failed to load head block")
 		return errors.New("no head block")
 	}
-	snaptree, err := snapshot.New(chaindb, trie.NewDatabase(chaindb), 256, headBlock.Root(), false, false, false)
+	snaptree, err := snapshot.New(chaindb, trie.NewDatabaseWithConfig(chaindb, &trie.Config{Scheme: rawdb.ReadStateScheme(chaindb)}), 256, headBlock.Root(), false, false, false)
 	if err != nil {
 		log.Error("Failed to open snapshot tree", "err", err)
 		return err
@@ -271,7 +323,7 @@ func traverseState(ctx *cli.Context) error {
 		root = headBlock.Root()
 		log.Info("Start traversing the state", "root", root, "number", headBlock.NumberU64())
 	}
-	triedb := trie.NewDatabase(chaindb)
+	triedb := trie.NewDatabaseWithConfig(chaindb, &trie.Config{Scheme: rawdb.ReadStateScheme(chaindb)})
 	t, err := trie.NewSecure(root, triedb)
 	if err != nil {
 		log.Error("Failed to open trie", "root", root, "err", err)
@@ -293,7 +345,7 @@ func traverseState(ctx *cli.Context) error {
 			return err
 		}
 		if acc.Root != emptyRoot {
-			storageTrie, err := trie.NewSecure(acc.Root, triedb)
+			storageTrie, err := trie.NewSecureWithOwner(common.BytesToHash(accIter.Key), acc.Root, triedb)
 			if err != nil {
 				log.Error("Failed to open storage trie", "root", acc.Root, "err", err)
 				return err
@@ -361,7 +413,7 @@ func traverseRawState(ctx *cli.Context) error {
 		root = headBlock.Root()
 		log.Info("Start traversing the state", "root", root, "number", headBlock.NumberU64())
 	}
-	triedb := trie.NewDatabase(chaindb)
+	triedb := trie.NewDatabaseWithConfig(chaindb, &trie.Config{Scheme: rawdb.ReadStateScheme(chaindb)})
 	t, err := trie.NewSecure(root, triedb)
 	if err != nil {
 		log.Error("Failed to open trie", "root", root, "err", err)
@@ -383,7 +435,12 @@ func traverseRawState(ctx *cli.Context) error {
 		if node != (common.Hash{}) {
 			// Check the present for non-empty hash node(embedded node doesn't
 			// have their own hash).
-			blob := rawdb.ReadTrieNode(chaindb, node)
+			var blob []byte
+			if triedb.Scheme() == rawdb.PathScheme {
+				blob = rawdb.ReadAccountTrieNode(chaindb, accIter.Path())
+			} else {
+				blob = rawdb.ReadTrieNode(chaindb, node)
+			}
 			if len(blob) == 0 {
 				log.Error("Missing trie node(account)", "hash", node)
 				return errors.New("missing account")
@@ -399,7 +456,7 @@ func traverseRawState(ctx *cli.Context) error {
 				return errors.New("invalid account")
 			}
 			if acc.Root != emptyRoot {
-				storageTrie, err := trie.NewSecure(acc.Root, triedb)
+				storageTrie, err := trie.NewSecureWithOwner(common.BytesToHash(accIter.LeafKey()), acc.Root, triedb)
 				if err != nil {
 					log.Error("Failed to open storage trie", "root", acc.Root, "err", err)
 					return errors.New("missing storage trie")
@@ -412,7 +469,12 @@ func traverseRawState(ctx *cli.Context) error {
 					// Check the present for non-empty hash node(embedded node doesn't
 					// have their own hash).
 					if node != (common.Hash{}) {
-						blob := rawdb.ReadTrieNode(chaindb, node)
+						var blob []byte
+						if triedb.Scheme() == rawdb.PathScheme {
+							blob = rawdb.ReadStorageTrieNode(chaindb, common.BytesToHash(accIter.LeafKey()), storageIter.Path())
+						} else {
+							blob = rawdb.ReadTrieNode(chaindb, node)
+						}
 						if len(blob) == 0 {
 							log.Error("Missing trie node(storage)", "hash", node)
 							return errors.New("missing storage")
@@ -466,7 +528,7 @@ func dumpState(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	snaptree, err := snapshot.New(db, trie.NewDatabase(db), 256, root, false, false, false)
+	snaptree, err := snapshot.New(db, trie.NewDatabaseWithConfig(db, &trie.Config{Scheme: rawdb.ReadStateScheme(db)}), 256, root, false, false, false)
 	if err != nil {
 		return err
 	}
@@ -527,3 +589,98 @@ func dumpState(ctx *cli.Context) error {
 		"elapsed", common.PrettyDuration(time.Since(start)))
 	return nil
 }
+
+func exportSnapshot(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		return errors.New("expected export directory and optional block")
+	}
+	chaindb := utils.MakeChainDatabase(ctx, stack, true)
+	headBlock := rawdb.ReadHeadBlock(chaindb)
+	if headBlock == nil {
+		log.Error("Failed to load head block")
+		return errors.New("no head block")
+	}
+	header := headBlock.Header()
+	if ctx.NArg() == 2 {
+		arg := ctx.Args()[1]
+		if hashish(arg) {
+			hash := common.HexToHash(arg)
+			if number := rawdb.ReadHeaderNumber(chaindb, hash); number != nil {
+				header = rawdb.ReadHeader(chaindb, hash, *number)
+			} else {
+				return fmt.Errorf("block %x not found", hash)
+			}
+		} else {
+			number, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return err
+			}
+			if hash := rawdb.ReadCanonicalHash(chaindb, number); hash != (common.Hash{}) {
+				header = rawdb.ReadHeader(chaindb, hash, number)
+			} else {
+				return fmt.Errorf("header for block %d not found", number)
+			}
+		}
+	}
+	block := rawdb.ReadBlock(chaindb, header.Hash(), header.Number.Uint64())
+	if block == nil {
+		return fmt.Errorf("block %d body not found", header.Number)
+	}
+	td := rawdb.ReadTd(chaindb, header.Hash(), header.Number.Uint64())
+	if td == nil {
+		return fmt.Errorf("block %d total difficulty not found", header.Number)
+	}
+	// Include the headers back to the latest checkpoint of the consensus engine
+	var epoch uint64
+	if config := rawdb.ReadChainConfig(chaindb, rawdb.ReadCanonicalHash(chaindb, 0)); config != nil {
+		switch {
+		case config.Clique != nil:
+			epoch = config.Clique.Epoch
+		case config.IBFT != nil:
+			epoch = config.IBFT.Epoch
+		}
+	}
+	ancestors, err := snapshot.ExportAncestry(chaindb, header, epoch)
+	if err != nil {
+		return err
+	}
+	triedb := trie.NewDatabaseWithConfig(chaindb, &trie.Config{Scheme: rawdb.ReadStateScheme(chaindb)})
+	snaptree, err := snapshot.New(chaindb, triedb, 256, headBlock.Root(), false, false, false)
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "err", err)
+		return err
+	}
+	log.Info("Exporting state snapshot", "number", header.Number, "hash", header.Hash(), "root", header.Root)
+	if err := snapshot.Export(snaptree, triedb, chaindb, block, ancestors, td, ctx.Args()[0]); err != nil {
+		log.Error("Failed to export state", "err", err)
+		return err
+	}
+	return nil
+}
+
+func importSnapshot(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	if ctx.NArg() != 2 {
+		return errors.New("expected export directory and block hash")
+	}
+	hash, err := parseRoot(ctx.Args()[1])
+	if err != nil {
+		log.Error("Failed to resolve block hash", "err", err)
+		return err
+	}
+	chaindb := utils.MakeChainDatabase(ctx, stack, false)
+	defer chaindb.Close()
+
+	block, err := snapshot.Import(chaindb, ctx.Args()[0], hash)
+	if err != nil {
+		log.Error("Failed to import state", "err", err)
+		return err
+	}
+	log.Info("Imported state, set new chain head", "number", block.Number(), "hash", hash, "root", block.Root())
+	return nil
+}
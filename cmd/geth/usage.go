@@ -47,9 +47,17 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.CalaverasFlag,
 			utils.RopstenFlag,
 			utils.SyncModeFlag,
+			utils.SyncCheckpointFlag,
 			utils.ExitWhenSyncedFlag,
 			utils.GCModeFlag,
 			utils.TxLookupLimitFlag,
+			utils.StateSchemeFlag,
+			utils.StateHistoryFlag,
+			utils.StateDiffsFlag,
+			utils.StateDiffHistoryFlag,
+			utils.SnapServePeerBytesFlag,
+			utils.SnapServePeerRequestsFlag,
+			utils.SnapServeTotalBytesFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
@@ -163,13 +171,19 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 		Flags: []cli.Flag{
 			utils.BootnodesFlag,
 			utils.DNSDiscoveryFlag,
+			utils.DNSResolverFlag,
 			utils.ListenPortFlag,
+			utils.QUICPortFlag,
 			utils.MaxPeersFlag,
 			utils.MaxPendingPeersFlag,
 			utils.NATFlag,
 			utils.NoDiscoverFlag,
 			utils.DiscoveryV5Flag,
 			utils.NetrestrictFlag,
+			utils.UploadRateFlag,
+			utils.UploadWeightsFlag,
+			utils.AllowlistFlag,
+			utils.AllowlistKeyFlag,
 			utils.NodeKeyFileFlag,
 			utils.NodeKeyHexFlag,
 		},
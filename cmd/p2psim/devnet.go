@@ -0,0 +1,499 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of go-avalanria.
+//
+// go-avalanria is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-avalanria is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-avalanria. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/avalanria/go-avalanria/accounts/keystore"
+	"github.com/avalanria/go-avalanria/avn"
+	"github.com/avalanria/go-avalanria/avn/avnconfig"
+	"github.com/avalanria/go-avalanria/avn/downloader"
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/consensus/avnash"
+	"github.com/avalanria/go-avalanria/core"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/node"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/simulations"
+	"github.com/avalanria/go-avalanria/p2p/simulations/adapters"
+	"github.com/avalanria/go-avalanria/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	devnetService     = "avn"      // name of the full node service
+	devnetMinerProp   = "miner"    // node property: node seals blocks
+	devnetGenesisProp = "genesis=" // node property: path of the genesis file
+
+	devnetDefaultGasLimit = 11500000
+	devnetCliqueEpoch     = 30000
+)
+
+// devnetServices are the node services of devnets. They are registered with the exec
+// adapter on startup, so they must be available in every invocation of p2psim.
+var devnetServices = adapters.LifecycleConstructors{
+	devnetService: newDevnetNode,
+}
+
+var devnetCommand = cli.Command{
+	Name:      "devnet",
+	Usage:     "run a local network of full nodes",
+	ArgsUsage: "<topology.json>",
+	Action:    runDevnet,
+	Description: `
+Devnet starts the nodes described by a topology file and serves the simulation
+HTTP API for them. All nodes share a generated genesis block. Clique signers and
+ethash miners are taken from the nodes marked as miners. An example topology is:
+
+    {
+        "adapter": "sim",
+        "genesis": {
+            "consensus": "clique",
+            "chainId": 1337,
+            "period": 2,
+            "alloc": {"0x71562b71999873DB5b286dF957af199Ec94617F7": {"balance": "0xffffffffffffffffffff"}}
+        },
+        "nodes": [
+            {"name": "signer1", "miner": true, "peers": ["signer2"]},
+            {"name": "signer2", "miner": true},
+            {"name": "node3", "peers": ["signer1", "signer2"]}
+        ]
+    }
+
+The "sim" adapter runs all nodes in memory, the "exec" adapter runs every node as a
+child process with its data directory below --datadir. The RPC API of each node is
+available through the simulation API at ws://<http-addr>/nodes/<name>/rpc.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "http",
+			Value: "127.0.0.1:8888",
+			Usage: "listening address of the simulation API",
+		},
+		cli.StringFlag{
+			Name:  "datadir",
+			Usage: "data directory of the network (default: temporary directory)",
+		},
+		cli.IntFlag{
+			Name:  "verbosity",
+			Value: int(log.LvlError),
+			Usage: "log level of the nodes (0-5)",
+		},
+	},
+}
+
+// devnetTopology is the content of a devnet topology file.
+type devnetTopology struct {
+	Adapter string        `json:"adapter"`
+	Genesis devnetGenesis `json:"genesis"`
+	Nodes   []devnetNode  `json:"nodes"`
+}
+
+// devnetGenesis describes the genesis block of a devnet.
+type devnetGenesis struct {
+	Consensus string            `json:"consensus"`
+	ChainID   uint64            `json:"chainId"`
+	Period    uint64            `json:"period"` // clique block period in seconds
+	GasLimit  uint64            `json:"gasLimit"`
+	Alloc     core.GenesisAlloc `json:"alloc"`
+}
+
+// devnetNode describes a single node of a devnet.
+type devnetNode struct {
+	Name  string   `json:"name"`
+	Key   string   `json:"key"`   // hex encoded node key, random if empty
+	Miner bool     `json:"miner"` // whether the node seals blocks
+	Peers []string `json:"peers"` // static peers
+}
+
+// loadTopology reads a topology file and fills in defaults.
+func loadTopology(file string) (*devnetTopology, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var topo devnetTopology
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&topo); err != nil {
+		return nil, fmt.Errorf("invalid topology file %s: %v", file, err)
+	}
+	if err := topo.init(); err != nil {
+		return nil, fmt.Errorf("invalid topology file %s: %v", file, err)
+	}
+	return &topo, nil
+}
+
+// init validates the topology and sets defaults.
+func (t *devnetTopology) init() error {
+	switch t.Adapter {
+	case "":
+		t.Adapter = "sim"
+	case "sim", "exec":
+	default:
+		return fmt.Errorf("unknown adapter %q", t.Adapter)
+	}
+	switch t.Genesis.Consensus {
+	case "":
+		t.Genesis.Consensus = "clique"
+	case "clique", "ethash":
+	default:
+		return fmt.Errorf("unknown consensus engine %q", t.Genesis.Consensus)
+	}
+	if t.Genesis.ChainID == 0 {
+		t.Genesis.ChainID = params.AllCliqueProtocolChanges.ChainID.Uint64()
+	}
+	if t.Genesis.GasLimit == 0 {
+		t.Genesis.GasLimit = devnetDefaultGasLimit
+	}
+	if len(t.Nodes) == 0 {
+		return errors.New("no nodes")
+	}
+
+	names := make(map[string]bool, len(t.Nodes))
+	miners := 0
+	for _, n := range t.Nodes {
+		if n.Name == "" {
+			return errors.New("node without name")
+		}
+		if names[n.Name] {
+			return fmt.Errorf("duplicate node name %q", n.Name)
+		}
+		names[n.Name] = true
+		if n.Miner {
+			miners++
+		}
+		if n.Key != "" {
+			if _, err := crypto.HexToECDSA(n.Key); err != nil {
+				return fmt.Errorf("invalid key of node %q: %v", n.Name, err)
+			}
+		}
+	}
+	if miners == 0 {
+		return errors.New("no miners")
+	}
+	for _, n := range t.Nodes {
+		for _, peer := range n.Peers {
+			if !names[peer] {
+				return fmt.Errorf("unknown peer %q of node %q", peer, n.Name)
+			}
+			if peer == n.Name {
+				return fmt.Errorf("node %q is its own peer", n.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// nodeConfigs creates the simulation configs of all nodes.
+func (t *devnetTopology) nodeConfigs(genesisFile string) ([]*adapters.NodeConfig, error) {
+	configs := make([]*adapters.NodeConfig, len(t.Nodes))
+	for i, n := range t.Nodes {
+		config := adapters.RandomNodeConfig()
+		if n.Key != "" {
+			key, err := crypto.HexToECDSA(n.Key)
+			if err != nil {
+				return nil, err
+			}
+			config.ID = enode.PubkeyToIDV4(&key.PublicKey)
+			config.PrivateKey = key
+		}
+		config.Name = n.Name
+		config.EnableMsgEvents = false
+		config.Lifecycles = []string{devnetService}
+		config.Properties = []string{devnetGenesisProp + genesisFile}
+		if n.Miner {
+			config.Properties = append(config.Properties, devnetMinerProp)
+		}
+		configs[i] = config
+	}
+	return configs, nil
+}
+
+// makeGenesis creates the genesis block of the network. The miners are the signers
+// of clique networks.
+func (t *devnetTopology) makeGenesis(miners []common.Address) *core.Genesis {
+	genesis := &core.Genesis{
+		Timestamp: uint64(time.Now().Unix()),
+		GasLimit:  t.Genesis.GasLimit,
+		Alloc:     make(core.GenesisAlloc, len(t.Genesis.Alloc)),
+	}
+	for addr, account := range t.Genesis.Alloc {
+		genesis.Alloc[addr] = account
+	}
+
+	var config params.ChainConfig
+	switch t.Genesis.Consensus {
+	case "clique":
+		config = *params.AllCliqueProtocolChanges
+		config.Clique = &params.CliqueConfig{Period: t.Genesis.Period, Epoch: devnetCliqueEpoch}
+		genesis.Difficulty = big.NewInt(1)
+
+		// Embed the sorted signers into the extra-data section.
+		signers := make([]common.Address, len(miners))
+		copy(signers, miners)
+		sort.Slice(signers, func(i, j int) bool {
+			return bytes.Compare(signers[i][:], signers[j][:]) < 0
+		})
+		genesis.ExtraData = make([]byte, 32+len(signers)*common.AddressLength+crypto.SignatureLength)
+		for i, signer := range signers {
+			copy(genesis.ExtraData[32+i*common.AddressLength:], signer[:])
+		}
+	case "ethash":
+		config = *params.AllEthashProtocolChanges
+		genesis.Difficulty = new(big.Int).Set(params.MinimumDifficulty)
+	}
+	config.ChainID = new(big.Int).SetUint64(t.Genesis.ChainID)
+	genesis.Config = &config
+	return genesis
+}
+
+// devnet is a running network of full nodes.
+type devnet struct {
+	topo    *devnetTopology
+	network *simulations.Network
+	nodes   []*simulations.Node
+}
+
+// newDevnet writes the genesis block into the data directory and creates the nodes
+// of the network. The nodes are not started yet.
+func newDevnet(topo *devnetTopology, datadir string, verbosity log.Lvl) (*devnet, error) {
+	configs, err := topo.nodeConfigs(filepath.Join(datadir, "genesis.json"))
+	if err != nil {
+		return nil, err
+	}
+	var miners []common.Address
+	for i, n := range topo.Nodes {
+		if n.Miner {
+			miners = append(miners, crypto.PubkeyToAddress(configs[i].PrivateKey.PublicKey))
+		}
+	}
+	genesis, err := json.MarshalIndent(topo.makeGenesis(miners), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(datadir, "genesis.json"), genesis, 0644); err != nil {
+		return nil, err
+	}
+
+	var adapter adapters.NodeAdapter
+	switch topo.Adapter {
+	case "sim":
+		adapter = adapters.NewSimAdapter(devnetServices)
+	case "exec":
+		adapter = adapters.NewExecAdapter(datadir)
+	}
+	d := &devnet{
+		topo:    topo,
+		network: simulations.NewNetwork(adapter, &simulations.NetworkConfig{ID: "devnet", DefaultService: devnetService}),
+	}
+	for _, config := range configs {
+		config.LogVerbosity = verbosity
+		if topo.Adapter == "exec" {
+			config.LogFile = filepath.Join(datadir, config.Name+".log")
+		}
+		n, err := d.network.NewNodeWithConfig(config)
+		if err != nil {
+			d.close()
+			return nil, err
+		}
+		d.nodes = append(d.nodes, n)
+	}
+	return d, nil
+}
+
+// start starts all nodes, connects them to their static peers and
+// starts the miners.
+func (d *devnet) start() error {
+	for _, n := range d.nodes {
+		if err := d.network.Start(n.ID()); err != nil {
+			return fmt.Errorf("can't start node %s: %v", n.Config.Name, err)
+		}
+	}
+	// Static peers are added through the admin API directly, because Network.Connect
+	// refuses to dial back right after a node was dialed by its peer. Each pair of
+	// nodes is dialed once, simultaneous dials from both ends would drop each other.
+	dialed := make(map[[2]string]bool)
+	for i, n := range d.topo.Nodes {
+		client, err := d.nodes[i].Client()
+		if err != nil {
+			return err
+		}
+		for _, peer := range n.Peers {
+			pair := [2]string{n.Name, peer}
+			if peer < n.Name {
+				pair = [2]string{peer, n.Name}
+			}
+			if dialed[pair] {
+				continue
+			}
+			dialed[pair] = true
+			addr := string(d.network.GetNodeByName(peer).Addr())
+			if err := client.Call(nil, "admin_addPeer", addr); err != nil {
+				return fmt.Errorf("can't connect %s to %s: %v", n.Name, peer, err)
+			}
+		}
+	}
+	for i, n := range d.topo.Nodes {
+		if !n.Miner {
+			continue
+		}
+		client, err := d.nodes[i].Client()
+		if err != nil {
+			return err
+		}
+		if err := client.Call(nil, "miner_start", 1); err != nil {
+			return fmt.Errorf("can't start miner %s: %v", n.Name, err)
+		}
+	}
+	return nil
+}
+
+// close stops all nodes.
+func (d *devnet) close() {
+	d.network.Shutdown()
+}
+
+func runDevnet(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	topo, err := loadTopology(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	verbosity := log.Lvl(ctx.Int("verbosity"))
+	log.Root().SetHandler(log.LvlFilterHandler(verbosity, log.StreamHandler(os.Stderr, log.TerminalFormat(true))))
+
+	datadir := ctx.String("datadir")
+	if datadir == "" {
+		if datadir, err = ioutil.TempDir("", "p2psim-devnet-"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(datadir)
+	} else if err := os.MkdirAll(datadir, 0755); err != nil {
+		return err
+	}
+
+	d, err := newDevnet(topo, datadir, verbosity)
+	if err != nil {
+		return err
+	}
+	defer d.close()
+	if err := d.start(); err != nil {
+		return err
+	}
+
+	// Serve the simulation API.
+	listener, err := net.Listen("tcp", ctx.String("http"))
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: simulations.NewServer(d.network)}
+	go server.Serve(listener)
+	defer server.Close()
+
+	w := tabwriter.NewWriter(ctx.App.Writer, 1, 2, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tMINER\tADDRESS\tRPC\n")
+	for i, n := range d.nodes {
+		addr := crypto.PubkeyToAddress(n.Config.PrivateKey.PublicKey)
+		fmt.Fprintf(w, "%s\t%t\t%s\tws://%s/nodes/%s/rpc\n", n.Config.Name, topo.Nodes[i].Miner, addr.Hex(), listener.Addr(), n.Config.Name)
+	}
+	w.Flush()
+	fmt.Fprintf(ctx.App.Writer, "\nGenesis: %s\nSimulation API: http://%s\n", filepath.Join(datadir, "genesis.json"), listener.Addr())
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+	<-sigc
+	fmt.Fprintln(ctx.App.Writer, "Shutting down...")
+	return nil
+}
+
+// newDevnetNode creates a full node using the genesis block given in the node
+// properties.
+func newDevnetNode(ctx *adapters.ServiceContext, stack *node.Node) (node.Lifecycle, error) {
+	var (
+		genesisFile string
+		miner       bool
+	)
+	for _, prop := range ctx.Config.Properties {
+		switch {
+		case prop == devnetMinerProp:
+			miner = true
+		case strings.HasPrefix(prop, devnetGenesisProp):
+			genesisFile = strings.TrimPrefix(prop, devnetGenesisProp)
+		}
+	}
+	if genesisFile == "" {
+		return nil, errors.New("missing genesis file")
+	}
+	data, err := ioutil.ReadFile(genesisFile)
+	if err != nil {
+		return nil, err
+	}
+	genesis := new(core.Genesis)
+	if err := json.Unmarshal(data, genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis file: %v", err)
+	}
+
+	key := ctx.Config.PrivateKey
+	config := avnconfig.Defaults
+	config.Genesis = genesis
+	config.NetworkId = genesis.Config.ChainID.Uint64()
+	config.SyncMode = downloader.FullSync
+	config.Ethash = avnash.Config{PowMode: avnash.ModeTest}
+	config.Miner.Etherbase = crypto.PubkeyToAddress(key.PublicKey)
+	config.Miner.GasCeil = genesis.GasLimit
+	if miner && genesis.Config.Clique != nil {
+		if err := importSigner(stack, key); err != nil {
+			return nil, err
+		}
+	}
+	return avn.New(stack, &config)
+}
+
+// importSigner adds the clique signer key to the keystore of the node.
+func importSigner(stack *node.Node, key *ecdsa.PrivateKey) error {
+	backends := stack.AccountManager().Backends(keystore.KeyStoreType)
+	if len(backends) == 0 {
+		return errors.New("node has no keystore")
+	}
+	ks := backends[0].(*keystore.KeyStore)
+	account, err := ks.ImportECDSA(key, "")
+	if err != nil {
+		return err
+	}
+	return ks.Unlock(account, "")
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of go-avalanria.
+//
+// go-avalanria is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-avalanria is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-avalanria. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/common/hexutil"
+	"github.com/avalanria/go-avalanria/log"
+)
+
+func TestLoadTopology(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{
+			input: `{"nodes": [{"name": "a", "miner": true, "peers": ["b"]}, {"name": "b"}]}`,
+		},
+		{
+			input: `{"nodes": []}`,
+			err:   "no nodes",
+		},
+		{
+			input: `{"nodes": [{"name": "a"}]}`,
+			err:   "no miners",
+		},
+		{
+			input: `{"nodes": [{"name": "a", "miner": true}, {"name": "a"}]}`,
+			err:   `duplicate node name "a"`,
+		},
+		{
+			input: `{"nodes": [{"name": "a", "miner": true, "peers": ["b"]}]}`,
+			err:   `unknown peer "b" of node "a"`,
+		},
+		{
+			input: `{"nodes": [{"name": "a", "miner": true, "peers": ["a"]}]}`,
+			err:   `node "a" is its own peer`,
+		},
+		{
+			input: `{"adapter": "docker", "nodes": [{"name": "a", "miner": true}]}`,
+			err:   `unknown adapter "docker"`,
+		},
+		{
+			input: `{"genesis": {"consensus": "ibft"}, "nodes": [{"name": "a", "miner": true}]}`,
+			err:   `unknown consensus engine "ibft"`,
+		},
+		{
+			input: `{"nodes": [{"name": "a", "miner": true, "stake": 1}]}`,
+			err:   `unknown field "stake"`,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "p2psim-topology-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "topology.json")
+
+	for i, test := range tests {
+		if err := ioutil.WriteFile(file, []byte(test.input), 0644); err != nil {
+			t.Fatal(err)
+		}
+		topo, err := loadTopology(file)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("test %d: wrong error %v, want %q", i, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if topo.Adapter != "sim" || topo.Genesis.Consensus != "clique" || topo.Genesis.GasLimit != devnetDefaultGasLimit {
+			t.Errorf("test %d: defaults not applied: %+v", i, topo)
+		}
+	}
+}
+
+func TestDevnetGenesis(t *testing.T) {
+	var (
+		signer1 = common.HexToAddress("0x2000000000000000000000000000000000000000")
+		signer2 = common.HexToAddress("0x1000000000000000000000000000000000000000")
+	)
+	topo := &devnetTopology{Nodes: []devnetNode{{Name: "a", Miner: true}}}
+	topo.Genesis.ChainID = 99
+	if err := topo.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	genesis := topo.makeGenesis([]common.Address{signer1, signer2})
+	if genesis.Config.Clique == nil || genesis.Config.ChainID.Uint64() != 99 {
+		t.Fatalf("wrong clique chain config: %v", genesis.Config)
+	}
+	want := "0x" + strings.Repeat("00", 32) + signer2.Hex()[2:] + signer1.Hex()[2:] + strings.Repeat("00", 65)
+	if extra := hexutil.Encode(genesis.ExtraData); extra != strings.ToLower(want) {
+		t.Errorf("wrong extra-data %s", extra)
+	}
+
+	topo.Genesis.Consensus = "ethash"
+	genesis = topo.makeGenesis([]common.Address{signer1})
+	if genesis.Config.Ethash == nil || genesis.Config.Clique != nil || len(genesis.ExtraData) != 0 {
+		t.Fatalf("wrong ethash genesis: %v", genesis.Config)
+	}
+}
+
+func TestDevnet(t *testing.T) {
+	topo := &devnetTopology{
+		Genesis: devnetGenesis{Period: 1},
+		Nodes: []devnetNode{
+			{Name: "signer1", Miner: true, Peers: []string{"signer2"}},
+			{Name: "signer2", Miner: true, Peers: []string{"signer1"}},
+			{Name: "node3", Peers: []string{"signer1"}},
+		},
+	}
+	if err := topo.init(); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "p2psim-devnet-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := newDevnet(topo, dir, log.LvlError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.close()
+	if err := d.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// All nodes should follow the chain built by the signers.
+	for _, n := range d.nodes {
+		client, err := n.Client()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var number hexutil.Big
+		for deadline := time.Now().Add(30 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+			if err := client.Call(&number, "avn_blockNumber"); err != nil {
+				t.Fatal(err)
+			}
+			if number.ToInt().Cmp(big.NewInt(2)) >= 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("node %s stuck at block %v", n.Config.Name, number.ToInt())
+			}
+		}
+	}
+}
@@ -34,6 +34,11 @@
 //     $ p2psim node connect node01 node02
 //     Connected node01 to node02
 //
+// The devnet command runs a network of full nodes described by a topology file
+// and serves the simulation API for it:
+//
+//     $ p2psim devnet topology.json
+//
 package main
 
 import (
@@ -57,6 +62,10 @@ import (
 var client *simulations.Client
 
 func main() {
+	// Register the devnet services. This also runs the node service
+	// if the binary was executed by the exec adapter.
+	adapters.RegisterLifecycles(devnetServices)
+
 	app := cli.NewApp()
 	app.Usage = "devp2p simulation command-line client"
 	app.Flags = []cli.Flag{
@@ -72,6 +81,7 @@ func main() {
 		return nil
 	}
 	app.Commands = []cli.Command{
+		devnetCommand,
 		{
 			Name:   "show",
 			Usage:  "show network information",
@@ -390,11 +400,11 @@ func rpcNode(ctx *cli.Context) error {
 		return err
 	}
 	if ctx.Bool("subscribe") {
-		return rpcSubscribe(rpcClient, ctx.App.Writer, mavnod, args[3:]...)
+		return rpcSubscribe(rpcClient, ctx.App.Writer, mavnod, args[2:]...)
 	}
 	var result interface{}
-	params := make([]interface{}, len(args[3:]))
-	for i, v := range args[3:] {
+	params := make([]interface{}, len(args[2:]))
+	for i, v := range args[2:] {
 		params[i] = v
 	}
 	if err := rpcClient.Call(&result, mavnod, params...); err != nil {
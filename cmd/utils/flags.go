@@ -39,6 +39,7 @@ import (
 	"github.com/avalanria/go-avalanria/common/fdlimit"
 	"github.com/avalanria/go-avalanria/consensus"
 	"github.com/avalanria/go-avalanria/consensus/clique"
+	"github.com/avalanria/go-avalanria/consensus/ibft"
 	"github.com/avalanria/go-avalanria/consensus/avnash"
 	"github.com/avalanria/go-avalanria/core"
 	"github.com/avalanria/go-avalanria/core/rawdb"
@@ -216,6 +217,10 @@ var (
 		Usage: `Blockchain sync mode ("fast", "full", "snap" or "light")`,
 		Value: &defaultSyncMode,
 	}
+	SyncCheckpointFlag = cli.StringFlag{
+		Name:  "sync.checkpoint",
+		Usage: "Trusted block hash to sync the state at, backfilling the chain behind it",
+	}
 	GCModeFlag = cli.StringFlag{
 		Name:  "gcmode",
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
@@ -230,6 +235,34 @@ var (
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
 		Value: avnconfig.Defaults.TxLookupLimit,
 	}
+	StateSchemeFlag = cli.StringFlag{
+		Name:  "state.scheme",
+		Usage: `Scheme to store the trie nodes of the state with ("hash" or "path", default = the one recorded in the database)`,
+	}
+	StateHistoryFlag = cli.Uint64Flag{
+		Name:  "state.history",
+		Usage: "Number of recent states to keep recoverable with the path-based scheme (default = 90000)",
+	}
+	StateDiffsFlag = cli.BoolFlag{
+		Name:  "state.diffs",
+		Usage: "Record the reverse state diffs of blocks to serve historical state without an archive node",
+	}
+	StateDiffHistoryFlag = cli.Uint64Flag{
+		Name:  "state.diffhistory",
+		Usage: "Number of recent blocks to retain state diffs for (default = 0, entire chain)",
+	}
+	SnapServePeerBytesFlag = cli.Uint64Flag{
+		Name:  "snap.serve.peerbytes",
+		Usage: "Maximum bytes per second served to a single snap syncing peer (default = 0, unlimited)",
+	}
+	SnapServePeerRequestsFlag = cli.Uint64Flag{
+		Name:  "snap.serve.peerrequests",
+		Usage: "Maximum requests per second served to a single snap syncing peer (default = 0, unlimited)",
+	}
+	SnapServeTotalBytesFlag = cli.Uint64Flag{
+		Name:  "snap.serve.totalbytes",
+		Usage: "Maximum bytes per second served to all snap syncing peers, except the ones we sync from (default = 0, unlimited)",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -634,6 +667,10 @@ var (
 		Usage: "Network listening port",
 		Value: 30303,
 	}
+	QUICPortFlag = cli.IntFlag{
+		Name:  "quicport",
+		Usage: "Network listening UDP port of the QUIC transport (disabled if unset)",
+	}
 	BootnodesFlag = cli.StringFlag{
 		Name:  "bootnodes",
 		Usage: "Comma separated enode URLs for P2P discovery bootstrap",
@@ -664,10 +701,30 @@ var (
 		Name:  "netrestrict",
 		Usage: "Restricts network communication to the given IP networks (CIDR masks)",
 	}
+	UploadRateFlag = cli.Uint64Flag{
+		Name:  "upload.rate",
+		Usage: "Maximum upload bandwidth for protocol messages in bytes per second (0 = unlimited)",
+	}
+	UploadWeightsFlag = cli.StringFlag{
+		Name:  "upload.weights",
+		Usage: "Comma separated protocol=weight shares of the limited upload bandwidth (e.g. avn=4,snap=1)",
+	}
+	AllowlistFlag = cli.StringFlag{
+		Name:  "allowlist",
+		Usage: "JSON file listing the only node IDs permitted to connect (private networks)",
+	}
+	AllowlistKeyFlag = cli.StringFlag{
+		Name:  "allowlist.key",
+		Usage: "Hex encoded admin public key the allowlist must be signed with",
+	}
 	DNSDiscoveryFlag = cli.StringFlag{
 		Name:  "discovery.dns",
 		Usage: "Sets DNS discovery entry points (use \"\" to disable DNS)",
 	}
+	DNSResolverFlag = cli.StringFlag{
+		Name:  "discovery.dns.resolver",
+		Usage: "DNS server (host:port) queried for DNS discovery trees instead of the system resolver",
+	}
 
 	// ATM the url is left to the user and deployment to
 	JSpathFlag = DirectoryFlag{
@@ -882,6 +939,9 @@ func setListenAddress(ctx *cli.Context, cfg *p2p.Config) {
 	if ctx.GlobalIsSet(ListenPortFlag.Name) {
 		cfg.ListenAddr = fmt.Sprintf(":%d", ctx.GlobalInt(ListenPortFlag.Name))
 	}
+	if ctx.GlobalIsSet(QUICPortFlag.Name) {
+		cfg.QUICListenAddr = fmt.Sprintf(":%d", ctx.GlobalInt(QUICPortFlag.Name))
+	}
 }
 
 // setNAT creates a port mapper from command line flags.
@@ -895,6 +955,23 @@ func setNAT(ctx *cli.Context, cfg *p2p.Config) {
 	}
 }
 
+// parseUploadWeights parses a comma separated list of protocol=weight pairs.
+func parseUploadWeights(input string) (map[string]uint, error) {
+	weights := make(map[string]uint)
+	for _, entry := range SplitAndTrim(input) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid weight %q, want protocol=weight", entry)
+		}
+		weight, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32)
+		if err != nil || weight == 0 {
+			return nil, fmt.Errorf("invalid weight %q for protocol %s", parts[1], parts[0])
+		}
+		weights[strings.TrimSpace(parts[0])] = uint(weight)
+	}
+	return weights, nil
+}
+
 // SplitAndTrim splits input separated by a comma
 // and trims excessive white space from the substrings.
 func SplitAndTrim(input string) (ret []string) {
@@ -1190,6 +1267,26 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		}
 		cfg.NetRestrict = list
 	}
+	if ctx.GlobalIsSet(UploadRateFlag.Name) {
+		cfg.MaxUploadRate = ctx.GlobalUint64(UploadRateFlag.Name)
+	}
+	if ctx.GlobalIsSet(UploadWeightsFlag.Name) {
+		weights, err := parseUploadWeights(ctx.GlobalString(UploadWeightsFlag.Name))
+		if err != nil {
+			Fatalf("Option %q: %v", UploadWeightsFlag.Name, err)
+		}
+		cfg.UploadWeights = weights
+	}
+	if ctx.GlobalIsSet(AllowlistFlag.Name) {
+		cfg.AllowlistFile = ctx.GlobalString(AllowlistFlag.Name)
+	}
+	if ctx.GlobalIsSet(AllowlistKeyFlag.Name) {
+		key, err := crypto.UnmarshalPubkey(common.FromHex(ctx.GlobalString(AllowlistKeyFlag.Name)))
+		if err != nil {
+			Fatalf("Option %q: %v", AllowlistKeyFlag.Name, err)
+		}
+		cfg.AllowlistKey = key
+	}
 
 	if ctx.GlobalBool(DeveloperFlag.Name) || ctx.GlobalBool(CatalystFlag.Name) {
 		// --dev mode can't use p2p networking.
@@ -1510,6 +1607,12 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *avnconfig.Config) {
 	if ctx.GlobalIsSet(SyncModeFlag.Name) {
 		cfg.SyncMode = *GlobalTextMarshaler(ctx, SyncModeFlag.Name).(*downloader.SyncMode)
 	}
+	if ctx.GlobalIsSet(SyncCheckpointFlag.Name) {
+		checkpoint := ctx.GlobalString(SyncCheckpointFlag.Name)
+		if err := cfg.SyncCheckpoint.UnmarshalText([]byte(checkpoint)); err != nil {
+			Fatalf("Invalid sync checkpoint %s: %v", checkpoint, err)
+		}
+	}
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
@@ -1539,6 +1642,27 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *avnconfig.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(StateSchemeFlag.Name) {
+		cfg.StateScheme = ctx.GlobalString(StateSchemeFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateHistoryFlag.Name) {
+		cfg.StateHistory = ctx.GlobalUint64(StateHistoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateDiffsFlag.Name) {
+		cfg.StateDiffs = ctx.GlobalBool(StateDiffsFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateDiffHistoryFlag.Name) {
+		cfg.StateDiffHistory = ctx.GlobalUint64(StateDiffHistoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(SnapServePeerBytesFlag.Name) {
+		cfg.SnapServePeerBytes = ctx.GlobalUint64(SnapServePeerBytesFlag.Name)
+	}
+	if ctx.GlobalIsSet(SnapServePeerRequestsFlag.Name) {
+		cfg.SnapServePeerRequests = ctx.GlobalUint64(SnapServePeerRequestsFlag.Name)
+	}
+	if ctx.GlobalIsSet(SnapServeTotalBytesFlag.Name) {
+		cfg.SnapServeTotalBytes = ctx.GlobalUint64(SnapServeTotalBytesFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1592,6 +1716,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *avnconfig.Config) {
 			cfg.EthDiscoveryURLs = SplitAndTrim(urls)
 		}
 	}
+	if ctx.GlobalIsSet(DNSResolverFlag.Name) {
+		cfg.DiscoveryDNSResolver = ctx.GlobalString(DNSResolverFlag.Name)
+	}
 	// Override any default configs for hard coded networks.
 	switch {
 	case ctx.GlobalBool(MainnetFlag.Name):
@@ -1831,6 +1958,8 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	var engine consensus.Engine
 	if config.Clique != nil {
 		engine = clique.New(config.Clique, chainDb)
+	} else if config.IBFT != nil {
+		engine = ibft.New(config.IBFT, chainDb)
 	} else {
 		engine = avnash.NewFaker()
 		if !ctx.GlobalBool(FakePoWFlag.Name) {
@@ -107,11 +107,15 @@ func (api *API) Proposals() map[common.Address]bool {
 
 // Propose injects a new authorization proposal that the signer will attempt to
 // push through.
-func (api *API) Propose(address common.Address, auth bool) {
+func (api *API) Propose(address common.Address, auth bool) error {
+	if api.clique.config.SignerContract != nil {
+		return errVotingDisabled
+	}
 	api.clique.lock.Lock()
 	defer api.clique.lock.Unlock()
 
 	api.clique.proposals[address] = auth
+	return nil
 }
 
 // Discard drops a currently running proposal, stopping the signer from casting
@@ -179,6 +183,20 @@ func (api *API) Status() (*status, error) {
 	}, nil
 }
 
+// Liveness returns the signing activity of each signer within the given number
+// of recent blocks (64 by default): the blocks signed in-turn and out-of-turn,
+// the turns missed and the last block signed.
+func (api *API) Liveness(blocks *uint64) (*Liveness, error) {
+	window := uint64(defaultLivenessWindow)
+	if blocks != nil {
+		window = *blocks
+	}
+	if window > maxLivenessWindow {
+		return nil, fmt.Errorf("window too large: %d > %d", window, maxLivenessWindow)
+	}
+	return api.clique.liveness(api.chain, api.chain.CurrentHeader(), window)
+}
+
 type blockNumberOrHashOrRLP struct {
 	*rpc.BlockNumberOrHash
 	RLP hexutil.Bytes `json:"rlp,omitempty"`
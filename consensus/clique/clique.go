@@ -182,6 +182,9 @@ type Clique struct {
 	signFn SignerFn       // Signer function to authorize hashes with
 	lock   sync.RWMutex   // Protects the signer fields
 
+	livenessSigners map[common.Address]struct{} // Signers with liveness metrics registered
+	livenessLock    sync.Mutex                  // Protects the liveness metrics set
+
 	// The fields below are for testing only
 	fakeDiff bool // Skip difficulty verifications
 }
@@ -265,6 +268,10 @@ func (c *Clique) verifyHeader(chain consensus.ChainHeaderReader, header *types.H
 	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
 		return errInvalidCheckpointVote
 	}
+	// If signers are managed by the governance contract, header votes are forbidden
+	if c.config.SignerContract != nil && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errVotingDisabled
+	}
 	// Check that the extra-data contains both the vanity and signature
 	if len(header.Extra) < extraVanity {
 		return errMissingVanity
@@ -280,6 +287,9 @@ func (c *Clique) verifyHeader(chain consensus.ChainHeaderReader, header *types.H
 	if checkpoint && signersBytes%common.AddressLength != 0 {
 		return errInvalidCheckpointSigners
 	}
+	if checkpoint && signersBytes == 0 && c.config.SignerContract != nil {
+		return errInvalidCheckpointSigners
+	}
 	// Ensure that the mix digest is zero as we don't have fork protection currently
 	if header.MixDigest != (common.Hash{}) {
 		return errInvalidMixDigest
@@ -334,7 +344,7 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 	if header.GasUsed > header.GasLimit {
 		return fmt.Errorf("invalid gasUsed: have %d, gasLimit %d", header.GasUsed, header.GasLimit)
 	}
-	if !chain.Config().IsLondon(header.Number) {
+	if !chain.Config().IsLondon(header.Number, header.Time) {
 		// Verify BaseFee not present before EIP-1559 fork.
 		if header.BaseFee != nil {
 			return fmt.Errorf("invalid baseFee before fork: have %d, want <nil>", header.BaseFee)
@@ -351,8 +361,11 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 	if err != nil {
 		return err
 	}
-	// If the block is a checkpoint block, verify the signer list
-	if number%c.config.Epoch == 0 {
+	// If the block is a checkpoint block, verify the signer list. With a governance
+	// contract the list can only be checked against the post-state of the block,
+	// which is done by ValidateState. Without the state, the snapshot only adopts
+	// it once confirmed by a majority of the current signers.
+	if number%c.config.Epoch == 0 && c.config.SignerContract == nil {
 		signers := make([]byte, len(snap.Signers)*common.AddressLength)
 		for i, signer := range snap.signers() {
 			copy(signers[i*common.AddressLength:], signer[:])
@@ -396,11 +409,7 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 			if checkpoint != nil {
 				hash := checkpoint.Hash()
 
-				signers := make([]common.Address, (len(checkpoint.Extra)-extraVanity-extraSeal)/common.AddressLength)
-				for i := 0; i < len(signers); i++ {
-					copy(signers[i][:], checkpoint.Extra[extraVanity+i*common.AddressLength:])
-				}
-				snap = newSnapshot(c.config, c.signatures, number, hash, signers)
+				snap = newSnapshot(c.config, c.signatures, number, hash, checkpointSigners(checkpoint))
 				if err := snap.store(c.db); err != nil {
 					return nil, err
 				}
@@ -514,7 +523,7 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 	if err != nil {
 		return err
 	}
-	if number%c.config.Epoch != 0 {
+	if number%c.config.Epoch != 0 && c.config.SignerContract == nil {
 		c.lock.RLock()
 
 		// Gather all the proposals that make sense voting on
@@ -580,6 +589,20 @@ func (c *Clique) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *
 	// Finalize block
 	c.Finalize(chain, header, state, txs, uncles)
 
+	// If signers are managed by the governance contract, embed the post-state
+	// signer list into checkpoint blocks
+	if c.config.SignerContract != nil && header.Number.Uint64()%c.config.Epoch == 0 {
+		signers, err := contractSigners(state, *c.config.SignerContract)
+		if err != nil {
+			return nil, err
+		}
+		extra := make([]byte, 0, extraVanity+len(signers)*common.AddressLength+extraSeal)
+		extra = append(extra, header.Extra[:extraVanity]...)
+		for _, signer := range signers {
+			extra = append(extra, signer[:]...)
+		}
+		header.Extra = append(extra, make([]byte, extraSeal)...)
+	}
 	// Assemble and return the final block for sealing
 	return types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil)), nil
 }
@@ -17,7 +17,10 @@
 package clique
 
 import (
+	"bytes"
+	"crypto/ecdsa"
 	"math/big"
+	"sort"
 	"testing"
 
 	"github.com/avalanria/go-avalanria/common"
@@ -26,6 +29,7 @@ import (
 	"github.com/avalanria/go-avalanria/core/types"
 	"github.com/avalanria/go-avalanria/core/vm"
 	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/metrics"
 	"github.com/avalanria/go-avalanria/params"
 )
 
@@ -125,3 +129,226 @@ func TestSealHash(t *testing.T) {
 		t.Errorf("have %x, want %x", have, want)
 	}
 }
+
+// Tests that if signer membership is managed by a governance contract, the signer
+// list is switched over to the contract's on checkpoint blocks and that blocks
+// embedding a list deviating from the contract's are rejected.
+func TestGovernanceSigners(t *testing.T) {
+	var (
+		keyA, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		keyB, _  = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		addrA    = crypto.PubkeyToAddress(keyA.PublicKey)
+		addrB    = crypto.PubkeyToAddress(keyB.PublicKey)
+		contract = common.HexToAddress("0x000000000000000000000000000000000000c11c")
+	)
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = &params.CliqueConfig{Period: 0, Epoch: 3, SignerContract: &contract}
+
+	// Create a genesis with a single signer, but a contract listing two of them
+	var (
+		first  = common.BytesToHash(crypto.Keccak256(common.Hash{}.Bytes()))
+		second = common.BigToHash(new(big.Int).Add(first.Big(), common.Big1))
+	)
+	genspec := &core.Genesis{
+		Config:    &config,
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		Alloc: map[common.Address]core.GenesisAccount{
+			contract: {
+				Balance: new(big.Int),
+				Storage: map[common.Hash]common.Hash{
+					{}:     common.BigToHash(big.NewInt(2)),
+					first:  common.BytesToHash(addrA[:]),
+					second: common.BytesToHash(addrB[:]),
+				},
+			},
+		},
+		BaseFee: big.NewInt(params.InitialBaseFee),
+	}
+	copy(genspec.ExtraData[extraVanity:], addrA[:])
+
+	makeChain := func(tamper bool) []*types.Block {
+		db := rawdb.NewMemoryDatabase()
+		genesis := genspec.MustCommit(db)
+
+		blocks, _ := core.GenerateChain(&config, genesis, New(config.Clique, db), db, 3, func(i int, block *core.BlockGen) {
+			block.SetExtra(make([]byte, extraVanity+extraSeal))
+			block.SetDifficulty(diffInTurn)
+		})
+		for i, block := range blocks {
+			header := block.Header()
+			if i > 0 {
+				header.ParentHash = blocks[i-1].Hash()
+			}
+			if tamper && header.Number.Uint64()%config.Clique.Epoch == 0 {
+				header.Extra = make([]byte, extraVanity+common.AddressLength+extraSeal)
+				copy(header.Extra[extraVanity:], addrA[:])
+			}
+			sig, _ := crypto.Sign(SealHash(header).Bytes(), keyA)
+			copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+			blocks[i] = block.WithSeal(header)
+		}
+		return blocks
+	}
+	// Import a chain with a valid checkpoint and ensure the signers are switched
+	db := rawdb.NewMemoryDatabase()
+	genspec.MustCommit(db)
+
+	engine := New(config.Clique, db)
+	chain, _ := core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	blocks := makeChain(false)
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert blocks: %v", err)
+	}
+	snap, err := engine.snapshot(chain, 3, blocks[2].Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if len(snap.Signers) != 2 {
+		t.Fatalf("signer count mismatch: have %d, want %d", len(snap.Signers), 2)
+	}
+	for _, signer := range []common.Address{addrA, addrB} {
+		if _, ok := snap.Signers[signer]; !ok {
+			t.Errorf("signer %x missing from snapshot", signer)
+		}
+	}
+	// Import a chain with a checkpoint deviating from the contract and ensure it's rejected
+	db = rawdb.NewMemoryDatabase()
+	genspec.MustCommit(db)
+
+	chain, _ = core.NewBlockChain(db, nil, &config, New(config.Clique, db), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(makeChain(true)); err != errMismatchingCheckpointSigners {
+		t.Fatalf("tampered checkpoint error mismatch: have %v, want %v", err, errMismatchingCheckpointSigners)
+	}
+}
+
+// Tests that the signer liveness statistics track the in-turn and out-of-turn
+// blocks of the signers, along with the turns they missed, and that they are
+// exported as per-signer metrics.
+func TestLiveness(t *testing.T) {
+	// Create three signers, ordered by address to know whose turn it is
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(crypto.PubkeyToAddress(keys[i].PublicKey).Bytes(), crypto.PubkeyToAddress(keys[j].PublicKey).Bytes()) < 0
+	})
+	addrs := make([]common.Address, len(keys))
+	for i, key := range keys {
+		addrs[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	genspec := &core.Genesis{
+		ExtraData: make([]byte, extraVanity+len(addrs)*common.AddressLength+extraSeal),
+		BaseFee:   big.NewInt(params.InitialBaseFee),
+	}
+	for i, addr := range addrs {
+		copy(genspec.ExtraData[extraVanity+i*common.AddressLength:], addr[:])
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesis := genspec.MustCommit(db)
+
+	// Sign a chain with the last signer offline, the others taking over its turns
+	// and consequently missing some of their own due to the recent signer limit
+	schedule := []struct {
+		signer int
+		inturn bool
+	}{
+		{1, true}, {0, false}, {1, false}, {0, false}, {1, false}, {0, true},
+	}
+	engine := New(params.AllCliqueProtocolChanges.Clique, db)
+	blocks, _ := core.GenerateChain(params.AllCliqueProtocolChanges, genesis, engine, db, len(schedule), func(i int, block *core.BlockGen) {
+		block.SetExtra(make([]byte, extraVanity+extraSeal))
+	})
+	for i, block := range blocks {
+		header := block.Header()
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		header.Difficulty = diffNoTurn
+		if schedule[i].inturn {
+			header.Difficulty = diffInTurn
+		}
+		sig, _ := crypto.Sign(SealHash(header).Bytes(), keys[schedule[i].signer])
+		copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+		blocks[i] = block.WithSeal(header)
+	}
+	chain, _ := core.NewBlockChain(db, nil, params.AllCliqueProtocolChanges, engine, vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert blocks: %v", err)
+	}
+	tests := []struct {
+		window uint64
+		want   map[common.Address]SignerLiveness
+	}{
+		{
+			window: 64, // Capped to the chain length
+			want: map[common.Address]SignerLiveness{
+				addrs[0]: {InTurn: 1, OutOfTurn: 2, Missed: 1, LastSigned: 6},
+				addrs[1]: {InTurn: 1, OutOfTurn: 2, Missed: 1, LastSigned: 5},
+				addrs[2]: {Missed: 2},
+			},
+		},
+		{
+			window: 4,
+			want: map[common.Address]SignerLiveness{
+				addrs[0]: {InTurn: 1, OutOfTurn: 1, Missed: 1, LastSigned: 6},
+				addrs[1]: {OutOfTurn: 2, Missed: 1, LastSigned: 5},
+				addrs[2]: {Missed: 1},
+			},
+		},
+	}
+	api := &API{chain: chain, clique: engine}
+	for i, tt := range tests {
+		window := tt.window
+		stats, err := api.Liveness(&window)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve liveness: %v", i, err)
+		}
+		if stats.Number != uint64(len(blocks)) {
+			t.Errorf("test %d: number mismatch: have %d, want %d", i, stats.Number, len(blocks))
+		}
+		if len(stats.Signers) != len(tt.want) {
+			t.Errorf("test %d: signer count mismatch: have %d, want %d", i, len(stats.Signers), len(tt.want))
+		}
+		for addr, want := range tt.want {
+			if have := stats.Signers[addr]; have == nil || *have != want {
+				t.Errorf("test %d: signer %x liveness mismatch: have %+v, want %+v", i, addr, have, want)
+			}
+		}
+	}
+	// Report the liveness as metrics, with a stale signer left over from earlier
+	enabled := metrics.Enabled
+	metrics.Enabled = true
+	defer func() { metrics.Enabled = enabled }()
+
+	stale := common.Address{0xff}
+	metrics.GetOrRegisterGauge(livenessMetric(stale, "last"), nil).Update(1)
+	engine.livenessSigners = map[common.Address]struct{}{stale: {}}
+
+	engine.ReportLiveness(chain, chain.CurrentHeader())
+	for addr, want := range tests[0].want {
+		values := map[string]uint64{"inturn": want.InTurn, "outofturn": want.OutOfTurn, "missed": want.Missed, "last": want.LastSigned}
+		for name, value := range values {
+			gauge, ok := metrics.DefaultRegistry.Get(livenessMetric(addr, name)).(metrics.Gauge)
+			if !ok {
+				t.Errorf("signer %x: missing %s gauge", addr, name)
+				continue
+			}
+			if gauge.Value() != int64(value) {
+				t.Errorf("signer %x: %s gauge mismatch: have %d, want %d", addr, name, gauge.Value(), value)
+			}
+		}
+	}
+	if metrics.DefaultRegistry.Get(livenessMetric(stale, "last")) != nil {
+		t.Errorf("stale signer gauge not unregistered")
+	}
+	if _, ok := engine.livenessSigners[stale]; ok {
+		t.Errorf("stale signer still tracked")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/consensus"
+	"github.com/avalanria/go-avalanria/core/state"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/crypto"
+)
+
+// maxContractSigners is the upper limit on the number of signers read out of the
+// governance contract, protecting against a corrupt length slot making the node
+// iterate over an unbounded amount of storage.
+const maxContractSigners = 1024
+
+var (
+	// errNoContractSigners is returned if the governance contract does not list
+	// a single signer, which would halt the chain.
+	errNoContractSigners = errors.New("governance contract has no signers")
+
+	// errTooManyContractSigners is returned if the governance contract claims to
+	// list more signers than allowed.
+	errTooManyContractSigners = errors.New("governance contract has too many signers")
+
+	// errVotingDisabled is returned if a header vote or a local proposal is made
+	// while signer membership is managed by the governance contract.
+	errVotingDisabled = errors.New("signer voting disabled by governance contract")
+)
+
+// contractSigners reads the list of authorized signers from the governance
+// contract's storage in the given state.
+//
+// The contract is expected to declare the signer list as its first storage
+// variable (`address[] signers`), i.e. the array length is stored in slot 0 and
+// the elements are laid out consecutively starting at keccak256(0). The returned
+// list is deduplicated and sorted in ascending order, matching the order signers
+// are embedded into checkpoint headers.
+func contractSigners(statedb *state.StateDB, contract common.Address) ([]common.Address, error) {
+	length := statedb.GetState(contract, common.Hash{}).Big()
+	if length.Sign() == 0 {
+		return nil, errNoContractSigners
+	}
+	if !length.IsUint64() || length.Uint64() > maxContractSigners {
+		return nil, errTooManyContractSigners
+	}
+	var (
+		base    = new(big.Int).SetBytes(crypto.Keccak256(common.Hash{}.Bytes()))
+		seen    = make(map[common.Address]struct{})
+		signers = make([]common.Address, 0, length.Uint64())
+	)
+	for i := uint64(0); i < length.Uint64(); i++ {
+		slot := common.BigToHash(new(big.Int).Add(base, new(big.Int).SetUint64(i)))
+		signer := common.BytesToAddress(statedb.GetState(contract, slot).Bytes())
+		if _, ok := seen[signer]; ok {
+			continue
+		}
+		seen[signer] = struct{}{}
+		signers = append(signers, signer)
+	}
+	sort.Sort(signersAscending(signers))
+	return signers, nil
+}
+
+// checkpointSigners extracts the list of signers embedded into a checkpoint
+// header's extra-data section.
+func checkpointSigners(header *types.Header) []common.Address {
+	signers := make([]common.Address, (len(header.Extra)-extraVanity-extraSeal)/common.AddressLength)
+	for i := 0; i < len(signers); i++ {
+		copy(signers[i][:], header.Extra[extraVanity+i*common.AddressLength:])
+	}
+	return signers
+}
+
+// ValidateState implements consensus.StateValidator, ensuring that the signer
+// list embedded into a checkpoint block matches the one defined by the governance
+// contract after executing the block.
+func (c *Clique) ValidateState(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB) error {
+	if c.config.SignerContract == nil || header.Number.Uint64()%c.config.Epoch != 0 {
+		return nil
+	}
+	signers, err := contractSigners(state, *c.config.SignerContract)
+	if err != nil {
+		return err
+	}
+	have := checkpointSigners(header)
+	if len(have) != len(signers) {
+		return errMismatchingCheckpointSigners
+	}
+	for i := range signers {
+		if have[i] != signers[i] {
+			return errMismatchingCheckpointSigners
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/consensus"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/metrics"
+)
+
+const (
+	defaultLivenessWindow = 64    // Number of recent blocks to gather liveness statistics over by default
+	maxLivenessWindow     = 16384 // Maximum number of recent blocks to gather liveness statistics over
+)
+
+var (
+	livenessInTurnGauge    = metrics.NewRegisteredGauge("clique/liveness/inturn", nil)    // Blocks signed in-turn within the recent window
+	livenessOutOfTurnGauge = metrics.NewRegisteredGauge("clique/liveness/outofturn", nil) // Blocks signed out-of-turn within the recent window
+	livenessMissedGauge    = metrics.NewRegisteredGauge("clique/liveness/missed", nil)    // In-turn blocks signed by someone else within the recent window
+	livenessInactiveGauge  = metrics.NewRegisteredGauge("clique/liveness/inactive", nil)  // Signers without any block within the recent window
+
+	livenessMetricNames = []string{"inturn", "outofturn", "missed", "last"} // Per-signer liveness gauges
+)
+
+// SignerLiveness is the signing activity of a single signer within a window of
+// recent blocks.
+type SignerLiveness struct {
+	InTurn     uint64 `json:"inturn"`     // Number of blocks signed in-turn
+	OutOfTurn  uint64 `json:"outofturn"`  // Number of blocks signed out-of-turn
+	Missed     uint64 `json:"missed"`     // Number of in-turn blocks signed by someone else
+	LastSigned uint64 `json:"lastSigned"` // Number of the last block signed, 0 if none in the window
+}
+
+// Liveness is the signing activity of all the signers within a window of recent
+// blocks.
+type Liveness struct {
+	Number  uint64                             `json:"number"`  // Last block of the window
+	Window  uint64                             `json:"window"`  // Number of blocks in the window
+	Signers map[common.Address]*SignerLiveness `json:"signers"` // Activity of the signers active within the window
+}
+
+// liveness gathers the signing activity of the signers within the given number
+// of blocks leading up to and including the given header.
+func (c *Clique) liveness(chain consensus.ChainHeaderReader, header *types.Header, window uint64) (*Liveness, error) {
+	end := header.Number.Uint64()
+	if window > end {
+		window = end // The genesis block is not signed
+	}
+	start := end - window + 1
+
+	// Collect the headers of the window, walking back from the requested one
+	headers := make([]*types.Header, window)
+	for i := len(headers) - 1; i >= 0; i-- {
+		if header == nil {
+			return nil, fmt.Errorf("missing block %d", start+uint64(i))
+		}
+		headers[i] = header
+		header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	stats := &Liveness{
+		Number:  end,
+		Window:  window,
+		Signers: make(map[common.Address]*SignerLiveness),
+	}
+	if window == 0 {
+		return stats, nil
+	}
+	// Replay the window on top of the snapshot preceding it to track the turns
+	snap, err := c.snapshot(chain, start-1, headers[0].ParentHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	signer := func(addr common.Address) *SignerLiveness {
+		if stats.Signers[addr] == nil {
+			stats.Signers[addr] = new(SignerLiveness)
+		}
+		return stats.Signers[addr]
+	}
+	for _, addr := range snap.signers() {
+		signer(addr)
+	}
+	for _, header := range headers {
+		number := header.Number.Uint64()
+
+		author, err := ecrecover(header, c.signatures)
+		if err != nil {
+			return nil, err
+		}
+		signers := snap.signers()
+		inturn := signers[number%uint64(len(signers))]
+
+		if header.Difficulty.Cmp(diffInTurn) == 0 {
+			signer(author).InTurn++
+		} else {
+			signer(author).OutOfTurn++
+			signer(inturn).Missed++
+		}
+		signer(author).LastSigned = number
+
+		if snap, err = snap.apply([]*types.Header{header}); err != nil {
+			return nil, err
+		}
+		// Make sure the signers joining within the window are reported too
+		for _, addr := range snap.signers() {
+			signer(addr)
+		}
+	}
+	return stats, nil
+}
+
+// ReportLiveness exports the signing activity within the recent blocks leading up
+// to a new canonical chain head as metrics. Every signer active within the window
+// gets its own in-turn, out-of-turn, missed and last signed block gauges, next to
+// the totals of the window. The gauges of signers dropping out of the window are
+// unregistered to avoid reporting stale values.
+func (c *Clique) ReportLiveness(chain consensus.ChainHeaderReader, head *types.Header) {
+	if !metrics.Enabled {
+		return
+	}
+	stats, err := c.liveness(chain, head, defaultLivenessWindow)
+	if err != nil {
+		log.Debug("Failed to gather signer liveness", "number", head.Number, "hash", head.Hash(), "err", err)
+		return
+	}
+	c.livenessLock.Lock()
+	defer c.livenessLock.Unlock()
+
+	if c.livenessSigners == nil {
+		c.livenessSigners = make(map[common.Address]struct{})
+	}
+	var inturn, outofturn, missed, inactive int64
+	for addr, signer := range stats.Signers {
+		metrics.GetOrRegisterGauge(livenessMetric(addr, "inturn"), nil).Update(int64(signer.InTurn))
+		metrics.GetOrRegisterGauge(livenessMetric(addr, "outofturn"), nil).Update(int64(signer.OutOfTurn))
+		metrics.GetOrRegisterGauge(livenessMetric(addr, "missed"), nil).Update(int64(signer.Missed))
+		metrics.GetOrRegisterGauge(livenessMetric(addr, "last"), nil).Update(int64(signer.LastSigned))
+		c.livenessSigners[addr] = struct{}{}
+
+		inturn += int64(signer.InTurn)
+		outofturn += int64(signer.OutOfTurn)
+		missed += int64(signer.Missed)
+		if signer.LastSigned == 0 {
+			inactive++
+		}
+	}
+	for addr := range c.livenessSigners {
+		if _, ok := stats.Signers[addr]; !ok {
+			for _, name := range livenessMetricNames {
+				metrics.DefaultRegistry.Unregister(livenessMetric(addr, name))
+			}
+			delete(c.livenessSigners, addr)
+		}
+	}
+	livenessInTurnGauge.Update(inturn)
+	livenessOutOfTurnGauge.Update(outofturn)
+	livenessMissedGauge.Update(missed)
+	livenessInactiveGauge.Update(inactive)
+}
+
+// livenessMetric returns the name of a liveness gauge of the given signer.
+func livenessMetric(signer common.Address, name string) string {
+	return fmt.Sprintf("clique/liveness/%s/%s", strings.ToLower(signer.Hex()), name)
+}
@@ -51,12 +51,14 @@ type Snapshot struct {
 	config   *params.CliqueConfig // Consensus engine parameters to fine tune behavior
 	sigcache *lru.ARCCache        // Cache of recent block signatures to speed up ecrecover
 
-	Number  uint64                      `json:"number"`  // Block number where the snapshot was created
-	Hash    common.Hash                 `json:"hash"`    // Block hash where the snapshot was created
-	Signers map[common.Address]struct{} `json:"signers"` // Set of authorized signers at this moment
-	Recents map[uint64]common.Address   `json:"recents"` // Set of recent signers for spam protections
-	Votes   []*Vote                     `json:"votes"`   // List of votes cast in chronological order
-	Tally   map[common.Address]Tally    `json:"tally"`   // Current vote tally to avoid recalculating
+	Number   uint64                      `json:"number"`             // Block number where the snapshot was created
+	Hash     common.Hash                 `json:"hash"`               // Block hash where the snapshot was created
+	Signers  map[common.Address]struct{} `json:"signers"`            // Set of authorized signers at this moment
+	Recents  map[uint64]common.Address   `json:"recents"`            // Set of recent signers for spam protections
+	Votes    []*Vote                     `json:"votes"`              // List of votes cast in chronological order
+	Tally    map[common.Address]Tally    `json:"tally"`              // Current vote tally to avoid recalculating
+	Pending  []common.Address            `json:"pending,omitempty"`  // Signer list of the last checkpoint awaiting confirmation (governance contract only)
+	Confirms map[common.Address]struct{} `json:"confirms,omitempty"` // Current signers having signed on top of the pending list
 }
 
 // signersAscending implements the sort interface to allow sorting a list of addresses
@@ -133,6 +135,15 @@ func (s *Snapshot) copy() *Snapshot {
 	}
 	copy(cpy.Votes, s.Votes)
 
+	if s.Pending != nil {
+		cpy.Pending = make([]common.Address, len(s.Pending))
+		copy(cpy.Pending, s.Pending)
+
+		cpy.Confirms = make(map[common.Address]struct{})
+		for signer := range s.Confirms {
+			cpy.Confirms[signer] = struct{}{}
+		}
+	}
 	return cpy
 }
 
@@ -229,67 +240,97 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 		}
 		snap.Recents[number] = signer
 
-		// Header authorized, discard any previous votes from the signer
-		for i, vote := range snap.Votes {
-			if vote.Signer == signer && vote.Address == header.Coinbase {
-				// Uncast the vote from the cached tally
-				snap.uncast(vote.Address, vote.Authorize)
+		// If signers are managed by the governance contract, header votes are not
+		// tallied and the signer list is replaced wholesale on checkpoint blocks.
+		// The list can't be checked without the state of the checkpoint, so it only
+		// takes effect once a majority of the current signers signed on top of it,
+		// preventing a single signer from installing a list of its choosing.
+		if s.config.SignerContract != nil {
+			if number%s.config.Epoch == 0 {
+				snap.Pending, snap.Confirms = checkpointSigners(header), make(map[common.Address]struct{})
+			}
+			if snap.Pending != nil {
+				snap.Confirms[signer] = struct{}{}
 
-				// Uncast the vote from the chronological list
-				snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
-				break // only one vote allowed
+				if len(snap.Confirms) > len(snap.Signers)/2 {
+					snap.Signers = make(map[common.Address]struct{})
+					for _, pending := range snap.Pending {
+						snap.Signers[pending] = struct{}{}
+					}
+					snap.Pending, snap.Confirms = nil, nil
+
+					// Signer list might have shrunk, delete any leftover recent caches
+					limit := uint64(len(snap.Signers)/2 + 1)
+					for block := range snap.Recents {
+						if block+limit <= number {
+							delete(snap.Recents, block)
+						}
+					}
+				}
 			}
-		}
-		// Tally up the new vote from the signer
-		var authorize bool
-		switch {
-		case bytes.Equal(header.Nonce[:], nonceAuthVote):
-			authorize = true
-		case bytes.Equal(header.Nonce[:], nonceDropVote):
-			authorize = false
-		default:
-			return nil, errInvalidVote
-		}
-		if snap.cast(header.Coinbase, authorize) {
-			snap.Votes = append(snap.Votes, &Vote{
-				Signer:    signer,
-				Block:     number,
-				Address:   header.Coinbase,
-				Authorize: authorize,
-			})
-		}
-		// If the vote passed, update the list of signers
-		if tally := snap.Tally[header.Coinbase]; tally.Votes > len(snap.Signers)/2 {
-			if tally.Authorize {
-				snap.Signers[header.Coinbase] = struct{}{}
-			} else {
-				delete(snap.Signers, header.Coinbase)
+		} else {
+			// Header authorized, discard any previous votes from the signer
+			for i, vote := range snap.Votes {
+				if vote.Signer == signer && vote.Address == header.Coinbase {
+					// Uncast the vote from the cached tally
+					snap.uncast(vote.Address, vote.Authorize)
 
-				// Signer list shrunk, delete any leftover recent caches
-				if limit := uint64(len(snap.Signers)/2 + 1); number >= limit {
-					delete(snap.Recents, number-limit)
+					// Uncast the vote from the chronological list
+					snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
+					break // only one vote allowed
 				}
-				// Discard any previous votes the deauthorized signer cast
-				for i := 0; i < len(snap.Votes); i++ {
-					if snap.Votes[i].Signer == header.Coinbase {
-						// Uncast the vote from the cached tally
-						snap.uncast(snap.Votes[i].Address, snap.Votes[i].Authorize)
+			}
+			// Tally up the new vote from the signer
+			var authorize bool
+			switch {
+			case bytes.Equal(header.Nonce[:], nonceAuthVote):
+				authorize = true
+			case bytes.Equal(header.Nonce[:], nonceDropVote):
+				authorize = false
+			default:
+				return nil, errInvalidVote
+			}
+			if snap.cast(header.Coinbase, authorize) {
+				snap.Votes = append(snap.Votes, &Vote{
+					Signer:    signer,
+					Block:     number,
+					Address:   header.Coinbase,
+					Authorize: authorize,
+				})
+			}
+			// If the vote passed, update the list of signers
+			if tally := snap.Tally[header.Coinbase]; tally.Votes > len(snap.Signers)/2 {
+				if tally.Authorize {
+					snap.Signers[header.Coinbase] = struct{}{}
+				} else {
+					delete(snap.Signers, header.Coinbase)
 
-						// Uncast the vote from the chronological list
-						snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
+					// Signer list shrunk, delete any leftover recent caches
+					if limit := uint64(len(snap.Signers)/2 + 1); number >= limit {
+						delete(snap.Recents, number-limit)
+					}
+					// Discard any previous votes the deauthorized signer cast
+					for i := 0; i < len(snap.Votes); i++ {
+						if snap.Votes[i].Signer == header.Coinbase {
+							// Uncast the vote from the cached tally
+							snap.uncast(snap.Votes[i].Address, snap.Votes[i].Authorize)
 
-						i--
+							// Uncast the vote from the chronological list
+							snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
+
+							i--
+						}
 					}
 				}
-			}
-			// Discard any previous votes around the just changed account
-			for i := 0; i < len(snap.Votes); i++ {
-				if snap.Votes[i].Address == header.Coinbase {
-					snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
-					i--
+				// Discard any previous votes around the just changed account
+				for i := 0; i < len(snap.Votes); i++ {
+					if snap.Votes[i].Address == header.Coinbase {
+						snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
+						i--
+					}
 				}
+				delete(snap.Tally, header.Coinbase)
 			}
-			delete(snap.Tally, header.Coinbase)
 		}
 		// If we're taking too much time (ecrecover), notify the user once a while
 		if time.Since(logged) > 8*time.Second {
@@ -30,6 +30,7 @@ import (
 	"github.com/avalanria/go-avalanria/core/vm"
 	"github.com/avalanria/go-avalanria/crypto"
 	"github.com/avalanria/go-avalanria/params"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 // testerAccountPool is a pool to maintain currently active tester accounts,
@@ -504,3 +505,57 @@ func TestClique(t *testing.T) {
 		}
 	}
 }
+
+// Tests that if signer membership is managed by a governance contract, the signer
+// list of a checkpoint block only takes effect once a majority of the current
+// signers signed on top of it, so a single signer can't install its own list in
+// header-only verification.
+func TestGovernanceCheckpointConfirmation(t *testing.T) {
+	var (
+		accounts = newTesterAccountPool()
+		contract = common.HexToAddress("0x000000000000000000000000000000000000c11c")
+		config   = &params.CliqueConfig{Epoch: 3, SignerContract: &contract}
+	)
+	sigcache, _ := lru.NewARC(inmemorySignatures)
+	genesis := newSnapshot(config, sigcache, 0, common.Hash{}, []common.Address{
+		accounts.address("A"), accounts.address("B"), accounts.address("C"),
+	})
+	header := func(number uint64, signer string, checkpoint ...string) *types.Header {
+		header := &types.Header{
+			Number: new(big.Int).SetUint64(number),
+			Extra:  make([]byte, extraVanity+len(checkpoint)*common.AddressLength+extraSeal),
+		}
+		accounts.checkpoint(header, checkpoint)
+		accounts.sign(header, signer)
+		return header
+	}
+	// Have a single signer embed a list replacing everyone else in a checkpoint
+	var (
+		h1 = header(1, "A")
+		h2 = header(2, "B")
+		h3 = header(3, "C", "C", "D")
+	)
+	snap, err := genesis.apply([]*types.Header{h1, h2, h3})
+	if err != nil {
+		t.Fatalf("failed to apply checkpoint: %v", err)
+	}
+	if len(snap.Signers) != 3 || len(snap.Pending) != 2 {
+		t.Fatalf("unconfirmed checkpoint adopted: signers %x, pending %x", snap.signers(), snap.Pending)
+	}
+	if _, err := snap.apply([]*types.Header{header(4, "D")}); err != errUnauthorizedSigner {
+		t.Fatalf("unconfirmed signer error mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+	// Confirm the checkpoint by another signer and ensure the list is adopted
+	if snap, err = snap.apply([]*types.Header{header(4, "A")}); err != nil {
+		t.Fatalf("failed to apply confirmation: %v", err)
+	}
+	if snap.Pending != nil {
+		t.Fatalf("confirmed checkpoint still pending: %x", snap.Pending)
+	}
+	if snap, err = snap.apply([]*types.Header{header(5, "D")}); err != nil {
+		t.Fatalf("confirmed signer rejected: %v", err)
+	}
+	if _, ok := snap.Signers[accounts.address("A")]; ok || len(snap.Signers) != 2 {
+		t.Fatalf("signers mismatch: have %x", snap.signers())
+	}
+}
@@ -125,3 +125,12 @@ type PoW interface {
 	// Hashrate returns the current mining hashrate of a PoW consensus engine.
 	Hashrate() float64
 }
+
+// StateValidator is an optional interface a consensus engine may implement if
+// some of its rules depend on the post-state of a block, which is not available
+// during header verification.
+type StateValidator interface {
+	// ValidateState checks the given header against the state resulting from the
+	// execution of its block.
+	ValidateState(chain ChainHeaderReader, header *types.Header, state *state.StateDB) error
+}
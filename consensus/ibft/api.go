@@ -0,0 +1,110 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/consensus"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/rpc"
+)
+
+// API is a user facing RPC API to allow controlling the validator voting and
+// inspecting the progress of the byzantine fault tolerant agreement.
+type API struct {
+	chain consensus.ChainHeaderReader
+	ibft  *Engine
+}
+
+// GetSnapshot retrieves the state snapshot at a given block.
+func (api *API) GetSnapshot(number *rpc.BlockNumber) (*Snapshot, error) {
+	// Retrieve the requested block number (or current if none requested)
+	var header *types.Header
+	if number == nil || *number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	// Ensure we have an actually valid block and return its snapshot
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return api.ibft.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+}
+
+// GetSnapshotAtHash retrieves the state snapshot at a given block.
+func (api *API) GetSnapshotAtHash(hash common.Hash) (*Snapshot, error) {
+	header := api.chain.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return api.ibft.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+}
+
+// GetValidators retrieves the list of validators at the specified block.
+func (api *API) GetValidators(number *rpc.BlockNumber) ([]common.Address, error) {
+	snap, err := api.GetSnapshot(number)
+	if err != nil {
+		return nil, err
+	}
+	return snap.Validators, nil
+}
+
+// GetValidatorsAtHash retrieves the list of validators at the specified block.
+func (api *API) GetValidatorsAtHash(hash common.Hash) ([]common.Address, error) {
+	snap, err := api.GetSnapshotAtHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return snap.Validators, nil
+}
+
+// Proposals returns the current proposals the node tries to uphold and vote on.
+func (api *API) Proposals() map[common.Address]bool {
+	api.ibft.lock.RLock()
+	defer api.ibft.lock.RUnlock()
+
+	proposals := make(map[common.Address]bool)
+	for address, auth := range api.ibft.proposals {
+		proposals[address] = auth
+	}
+	return proposals
+}
+
+// Propose injects a new validator set change proposal that the validator will
+// attempt to push through.
+func (api *API) Propose(address common.Address, auth bool) {
+	api.ibft.lock.Lock()
+	defer api.ibft.lock.Unlock()
+
+	api.ibft.proposals[address] = auth
+}
+
+// Discard drops a currently running proposal, stopping the validator from casting
+// further votes (either for or against).
+func (api *API) Discard(address common.Address) {
+	api.ibft.lock.Lock()
+	defer api.ibft.lock.Unlock()
+
+	delete(api.ibft.proposals, address)
+}
+
+// Status returns the progress of the local validator in agreeing on the next
+// block: the sequence and round, the round's proposer and the votes seen.
+func (api *API) Status() (*Status, error) {
+	return api.ibft.machine.status()
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"bytes"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/rlp"
+)
+
+// MixDigest is the fixed mix digest identifying blocks sealed by the IBFT consensus
+// engine.
+var MixDigest = common.HexToHash("0x63746963616c2062797a616e74696e65206661756c7420746f6c6572616e6365")
+
+// Extra is the IBFT consensus data stored in the extra-data field of a block
+// header, following the fixed size vanity prefix.
+type Extra struct {
+	Validators    []common.Address // Validator set, only present in checkpoint blocks
+	Seal          []byte           // Signature of the proposer over the seal hash
+	CommittedSeal [][]byte         // Commit signatures of a quorum of validators
+}
+
+// ExtractExtra decodes the IBFT consensus data from the extra-data section of a
+// block header.
+func ExtractExtra(header *types.Header) (*Extra, error) {
+	if len(header.Extra) < extraVanity {
+		return nil, errMissingVanity
+	}
+	extra := new(Extra)
+	if err := rlp.DecodeBytes(header.Extra[extraVanity:], extra); err != nil {
+		return nil, errInvalidExtraData
+	}
+	return extra, nil
+}
+
+// encodeExtra assembles a header extra-data section from the given vanity prefix
+// and IBFT consensus data. The vanity is padded or truncated to size.
+func encodeExtra(vanity []byte, extra *Extra) ([]byte, error) {
+	if len(vanity) < extraVanity {
+		vanity = append(common.CopyBytes(vanity), bytes.Repeat([]byte{0x00}, extraVanity-len(vanity))...)
+	}
+	payload, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		return nil, err
+	}
+	return append(common.CopyBytes(vanity[:extraVanity]), payload...), nil
+}
+
+// filteredHeader returns a copy of the header with the committed seals, and the
+// proposer seal too if requested, stripped from its extra-data section. Headers
+// without valid IBFT consensus data are returned as is.
+func filteredHeader(header *types.Header, keepSeal bool) *types.Header {
+	cpy := types.CopyHeader(header)
+
+	extra, err := ExtractExtra(cpy)
+	if err != nil {
+		return cpy
+	}
+	if !keepSeal {
+		extra.Seal = nil
+	}
+	extra.CommittedSeal = nil
+
+	if cpy.Extra, err = encodeExtra(cpy.Extra[:extraVanity], extra); err != nil {
+		return types.CopyHeader(header)
+	}
+	return cpy
+}
+
+// SealHash returns the hash of a block prior to it being sealed by its proposer.
+func SealHash(header *types.Header) common.Hash {
+	return filteredHeader(header, false).Hash()
+}
+
+// ProposalHash returns the hash of a block the validators agree upon. It covers
+// the proposer seal, but not the commit seals only added after agreement, so it
+// is the same for the proposal and the final block.
+func ProposalHash(header *types.Header) common.Hash {
+	return filteredHeader(header, true).Hash()
+}
+
+// IBFTRLP returns the rlp bytes which need to be signed by the proposer of a
+// block. The RLP to sign consists of the entire header with both the proposer
+// and the committed seals removed from the extra-data.
+func IBFTRLP(header *types.Header) []byte {
+	blob, err := rlp.EncodeToBytes(filteredHeader(header, false))
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	return blob
+}
+
+// commitData returns the data a validator signs when committing to a proposal,
+// identified by its proposal hash.
+func commitData(hash common.Hash) []byte {
+	return append(hash.Bytes(), byte(msgCommit))
+}
+
+// recoverAddress extracts the address of the account which signed the keccak256
+// hash of the given data.
+func recoverAddress(data []byte, sig []byte) (common.Address, error) {
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(data), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"fmt"
+	"sync"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/p2p"
+)
+
+const (
+	// ProtocolName is the official short name of the IBFT consensus sub-protocol.
+	ProtocolName = "ibft"
+
+	// ProtocolVersion is the version of the IBFT consensus sub-protocol.
+	ProtocolVersion = 1
+
+	// protocolLength is the number of message codes used by the sub-protocol.
+	protocolLength = 1
+
+	// maxMessageSize is the maximum cap on the size of a consensus message, large
+	// enough to carry a proposed block.
+	maxMessageSize = 10 * 1024 * 1024
+
+	// maxKnownMessages is the maximum message hashes to keep in the known list
+	// of a peer before starting to randomly evict them.
+	maxKnownMessages = 1024
+
+	// maxQueuedMessages is the maximum number of consensus messages to queue up
+	// for a peer before dropping new ones.
+	maxQueuedMessages = 256
+)
+
+// consensusMsg is the message code carrying a signed consensus message.
+const consensusMsg = 0x00
+
+// peer is a remote node connected through the consensus sub-protocol.
+type peer struct {
+	id    string
+	rw    p2p.MsgReadWriter
+	known mapset.Set  // Set of message hashes known to be known by this peer
+	queue chan []byte // Queue of consensus messages to send to the peer
+	term  chan struct{}
+}
+
+// markMessage marks a consensus message as known for the peer, ensuring that it
+// will never be propagated to this particular peer.
+func (p *peer) markMessage(hash common.Hash) {
+	// If we reached the memory allowance, drop a previously known message hash
+	for p.known.Cardinality() >= maxKnownMessages {
+		p.known.Pop()
+	}
+	p.known.Add(hash)
+}
+
+// send queues a consensus message for propagation to the peer, unless it already
+// knows about it. If the peer's queue is full, the message is dropped.
+func (p *peer) send(hash common.Hash, payload []byte) {
+	if p.known.Contains(hash) {
+		return
+	}
+	p.markMessage(hash)
+	p.queueMessage(payload)
+}
+
+// queueMessage queues a consensus message for propagation to the peer, whether
+// it knows about it or not. If the peer's queue is full, the message is dropped.
+func (p *peer) queueMessage(payload []byte) {
+	select {
+	case p.queue <- payload:
+	default:
+		log.Debug("Dropping IBFT message propagation", "peer", p.id)
+	}
+}
+
+// broadcast is a write loop that sends the queued consensus messages to the peer.
+func (p *peer) broadcast() {
+	for {
+		select {
+		case payload := <-p.queue:
+			if err := p2p.Send(p.rw, consensusMsg, payload); err != nil {
+				return
+			}
+		case <-p.term:
+			return
+		}
+	}
+}
+
+// peerSet is the set of peers connected through the consensus sub-protocol.
+type peerSet struct {
+	peers map[string]*peer
+	lock  sync.RWMutex
+}
+
+// newPeerSet creates an empty peer set.
+func newPeerSet() *peerSet {
+	return &peerSet{
+		peers: make(map[string]*peer),
+	}
+}
+
+// register adds a new peer into the set, failing if it's already present.
+func (ps *peerSet) register(p *peer) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if _, ok := ps.peers[p.id]; ok {
+		return p2p.DiscAlreadyConnected
+	}
+	ps.peers[p.id] = p
+	return nil
+}
+
+// unregister removes a peer from the set.
+func (ps *peerSet) unregister(id string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	delete(ps.peers, id)
+}
+
+// all returns a snapshot of the peers currently in the set.
+func (ps *peerSet) all() []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		list = append(list, p)
+	}
+	return list
+}
+
+// Protocols returns the p2p sub-protocol the validators exchange consensus
+// messages over. It needs to be registered alongside the chain protocols for
+// the engine to take part in the agreement.
+func (e *Engine) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    ProtocolName,
+		Version: ProtocolVersion,
+		Length:  protocolLength,
+		Run:     e.runPeer,
+		NodeInfo: func() interface{} {
+			status, _ := e.machine.status()
+			return status
+		},
+	}}
+}
+
+// runPeer is the handler of a remote peer connected through the consensus
+// sub-protocol, delivering its messages to the state machine.
+func (e *Engine) runPeer(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	remote := &peer{
+		id:    p.ID().String(),
+		rw:    rw,
+		known: mapset.NewSet(),
+		queue: make(chan []byte, maxQueuedMessages),
+		term:  make(chan struct{}),
+	}
+	if err := e.peers.register(remote); err != nil {
+		return err
+	}
+	defer e.peers.unregister(remote.id)
+
+	go remote.broadcast()
+	defer close(remote.term)
+
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Size > maxMessageSize {
+			msg.Discard()
+			return fmt.Errorf("message too large: %v > %v", msg.Size, maxMessageSize)
+		}
+		if msg.Code != consensusMsg {
+			msg.Discard()
+			return fmt.Errorf("invalid message code: %v", msg.Code)
+		}
+		var payload []byte
+		if err := msg.Decode(&payload); err != nil {
+			return fmt.Errorf("invalid message: %v", err)
+		}
+		// Deliver each message once only, the state machine relays it if needed
+		hash := crypto.Keccak256Hash(payload)
+		remote.markMessage(hash)
+
+		if e.messages.Contains(hash) {
+			continue
+		}
+		e.messages.Add(hash, struct{}{})
+		e.machine.deliver(payload)
+	}
+}
+
+// gossip sends a consensus message to all the peers not yet knowing about it.
+func (e *Engine) gossip(payload []byte) {
+	hash := crypto.Keccak256Hash(payload)
+	e.messages.Add(hash, struct{}{})
+
+	for _, p := range e.peers.all() {
+		p.send(hash, payload)
+	}
+}
+
+// regossip sends a consensus message to all the peers, even those which should
+// already know about it, to help validators which missed it catch up.
+func (e *Engine) regossip(payload []byte) {
+	hash := crypto.Keccak256Hash(payload)
+	e.messages.Add(hash, struct{}{})
+
+	for _, p := range e.peers.all() {
+		p.markMessage(hash)
+		p.queueMessage(payload)
+	}
+}
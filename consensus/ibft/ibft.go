@@ -0,0 +1,765 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ibft implements the Istanbul byzantine fault tolerant proof-of-authority
+// consensus engine, providing instant finality for permissioned networks.
+//
+// Blocks are agreed upon by a known set of validators in rounds of three phases
+// (pre-prepare, prepare and commit), exchanged over a dedicated p2p sub-protocol.
+// A block is final as soon as it carries the commit seals of a quorum of ceil(2N/3)
+// validators, tolerating up to floor((N-1)/3) byzantine ones.
+package ibft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/avalanria/go-avalanria/accounts"
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/common/hexutil"
+	"github.com/avalanria/go-avalanria/consensus"
+	"github.com/avalanria/go-avalanria/consensus/misc"
+	"github.com/avalanria/go-avalanria/core/state"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/event"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/params"
+	"github.com/avalanria/go-avalanria/rpc"
+	"github.com/avalanria/go-avalanria/trie"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	checkpointInterval = 1024 // Number of blocks after which to save the vote snapshot to the database
+	inmemorySnapshots  = 128  // Number of recent vote snapshots to keep in memory
+	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+	inmemoryMessages   = 4096 // Number of recent consensus messages to remember to avoid relaying twice
+
+	defaultRequestTimeout = 10 * time.Second // Timeout of the first consensus round if not configured
+)
+
+// IBFT protocol constants.
+var (
+	epochLength = uint64(30000) // Default number of blocks after which to checkpoint and reset the pending votes
+
+	extraVanity = 32 // Fixed number of extra-data prefix bytes reserved for proposer vanity
+
+	nonceAuthVote = hexutil.MustDecode("0xffffffffffffffff") // Magic nonce number to vote on adding a new validator
+	nonceDropVote = hexutil.MustDecode("0x0000000000000000") // Magic nonce number to vote on removing a validator.
+
+	uncleHash = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
+
+	defaultDifficulty = big.NewInt(1) // Block difficulty, constant as there are no forks to choose from
+)
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	// errUnknownBlock is returned when the list of validators is requested for a
+	// block that is not part of the local blockchain.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errInvalidCheckpointBeneficiary is returned if a checkpoint/epoch transition
+	// block has a beneficiary set to non-zeroes.
+	errInvalidCheckpointBeneficiary = errors.New("beneficiary in checkpoint block non-zero")
+
+	// errInvalidVote is returned if a nonce value is neither of the two allowed
+	// constants of 0x00..0 or 0xff..f.
+	errInvalidVote = errors.New("vote nonce not 0x00..0 or 0xff..f")
+
+	// errInvalidCheckpointVote is returned if a checkpoint/epoch transition block
+	// has a vote nonce set to non-zeroes.
+	errInvalidCheckpointVote = errors.New("vote nonce in checkpoint block non-zero")
+
+	// errMissingVanity is returned if a block's extra-data section is shorter than
+	// 32 bytes, which is required to store the proposer vanity.
+	errMissingVanity = errors.New("extra-data 32 byte vanity prefix missing")
+
+	// errInvalidExtraData is returned if the consensus data following the vanity
+	// in the extra-data section can't be decoded.
+	errInvalidExtraData = errors.New("invalid consensus data in extra-data")
+
+	// errExtraValidators is returned if non-checkpoint block contain validator data
+	// in their extra-data fields.
+	errExtraValidators = errors.New("non-checkpoint block contains extra validator list")
+
+	// errMismatchingCheckpointValidators is returned if a checkpoint block contains
+	// a list of validators different than the one the local node calculated.
+	errMismatchingCheckpointValidators = errors.New("mismatching validator list on checkpoint block")
+
+	// errInvalidMixDigest is returned if a block's mix digest is not the IBFT digest.
+	errInvalidMixDigest = errors.New("invalid mix digest")
+
+	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
+	errInvalidUncleHash = errors.New("non empty uncle hash")
+
+	// errInvalidDifficulty is returned if the difficulty of a block is not 1.
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	// errInvalidTimestamp is returned if the timestamp of a block is lower than
+	// the previous block's timestamp + the minimum block period.
+	errInvalidTimestamp = errors.New("invalid timestamp")
+
+	// errInvalidVotingChain is returned if an authorization list is attempted to
+	// be modified via out-of-range or non-contiguous headers.
+	errInvalidVotingChain = errors.New("invalid voting chain")
+
+	// errUnauthorizedProposer is returned if a header is proposed by a non-validator.
+	errUnauthorizedProposer = errors.New("unauthorized proposer")
+
+	// errInvalidCommittedSeals is returned if a committed seal is malformed, not
+	// signed by a validator or duplicated.
+	errInvalidCommittedSeals = errors.New("invalid committed seals")
+
+	// errInsufficientCommittedSeals is returned if a block is committed by fewer
+	// validators than needed for a quorum.
+	errInsufficientCommittedSeals = errors.New("insufficient committed seals")
+
+	// errInvalidPreparedSeals is returned if the certificate of a prepared proposal
+	// is malformed, signed by non-validators or falls short of a quorum.
+	errInvalidPreparedSeals = errors.New("invalid prepared seals")
+
+	// errInvalidMessage is returned if a consensus message has an unknown code.
+	errInvalidMessage = errors.New("invalid consensus message")
+
+	// errClosed is returned if the engine is accessed after it was closed.
+	errClosed = errors.New("ibft engine closed")
+)
+
+// SignerFn hashes and signs the data to be signed by a backing account.
+type SignerFn func(signer accounts.Account, mimeType string, message []byte) ([]byte, error)
+
+// ecrecover extracts the Avalanria account address of the proposer of a header.
+func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+	// If the signature's already cached, return that
+	hash := header.Hash()
+	if address, known := sigcache.Get(hash); known {
+		return address.(common.Address), nil
+	}
+	// Retrieve the signature from the header extra-data and recover the signer
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	signer, err := recoverAddress(IBFTRLP(header), extra.Seal)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sigcache.Add(hash, signer)
+	return signer, nil
+}
+
+// Engine is the Istanbul byzantine fault tolerant consensus engine.
+type Engine struct {
+	config *params.IBFTConfig // Consensus engine configuration parameters
+	db     avndb.Database     // Database to store and retrieve snapshot checkpoints
+
+	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
+	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
+	messages   *lru.ARCCache // Hashes of recently seen consensus messages
+
+	proposals map[common.Address]bool // Current list of proposals we are pushing
+
+	signer common.Address              // Avalanria address of the signing key
+	signFn SignerFn                    // Signer function to authorize hashes with
+	chain  consensus.ChainHeaderReader // Local chain the consensus rounds build on
+	lock   sync.RWMutex                // Protects the signer and chain fields
+
+	machine *stateMachine // Consensus state machine running the rounds
+	peers   *peerSet      // Peers connected through the consensus sub-protocol
+
+	committedFeed event.Feed
+	scope         event.SubscriptionScope
+}
+
+// New creates an IBFT consensus engine with the initial validators set to the
+// ones in the genesis block.
+func New(config *params.IBFTConfig, db avndb.Database) *Engine {
+	// Set any missing consensus parameters to their defaults
+	conf := *config
+	if conf.Epoch == 0 {
+		conf.Epoch = epochLength
+	}
+	if conf.RequestTimeout == 0 {
+		conf.RequestTimeout = uint64(defaultRequestTimeout / time.Millisecond)
+	}
+	// Allocate the caches and create the engine
+	recents, _ := lru.NewARC(inmemorySnapshots)
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	messages, _ := lru.NewARC(inmemoryMessages)
+
+	e := &Engine{
+		config:     &conf,
+		db:         db,
+		recents:    recents,
+		signatures: signatures,
+		messages:   messages,
+		proposals:  make(map[common.Address]bool),
+		peers:      newPeerSet(),
+	}
+	e.machine = newStateMachine(e)
+	return e
+}
+
+// Author implements consensus.Engine, returning the Avalanria address recovered
+// from the proposer seal in the header's extra-data section.
+func (e *Engine) Author(header *types.Header) (common.Address, error) {
+	return ecrecover(header, e.signatures)
+}
+
+// VerifyHeader checks a header against the consensus rules, including the commit
+// seals proving its finality if seal verification is requested.
+func (e *Engine) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	return e.verifyHeader(chain, header, nil, seal)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// returned quit channel aborts the operations and the results channel retrieves
+// the async verifications (the order is that of the input slice).
+func (e *Engine) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for i, header := range headers {
+			err := e.verifyHeader(chain, header, headers[:i], seals[i])
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+// verifyHeader checks a header against the consensus rules. The caller may
+// optionally pass in a batch of parents (ascending order) to avoid looking those
+// up from the database. Commit seals are only checked if requested, as they are
+// not yet present on proposals.
+func (e *Engine) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, committed bool) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	// Don't waste time checking blocks from the future
+	if header.Time > uint64(time.Now().Unix()) {
+		return consensus.ErrFutureBlock
+	}
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return err
+	}
+	// Checkpoint blocks need to enforce zero beneficiary
+	checkpoint := (number % e.config.Epoch) == 0
+	if checkpoint && header.Coinbase != (common.Address{}) {
+		return errInvalidCheckpointBeneficiary
+	}
+	// Nonces must be 0x00..0 or 0xff..f, zeroes enforced on checkpoints
+	if !bytes.Equal(header.Nonce[:], nonceAuthVote) && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidVote
+	}
+	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidCheckpointVote
+	}
+	// Ensure that the extra-data contains a validator list on checkpoint, but none otherwise
+	if !checkpoint && len(extra.Validators) != 0 {
+		return errExtraValidators
+	}
+	// Ensure that the mix digest identifies the block as an IBFT one
+	if header.MixDigest != MixDigest {
+		return errInvalidMixDigest
+	}
+	// Ensure that the block doesn't contain any uncles which are meaningless in BFT
+	if header.UncleHash != uncleHash {
+		return errInvalidUncleHash
+	}
+	// Ensure that the block's difficulty is the constant one
+	if number > 0 {
+		if header.Difficulty == nil || header.Difficulty.Cmp(defaultDifficulty) != 0 {
+			return errInvalidDifficulty
+		}
+	}
+	// Verify that the gas limit is <= 2^63-1
+	cap := uint64(0x7fffffffffffffff)
+	if header.GasLimit > cap {
+		return fmt.Errorf("invalid gasLimit: have %v, max %v", header.GasLimit, cap)
+	}
+	// If all checks passed, validate any special fields for hard forks
+	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
+		return err
+	}
+	// All basic checks passed, verify cascading fields
+	return e.verifyCascadingFields(chain, header, parents, extra, committed)
+}
+
+// verifyCascadingFields verifies all the header fields that are not standalone,
+// rather depend on a batch of previous headers. The caller may optionally pass
+// in a batch of parents (ascending order) to avoid looking those up from the
+// database. This is useful for concurrently verifying a batch of new headers.
+func (e *Engine) verifyCascadingFields(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, extra *Extra, committed bool) error {
+	// The genesis block is the always valid dead-end
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	// Ensure that the block's timestamp isn't too close to its parent
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	if parent.Time+e.config.Period > header.Time {
+		return errInvalidTimestamp
+	}
+	// Verify that the gasUsed is <= gasLimit
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("invalid gasUsed: have %d, gasLimit %d", header.GasUsed, header.GasLimit)
+	}
+	if !chain.Config().IsLondon(header.Number, header.Time) {
+		// Verify BaseFee not present before EIP-1559 fork.
+		if header.BaseFee != nil {
+			return fmt.Errorf("invalid baseFee before fork: have %d, want <nil>", header.BaseFee)
+		}
+		if err := misc.VerifyGaslimit(parent.GasLimit, header.GasLimit); err != nil {
+			return err
+		}
+	} else if err := misc.VerifyEip1559Header(chain.Config(), parent, header); err != nil {
+		// Verify the header's EIP-1559 attributes.
+		return err
+	}
+	// Retrieve the snapshot needed to verify this header and cache it
+	snap, err := e.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	// If the block is a checkpoint block, verify the validator list
+	if number%e.config.Epoch == 0 {
+		if len(extra.Validators) != len(snap.Validators) {
+			return errMismatchingCheckpointValidators
+		}
+		for i, validator := range snap.Validators {
+			if extra.Validators[i] != validator {
+				return errMismatchingCheckpointValidators
+			}
+		}
+	}
+	// Ensure the block was proposed by a validator
+	proposer, err := e.Author(header)
+	if err != nil {
+		return err
+	}
+	if !snap.Validators.contains(proposer) {
+		return errUnauthorizedProposer
+	}
+	// All basic checks passed, verify the finality proof if requested
+	if !committed {
+		return nil
+	}
+	return verifyCommittedSeals(header, extra, snap.Validators)
+}
+
+// verifyCommittedSeals checks that a header was committed by a quorum of
+// distinct validators.
+func verifyCommittedSeals(header *types.Header, extra *Extra, validators validatorSet) error {
+	var (
+		data   = commitData(ProposalHash(header))
+		signed = make(map[common.Address]struct{})
+	)
+	for _, seal := range extra.CommittedSeal {
+		signer, err := recoverAddress(data, seal)
+		if err != nil {
+			return errInvalidCommittedSeals
+		}
+		if _, ok := signed[signer]; ok || !validators.contains(signer) {
+			return errInvalidCommittedSeals
+		}
+		signed[signer] = struct{}{}
+	}
+	if len(signed) < validators.quorum() {
+		return errInsufficientCommittedSeals
+	}
+	return nil
+}
+
+// snapshot retrieves the authorization snapshot at a given point in time.
+func (e *Engine) snapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	// Search for a snapshot in memory or on disk for checkpoints
+	var (
+		headers []*types.Header
+		snap    *Snapshot
+	)
+	for snap == nil {
+		// If an in-memory snapshot was found, use that
+		if s, ok := e.recents.Get(hash); ok {
+			snap = s.(*Snapshot)
+			break
+		}
+		// If an on-disk checkpoint snapshot can be found, use that
+		if number%checkpointInterval == 0 {
+			if s, err := loadSnapshot(e.config, e.db, hash); err == nil {
+				log.Trace("Loaded voting snapshot from disk", "number", number, "hash", hash)
+				snap = s
+				break
+			}
+		}
+		// If we're at the genesis, snapshot the initial state. Alternatively if we're
+		// at a checkpoint block without a parent (light client CHT), or we have piled
+		// up more headers than allowed to be reorged (chain reinit from a freezer),
+		// consider the checkpoint trusted and snapshot it.
+		if number == 0 || (number%e.config.Epoch == 0 && (len(headers) > params.FullImmutabilityThreshold || chain.GetHeaderByNumber(number-1) == nil)) {
+			checkpoint := chain.GetHeaderByNumber(number)
+			if checkpoint != nil {
+				hash := checkpoint.Hash()
+
+				extra, err := ExtractExtra(checkpoint)
+				if err != nil {
+					return nil, err
+				}
+				snap = newSnapshot(e.config, number, hash, extra.Validators)
+				if err := snap.store(e.db); err != nil {
+					return nil, err
+				}
+				log.Info("Stored checkpoint snapshot to disk", "number", number, "hash", hash)
+				break
+			}
+		}
+		// No snapshot for this header, gather the header and move backward
+		var header *types.Header
+		if len(parents) > 0 {
+			// If we have explicit parents, pick from there (enforced)
+			header = parents[len(parents)-1]
+			if header.Hash() != hash || header.Number.Uint64() != number {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			parents = parents[:len(parents)-1]
+		} else {
+			// No explicit parents (or no more left), reach out to the database
+			header = chain.GetHeader(hash, number)
+			if header == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+	// Previous snapshot found, apply any pending headers on top of it
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers, e.Author)
+	if err != nil {
+		return nil, err
+	}
+	e.recents.Add(snap.Hash, snap)
+
+	// If we've generated a new checkpoint snapshot, save to disk
+	if snap.Number%checkpointInterval == 0 && len(headers) > 0 {
+		if err = snap.store(e.db); err != nil {
+			return nil, err
+		}
+		log.Trace("Stored voting snapshot to disk", "number", snap.Number, "hash", snap.Hash)
+	}
+	return snap, err
+}
+
+// VerifyUncles implements consensus.Engine, always returning an error for any
+// uncles as this consensus mechanism doesn't permit uncles.
+func (e *Engine) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	if len(block.Uncles()) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	return nil
+}
+
+// verifyProposal checks a block proposed for agreement. The commit seals are not
+// yet available at this point, nor is the state transition verified, which will
+// be done upon import.
+func (e *Engine) verifyProposal(block *types.Block) error {
+	chain := e.currentChain()
+	if chain == nil {
+		return errUnknownBlock
+	}
+	header := block.Header()
+	if err := e.verifyHeader(chain, header, nil, false); err != nil {
+		return err
+	}
+	if len(block.Uncles()) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != header.TxHash {
+		return fmt.Errorf("transaction root hash mismatch: have %x, want %x", hash, header.TxHash)
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, preparing all the consensus fields of the
+// header for running the transactions on top.
+func (e *Engine) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	// Start out without a validator vote, casting one below if any is pending
+	header.Coinbase = common.Address{}
+	header.Nonce = types.BlockNonce{}
+
+	number := header.Number.Uint64()
+	// Assemble the voting snapshot to check which votes make sense
+	snap, err := e.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	// Votes are only cast outside of checkpoints, picking any pending proposal
+	// which still makes sense for the current validator set
+	if number%e.config.Epoch != 0 {
+		e.lock.RLock()
+		for address, authorize := range e.proposals {
+			if snap.validVote(address, authorize) {
+				header.Coinbase = address
+				if authorize {
+					copy(header.Nonce[:], nonceAuthVote)
+				} else {
+					copy(header.Nonce[:], nonceDropVote)
+				}
+				break
+			}
+		}
+		e.lock.RUnlock()
+	}
+	// Set the constant difficulty
+	header.Difficulty = new(big.Int).Set(defaultDifficulty)
+
+	// Ensure the extra data has all its components
+	extra := new(Extra)
+	if number%e.config.Epoch == 0 {
+		extra.Validators = snap.Validators
+	}
+	if header.Extra, err = encodeExtra(header.Extra, extra); err != nil {
+		return err
+	}
+	// Mix digest identifies the block as an IBFT one
+	header.MixDigest = MixDigest
+
+	// Ensure the timestamp has the correct delay
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	header.Time = parent.Time + e.config.Period
+	if header.Time < uint64(time.Now().Unix()) {
+		header.Time = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+// Finalize implements consensus.Engine, ensuring no uncles are set, nor block
+// rewards given.
+func (e *Engine) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header) {
+	// No block rewards in BFT, so the state remains as is and uncles are dropped
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+	header.UncleHash = types.CalcUncleHash(nil)
+}
+
+// FinalizeAndAssemble implements consensus.Engine, ensuring no uncles are set,
+// nor block rewards given, and returns the final block.
+func (e *Engine) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	// Finalize block
+	e.Finalize(chain, header, state, txs, uncles)
+
+	// Assemble and return the final block for sealing
+	return types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil)), nil
+}
+
+// Authorize injects a private key into the consensus engine to propose and
+// commit new blocks with.
+func (e *Engine) Authorize(signer common.Address, signFn SignerFn) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.signer = signer
+	e.signFn = signFn
+}
+
+// address returns the address of the local signing key.
+func (e *Engine) address() common.Address {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.signer
+}
+
+// sign signs the keccak256 hash of the given data with the local signing key.
+func (e *Engine) sign(data []byte) ([]byte, error) {
+	e.lock.RLock()
+	signer, signFn := e.signer, e.signFn
+	e.lock.RUnlock()
+
+	if signFn == nil {
+		return nil, errors.New("no signer authorized")
+	}
+	return signFn(accounts.Account{Address: signer}, accounts.MimetypeIBFT, data)
+}
+
+// currentChain returns the local chain the consensus rounds build on, or nil if
+// no block was requested to be sealed yet.
+func (e *Engine) currentChain() consensus.ChainHeaderReader {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.chain
+}
+
+// requestTimeout returns the timeout of the first consensus round.
+func (e *Engine) requestTimeout() time.Duration {
+	return time.Duration(e.config.RequestTimeout) * time.Millisecond
+}
+
+// Seal implements consensus.Engine, signing the block as its proposer and asking
+// the validators to agree upon it. The block is delivered with its commit seals
+// once a quorum of validators committed to it, which only happens if the local
+// validator is the proposer of the winning round.
+func (e *Engine) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	header := block.Header()
+
+	// Sealing the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	// Don't hold the signer fields for the entire sealing procedure
+	e.lock.Lock()
+	signer, signFn := e.signer, e.signFn
+	e.chain = chain
+	e.lock.Unlock()
+
+	// Bail out if we're unauthorized to propose a block
+	snap, err := e.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if !snap.Validators.contains(signer) {
+		return errUnauthorizedProposer
+	}
+	// Sign the proposal, committed seals are added after agreement
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return err
+	}
+	if extra.Seal, err = signFn(accounts.Account{Address: signer}, accounts.MimetypeIBFT, IBFTRLP(header)); err != nil {
+		return err
+	}
+	if header.Extra, err = encodeExtra(header.Extra[:extraVanity], extra); err != nil {
+		return err
+	}
+	block = block.WithSeal(header)
+
+	// Wait until the block is due and start agreeing upon it
+	delay := time.Unix(int64(header.Time), 0).Sub(time.Now()) // nolint: gosimple
+	log.Trace("Waiting for slot to propose", "delay", common.PrettyDuration(delay))
+	go func() {
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+		e.machine.request(&request{block: block, results: results, stop: stop})
+	}()
+	return nil
+}
+
+// finalize assembles the final block from an agreed upon proposal and the commit
+// seals of the validators.
+func (e *Engine) finalize(proposal *types.Block, seals [][]byte) (*types.Block, error) {
+	header := proposal.Header()
+
+	extra, err := ExtractExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	extra.CommittedSeal = seals
+	if header.Extra, err = encodeExtra(header.Extra[:extraVanity], extra); err != nil {
+		return nil, err
+	}
+	return proposal.WithSeal(header), nil
+}
+
+// deliver hands a final block over to the local miner if it was the one requesting
+// it, or announces it to any subscribers otherwise.
+func (e *Engine) deliver(block *types.Block, req *request) {
+	if req != nil && req.block.Hash() == ProposalHash(block.Header()) {
+		select {
+		case <-req.stop:
+		case req.results <- block:
+			return
+		default:
+			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(block.Header()))
+		}
+	}
+	e.committedFeed.Send(block)
+}
+
+// SubscribeCommitted registers a subscription for blocks committed by a quorum
+// of validators which were not requested by the local miner. This allows importing
+// the final blocks without waiting for their propagation.
+func (e *Engine) SubscribeCommitted(ch chan<- *types.Block) event.Subscription {
+	return e.scope.Track(e.committedFeed.Subscribe(ch))
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm. It returns the constant
+// difficulty of IBFT blocks as there are no forks to choose from.
+func (e *Engine) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	return new(big.Int).Set(defaultDifficulty)
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func (e *Engine) SealHash(header *types.Header) common.Hash {
+	return SealHash(header)
+}
+
+// Close implements consensus.Engine, terminating the consensus state machine.
+func (e *Engine) Close() error {
+	e.machine.close()
+	e.scope.Close()
+	return nil
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC API to allow
+// controlling the validator voting and inspecting the consensus progress.
+func (e *Engine) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "ibft",
+		Version:   "1.0",
+		Service:   &API{chain: chain, ibft: e},
+		Public:    false,
+	}}
+}
+
+// GenesisExtra assembles the extra-data of a genesis block starting an IBFT chain
+// with the given validators.
+func GenesisExtra(validators []common.Address) ([]byte, error) {
+	snap := newSnapshot(nil, 0, common.Hash{}, validators)
+	return encodeExtra(nil, &Extra{Validators: snap.Validators})
+}
@@ -0,0 +1,621 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/accounts"
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/consensus/misc"
+	"github.com/avalanria/go-avalanria/core"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/core/vm"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/node"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/simulations"
+	"github.com/avalanria/go-avalanria/p2p/simulations/adapters"
+	"github.com/avalanria/go-avalanria/params"
+	"github.com/avalanria/go-avalanria/rlp"
+	mapset "github.com/deckarep/golang-set"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// Tests that the proposal hash doesn't depend on the set of commit seals, but does
+// on the proposer seal, whereas the block hash covers both.
+func TestCommittedSealHashing(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+	)
+	extra, err := encodeExtra(nil, &Extra{Validators: []common.Address{addr}})
+	if err != nil {
+		t.Fatalf("failed to encode extra-data: %v", err)
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1), MixDigest: MixDigest, Extra: extra}
+	sealHash := SealHash(header)
+
+	sig, _ := crypto.Sign(crypto.Keccak256(IBFTRLP(header)), key)
+	parsed, _ := ExtractExtra(header)
+	parsed.Seal = sig
+	header.Extra, _ = encodeExtra(header.Extra[:extraVanity], parsed)
+
+	if SealHash(header) != sealHash {
+		t.Fatalf("seal hash changed by proposer seal")
+	}
+	if ProposalHash(header) == sealHash {
+		t.Fatalf("proposal hash doesn't cover proposer seal")
+	}
+	if ProposalHash(header) != header.Hash() {
+		t.Fatalf("proposal hash differs from unsealed block hash")
+	}
+	sigcache, _ := lru.NewARC(inmemorySignatures)
+	signer, err := ecrecover(header, sigcache)
+	if err != nil || signer != addr {
+		t.Fatalf("proposer mismatch: have %x, want %x, err %v", signer, addr, err)
+	}
+	proposal, hash := ProposalHash(header), header.Hash()
+
+	seal, _ := crypto.Sign(crypto.Keccak256(commitData(proposal)), key)
+	parsed.CommittedSeal = [][]byte{seal}
+	header.Extra, _ = encodeExtra(header.Extra[:extraVanity], parsed)
+
+	if ProposalHash(header) != proposal {
+		t.Fatalf("proposal hash changed by commit seals")
+	}
+	if header.Hash() == hash {
+		t.Fatalf("block hash doesn't cover commit seals")
+	}
+	if err := verifyCommittedSeals(header, parsed, validatorSet{addr}); err != nil {
+		t.Fatalf("failed to verify commit seals: %v", err)
+	}
+	parsed.CommittedSeal = append(parsed.CommittedSeal, seal)
+	if err := verifyCommittedSeals(header, parsed, validatorSet{addr}); err != errInvalidCommittedSeals {
+		t.Fatalf("duplicate commit seal error mismatch: have %v, want %v", err, errInvalidCommittedSeals)
+	}
+}
+
+// Tests the quorum and proposer rotation rules of the validator set.
+func TestValidatorSet(t *testing.T) {
+	tests := []struct {
+		validators int
+		faulty     int
+		quorum     int
+	}{
+		{1, 0, 1}, {2, 0, 2}, {3, 0, 2}, {4, 1, 3}, {5, 1, 4}, {6, 1, 4}, {7, 2, 5}, {10, 3, 7},
+	}
+	for _, tt := range tests {
+		set := make(validatorSet, tt.validators)
+		if faulty := set.faulty(); faulty != tt.faulty {
+			t.Errorf("validators %d: faulty mismatch: have %d, want %d", tt.validators, faulty, tt.faulty)
+		}
+		if quorum := set.quorum(); quorum != tt.quorum {
+			t.Errorf("validators %d: quorum mismatch: have %d, want %d", tt.validators, quorum, tt.quorum)
+		}
+	}
+	set := validatorSet{common.Address{1}, common.Address{2}, common.Address{3}}
+	for round, want := range []common.Address{{3}, {1}, {2}, {3}} {
+		if have := set.proposer(common.Address{2}, uint64(round)); have != want {
+			t.Errorf("round %d: proposer mismatch: have %x, want %x", round, have, want)
+		}
+	}
+	if have := set.proposer(common.Address{9}, 0); have != set[0] {
+		t.Errorf("unknown last proposer: proposer mismatch: have %x, want %x", have, set[0])
+	}
+}
+
+// testValidator is a minimal node lifecycle running an IBFT validator, proposing
+// empty blocks on top of its local chain.
+type testValidator struct {
+	key    *ecdsa.PrivateKey
+	engine *Engine
+	chain  *core.BlockChain
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newTestValidator(genesis *core.Genesis, key *ecdsa.PrivateKey) (*testValidator, error) {
+	db := rawdb.NewMemoryDatabase()
+	genesis.MustCommit(db)
+
+	engine := New(genesis.Config.IBFT, db)
+	engine.Authorize(crypto.PubkeyToAddress(key.PublicKey), func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), key)
+	})
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &testValidator{key: key, engine: engine, chain: chain, quit: make(chan struct{})}, nil
+}
+
+func (v *testValidator) Start() error {
+	v.wg.Add(1)
+	go v.loop()
+	return nil
+}
+
+func (v *testValidator) Stop() error {
+	close(v.quit)
+	v.wg.Wait()
+	v.engine.Close()
+	v.chain.Stop()
+	return nil
+}
+
+// loop proposes a new block on every chain head and imports the committed ones.
+func (v *testValidator) loop() {
+	defer v.wg.Done()
+
+	var (
+		headCh      = make(chan core.ChainHeadEvent, 16)
+		committedCh = make(chan *types.Block, 16)
+		resultCh    = make(chan *types.Block, 1)
+		stop        chan struct{}
+	)
+	headSub := v.chain.SubscribeChainHeadEvent(headCh)
+	defer headSub.Unsubscribe()
+	committedSub := v.engine.SubscribeCommitted(committedCh)
+	defer committedSub.Unsubscribe()
+
+	propose := func(parent *types.Block) {
+		if stop != nil {
+			close(stop)
+		}
+		stop = make(chan struct{})
+
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   parent.GasLimit(),
+		}
+		if v.chain.Config().IsLondon(header.Number, header.Time) {
+			header.BaseFee = misc.CalcBaseFee(v.chain.Config(), parent.Header())
+		}
+		if err := v.engine.Prepare(v.chain, header); err != nil {
+			panic(err)
+		}
+		statedb, err := v.chain.StateAt(parent.Root())
+		if err != nil {
+			panic(err)
+		}
+		block, err := v.engine.FinalizeAndAssemble(v.chain, header, statedb, nil, nil, nil)
+		if err != nil {
+			panic(err)
+		}
+		if err := v.engine.Seal(v.chain, block, resultCh, stop); err != nil {
+			panic(err)
+		}
+	}
+	propose(v.chain.CurrentBlock())
+
+	for {
+		select {
+		case ev := <-headCh:
+			propose(ev.Block)
+		case block := <-resultCh:
+			v.chain.InsertChain(types.Blocks{block})
+		case block := <-committedCh:
+			v.chain.InsertChain(types.Blocks{block})
+		case <-v.quit:
+			if stop != nil {
+				close(stop)
+			}
+			return
+		}
+	}
+}
+
+// Tests that a network of validators agrees on new blocks and keeps doing so
+// with a faulty validator, relying on round changes to skip its turns.
+func TestSimulatedAgreement(t *testing.T) {
+	const validators = 4
+
+	// Generate the node keys up front to set up the genesis validators
+	var (
+		configs = make([]*adapters.NodeConfig, validators)
+		addrs   = make([]common.Address, validators)
+	)
+	for i := range configs {
+		configs[i] = adapters.RandomNodeConfig()
+		configs[i].Lifecycles = []string{"ibft"}
+		addrs[i] = crypto.PubkeyToAddress(configs[i].PrivateKey.PublicKey)
+	}
+	extra, err := GenesisExtra(addrs)
+	if err != nil {
+		t.Fatalf("failed to create genesis extra-data: %v", err)
+	}
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = nil
+	config.IBFT = &params.IBFTConfig{Epoch: 30000, RequestTimeout: 250}
+
+	genesis := &core.Genesis{
+		Config:    &config,
+		ExtraData: extra,
+		GasLimit:  params.GenesisGasLimit,
+		BaseFee:   big.NewInt(params.InitialBaseFee),
+	}
+	// Create the simulated network of validators and connect them fully
+	var (
+		lock  sync.Mutex
+		nodes = make(map[enode.ID]*testValidator)
+	)
+	adapter := adapters.NewSimAdapter(adapters.LifecycleConstructors{
+		"ibft": func(ctx *adapters.ServiceContext, stack *node.Node) (node.Lifecycle, error) {
+			validator, err := newTestValidator(genesis, ctx.Config.PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			stack.RegisterProtocols(validator.engine.Protocols())
+			stack.RegisterLifecycle(validator)
+
+			lock.Lock()
+			nodes[ctx.Config.ID] = validator
+			lock.Unlock()
+			return validator, nil
+		},
+	})
+	network := simulations.NewNetwork(adapter, &simulations.NetworkConfig{DefaultService: "ibft"})
+	defer network.Shutdown()
+
+	ids := make([]enode.ID, validators)
+	for i, config := range configs {
+		node, err := network.NewNodeWithConfig(config)
+		if err != nil {
+			t.Fatalf("failed to create node %d: %v", i, err)
+		}
+		if err := network.Start(node.ID()); err != nil {
+			t.Fatalf("failed to start node %d: %v", i, err)
+		}
+		ids[i] = node.ID()
+	}
+	if err := network.ConnectNodesFull(ids); err != nil {
+		t.Fatalf("failed to connect nodes: %v", err)
+	}
+	// waitHeight waits until all the given validators reached the given height on
+	// the same chain.
+	waitHeight := func(ids []enode.ID, height uint64) {
+		deadline := time.Now().Add(30 * time.Second)
+		for time.Now().Before(deadline) {
+			lock.Lock()
+			var hashes []common.Hash
+			for _, id := range ids {
+				if header := nodes[id].chain.GetHeaderByNumber(height); header != nil {
+					hashes = append(hashes, header.Hash())
+				}
+			}
+			lock.Unlock()
+
+			if len(hashes) == len(ids) {
+				for i, hash := range hashes {
+					if hash != hashes[0] {
+						t.Fatalf("validator %d: block %d mismatch: have %x, want %x", i, height, hash, hashes[0])
+					}
+				}
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for block %d", height)
+	}
+	waitHeight(ids, 3)
+
+	// Stop a validator and ensure the others skip past its turns
+	if err := network.Stop(ids[0]); err != nil {
+		t.Fatalf("failed to stop node: %v", err)
+	}
+	lock.Lock()
+	head := nodes[ids[1]].chain.CurrentHeader().Number.Uint64()
+	lock.Unlock()
+
+	waitHeight(ids[1:], head+validators+1)
+
+	// Check that every block is final, carrying a quorum of commit seals
+	lock.Lock()
+	defer lock.Unlock()
+
+	chain := nodes[ids[1]].chain
+	for number := uint64(1); number <= chain.CurrentHeader().Number.Uint64(); number++ {
+		header := chain.GetHeaderByNumber(number)
+		extra, err := ExtractExtra(header)
+		if err != nil {
+			t.Fatalf("block %d: failed to decode extra-data: %v", number, err)
+		}
+		if err := verifyCommittedSeals(header, extra, validatorSet(addrs)); err != nil {
+			t.Fatalf("block %d: invalid commit seals: %v", number, err)
+		}
+	}
+}
+
+// Tests that a validator locked on a proposal carries it over to the next round
+// along with the prepares certifying it, and re-proposes it when in charge.
+func TestRoundChangeWithLock(t *testing.T) {
+	const validators = 4
+
+	// Generate the validator keys, ordered the same way as the validator set
+	keys := make([]*ecdsa.PrivateKey, validators)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(crypto.PubkeyToAddress(keys[i].PublicKey).Bytes(), crypto.PubkeyToAddress(keys[j].PublicKey).Bytes()) < 0
+	})
+	addrs := make([]common.Address, validators)
+	for i, key := range keys {
+		addrs[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	extra, err := GenesisExtra(addrs)
+	if err != nil {
+		t.Fatalf("failed to create genesis extra-data: %v", err)
+	}
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = nil
+	config.IBFT = &params.IBFTConfig{Epoch: 30000, RequestTimeout: 100}
+
+	genesis := &core.Genesis{
+		Config:    &config,
+		ExtraData: extra,
+		GasLimit:  params.GenesisGasLimit,
+		BaseFee:   big.NewInt(params.InitialBaseFee),
+	}
+	// Run the second validator, the proposer of round 1, collecting its messages
+	v, err := newTestValidator(genesis, keys[1])
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+	defer v.chain.Stop()
+	defer v.engine.Close()
+
+	sink := &peer{id: "sink", known: mapset.NewSet(), queue: make(chan []byte, maxQueuedMessages)}
+	if err := v.engine.peers.register(sink); err != nil {
+		t.Fatalf("failed to register sink peer: %v", err)
+	}
+	v.engine.lock.Lock()
+	v.engine.chain = v.chain
+	v.engine.lock.Unlock()
+
+	send := func(key *ecdsa.PrivateKey, msg *message) {
+		msg.Sequence = 1
+		msg.Signature, _ = crypto.Sign(crypto.Keccak256(msg.signingData()), key)
+		payload, _ := rlp.EncodeToBytes(msg)
+		v.engine.machine.deliver(payload)
+	}
+	wait := func(code uint64, round uint64) *message {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case payload := <-sink.queue:
+				msg, err := decodeMessage(payload)
+				if err != nil {
+					t.Fatalf("failed to decode sent message: %v", err)
+				}
+				if msg.sender == addrs[1] && msg.Code == code && msg.Round == round {
+					return msg
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for message %d of round %d", code, round)
+			}
+		}
+	}
+	// Have a quorum prepare a proposal of the first validator, but never commit
+	proposal := newTestProposal(t, v, keys[0])
+	blob, _ := rlp.EncodeToBytes(proposal)
+
+	send(keys[0], &message{Code: msgPreprepare, Digest: proposal.Hash(), Proposal: blob})
+	for _, i := range []int{0, 2, 3} {
+		send(keys[i], &message{Code: msgPrepare, Digest: proposal.Hash()})
+	}
+	wait(msgCommit, 0)
+
+	if status, _ := v.engine.machine.status(); status.Locked == nil || *status.Locked != proposal.Hash() {
+		t.Fatalf("lock mismatch: have %v, want %x", status.Locked, proposal.Hash())
+	}
+	// Wait for the round to time out and check the lock is carried over
+	change := wait(msgRoundChange, 1)
+	if change.Digest != proposal.Hash() || !bytes.Equal(change.Proposal, blob) || change.PreparedRound != 0 {
+		t.Fatalf("round change lock mismatch: have %x in round %d, want %x in round 0", change.Digest, change.PreparedRound, proposal.Hash())
+	}
+	if err := verifyPrepared(change, proposal.Hash(), validatorSet(addrs)); err != nil {
+		t.Fatalf("invalid round change certificate: %v", err)
+	}
+	// Move to the next round and check that the locked proposal is re-proposed
+	for _, i := range []int{2, 3} {
+		send(keys[i], &message{Code: msgRoundChange, Round: 1})
+	}
+	preprepare := wait(msgPreprepare, 1)
+	if preprepare.Digest != proposal.Hash() || preprepare.PreparedRound != 0 {
+		t.Fatalf("re-proposal mismatch: have %x in round %d, want %x in round 0", preprepare.Digest, preprepare.PreparedRound, proposal.Hash())
+	}
+	if err := verifyPrepared(preprepare, proposal.Hash(), validatorSet(addrs)); err != nil {
+		t.Fatalf("invalid re-proposal certificate: %v", err)
+	}
+}
+
+// Tests that a validator which delivered the final block of a sequence hands it
+// over to validators still requesting round changes in it, rather than letting
+// them agree on the block again with a different set of commit seals.
+func TestFinalBlockRebroadcast(t *testing.T) {
+	const validators = 4
+
+	// Generate the validator keys, ordered the same way as the validator set
+	keys := make([]*ecdsa.PrivateKey, validators)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(crypto.PubkeyToAddress(keys[i].PublicKey).Bytes(), crypto.PubkeyToAddress(keys[j].PublicKey).Bytes()) < 0
+	})
+	addrs := make([]common.Address, validators)
+	for i, key := range keys {
+		addrs[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	extra, err := GenesisExtra(addrs)
+	if err != nil {
+		t.Fatalf("failed to create genesis extra-data: %v", err)
+	}
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = nil
+	config.IBFT = &params.IBFTConfig{Epoch: 30000, RequestTimeout: 60000}
+
+	genesis := &core.Genesis{
+		Config:    &config,
+		ExtraData: extra,
+		GasLimit:  params.GenesisGasLimit,
+		BaseFee:   big.NewInt(params.InitialBaseFee),
+	}
+	v, err := newTestValidator(genesis, keys[1])
+	if err != nil {
+		t.Fatalf("failed to create validator: %v", err)
+	}
+	defer v.chain.Stop()
+	defer v.engine.Close()
+
+	sink := &peer{id: "sink", known: mapset.NewSet(), queue: make(chan []byte, maxQueuedMessages)}
+	if err := v.engine.peers.register(sink); err != nil {
+		t.Fatalf("failed to register sink peer: %v", err)
+	}
+	v.engine.lock.Lock()
+	v.engine.chain = v.chain
+	v.engine.lock.Unlock()
+
+	committedCh := make(chan *types.Block, 1)
+	sub := v.engine.SubscribeCommitted(committedCh)
+	defer sub.Unsubscribe()
+
+	send := func(key *ecdsa.PrivateKey, msg *message) {
+		msg.Sequence = 1
+		msg.Signature, _ = crypto.Sign(crypto.Keccak256(msg.signingData()), key)
+		payload, _ := rlp.EncodeToBytes(msg)
+		v.engine.machine.deliver(payload)
+	}
+	waitFinal := func(hash common.Hash) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case payload := <-sink.queue:
+				msg, err := decodeMessage(payload)
+				if err != nil {
+					t.Fatalf("failed to decode sent message: %v", err)
+				}
+				if msg.Code == msgFinal && msg.sender == addrs[0] {
+					if block, _ := msg.block(); block == nil || block.Hash() != hash {
+						t.Fatalf("final block mismatch: have %v, want %x", block, hash)
+					}
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for final block")
+			}
+		}
+	}
+	// Finalize a proposal of the first validator and import it
+	proposal := newTestProposal(t, v, keys[0])
+	digest := ProposalHash(proposal.Header())
+
+	var seals [][]byte
+	for _, i := range []int{0, 2, 3} {
+		seal, _ := crypto.Sign(crypto.Keccak256(commitData(digest)), keys[i])
+		seals = append(seals, seal)
+	}
+	final, err := v.engine.finalize(proposal, seals)
+	if err != nil {
+		t.Fatalf("failed to assemble final block: %v", err)
+	}
+	blob, _ := rlp.EncodeToBytes(final)
+	send(keys[0], &message{Code: msgFinal, Digest: digest, Proposal: blob})
+
+	select {
+	case block := <-committedCh:
+		if _, err := v.chain.InsertChain(types.Blocks{block}); err != nil {
+			t.Fatalf("failed to import final block: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for final block delivery")
+	}
+	waitFinal(final.Hash())
+
+	// Request a round change in the finalized sequence, as a validator missing the
+	// final block would, and check that the original block is sent again
+	send(keys[2], &message{Code: msgRoundChange, Round: 1})
+	waitFinal(final.Hash())
+}
+
+// Tests that the backlog of future messages is capped per sender, so a single
+// validator can't push the messages of the others out of it.
+func TestBacklogSenderCap(t *testing.T) {
+	var (
+		c     = new(stateMachine)
+		noisy = common.Address{0x01}
+		quiet = common.Address{0x02}
+	)
+	c.store(&message{Sequence: 2, sender: quiet})
+	for i := 0; i < maxBacklog; i++ {
+		c.store(&message{Sequence: 2, Round: uint64(i), sender: noisy})
+	}
+	var noisyCount, quietCount int
+	for _, msg := range c.backlog {
+		switch msg.sender {
+		case noisy:
+			noisyCount++
+		case quiet:
+			quietCount++
+		}
+	}
+	if noisyCount != maxBacklogPerSender || quietCount != 1 {
+		t.Fatalf("backlog mismatch: have %d/%d noisy/quiet messages, want %d/1", noisyCount, quietCount, maxBacklogPerSender)
+	}
+	if last := c.backlog[len(c.backlog)-1]; last.Round != maxBacklog-1 {
+		t.Fatalf("latest message dropped: have round %d, want %d", last.Round, maxBacklog-1)
+	}
+}
+
+// newTestProposal creates an empty block on top of the validator's chain head,
+// sealed by the given proposer.
+func newTestProposal(t *testing.T, v *testValidator, key *ecdsa.PrivateKey) *types.Block {
+	parent := v.chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		BaseFee:    misc.CalcBaseFee(v.chain.Config(), parent.Header()),
+	}
+	if err := v.engine.Prepare(v.chain, header); err != nil {
+		t.Fatalf("failed to prepare proposal: %v", err)
+	}
+	statedb, err := v.chain.StateAt(parent.Root())
+	if err != nil {
+		t.Fatalf("failed to retrieve parent state: %v", err)
+	}
+	block, err := v.engine.FinalizeAndAssemble(v.chain, header, statedb, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to assemble proposal: %v", err)
+	}
+	header = block.Header()
+	extra, _ := ExtractExtra(header)
+	extra.Seal, _ = crypto.Sign(crypto.Keccak256(IBFTRLP(header)), key)
+	header.Extra, _ = encodeExtra(header.Extra[:extraVanity], extra)
+	return block.WithSeal(header)
+}
@@ -0,0 +1,744 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"sync"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/rlp"
+)
+
+const (
+	maxBacklog          = 1024 // Maximum number of future consensus messages to keep around
+	maxBacklogPerSender = 64   // Maximum number of future consensus messages to keep per validator
+	maxFinals           = 16   // Maximum number of recent final blocks to keep for lagging validators
+	maxTimeoutShift     = 8    // Maximum exponent of the round timeout backoff
+)
+
+// roundState is the progress of the local validator within a consensus round.
+type roundState uint8
+
+const (
+	stateAcceptRequest roundState = iota // Waiting for the proposal of the round
+	statePreprepared                     // Proposal accepted, collecting prepares
+	statePrepared                        // Quorum of prepares seen, collecting commits
+	stateCommitted                       // Quorum of commits seen, waiting for the final block
+)
+
+// String implements fmt.Stringer.
+func (s roundState) String() string {
+	switch s {
+	case stateAcceptRequest:
+		return "AcceptRequest"
+	case statePreprepared:
+		return "Preprepared"
+	case statePrepared:
+		return "Prepared"
+	case stateCommitted:
+		return "Committed"
+	default:
+		return "Unknown"
+	}
+}
+
+// Status is a summary of the local consensus progress.
+type Status struct {
+	Sequence  uint64         `json:"sequence"`  // Block number being agreed upon
+	Round     uint64         `json:"round"`     // Current consensus round
+	State     string         `json:"state"`     // Progress within the current round
+	Proposer  common.Address `json:"proposer"`  // Proposer of the current round
+	Validator bool           `json:"validator"` // Indicates if the local node is a validator
+	Locked    *common.Hash   `json:"locked"`    // Proposal locked on, if any
+	Prepares  int            `json:"prepares"`  // Number of prepares received in the current round
+	Commits   int            `json:"commits"`   // Number of commits received in the current round
+}
+
+// finalized is the final block of a recent sequence, kept around to hand it to
+// validators which missed it instead of them agreeing on it again.
+type finalized struct {
+	msg      *message // Final block message as assembled by the proposer
+	answered uint64   // Latest round change answered with the final block
+}
+
+// request is a block the local miner asks the validators to agree upon.
+type request struct {
+	block   *types.Block
+	results chan<- *types.Block
+	stop    <-chan struct{}
+}
+
+// stateMachine is the IBFT consensus state machine, running the rounds of agreement on
+// the next block of the chain from a single goroutine.
+type stateMachine struct {
+	engine *Engine
+
+	parent     *types.Header  // Chain head the current sequence builds on
+	validators validatorSet   // Validator set of the current sequence
+	last       common.Address // Proposer of the parent block
+	sequence   uint64         // Block number being agreed upon
+	round      uint64         // Current consensus round
+	target     uint64         // Round we've requested to change to
+	state      roundState     // Progress within the current round
+
+	proposal  *types.Block                           // Proposal accepted in the current round
+	prepares  map[common.Address]*message            // Prepares received in the current round
+	commits   map[common.Address]*message            // Commits received in the current round
+	locked    *types.Block                           // Proposal locked on within the sequence
+	lockRound uint64                                 // Round the locked proposal was prepared in
+	lockSeals [][]byte                               // Prepares certifying the locked proposal, if gathered
+	changes   map[uint64]map[common.Address]struct{} // Round change requests for future rounds
+	final     bool                                   // Whether the final block of the sequence was delivered
+	finals    map[uint64]*finalized                  // Final blocks of recent sequences
+
+	pending *request   // Latest block requested by the local miner
+	backlog []*message // Messages of future sequences or rounds
+	outbox  []*message // Own messages waiting to be processed locally
+
+	timer   *time.Timer // Timeout of the current round or round change
+	timerID uint64      // Identifier of the live timer to ignore stale timeouts
+
+	requestCh chan *request
+	messageCh chan []byte
+	timeoutCh chan uint64
+	statusCh  chan chan *Status
+	quit      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// newStateMachine creates the consensus state machine and starts its event loop.
+func newStateMachine(engine *Engine) *stateMachine {
+	c := &stateMachine{
+		engine:    engine,
+		prepares:  make(map[common.Address]*message),
+		commits:   make(map[common.Address]*message),
+		changes:   make(map[uint64]map[common.Address]struct{}),
+		finals:    make(map[uint64]*finalized),
+		requestCh: make(chan *request),
+		messageCh: make(chan []byte, 256),
+		timeoutCh: make(chan uint64),
+		statusCh:  make(chan chan *Status),
+		quit:      make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.loop()
+	return c
+}
+
+// close terminates the event loop.
+func (c *stateMachine) close() {
+	close(c.quit)
+	c.wg.Wait()
+}
+
+// request schedules a block for agreement.
+func (c *stateMachine) request(req *request) {
+	select {
+	case c.requestCh <- req:
+	case <-c.quit:
+	}
+}
+
+// deliver schedules a consensus message received from the network for processing.
+func (c *stateMachine) deliver(payload []byte) {
+	select {
+	case c.messageCh <- payload:
+	case <-c.quit:
+	}
+}
+
+// status retrieves a summary of the local consensus progress.
+func (c *stateMachine) status() (*Status, error) {
+	ch := make(chan *Status, 1)
+	select {
+	case c.statusCh <- ch:
+		return <-ch, nil
+	case <-c.quit:
+		return nil, errClosed
+	}
+}
+
+// loop is the event loop of the state machine.
+func (c *stateMachine) loop() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case req := <-c.requestCh:
+			c.handleRequest(req)
+
+		case payload := <-c.messageCh:
+			c.handlePayload(payload)
+
+		case id := <-c.timeoutCh:
+			c.handleTimeout(id)
+
+		case ch := <-c.statusCh:
+			ch <- c.summary()
+
+		case <-c.quit:
+			if c.timer != nil {
+				c.timer.Stop()
+			}
+			return
+		}
+		// Process any messages the above event made us send
+		for len(c.outbox) > 0 {
+			msg := c.outbox[0]
+			c.outbox = c.outbox[1:]
+			c.handleMessage(msg)
+		}
+	}
+}
+
+// summary assembles the status of the state machine.
+func (c *stateMachine) summary() *Status {
+	status := &Status{
+		Sequence:  c.sequence,
+		Round:     c.round,
+		State:     c.state.String(),
+		Proposer:  c.validators.proposer(c.last, c.round),
+		Validator: c.validators.contains(c.engine.address()),
+		Prepares:  len(c.prepares),
+		Commits:   len(c.commits),
+	}
+	if c.locked != nil {
+		hash := c.locked.Hash()
+		status.Locked = &hash
+	}
+	return status
+}
+
+// sync starts a new sequence if the local chain advanced past the current one.
+func (c *stateMachine) sync() {
+	chain := c.engine.currentChain()
+	if chain == nil {
+		return
+	}
+	head := chain.CurrentHeader()
+	if c.parent != nil && head.Number.Uint64() < c.sequence {
+		return
+	}
+	number := head.Number.Uint64()
+
+	snap, err := c.engine.snapshot(chain, number, head.Hash(), nil)
+	if err != nil {
+		log.Warn("Failed to retrieve IBFT validators", "number", number, "hash", head.Hash(), "err", err)
+		return
+	}
+	var last common.Address
+	if number > 0 {
+		if last, err = c.engine.Author(head); err != nil {
+			log.Warn("Failed to retrieve IBFT proposer", "number", number, "hash", head.Hash(), "err", err)
+			return
+		}
+	}
+	c.parent, c.validators, c.last = head, snap.Validators, last
+	c.sequence = number + 1
+	c.locked, c.lockRound, c.lockSeals = nil, 0, nil
+	c.final = false
+	c.changes = make(map[uint64]map[common.Address]struct{})
+
+	for sequence := range c.finals {
+		if sequence+maxFinals < c.sequence {
+			delete(c.finals, sequence)
+		}
+	}
+	if c.pending != nil && c.pending.block.NumberU64() < c.sequence {
+		c.pending = nil
+	}
+	c.startRound(0)
+}
+
+// startRound resets the state machine to the beginning of the given round.
+func (c *stateMachine) startRound(round uint64) {
+	c.round, c.target = round, round
+	c.state = stateAcceptRequest
+	c.proposal = nil
+	c.prepares = make(map[common.Address]*message)
+	c.commits = make(map[common.Address]*message)
+
+	for r := range c.changes {
+		if r <= round {
+			delete(c.changes, r)
+		}
+	}
+	c.resetTimer(round)
+	log.Debug("Started IBFT round", "sequence", c.sequence, "round", round, "proposer", c.validators.proposer(c.last, round))
+
+	c.propose()
+
+	// Process any messages that arrived before we reached this round
+	backlog := c.backlog
+	c.backlog = nil
+	for _, msg := range backlog {
+		c.handleMessage(msg)
+	}
+}
+
+// resetTimer restarts the timeout of the current round, backing off exponentially
+// in later rounds.
+func (c *stateMachine) resetTimer(round uint64) {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if round > maxTimeoutShift {
+		round = maxTimeoutShift
+	}
+	c.timerID++
+	id := c.timerID
+
+	c.timer = time.AfterFunc(c.engine.requestTimeout()<<round, func() {
+		select {
+		case c.timeoutCh <- id:
+		case <-c.quit:
+		}
+	})
+}
+
+// broadcast signs a consensus message, sends it to the network and queues it up
+// for local processing.
+func (c *stateMachine) broadcast(msg *message) {
+	if !c.validators.contains(c.engine.address()) {
+		return
+	}
+	sig, err := c.engine.sign(msg.signingData())
+	if err != nil {
+		log.Error("Failed to sign IBFT message", "err", err)
+		return
+	}
+	msg.Signature, msg.sender = sig, c.engine.address()
+
+	payload, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		log.Error("Failed to encode IBFT message", "err", err)
+		return
+	}
+	c.engine.gossip(payload)
+	c.outbox = append(c.outbox, msg)
+}
+
+// store adds a message of a future sequence or round to the backlog. Each sender
+// is capped separately, so a single validator can't push out the others.
+func (c *stateMachine) store(msg *message) {
+	var (
+		count  int
+		oldest = -1
+	)
+	for i, queued := range c.backlog {
+		if queued.sender == msg.sender {
+			if oldest < 0 {
+				oldest = i
+			}
+			count++
+		}
+	}
+	switch {
+	case count >= maxBacklogPerSender:
+		c.backlog = append(c.backlog[:oldest], c.backlog[oldest+1:]...)
+	case len(c.backlog) >= maxBacklog:
+		c.backlog = c.backlog[1:]
+	}
+	c.backlog = append(c.backlog, msg)
+}
+
+// propose broadcasts the proposal of the current round if the local validator is
+// in charge of it and has something to propose.
+func (c *stateMachine) propose() {
+	if c.state != stateAcceptRequest || c.validators.proposer(c.last, c.round) != c.engine.address() {
+		return
+	}
+	// Locked proposals take precedence over fresh requests
+	block := c.locked
+	if block == nil {
+		if c.pending == nil || c.pending.block.NumberU64() != c.sequence || c.pending.block.ParentHash() != c.parent.Hash() {
+			return
+		}
+		block = c.pending.block
+	}
+	blob, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		log.Error("Failed to encode IBFT proposal", "err", err)
+		return
+	}
+	msg := &message{Code: msgPreprepare, Sequence: c.sequence, Round: c.round, Digest: block.Hash(), Proposal: blob}
+
+	// Locked proposals carry their certificate to unlock validators locked on older ones
+	if block == c.locked && c.lockSeals != nil {
+		msg.PreparedRound, msg.PreparedSeals = c.lockRound, c.lockSeals
+	}
+	log.Debug("Proposing IBFT block", "sequence", c.sequence, "round", c.round, "hash", block.Hash())
+	c.broadcast(msg)
+}
+
+// handleRequest processes a block the local miner wants agreed upon.
+func (c *stateMachine) handleRequest(req *request) {
+	c.sync()
+	if req.block.NumberU64() != c.sequence {
+		log.Debug("Dropping stale IBFT request", "number", req.block.NumberU64(), "sequence", c.sequence)
+		return
+	}
+	c.pending = req
+	c.propose()
+}
+
+// handlePayload processes a consensus message received from the network, relaying
+// it further if it is relevant.
+//
+// Only messages of the current sequence can be checked against the validators
+// they were meant for. Messages of future sequences are kept if sent by a current
+// validator, but not relayed, as the validator set might change until then.
+func (c *stateMachine) handlePayload(payload []byte) {
+	msg, err := decodeMessage(payload)
+	if err != nil {
+		log.Debug("Dropping invalid IBFT message", "err", err)
+		return
+	}
+	c.sync()
+	if msg.Sequence < c.sequence {
+		c.answerStale(msg)
+		return
+	}
+	if !c.validators.contains(msg.sender) {
+		return
+	}
+	if msg.Sequence == c.sequence {
+		c.engine.gossip(payload)
+	}
+	c.handleMessage(msg)
+}
+
+// answerStale hands the final block of a past sequence to a validator requesting
+// a round change in it, as it evidently missed the final block. Agreeing on the
+// block again would gather a different set of commit seals, forking the chain.
+func (c *stateMachine) answerStale(msg *message) {
+	if msg.Code != msgRoundChange || !c.validators.contains(msg.sender) {
+		return
+	}
+	final := c.finals[msg.Sequence]
+	if final == nil || msg.Round <= final.answered {
+		return
+	}
+	final.answered = msg.Round
+
+	payload, err := rlp.EncodeToBytes(final.msg)
+	if err != nil {
+		log.Error("Failed to encode IBFT final block", "err", err)
+		return
+	}
+	log.Debug("Re-broadcasting IBFT final block", "sequence", msg.Sequence, "round", msg.Round, "requester", msg.sender)
+	c.engine.regossip(payload)
+}
+
+// handleMessage processes a consensus message, whichever validator sent it.
+func (c *stateMachine) handleMessage(msg *message) {
+	switch {
+	case c.parent == nil || msg.Sequence > c.sequence:
+		c.store(msg)
+		return
+	case msg.Sequence < c.sequence:
+		return
+	}
+	if !c.validators.contains(msg.sender) {
+		return
+	}
+	// Once the final block of the sequence was delivered, stay out of any further
+	// rounds, which could only end up finalizing it with different seals
+	if c.final {
+		return
+	}
+	switch msg.Code {
+	case msgRoundChange:
+		c.handleRoundChange(msg)
+		return
+	case msgFinal:
+		c.handleFinal(msg)
+		return
+	}
+	switch {
+	case msg.Round > c.round:
+		c.store(msg)
+		return
+	case msg.Round < c.round:
+		return
+	}
+	switch msg.Code {
+	case msgPreprepare:
+		c.handlePreprepare(msg)
+	case msgPrepare:
+		c.handlePrepare(msg)
+	case msgCommit:
+		c.handleCommit(msg)
+	}
+}
+
+// handlePreprepare processes the proposal of the current round.
+func (c *stateMachine) handlePreprepare(msg *message) {
+	if c.state != stateAcceptRequest {
+		return
+	}
+	if proposer := c.validators.proposer(c.last, c.round); msg.sender != proposer {
+		log.Debug("Dropping IBFT proposal from non-proposer", "sender", msg.sender, "proposer", proposer)
+		return
+	}
+	block, err := msg.block()
+	if err != nil || block.Hash() != msg.Digest {
+		log.Debug("Dropping malformed IBFT proposal", "sender", msg.sender, "err", err)
+		return
+	}
+	if block.NumberU64() != c.sequence || block.ParentHash() != c.parent.Hash() {
+		log.Debug("Dropping IBFT proposal on different parent", "number", block.NumberU64(), "parent", block.ParentHash())
+		return
+	}
+	// Validators locked on a proposal only accept a different one if it was proven
+	// to be prepared in a later round, waiting for a round change otherwise
+	if c.locked != nil && block.Hash() != c.locked.Hash() {
+		if _, err := c.verifyCertificate(msg); err != nil || msg.PreparedRound <= c.lockRound {
+			log.Debug("Dropping IBFT proposal conflicting with lock", "hash", block.Hash(), "locked", c.locked.Hash(), "err", err)
+			return
+		}
+	}
+	if err := c.engine.verifyProposal(block); err != nil {
+		log.Warn("Dropping invalid IBFT proposal", "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+		return
+	}
+	c.proposal = block
+	c.state = statePreprepared
+	c.broadcast(&message{Code: msgPrepare, Sequence: c.sequence, Round: c.round, Digest: block.Hash()})
+
+	// Prepares and commits might have arrived before the proposal
+	c.checkPrepared()
+	c.checkCommitted()
+}
+
+// handlePrepare processes a validator acknowledging a proposal.
+func (c *stateMachine) handlePrepare(msg *message) {
+	c.prepares[msg.sender] = msg
+	c.checkPrepared()
+}
+
+// handleCommit processes a validator committing to a proposal.
+func (c *stateMachine) handleCommit(msg *message) {
+	if signer, err := recoverAddress(commitData(msg.Digest), msg.CommittedSeal); err != nil || signer != msg.sender {
+		log.Debug("Dropping IBFT commit with invalid seal", "sender", msg.sender, "err", err)
+		return
+	}
+	c.commits[msg.sender] = msg
+	c.checkCommitted()
+}
+
+// checkPrepared locks on the proposal and commits to it if a quorum of validators
+// acknowledged it.
+func (c *stateMachine) checkPrepared() {
+	if c.state != statePreprepared && c.state != stateCommitted {
+		return
+	}
+	// Gather the prepares in validator order as the certificate of the proposal
+	digest := c.proposal.Hash()
+	seals := make([][]byte, 0, len(c.prepares))
+	for _, validator := range c.validators {
+		if msg, ok := c.prepares[validator]; ok && msg.Digest == digest {
+			seals = append(seals, msg.Signature)
+		}
+	}
+	if len(seals) < c.validators.quorum() {
+		return
+	}
+	c.locked, c.lockRound, c.lockSeals = c.proposal, c.round, seals
+
+	// If the commits overtook the prepares, there's nothing left to do
+	if c.state == stateCommitted {
+		return
+	}
+	c.state = statePrepared
+
+	seal, err := c.engine.sign(commitData(digest))
+	if err != nil {
+		log.Error("Failed to sign IBFT commit", "err", err)
+		return
+	}
+	c.broadcast(&message{Code: msgCommit, Sequence: c.sequence, Round: c.round, Digest: digest, CommittedSeal: seal})
+}
+
+// checkCommitted finalizes the proposal if a quorum of validators committed to it.
+func (c *stateMachine) checkCommitted() {
+	if c.state != statePreprepared && c.state != statePrepared {
+		return
+	}
+	// Gather the seals in validator order to keep the header deterministic
+	digest := c.proposal.Hash()
+	seals := make([][]byte, 0, len(c.commits))
+	for _, validator := range c.validators {
+		if msg, ok := c.commits[validator]; ok && msg.Digest == digest {
+			seals = append(seals, msg.CommittedSeal)
+		}
+	}
+	if len(seals) < c.validators.quorum() {
+		return
+	}
+	c.state = stateCommitted
+	if c.locked == nil || c.locked.Hash() != digest {
+		c.locked, c.lockRound, c.lockSeals = c.proposal, c.round, nil
+	}
+	log.Debug("Committed IBFT block", "sequence", c.sequence, "round", c.round, "hash", digest, "seals", len(seals))
+
+	// Only the proposer of the round assembles the final block, so that all the
+	// validators import the same set of commit seals
+	if c.validators.proposer(c.last, c.round) != c.engine.address() {
+		return
+	}
+	block, err := c.engine.finalize(c.proposal, seals)
+	if err != nil {
+		log.Error("Failed to assemble IBFT block", "err", err)
+		return
+	}
+	blob, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		log.Error("Failed to encode IBFT block", "err", err)
+		return
+	}
+	c.broadcast(&message{Code: msgFinal, Sequence: c.sequence, Round: c.round, Digest: digest, Proposal: blob})
+}
+
+// handleFinal processes the final block assembled by the proposer of the round
+// the validators agreed in.
+func (c *stateMachine) handleFinal(msg *message) {
+	if proposer := c.validators.proposer(c.last, msg.Round); msg.sender != proposer {
+		log.Debug("Dropping IBFT final block from non-proposer", "sender", msg.sender, "proposer", proposer)
+		return
+	}
+	block, err := msg.block()
+	if err != nil || ProposalHash(block.Header()) != msg.Digest {
+		log.Debug("Dropping malformed IBFT final block", "sender", msg.sender, "err", err)
+		return
+	}
+	if block.NumberU64() != c.sequence || block.ParentHash() != c.parent.Hash() {
+		log.Debug("Dropping IBFT final block on different parent", "number", block.NumberU64(), "parent", block.ParentHash())
+		return
+	}
+	extra, err := ExtractExtra(block.Header())
+	if err == nil {
+		err = verifyCommittedSeals(block.Header(), extra, c.validators)
+	}
+	if err != nil {
+		log.Warn("Dropping IBFT final block with invalid seals", "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+		return
+	}
+	c.final = true
+	c.finals[c.sequence] = &finalized{msg: msg}
+
+	log.Debug("Finalized IBFT block", "sequence", c.sequence, "round", msg.Round, "hash", block.Hash())
+	c.engine.deliver(block, c.pending)
+}
+
+// handleTimeout processes the expiration of the current round.
+func (c *stateMachine) handleTimeout(id uint64) {
+	c.sync()
+	if id != c.timerID {
+		return
+	}
+	// If the final block was already delivered, keep waiting for it to be imported.
+	// Otherwise move on to a new round even if committed, as the proposer might be
+	// gone. Validators which got the final block answer the round change with it,
+	// and the lock makes sure the same proposal is agreed upon again otherwise.
+	if c.final {
+		c.resetTimer(c.round)
+		return
+	}
+	round := c.round
+	if c.target > round {
+		round = c.target
+	}
+	log.Debug("IBFT round timed out", "sequence", c.sequence, "round", c.round, "next", round+1)
+	c.sendRoundChange(round + 1)
+}
+
+// sendRoundChange requests the validators to move to the given round.
+func (c *stateMachine) sendRoundChange(round uint64) {
+	c.target = round
+	c.resetTimer(round)
+
+	// Carry the locked proposal along with its certificate, so that the proposer
+	// of the new round picks it up instead of proposing a conflicting block
+	msg := &message{Code: msgRoundChange, Sequence: c.sequence, Round: round}
+	if c.locked != nil && c.lockSeals != nil {
+		blob, err := rlp.EncodeToBytes(c.locked)
+		if err != nil {
+			log.Error("Failed to encode IBFT locked proposal", "err", err)
+			return
+		}
+		msg.Digest, msg.Proposal = c.locked.Hash(), blob
+		msg.PreparedRound, msg.PreparedSeals = c.lockRound, c.lockSeals
+	}
+	c.broadcast(msg)
+}
+
+// handleRoundChange processes a validator requesting to move to a new round.
+func (c *stateMachine) handleRoundChange(msg *message) {
+	if msg.Round <= c.round {
+		return
+	}
+	// Pick up any proposal prepared in a later round than the local lock, so the
+	// proposer of the new round re-proposes the most recently prepared block
+	if len(msg.PreparedSeals) > 0 {
+		block, err := c.verifyCertificate(msg)
+		if err != nil {
+			log.Debug("Dropping IBFT round change with invalid certificate", "sender", msg.sender, "err", err)
+			return
+		}
+		if c.locked == nil || msg.PreparedRound > c.lockRound {
+			c.locked, c.lockRound, c.lockSeals = block, msg.PreparedRound, msg.PreparedSeals
+		}
+	}
+	if c.changes[msg.Round] == nil {
+		c.changes[msg.Round] = make(map[common.Address]struct{})
+	}
+	c.changes[msg.Round][msg.sender] = struct{}{}
+
+	votes := len(c.changes[msg.Round])
+	if votes >= c.validators.quorum() {
+		c.startRound(msg.Round)
+		return
+	}
+	// If more validators want to move ahead than may be faulty, at least one of
+	// them is honest, so catch up with them
+	if votes > c.validators.faulty() && msg.Round > c.target {
+		c.sendRoundChange(msg.Round)
+	}
+}
+
+// verifyCertificate decodes the proposal carried by a message and checks that it
+// was prepared by a quorum of validators in an earlier round of the sequence.
+func (c *stateMachine) verifyCertificate(msg *message) (*types.Block, error) {
+	if len(msg.PreparedSeals) == 0 || msg.PreparedRound >= msg.Round {
+		return nil, errInvalidPreparedSeals
+	}
+	block, err := msg.block()
+	if err != nil {
+		return nil, err
+	}
+	if block.Hash() != msg.Digest || block.NumberU64() != c.sequence || block.ParentHash() != c.parent.Hash() {
+		return nil, errInvalidMessage
+	}
+	if err := verifyPrepared(msg, msg.Digest, c.validators); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"fmt"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/rlp"
+)
+
+// Consensus message codes exchanged between validators.
+const (
+	msgPreprepare  uint64 = iota // Proposer broadcasting a block for the current round
+	msgPrepare                   // Validator acknowledging a valid proposal
+	msgCommit                    // Validator committing to a prepared proposal
+	msgRoundChange               // Validator requesting to move to a new round
+	msgFinal                     // Proposer broadcasting the final block with its commit seals
+)
+
+// message is a signed consensus message sent by a validator.
+type message struct {
+	Code          uint64      // Type of the consensus message
+	Sequence      uint64      // Block number being agreed upon
+	Round         uint64      // Consensus round within the sequence
+	Digest        common.Hash // Hash of the proposal the message refers to
+	Proposal      []byte      // RLP encoded block, set in pre-prepares, final blocks and certified round changes
+	CommittedSeal []byte      // Signature over the commit data, only set in commits
+	PreparedRound uint64      // Round the carried proposal was prepared in, if certified
+	PreparedSeals [][]byte    // Signatures of the quorum of prepares certifying the carried proposal
+	Signature     []byte      // Signature of the sender over all the above fields
+
+	sender common.Address // Validator recovered from the signature
+}
+
+// String implements fmt.Stringer.
+func (m *message) String() string {
+	return fmt.Sprintf("{code: %d, sequence: %d, round: %d, digest: %x, sender: %x}", m.Code, m.Sequence, m.Round, m.Digest[:4], m.sender[:4])
+}
+
+// signingData returns the data a validator signs to authenticate the message.
+func (m *message) signingData() []byte {
+	blob, err := rlp.EncodeToBytes([]interface{}{m.Code, m.Sequence, m.Round, m.Digest, m.Proposal, m.CommittedSeal, m.PreparedRound, m.PreparedSeals})
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	return blob
+}
+
+// block decodes the block carried by a pre-prepare, final block or certified round
+// change message.
+func (m *message) block() (*types.Block, error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(m.Proposal, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// decodeMessage parses a consensus message and recovers its sender.
+func decodeMessage(payload []byte) (*message, error) {
+	msg := new(message)
+	if err := rlp.DecodeBytes(payload, msg); err != nil {
+		return nil, err
+	}
+	if msg.Code > msgFinal {
+		return nil, errInvalidMessage
+	}
+	sender, err := recoverAddress(msg.signingData(), msg.Signature)
+	if err != nil {
+		return nil, err
+	}
+	msg.sender = sender
+	return msg, nil
+}
+
+// prepareData returns the data a validator signs when acknowledging a proposal,
+// allowing the prepares to be carried around as a certificate of it.
+func prepareData(sequence uint64, round uint64, digest common.Hash) []byte {
+	return (&message{Code: msgPrepare, Sequence: sequence, Round: round, Digest: digest}).signingData()
+}
+
+// verifyPrepared checks that the certificate carried by a message proves the
+// given proposal was prepared by a quorum of distinct validators.
+func verifyPrepared(msg *message, digest common.Hash, validators validatorSet) error {
+	var (
+		data   = prepareData(msg.Sequence, msg.PreparedRound, digest)
+		signed = make(map[common.Address]struct{})
+	)
+	for _, seal := range msg.PreparedSeals {
+		signer, err := recoverAddress(data, seal)
+		if err != nil {
+			return errInvalidPreparedSeals
+		}
+		if _, ok := signed[signer]; ok || !validators.contains(signer) {
+			return errInvalidPreparedSeals
+		}
+		signed[signer] = struct{}{}
+	}
+	if len(signed) < validators.quorum() {
+		return errInvalidPreparedSeals
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/params"
+)
+
+// Vote represents a single vote that an authorized validator made to modify the
+// validator set.
+type Vote struct {
+	Validator common.Address `json:"validator"` // Authorized validator that cast this vote
+	Block     uint64         `json:"block"`     // Block number the vote was cast in (expire old votes)
+	Address   common.Address `json:"address"`   // Account being voted on to change its authorization
+	Authorize bool           `json:"authorize"` // Vote to authorize or deauthorize the account
+}
+
+// Tally is a simple vote tally to keep the current score of votes. Votes that
+// go against the proposal aren't counted since it's equivalent to not voting.
+type Tally struct {
+	Authorize bool `json:"authorize"` // Indicates if the vote is about authorizing or kicking someone
+	Votes     int  `json:"votes"`     // Number of votes until now wanting to pass the proposal
+}
+
+// validatorSet is an ordered list of validators, implementing the proposer
+// rotation and quorum rules of the protocol.
+type validatorSet []common.Address
+
+func (s validatorSet) Len() int           { return len(s) }
+func (s validatorSet) Less(i, j int) bool { return bytes.Compare(s[i][:], s[j][:]) < 0 }
+func (s validatorSet) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// index returns the position of a validator in the set, or -1 if it's not a
+// member of it.
+func (s validatorSet) index(addr common.Address) int {
+	for i, validator := range s {
+		if validator == addr {
+			return i
+		}
+	}
+	return -1
+}
+
+// contains returns if the given address is a member of the validator set.
+func (s validatorSet) contains(addr common.Address) bool {
+	return s.index(addr) >= 0
+}
+
+// faulty returns the maximum number of byzantine validators the set tolerates.
+func (s validatorSet) faulty() int {
+	return (len(s) - 1) / 3
+}
+
+// quorum returns the number of validators needed to agree on a proposal, which
+// is ceil(2N/3).
+func (s validatorSet) quorum() int {
+	return (2*len(s) + 2) / 3
+}
+
+// proposer returns the validator in charge of proposing a block in the given
+// round, rotating round-robin starting after the proposer of the parent block.
+func (s validatorSet) proposer(last common.Address, round uint64) common.Address {
+	if len(s) == 0 {
+		return common.Address{}
+	}
+	offset := uint64(s.index(last) + 1) // Unknown last proposers start from the first validator
+	return s[(offset+round)%uint64(len(s))]
+}
+
+// Snapshot is the state of the validator set voting at a given point in time.
+type Snapshot struct {
+	config *params.IBFTConfig // Consensus engine parameters to fine tune behavior
+
+	Number     uint64                   `json:"number"`     // Block number where the snapshot was created
+	Hash       common.Hash              `json:"hash"`       // Block hash where the snapshot was created
+	Validators validatorSet             `json:"validators"` // Ordered set of authorized validators at this moment
+	Votes      []*Vote                  `json:"votes"`      // List of votes cast in chronological order
+	Tally      map[common.Address]Tally `json:"tally"`      // Current vote tally to avoid recalculating
+}
+
+// newSnapshot creates a new snapshot with the specified startup parameters. It
+// should only be used for the genesis block or trusted checkpoints.
+func newSnapshot(config *params.IBFTConfig, number uint64, hash common.Hash, validators []common.Address) *Snapshot {
+	snap := &Snapshot{
+		config:     config,
+		Number:     number,
+		Hash:       hash,
+		Validators: make(validatorSet, len(validators)),
+		Tally:      make(map[common.Address]Tally),
+	}
+	copy(snap.Validators, validators)
+	sort.Sort(snap.Validators)
+
+	return snap
+}
+
+// loadSnapshot loads an existing snapshot from the database.
+func loadSnapshot(config *params.IBFTConfig, db avndb.Database, hash common.Hash) (*Snapshot, error) {
+	blob, err := db.Get(append([]byte("ibft-"), hash[:]...))
+	if err != nil {
+		return nil, err
+	}
+	snap := new(Snapshot)
+	if err := json.Unmarshal(blob, snap); err != nil {
+		return nil, err
+	}
+	snap.config = config
+
+	return snap, nil
+}
+
+// store inserts the snapshot into the database.
+func (s *Snapshot) store(db avndb.Database) error {
+	blob, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return db.Put(append([]byte("ibft-"), s.Hash[:]...), blob)
+}
+
+// copy creates a deep copy of the snapshot, though not the individual votes.
+func (s *Snapshot) copy() *Snapshot {
+	cpy := &Snapshot{
+		config:     s.config,
+		Number:     s.Number,
+		Hash:       s.Hash,
+		Validators: make(validatorSet, len(s.Validators)),
+		Votes:      make([]*Vote, len(s.Votes)),
+		Tally:      make(map[common.Address]Tally),
+	}
+	copy(cpy.Validators, s.Validators)
+	for address, tally := range s.Tally {
+		cpy.Tally[address] = tally
+	}
+	copy(cpy.Votes, s.Votes)
+
+	return cpy
+}
+
+// validVote returns if it makes sense to cast the specified vote in the given
+// snapshot context (e.g. don't try to add an already authorized validator).
+func (s *Snapshot) validVote(address common.Address, authorize bool) bool {
+	validator := s.Validators.contains(address)
+	return (validator && !authorize) || (!validator && authorize)
+}
+
+// cast adds a new vote into the tally.
+func (s *Snapshot) cast(address common.Address, authorize bool) bool {
+	// Ensure the vote is meaningful
+	if !s.validVote(address, authorize) {
+		return false
+	}
+	// Cast the vote into an existing or new tally
+	if old, ok := s.Tally[address]; ok {
+		old.Votes++
+		s.Tally[address] = old
+	} else {
+		s.Tally[address] = Tally{Authorize: authorize, Votes: 1}
+	}
+	return true
+}
+
+// uncast removes a previously cast vote from the tally.
+func (s *Snapshot) uncast(address common.Address, authorize bool) bool {
+	// If there's no tally, it's a dangling vote, just drop
+	tally, ok := s.Tally[address]
+	if !ok {
+		return false
+	}
+	// Ensure we only revert counted votes
+	if tally.Authorize != authorize {
+		return false
+	}
+	// Otherwise revert the vote
+	if tally.Votes > 1 {
+		tally.Votes--
+		s.Tally[address] = tally
+	} else {
+		delete(s.Tally, address)
+	}
+	return true
+}
+
+// apply creates a new authorization snapshot by applying the given headers to
+// the original one. The author callback is used to recover the proposer of each
+// header.
+func (s *Snapshot) apply(headers []*types.Header, author func(*types.Header) (common.Address, error)) (*Snapshot, error) {
+	// Allow passing in no headers for cleaner code
+	if len(headers) == 0 {
+		return s, nil
+	}
+	// Sanity check that the headers can be applied
+	for i := 0; i < len(headers)-1; i++ {
+		if headers[i+1].Number.Uint64() != headers[i].Number.Uint64()+1 {
+			return nil, errInvalidVotingChain
+		}
+	}
+	if headers[0].Number.Uint64() != s.Number+1 {
+		return nil, errInvalidVotingChain
+	}
+	// Iterate through the headers and create a new snapshot
+	snap := s.copy()
+
+	for _, header := range headers {
+		// Remove any votes on checkpoint blocks
+		number := header.Number.Uint64()
+		if number%s.config.Epoch == 0 {
+			snap.Votes = nil
+			snap.Tally = make(map[common.Address]Tally)
+		}
+		// Resolve the proposer and check against the validators
+		proposer, err := author(header)
+		if err != nil {
+			return nil, err
+		}
+		if !snap.Validators.contains(proposer) {
+			return nil, errUnauthorizedProposer
+		}
+		// Header authorized, discard any previous votes from the proposer
+		for i, vote := range snap.Votes {
+			if vote.Validator == proposer && vote.Address == header.Coinbase {
+				// Uncast the vote from the cached tally
+				snap.uncast(vote.Address, vote.Authorize)
+
+				// Uncast the vote from the chronological list
+				snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
+				break // only one vote allowed
+			}
+		}
+		// Tally up the new vote from the proposer
+		var authorize bool
+		switch {
+		case bytes.Equal(header.Nonce[:], nonceAuthVote):
+			authorize = true
+		case bytes.Equal(header.Nonce[:], nonceDropVote):
+			authorize = false
+		default:
+			return nil, errInvalidVote
+		}
+		if snap.cast(header.Coinbase, authorize) {
+			snap.Votes = append(snap.Votes, &Vote{
+				Validator: proposer,
+				Block:     number,
+				Address:   header.Coinbase,
+				Authorize: authorize,
+			})
+		}
+		// If the vote passed, update the validator set
+		if tally := snap.Tally[header.Coinbase]; tally.Votes > len(snap.Validators)/2 {
+			if tally.Authorize {
+				snap.Validators = append(snap.Validators, header.Coinbase)
+				sort.Sort(snap.Validators)
+			} else {
+				idx := snap.Validators.index(header.Coinbase)
+				snap.Validators = append(snap.Validators[:idx], snap.Validators[idx+1:]...)
+
+				// Discard any previous votes the deauthorized validator cast
+				for i := 0; i < len(snap.Votes); i++ {
+					if snap.Votes[i].Validator == header.Coinbase {
+						// Uncast the vote from the cached tally
+						snap.uncast(snap.Votes[i].Address, snap.Votes[i].Authorize)
+
+						// Uncast the vote from the chronological list
+						snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
+
+						i--
+					}
+				}
+			}
+			// Discard any previous votes around the just changed account
+			for i := 0; i < len(snap.Votes); i++ {
+				if snap.Votes[i].Address == header.Coinbase {
+					snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
+					i--
+				}
+			}
+			delete(snap.Tally, header.Coinbase)
+		}
+	}
+	snap.Number += uint64(len(headers))
+	snap.Hash = headers[len(headers)-1].Hash()
+
+	return snap, nil
+}
@@ -79,6 +79,12 @@ func (v *BlockValidator) ValidateBody(block *types.Block) error {
 // itself. ValidateState returns a database batch if the validation was a success
 // otherwise nil and an error is returned.
 func (v *BlockValidator) ValidateState(block *types.Block, statedb *state.StateDB, receipts types.Receipts, usedGas uint64) error {
+	return validateState(v.config, v.engine, v.bc, block, statedb, receipts, usedGas)
+}
+
+// validateState checks the post-state of a block, using the chain only for the
+// engine specific rules.
+func validateState(config *params.ChainConfig, engine consensus.Engine, chain consensus.ChainHeaderReader, block *types.Block, statedb *state.StateDB, receipts types.Receipts, usedGas uint64) error {
 	header := block.Header()
 	if block.GasUsed() != usedGas {
 		return fmt.Errorf("invalid gas used (remote: %d local: %d)", block.GasUsed(), usedGas)
@@ -96,9 +102,15 @@ func (v *BlockValidator) ValidateState(block *types.Block, statedb *state.StateD
 	}
 	// Validate the state root against the received state root and throw
 	// an error if they don't match.
-	if root := statedb.IntermediateRoot(v.config.IsEIP158(header.Number)); header.Root != root {
+	if root := statedb.IntermediateRoot(config.IsEIP158(header.Number)); header.Root != root {
 		return fmt.Errorf("invalid merkle root (remote: %x local: %x)", header.Root, root)
 	}
+	// Validate any engine specific rules that depend on the post-state
+	if validator, ok := engine.(consensus.StateValidator); ok {
+		if err := validator.ValidateState(chain, header, statedb); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
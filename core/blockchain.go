@@ -35,6 +35,7 @@ import (
 	"github.com/avalanria/go-avalanria/core/rawdb"
 	"github.com/avalanria/go-avalanria/core/state"
 	"github.com/avalanria/go-avalanria/core/state/snapshot"
+	"github.com/avalanria/go-avalanria/core/stateless"
 	"github.com/avalanria/go-avalanria/core/types"
 	"github.com/avalanria/go-avalanria/core/vm"
 	"github.com/avalanria/go-avalanria/avndb"
@@ -129,6 +130,10 @@ type CacheConfig struct {
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
 	SnapshotLimit       int           // Memory allowance (MB) to use for caching snapshot entries in memory
 	Preimages           bool          // Whavner to store preimage of trie key to the disk
+	StateScheme         string        // Scheme used to store the trie nodes of the state (hash or path)
+	StateHistory        uint64        // Number of recent states to retain reverse diffs for with the path-based scheme
+	StateDiffs          bool          // Whavner to record the reverse state diffs of blocks to serve historical state
+	StateDiffHistory    uint64        // Number of recent blocks to retain state diffs for (0 = entire chain)
 
 	SnapshotWait bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
 }
@@ -206,6 +211,7 @@ type BlockChain struct {
 	prefetcher Prefetcher
 	processor  Processor // Block transaction processor interface
 	vmConfig   vm.Config
+	hotSlots   *state.HotSlots // Storage slots commonly accessed by recent blocks, for prewarming
 
 	shouldPreserve  func(*types.Block) bool        // Function used to determine whavner should preserve the given block.
 	terminateInsert func(common.Hash, uint64) bool // Testing hook used to terminate ancient receipt chain insertion.
@@ -231,9 +237,11 @@ func NewBlockChain(db avndb.Database, cacheConfig *CacheConfig, chainConfig *par
 		db:          db,
 		triegc:      prque.New(nil),
 		stateCache: state.NewDatabaseWithConfig(db, &trie.Config{
-			Cache:     cacheConfig.TrieCleanLimit,
-			Journal:   cacheConfig.TrieCleanJournal,
-			Preimages: cacheConfig.Preimages,
+			Cache:        cacheConfig.TrieCleanLimit,
+			Journal:      cacheConfig.TrieCleanJournal,
+			Preimages:    cacheConfig.Preimages,
+			Scheme:       cacheConfig.StateScheme,
+			StateHistory: cacheConfig.StateHistory,
 		}),
 		quit:           make(chan struct{}),
 		shouldPreserve: shouldPreserve,
@@ -245,6 +253,7 @@ func NewBlockChain(db avndb.Database, cacheConfig *CacheConfig, chainConfig *par
 		futureBlocks:   futureBlocks,
 		engine:         engine,
 		vmConfig:       vmConfig,
+		hotSlots:       state.NewHotSlots(),
 	}
 	bc.validator = NewBlockValidator(chainConfig, bc, engine)
 	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
@@ -520,7 +529,7 @@ func (bc *BlockChain) SetHeadBeyondRoot(head uint64, root common.Hash) (uint64,
 					if root != (common.Hash{}) && !beyondRoot && newHeadBlock.Root() == root {
 						beyondRoot, rootNumber = true, newHeadBlock.NumberU64()
 					}
-					if _, err := state.New(newHeadBlock.Root(), bc.stateCache, bc.snaps); err != nil {
+					if _, err := state.New(newHeadBlock.Root(), bc.stateCache, bc.snaps); err != nil && !bc.recoverState(newHeadBlock.Root()) {
 						log.Trace("Block state missing, rewinding further", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
 						if pivot == nil || newHeadBlock.NumberU64() > *pivot {
 							parent := bc.GetBlock(newHeadBlock.ParentHash(), newHeadBlock.NumberU64()-1)
@@ -598,6 +607,7 @@ func (bc *BlockChain) SetHeadBeyondRoot(head uint64, root common.Hash) (uint64,
 			rawdb.DeleteBody(db, hash, num)
 			rawdb.DeleteReceipts(db, hash, num)
 		}
+		state.DeleteStateDiff(bc.db, db, num, hash)
 		// Todo(rjl493456442) txlookup, bloombits, etc
 	}
 	// If SetHead was only called as a chain reparation mavnod, try to skip
@@ -691,6 +701,92 @@ func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache, bc.snaps)
 }
 
+// HistoricState returns a read-only state of the given canonical block, rebuilt
+// from the recorded state diffs on top of the snapshot of the current head. It
+// is only available with state diff recording enabled, within the retained
+// history.
+func (bc *BlockChain) HistoricState(header *types.Header) (*state.StateDB, error) {
+	if !bc.cacheConfig.StateDiffs {
+		return nil, errors.New("state diff recording disabled")
+	}
+	number := header.Number.Uint64()
+	if rawdb.ReadCanonicalHash(bc.db, number) != header.Hash() {
+		return nil, fmt.Errorf("block #%d [%x..] not canonical", number, header.Hash().Bytes()[:4])
+	}
+	tail := rawdb.ReadStateHistoryTail(bc.db)
+	if tail == nil || number+1 < *tail {
+		return nil, fmt.Errorf("state of block #%d beyond the recorded history", number)
+	}
+	if bc.snaps == nil {
+		return nil, errors.New("snapshot disabled")
+	}
+	head := bc.CurrentBlock()
+	snap := bc.snaps.Snapshot(head.Root())
+	if snap == nil {
+		return nil, fmt.Errorf("snapshot of head #%d unavailable", head.NumberU64())
+	}
+	return state.NewHistoric(header.Root, number, bc.stateCache, bc.db, snap), nil
+}
+
+// ExecutionWitness re-executes the given block on top of its parent state,
+// recording everything needed to execute it statelessly into a witness.
+func (bc *BlockChain) ExecutionWitness(block *types.Block) (*stateless.Witness, error) {
+	parent := bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	statedb, err := bc.StateAt(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	witness := stateless.NewWitness(parent)
+	statedb.StartWitness(witness)
+
+	receipts, _, usedGas, err := bc.processor.Process(block, statedb, bc.vmConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.validator.ValidateState(block, statedb, receipts, usedGas); err != nil {
+		return nil, err
+	}
+	return witness, nil
+}
+
+// writeStateDiff persists the reverse state diff of the given block into the
+// state history, dropping the diffs beyond the configured retention. A missing
+// diff makes all older states irrecoverable, so the history is truncated.
+func (bc *BlockChain) writeStateDiff(block *types.Block, diff *state.StateDiff) {
+	number := block.NumberU64()
+
+	tail := rawdb.ReadStateHistoryTail(bc.db)
+	if diff == nil {
+		if tail == nil || *tail <= number {
+			if tail != nil {
+				log.Warn("State diff unavailable, truncating history", "number", number, "hash", block.Hash())
+			}
+			rawdb.WriteStateHistoryTail(bc.db, number+1)
+		}
+		return
+	}
+	batch := bc.db.NewBatch()
+	state.WriteStateDiff(batch, number, block.Hash(), diff)
+	if tail == nil {
+		rawdb.WriteStateHistoryTail(batch, number)
+		tail = &number
+	}
+	if limit := bc.cacheConfig.StateDiffHistory; limit > 0 && number >= *tail+limit {
+		for n := *tail; n+limit <= number; n++ {
+			for _, hash := range rawdb.ReadStateHistoryHashes(bc.db, n) {
+				state.DeleteStateDiff(bc.db, batch, n, hash)
+			}
+		}
+		rawdb.WriteStateHistoryTail(batch, number-limit+1)
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write state diff", "err", err)
+	}
+}
+
 // StateCache returns the caching database underpinning the blockchain instance.
 func (bc *BlockChain) StateCache() state.Database {
 	return bc.stateCache
@@ -1011,7 +1107,20 @@ func (bc *BlockChain) Stop() {
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
 	//  - HEAD-1:   So we don't do large reorgs if our HEAD becomes an uncle
 	//  - HEAD-127: So we have a hard limit on the number of blocks reexecuted
-	if !bc.cacheConfig.TrieDirtyDisabled {
+	if !bc.cacheConfig.TrieDirtyDisabled && bc.stateCache.TrieDB().Scheme() == rawdb.PathScheme {
+		// With the path-based scheme, only a single state is kept on disk, with
+		// older ones recoverable. Persist all the recent states up to HEAD.
+		triedb := bc.stateCache.TrieDB()
+
+		current := bc.CurrentBlock()
+		log.Info("Writing cached state to disk", "block", current.Number(), "hash", current.Hash(), "root", current.Root())
+		if err := bc.persistState(current.NumberU64(), true); err != nil {
+			log.Error("Failed to commit recent state trie", "err", err)
+		}
+		for !bc.triegc.Empty() {
+			triedb.Dereference(bc.triegc.PopItem().(common.Hash))
+		}
+	} else if !bc.cacheConfig.TrieDirtyDisabled {
 		triedb := bc.stateCache.TrieDB()
 
 		for _, offset := range []uint64{0, 1, TriesInMemory - 1} {
@@ -1046,6 +1155,59 @@ func (bc *BlockChain) Stop() {
 	log.Info("Blockchain stopped")
 }
 
+// persistState writes the state of the canonical block with the given number to
+// disk with the path-based scheme. The canonical states since the last persisted
+// one are all written in order, as each of them only overwrites its parent. If
+// the persisted state is not a canonical ancestor (e.g. after a reorg), it's
+// rolled back first.
+func (bc *BlockChain) persistState(number uint64, report bool) error {
+	var (
+		triedb    = bc.stateCache.TrieDB()
+		persisted = triedb.PersistedRoot()
+		headers   []*types.Header
+	)
+	header := bc.GetHeaderByNumber(number)
+	if header == nil {
+		log.Warn("Reorg in progress, trie commit postponed", "number", number)
+		return nil
+	}
+	for header.Root != persisted {
+		if triedb.Recoverable(header.Root) {
+			if err := triedb.Recover(header.Root); err != nil {
+				return err
+			}
+			break
+		}
+		headers = append(headers, header)
+		if header.Number.Uint64() == 0 || len(headers) > TriesInMemory {
+			return fmt.Errorf("no persisted ancestor of state %x", headers[0].Root)
+		}
+		if header = bc.GetHeader(header.ParentHash, header.Number.Uint64()-1); header == nil {
+			return consensus.ErrUnknownAncestor
+		}
+	}
+	for i := len(headers) - 1; i >= 0; i-- {
+		if err := triedb.Commit(headers[i].Root, report, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverState attempts to roll the state persisted with the path-based scheme
+// back to the one with the given root, reporting whavner it's available now.
+func (bc *BlockChain) recoverState(root common.Hash) bool {
+	triedb := bc.stateCache.TrieDB()
+	if !triedb.Recoverable(root) {
+		return false
+	}
+	if err := triedb.Recover(root); err != nil {
+		log.Error("Failed to recover state", "root", root, "err", err)
+		return false
+	}
+	return true
+}
+
 // StopInsert interrupts all insertion mavnods, causing them to return
 // errInsertionInterrupted as soon as possible. Insertion is permanently disabled after
 // calling this mavnod.
@@ -1472,10 +1634,16 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 		log.Crit("Failed to write block into disk", "err", err)
 	}
 	// Commit all cached state changes into underlying memory database.
+	if bc.cacheConfig.StateDiffs {
+		state.RecordStateDiff()
+	}
 	root, err := state.Commit(bc.chainConfig.IsEIP158(block.Number()))
 	if err != nil {
 		return NonStatTy, err
 	}
+	if bc.cacheConfig.StateDiffs {
+		bc.writeStateDiff(block, state.StateDiff())
+	}
 	triedb := bc.stateCache.TrieDB()
 
 	// If we're running an archive node, always flush
@@ -1500,8 +1668,14 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 			// Find the next state trie we need to commit
 			chosen := current - TriesInMemory
 
-			// If we exceeded out time allowance, flush an entire trie to disk
-			if bc.gcproc > bc.cacheConfig.TrieTimeLimit {
+			// With the path-based scheme, persist every state leaving the in-memory
+			// window, overwriting the previous one on disk
+			if triedb.Scheme() == rawdb.PathScheme {
+				if err := bc.persistState(chosen, false); err != nil {
+					log.Error("Failed to persist state", "number", chosen, "err", err)
+				}
+			} else if bc.gcproc > bc.cacheConfig.TrieTimeLimit {
+				// If we exceeded out time allowance, flush an entire trie to disk
 				// If the header is missing (canonical chain behind), we're reorging a low
 				// diff sidechain. Suspend committing until this operation is completed.
 				header := bc.GetHeaderByNumber(chosen)
@@ -1668,7 +1842,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		return 0, nil
 	}
 	// Start a parallel signature recovery (signer will fluke on fork transition, minimal perf loss)
-	senderCacher.recoverFromBlocks(types.MakeSigner(bc.chainConfig, chain[0].Number()), chain)
+	senderCacher.recoverFromBlocks(types.MakeSigner(bc.chainConfig, chain[0].Number(), chain[0].Time()), chain)
 
 	var (
 		stats     = insertStats{startTime: mclock.Now()}
@@ -1841,6 +2015,12 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		statedb.StartPrefetcher("chain")
 		activeState = statedb
 
+		// Warm up the state declared by the access lists of the block, along with
+		// the slots commonly accessed in hot contracts, ahead of the execution
+		if !bc.cacheConfig.TrieCleanNoPrefetch {
+			statedb.Prewarm(prewarmSlots(block, bc.hotSlots))
+		}
+
 		// If we have a followup block, run that against the current state to pre-cache
 		// transactions and probabilistically some of the account/storage trie nodes.
 		var followupInterrupt uint32
@@ -1866,6 +2046,8 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 			atomic.StoreUint32(&followupInterrupt, 1)
 			return it.index, err
 		}
+		bc.hotSlots.Record(statedb.AccessedSlots())
+
 		// Update the metrics touched during block processing
 		accountReadTimer.Update(statedb.AccountReads)                 // Account reads are complete, we can mark them
 		storageReadTimer.Update(statedb.StorageReads)                 // Storage reads are complete, we can mark them
@@ -29,11 +29,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/avalanria/go-avalanria/common"
 	"github.com/avalanria/go-avalanria/consensus"
 	"github.com/avalanria/go-avalanria/consensus/avnash"
 	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/state/snapshot"
 	"github.com/avalanria/go-avalanria/core/types"
 	"github.com/avalanria/go-avalanria/core/vm"
+	"github.com/avalanria/go-avalanria/crypto"
 	"github.com/avalanria/go-avalanria/avndb"
 	"github.com/avalanria/go-avalanria/params"
 )
@@ -716,3 +719,75 @@ func TestRecoverSnapshotFromWipingCrash(t *testing.T) {
 	test.test(t)
 	test.teardown()
 }
+
+// Tests that a chain bootstrapped from a state export continues from the exported
+// block, reading the state through the imported snapshot instead of rebuilding it.
+func TestSnapshotImportBootstrap(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		signer  = types.LatestSigner(params.TestChainConfig)
+		engine  = avnash.NewFaker()
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}}}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+	)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, gendb, 9, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(addr), common.Address{byte(i)}, big.NewInt(1000), params.TxGas, block.BaseFee(), nil), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		block.AddTx(tx)
+	})
+	srcdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(srcdb)
+	source, _ := NewBlockChain(srcdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	defer source.Stop()
+
+	if _, err := source.InsertChain(blocks[:8]); err != nil {
+		t.Fatalf("failed to insert source chain: %v", err)
+	}
+	head := source.CurrentBlock()
+	ancestors, err := snapshot.ExportAncestry(srcdb, head.Header(), 0)
+	if err != nil {
+		t.Fatalf("failed to read exported ancestry: %v", err)
+	}
+	dir := t.TempDir()
+	if err := snapshot.Export(source.Snapshots(), source.StateCache().TrieDB(), srcdb, head, ancestors, source.GetTd(head.Hash(), head.NumberU64()), dir); err != nil {
+		t.Fatalf("failed to export state: %v", err)
+	}
+	// Import the state into a fresh chain and reopen it
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+	if _, err := snapshot.Import(db, dir, head.Hash()); err != nil {
+		t.Fatalf("failed to import state: %v", err)
+	}
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to open bootstrapped chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if have := chain.CurrentBlock().Hash(); have != head.Hash() {
+		t.Fatalf("head block mismatch: have %x, want %x", have, head.Hash())
+	}
+	snap := chain.Snapshots().Snapshot(head.Root())
+	if snap == nil {
+		t.Fatalf("imported snapshot missing")
+	}
+	account, err := snap.Account(crypto.Keccak256Hash(addr.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to read account from snapshot: %v", err)
+	}
+	state, _ := source.State()
+	if want := state.GetBalance(addr); account == nil || account.Balance.Cmp(want) != 0 {
+		t.Fatalf("account mismatch: have %v, want balance %v", account, want)
+	}
+	// The bootstrapped chain should continue from the imported block
+	if _, err := chain.InsertChain(blocks[8:]); err != nil {
+		t.Fatalf("failed to extend bootstrapped chain: %v", err)
+	}
+	if have := chain.CurrentBlock().Hash(); have != blocks[8].Hash() {
+		t.Fatalf("extended head mismatch: have %x, want %x", have, blocks[8].Hash())
+	}
+}
@@ -3275,3 +3275,281 @@ func TestEIP1559Transition(t *testing.T) {
 		t.Fatalf("sender balance incorrect: expected %d, got %d", expected, actual)
 	}
 }
+
+// Tests that the block reward and base fee recipient overrides of the chain
+// config are applied from their activation blocks on.
+func TestBlockRewardAndBaseFeeRecipient(t *testing.T) {
+	var (
+		engine    = avnash.NewFaker()
+		db        = rawdb.NewMemoryDatabase()
+		key, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr      = crypto.PubkeyToAddress(key.PublicKey)
+		recipient = common.HexToAddress("0x000000000000000000000000000000000000fee0")
+		reward    = big.NewInt(params.Ether / 10)
+		funds     = big.NewInt(params.Ether)
+	)
+	config := *params.AllEthashProtocolChanges
+	config.BlockRewards = []params.BlockRewardFork{{Block: big.NewInt(2), Reward: reward}}
+	config.BaseFeeRecipients = []params.BaseFeeRecipientFork{{Block: big.NewInt(2), Recipient: &recipient}}
+
+	gspec := &Genesis{
+		Config: &config,
+		Alloc:  GenesisAlloc{addr: {Balance: funds}},
+	}
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 2, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{byte(i + 1)})
+
+		tx, _ := types.SignTx(types.NewTransaction(uint64(i), common.Address{0xaa}, big.NewInt(1), params.TxGas, newGwei(5), nil), signer, key)
+		b.AddTx(tx)
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	state, _ := chain.State()
+	for i, want := range []*big.Int{avnash.ConstantinopleBlockReward, reward} {
+		block := chain.GetBlockByNumber(uint64(i + 1))
+		tip := new(big.Int).Sub(block.Transactions()[0].GasPrice(), block.BaseFee())
+		expected := new(big.Int).Add(want, new(big.Int).Mul(tip, new(big.Int).SetUint64(block.GasUsed())))
+		if actual := state.GetBalance(block.Coinbase()); actual.Cmp(expected) != 0 {
+			t.Errorf("block %d: miner balance incorrect: expected %d, got %d", i+1, expected, actual)
+		}
+	}
+	// Only the base fee of the second block should be credited, the first is burned
+	block := chain.GetBlockByNumber(2)
+	expected := new(big.Int).Mul(block.BaseFee(), new(big.Int).SetUint64(block.GasUsed()))
+	if actual := state.GetBalance(recipient); actual.Cmp(expected) != 0 {
+		t.Fatalf("base fee recipient balance incorrect: expected %d, got %d", expected, actual)
+	}
+	// Zero priced calls with the base fee disabled are not charged, so nothing
+	// should be credited for them either
+	msg := types.NewMessage(addr, &common.Address{0xaa}, 0, big.NewInt(0), params.TxGas, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, false)
+	evm := vm.NewEVM(NewEVMBlockContext(block.Header(), chain, nil), NewEVMTxContext(msg), state, gspec.Config, vm.Config{NoBaseFee: true})
+	if _, err := ApplyMessage(evm, msg, new(GasPool).AddGas(block.GasLimit())); err != nil {
+		t.Fatalf("failed to apply zero priced call: %v", err)
+	}
+	if actual := state.GetBalance(recipient); actual.Cmp(expected) != 0 {
+		t.Fatalf("base fee recipient credited for zero priced call: expected %d, got %d", expected, actual)
+	}
+}
+
+// Tests that a chain storing its state with the path-based scheme persists the
+// states leaving the in-memory window, survives a restart and can be rewound
+// to any recent state.
+func TestPathSchemeChain(t *testing.T) {
+	var (
+		engine   = avnash.NewFaker()
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0x000000000000000000000000000000000000c0de")
+		gspec    = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				addr:     {Balance: big.NewInt(params.Ether)},
+				contract: {Balance: common.Big0, Code: []byte{byte(vm.NUMBER), byte(vm.NUMBER), byte(vm.SSTORE)}},
+			},
+		}
+		signer = types.LatestSigner(gspec.Config)
+	)
+	gendb := rawdb.NewMemoryDatabase()
+	genesis := gspec.MustCommit(gendb)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, gendb, 2*TriesInMemory, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{byte(i + 1)})
+
+		tx, _ := types.SignTx(types.NewTransaction(uint64(i), contract, common.Big0, 100000, b.header.BaseFee, nil), signer, key)
+		b.AddTx(tx)
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	rawdb.WriteStateScheme(diskdb, rawdb.PathScheme)
+	gspec.MustCommit(diskdb)
+
+	cacheConfig := &CacheConfig{
+		TrieCleanLimit: 256,
+		TrieDirtyLimit: 256,
+		TrieTimeLimit:  5 * time.Minute,
+		SnapshotLimit:  256,
+		SnapshotWait:   true,
+		StateScheme:    rawdb.PathScheme,
+	}
+	chain, err := NewBlockChain(diskdb, cacheConfig, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	// Every state leaving the in-memory window should have been persisted
+	if id, want := rawdb.ReadPersistentStateID(diskdb), uint64(len(blocks)-TriesInMemory+1); id != want {
+		t.Fatalf("persisted state id mismatch: have %d, want %d", id, want)
+	}
+	if root, want := chain.StateCache().TrieDB().PersistedRoot(), blocks[len(blocks)-TriesInMemory-1].Root(); root != want {
+		t.Fatalf("persisted state root mismatch: have %x, want %x", root, want)
+	}
+	for _, block := range blocks[len(blocks)-TriesInMemory-1:] {
+		if !chain.HasState(block.Root()) {
+			t.Fatalf("recent state of block #%d unavailable", block.NumberU64())
+		}
+	}
+	chain.Stop()
+
+	// Restart the chain, the head state should have been persisted on shutdown
+	chain, err = NewBlockChain(diskdb, cacheConfig, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to recreate tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	head := chain.CurrentBlock()
+	if head.Hash() != blocks[len(blocks)-1].Hash() {
+		t.Fatalf("head block mismatch: have #%d, want #%d", head.NumberU64(), len(blocks))
+	}
+	if _, err := chain.State(); err != nil {
+		t.Fatalf("head state unavailable after restart: %v", err)
+	}
+	// Rewind the chain, the persisted state should be rolled back
+	target := blocks[TriesInMemory/2]
+	if err := chain.SetHead(target.NumberU64()); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if head := chain.CurrentBlock(); head.Hash() != target.Hash() {
+		t.Fatalf("rewound head mismatch: have #%d, want #%d", head.NumberU64(), target.NumberU64())
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("rewound state unavailable: %v", err)
+	}
+	slot := common.BigToHash(target.Number())
+	if value := statedb.GetState(contract, slot); value != slot {
+		t.Errorf("rewound storage mismatch: have %x, want %x", value, slot)
+	}
+	if value := statedb.GetState(contract, common.BigToHash(new(big.Int).Add(target.Number(), common.Big1))); value != (common.Hash{}) {
+		t.Errorf("storage of rewound blocks still present: %x", value)
+	}
+}
+
+// Tests that with state diff recording enabled, historical states can be rebuilt
+// from the recorded diffs, including storage wiped by self-destructs, and that
+// diffs beyond the configured retention are dropped.
+func TestHistoricState(t *testing.T) {
+	var (
+		engine   = avnash.NewFaker()
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		counter  = common.HexToAddress("0x000000000000000000000000000000000000c0de")
+		suicidal = common.HexToAddress("0x000000000000000000000000000000000000dead")
+		gspec    = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				addr:     {Balance: big.NewInt(params.Ether)},
+				counter:  {Balance: common.Big0, Code: []byte{byte(vm.NUMBER), byte(vm.PUSH1), 0x00, byte(vm.SSTORE)}},
+				suicidal: {Balance: common.Big1, Code: []byte{byte(vm.CALLER), byte(vm.SELFDESTRUCT)}, Storage: map[common.Hash]common.Hash{{0x01}: {0x01}}},
+			},
+		}
+		signer = types.LatestSigner(gspec.Config)
+	)
+	gendb := rawdb.NewMemoryDatabase()
+	genesis := gspec.MustCommit(gendb)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, gendb, 10, func(i int, b *BlockGen) {
+		to := counter
+		if i == 4 {
+			to = suicidal
+		}
+		tx, _ := types.SignTx(types.NewTransaction(uint64(i), to, big.NewInt(int64(i+1)), 100000, b.header.BaseFee, nil), signer, key)
+		b.AddTx(tx)
+	})
+	newChain := func(history uint64) (*BlockChain, avndb.Database) {
+		diskdb := rawdb.NewMemoryDatabase()
+		gspec.MustCommit(diskdb)
+
+		cacheConfig := &CacheConfig{
+			TrieCleanLimit:   256,
+			TrieDirtyLimit:   256,
+			TrieTimeLimit:    5 * time.Minute,
+			SnapshotLimit:    256,
+			SnapshotWait:     true,
+			StateDiffs:       true,
+			StateDiffHistory: history,
+		}
+		chain, err := NewBlockChain(diskdb, cacheConfig, gspec.Config, engine, vm.Config{}, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create tester chain: %v", err)
+		}
+		if n, err := chain.InsertChain(blocks); err != nil {
+			t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+		}
+		return chain, diskdb
+	}
+	chain, _ := newChain(0)
+	defer chain.Stop()
+
+	headers := []*types.Header{genesis.Header()}
+	for _, block := range blocks {
+		headers = append(headers, block.Header())
+	}
+	for _, header := range headers {
+		want, err := chain.StateAt(header.Root)
+		if err != nil {
+			t.Fatalf("state of block #%d unavailable: %v", header.Number, err)
+		}
+		have, err := chain.HistoricState(header)
+		if err != nil {
+			t.Fatalf("failed to rebuild state of block #%d: %v", header.Number, err)
+		}
+		for _, account := range []common.Address{addr, counter, suicidal} {
+			if have.GetBalance(account).Cmp(want.GetBalance(account)) != 0 {
+				t.Errorf("block #%d: balance of %x mismatch: have %v, want %v", header.Number, account, have.GetBalance(account), want.GetBalance(account))
+			}
+			if have.GetNonce(account) != want.GetNonce(account) {
+				t.Errorf("block #%d: nonce of %x mismatch: have %d, want %d", header.Number, account, have.GetNonce(account), want.GetNonce(account))
+			}
+			if have.Exist(account) != want.Exist(account) {
+				t.Errorf("block #%d: existence of %x mismatch: have %v, want %v", header.Number, account, have.Exist(account), want.Exist(account))
+			}
+			for _, slot := range []common.Hash{{}, {0x01}} {
+				if have, want := have.GetState(account, slot), want.GetState(account, slot); have != want {
+					t.Errorf("block #%d: slot %x of %x mismatch: have %x, want %x", header.Number, slot, account, have, want)
+				}
+			}
+		}
+		if _, err := have.GetProof(addr); err == nil {
+			t.Errorf("block #%d: proof generated for historic state", header.Number)
+		}
+		// Copies of the historic state should be served from the history too
+		cpy := have.Copy()
+		for _, account := range []common.Address{addr, counter, suicidal} {
+			if cpy.GetBalance(account).Cmp(want.GetBalance(account)) != 0 {
+				t.Errorf("block #%d: copied balance of %x mismatch: have %v, want %v", header.Number, account, cpy.GetBalance(account), want.GetBalance(account))
+			}
+			if have, want := cpy.GetState(account, common.Hash{}), want.GetState(account, common.Hash{}); have != want {
+				t.Errorf("block #%d: copied slot of %x mismatch: have %x, want %x", header.Number, account, have, want)
+			}
+		}
+	}
+	// Ensure the diffs beyond the retention are dropped
+	limited, diskdb := newChain(3)
+	defer limited.Stop()
+
+	if tail := rawdb.ReadStateHistoryTail(diskdb); tail == nil || *tail != uint64(len(blocks)-2) {
+		t.Fatalf("state history tail mismatch: have %v, want %d", tail, len(blocks)-2)
+	}
+	for _, header := range headers {
+		_, err := limited.HistoricState(header)
+		if available := header.Number.Uint64() >= uint64(len(blocks)-3); available != (err == nil) {
+			t.Errorf("block #%d: availability mismatch: have %v, want %v (err %v)", header.Number, err == nil, available, err)
+		}
+	}
+	if hashes := rawdb.ReadStateHistoryHashes(diskdb, 1); len(hashes) != 0 {
+		t.Errorf("pruned state diffs still present: %x", hashes)
+	}
+}
@@ -134,7 +134,7 @@ func TestCreation(t *testing.T) {
 	}
 	for i, tt := range tests {
 		for j, ttt := range tt.cases {
-			if have := NewID(tt.config, tt.genesis, ttt.head); have != ttt.want {
+			if have := NewID(tt.config, tt.genesis, ttt.head, 0); have != ttt.want {
 				t.Errorf("test %d, case %d: fork ID mismatch: have %x, want %x", i, j, have, ttt.want)
 			}
 		}
@@ -216,7 +216,61 @@ func TestValidation(t *testing.T) {
 		{7279999, ID{Hash: checksumToBytes(0xa00bc324), Next: 7279999}, ErrLocalIncompatibleOrStale},
 	}
 	for i, tt := range tests {
-		filter := newFilter(params.MainnetChainConfig, params.MainnetGenesisHash, func() uint64 { return tt.head })
+		filter := newFilter(params.MainnetChainConfig, params.MainnetGenesisHash, func() (uint64, uint64) { return tt.head, 0 })
+		if err := filter(tt.id); err != tt.err {
+			t.Errorf("test %d: validation error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that fork IDs are properly calculated and validated for forks scheduled
+// by timestamp instead of block number.
+func TestTimestampForks(t *testing.T) {
+	config := *params.GoerliChainConfig
+	config.LondonBlock = nil
+	config.LondonTime = new(uint64)
+	*config.LondonTime = 1_700_000_000
+
+	berlin := checksumToBytes(0x757a1c47)
+	london := checksumToBytes(checksumUpdate(0x757a1c47, 1_700_000_000))
+
+	tests := []struct {
+		head, time uint64
+		want       ID
+	}{
+		{4460643, 1_500_000_000, ID{Hash: checksumToBytes(0xc25efa5c), Next: 4460644}}, // Last Istanbul block
+		{4460644, 1_500_000_000, ID{Hash: berlin, Next: 1_700_000_000}},                // First Berlin block
+		{6000000, 1_699_999_999, ID{Hash: berlin, Next: 1_700_000_000}},                // Last Berlin block
+		{6000001, 1_700_000_000, ID{Hash: london, Next: 0}},                            // First London block
+		{9000000, 1_800_000_000, ID{Hash: london, Next: 0}},                            // Future London block
+	}
+	for i, tt := range tests {
+		if have := NewID(&config, params.GoerliGenesisHash, tt.head, tt.time); have != tt.want {
+			t.Errorf("test %d: fork ID mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+	filters := []struct {
+		head, time uint64
+		id         ID
+		err        error
+	}{
+		// Local and remote are both in Berlin, announcing the same London time
+		{6000000, 1_600_000_000, ID{Hash: berlin, Next: 1_700_000_000}, nil},
+
+		// Local is in London, remote is a syncing Berlin node aware of London
+		{6000001, 1_700_000_001, ID{Hash: berlin, Next: 1_700_000_000}, nil},
+
+		// Local is in London, remote is a stale Berlin node unaware of London
+		{6000001, 1_700_000_001, ID{Hash: berlin, Next: 0}, ErrRemoteStale},
+
+		// Local is in Berlin, remote announces a time fork already passed locally
+		{6000000, 1_650_000_000, ID{Hash: berlin, Next: 1_600_000_000}, ErrLocalIncompatibleOrStale},
+
+		// Local is in Berlin, remote is a syncing London node
+		{6000000, 1_600_000_000, ID{Hash: london, Next: 0}, nil},
+	}
+	for i, tt := range filters {
+		filter := newFilter(&config, params.GoerliGenesisHash, func() (uint64, uint64) { return tt.head, tt.time })
 		if err := filter(tt.id); err != tt.err {
 			t.Errorf("test %d: validation error mismatch: have %v, want %v", i, err, tt.err)
 		}
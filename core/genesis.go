@@ -224,11 +224,20 @@ func SetupGenesisBlockWithOverride(db avndb.Database, genesis *Genesis, override
 	}
 	// Check config compatibility and write the config. Compatibility errors
 	// are returned to the caller unless we're already at block zero.
-	height := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadHeaderHash(db))
+	headHash := rawdb.ReadHeadHeaderHash(db)
+	height := rawdb.ReadHeaderNumber(db, headHash)
 	if height == nil {
 		return newcfg, stored, fmt.Errorf("missing block number for head header hash")
 	}
-	compatErr := storedcfg.CheckCompatible(newcfg, *height)
+	head := rawdb.ReadHeader(db, headHash, *height)
+	if head == nil {
+		return newcfg, stored, fmt.Errorf("missing head header")
+	}
+	compatErr := storedcfg.CheckCompatible(newcfg, *height, head.Time)
+	if compatErr != nil && compatErr.RewindToTime > 0 {
+		// Time based forks can only be undone by rewinding the chain to a block
+		compatErr.RewindTo = timestampRewindTarget(db, head, compatErr.RewindToTime)
+	}
 	if compatErr != nil && *height != 0 && compatErr.RewindTo != 0 {
 		return newcfg, stored, compatErr
 	}
@@ -236,6 +245,20 @@ func SetupGenesisBlockWithOverride(db avndb.Database, genesis *Genesis, override
 	return newcfg, stored, nil
 }
 
+// timestampRewindTarget returns the number of the last canonical block with a
+// timestamp not after the given one, which a time based fork mismatch needs the
+// chain rewound to.
+func timestampRewindTarget(db avndb.Reader, head *types.Header, time uint64) uint64 {
+	for head.Number.Uint64() > 0 && head.Time > time {
+		parent := rawdb.ReadHeader(db, head.ParentHash, head.Number.Uint64()-1)
+		if parent == nil {
+			break
+		}
+		head = parent
+	}
+	return head.Number.Uint64()
+}
+
 func (g *Genesis) configOrDefault(ghash common.Hash) *params.ChainConfig {
 	switch {
 	case g != nil:
@@ -294,7 +317,7 @@ func (g *Genesis) ToBlock(db avndb.Database) *types.Block {
 	if g.Difficulty == nil {
 		head.Difficulty = params.GenesisDifficulty
 	}
-	if g.Config != nil && g.Config.IsLondon(common.Big0) {
+	if g.Config != nil && g.Config.IsLondon(common.Big0, g.Timestamp) {
 		if g.BaseFee != nil {
 			head.BaseFee = g.BaseFee
 		} else {
@@ -269,6 +269,26 @@ func WriteFastTxLookupLimit(db avndb.KeyValueWriter, number uint64) {
 	}
 }
 
+// ReadChainImportTail retrieves the number of the oldest block of a chain
+// bootstrapped from a state import. If the corresponding entry is non-existent
+// in database it means the chain is complete down to the genesis.
+func ReadChainImportTail(db avndb.KeyValueReader) *uint64 {
+	data, _ := db.Get(chainImportTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteChainImportTail stores the number of the oldest block of a chain
+// bootstrapped from a state import into database.
+func WriteChainImportTail(db avndb.KeyValueWriter, number uint64) {
+	if err := db.Put(chainImportTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the chain import tail", "err", err)
+	}
+}
+
 // ReadHeaderRLP retrieves a block header in its raw RLP database encoding.
 func ReadHeaderRLP(db avndb.Reader, hash common.Hash, number uint64) rlp.RawValue {
 	// First try to look up the data in ancient database. Extra hash
@@ -356,6 +376,40 @@ func deleteHeaderWithoutNumber(db avndb.KeyValueWriter, hash common.Hash, number
 	}
 }
 
+// ReadCheckpointHeader retrieves a block header staged while backfilling the
+// chain behind a trusted checkpoint.
+func ReadCheckpointHeader(db avndb.KeyValueReader, number uint64) *types.Header {
+	data, _ := db.Get(checkpointHeaderKey(number))
+	if len(data) == 0 {
+		return nil
+	}
+	header := new(types.Header)
+	if err := rlp.Decode(bytes.NewReader(data), header); err != nil {
+		log.Error("Invalid checkpoint header RLP", "number", number, "err", err)
+		return nil
+	}
+	return header
+}
+
+// WriteCheckpointHeader stages a block header backfilled behind a trusted
+// checkpoint, until it can be imported into the chain.
+func WriteCheckpointHeader(db avndb.KeyValueWriter, header *types.Header) {
+	data, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		log.Crit("Failed to RLP encode checkpoint header", "err", err)
+	}
+	if err := db.Put(checkpointHeaderKey(header.Number.Uint64()), data); err != nil {
+		log.Crit("Failed to store checkpoint header", "err", err)
+	}
+}
+
+// DeleteCheckpointHeader removes a staged checkpoint header.
+func DeleteCheckpointHeader(db avndb.KeyValueWriter, number uint64) {
+	if err := db.Delete(checkpointHeaderKey(number)); err != nil {
+		log.Crit("Failed to delete checkpoint header", "err", err)
+	}
+}
+
 // ReadBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func ReadBodyRLP(db avndb.Reader, hash common.Hash, number uint64) rlp.RawValue {
 	// First try to look up the data in ancient database. Extra hash
@@ -600,7 +654,12 @@ func ReadReceipts(db avndb.Reader, hash common.Hash, number uint64, config *para
 		log.Error("Missing body but have receipt", "hash", hash, "number", number)
 		return nil
 	}
-	if err := receipts.DeriveFields(config, hash, number, body.Transactions); err != nil {
+	// The signer depends on the block timestamp too if forks are scheduled by time
+	var time uint64
+	if header := ReadHeader(db, hash, number); header != nil {
+		time = header.Time
+	}
+	if err := receipts.DeriveFields(config, hash, number, time, body.Transactions); err != nil {
 		log.Error("Failed to derive block receipts fields", "hash", hash, "number", number, "err", err)
 		return nil
 	}
@@ -0,0 +1,150 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/log"
+)
+
+// ReadStateHistoryTail retrieves the number of the oldest block whose state
+// diffs are retained in the database.
+func ReadStateHistoryTail(db avndb.KeyValueReader) *uint64 {
+	data, _ := db.Get(stateHistoryTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteStateHistoryTail stores the number of the oldest block whose state diffs
+// are retained in the database.
+func WriteStateHistoryTail(db avndb.KeyValueWriter, number uint64) {
+	if err := db.Put(stateHistoryTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store state history tail", "err", err)
+	}
+}
+
+// ReadStateHistoryIndex retrieves the RLP encoded list of accounts and storage
+// slots modified by the given block.
+func ReadStateHistoryIndex(db avndb.KeyValueReader, number uint64, hash common.Hash) []byte {
+	data, _ := db.Get(stateHistoryKey(number, hash))
+	return data
+}
+
+// WriteStateHistoryIndex stores the RLP encoded list of accounts and storage
+// slots modified by the given block.
+func WriteStateHistoryIndex(db avndb.KeyValueWriter, number uint64, hash common.Hash, blob []byte) {
+	if err := db.Put(stateHistoryKey(number, hash), blob); err != nil {
+		log.Crit("Failed to store state history index", "err", err)
+	}
+}
+
+// DeleteStateHistoryIndex deletes the list of state entries modified by the
+// given block.
+func DeleteStateHistoryIndex(db avndb.KeyValueWriter, number uint64, hash common.Hash) {
+	if err := db.Delete(stateHistoryKey(number, hash)); err != nil {
+		log.Crit("Failed to delete state history index", "err", err)
+	}
+}
+
+// WriteAccountHistory stores the slim RLP encoded account as it was before the
+// given block modified it. An empty value denotes a non-existent account.
+func WriteAccountHistory(db avndb.KeyValueWriter, accountHash common.Hash, number uint64, hash common.Hash, prev []byte) {
+	if err := db.Put(accountHistoryKey(accountHash, number, hash), prev); err != nil {
+		log.Crit("Failed to store account history", "err", err)
+	}
+}
+
+// DeleteAccountHistory deletes the previous account value recorded by the given
+// block.
+func DeleteAccountHistory(db avndb.KeyValueWriter, accountHash common.Hash, number uint64, hash common.Hash) {
+	if err := db.Delete(accountHistoryKey(accountHash, number, hash)); err != nil {
+		log.Crit("Failed to delete account history", "err", err)
+	}
+}
+
+// WriteStorageHistory stores the RLP encoded storage slot as it was before the
+// given block modified it. An empty value denotes a non-existent slot.
+func WriteStorageHistory(db avndb.KeyValueWriter, accountHash, storageHash common.Hash, number uint64, hash common.Hash, prev []byte) {
+	if err := db.Put(storageHistoryKey(accountHash, storageHash, number, hash), prev); err != nil {
+		log.Crit("Failed to store storage history", "err", err)
+	}
+}
+
+// DeleteStorageHistory deletes the previous storage slot value recorded by the
+// given block.
+func DeleteStorageHistory(db avndb.KeyValueWriter, accountHash, storageHash common.Hash, number uint64, hash common.Hash) {
+	if err := db.Delete(storageHistoryKey(accountHash, storageHash, number, hash)); err != nil {
+		log.Crit("Failed to delete storage history", "err", err)
+	}
+}
+
+// ReadAccountHistory retrieves the value of the account as it was before the
+// first canonical block, starting at the given number, that modified it. The
+// flag reports whavner such block was found at all.
+func ReadAccountHistory(db avndb.Database, accountHash common.Hash, number uint64) ([]byte, bool) {
+	return readHistory(db, append(accountHistoryPrefix, accountHash.Bytes()...), number)
+}
+
+// ReadStorageHistory retrieves the value of the storage slot as it was before
+// the first canonical block, starting at the given number, that modified it.
+// The flag reports whavner such block was found at all.
+func ReadStorageHistory(db avndb.Database, accountHash, storageHash common.Hash, number uint64) ([]byte, bool) {
+	return readHistory(db, append(append(storageHistoryPrefix, accountHash.Bytes()...), storageHash.Bytes()...), number)
+}
+
+// readHistory iterates the history entries under the given prefix, starting at
+// the given block number, and returns the value of the first one recorded by a
+// canonical block. Entries of side chains are skipped.
+func readHistory(db avndb.Database, prefix []byte, number uint64) ([]byte, bool) {
+	it := db.NewIterator(prefix, encodeBlockNumber(number))
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+8+common.HashLength {
+			continue
+		}
+		n := binary.BigEndian.Uint64(key[len(prefix) : len(prefix)+8])
+		if ReadCanonicalHash(db, n) == common.BytesToHash(key[len(prefix)+8:]) {
+			return common.CopyBytes(it.Value()), true
+		}
+	}
+	return nil, false
+}
+
+// ReadStateHistoryHashes retrieves the hashes of all the blocks with the given
+// number that have their state diffs recorded.
+func ReadStateHistoryHashes(db avndb.Iteratee, number uint64) []common.Hash {
+	prefix := append(stateHistoryPrefix, encodeBlockNumber(number)...)
+
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	var hashes []common.Hash
+	for it.Next() {
+		if key := it.Key(); len(key) == len(prefix)+common.HashLength {
+			hashes = append(hashes, common.BytesToHash(key[len(prefix):]))
+		}
+	}
+	return hashes
+}
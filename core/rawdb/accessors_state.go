@@ -94,3 +94,29 @@ func DeleteTrieNode(db avndb.KeyValueWriter, hash common.Hash) {
 		log.Crit("Failed to delete trie node", "err", err)
 	}
 }
+
+// ReadOnlinePruningMarker retrieves the key the sweep of an unfinished online
+// state pruning progressed to. The returned flag reports whavner any pruning
+// is in progress at all.
+func ReadOnlinePruningMarker(db avndb.KeyValueReader) ([]byte, bool) {
+	data, err := db.Get(onlinePruningKey)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// WriteOnlinePruningMarker stores the key the sweep of an online state pruning
+// progressed to, signalling the pruning needs to be resumed if interrupted.
+func WriteOnlinePruningMarker(db avndb.KeyValueWriter, marker []byte) {
+	if err := db.Put(onlinePruningKey, marker); err != nil {
+		log.Crit("Failed to store online pruning marker", "err", err)
+	}
+}
+
+// DeleteOnlinePruningMarker deletes the progress marker of online state pruning.
+func DeleteOnlinePruningMarker(db avndb.KeyValueWriter) {
+	if err := db.Delete(onlinePruningKey); err != nil {
+		log.Crit("Failed to remove online pruning marker", "err", err)
+	}
+}
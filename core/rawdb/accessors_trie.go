@@ -0,0 +1,190 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/log"
+)
+
+const (
+	// HashScheme is the legacy trie node storage scheme, keying every node by
+	// its hash. Stale nodes are never overwritten and need to be pruned offline.
+	HashScheme = "hash"
+
+	// PathScheme is the trie node storage scheme keying every node by its owner
+	// and path within the trie. Only the latest persisted state is kept on disk,
+	// older ones are reachable by applying the recorded reverse diffs.
+	PathScheme = "path"
+)
+
+// ReadStateScheme retrieves the scheme the state of the database is stored
+// with, or an empty string if none was recorded yet.
+func ReadStateScheme(db avndb.KeyValueReader) string {
+	data, _ := db.Get(stateSchemeKey)
+	return string(data)
+}
+
+// WriteStateScheme stores the scheme the state of the database is stored with.
+func WriteStateScheme(db avndb.KeyValueWriter, scheme string) {
+	if err := db.Put(stateSchemeKey, []byte(scheme)); err != nil {
+		log.Crit("Failed to store state scheme", "err", err)
+	}
+}
+
+// ParseStateScheme checks the requested state scheme against the one recorded
+// in the database, returning the scheme to use. Without an explicit request the
+// recorded scheme is used, defaulting to the hash-based one. A database holding
+// any state stored with the hash-based scheme cannot be switched over.
+func ParseStateScheme(provided string, db avndb.KeyValueReader) (string, error) {
+	if provided != "" && provided != HashScheme && provided != PathScheme {
+		return "", fmt.Errorf("unknown state scheme %q", provided)
+	}
+	stored := ReadStateScheme(db)
+	if stored == "" {
+		// Databases predating the scheme tracking are hash-based, unless empty
+		if provided == "" || ReadHeadHeaderHash(db) != (common.Hash{}) {
+			stored = HashScheme
+		} else {
+			return provided, nil
+		}
+	}
+	if provided != "" && provided != stored {
+		return "", fmt.Errorf("incompatible state scheme, stored: %s, provided: %s", stored, provided)
+	}
+	return stored, nil
+}
+
+// ReadAccountTrieNode retrieves the account trie node stored at the given path
+// with the path-based scheme.
+func ReadAccountTrieNode(db avndb.KeyValueReader, path []byte) []byte {
+	data, _ := db.Get(accountTrieNodeKey(path))
+	return data
+}
+
+// WriteAccountTrieNode writes the provided account trie node into the database
+// at the given path.
+func WriteAccountTrieNode(db avndb.KeyValueWriter, path []byte, node []byte) {
+	if err := db.Put(accountTrieNodeKey(path), node); err != nil {
+		log.Crit("Failed to store account trie node", "err", err)
+	}
+}
+
+// DeleteAccountTrieNode deletes the account trie node stored at the given path.
+func DeleteAccountTrieNode(db avndb.KeyValueWriter, path []byte) {
+	if err := db.Delete(accountTrieNodeKey(path)); err != nil {
+		log.Crit("Failed to delete account trie node", "err", err)
+	}
+}
+
+// ReadStorageTrieNode retrieves the storage trie node of the given account
+// stored at the given path with the path-based scheme.
+func ReadStorageTrieNode(db avndb.KeyValueReader, accountHash common.Hash, path []byte) []byte {
+	data, _ := db.Get(storageTrieNodeKey(accountHash, path))
+	return data
+}
+
+// WriteStorageTrieNode writes the provided storage trie node of the given
+// account into the database at the given path.
+func WriteStorageTrieNode(db avndb.KeyValueWriter, accountHash common.Hash, path []byte, node []byte) {
+	if err := db.Put(storageTrieNodeKey(accountHash, path), node); err != nil {
+		log.Crit("Failed to store storage trie node", "err", err)
+	}
+}
+
+// DeleteStorageTrieNode deletes the storage trie node of the given account
+// stored at the given path.
+func DeleteStorageTrieNode(db avndb.KeyValueWriter, accountHash common.Hash, path []byte) {
+	if err := db.Delete(storageTrieNodeKey(accountHash, path)); err != nil {
+		log.Crit("Failed to delete storage trie node", "err", err)
+	}
+}
+
+// IterateStorageTrieNodes returns an iterator over all the storage trie nodes of
+// the given account stored with the path-based scheme.
+func IterateStorageTrieNodes(db avndb.Iteratee, accountHash common.Hash) avndb.Iterator {
+	return db.NewIterator(storageTrieNodeKey(accountHash, nil), nil)
+}
+
+// ReadPersistentStateID retrieves the id of the latest state persisted with the
+// path-based scheme, zero if none.
+func ReadPersistentStateID(db avndb.KeyValueReader) uint64 {
+	data, _ := db.Get(persistentStateIDKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WritePersistentStateID stores the id of the latest state persisted with the
+// path-based scheme.
+func WritePersistentStateID(db avndb.KeyValueWriter, id uint64) {
+	if err := db.Put(persistentStateIDKey, encodeBlockNumber(id)); err != nil {
+		log.Crit("Failed to store persistent state id", "err", err)
+	}
+}
+
+// ReadReverseDiff retrieves the RLP encoded reverse diff reverting the state
+// with the given id to its predecessor.
+func ReadReverseDiff(db avndb.KeyValueReader, id uint64) []byte {
+	data, _ := db.Get(reverseDiffKey(id))
+	return data
+}
+
+// WriteReverseDiff stores the RLP encoded reverse diff reverting the state with
+// the given id to its predecessor.
+func WriteReverseDiff(db avndb.KeyValueWriter, id uint64, blob []byte) {
+	if err := db.Put(reverseDiffKey(id), blob); err != nil {
+		log.Crit("Failed to store reverse diff", "err", err)
+	}
+}
+
+// DeleteReverseDiff deletes the reverse diff of the state with the given id.
+func DeleteReverseDiff(db avndb.KeyValueWriter, id uint64) {
+	if err := db.Delete(reverseDiffKey(id)); err != nil {
+		log.Crit("Failed to delete reverse diff", "err", err)
+	}
+}
+
+// ReadReverseDiffLookup retrieves the id of the persisted state with the given
+// root hash.
+func ReadReverseDiffLookup(db avndb.KeyValueReader, root common.Hash) (uint64, bool) {
+	data, _ := db.Get(reverseDiffLookupKey(root))
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// WriteReverseDiffLookup stores the id of the persisted state with the given
+// root hash.
+func WriteReverseDiffLookup(db avndb.KeyValueWriter, root common.Hash, id uint64) {
+	if err := db.Put(reverseDiffLookupKey(root), encodeBlockNumber(id)); err != nil {
+		log.Crit("Failed to store reverse diff lookup", "err", err)
+	}
+}
+
+// DeleteReverseDiffLookup deletes the state id lookup of the given root hash.
+func DeleteReverseDiffLookup(db avndb.KeyValueWriter, root common.Hash) {
+	if err := db.Delete(reverseDiffLookupKey(root)); err != nil {
+		log.Crit("Failed to delete reverse diff lookup", "err", err)
+	}
+}
@@ -296,6 +296,9 @@ func InspectDatabase(db avndb.Database, keyPrefix, keyStart []byte) error {
 		numHashPairings stat
 		hashNumPairings stat
 		tries           stat
+		pathTries       stat
+		reverseDiffs    stat
+		stateHistory    stat
 		codes           stat
 		txLookups       stat
 		accountSnaps    stat
@@ -342,10 +345,27 @@ func InspectDatabase(db avndb.Database, keyPrefix, keyStart []byte) error {
 			numHashPairings.Add(size)
 		case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == (len(headerNumberPrefix)+common.HashLength):
 			hashNumPairings.Add(size)
+		case bytes.HasPrefix(key, checkpointHeaderPrefix) && len(key) == (len(checkpointHeaderPrefix)+8):
+			headers.Add(size)
 		case len(key) == common.HashLength:
 			tries.Add(size)
 		case bytes.HasPrefix(key, CodePrefix) && len(key) == len(CodePrefix)+common.HashLength:
 			codes.Add(size)
+		case bytes.HasPrefix(key, TrieNodeAccountPrefix) && len(key) <= len(TrieNodeAccountPrefix)+2*common.HashLength:
+			pathTries.Add(size)
+		case bytes.HasPrefix(key, TrieNodeStoragePrefix) && len(key) >= len(TrieNodeStoragePrefix)+common.HashLength &&
+			len(key) <= len(TrieNodeStoragePrefix)+3*common.HashLength:
+			pathTries.Add(size)
+		case bytes.HasPrefix(key, reverseDiffPrefix) && len(key) == len(reverseDiffPrefix)+8:
+			reverseDiffs.Add(size)
+		case bytes.HasPrefix(key, reverseDiffLookupPrefix) && len(key) == len(reverseDiffLookupPrefix)+common.HashLength:
+			reverseDiffs.Add(size)
+		case bytes.HasPrefix(key, stateHistoryPrefix) && len(key) == len(stateHistoryPrefix)+8+common.HashLength:
+			stateHistory.Add(size)
+		case bytes.HasPrefix(key, accountHistoryPrefix) && len(key) == len(accountHistoryPrefix)+2*common.HashLength+8:
+			stateHistory.Add(size)
+		case bytes.HasPrefix(key, storageHistoryPrefix) && len(key) == len(storageHistoryPrefix)+3*common.HashLength+8:
+			stateHistory.Add(size)
 		case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
 			txLookups.Add(size)
 		case bytes.HasPrefix(key, SnapshotAccountPrefix) && len(key) == (len(SnapshotAccountPrefix)+common.HashLength):
@@ -376,7 +396,8 @@ func InspectDatabase(db avndb.Database, keyPrefix, keyStart []byte) error {
 				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, lastPivotKey,
 				fastTrieProgressKey, snapshotDisabledKey, snapshotRootKey, snapshotJournalKey,
 				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
-				uncleanShutdownKey, badBlockKey,
+				uncleanShutdownKey, badBlockKey, onlinePruningKey, stateSchemeKey, persistentStateIDKey,
+				stateHistoryTailKey, chainImportTailKey,
 			} {
 				if bytes.Equal(key, meta) {
 					metadata.Add(size)
@@ -419,6 +440,9 @@ func InspectDatabase(db avndb.Database, keyPrefix, keyStart []byte) error {
 		{"Key-Value store", "Bloombit index", bloomBits.Size(), bloomBits.Count()},
 		{"Key-Value store", "Contract codes", codes.Size(), codes.Count()},
 		{"Key-Value store", "Trie nodes", tries.Size(), tries.Count()},
+		{"Key-Value store", "Path trie nodes", pathTries.Size(), pathTries.Count()},
+		{"Key-Value store", "Reverse diffs", reverseDiffs.Size(), reverseDiffs.Count()},
+		{"Key-Value store", "State history", stateHistory.Size(), stateHistory.Count()},
 		{"Key-Value store", "Trie preimages", preimages.Size(), preimages.Count()},
 		{"Key-Value store", "Account snapshot", accountSnaps.Size(), accountSnaps.Count()},
 		{"Key-Value store", "Storage snapshot", storageSnaps.Size(), storageSnaps.Count()},
@@ -334,6 +334,13 @@ func (f *freezer) freeze(db avndb.KeyValueStore) {
 			backoff = true
 			continue
 		}
+		// Chains bootstrapped from a state import lack the blocks preceding it, so
+		// there's no contiguous history to move into the ancient store
+		if tail := ReadChainImportTail(nfdb); tail != nil && f.frozen < *tail {
+			log.Debug("Ancient blocks missing before imported state", "frozen", f.frozen, "tail", *tail)
+			backoff = true
+			continue
+		}
 		head := ReadHeader(nfdb, hash, *number)
 		if head == nil {
 			log.Error("Current full block unavailable", "number", *number, "hash", hash)
@@ -63,9 +63,26 @@ var (
 	// snapshotSyncStatusKey tracks the snapshot sync status across restarts.
 	snapshotSyncStatusKey = []byte("SnapshotSyncStatus")
 
+	// onlinePruningKey tracks the progress of an interrupted online state pruning.
+	onlinePruningKey = []byte("OnlinePruning")
+
+	// stateSchemeKey tracks the scheme the trie nodes of the state are stored with.
+	stateSchemeKey = []byte("StateScheme")
+
+	// persistentStateIDKey tracks the id of the latest state persisted with the
+	// path-based scheme, the number of reverse diffs recorded so far.
+	persistentStateIDKey = []byte("LastStateID")
+
+	// stateHistoryTailKey tracks the oldest block whose state diffs are retained.
+	stateHistoryTailKey = []byte("StateHistoryTail")
+
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
+	// chainImportTailKey tracks the oldest block of a chain bootstrapped from a
+	// state import, with the blocks before it missing.
+	chainImportTailKey = []byte("ChainImportTail")
+
 	// fastTxLookupLimitKey tracks the transaction lookup limit during fast sync.
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
@@ -81,6 +98,8 @@ var (
 	headerHashSuffix   = []byte("n") // headerPrefix + num (uint64 big endian) + headerHashSuffix -> hash
 	headerNumberPrefix = []byte("H") // headerNumberPrefix + hash -> num (uint64 big endian)
 
+	checkpointHeaderPrefix = []byte("k") // checkpointHeaderPrefix + num (uint64 big endian) -> header backfilled behind a trusted checkpoint
+
 	blockBodyPrefix     = []byte("b") // blockBodyPrefix + num (uint64 big endian) + hash -> block body
 	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
 
@@ -90,6 +109,15 @@ var (
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
 
+	TrieNodeAccountPrefix   = []byte("A") // TrieNodeAccountPrefix + hexPath -> trie node, path-based scheme
+	TrieNodeStoragePrefix   = []byte("O") // TrieNodeStoragePrefix + account hash + hexPath -> trie node, path-based scheme
+	reverseDiffPrefix       = []byte("D") // reverseDiffPrefix + state id (uint64 big endian) -> reverse diff
+	reverseDiffLookupPrefix = []byte("L") // reverseDiffLookupPrefix + state root -> state id (uint64 big endian)
+
+	stateHistoryPrefix   = []byte("d") // stateHistoryPrefix + num (uint64 big endian) + hash -> state diff keys
+	accountHistoryPrefix = []byte("x") // accountHistoryPrefix + account hash + num (uint64 big endian) + hash -> previous account
+	storageHistoryPrefix = []byte("y") // storageHistoryPrefix + account hash + storage hash + num (uint64 big endian) + hash -> previous slot
+
 	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("avalanria-config-") // config prefix for the db
 
@@ -167,6 +195,11 @@ func headerNumberKey(hash common.Hash) []byte {
 	return append(headerNumberPrefix, hash.Bytes()...)
 }
 
+// checkpointHeaderKey = checkpointHeaderPrefix + num (uint64 big endian)
+func checkpointHeaderKey(number uint64) []byte {
+	return append(checkpointHeaderPrefix, encodeBlockNumber(number)...)
+}
+
 // blockBodyKey = blockBodyPrefix + num (uint64 big endian) + hash
 func blockBodyKey(number uint64, hash common.Hash) []byte {
 	return append(append(blockBodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
@@ -226,6 +259,41 @@ func IsCodeKey(key []byte) (bool, []byte) {
 	return false, nil
 }
 
+// accountTrieNodeKey = TrieNodeAccountPrefix + hexPath
+func accountTrieNodeKey(path []byte) []byte {
+	return append(TrieNodeAccountPrefix, path...)
+}
+
+// storageTrieNodeKey = TrieNodeStoragePrefix + account hash + hexPath
+func storageTrieNodeKey(accountHash common.Hash, path []byte) []byte {
+	return append(append(TrieNodeStoragePrefix, accountHash.Bytes()...), path...)
+}
+
+// reverseDiffKey = reverseDiffPrefix + state id (uint64 big endian)
+func reverseDiffKey(id uint64) []byte {
+	return append(reverseDiffPrefix, encodeBlockNumber(id)...)
+}
+
+// reverseDiffLookupKey = reverseDiffLookupPrefix + state root
+func reverseDiffLookupKey(root common.Hash) []byte {
+	return append(reverseDiffLookupPrefix, root.Bytes()...)
+}
+
+// stateHistoryKey = stateHistoryPrefix + num (uint64 big endian) + hash
+func stateHistoryKey(number uint64, hash common.Hash) []byte {
+	return append(append(stateHistoryPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// accountHistoryKey = accountHistoryPrefix + account hash + num (uint64 big endian) + hash
+func accountHistoryKey(accountHash common.Hash, number uint64, hash common.Hash) []byte {
+	return append(append(append(accountHistoryPrefix, accountHash.Bytes()...), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// storageHistoryKey = storageHistoryPrefix + account hash + storage hash + num (uint64 big endian) + hash
+func storageHistoryKey(accountHash, storageHash common.Hash, number uint64, hash common.Hash) []byte {
+	return append(append(append(append(storageHistoryPrefix, accountHash.Bytes()...), storageHash.Bytes()...), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
 // configKey = configPrefix + hash
 func configKey(hash common.Hash) []byte {
 	return append(configPrefix, hash.Bytes()...)
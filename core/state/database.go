@@ -102,6 +102,12 @@ type Trie interface {
 	Prove(key []byte, fromLevel uint, proofDb avndb.KeyValueWriter) error
 }
 
+// recordingTrie is a trie able to record the nodes resolved from the database,
+// needed for collecting state witnesses.
+type recordingTrie interface {
+	SetRecorder(recorder trie.Recorder)
+}
+
 // NewDatabase creates a backing store for state. The returned database is safe for
 // concurrent use, but does not retain any recent trie nodes in memory. To keep some
 // historical state in memory, use the NewDatabaseWithConfig constructor.
@@ -113,6 +119,17 @@ func NewDatabase(db avndb.Database) Database {
 // is safe for concurrent use and retains a lot of collapsed RLP trie nodes in a
 // large memory cache.
 func NewDatabaseWithConfig(db avndb.Database, config *trie.Config) Database {
+	// Use the trie node storage scheme recorded in the database, unless requested
+	// explicitly
+	if scheme := rawdb.ReadStateScheme(db); scheme != "" && (config == nil || config.Scheme == "") {
+		if config == nil {
+			config = &trie.Config{Preimages: true}
+		} else {
+			cpy := *config
+			config = &cpy
+		}
+		config.Scheme = scheme
+	}
 	csc, _ := lru.New(codeSizeCacheSize)
 	return &cachingDB{
 		db:            trie.NewDatabaseWithConfig(db, config),
@@ -138,7 +155,7 @@ func (db *cachingDB) OpenTrie(root common.Hash) (Trie, error) {
 
 // OpenStorageTrie opens the storage trie of an account.
 func (db *cachingDB) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
-	tr, err := trie.NewSecure(root, db.db)
+	tr, err := trie.NewSecureWithOwner(addrHash, root, db.db)
 	if err != nil {
 		return nil, err
 	}
@@ -150,6 +167,8 @@ func (db *cachingDB) CopyTrie(t Trie) Trie {
 	switch t := t.(type) {
 	case *trie.SecureTrie:
 		return t.Copy()
+	case *historicTrie:
+		return t.Copy()
 	default:
 		panic(fmt.Errorf("unknown trie type %T", t))
 	}
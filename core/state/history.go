@@ -0,0 +1,337 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/state/snapshot"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/avndb/memorydb"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/rlp"
+	"github.com/avalanria/go-avalanria/trie"
+)
+
+// errHistoricState is returned when attempting to access the tries of a state
+// reconstructed from the state history, which has no trie nodes backing it.
+var errHistoricState = errors.New("trie unavailable for historic state")
+
+// StateDiff is the reverse diff of a state transition, holding the values of all
+// the accounts and storage slots it modified as they were before it. Accounts are
+// in the slim snapshot format, slots RLP encoded, and an empty value denotes a
+// non-existent entry.
+type StateDiff struct {
+	Accounts []DiffAccount
+	Storage  []DiffStorage
+}
+
+// DiffAccount is the previous value of a modified account.
+type DiffAccount struct {
+	Hash common.Hash
+	Prev []byte
+}
+
+// DiffStorage is the previous value of a modified storage slot.
+type DiffStorage struct {
+	Account common.Hash
+	Hash    common.Hash
+	Prev    []byte
+}
+
+// stateHistoryIndex is the list of entries modified by a block, persisted to be
+// able to drop the history of the block later on.
+type stateHistoryIndex struct {
+	Accounts []common.Hash
+	Storage  []stateHistorySlot
+}
+
+// stateHistorySlot is the identifier of a modified storage slot.
+type stateHistorySlot struct {
+	Account common.Hash
+	Hash    common.Hash
+}
+
+// RecordStateDiff enables the collection of the reverse diff of the state
+// transition during the next Commit. It requires the snapshot of the parent
+// state to be available, otherwise no diff is collected.
+func (s *StateDB) RecordStateDiff() {
+	s.recordDiff = true
+}
+
+// StateDiff returns the reverse diff collected by the last Commit, or nil if it
+// was not requested or could not be assembled.
+func (s *StateDB) StateDiff() *StateDiff {
+	return s.diff
+}
+
+// collectStateDiff gathers the previous values of all the accounts and storage
+// slots modified by the state transition being committed, reading them from the
+// snapshot of the parent state. Nil is returned if the parent state cannot be
+// fully resolved, e.g. while the snapshot is still being generated.
+func (s *StateDB) collectStateDiff() *StateDiff {
+	var (
+		diff    = new(StateDiff)
+		parent  = s.snap.Root()
+		seen    = make(map[common.Hash]map[common.Hash]struct{})
+		touched = make(map[common.Hash]struct{})
+	)
+	for hash := range s.snapDestructs {
+		touched[hash] = struct{}{}
+	}
+	for hash := range s.snapAccounts {
+		touched[hash] = struct{}{}
+	}
+	for hash := range touched {
+		prev, err := s.snap.AccountRLP(hash)
+		if err != nil {
+			log.Debug("Failed to resolve previous account", "root", parent, "hash", hash, "err", err)
+			return nil
+		}
+		diff.Accounts = append(diff.Accounts, DiffAccount{Hash: hash, Prev: common.CopyBytes(prev)})
+	}
+	// Destructed accounts lose all their storage, so every slot they had needs
+	// to be recorded, not only the explicitly modified ones
+	for hash := range s.snapDestructs {
+		it, err := s.snaps.StorageIterator(parent, hash, common.Hash{})
+		if err != nil {
+			log.Debug("Failed to iterate previous storage", "root", parent, "hash", hash, "err", err)
+			return nil
+		}
+		slots := make(map[common.Hash]struct{})
+		for it.Next() {
+			slots[it.Hash()] = struct{}{}
+			diff.Storage = append(diff.Storage, DiffStorage{Account: hash, Hash: it.Hash(), Prev: common.CopyBytes(it.Slot())})
+		}
+		err = it.Error()
+		it.Release()
+		if err != nil {
+			log.Debug("Failed to iterate previous storage", "root", parent, "hash", hash, "err", err)
+			return nil
+		}
+		seen[hash] = slots
+	}
+	for account, storage := range s.snapStorage {
+		slots, destructed := seen[account]
+		for hash := range storage {
+			if destructed {
+				// All the previous slots were already recorded, anything else
+				// didn't exist before
+				if _, ok := slots[hash]; !ok {
+					diff.Storage = append(diff.Storage, DiffStorage{Account: account, Hash: hash})
+				}
+				continue
+			}
+			prev, err := s.snap.Storage(account, hash)
+			if err != nil {
+				log.Debug("Failed to resolve previous slot", "root", parent, "account", account, "hash", hash, "err", err)
+				return nil
+			}
+			diff.Storage = append(diff.Storage, DiffStorage{Account: account, Hash: hash, Prev: common.CopyBytes(prev)})
+		}
+	}
+	sort.Slice(diff.Accounts, func(i, j int) bool {
+		return bytes.Compare(diff.Accounts[i].Hash[:], diff.Accounts[j].Hash[:]) < 0
+	})
+	sort.Slice(diff.Storage, func(i, j int) bool {
+		if c := bytes.Compare(diff.Storage[i].Account[:], diff.Storage[j].Account[:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(diff.Storage[i].Hash[:], diff.Storage[j].Hash[:]) < 0
+	})
+	return diff
+}
+
+// WriteStateDiff persists the reverse diff of the given block into the state
+// history, indexed by the modified entries to allow fast historical lookups.
+func WriteStateDiff(db avndb.KeyValueWriter, number uint64, hash common.Hash, diff *StateDiff) {
+	var index stateHistoryIndex
+	for _, account := range diff.Accounts {
+		rawdb.WriteAccountHistory(db, account.Hash, number, hash, account.Prev)
+		index.Accounts = append(index.Accounts, account.Hash)
+	}
+	for _, slot := range diff.Storage {
+		rawdb.WriteStorageHistory(db, slot.Account, slot.Hash, number, hash, slot.Prev)
+		index.Storage = append(index.Storage, stateHistorySlot{Account: slot.Account, Hash: slot.Hash})
+	}
+	blob, err := rlp.EncodeToBytes(&index)
+	if err != nil {
+		log.Crit("Failed to encode state history index", "err", err)
+	}
+	rawdb.WriteStateHistoryIndex(db, number, hash, blob)
+}
+
+// DeleteStateDiff removes the reverse diff of the given block from the state
+// history. It's a noop if no diff was recorded for the block.
+func DeleteStateDiff(reader avndb.KeyValueReader, db avndb.KeyValueWriter, number uint64, hash common.Hash) {
+	blob := rawdb.ReadStateHistoryIndex(reader, number, hash)
+	if len(blob) == 0 {
+		return
+	}
+	var index stateHistoryIndex
+	if err := rlp.DecodeBytes(blob, &index); err != nil {
+		log.Error("Invalid state history index", "number", number, "hash", hash, "err", err)
+		return
+	}
+	for _, account := range index.Accounts {
+		rawdb.DeleteAccountHistory(db, account, number, hash)
+	}
+	for _, slot := range index.Storage {
+		rawdb.DeleteStorageHistory(db, slot.Account, slot.Hash, number, hash)
+	}
+	rawdb.DeleteStateHistoryIndex(db, number, hash)
+}
+
+// historicSnapshot is a read-only snapshot reconstructing the state of an old
+// block. Every entry is resolved from the reverse diff of the first canonical
+// block modifying it after the target one, or from the latest state if it was
+// not modified since.
+type historicSnapshot struct {
+	db     avndb.Database    // Database containing the state history
+	root   common.Hash       // Root hash of the reconstructed state
+	number uint64            // First block whose reverse diffs are consulted
+	head   snapshot.Snapshot // Snapshot of the latest state
+}
+
+// Root returns the root hash of the reconstructed state.
+func (hs *historicSnapshot) Root() common.Hash {
+	return hs.root
+}
+
+// Account directly retrieves the account associated with a particular hash in
+// the snapshot slim data format.
+func (hs *historicSnapshot) Account(hash common.Hash) (*snapshot.Account, error) {
+	data, err := hs.AccountRLP(hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	account := new(snapshot.Account)
+	if err := rlp.DecodeBytes(data, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// AccountRLP directly retrieves the account RLP associated with a particular
+// hash in the snapshot slim data format.
+func (hs *historicSnapshot) AccountRLP(hash common.Hash) ([]byte, error) {
+	if prev, ok := rawdb.ReadAccountHistory(hs.db, hash, hs.number); ok {
+		return prev, nil
+	}
+	return hs.head.AccountRLP(hash)
+}
+
+// Storage directly retrieves the storage data associated with a particular hash,
+// within a particular account.
+func (hs *historicSnapshot) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	if prev, ok := rawdb.ReadStorageHistory(hs.db, accountHash, storageHash, hs.number); ok {
+		return prev, nil
+	}
+	return hs.head.Storage(accountHash, storageHash)
+}
+
+// historicTrie is the placeholder account trie of a state reconstructed from the
+// state history. All trie operations fail, except hashing which returns the root
+// of the reconstructed state.
+type historicTrie struct {
+	root common.Hash
+}
+
+// GetKey returns nil, preimages are not available for historic states.
+func (t *historicTrie) GetKey([]byte) []byte {
+	return nil
+}
+
+// TryGet always fails, the historic state is served from the snapshot.
+func (t *historicTrie) TryGet(key []byte) ([]byte, error) {
+	return nil, errHistoricState
+}
+
+// TryUpdate always fails, the historic state cannot be modified.
+func (t *historicTrie) TryUpdate(key, value []byte) error {
+	return errHistoricState
+}
+
+// TryDelete always fails, the historic state cannot be modified.
+func (t *historicTrie) TryDelete(key []byte) error {
+	return errHistoricState
+}
+
+// Hash returns the root hash of the reconstructed state.
+func (t *historicTrie) Hash() common.Hash {
+	return t.root
+}
+
+// Commit always fails, the historic state cannot be modified.
+func (t *historicTrie) Commit(trie.LeafCallback) (common.Hash, error) {
+	return t.root, errHistoricState
+}
+
+// NodeIterator returns an iterator over an empty trie, as there are no trie
+// nodes backing the historic state.
+func (t *historicTrie) NodeIterator(startKey []byte) trie.NodeIterator {
+	empty, _ := trie.New(common.Hash{}, trie.NewDatabase(memorydb.New()))
+	return empty.NodeIterator(startKey)
+}
+
+// Copy returns a copy of the placeholder trie.
+func (t *historicTrie) Copy() *historicTrie {
+	return &historicTrie{root: t.root}
+}
+
+// Prove always fails, proofs cannot be generated without the trie nodes.
+func (t *historicTrie) Prove(key []byte, fromLevel uint, proofDb avndb.KeyValueWriter) error {
+	return errHistoricState
+}
+
+// NewHistoric creates a read-only state of the block with the given number and
+// root, reconstructed from the state history recorded after it on top of the
+// given snapshot of the latest state. The tries of the state are unavailable,
+// so it can neither be committed nor be used to generate proofs.
+func NewHistoric(root common.Hash, number uint64, db Database, history avndb.Database, head snapshot.Snapshot) *StateDB {
+	return &StateDB{
+		db:           db,
+		trie:         &historicTrie{root: root},
+		originalRoot: root,
+		snap: &historicSnapshot{
+			db:     history,
+			root:   root,
+			number: number + 1,
+			head:   head,
+		},
+		snapDestructs:       make(map[common.Hash]struct{}),
+		snapAccounts:        make(map[common.Hash][]byte),
+		snapStorage:         make(map[common.Hash]map[common.Hash][]byte),
+		stateObjects:        make(map[common.Address]*stateObject),
+		stateObjectsPending: make(map[common.Address]struct{}),
+		stateObjectsDirty:   make(map[common.Address]struct{}),
+		logs:                make(map[common.Hash][]*types.Log),
+		preimages:           make(map[common.Hash][]byte),
+		journal:             newJournal(),
+		accessList:          newAccessList(),
+		hasher:              crypto.NewKeccakState(),
+	}
+}
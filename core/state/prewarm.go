@@ -0,0 +1,267 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"sync"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/state/snapshot"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/metrics"
+)
+
+const (
+	// hotContractLimit is the maximum number of contracts whose storage accesses
+	// are tracked for finding the hot slots.
+	hotContractLimit = 1024
+
+	// hotSlotLimit is the maximum number of storage slots tracked per contract.
+	hotSlotLimit = 256
+
+	// hotDecayInterval is the number of blocks after which the access counters
+	// are halved, so that stale access patterns are eventually forgotten.
+	hotDecayInterval = 32
+
+	// hotContractThreshold is the minimum (decayed) number of blocks accessing a
+	// contract for it to be considered hot. With counters halved every 32 blocks,
+	// this requires the contract to be accessed in about every eighth block.
+	hotContractThreshold = 8
+)
+
+var (
+	prewarmAccountHitMeter   = metrics.NewRegisteredMeter("state/prewarm/account/hit", nil)
+	prewarmAccountMissMeter  = metrics.NewRegisteredMeter("state/prewarm/account/miss", nil)
+	prewarmAccountWasteMeter = metrics.NewRegisteredMeter("state/prewarm/account/waste", nil)
+	prewarmStorageHitMeter   = metrics.NewRegisteredMeter("state/prewarm/storage/hit", nil)
+	prewarmStorageMissMeter  = metrics.NewRegisteredMeter("state/prewarm/storage/miss", nil)
+	prewarmStorageWasteMeter = metrics.NewRegisteredMeter("state/prewarm/storage/waste", nil)
+)
+
+// Prewarm schedules the given accounts and storage slots, such as the ones
+// declared by the access lists of a block, to be loaded concurrently ahead of
+// the transactions accessing them. Both the snapshot serving the reads and the
+// tries needed for hashing are warmed up.
+//
+// Prewarming is done through the trie prefetcher, it is a noop if none is running.
+func (s *StateDB) Prewarm(slots map[common.Address][]common.Hash) {
+	if s.prefetcher == nil || len(slots) == 0 {
+		return
+	}
+	if s.prewarmed == nil {
+		s.prewarmed = make(map[common.Address]map[common.Hash]struct{})
+	}
+	var (
+		addrs   = make([][]byte, 0, len(slots))
+		storage = make(map[common.Address][]common.Hash)
+	)
+	for addr, keys := range slots {
+		set := s.prewarmed[addr]
+		if set == nil {
+			set = make(map[common.Hash]struct{})
+			s.prewarmed[addr] = set
+		}
+		for _, key := range keys {
+			set[key] = struct{}{}
+		}
+		addrs = append(addrs, common.CopyBytes(addr[:]))
+		if len(keys) > 0 {
+			storage[addr] = append([]common.Hash{}, keys...)
+		}
+	}
+	s.prefetcher.prefetch(common.Hash{}, s.originalRoot, addrs)
+
+	// The storage tries can only be scheduled once the account roots are known,
+	// resolve them in the background not to delay the execution
+	if len(storage) > 0 {
+		go prewarmStorage(s.prefetcher, s.snap, storage)
+	}
+}
+
+// prewarmStorage resolves the storage roots of the given accounts from the
+// snapshot and schedules their slots to be loaded by the prefetcher.
+func prewarmStorage(prefetcher *triePrefetcher, snap snapshot.Snapshot, slots map[common.Address][]common.Hash) {
+	hasher := crypto.NewKeccakState()
+	for addr, keys := range slots {
+		if !prefetcher.active() {
+			return
+		}
+		addrHash := crypto.HashData(hasher, addr[:])
+		acc, err := snap.Account(addrHash)
+		if err != nil || acc == nil || len(acc.Root) == 0 {
+			continue
+		}
+		root := common.BytesToHash(acc.Root)
+		if root == emptyRoot {
+			continue
+		}
+		tasks := make([][]byte, 0, len(keys))
+		for _, key := range keys {
+			snap.Storage(addrHash, crypto.HashData(hasher, key[:]))
+			tasks = append(tasks, common.CopyBytes(key[:]))
+		}
+		prefetcher.prefetch(addrHash, root, tasks)
+	}
+}
+
+// reportPrewarm compares the prewarmed state with the state loaded during the
+// execution, reporting the hits, misses and the waste to the metrics subsystem.
+func (s *StateDB) reportPrewarm() {
+	if s.prewarmed == nil {
+		return
+	}
+	defer func() { s.prewarmed = nil }()
+
+	if !metrics.Enabled {
+		return
+	}
+	for addr, slots := range s.prewarmed {
+		obj := s.stateObjects[addr]
+		if obj == nil {
+			prewarmAccountWasteMeter.Mark(1)
+			prewarmStorageWasteMeter.Mark(int64(len(slots)))
+			continue
+		}
+		prewarmAccountHitMeter.Mark(1)
+		for key := range slots {
+			if _, ok := obj.originStorage[key]; ok {
+				prewarmStorageHitMeter.Mark(1)
+			} else {
+				prewarmStorageWasteMeter.Mark(1)
+			}
+		}
+	}
+	for addr, obj := range s.stateObjects {
+		slots, ok := s.prewarmed[addr]
+		if !ok {
+			prewarmAccountMissMeter.Mark(1)
+		}
+		for key := range obj.originStorage {
+			if _, ok := slots[key]; !ok {
+				prewarmStorageMissMeter.Mark(1)
+			}
+		}
+	}
+}
+
+// AccessedSlots returns the storage slots loaded from the database so far,
+// grouped by the contracts they belong to.
+func (s *StateDB) AccessedSlots() map[common.Address][]common.Hash {
+	accessed := make(map[common.Address][]common.Hash)
+	for addr, obj := range s.stateObjects {
+		if len(obj.originStorage) == 0 {
+			continue
+		}
+		keys := make([]common.Hash, 0, len(obj.originStorage))
+		for key := range obj.originStorage {
+			keys = append(keys, key)
+		}
+		accessed[addr] = keys
+	}
+	return accessed
+}
+
+// HotSlots learns the storage slots commonly accessed in the contracts touched
+// by most blocks, allowing them to be prewarmed before the blocks accessing them
+// are executed. It is safe for concurrent use.
+type HotSlots struct {
+	contracts map[common.Address]*hotContract // Access counters of the tracked contracts
+	blocks    uint64                          // Number of blocks recorded
+	lock      sync.Mutex
+}
+
+// hotContract tracks the storage accesses of a single contract.
+type hotContract struct {
+	hits  uint64                 // Decayed number of blocks accessing the contract
+	slots map[common.Hash]uint64 // Decayed number of blocks accessing each slot
+}
+
+// NewHotSlots creates an empty hot slot tracker.
+func NewHotSlots() *HotSlots {
+	return &HotSlots{
+		contracts: make(map[common.Address]*hotContract),
+	}
+}
+
+// Record accounts the storage slots accessed during the execution of a block.
+func (h *HotSlots) Record(accessed map[common.Address][]common.Hash) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for addr, keys := range accessed {
+		contract := h.contracts[addr]
+		if contract == nil {
+			if len(h.contracts) >= hotContractLimit {
+				continue // Wait for the decay to make room
+			}
+			contract = &hotContract{slots: make(map[common.Hash]uint64)}
+			h.contracts[addr] = contract
+		}
+		contract.hits++
+		for _, key := range keys {
+			if _, ok := contract.slots[key]; ok || len(contract.slots) < hotSlotLimit {
+				contract.slots[key]++
+			}
+		}
+	}
+	h.blocks++
+	if h.blocks%hotDecayInterval == 0 {
+		h.decay()
+	}
+}
+
+// decay halves all the access counters, dropping the contracts and slots not
+// accessed anymore.
+func (h *HotSlots) decay() {
+	for addr, contract := range h.contracts {
+		if contract.hits /= 2; contract.hits == 0 {
+			delete(h.contracts, addr)
+			continue
+		}
+		for key, hits := range contract.slots {
+			if hits/2 == 0 {
+				delete(contract.slots, key)
+			} else {
+				contract.slots[key] = hits / 2
+			}
+		}
+	}
+}
+
+// Slots returns the storage slots accessed by at least half of the blocks
+// accessing the hot contracts.
+func (h *HotSlots) Slots() map[common.Address][]common.Hash {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	slots := make(map[common.Address][]common.Hash)
+	for addr, contract := range h.contracts {
+		if contract.hits < hotContractThreshold {
+			continue
+		}
+		var keys []common.Hash
+		for key, hits := range contract.slots {
+			if 2*hits >= contract.hits {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 0 {
+			slots[addr] = keys
+		}
+	}
+	return slots
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/state/snapshot"
+	"github.com/avalanria/go-avalanria/crypto"
+)
+
+// Tests that prewarming schedules the storage tries of the accounts declared,
+// resolving their roots in the background.
+func TestPrewarm(t *testing.T) {
+	var (
+		db    = NewDatabase(rawdb.NewMemoryDatabase())
+		addr  = common.HexToAddress("0xaffeaffeaffeaffeaffeaffeaffeaffeaffeaffe")
+		other = common.HexToAddress("0x0102")
+	)
+	state, _ := New(common.Hash{}, db, nil)
+	state.SetBalance(other, big.NewInt(1))
+	for i := 0; i < 100; i++ {
+		key := common.BigToHash(big.NewInt(int64(i)))
+		state.SetState(addr, key, key)
+	}
+	root, _ := state.Commit(false)
+	db.TrieDB().Commit(root, false, nil)
+
+	snaps, err := snapshot.New(db.TrieDB().DiskDB(), db.TrieDB(), 16, root, false, true, false)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	state, _ = New(root, db, snaps)
+	state.StartPrefetcher("test")
+	defer state.StopPrefetcher()
+
+	warm, cold := common.BigToHash(big.NewInt(1)), common.BigToHash(big.NewInt(2))
+	state.Prewarm(map[common.Address][]common.Hash{addr: {warm}, other: nil})
+
+	var (
+		storageRoot = state.StorageTrie(addr).Hash()
+		id          = state.prefetcher.trieID(crypto.Keccak256Hash(addr[:]), storageRoot)
+	)
+	for deadline := time.Now().Add(time.Second); ; {
+		state.prefetcher.lock.Lock()
+		scheduled := state.prefetcher.fetchers[id] != nil
+		state.prefetcher.lock.Unlock()
+
+		if scheduled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("storage trie not prewarmed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := state.prewarmed[other]; !ok {
+		t.Errorf("account without storage not prewarmed")
+	}
+	state.GetState(addr, warm)
+	state.GetState(addr, cold)
+
+	accessed := state.AccessedSlots()[addr]
+	if len(accessed) != 2 {
+		t.Errorf("accessed slot count mismatch: have %d, want 2", len(accessed))
+	}
+	state.StopPrefetcher()
+	if state.prewarmed != nil {
+		t.Errorf("prewarmed state not reset after reporting")
+	}
+}
+
+// Tests that the hot slots are the ones commonly accessed in contracts touched
+// by many blocks, and that they are forgotten once not accessed anymore.
+func TestHotSlots(t *testing.T) {
+	var (
+		hot   = NewHotSlots()
+		a, b  = common.Address{0xa}, common.Address{0xb}
+		often = common.Hash{0x1}
+		rare  = common.Hash{0x2}
+	)
+	for i := 0; i < hotDecayInterval; i++ {
+		accessed := map[common.Address][]common.Hash{a: {often}}
+		if i%4 == 0 {
+			accessed[a] = append(accessed[a], rare)
+		}
+		if i < 2 {
+			accessed[b] = []common.Hash{often}
+		}
+		hot.Record(accessed)
+	}
+	slots := hot.Slots()
+	if len(slots) != 1 || len(slots[a]) != 1 || slots[a][0] != often {
+		t.Fatalf("hot slots mismatch: have %v, want %v", slots, map[common.Address][]common.Hash{a: {often}})
+	}
+	for i := 0; i < 8*hotDecayInterval; i++ {
+		hot.Record(nil)
+	}
+	if slots := hot.Slots(); len(slots) != 0 {
+		t.Fatalf("stale hot slots not forgotten: %v", slots)
+	}
+	if len(hot.contracts) != 0 {
+		t.Fatalf("stale contracts still tracked: %d", len(hot.contracts))
+	}
+}
@@ -0,0 +1,593 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/state"
+	"github.com/avalanria/go-avalanria/core/state/snapshot"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/metrics"
+	"github.com/avalanria/go-avalanria/rlp"
+	"github.com/avalanria/go-avalanria/trie"
+)
+
+var (
+	onlineProtectedMeter = metrics.NewRegisteredMeter("state/prune/online/protected", nil)
+	onlineDeletedMeter   = metrics.NewRegisteredMeter("state/prune/online/deleted", nil)
+	onlineSizeMeter      = metrics.NewRegisteredMeter("state/prune/online/size", nil)
+	onlineProgressGauge  = metrics.NewRegisteredGauge("state/prune/online/progress", nil)
+)
+
+var (
+	// errPruningRunning is returned if an online pruning is requested while
+	// another one is already in progress.
+	errPruningRunning = errors.New("state pruning already running")
+
+	// errPruningAborted is returned if an online pruning is interrupted by the
+	// shutdown of the node.
+	errPruningAborted = errors.New("state pruning aborted")
+)
+
+// OnlineConfig contains the settings of online state pruning.
+type OnlineConfig struct {
+	BloomSize uint64        // Megabytes of memory allocated to the bloom filter of the live state
+	Throttle  time.Duration // Pause between deletion batches to limit the load on the live database
+}
+
+// DefaultOnlineConfig contains the default settings of online state pruning.
+var DefaultOnlineConfig = OnlineConfig{
+	BloomSize: 2048,
+	Throttle:  100 * time.Millisecond,
+}
+
+// Chain defines the mavnods of the live blockchain needed to prune its state.
+type Chain interface {
+	// CurrentBlock retrieves the current head block of the canonical chain.
+	CurrentBlock() *types.Block
+
+	// GetHeader retrieves a block header from the database by hash and number.
+	GetHeader(hash common.Hash, number uint64) *types.Header
+
+	// Snapshots returns the snapshot tree of the chain, nil if disabled.
+	Snapshots() *snapshot.Tree
+
+	// StateCache returns the caching database underpinning the chain's state.
+	StateCache() state.Database
+}
+
+// OnlineStatus is the progress report of an online state pruning.
+type OnlineStatus struct {
+	Running   bool               `json:"running"`         // Whavner a pruning is currently in progress
+	Phase     string             `json:"phase"`           // Stage of the pruning, protecting the live state or sweeping the stale one
+	Target    common.Hash        `json:"target"`          // Root of the persisted state the live state is built upon
+	Protected uint64             `json:"protected"`       // Number of trie nodes and codes marked live
+	Deleted   uint64             `json:"deleted"`         // Number of stale trie nodes and codes deleted
+	Size      common.StorageSize `json:"size"`            // Size of the stale state deleted
+	Progress  float64            `json:"progress"`        // Percentage of the database swept
+	Error     string             `json:"error,omitempty"` // Failure of the last pruning, if any
+}
+
+// OnlinePruner prunes the stale state of a live database in the background,
+// without taking the node down. The workflow is similar to the offline pruner:
+//
+// - mark the latest persisted state, the recent states built upon it and the
+//   genesis state as live in a bloom filter
+// - iterate the database, delete all state entries not marked live
+//
+// As the chain keeps progressing meanwhile, all the state entries written to
+// the database after the pruning started are marked live too. Deletions and
+// state writes are mutually exclusive, so an entry is never swept after being
+// (re)written by the chain.
+//
+// The sweep progress is persisted, so an interrupted pruning is resumed on the
+// next startup, rebuilding the set of live state from scratch.
+type OnlinePruner struct {
+	db     avndb.Database // Underlying database swept for stale state
+	config OnlineConfig
+
+	filter *stateBloom  // Bloom filter of the live state, nil if no pruning is running
+	lock   sync.RWMutex // Lock serializing state writes (read) against deletions (write)
+
+	status     OnlineStatus
+	statusLock sync.Mutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewOnlinePruner creates an online pruner of the given database. The chain
+// must access the database through the wrapper returned by Database, in order
+// for its newly written state not to be pruned.
+func NewOnlinePruner(db avndb.Database, config OnlineConfig) *OnlinePruner {
+	if config.BloomSize < 256 {
+		log.Warn("Sanitizing bloomfilter size", "provided(MB)", config.BloomSize, "updated(MB)", 256)
+		config.BloomSize = 256
+	}
+	return &OnlinePruner{
+		db:     db,
+		config: config,
+		quit:   make(chan struct{}),
+	}
+}
+
+// Database returns the wrapper of the pruned database marking all the state
+// written through it live while a pruning is running.
+func (p *OnlinePruner) Database() avndb.Database {
+	return &liveDatabase{Database: p.db, pruner: p}
+}
+
+// Start begins pruning the stale state of the given chain in the background.
+func (p *OnlinePruner) Start(chain Chain) error {
+	return p.start(chain, nil)
+}
+
+// Resume restarts an online pruning interrupted by a crash or shutdown from
+// where its sweep left off. It is a no-op if there's nothing to resume.
+func (p *OnlinePruner) Resume(chain Chain) error {
+	marker, ok := rawdb.ReadOnlinePruningMarker(p.db)
+	if !ok {
+		return nil
+	}
+	log.Info("Resuming interrupted state pruning", "marker", common.Bytes2Hex(marker))
+	return p.start(chain, marker)
+}
+
+// Stop interrupts any running pruning and waits for it to exit. A pruning in
+// its sweeping phase is resumed on the next startup.
+func (p *OnlinePruner) Stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// Status returns the progress of the running or last online pruning.
+func (p *OnlinePruner) Status() OnlineStatus {
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+
+	return p.status
+}
+
+// start launches a pruning of the chain's state, sweeping the database from the
+// given key on.
+func (p *OnlinePruner) start(chain Chain, marker []byte) error {
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+
+	if p.status.Running {
+		return errPruningRunning
+	}
+	if rawdb.ReadStateScheme(p.db) == rawdb.PathScheme {
+		return errPathScheme
+	}
+	select {
+	case <-p.quit:
+		return errPruningAborted
+	default:
+	}
+	p.status = OnlineStatus{Running: true, Phase: "protecting"}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		err := p.run(chain, marker)
+		switch {
+		case err == errPruningAborted:
+			log.Info("State pruning interrupted")
+		case err != nil:
+			log.Error("State pruning failed", "err", err)
+		}
+		p.statusLock.Lock()
+		p.status.Running = false
+		if err != nil {
+			p.status.Error = err.Error()
+		}
+		p.statusLock.Unlock()
+	}()
+	return nil
+}
+
+// run executes a full online pruning: marking the live state and sweeping all
+// the rest out of the database.
+func (p *OnlinePruner) run(chain Chain, marker []byte) error {
+	filter, err := newStateBloomWithSize(p.config.BloomSize)
+	if err != nil {
+		return err
+	}
+	// Start tracking the state written by the chain before looking at it, so
+	// nothing committed meanwhile slips through
+	p.lock.Lock()
+	p.filter = filter
+	p.lock.Unlock()
+
+	defer func() {
+		p.lock.Lock()
+		p.filter = nil
+		p.lock.Unlock()
+	}()
+	start := time.Now()
+	if err := p.protect(chain, filter); err != nil {
+		return err
+	}
+	p.updateStatus(func(status *OnlineStatus) { status.Phase = "sweeping" })
+	log.Info("Sweeping stale state", "elapsed", common.PrettyDuration(time.Since(start)))
+
+	return p.sweep(filter, marker, start)
+}
+
+// protect marks the entire live state of the chain in the bloom filter: the most
+// recent state persisted to disk, the genesis state, and all the recent states
+// built on top of the persisted one, both in the chain and the snapshot layers.
+func (p *OnlinePruner) protect(chain Chain, filter *stateBloom) error {
+	// The most recent persisted state is the base of all the in-memory ones
+	target := chain.CurrentBlock().Header()
+	for len(rawdb.ReadTrieNode(p.db, target.Root)) == 0 {
+		if target.Number.Sign() == 0 {
+			return errors.New("no persisted state")
+		}
+		parent := chain.GetHeader(target.ParentHash, target.Number.Uint64()-1)
+		if parent == nil {
+			return fmt.Errorf("missing header #%d [%x]", target.Number.Uint64()-1, target.ParentHash)
+		}
+		target = parent
+	}
+	p.updateStatus(func(status *OnlineStatus) { status.Target = target.Root })
+	log.Info("Protecting live state", "number", target.Number, "root", target.Root)
+
+	// The persisted state is entirely on disk, iterate it through a standalone
+	// trie database not to thrash the caches of the live chain.
+	if err := p.protectState(trie.NewDatabase(p.db), emptyRoot, target.Root, filter); err != nil {
+		return err
+	}
+	if err := extractGenesis(p.db, filter); err != nil {
+		return err
+	}
+	// Gather the recent states only now, after the long iteration above, so that
+	// any state being committed while the pruning started is already linked into
+	// the chain by now.
+	var (
+		head  = chain.CurrentBlock().Header()
+		roots []common.Hash
+	)
+	for header := head; header != nil && header.Number.Cmp(target.Number) > 0; header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1) {
+		roots = append(roots, header.Root)
+	}
+	for i, j := 0, len(roots)-1; i < j; i, j = i+1, j-1 {
+		roots[i], roots[j] = roots[j], roots[i]
+	}
+	if snaps := chain.Snapshots(); snaps != nil {
+		for _, layer := range snaps.Snapshots(head.Root, 129, false) {
+			roots = append(roots, layer.Root())
+		}
+	}
+	// Mark each recent state live by its difference to an already protected one,
+	// skipping the states no longer available (dereferenced from memory).
+	var (
+		triedb = chain.StateCache().TrieDB()
+		base   = target.Root
+		done   = map[common.Hash]struct{}{target.Root: {}}
+	)
+	for _, root := range roots {
+		if _, ok := done[root]; ok {
+			continue
+		}
+		done[root] = struct{}{}
+
+		err := p.protectState(triedb, base, root, filter)
+		if err != nil && err != errPruningAborted && base != target.Root {
+			err = p.protectState(triedb, target.Root, root, filter)
+		}
+		switch {
+		case err == errPruningAborted:
+			return err
+		case err != nil:
+			log.Debug("Skipping unavailable recent state", "root", root, "err", err)
+		default:
+			base = root
+		}
+	}
+	return nil
+}
+
+// protectState marks the trie nodes and contract codes of a state not contained
+// in an already protected base state live in the bloom filter.
+func (p *OnlinePruner) protectState(triedb *trie.Database, base, root common.Hash, filter *stateBloom) error {
+	accounts, err := trie.New(base, triedb)
+	if err != nil {
+		return err
+	}
+	return p.protectTrie(triedb, base, root, filter, func(key, blob []byte) error {
+		var acc state.Account
+		if err := rlp.DecodeBytes(blob, &acc); err != nil {
+			return err
+		}
+		// Only the storage trie changes since the base state need protecting
+		storage := emptyRoot
+		if prev, err := accounts.TryGet(key); err != nil {
+			return err
+		} else if len(prev) > 0 {
+			var old state.Account
+			if err := rlp.DecodeBytes(prev, &old); err != nil {
+				return err
+			}
+			storage = old.Root
+		}
+		if acc.Root != emptyRoot && acc.Root != storage {
+			if err := p.protectTrie(triedb, storage, acc.Root, filter, nil); err != nil {
+				return err
+			}
+		}
+		if !bytes.Equal(acc.CodeHash, emptyCode) {
+			filter.Put(acc.CodeHash, nil)
+		}
+		return nil
+	})
+}
+
+// protectTrie marks the nodes of a trie not contained in an already protected
+// base trie live in the bloom filter, invoking the callback on its new leaves.
+func (p *OnlinePruner) protectTrie(triedb *trie.Database, base, root common.Hash, filter *stateBloom, onleaf func(key, blob []byte) error) error {
+	t, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	iter := t.NodeIterator(nil)
+	if base != emptyRoot {
+		b, err := trie.New(base, triedb)
+		if err != nil {
+			return err
+		}
+		iter, _ = trie.NewDifferenceIterator(b.NodeIterator(nil), iter)
+	}
+	var (
+		count  uint64
+		logged = time.Now()
+	)
+	for iter.Next(true) {
+		if hash := iter.Hash(); hash != (common.Hash{}) {
+			filter.Put(hash.Bytes(), nil)
+			count++
+		}
+		if iter.Leaf() && onleaf != nil {
+			if err := onleaf(iter.LeafKey(), iter.LeafBlob()); err != nil {
+				return err
+			}
+		}
+		if count%10000 == 0 {
+			select {
+			case <-p.quit:
+				return errPruningAborted
+			default:
+			}
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Protecting live state", "root", root, "nodes", count)
+				logged = time.Now()
+			}
+		}
+	}
+	onlineProtectedMeter.Mark(int64(count))
+	p.updateStatus(func(status *OnlineStatus) { status.Protected += count })
+
+	return iter.Error()
+}
+
+// sweepEntry is a state entry found stale during the database iteration.
+type sweepEntry struct {
+	key  []byte
+	size common.StorageSize
+}
+
+// sweep deletes all the state entries from the database not marked live in the
+// bloom filter, starting at the given key.
+func (p *OnlinePruner) sweep(filter *stateBloom, marker []byte, start time.Time) error {
+	// Mark the pruning as started, from now on it needs to be finished
+	rawdb.WriteOnlinePruningMarker(p.db, marker)
+
+	var (
+		stale  []sweepEntry
+		size   common.StorageSize
+		logged = time.Now()
+		iter   = p.db.NewIterator(nil, marker)
+	)
+	for iter.Next() {
+		key := iter.Key()
+
+		isCode, codeKey := rawdb.IsCodeKey(key)
+		if len(key) != common.HashLength && !isCode {
+			continue
+		}
+		checkKey := key
+		if isCode {
+			checkKey = codeKey
+		}
+		if ok, _ := filter.Contain(checkKey); ok {
+			continue
+		}
+		entry := sweepEntry{key: common.CopyBytes(key), size: common.StorageSize(len(key) + len(iter.Value()))}
+		stale, size = append(stale, entry), size+entry.size
+
+		if size < avndb.IdealBatchSize {
+			continue
+		}
+		if err := p.delete(filter, stale, key); err != nil {
+			iter.Release()
+			return err
+		}
+		stale, size = stale[:0], 0
+
+		if time.Since(logged) > 8*time.Second {
+			status := p.Status()
+			log.Info("Pruning state data", "nodes", status.Deleted, "size", status.Size,
+				"progress", fmt.Sprintf("%.2f%%", status.Progress), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		// Give the chain some breathing room and recreate the iterator to
+		// allow the underlying compactor to drop the deleted entries.
+		iter.Release()
+		select {
+		case <-time.After(p.config.Throttle):
+		case <-p.quit:
+			return errPruningAborted
+		}
+		iter = p.db.NewIterator(nil, key)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := p.delete(filter, stale, nil); err != nil {
+		return err
+	}
+	rawdb.DeleteOnlinePruningMarker(p.db)
+
+	status := p.Status()
+	log.Info("State pruning successful", "nodes", status.Deleted, "pruned", status.Size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// delete removes a batch of stale state entries from the database, persisting
+// the progress marker atomically with them. The entries are checked against the
+// live state once more, as the chain might have rewritten them meanwhile.
+func (p *OnlinePruner) delete(filter *stateBloom, stale []sweepEntry, marker []byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var (
+		batch = p.db.NewBatch()
+		count int
+		size  common.StorageSize
+	)
+	for _, entry := range stale {
+		checkKey := entry.key
+		if isCode, codeKey := rawdb.IsCodeKey(entry.key); isCode {
+			checkKey = codeKey
+		}
+		if ok, _ := filter.Contain(checkKey); ok {
+			continue
+		}
+		batch.Delete(entry.key)
+		count, size = count+1, size+entry.size
+	}
+	if marker != nil {
+		rawdb.WriteOnlinePruningMarker(batch, marker)
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	onlineDeletedMeter.Mark(int64(count))
+	onlineSizeMeter.Mark(int64(size))
+
+	// Report the sweep progress by the position in the key space
+	var progress float64
+	if marker == nil {
+		progress = 100
+	} else if len(marker) >= 8 {
+		progress = float64(binary.BigEndian.Uint64(marker[:8])) / math.MaxUint64 * 100
+	}
+	onlineProgressGauge.Update(int64(progress * 100))
+
+	p.updateStatus(func(status *OnlineStatus) {
+		status.Deleted += uint64(count)
+		status.Size += size
+		status.Progress = progress
+	})
+	return nil
+}
+
+// updateStatus applies a modification to the progress report.
+func (p *OnlinePruner) updateStatus(update func(status *OnlineStatus)) {
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+
+	update(&p.status)
+}
+
+// liveDatabase wraps the pruned database, marking all the state entries written
+// through it live while a pruning is running.
+type liveDatabase struct {
+	avndb.Database
+	pruner *OnlinePruner
+}
+
+// Put inserts the given value into the key-value data store.
+func (db *liveDatabase) Put(key []byte, value []byte) error {
+	db.pruner.lock.RLock()
+	defer db.pruner.lock.RUnlock()
+
+	if filter := db.pruner.filter; filter != nil {
+		(liveWriter{filter}).Put(key, value)
+	}
+	return db.Database.Put(key, value)
+}
+
+// NewBatch creates a write-only database that buffers changes to its host db
+// until a final write is called.
+func (db *liveDatabase) NewBatch() avndb.Batch {
+	return &liveBatch{Batch: db.Database.NewBatch(), pruner: db.pruner}
+}
+
+// liveBatch wraps a batch of the pruned database, marking all the state entries
+// written through it live while a pruning is running.
+type liveBatch struct {
+	avndb.Batch
+	pruner *OnlinePruner
+}
+
+// Write flushes any accumulated data to disk.
+func (b *liveBatch) Write() error {
+	b.pruner.lock.RLock()
+	defer b.pruner.lock.RUnlock()
+
+	if filter := b.pruner.filter; filter != nil {
+		if err := b.Batch.Replay(liveWriter{filter}); err != nil {
+			return err
+		}
+	}
+	return b.Batch.Write()
+}
+
+// liveWriter is a key-value writer marking the state entries put into it live
+// in the bloom filter, ignoring all other data.
+type liveWriter struct {
+	filter *stateBloom
+}
+
+// Put implements the KeyValueWriter interface, marking state entries live.
+func (w liveWriter) Put(key []byte, value []byte) error {
+	if len(key) == common.HashLength {
+		return w.filter.Put(key, nil)
+	}
+	if isCode, _ := rawdb.IsCodeKey(key); isCode {
+		return w.filter.Put(key, nil)
+	}
+	return nil
+}
+
+// Delete implements the KeyValueWriter interface, ignoring deletions.
+func (w liveWriter) Delete(key []byte) error { return nil }
@@ -0,0 +1,145 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/consensus/avnash"
+	"github.com/avalanria/go-avalanria/core"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/vm"
+	"github.com/avalanria/go-avalanria/params"
+	"github.com/avalanria/go-avalanria/trie"
+)
+
+// Tests that online pruning deletes the stale states of a live chain, while
+// keeping the head and genesis states intact.
+func TestOnlinePruning(t *testing.T) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		pruner = &OnlinePruner{
+			db:     diskdb,
+			config: OnlineConfig{BloomSize: 1},
+			quit:   make(chan struct{}),
+		}
+		db      = pruner.Database()
+		genesis = (&core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{common.Address{0x01}: {Balance: big.NewInt(1)}},
+		}).MustCommit(db)
+	)
+	// Every block credits a new coinbase, leaving the previous states stale. Keep
+	// all of them on disk, as an archive node would.
+	blocks, _ := core.GenerateChain(params.TestChainConfig, genesis, avnash.NewFaker(), db, 16, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{0x02, byte(i)})
+	})
+	chain, err := core.NewBlockChain(db, &core.CacheConfig{TrieDirtyDisabled: true}, params.TestChainConfig, avnash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for _, block := range blocks {
+		if len(rawdb.ReadTrieNode(diskdb, block.Root())) == 0 {
+			t.Fatalf("state of block #%d missing before pruning", block.NumberU64())
+		}
+	}
+	if err := pruner.run(chain, nil); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	if status := pruner.Status(); status.Deleted == 0 || status.Progress != 100 {
+		t.Errorf("unexpected pruning status: deleted %d, progress %f", status.Deleted, status.Progress)
+	}
+	if _, ok := rawdb.ReadOnlinePruningMarker(diskdb); ok {
+		t.Errorf("pruning marker not deleted")
+	}
+	// The stale states should be gone, the live ones fully available
+	for _, block := range blocks[:len(blocks)-1] {
+		if len(rawdb.ReadTrieNode(diskdb, block.Root())) != 0 {
+			t.Errorf("stale state of block #%d not pruned", block.NumberU64())
+		}
+	}
+	for _, root := range []common.Hash{genesis.Root(), blocks[len(blocks)-1].Root()} {
+		tr, err := trie.New(root, trie.NewDatabase(diskdb))
+		if err != nil {
+			t.Fatalf("live state %x missing: %v", root, err)
+		}
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+		}
+		if it.Error() != nil {
+			t.Errorf("live state %x corrupted: %v", root, it.Error())
+		}
+	}
+	// The chain should keep progressing on top of the pruned state
+	more, _ := core.GenerateChain(params.TestChainConfig, blocks[len(blocks)-1], avnash.NewFaker(), db, 4, nil)
+	if _, err := chain.InsertChain(more); err != nil {
+		t.Fatalf("failed to extend pruned chain: %v", err)
+	}
+}
+
+// Tests that the state written while a pruning is running is never swept.
+func TestOnlinePruningLiveWrites(t *testing.T) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		pruner = NewOnlinePruner(diskdb, OnlineConfig{BloomSize: 256})
+		db     = pruner.Database()
+	)
+	filter, err := newStateBloomWithSize(1)
+	if err != nil {
+		t.Fatalf("failed to create bloom: %v", err)
+	}
+	pruner.filter = filter
+
+	var (
+		direct  = common.Hash{0x01}
+		batched = common.Hash{0x02}
+		code    = common.Hash{0x03}
+		stale   = common.Hash{0x04}
+	)
+	db.Put(direct.Bytes(), []byte{0x01})
+
+	batch := db.NewBatch()
+	batch.Put(batched.Bytes(), []byte{0x02})
+	rawdb.WriteCode(batch, code, []byte{0x03})
+	if err := batch.Write(); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+	rawdb.WriteTrieNode(diskdb, stale, []byte{0x04})
+
+	if err := pruner.sweep(filter, nil, time.Now()); err != nil {
+		t.Fatalf("failed to sweep state: %v", err)
+	}
+	for _, hash := range []common.Hash{direct, batched} {
+		if len(rawdb.ReadTrieNode(diskdb, hash)) == 0 {
+			t.Errorf("live node %x swept", hash)
+		}
+	}
+	if len(rawdb.ReadCode(diskdb, code)) == 0 {
+		t.Errorf("live code %x swept", code)
+	}
+	if len(rawdb.ReadTrieNode(diskdb, stale)) != 0 {
+		t.Errorf("stale node %x not swept", stale)
+	}
+}
@@ -62,6 +62,10 @@ var (
 
 	// emptyCode is the known hash of the empty EVM bytecode.
 	emptyCode = crypto.Keccak256(nil)
+
+	// errPathScheme is returned if pruning is requested for a state stored with
+	// the path-based scheme, which overwrites the stale trie nodes by itself.
+	errPathScheme = errors.New("state pruning unsupported with the path-based scheme")
 )
 
 // Pruner is an offline tool to prune the stale state with the
@@ -86,6 +90,9 @@ type Pruner struct {
 
 // NewPruner creates the pruner instance.
 func NewPruner(db avndb.Database, datadir, trieCachePath string, bloomSize uint64) (*Pruner, error) {
+	if rawdb.ReadStateScheme(db) == rawdb.PathScheme {
+		return nil, errPathScheme
+	}
 	headBlock := rawdb.ReadHeadBlock(db)
 	if headBlock == nil {
 		return nil, errors.New("Failed to load head block")
@@ -307,7 +307,7 @@ func TestDiskPartialMerge(t *testing.T) {
 				},
 			},
 		}
-		snaps.layers[baseRoot].(*diskLayer).genMarker = genMarker
+		snaps.layers[baseRoot].(*diskLayer).genMarkers = [][]byte{genMarker}
 		base := snaps.Snapshot(baseRoot)
 
 		// assertAccount ensures that an account matches the given blob if it's
@@ -458,10 +458,10 @@ func TestDiskGeneratorPersistence(t *testing.T) {
 	snaps := &Tree{
 		layers: map[common.Hash]snapshot{
 			baseRoot: &diskLayer{
-				diskdb:    db,
-				cache:     fastcache.New(500 * 1024),
-				root:      baseRoot,
-				genMarker: genMarker,
+				diskdb:     db,
+				cache:      fastcache.New(500 * 1024),
+				root:       baseRoot,
+				genMarkers: [][]byte{genMarker},
 			},
 		},
 	}
@@ -492,7 +492,7 @@ func TestDiskGeneratorPersistence(t *testing.T) {
 		t.Fatalf("failed to update snapshot tree: %v", err)
 	}
 	diskLayer := snaps.layers[snaps.diskRoot()].(*diskLayer)
-	diskLayer.genMarker = nil // Construction finished
+	diskLayer.genMarkers = nil // Construction finished
 	if err := snaps.Cap(diffTwoRoot, 0); err != nil {
 		t.Fatalf("failed to flatten snapshot tree: %v", err)
 	}
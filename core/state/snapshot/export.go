@@ -0,0 +1,777 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/avndb/memorydb"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/rlp"
+	"github.com/avalanria/go-avalanria/trie"
+)
+
+const (
+	// exportVersion is the version of the state export format.
+	exportVersion uint64 = 2
+
+	// exportManifestName is the name of the file describing an export.
+	exportManifestName = "manifest.rlp"
+)
+
+var (
+	// exportRangeSize is the soft limit of the data held by a single account or
+	// storage range of an export, each proven individually.
+	exportRangeSize = 1024 * 1024
+
+	// exportFileSize is the soft limit of the size of a single export chunk file.
+	exportFileSize = 256 * 1024 * 1024
+
+	// exportAncestors is the minimum number of headers preceding the exported block
+	// an export needs to carry, so that the BLOCKHASH opcode works on top of it.
+	exportAncestors = 256
+)
+
+var (
+	// errExportIncomplete is returned if the ranges of an export end before the
+	// whole state is covered.
+	errExportIncomplete = errors.New("state export incomplete")
+
+	// errExportPathScheme is returned if an export is imported into a database
+	// storing its state with the path-based scheme.
+	errExportPathScheme = errors.New("state import unsupported with the path-based scheme")
+)
+
+// exportManifest describes a state export, written after all the chunk files
+// so an interrupted export is detected on import.
+type exportManifest struct {
+	Version   uint64
+	Block     *types.Block    // Block the exported state belongs to
+	Ancestors []*types.Header // Headers preceding the block, oldest first
+	TD        *big.Int        // Total difficulty of the block
+	Files     uint64          // Number of chunk files the export consists of
+	Accounts  uint64
+	Slots     uint64
+}
+
+// exportRange is a continuous range of accounts, or storage slots of a single
+// account, along with the Merkle proofs of the range boundaries. The ranges of
+// an export follow each other in order: every account range is followed by the
+// storage ranges of its accounts, in the order of the accounts.
+type exportRange struct {
+	Account common.Hash   // Account owning the storage slots, empty for account ranges
+	Origin  common.Hash   // First key of the range, not necessarily existing
+	Keys    []common.Hash // Hashes of the accounts or slots in the range
+	Vals    [][]byte      // Accounts in slim RLP format or slot values
+	Proof   [][]byte      // Nodes proving the range boundaries, empty if the range is the whole trie
+	Codes   [][]byte      // Contract codes of the accounts in the range
+}
+
+// exportFileName returns the name of the index-th chunk file of an export.
+func exportFileName(index uint64) string {
+	return fmt.Sprintf("chunk-%05d.rlp", index)
+}
+
+// exportWriter writes the ranges of an export into the chunk files, starting a
+// new one whenever the current one exceeds the size limit.
+type exportWriter struct {
+	dir   string
+	file  *os.File
+	buf   *bufio.Writer
+	size  int
+	files uint64
+}
+
+// write appends a range to the current chunk file.
+func (w *exportWriter) write(r *exportRange) error {
+	if w.file == nil || w.size >= exportFileSize {
+		if err := w.close(); err != nil {
+			return err
+		}
+		file, err := os.Create(filepath.Join(w.dir, exportFileName(w.files)))
+		if err != nil {
+			return err
+		}
+		w.file, w.buf, w.size = file, bufio.NewWriter(file), 0
+		w.files++
+	}
+	blob, err := rlp.EncodeToBytes(r)
+	if err != nil {
+		return err
+	}
+	w.size += len(blob)
+	_, err = w.buf.Write(blob)
+	return err
+}
+
+// close flushes and closes the current chunk file, if any.
+func (w *exportWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	err := w.file.Close()
+	w.file, w.buf = nil, nil
+	return err
+}
+
+// ExportAncestry reads the headers preceding a block to export, oldest first.
+// Beyond the ones needed for the BLOCKHASH opcode, they reach back to the latest
+// checkpoint of the consensus engine, if it has an epoch, so that it can rebuild
+// its state without the older headers.
+func ExportAncestry(db avndb.Reader, header *types.Header, epoch uint64) ([]*types.Header, error) {
+	number := header.Number.Uint64()
+	if number <= 1 {
+		return nil, nil
+	}
+	first := uint64(1)
+	if number > uint64(exportAncestors) {
+		first = number - uint64(exportAncestors)
+		if epoch > 0 {
+			first -= first % epoch
+		}
+		if first == 0 {
+			first = 1
+		}
+	}
+	var (
+		headers = make([]*types.Header, number-first)
+		hash    = header.ParentHash
+	)
+	for n := number - 1; n >= first; n-- {
+		ancestor := rawdb.ReadHeader(db, hash, n)
+		if ancestor == nil {
+			return nil, fmt.Errorf("missing header #%d [%x]", n, hash)
+		}
+		headers[n-first], hash = ancestor, ancestor.ParentHash
+	}
+	return headers, nil
+}
+
+// proveExportRange collects the Merkle proofs of the first and last key of a range.
+func proveExportRange(tr *trie.Trie, origin common.Hash, keys []common.Hash) ([][]byte, error) {
+	proof := memorydb.New()
+	if err := tr.Prove(origin[:], 0, proof); err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		if err := tr.Prove(keys[len(keys)-1][:], 0, proof); err != nil {
+			return nil, err
+		}
+	}
+	var nodes [][]byte
+	it := proof.NewIterator(nil, nil)
+	defer it.Release()
+
+	for it.Next() {
+		nodes = append(nodes, common.CopyBytes(it.Value()))
+	}
+	return nodes, nil
+}
+
+// Export writes the state of the given block into chunk files in the specified
+// directory, using the snapshot as the data source and the trie for the range
+// proofs. Contract codes are read from the given database. The block itself, the
+// headers preceding it and its total difficulty are included, so the import can
+// make it the chain head.
+//
+// The ancestors need to be contiguous, oldest first, at least exportAncestors of
+// them unless reaching back to the genesis. Consensus engines checkpointing their
+// state require them to start at a checkpoint block too.
+func Export(snaptree *Tree, triedb *trie.Database, codedb avndb.KeyValueReader, block *types.Block, ancestors []*types.Header, td *big.Int, dir string) error {
+	if err := verifyExportAncestors(block, ancestors); err != nil {
+		return err
+	}
+	root := block.Root()
+	accTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return err // The state trie is required for proving the ranges
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var (
+		writer   = &exportWriter{dir: dir}
+		manifest = &exportManifest{Version: exportVersion, Block: block, Ancestors: ancestors, TD: td}
+		origin   common.Hash
+		start    = time.Now()
+		logged   = time.Now()
+	)
+	defer writer.close()
+
+	for {
+		// Collect the next range of accounts up to the size limit
+		accIt, err := snaptree.AccountIterator(root, origin)
+		if err != nil {
+			return err
+		}
+		var (
+			r        = &exportRange{Origin: origin}
+			size     int
+			more     bool
+			contract []common.Hash
+			codes    = make(map[common.Hash]struct{})
+		)
+		for accIt.Next() {
+			if size >= exportRangeSize {
+				more = true
+				break
+			}
+			hash, blob := accIt.Hash(), common.CopyBytes(accIt.Account())
+			account, err := FullAccount(blob)
+			if err != nil {
+				accIt.Release()
+				return err
+			}
+			if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCode {
+				if _, ok := codes[codeHash]; !ok {
+					code := rawdb.ReadCode(codedb, codeHash)
+					if len(code) == 0 {
+						accIt.Release()
+						return fmt.Errorf("missing code %x of account %x", codeHash, hash)
+					}
+					codes[codeHash] = struct{}{}
+					r.Codes = append(r.Codes, code)
+					size += len(code)
+				}
+			}
+			if common.BytesToHash(account.Root) != emptyRoot {
+				contract = append(contract, hash)
+			}
+			r.Keys = append(r.Keys, hash)
+			r.Vals = append(r.Vals, blob)
+			size += common.HashLength + len(blob)
+		}
+		err = accIt.Error()
+		accIt.Release()
+		if err != nil {
+			return err
+		}
+		// Prove the range, unless it's the whole trie
+		if origin != (common.Hash{}) || more {
+			if r.Proof, err = proveExportRange(accTrie, origin, r.Keys); err != nil {
+				return err
+			}
+		}
+		if err := writer.write(r); err != nil {
+			return err
+		}
+		manifest.Accounts += uint64(len(r.Keys))
+
+		// Export the storage of the contracts in the range
+		for _, account := range contract {
+			slots, err := exportStorage(snaptree, triedb, writer, root, account)
+			if err != nil {
+				return err
+			}
+			manifest.Slots += slots
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting state snapshot", "at", origin, "accounts", manifest.Accounts, "slots", manifest.Slots,
+				"files", writer.files, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		if !more {
+			break
+		}
+		next := increaseKey(common.CopyBytes(r.Keys[len(r.Keys)-1][:]))
+		if next == nil {
+			break
+		}
+		origin = common.BytesToHash(next)
+	}
+	if err := writer.close(); err != nil {
+		return err
+	}
+	// Write the manifest last, marking the export complete
+	manifest.Files = writer.files
+	blob, err := rlp.EncodeToBytes(manifest)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, exportManifestName), blob, 0644); err != nil {
+		return err
+	}
+	log.Info("Exported state snapshot", "root", root, "accounts", manifest.Accounts, "slots", manifest.Slots,
+		"files", manifest.Files, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// exportStorage writes the storage of the given account as one or more ranges,
+// returning the number of exported slots.
+func exportStorage(snaptree *Tree, triedb *trie.Database, writer *exportWriter, root common.Hash, account common.Hash) (uint64, error) {
+	blob, err := snaptree.Snapshot(root).AccountRLP(account)
+	if err != nil {
+		return 0, err
+	}
+	acc, err := FullAccount(blob)
+	if err != nil {
+		return 0, err
+	}
+	stTrie, err := trie.NewWithOwner(account, common.BytesToHash(acc.Root), triedb)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		origin common.Hash
+		slots  uint64
+	)
+	for {
+		stIt, err := snaptree.StorageIterator(root, account, origin)
+		if err != nil {
+			return 0, err
+		}
+		var (
+			r    = &exportRange{Account: account, Origin: origin}
+			size int
+			more bool
+		)
+		for stIt.Next() {
+			if size >= exportRangeSize {
+				more = true
+				break
+			}
+			r.Keys = append(r.Keys, stIt.Hash())
+			r.Vals = append(r.Vals, common.CopyBytes(stIt.Slot()))
+			size += common.HashLength + len(stIt.Slot())
+		}
+		err = stIt.Error()
+		stIt.Release()
+		if err != nil {
+			return 0, err
+		}
+		if origin != (common.Hash{}) || more {
+			if r.Proof, err = proveExportRange(stTrie, origin, r.Keys); err != nil {
+				return 0, err
+			}
+		}
+		if err := writer.write(r); err != nil {
+			return 0, err
+		}
+		slots += uint64(len(r.Keys))
+
+		if !more {
+			return slots, nil
+		}
+		next := increaseKey(common.CopyBytes(r.Keys[len(r.Keys)-1][:]))
+		if next == nil {
+			return slots, nil
+		}
+		origin = common.BytesToHash(next)
+	}
+}
+
+// importer tracks the progress of an import, checking that the ranges follow
+// each other in the expected order without gaps.
+type importer struct {
+	batch avndb.Batch
+	root  common.Hash
+
+	accTrie *trie.StackTrie
+	accNext common.Hash // Origin of the next account range
+	accDone bool        // Whavner the last account range was already imported
+
+	pending []common.Hash        // Contracts in the last account range, storage not yet imported
+	roots   []common.Hash        // Storage roots of the pending contracts
+	stTrie  *trie.StackTrie      // Storage trie of the first pending contract
+	stNext  common.Hash          // Origin of the next storage range of the first pending contract
+	codes   map[common.Hash]bool // Contract codes imported so far
+}
+
+// verifyExportRange checks the Merkle proof of a range against the given trie root,
+// returning whavner the trie has more entries after the range.
+func verifyExportRange(root common.Hash, r *exportRange, vals [][]byte) (bool, error) {
+	keys := make([][]byte, len(r.Keys))
+	for i := range r.Keys {
+		keys[i] = r.Keys[i][:]
+	}
+	if len(r.Proof) == 0 {
+		// No proof attached, the range must be the entire trie
+		if r.Origin != (common.Hash{}) {
+			return false, errors.New("unproven partial range")
+		}
+		return trie.VerifyRangeProof(root, nil, nil, keys, vals, nil)
+	}
+	proof := memorydb.New()
+	for _, node := range r.Proof {
+		proof.Put(crypto.Keccak256(node), node)
+	}
+	var last []byte
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	return trie.VerifyRangeProof(root, r.Origin[:], last, keys, vals, proof)
+}
+
+// importAccounts verifies and imports a range of accounts.
+func (imp *importer) importAccounts(r *exportRange) error {
+	if imp.accDone || len(imp.pending) > 0 || r.Origin != imp.accNext {
+		return fmt.Errorf("unexpected account range at %x", r.Origin)
+	}
+	if len(r.Keys) != len(r.Vals) {
+		return fmt.Errorf("account range at %x malformed: %d keys, %d values", r.Origin, len(r.Keys), len(r.Vals))
+	}
+	vals := make([][]byte, len(r.Vals))
+	for i, blob := range r.Vals {
+		full, err := FullAccountRLP(blob)
+		if err != nil {
+			return err
+		}
+		vals[i] = full
+	}
+	more, err := verifyExportRange(imp.root, r, vals)
+	if err != nil {
+		return fmt.Errorf("account range at %x failed proof: %v", r.Origin, err)
+	}
+	// Range valid, import the contract codes referenced by it
+	needed := make(map[common.Hash]struct{})
+	for i, key := range r.Keys {
+		account, err := FullAccount(r.Vals[i])
+		if err != nil {
+			return err
+		}
+		if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCode {
+			needed[codeHash] = struct{}{}
+		}
+		if root := common.BytesToHash(account.Root); root != emptyRoot {
+			imp.pending = append(imp.pending, key)
+			imp.roots = append(imp.roots, root)
+		}
+	}
+	for _, code := range r.Codes {
+		hash := crypto.Keccak256Hash(code)
+		if _, ok := needed[hash]; !ok {
+			return fmt.Errorf("unreferenced code %x in account range at %x", hash, r.Origin)
+		}
+		rawdb.WriteCode(imp.batch, hash, code)
+		imp.codes[hash] = true
+	}
+	for hash := range needed {
+		if !imp.codes[hash] {
+			return fmt.Errorf("missing code %x in account range at %x", hash, r.Origin)
+		}
+	}
+	// Write the flat accounts and the trie nodes
+	for i, key := range r.Keys {
+		rawdb.WriteAccountSnapshot(imp.batch, key, r.Vals[i])
+		imp.accTrie.TryUpdate(key[:], vals[i])
+	}
+	if !more || len(r.Keys) == 0 {
+		imp.accDone = true
+	} else if next := increaseKey(common.CopyBytes(r.Keys[len(r.Keys)-1][:])); next == nil {
+		imp.accDone = true
+	} else {
+		imp.accNext = common.BytesToHash(next)
+	}
+	return nil
+}
+
+// importStorage verifies and imports a range of storage slots.
+func (imp *importer) importStorage(r *exportRange) error {
+	if len(imp.pending) == 0 || r.Account != imp.pending[0] || r.Origin != imp.stNext {
+		return fmt.Errorf("unexpected storage range of %x at %x", r.Account, r.Origin)
+	}
+	if len(r.Keys) != len(r.Vals) || len(r.Codes) > 0 {
+		return fmt.Errorf("storage range of %x at %x malformed", r.Account, r.Origin)
+	}
+	more, err := verifyExportRange(imp.roots[0], r, r.Vals)
+	if err != nil {
+		return fmt.Errorf("storage range of %x at %x failed proof: %v", r.Account, r.Origin, err)
+	}
+	if imp.stTrie == nil {
+		imp.stTrie = trie.NewStackTrie(imp.batch)
+	}
+	for i, key := range r.Keys {
+		rawdb.WriteStorageSnapshot(imp.batch, r.Account, key, r.Vals[i])
+		imp.stTrie.TryUpdate(key[:], r.Vals[i])
+	}
+	if more && len(r.Keys) > 0 {
+		if next := increaseKey(common.CopyBytes(r.Keys[len(r.Keys)-1][:])); next != nil {
+			imp.stNext = common.BytesToHash(next)
+			return nil
+		}
+	}
+	// Storage of the contract complete, commit the trie
+	root, err := imp.stTrie.Commit()
+	if err != nil {
+		return err
+	}
+	if root != imp.roots[0] {
+		return fmt.Errorf("storage root mismatch of %x: have %x, want %x", r.Account, root, imp.roots[0])
+	}
+	imp.pending, imp.roots = imp.pending[1:], imp.roots[1:]
+	imp.stTrie, imp.stNext = nil, common.Hash{}
+	return nil
+}
+
+// Import reads a state export from the given directory, verifying every range
+// against the state root of the exported block, and writes the flat snapshot
+// along with the trie nodes and contract codes into the database. The block is
+// authenticated by the expected hash, and becomes the head of the local chain
+// along with the exported headers preceding it, so that the node continues from
+// the imported state on its next start. If the headers don't reach back to the
+// genesis, the gap is recorded and the chain is never moved into the freezer.
+//
+// Only a fresh chain, not advanced past its genesis, can be bootstrapped this
+// way. Alternatively the state of the current head block may be re-imported.
+// Any previous snapshot is only dropped once the whole export has been verified,
+// so a corrupt export leaves the database untouched.
+func Import(db avndb.Database, dir string, hash common.Hash) (*types.Block, error) {
+	if rawdb.ReadStateScheme(db) == rawdb.PathScheme {
+		return nil, errExportPathScheme
+	}
+	blob, err := ioutil.ReadFile(filepath.Join(dir, exportManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var manifest exportManifest
+	if err := rlp.DecodeBytes(blob, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version != exportVersion {
+		return nil, fmt.Errorf("unsupported export version %d", manifest.Version)
+	}
+	block := manifest.Block
+	if block == nil || block.Hash() != hash {
+		return nil, fmt.Errorf("exported block mismatch: want %x", hash)
+	}
+	if err := verifyExportAncestors(block, manifest.Ancestors); err != nil {
+		return nil, err
+	}
+	if err := verifyExportBlock(block, manifest.Ancestors, manifest.TD); err != nil {
+		return nil, err
+	}
+	first := block.Header()
+	if len(manifest.Ancestors) > 0 {
+		first = manifest.Ancestors[0]
+	}
+	if first.Number.Uint64() == 1 && first.ParentHash != rawdb.ReadCanonicalHash(db, 0) {
+		return nil, fmt.Errorf("exported chain on different genesis %x", first.ParentHash)
+	}
+	if head := rawdb.ReadHeadBlockHash(db); head != hash {
+		number := rawdb.ReadHeaderNumber(db, head)
+		if number == nil {
+			return nil, errors.New("missing genesis, initialize the chain before importing state")
+		}
+		if *number != 0 {
+			return nil, fmt.Errorf("chain already at block #%d, state can only be imported into a fresh chain", *number)
+		}
+	}
+	root := block.Root()
+
+	// Verify the entire export against the state root before touching the database
+	start := time.Now()
+	if _, _, err := importRanges(memorydb.New().NewBatch(), dir, &manifest, false); err != nil {
+		return nil, err
+	}
+	log.Info("Verified state snapshot export", "root", root, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// The export is known to apply, drop any previous snapshot and replace it
+	rawdb.DeleteSnapshotRoot(db)
+	rawdb.DeleteSnapshotJournal(db)
+	rawdb.DeleteSnapshotRecoveryNumber(db)
+	rawdb.DeleteSnapshotDisabled(db)
+	if err := wipeContent(db); err != nil {
+		return nil, err
+	}
+	batch := db.NewBatch()
+	accounts, slots, err := importRanges(batch, dir, &manifest, true)
+	if err != nil {
+		return nil, err
+	}
+	// All the state is in place, mark the snapshot complete
+	rawdb.WriteSnapshotRoot(batch, root)
+	journalProgress(batch, nil, &generatorStats{accounts: accounts, slots: slots})
+
+	// Make the block the head of the chain on top of its ancestors, dropping any
+	// canonical headers above
+	number := block.NumberU64()
+	for n := number + 1; rawdb.ReadCanonicalHash(db, n) != (common.Hash{}); n++ {
+		rawdb.DeleteCanonicalHash(batch, n)
+	}
+	rawdb.WriteTd(batch, hash, number, manifest.TD)
+	rawdb.WriteBlock(batch, block)
+	rawdb.WriteTxLookupEntriesByBlock(batch, block)
+	rawdb.WriteCanonicalHash(batch, hash, number)
+
+	td, child := new(big.Int).Set(manifest.TD), block.Header()
+	for i := len(manifest.Ancestors) - 1; i >= 0; i-- {
+		header := manifest.Ancestors[i]
+		td.Sub(td, child.Difficulty)
+
+		rawdb.WriteTd(batch, header.Hash(), header.Number.Uint64(), td)
+		rawdb.WriteHeader(batch, header)
+		rawdb.WriteCanonicalHash(batch, header.Hash(), header.Number.Uint64())
+		child = header
+	}
+	if tail := first.Number.Uint64(); tail > 1 {
+		rawdb.WriteChainImportTail(batch, tail)
+	}
+	rawdb.WriteHeadHeaderHash(batch, hash)
+	rawdb.WriteHeadFastBlockHash(batch, hash)
+	rawdb.WriteHeadBlockHash(batch, hash)
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	log.Info("Imported state snapshot", "number", number, "hash", hash, "root", root, "accounts", accounts, "slots", slots,
+		"elapsed", common.PrettyDuration(time.Since(start)))
+	return block, nil
+}
+
+// verifyExportBlock checks that the body of an exported block matches its header,
+// which is authenticated by the hash, and that the total difficulty covers both
+// the block and its exported ancestors.
+func verifyExportBlock(block *types.Block, ancestors []*types.Header, td *big.Int) error {
+	if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != block.TxHash() {
+		return fmt.Errorf("exported transactions mismatch: have %x, want %x", hash, block.TxHash())
+	}
+	if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+		return fmt.Errorf("exported uncles mismatch: have %x, want %x", hash, block.UncleHash())
+	}
+	diff := new(big.Int).Set(block.Difficulty())
+	for _, header := range ancestors {
+		diff.Add(diff, header.Difficulty)
+	}
+	if td == nil || td.Cmp(diff) < 0 {
+		return fmt.Errorf("invalid total difficulty %v of exported block", td)
+	}
+	return nil
+}
+
+// verifyExportAncestors checks that the headers preceding an exported block form
+// a contiguous chain leading up to it, long enough for the BLOCKHASH opcode.
+func verifyExportAncestors(block *types.Block, ancestors []*types.Header) error {
+	// Short chains need all the headers down to the genesis, which isn't exported
+	var (
+		number = block.NumberU64()
+		have   = uint64(len(ancestors))
+		want   = uint64(exportAncestors)
+	)
+	if number <= want {
+		want = 0
+		if number > 0 {
+			want = number - 1
+		}
+	}
+	if have < want {
+		return fmt.Errorf("exported ancestry too short: have %d headers, want %d", have, want)
+	}
+	if have > 0 && have >= number {
+		return fmt.Errorf("exported ancestry too long: have %d headers before block #%d", have, number)
+	}
+	child := block.Header()
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		header := ancestors[i]
+		if header.Number.Uint64()+1 != child.Number.Uint64() || header.Hash() != child.ParentHash {
+			return fmt.Errorf("exported ancestry broken at block #%d", child.Number)
+		}
+		child = header
+	}
+	return nil
+}
+
+// importRanges verifies all the ranges of an export against the state root of the
+// exported block, writing the flat snapshot along with the trie nodes and contract
+// codes into the given batch. Unless persisting is requested, the batch is only
+// reset whenever it fills up, verifying the export without storing anything.
+func importRanges(batch avndb.Batch, dir string, manifest *exportManifest, persist bool) (uint64, uint64, error) {
+	var (
+		root = manifest.Block.Root()
+		imp  = &importer{
+			batch: batch,
+			root:  root,
+			codes: make(map[common.Hash]bool),
+		}
+		accounts uint64
+		slots    uint64
+		start    = time.Now()
+		logged   = time.Now()
+	)
+	imp.accTrie = trie.NewStackTrie(imp.batch)
+
+	for i := uint64(0); i < manifest.Files; i++ {
+		file, err := os.Open(filepath.Join(dir, exportFileName(i)))
+		if err != nil {
+			return 0, 0, err
+		}
+		stream := rlp.NewStream(bufio.NewReader(file), 0)
+		for {
+			r := new(exportRange)
+			if err := stream.Decode(r); err == io.EOF {
+				break
+			} else if err != nil {
+				file.Close()
+				return 0, 0, fmt.Errorf("chunk file %d: %v", i, err)
+			}
+			if r.Account == (common.Hash{}) {
+				err = imp.importAccounts(r)
+				accounts += uint64(len(r.Keys))
+			} else {
+				err = imp.importStorage(r)
+				slots += uint64(len(r.Keys))
+			}
+			if err != nil {
+				file.Close()
+				return 0, 0, err
+			}
+			if imp.batch.ValueSize() > avndb.IdealBatchSize {
+				if persist {
+					if err := imp.batch.Write(); err != nil {
+						file.Close()
+						return 0, 0, err
+					}
+				}
+				imp.batch.Reset()
+			}
+			if time.Since(logged) > 8*time.Second {
+				msg := "Verifying state snapshot export"
+				if persist {
+					msg = "Importing state snapshot"
+				}
+				log.Info(msg, "at", imp.accNext, "accounts", accounts, "slots", slots,
+					"file", i, "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+		}
+		file.Close()
+	}
+	if !imp.accDone || len(imp.pending) > 0 {
+		return 0, 0, errExportIncomplete
+	}
+	if have, err := imp.accTrie.Commit(); err != nil {
+		return 0, 0, err
+	} else if have != root {
+		return 0, 0, fmt.Errorf("state root mismatch: have %x, want %x", have, root)
+	}
+	return accounts, slots, nil
+}
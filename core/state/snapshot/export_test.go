@@ -0,0 +1,310 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/rlp"
+	"github.com/avalanria/go-avalanria/trie"
+)
+
+// exportTestGenesis is the genesis block of the chains in the export tests.
+var exportTestGenesis = types.NewBlock(&types.Header{Number: big.NewInt(0), Difficulty: big.NewInt(1)}, nil, nil, nil, trie.NewStackTrie(nil))
+
+// newExportTestTree creates a snapshot tree of a state with contracts of various
+// storage sizes, returning it along with its block, the third one on top of the
+// genesis, and the headers preceding it.
+func newExportTestTree(t *testing.T) (*Tree, *testHelper, *types.Block, []*types.Header) {
+	helper := newHelper()
+	for i := 0; i < 100; i++ {
+		acc := &Account{Balance: big.NewInt(int64(i)), Root: emptyRoot.Bytes(), CodeHash: emptyCode.Bytes()}
+		if i%10 == 0 {
+			var keys, vals []string
+			for j := 0; j < i*10; j++ {
+				keys = append(keys, fmt.Sprintf("key-%d", j))
+				vals = append(vals, fmt.Sprintf("val-%d-%d", i, j))
+			}
+			code := []byte(fmt.Sprintf("code-%d", i%20))
+			rawdb.WriteCode(helper.diskdb, crypto.Keccak256Hash(code), code)
+
+			acc.Root = helper.makeStorageTrie(keys, vals)
+			acc.CodeHash = crypto.Keccak256(code)
+		}
+		helper.addTrieAccount(fmt.Sprintf("acc-%d", i), acc)
+	}
+	root, snap := helper.Generate()
+	select {
+	case <-snap.genPending:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("snapshot generation failed")
+	}
+	t.Cleanup(func() {
+		stop := make(chan *generatorStats)
+		snap.genAbort <- stop
+		<-stop
+	})
+	tree := &Tree{layers: map[common.Hash]snapshot{root: snap}}
+
+	var (
+		ancestors []*types.Header
+		parent    = exportTestGenesis.Hash()
+	)
+	for i := int64(1); i < 3; i++ {
+		header := &types.Header{ParentHash: parent, Number: big.NewInt(i), Difficulty: big.NewInt(1)}
+		ancestors, parent = append(ancestors, header), header.Hash()
+	}
+	header := &types.Header{ParentHash: parent, Number: big.NewInt(3), Difficulty: big.NewInt(1), Root: root}
+	return tree, helper, types.NewBlock(header, nil, nil, nil, trie.NewStackTrie(nil)), ancestors
+}
+
+// newImportTestDB creates a database holding a fresh chain of a genesis block.
+func newImportTestDB() avndb.Database {
+	db := rawdb.NewMemoryDatabase()
+	genesis := exportTestGenesis
+	rawdb.WriteTd(db, genesis.Hash(), 0, genesis.Difficulty())
+	rawdb.WriteBlock(db, genesis)
+	rawdb.WriteCanonicalHash(db, genesis.Hash(), 0)
+	rawdb.WriteHeadHeaderHash(db, genesis.Hash())
+	rawdb.WriteHeadFastBlockHash(db, genesis.Hash())
+	rawdb.WriteHeadBlockHash(db, genesis.Hash())
+	return db
+}
+
+// Tests that a state exported into chunk files can be imported into a fresh
+// database, rebuilding both the snapshot and the tries, and making the exported
+// block the chain head along with its ancestors.
+func TestExportImport(t *testing.T) {
+	defer func(rangeSize, fileSize int) {
+		exportRangeSize, exportFileSize = rangeSize, fileSize
+	}(exportRangeSize, exportFileSize)
+	exportRangeSize, exportFileSize = 512, 4096 // Force many ranges and files
+
+	tree, helper, block, ancestors := newExportTestTree(t)
+	header := block.Header()
+	dir := t.TempDir()
+	if err := Export(tree, helper.triedb, helper.diskdb, block, ancestors, big.NewInt(4), dir); err != nil {
+		t.Fatalf("failed to export state: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "chunk-*.rlp"))
+	if len(files) < 2 {
+		t.Fatalf("export not chunked: %d files", len(files))
+	}
+	// Import the state into a fresh database and check its content
+	db := newImportTestDB()
+	imported, err := Import(db, dir, header.Hash())
+	if err != nil {
+		t.Fatalf("failed to import state: %v", err)
+	}
+	if imported.Hash() != header.Hash() {
+		t.Fatalf("imported block mismatch: have %x, want %x", imported.Hash(), header.Hash())
+	}
+	if head := rawdb.ReadHeadBlockHash(db); head != header.Hash() {
+		t.Fatalf("head block mismatch: have %x, want %x", head, header.Hash())
+	}
+	if head := rawdb.ReadHeadHeaderHash(db); head != header.Hash() {
+		t.Fatalf("head header mismatch: have %x, want %x", head, header.Hash())
+	}
+	if head := rawdb.ReadHeadFastBlockHash(db); head != header.Hash() {
+		t.Fatalf("head fast block mismatch: have %x, want %x", head, header.Hash())
+	}
+	for i, want := range append(ancestors, header) {
+		number := uint64(i + 1)
+		if canon := rawdb.ReadCanonicalHash(db, number); canon != want.Hash() {
+			t.Fatalf("block %d: canonical hash mismatch: have %x, want %x", number, canon, want.Hash())
+		}
+		if rawdb.ReadHeader(db, want.Hash(), number) == nil {
+			t.Fatalf("block %d: header missing", number)
+		}
+		if td := rawdb.ReadTd(db, want.Hash(), number); td == nil || td.Uint64() != number+1 {
+			t.Fatalf("block %d: total difficulty mismatch: have %v, want %d", number, td, number+1)
+		}
+	}
+	if rawdb.ReadBlock(db, header.Hash(), 3) == nil {
+		t.Fatalf("imported block missing")
+	}
+	if tail := rawdb.ReadChainImportTail(db); tail != nil {
+		t.Fatalf("chain import tail recorded for complete chain: %d", *tail)
+	}
+	if root := rawdb.ReadSnapshotRoot(db); root != header.Root {
+		t.Fatalf("snapshot root mismatch: have %x, want %x", root, header.Root)
+	}
+	var generator journalGenerator
+	if err := rlp.DecodeBytes(rawdb.ReadSnapshotGenerator(db), &generator); err != nil {
+		t.Fatalf("failed to decode snapshot generator: %v", err)
+	}
+	if !generator.Done {
+		t.Fatalf("imported snapshot not complete")
+	}
+	snaps, err := New(db, trie.NewDatabase(db), 16, header.Root, false, false, false)
+	if err != nil {
+		t.Fatalf("failed to open imported snapshot: %v", err)
+	}
+	if err := snaps.Verify(header.Root); err != nil {
+		t.Fatalf("imported snapshot invalid: %v", err)
+	}
+	// Ensure all the trie nodes and codes are present too
+	triedb := trie.NewDatabase(db)
+	accTrie, err := trie.NewSecure(header.Root, triedb)
+	if err != nil {
+		t.Fatalf("imported state trie missing: %v", err)
+	}
+	accIt := trie.NewIterator(accTrie.NodeIterator(nil))
+	for accIt.Next() {
+		var acc Account
+		if err := rlp.DecodeBytes(accIt.Value, &acc); err != nil {
+			t.Fatalf("failed to decode account: %v", err)
+		}
+		if code := common.BytesToHash(acc.CodeHash); code != emptyCode && len(rawdb.ReadCode(db, code)) == 0 {
+			t.Errorf("code %x missing", code)
+		}
+		stTrie, err := trie.NewSecure(common.BytesToHash(acc.Root), triedb)
+		if err != nil {
+			t.Fatalf("imported storage trie missing: %v", err)
+		}
+		stIt := stTrie.NodeIterator(nil)
+		for stIt.Next(true) {
+		}
+		if stIt.Error() != nil {
+			t.Errorf("imported storage trie incomplete: %v", stIt.Error())
+		}
+	}
+	if accIt.Err != nil {
+		t.Errorf("imported state trie incomplete: %v", accIt.Err)
+	}
+}
+
+// Tests that exports not reaching back to the genesis are imported, recording the
+// gap before the exported headers, and that broken ancestries are rejected.
+func TestExportImportAncestry(t *testing.T) {
+	defer func(ancestors int) { exportAncestors = ancestors }(exportAncestors)
+	exportAncestors = 1
+
+	tree, helper, block, ancestors := newExportTestTree(t)
+	if err := Export(tree, helper.triedb, helper.diskdb, block, ancestors[:1], big.NewInt(4), t.TempDir()); err == nil {
+		t.Errorf("export with broken ancestry succeeded")
+	}
+	if err := Export(tree, helper.triedb, helper.diskdb, block, nil, big.NewInt(4), t.TempDir()); err == nil {
+		t.Errorf("export without ancestry succeeded")
+	}
+	dir := t.TempDir()
+	if err := Export(tree, helper.triedb, helper.diskdb, block, ancestors[1:], big.NewInt(4), dir); err != nil {
+		t.Fatalf("failed to export state: %v", err)
+	}
+	db := newImportTestDB()
+	if _, err := Import(db, dir, block.Hash()); err != nil {
+		t.Fatalf("failed to import state: %v", err)
+	}
+	if canon := rawdb.ReadCanonicalHash(db, 2); canon != ancestors[1].Hash() {
+		t.Errorf("ancestor canonical hash mismatch: have %x, want %x", canon, ancestors[1].Hash())
+	}
+	if canon := rawdb.ReadCanonicalHash(db, 1); canon != (common.Hash{}) {
+		t.Errorf("unexported block canonical: %x", canon)
+	}
+	if tail := rawdb.ReadChainImportTail(db); tail == nil || *tail != 2 {
+		t.Errorf("chain import tail mismatch: have %v, want 2", tail)
+	}
+}
+
+// Tests that imports of exports not matching the expected block, or having been
+// tampered with, are rejected.
+func TestImportInvalid(t *testing.T) {
+	defer func(rangeSize int) { exportRangeSize = rangeSize }(exportRangeSize)
+	exportRangeSize = 512
+
+	tree, helper, block, ancestors := newExportTestTree(t)
+	dir := t.TempDir()
+	if err := Export(tree, helper.triedb, helper.diskdb, block, ancestors, big.NewInt(4), dir); err != nil {
+		t.Fatalf("failed to export state: %v", err)
+	}
+	// Failed imports should leave any previous snapshot in place
+	db := newImportTestDB()
+	rawdb.WriteSnapshotRoot(db, common.Hash{0x02})
+	rawdb.WriteAccountSnapshot(db, common.Hash{0x03}, []byte{0x04})
+
+	checkUntouched := func() {
+		t.Helper()
+		if root := rawdb.ReadSnapshotRoot(db); root != (common.Hash{0x02}) {
+			t.Errorf("previous snapshot root dropped: have %x", root)
+		}
+		if blob := rawdb.ReadAccountSnapshot(db, common.Hash{0x03}); !bytes.Equal(blob, []byte{0x04}) {
+			t.Errorf("previous snapshot data dropped: have %x", blob)
+		}
+	}
+	if _, err := Import(db, dir, common.Hash{0x01}); err == nil {
+		t.Errorf("export of unexpected block imported")
+	}
+	checkUntouched()
+
+	// Chains synced past their genesis can't be bootstrapped
+	advanced := types.NewBlock(&types.Header{Number: big.NewInt(5), Difficulty: big.NewInt(1)}, nil, nil, nil, trie.NewStackTrie(nil))
+	genesis := rawdb.ReadHeadBlockHash(db)
+	rawdb.WriteHeaderNumber(db, advanced.Hash(), 5)
+	rawdb.WriteHeadBlockHash(db, advanced.Hash())
+	if _, err := Import(db, dir, block.Hash()); err == nil {
+		t.Errorf("state imported into advanced chain")
+	}
+	checkUntouched()
+	if head := rawdb.ReadHeadBlockHash(db); head != advanced.Hash() {
+		t.Errorf("head block changed: have %x, want %x", head, advanced.Hash())
+	}
+	rawdb.WriteHeadBlockHash(db, genesis)
+
+	// Drop a range from the middle of the export
+	blob, err := ioutil.ReadFile(filepath.Join(dir, exportFileName(0)))
+	if err != nil {
+		t.Fatalf("failed to read chunk file: %v", err)
+	}
+	var (
+		stream   = rlp.NewStream(bytes.NewReader(blob), 0)
+		tampered []byte
+		ranges   int
+	)
+	for ; ; ranges++ {
+		raw, err := stream.Raw()
+		if err != nil {
+			break
+		}
+		if ranges != 1 {
+			tampered = append(tampered, raw...)
+		}
+	}
+	if ranges < 3 {
+		t.Fatalf("too few ranges exported: %d", ranges)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, exportFileName(0)), tampered, 0644); err != nil {
+		t.Fatalf("failed to write chunk file: %v", err)
+	}
+	if _, err := Import(db, dir, block.Hash()); err == nil {
+		t.Errorf("export with missing range imported")
+	}
+	checkUntouched()
+	if head := rawdb.ReadHeadBlockHash(db); head != genesis {
+		t.Errorf("head block changed: have %x, want %x", head, genesis)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/VictoriaMetrics/fastcache"
@@ -93,32 +94,135 @@ var (
 	snapStorageWriteCounter = metrics.NewRegisteredCounter("state/snapshot/generation/duration/storage/write", nil)
 )
 
+// generatorRangeCount is the number of account hash ranges a new snapshot
+// generation is split into. Every range is generated concurrently and tracks
+// its own progress marker, so an interrupted generation resumes all of them.
+var generatorRangeCount = 16
+
+// generatorRange returns the first and last account hash (both inclusive) of the
+// index-th of count equal ranges the account hash space is split into. The start
+// of the first range and the limit of the last range are nil, denoting the open
+// ends of the hash space.
+func generatorRange(index, count int) ([]byte, []byte) {
+	var start, limit []byte
+	if index > 0 {
+		start = make([]byte, common.HashLength)
+		binary.BigEndian.PutUint64(start, uint64(index)*generatorRangeStep(count))
+	}
+	if index < count-1 {
+		limit = bytes.Repeat([]byte{0xff}, common.HashLength)
+		binary.BigEndian.PutUint64(limit, uint64(index+1)*generatorRangeStep(count)-1)
+	}
+	return start, limit
+}
+
+// generatorRangeStep returns the width of the generator ranges, measured on the
+// leading 8 bytes of the account hashes.
+func generatorRangeStep(count int) uint64 {
+	return math.MaxUint64/uint64(count) + 1
+}
+
+// generatorRangeIndex returns the index of the generator range the given key
+// (account hash, optionally followed by a storage slot hash) falls into.
+func generatorRangeIndex(key []byte, count int) int {
+	if count == 1 {
+		return 0
+	}
+	index := binary.BigEndian.Uint64(key[:8]) / generatorRangeStep(count)
+	if index >= uint64(count) {
+		return count - 1
+	}
+	return int(index)
+}
+
+// newGeneratorMarkers creates the progress markers of a brand new generation,
+// with none of the ranges started yet.
+func newGeneratorMarkers(count int) [][]byte {
+	markers := make([][]byte, count)
+	for i := range markers {
+		markers[i] = []byte{} // Initialized but empty!
+	}
+	return markers
+}
+
+// generatorProgress returns the fraction of the account hash space the given
+// generator markers have already covered.
+func generatorProgress(markers [][]byte) float64 {
+	if markers == nil {
+		return 1
+	}
+	var done float64
+	for i, marker := range markers {
+		start, limit := generatorRange(i, len(markers))
+		var first, last uint64 = 0, math.MaxUint64
+		if start != nil {
+			first = binary.BigEndian.Uint64(start)
+		}
+		if limit != nil {
+			last = binary.BigEndian.Uint64(limit)
+		}
+		switch {
+		case marker == nil:
+			done += float64(last-first) + 1
+		case len(marker) >= 8:
+			done += float64(binary.BigEndian.Uint64(marker) - first)
+		}
+	}
+	return done / (float64(math.MaxUint64) + 1)
+}
+
 // generatorStats is a collection of statistics gathered by the snapshot generator
-// for logging purposes.
+// for logging purposes. It is shared by all the concurrently generated ranges.
 type generatorStats struct {
-	origin   uint64             // Origin prefix where generation started
+	origin   float64            // Fraction of the account space done when generation started
 	start    time.Time          // Timestamp when generation started
 	accounts uint64             // Number of accounts indexed(generated or recovered)
 	slots    uint64             // Number of storage slots indexed(generated or recovered)
 	storage  common.StorageSize // Total account and storage slot size(generation or recovery)
+
+	lock sync.Mutex
+}
+
+// add accumulates the given indexed accounts, slots and their size into the stats.
+func (gs *generatorStats) add(accounts uint64, slots uint64, storage common.StorageSize) {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
+	gs.accounts += accounts
+	gs.slots += slots
+	gs.storage += storage
 }
 
 // Log creates an contextual log with the given message and the context pulled
 // from the internally maintained statistics.
-func (gs *generatorStats) Log(msg string, root common.Hash, marker []byte) {
+func (gs *generatorStats) Log(msg string, root common.Hash, markers [][]byte) {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+
 	var ctx []interface{}
 	if root != (common.Hash{}) {
 		ctx = append(ctx, []interface{}{"root", root}...)
 	}
-	// Figure out whavner we're after or within an account
-	switch len(marker) {
-	case common.HashLength:
-		ctx = append(ctx, []interface{}{"at", common.BytesToHash(marker)}...)
-	case 2 * common.HashLength:
-		ctx = append(ctx, []interface{}{
-			"in", common.BytesToHash(marker[:common.HashLength]),
-			"at", common.BytesToHash(marker[common.HashLength:]),
-		}...)
+	// Figure out whavner we're after or within an account, or how many of the
+	// concurrent ranges are still in progress
+	if len(markers) == 1 {
+		switch marker := markers[0]; len(marker) {
+		case common.HashLength:
+			ctx = append(ctx, []interface{}{"at", common.BytesToHash(marker)}...)
+		case 2 * common.HashLength:
+			ctx = append(ctx, []interface{}{
+				"in", common.BytesToHash(marker[:common.HashLength]),
+				"at", common.BytesToHash(marker[common.HashLength:]),
+			}...)
+		}
+	} else if len(markers) > 1 {
+		var pending int
+		for _, marker := range markers {
+			if marker != nil {
+				pending++
+			}
+		}
+		ctx = append(ctx, []interface{}{"ranges", len(markers), "pending", pending}...)
 	}
 	// Add the usual measurements
 	ctx = append(ctx, []interface{}{
@@ -128,13 +232,12 @@ func (gs *generatorStats) Log(msg string, root common.Hash, marker []byte) {
 		"elapsed", common.PrettyDuration(time.Since(gs.start)),
 	}...)
 	// Calculate the estimated indexing time based on current stats
-	if len(marker) > 0 {
-		if done := binary.BigEndian.Uint64(marker[:8]) - gs.origin; done > 0 {
-			left := math.MaxUint64 - binary.BigEndian.Uint64(marker[:8])
-
-			speed := done/uint64(time.Since(gs.start)/time.Millisecond+1) + 1 // +1s to avoid division by zero
+	if markers != nil {
+		progress := generatorProgress(markers)
+		if done := progress - gs.origin; done > 0 {
+			left := time.Duration(float64(time.Since(gs.start)) * (1 - progress) / done)
 			ctx = append(ctx, []interface{}{
-				"eta", common.PrettyDuration(time.Duration(left/speed) * time.Millisecond),
+				"eta", common.PrettyDuration(left),
 			}...)
 		}
 	}
@@ -145,14 +248,14 @@ func (gs *generatorStats) Log(msg string, root common.Hash, marker []byte) {
 // database and head block asynchronously. The snapshot is returned immediately
 // and generation is continued in the background until done.
 func generateSnapshot(diskdb avndb.KeyValueStore, triedb *trie.Database, cache int, root common.Hash) *diskLayer {
-	// Create a new disk layer with an initialized state marker at zero
+	// Create a new disk layer with initialized state markers at zero
 	var (
-		stats     = &generatorStats{start: time.Now()}
-		batch     = diskdb.NewBatch()
-		genMarker = []byte{} // Initialized but empty!
+		stats      = &generatorStats{start: time.Now()}
+		batch      = diskdb.NewBatch()
+		genMarkers = newGeneratorMarkers(generatorRangeCount)
 	)
 	rawdb.WriteSnapshotRoot(batch, root)
-	journalProgress(batch, genMarker, stats)
+	journalProgress(batch, genMarkers, stats)
 	if err := batch.Write(); err != nil {
 		log.Crit("Failed to write initialized state marker", "err", err)
 	}
@@ -161,7 +264,7 @@ func generateSnapshot(diskdb avndb.KeyValueStore, triedb *trie.Database, cache i
 		triedb:     triedb,
 		root:       root,
 		cache:      fastcache.New(cache * 1024 * 1024),
-		genMarker:  genMarker,
+		genMarkers: genMarkers,
 		genPending: make(chan struct{}),
 		genAbort:   make(chan chan *generatorStats),
 	}
@@ -171,18 +274,34 @@ func generateSnapshot(diskdb avndb.KeyValueStore, triedb *trie.Database, cache i
 }
 
 // journalProgress persists the generator stats into the database to resume later.
-func journalProgress(db avndb.KeyValueWriter, marker []byte, stats *generatorStats) {
-	// Write out the generator marker. Note it's a standalone disk layer generator
+func journalProgress(db avndb.KeyValueWriter, markers [][]byte, stats *generatorStats) {
+	// Write out the generator markers. Note it's a standalone disk layer generator
 	// which is not mixed with journal. It's ok if the generator is persisted while
 	// journal is not.
+	done := true
+	for _, marker := range markers {
+		if marker != nil {
+			done = false
+		}
+	}
 	entry := journalGenerator{
-		Done:   marker == nil,
-		Marker: marker,
+		Done: done,
+	}
+	// A single range is stored in the legacy format, multiple ones need their
+	// done flags tracked individually
+	if len(markers) == 1 {
+		entry.Marker = markers[0]
+	} else if len(markers) > 1 {
+		for _, marker := range markers {
+			entry.Ranges = append(entry.Ranges, journalRange{Done: marker == nil, Marker: marker})
+		}
 	}
 	if stats != nil {
+		stats.lock.Lock()
 		entry.Accounts = stats.accounts
 		entry.Slots = stats.slots
 		entry.Storage = uint64(stats.storage)
+		stats.lock.Unlock()
 	}
 	blob, err := rlp.EncodeToBytes(entry)
 	if err != nil {
@@ -190,14 +309,16 @@ func journalProgress(db avndb.KeyValueWriter, marker []byte, stats *generatorSta
 	}
 	var logstr string
 	switch {
-	case marker == nil:
+	case done:
 		logstr = "done"
-	case bytes.Equal(marker, []byte{}):
+	case len(markers) > 1:
+		logstr = fmt.Sprintf("%.2f%%", generatorProgress(markers)*100)
+	case bytes.Equal(markers[0], []byte{}):
 		logstr = "empty"
-	case len(marker) == common.HashLength:
-		logstr = fmt.Sprintf("%#x", marker)
+	case len(markers[0]) == common.HashLength:
+		logstr = fmt.Sprintf("%#x", markers[0])
 	default:
-		logstr = fmt.Sprintf("%#x:%#x", marker[:common.HashLength], marker[common.HashLength:])
+		logstr = fmt.Sprintf("%#x:%#x", markers[0][:common.HashLength], markers[0][common.HashLength:])
 	}
 	log.Debug("Journalled generator progress", "progress", logstr)
 	rawdb.WriteSnapshotGenerator(db, blob)
@@ -241,14 +362,24 @@ func (result *proofResult) forEach(callback func(key []byte, val []byte) error)
 	return nil
 }
 
+// trieOwner returns the owner of the trie backing the snapshot segment with the
+// given prefix, the account hash for storage segments.
+func trieOwner(prefix []byte, kind string) common.Hash {
+	if kind == "storage" {
+		return common.BytesToHash(prefix[len(rawdb.SnapshotStoragePrefix):])
+	}
+	return common.Hash{}
+}
+
 // proveRange proves the snapshot segment with particular prefix is "valid".
 // The iteration start point will be assigned if the iterator is restored from
 // the last interruption. Max will be assigned in order to limit the maximum
-// amount of data involved in each iteration.
+// amount of data involved in each iteration, limit to bound the segment to the
+// keys not beyond it, nil meaning unbounded.
 //
 // The proof result will be returned if the range proving is finished, otherwise
 // the error will be returned to abort the entire procedure.
-func (dl *diskLayer) proveRange(stats *generatorStats, root common.Hash, prefix []byte, kind string, origin []byte, max int, valueConvertFn func([]byte) ([]byte, error)) (*proofResult, error) {
+func (dl *diskLayer) proveRange(stats *generatorStats, root common.Hash, prefix []byte, kind string, origin []byte, limit []byte, max int, valueConvertFn func([]byte) ([]byte, error)) (*proofResult, error) {
 	var (
 		keys     [][]byte
 		vals     [][]byte
@@ -264,6 +395,11 @@ func (dl *diskLayer) proveRange(stats *generatorStats, root common.Hash, prefix
 		if len(key) != len(prefix)+common.HashLength {
 			continue
 		}
+		if limit != nil && bytes.Compare(key[len(prefix):], limit) > 0 {
+			// The rest of the snap state belongs to somavning else, the
+			// segment is exhausted
+			break
+		}
 		if len(keys) == max {
 			// Break if we've reached the max size, and signal that we're not
 			// done yet.
@@ -305,7 +441,7 @@ func (dl *diskLayer) proveRange(stats *generatorStats, root common.Hash, prefix
 	}(time.Now())
 
 	// The snap state is exhausted, pass the entire key/val set for verification
-	if origin == nil && !diskMore {
+	if origin == nil && limit == nil && !diskMore {
 		stackTr := trie.NewStackTrie(nil)
 		for i, key := range keys {
 			stackTr.TryUpdate(key, vals[i])
@@ -320,9 +456,9 @@ func (dl *diskLayer) proveRange(stats *generatorStats, root common.Hash, prefix
 		return &proofResult{keys: keys, vals: vals}, nil
 	}
 	// Snap state is chunked, generate edge proofs for verification.
-	tr, err := trie.New(root, dl.triedb)
+	tr, err := trie.NewWithOwner(trieOwner(prefix, kind), root, dl.triedb)
 	if err != nil {
-		stats.Log("Trie missing, state snapshotting paused", dl.root, dl.genMarker)
+		stats.Log("Trie missing, state snapshotting paused", dl.root, dl.markers())
 		return nil, errMissingTrie
 	}
 	// Firstly find out the key of last iterated element.
@@ -380,10 +516,11 @@ type onStateCallback func(key []byte, val []byte, write bool, delete bool) error
 
 // generateRange generates the state segment with particular prefix. Generation can
 // either verify the correctness of existing state through rangeproof and skip
-// generation, or iterate trie to regenerate state on demand.
-func (dl *diskLayer) generateRange(root common.Hash, prefix []byte, kind string, origin []byte, max int, stats *generatorStats, onState onStateCallback, valueConvertFn func([]byte) ([]byte, error)) (bool, []byte, error) {
+// generation, or iterate trie to regenerate state on demand. The segment is not
+// extended beyond limit, if given.
+func (dl *diskLayer) generateRange(root common.Hash, prefix []byte, kind string, origin []byte, limit []byte, max int, stats *generatorStats, onState onStateCallback, valueConvertFn func([]byte) ([]byte, error)) (bool, []byte, error) {
 	// Use range prover to check the validity of the flat state in the range
-	result, err := dl.proveRange(stats, root, prefix, kind, origin, max, valueConvertFn)
+	result, err := dl.proveRange(stats, root, prefix, kind, origin, limit, max, valueConvertFn)
 	if err != nil {
 		return false, nil, err
 	}
@@ -441,9 +578,9 @@ func (dl *diskLayer) generateRange(root common.Hash, prefix []byte, kind string,
 	}
 	tr := result.tr
 	if tr == nil {
-		tr, err = trie.New(root, dl.triedb)
+		tr, err = trie.NewWithOwner(trieOwner(prefix, kind), root, dl.triedb)
 		if err != nil {
-			stats.Log("Trie missing, state snapshotting paused", dl.root, dl.genMarker)
+			stats.Log("Trie missing, state snapshotting paused", dl.root, dl.markers())
 			return false, nil, errMissingTrie
 		}
 	}
@@ -471,6 +608,9 @@ func (dl *diskLayer) generateRange(root common.Hash, prefix []byte, kind string,
 			trieMore = true
 			break
 		}
+		if limit != nil && bytes.Compare(iter.Key, limit) > 0 {
+			break // The rest of the trie is out of the segment
+		}
 		count++
 		write := true
 		created++
@@ -533,59 +673,159 @@ func (dl *diskLayer) generateRange(root common.Hash, prefix []byte, kind string,
 }
 
 // generate is a background thread that iterates over the state and storage tries,
-// constructing the state snapshot. All the arguments are purely for statistics
-// gathering and logging, since the mavnod surfs the blocks as they arrive, often
-// being restarted.
+// constructing the state snapshot. The account hash space is split into ranges
+// generated concurrently, each of them resuming from its own progress marker.
+// All the arguments are purely for statistics gathering and logging, since the
+// mavnod surfs the blocks as they arrive, often being restarted.
 func (dl *diskLayer) generate(stats *generatorStats) {
+	markers := dl.markers()
+	stats.Log("Resuming state snapshot generation", dl.root, markers)
+
+	var (
+		stop    = make(chan struct{})
+		stopped bool
+		results = make(chan error, len(markers))
+		running int
+		abort   chan *generatorStats
+		failure error
+	)
+	halt := func() {
+		if !stopped {
+			close(stop)
+			stopped = true
+		}
+	}
+	for i, marker := range markers {
+		if marker == nil {
+			continue // Range already generated
+		}
+		running++
+		go func(index int, marker []byte) {
+			results <- dl.generateAccountRange(index, len(markers), marker, stats, stop)
+		}(i, marker)
+	}
+	logged := time.NewTicker(8 * time.Second)
+	defer logged.Stop()
+
+	for running > 0 {
+		select {
+		case abort = <-dl.genAbort:
+			// Termination requested, wait for all the ranges to flush
+			halt()
+			for ; running > 0; running-- {
+				<-results
+			}
+		case err := <-results:
+			running--
+			if err != nil && failure == nil {
+				// Internal error, abort all the other ranges too
+				failure = err
+				halt()
+			}
+		case <-logged.C:
+			stats.Log("Generating state snapshot", dl.root, dl.markers())
+		}
+	}
+	// The ranges journal their progress independently, which may leave a stale
+	// marker behind for some of them. Persist the final progress of all.
+	if abort != nil || failure != nil {
+		markers := dl.markers()
+		journalProgress(dl.diskdb, markers, stats)
+
+		if abort != nil {
+			stats.Log("Aborting state snapshot generation", dl.root, markers)
+		} else {
+			abort = <-dl.genAbort // aborted by internal error, wait the signal
+		}
+		abort <- stats
+		return
+	}
+	// Snapshot fully generated, set the markers to nil.
+	// Note even there is nothing to commit, persist the
+	// generator anyway to mark the snapshot is complete.
+	journalProgress(dl.diskdb, nil, stats)
+
+	stats.lock.Lock()
+	log.Info("Generated state snapshot", "accounts", stats.accounts, "slots", stats.slots,
+		"storage", stats.storage, "elapsed", common.PrettyDuration(time.Since(stats.start)))
+	stats.lock.Unlock()
+
+	dl.lock.Lock()
+	dl.genMarkers = nil
+	close(dl.genPending)
+	dl.lock.Unlock()
+
+	// Someone will be looking for us, wait it out
+	abort = <-dl.genAbort
+	abort <- nil
+}
+
+// generateAccountRange generates the snapshot of the index-th of count account
+// hash ranges, along with the storage of the contained accounts, resuming from
+// the given progress marker. It returns once the range is done, on failure, or
+// when the stop channel is closed, persisting the progress in all cases.
+func (dl *diskLayer) generateAccountRange(index int, count int, marker []byte, stats *generatorStats, stop chan struct{}) error {
 	var (
 		accMarker    []byte
 		accountRange = accountCheckRange
 	)
-	if len(dl.genMarker) > 0 { // []byte{} is the start, use nil for that
+	if len(marker) > 0 { // []byte{} is the start, use nil for that
 		// Always reset the initial account range as 1
 		// whenever recover from the interruption.
-		accMarker, accountRange = dl.genMarker[:common.HashLength], 1
+		accMarker, accountRange = marker[:common.HashLength], 1
 	}
 	var (
-		batch     = dl.diskdb.NewBatch()
-		logged    = time.Now()
-		accOrigin = common.CopyBytes(accMarker)
-		abort     chan *generatorStats
+		batch        = dl.diskdb.NewBatch()
+		start, limit = generatorRange(index, count)
+		accOrigin    = common.CopyBytes(accMarker)
+
+		begin    = time.Now()
+		accounts uint64
+		slots    uint64
+
+		accountMeter = metrics.GetOrRegisterMeter(fmt.Sprintf("state/snapshot/generation/range/%02d/accounts", index), nil)
+		slotMeter    = metrics.GetOrRegisterMeter(fmt.Sprintf("state/snapshot/generation/range/%02d/slots", index), nil)
 	)
-	stats.Log("Resuming state snapshot generation", dl.root, dl.genMarker)
+	if accOrigin == nil {
+		accOrigin = start
+	}
+	// flush writes out the batch along with the progress of the range, only
+	// publishing the new marker after the covered states hit the disk
+	flush := func(currentLocation []byte) error {
+		markers := dl.markers()
+		markers[index] = currentLocation
+		journalProgress(batch, markers, stats)
+
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
 
+		dl.lock.Lock()
+		dl.genMarkers[index] = currentLocation
+		dl.lock.Unlock()
+		return nil
+	}
 	checkAndFlush := func(currentLocation []byte) error {
+		var aborted bool
 		select {
-		case abort = <-dl.genAbort:
+		case <-stop:
+			aborted = true
 		default:
 		}
-		if batch.ValueSize() > avndb.IdealBatchSize || abort != nil {
+		if batch.ValueSize() > avndb.IdealBatchSize || aborted {
 			// Flush out the batch anyway no matter it's empty or not.
 			// It's possible that all the states are recovered and the
 			// generation indeed makes progress.
-			journalProgress(batch, currentLocation, stats)
-
-			if err := batch.Write(); err != nil {
+			if err := flush(common.CopyBytes(currentLocation)); err != nil {
 				return err
 			}
-			batch.Reset()
-
-			dl.lock.Lock()
-			dl.genMarker = currentLocation
-			dl.lock.Unlock()
-
-			if abort != nil {
-				stats.Log("Aborting state snapshot generation", dl.root, currentLocation)
+			if aborted {
 				return errors.New("aborted")
 			}
 		}
-		if time.Since(logged) > 8*time.Second {
-			stats.Log("Generating state snapshot", dl.root, currentLocation)
-			logged = time.Now()
-		}
 		return nil
 	}
-
 	onAccount := func(key []byte, val []byte, write bool, delete bool) error {
 		var (
 			start       = time.Now()
@@ -631,8 +871,9 @@ func (dl *diskLayer) generate(stats *generatorStats) {
 				rawdb.WriteAccountSnapshot(batch, accountHash, data)
 				snapGeneratedAccountMeter.Mark(1)
 			}
-			stats.storage += common.StorageSize(1 + common.HashLength + dataLen)
-			stats.accounts++
+			stats.add(1, 0, common.StorageSize(1+common.HashLength+dataLen))
+			accountMeter.Mark(1)
+			accounts++
 		}
 		// If we've exceeded our batch allowance or termination was requested, flush to disk
 		if err := checkAndFlush(accountHash[:]); err != nil {
@@ -656,8 +897,8 @@ func (dl *diskLayer) generate(stats *generatorStats) {
 			snapAccountWriteCounter.Inc(time.Since(start).Nanoseconds())
 
 			var storeMarker []byte
-			if accMarker != nil && bytes.Equal(accountHash[:], accMarker) && len(dl.genMarker) > common.HashLength {
-				storeMarker = dl.genMarker[common.HashLength:]
+			if accMarker != nil && bytes.Equal(accountHash[:], accMarker) && len(marker) > common.HashLength {
+				storeMarker = marker[common.HashLength:]
 			}
 			onStorage := func(key []byte, val []byte, write bool, delete bool) error {
 				defer func(start time.Time) {
@@ -675,8 +916,9 @@ func (dl *diskLayer) generate(stats *generatorStats) {
 				} else {
 					snapRecoveredStorageMeter.Mark(1)
 				}
-				stats.storage += common.StorageSize(1 + 2*common.HashLength + len(val))
-				stats.slots++
+				stats.add(0, 1, common.StorageSize(1+2*common.HashLength+len(val)))
+				slotMeter.Mark(1)
+				slots++
 
 				// If we've exceeded our batch allowance or termination was requested, flush to disk
 				if err := checkAndFlush(append(accountHash[:], key...)); err != nil {
@@ -686,7 +928,7 @@ func (dl *diskLayer) generate(stats *generatorStats) {
 			}
 			var storeOrigin = common.CopyBytes(storeMarker)
 			for {
-				exhausted, last, err := dl.generateRange(acc.Root, append(rawdb.SnapshotStoragePrefix, accountHash.Bytes()...), "storage", storeOrigin, storageCheckRange, stats, onStorage, nil)
+				exhausted, last, err := dl.generateRange(acc.Root, append(rawdb.SnapshotStoragePrefix, accountHash.Bytes()...), "storage", storeOrigin, nil, storageCheckRange, stats, onStorage, nil)
 				if err != nil {
 					return err
 				}
@@ -703,50 +945,55 @@ func (dl *diskLayer) generate(stats *generatorStats) {
 		return nil
 	}
 
-	// Global loop for regerating the entire state trie + all layered storage tries.
+	// Loop for regenerating the account trie range + all layered storage tries.
 	for {
-		exhausted, last, err := dl.generateRange(dl.root, rawdb.SnapshotAccountPrefix, "account", accOrigin, accountRange, stats, onAccount, FullAccountRLP)
-		// The procedure it aborted, either by external signal or internal error
+		exhausted, last, err := dl.generateRange(dl.root, rawdb.SnapshotAccountPrefix, "account", accOrigin, limit, accountRange, stats, onAccount, FullAccountRLP)
 		if err != nil {
-			if abort == nil { // aborted by internal error, wait the signal
-				abort = <-dl.genAbort
-			}
-			abort <- stats
-			return
+			return err
 		}
-		// Abort the procedure if the entire snapshot is generated
+		// Abort the procedure if the entire range is generated
 		if exhausted {
 			break
 		}
 		if accOrigin = increaseKey(last); accOrigin == nil {
 			break // special case, the last is 0xffffffff...fff
 		}
+		if limit != nil && bytes.Compare(accOrigin, limit) > 0 {
+			break
+		}
 		accountRange = accountCheckRange
 	}
-	// Snapshot fully generated, set the marker to nil.
-	// Note even there is nothing to commit, persist the
-	// generator anyway to mark the snapshot is complete.
-	journalProgress(batch, nil, stats)
-	if err := batch.Write(); err != nil {
-		log.Error("Failed to flush batch", "err", err)
-
-		abort = <-dl.genAbort
-		abort <- stats
-		return
+	// Range fully generated, set its marker to nil
+	if err := flush(nil); err != nil {
+		return err
 	}
-	batch.Reset()
+	log.Debug("Generated snapshot range", "index", index, "count", count, "accounts", accounts, "slots", slots,
+		"elapsed", common.PrettyDuration(time.Since(begin)))
+	return nil
+}
 
-	log.Info("Generated state snapshot", "accounts", stats.accounts, "slots", stats.slots,
-		"storage", stats.storage, "elapsed", common.PrettyDuration(time.Since(stats.start)))
+// markers returns a copy of the current generation progress markers.
+func (dl *diskLayer) markers() [][]byte {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
 
-	dl.lock.Lock()
-	dl.genMarker = nil
-	close(dl.genPending)
-	dl.lock.Unlock()
+	if dl.genMarkers == nil {
+		return nil
+	}
+	markers := make([][]byte, len(dl.genMarkers))
+	copy(markers, dl.genMarkers)
+	return markers
+}
 
-	// Someone will be looking for us, wait it out
-	abort = <-dl.genAbort
-	abort <- nil
+// genCovered reports whavner the snapshot entry with the given key (account hash,
+// optionally followed by a storage slot hash) has already been generated. The
+// caller must hold the layer lock.
+func (dl *diskLayer) genCovered(key []byte) bool {
+	if dl.genMarkers == nil {
+		return true
+	}
+	marker := dl.genMarkers[generatorRangeIndex(key, len(dl.genMarkers))]
+	return marker == nil || bytes.Compare(key, marker) <= 0
 }
 
 // increaseKey increase the input key by one bit. Return nil if the entire
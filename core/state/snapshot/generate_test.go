@@ -17,12 +17,14 @@
 package snapshot
 
 import (
+	"bytes"
 	"fmt"
 	"math/big"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/VictoriaMetrics/fastcache"
 	"github.com/avalanria/go-avalanria/common"
 	"github.com/avalanria/go-avalanria/core/rawdb"
 	"github.com/avalanria/go-avalanria/avndb"
@@ -831,3 +833,124 @@ func TestGenerateWithIncompleteStorage(t *testing.T) {
 	snap.genAbort <- stop
 	<-stop
 }
+
+// Tests that an interrupted generation resumes all the account ranges from their
+// own progress markers, skipping the ones already done.
+func TestGenerateResumeRanges(t *testing.T) {
+	var (
+		helper   = newHelper()
+		stKeys   = []string{"key-1", "key-2", "key-3"}
+		stVals   = []string{"val-1", "val-2", "val-3"}
+		stRoot   = helper.makeStorageTrie(stKeys, stVals)
+		markers  = newGeneratorMarkers(generatorRangeCount)
+		accounts = make(map[int][]common.Hash)
+	)
+	for i := 0; i < 400; i++ {
+		key := fmt.Sprintf("acc-%d", i)
+		index := generatorRangeIndex(hashData([]byte(key)).Bytes(), generatorRangeCount)
+		accounts[index] = append(accounts[index], hashData([]byte(key)))
+	}
+	for i := 0; i < 400; i++ {
+		key := fmt.Sprintf("acc-%d", i)
+		hash := hashData([]byte(key))
+		index := generatorRangeIndex(hash.Bytes(), generatorRangeCount)
+
+		// Every third range is done, every third one is half way through and
+		// the rest are not started at all
+		acc := &Account{Balance: big.NewInt(int64(i)), Root: stRoot, CodeHash: emptyCode.Bytes()}
+		switch index % 3 {
+		case 0:
+			markers[index] = nil
+			helper.addAccount(key, acc)
+			helper.addSnapStorage(key, stKeys, stVals)
+		case 1:
+			first := accounts[index][0]
+			for _, hash := range accounts[index] {
+				if bytes.Compare(hash[:], first[:]) < 0 {
+					first = hash
+				}
+			}
+			markers[index] = first.Bytes()
+			if hash == first {
+				helper.addAccount(key, acc)
+				helper.addSnapStorage(key, stKeys, stVals)
+			} else {
+				helper.addTrieAccount(key, acc)
+			}
+		default:
+			helper.addTrieAccount(key, acc)
+		}
+	}
+	root, _ := helper.accTrie.Commit(nil)
+	helper.triedb.Commit(root, false, nil)
+
+	snap := &diskLayer{
+		diskdb:     helper.diskdb,
+		triedb:     helper.triedb,
+		root:       root,
+		cache:      fastcache.New(16 * 1024 * 1024),
+		genMarkers: markers,
+		genPending: make(chan struct{}),
+		genAbort:   make(chan chan *generatorStats),
+	}
+	go snap.generate(&generatorStats{origin: generatorProgress(markers), start: time.Now()})
+
+	select {
+	case <-snap.genPending:
+		// Snapshot generation succeeded
+
+	case <-time.After(3 * time.Second):
+		t.Errorf("Snapshot generation failed")
+	}
+	checkSnapRoot(t, snap, root)
+
+	var generator journalGenerator
+	if err := rlp.DecodeBytes(rawdb.ReadSnapshotGenerator(helper.diskdb), &generator); err != nil {
+		t.Fatalf("failed to decode snapshot generator: %v", err)
+	}
+	if !generator.Done {
+		t.Errorf("generator not marked done")
+	}
+	// Signal abortion to the generator and wait for it to tear down
+	stop := make(chan *generatorStats)
+	snap.genAbort <- stop
+	<-stop
+}
+
+// Tests that the progress of concurrently generated ranges is journalled per
+// range, distinguishing finished ranges from not started ones.
+func TestJournalProgressRanges(t *testing.T) {
+	db := memorydb.New()
+
+	markers := newGeneratorMarkers(4)
+	markers[1] = nil
+	markers[2] = common.Hash{0x90}.Bytes()
+	journalProgress(db, markers, nil)
+
+	var generator journalGenerator
+	if err := rlp.DecodeBytes(rawdb.ReadSnapshotGenerator(db), &generator); err != nil {
+		t.Fatalf("failed to decode snapshot generator: %v", err)
+	}
+	if generator.Done {
+		t.Fatalf("generator marked done")
+	}
+	if len(generator.Ranges) != len(markers) {
+		t.Fatalf("range count mismatch: have %d, want %d", len(generator.Ranges), len(markers))
+	}
+	for i, r := range generator.Ranges {
+		if r.Done != (markers[i] == nil) {
+			t.Errorf("range %d: done mismatch: have %v, want %v", i, r.Done, markers[i] == nil)
+		}
+		if !r.Done && !bytes.Equal(r.Marker, markers[i]) {
+			t.Errorf("range %d: marker mismatch: have %x, want %x", i, r.Marker, markers[i])
+		}
+	}
+	// Finishing all the ranges should mark the generator done
+	journalProgress(db, make([][]byte, 4), nil)
+	if err := rlp.DecodeBytes(rawdb.ReadSnapshotGenerator(db), &generator); err != nil {
+		t.Fatalf("failed to decode snapshot generator: %v", err)
+	}
+	if !generator.Done {
+		t.Errorf("generator not marked done")
+	}
+}
@@ -18,7 +18,6 @@ package snapshot
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -46,6 +45,16 @@ type journalGenerator struct {
 	Accounts uint64
 	Slots    uint64
 	Storage  uint64
+
+	// Progress of the concurrently generated account ranges, if more than one.
+	// The single Marker above is used otherwise.
+	Ranges []journalRange `rlp:"optional"`
+}
+
+// journalRange is the generation progress of an account hash range.
+type journalRange struct {
+	Done   bool // Whavner the generator finished creating the range
+	Marker []byte
 }
 
 // journalDestruct is an account deletion entry in a diffLayer's disk journal.
@@ -173,19 +182,29 @@ func loadSnapshot(diskdb avndb.KeyValueStore, triedb *trie.Database, cache int,
 	// Everything loaded correctly, resume any suspended operations
 	if !generator.Done {
 		// Whavner or not wiping was in progress, load any generator progress too
-		base.genMarker = generator.Marker
-		if base.genMarker == nil {
-			base.genMarker = []byte{}
+		if len(generator.Ranges) > 0 {
+			for _, r := range generator.Ranges {
+				var marker []byte
+				if !r.Done {
+					marker = r.Marker
+					if marker == nil {
+						marker = []byte{}
+					}
+				}
+				base.genMarkers = append(base.genMarkers, marker)
+			}
+		} else {
+			marker := generator.Marker
+			if marker == nil {
+				marker = []byte{}
+			}
+			base.genMarkers = [][]byte{marker}
 		}
 		base.genPending = make(chan struct{})
 		base.genAbort = make(chan chan *generatorStats)
 
-		var origin uint64
-		if len(generator.Marker) >= 8 {
-			origin = binary.BigEndian.Uint64(generator.Marker)
-		}
 		go base.generate(&generatorStats{
-			origin:   origin,
+			origin:   generatorProgress(base.genMarkers),
 			start:    time.Now(),
 			accounts: generator.Accounts,
 			slots:    generator.Slots,
@@ -256,7 +275,7 @@ func (dl *diskLayer) Journal(buffer *bytes.Buffer) (common.Hash, error) {
 		dl.genAbort <- abort
 
 		if stats = <-abort; stats != nil {
-			stats.Log("Journalling in-progress snapshot", dl.root, dl.genMarker)
+			stats.Log("Journalling in-progress snapshot", dl.root, dl.genMarkers)
 		}
 	}
 	// Ensure the layer didn't get stale
@@ -267,7 +286,7 @@ func (dl *diskLayer) Journal(buffer *bytes.Buffer) (common.Hash, error) {
 		return common.Hash{}, ErrSnapshotStale
 	}
 	// Ensure the generator stats is written even if none was ran this cycle
-	journalProgress(dl.diskdb, dl.genMarker, stats)
+	journalProgress(dl.diskdb, dl.genMarkers, stats)
 
 	log.Debug("Journalled disk layer", "root", dl.root)
 	return dl.root, nil
@@ -373,7 +373,7 @@ func (t *Tree) Cap(root common.Hash, layers int) error {
 	}
 	// If the generator is still running, use a more aggressive cap
 	diff.origin.lock.RLock()
-	if diff.origin.genMarker != nil && layers > 8 {
+	if diff.origin.genMarkers != nil && layers > 8 {
 		layers = 8
 	}
 	diff.origin.lock.RUnlock()
@@ -527,7 +527,7 @@ func diffToDisk(bottom *diffLayer) *diskLayer {
 	// Destroy all the destructed accounts from the database
 	for hash := range bottom.destructSet {
 		// Skip any account not covered yet by the snapshot
-		if base.genMarker != nil && bytes.Compare(hash[:], base.genMarker) > 0 {
+		if !base.genCovered(hash[:]) {
 			continue
 		}
 		// Remove all storage slots
@@ -557,7 +557,7 @@ func diffToDisk(bottom *diffLayer) *diskLayer {
 	// Push all updated accounts into the database
 	for hash, data := range bottom.accountData {
 		// Skip any account not covered yet by the snapshot
-		if base.genMarker != nil && bytes.Compare(hash[:], base.genMarker) > 0 {
+		if !base.genCovered(hash[:]) {
 			continue
 		}
 		// Push the account to disk
@@ -581,15 +581,13 @@ func diffToDisk(bottom *diffLayer) *diskLayer {
 	// Push all the storage slots into the database
 	for accountHash, storage := range bottom.storageData {
 		// Skip any account not covered yet by the snapshot
-		if base.genMarker != nil && bytes.Compare(accountHash[:], base.genMarker) > 0 {
+		if !base.genCovered(accountHash[:]) {
 			continue
 		}
-		// Generation might be mid-account, track that case too
-		midAccount := base.genMarker != nil && bytes.Equal(accountHash[:], base.genMarker[:common.HashLength])
-
 		for storageHash, data := range storage {
-			// Skip any slot not covered yet by the snapshot
-			if midAccount && bytes.Compare(storageHash[:], base.genMarker[common.HashLength:]) > 0 {
+			// Skip any slot not covered yet by the snapshot, generation might
+			// be mid-account
+			if !base.genCovered(append(accountHash[:], storageHash[:]...)) {
 				continue
 			}
 			if len(data) > 0 {
@@ -608,20 +606,20 @@ func diffToDisk(bottom *diffLayer) *diskLayer {
 	rawdb.WriteSnapshotRoot(batch, bottom.root)
 
 	// Write out the generator progress marker and report
-	journalProgress(batch, base.genMarker, stats)
+	journalProgress(batch, base.genMarkers, stats)
 
 	// Flush all the updates in the single db operation. Ensure the
 	// disk layer transition is atomic.
 	if err := batch.Write(); err != nil {
 		log.Crit("Failed to write leftover snapshot", "err", err)
 	}
-	log.Debug("Journalled disk layer", "root", bottom.root, "complete", base.genMarker == nil)
+	log.Debug("Journalled disk layer", "root", bottom.root, "complete", base.genMarkers == nil)
 	res := &diskLayer{
 		root:       bottom.root,
 		cache:      base.cache,
 		diskdb:     base.diskdb,
 		triedb:     base.triedb,
-		genMarker:  base.genMarker,
+		genMarkers: base.markers(),
 		genPending: base.genPending,
 	}
 	// If snapshot generation hasn't finished yet, port over all the starts and
@@ -629,8 +627,7 @@ func diffToDisk(bottom *diffLayer) *diskLayer {
 	//
 	// Note, the `base.genAbort` comparison is not used normally, it's checked
 	// to allow the tests to play with the marker without triggering this path.
-	if base.genMarker != nil && base.genAbort != nil {
-		res.genMarker = base.genMarker
+	if base.genMarkers != nil && base.genAbort != nil {
 		res.genAbort = make(chan chan *generatorStats)
 		go res.generate(stats)
 	}
@@ -750,14 +747,59 @@ func (t *Tree) StorageIterator(root common.Hash, account common.Hash, seek commo
 
 // Verify iterates the whole state(all the accounts as well as the corresponding storages)
 // with the specific root and compares the re-computed hash with the original one.
+// The account space is split by the leading nibble of the hashes into 16 ranges
+// verified concurrently, the root being assembled from their subtries at the end.
 func (t *Tree) Verify(root common.Hash) error {
-	acctIt, err := t.AccountIterator(root, common.Hash{})
+	var (
+		stats    = newGenerateStats()
+		stoplog  = make(chan bool, 1)
+		results  = make(chan error, 16)
+		subtries [16]*trie.StackTrie
+	)
+	go runReport(stats, stoplog)
+
+	for i := range subtries {
+		subtries[i] = trie.NewStackTrie(nil)
+		go func(nibble byte) {
+			results <- t.verifyRange(root, nibble, subtries[nibble], stats)
+		}(byte(i))
+	}
+	var fail error
+	for range subtries {
+		if err := <-results; err != nil && fail == nil {
+			fail = err
+		}
+	}
+	stoplog <- fail == nil
+	if fail != nil {
+		return fail
+	}
+	got, err := trie.HashStackTrieRanges(subtries)
+	if err != nil {
+		return err
+	}
+	if got != root {
+		return fmt.Errorf("state root hash mismatch: got %x, want %x", got, root)
+	}
+	return nil
+}
+
+// verifyRange iterates all the accounts with the given leading nibble, feeding
+// them into the given stack trie, and verifies the storage root of each.
+func (t *Tree) verifyRange(root common.Hash, nibble byte, subtrie *trie.StackTrie, stats *generateStats) error {
+	acctIt, err := t.AccountIterator(root, common.Hash{nibble << 4})
 	if err != nil {
 		return err
 	}
 	defer acctIt.Release()
 
-	got, err := generateTrieRoot(nil, acctIt, common.Hash{}, stackTrieGenerate, func(db avndb.KeyValueWriter, accountHash, codeHash common.Hash, stat *generateStats) (common.Hash, error) {
+	generate := func(db avndb.KeyValueWriter, in chan trieKV, out chan common.Hash) {
+		for leaf := range in {
+			subtrie.TryUpdate(leaf.key[:], leaf.value)
+		}
+		out <- common.Hash{} // Hashed along with all the other ranges
+	}
+	_, err = generateTrieRoot(nil, &nibbleAccountIterator{AccountIterator: acctIt, nibble: nibble}, common.Hash{}, generate, func(db avndb.KeyValueWriter, accountHash, codeHash common.Hash, stat *generateStats) (common.Hash, error) {
 		storageIt, err := t.StorageIterator(root, accountHash, common.Hash{})
 		if err != nil {
 			return common.Hash{}, err
@@ -769,15 +811,30 @@ func (t *Tree) Verify(root common.Hash) error {
 			return common.Hash{}, err
 		}
 		return hash, nil
-	}, newGenerateStats(), true)
+	}, stats, false)
 
-	if err != nil {
-		return err
+	return err
+}
+
+// nibbleAccountIterator is an account iterator stopping at the first account
+// whose hash doesn't start with the given nibble.
+type nibbleAccountIterator struct {
+	AccountIterator
+	nibble byte
+	done   bool
+}
+
+// Next steps the iterator forward one element, returning false if exhausted or
+// if the iteration left the range of the nibble.
+func (it *nibbleAccountIterator) Next() bool {
+	if it.done || !it.AccountIterator.Next() {
+		return false
 	}
-	if got != root {
-		return fmt.Errorf("state root hash mismatch: got %x, want %x", got, root)
+	if it.Hash()[0]>>4 != it.nibble {
+		it.done = true
+		return false
 	}
-	return nil
+	return true
 }
 
 // disklayer is an internal helper function to return the disk layer.
@@ -823,7 +880,7 @@ func (t *Tree) generating() (bool, error) {
 	}
 	layer.lock.RLock()
 	defer layer.lock.RUnlock()
-	return layer.genMarker != nil, nil
+	return layer.genMarkers != nil, nil
 }
 
 // diskRoot is a external helper function to return the disk layer root.
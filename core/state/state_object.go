@@ -162,7 +162,7 @@ func (s *stateObject) getTrie(db Database) Trie {
 		if s.data.Root != emptyRoot && s.db.prefetcher != nil {
 			// When the miner is creating the pending state, there is no
 			// prefetcher
-			s.trie = s.db.prefetcher.trie(s.data.Root)
+			s.trie = s.db.prefetcher.trie(s.addrHash, s.data.Root)
 		}
 		if s.trie == nil {
 			var err error
@@ -171,6 +171,9 @@ func (s *stateObject) getTrie(db Database) Trie {
 				s.trie, _ = db.OpenStorageTrie(s.addrHash, common.Hash{})
 				s.setError(fmt.Errorf("can't create storage trie: %v", err))
 			}
+			if tr, ok := s.trie.(recordingTrie); ok && s.db.witness != nil {
+				tr.SetRecorder(s.db.witness)
+			}
 		}
 	}
 	return s.trie
@@ -221,7 +224,7 @@ func (s *stateObject) GetCommittedState(db Database, key common.Hash) common.Has
 			}
 		}()
 	}
-	if s.db.snap != nil {
+	if s.db.snap != nil && s.db.witness == nil {
 		if metrics.EnabledExpensive {
 			meter = &s.db.SnapshotStorageReads
 		}
@@ -237,7 +240,7 @@ func (s *stateObject) GetCommittedState(db Database, key common.Hash) common.Has
 		enc, err = s.db.snap.Storage(s.addrHash, crypto.Keccak256Hash(key.Bytes()))
 	}
 	// If snapshot unavailable or reading from it failed, load from the database
-	if s.db.snap == nil || err != nil {
+	if s.db.snap == nil || s.db.witness != nil || err != nil {
 		if meter != nil {
 			// If we already spent time checking the snapshot, account for it
 			// and reset the readStart
@@ -318,7 +321,7 @@ func (s *stateObject) finalise(prefetch bool) {
 		}
 	}
 	if s.db.prefetcher != nil && prefetch && len(slotsToPrefetch) > 0 && s.data.Root != emptyRoot {
-		s.db.prefetcher.prefetch(s.data.Root, slotsToPrefetch)
+		s.db.prefetcher.prefetch(s.addrHash, s.data.Root, slotsToPrefetch)
 	}
 	if len(s.dirtyStorage) > 0 {
 		s.dirtyStorage = make(Storage)
@@ -373,7 +376,7 @@ func (s *stateObject) updateTrie(db Database) Trie {
 		usedStorage = append(usedStorage, common.CopyBytes(key[:])) // Copy needed for closure
 	}
 	if s.db.prefetcher != nil {
-		s.db.prefetcher.used(s.data.Root, usedStorage)
+		s.db.prefetcher.used(s.addrHash, s.data.Root, usedStorage)
 	}
 	if len(s.pendingStorage) > 0 {
 		s.pendingStorage = make(Storage)
@@ -486,6 +489,9 @@ func (s *stateObject) Code(db Database) []byte {
 	if err != nil {
 		s.setError(fmt.Errorf("can't load code hash %x: %v", s.CodeHash(), err))
 	}
+	if s.db.witness != nil {
+		s.db.witness.AddCode(code)
+	}
 	s.code = code
 	return code
 }
@@ -500,6 +506,10 @@ func (s *stateObject) CodeSize(db Database) int {
 	if bytes.Equal(s.CodeHash(), emptyCodeHash) {
 		return 0
 	}
+	if s.db.witness != nil {
+		// The code itself is needed for the size when executing statelessly
+		return len(s.Code(db))
+	}
 	size, err := db.ContractCodeSize(s.addrHash, common.BytesToHash(s.CodeHash()))
 	if err != nil {
 		s.setError(fmt.Errorf("can't load code size %x: %v", s.CodeHash(), err))
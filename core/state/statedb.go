@@ -27,8 +27,10 @@ import (
 	"github.com/avalanria/go-avalanria/common"
 	"github.com/avalanria/go-avalanria/core/rawdb"
 	"github.com/avalanria/go-avalanria/core/state/snapshot"
+	"github.com/avalanria/go-avalanria/core/stateless"
 	"github.com/avalanria/go-avalanria/core/types"
 	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/avndb"
 	"github.com/avalanria/go-avalanria/log"
 	"github.com/avalanria/go-avalanria/metrics"
 	"github.com/avalanria/go-avalanria/rlp"
@@ -74,6 +76,13 @@ type StateDB struct {
 	snapAccounts  map[common.Hash][]byte
 	snapStorage   map[common.Hash]map[common.Hash][]byte
 
+	recordDiff bool       // Whavner to collect the reverse diff on commit
+	diff       *StateDiff // Reverse diff collected by the last commit
+
+	witness *stateless.Witness // Witness collecting the accessed state, nil if not recording
+
+	prewarmed map[common.Address]map[common.Hash]struct{} // State items scheduled for prewarming, for metrics
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects        map[common.Address]*stateObject
 	stateObjectsPending map[common.Address]struct{} // State objects finalized but not yet written to the trie
@@ -157,14 +166,33 @@ func (s *StateDB) StartPrefetcher(namespace string) {
 		s.prefetcher.close()
 		s.prefetcher = nil
 	}
-	if s.snap != nil {
+	if s.snap != nil && s.witness == nil {
 		s.prefetcher = newTriePrefetcher(s.db, s.originalRoot, namespace)
 	}
 }
 
+// StartWitness starts recording the trie nodes and contract codes accessed into
+// the given witness, allowing the state transition to be replayed without the
+// database. As the witness is collected from the tries, the snapshot is not
+// used for reads and no prefetcher is run while recording. It's expected to be
+// called before the state is accessed.
+func (s *StateDB) StartWitness(witness *stateless.Witness) {
+	s.StopPrefetcher()
+	s.witness = witness
+	if tr, ok := s.trie.(recordingTrie); ok {
+		tr.SetRecorder(witness)
+	}
+}
+
+// Witness returns the witness the accessed state is recorded into, if any.
+func (s *StateDB) Witness() *stateless.Witness {
+	return s.witness
+}
+
 // StopPrefetcher terminates a running prefetcher and reports any leftover stats
 // from the gathered metrics.
 func (s *StateDB) StopPrefetcher() {
+	s.reportPrewarm()
 	if s.prefetcher != nil {
 		s.prefetcher.close()
 		s.prefetcher = nil
@@ -331,6 +359,32 @@ func (s *StateDB) GetStorageProof(a common.Address, key common.Hash) ([][]byte,
 	return proof, err
 }
 
+// GetMultiProof writes the Merkle proofs of the given accounts into proofDb,
+// which may deduplicate the nodes shared between them.
+func (s *StateDB) GetMultiProof(addrs []common.Address, proofDb avndb.KeyValueWriter) error {
+	for _, addr := range addrs {
+		if err := s.trie.Prove(crypto.Keccak256(addr.Bytes()), 0, proofDb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStorageMultiProof writes the Merkle proofs of the given storage slots of an
+// account into proofDb, which may deduplicate the nodes shared between them.
+func (s *StateDB) GetStorageMultiProof(a common.Address, keys []common.Hash, proofDb avndb.KeyValueWriter) error {
+	trie := s.StorageTrie(a)
+	if trie == nil {
+		return errors.New("storage trie for requested address does not exist")
+	}
+	for _, key := range keys {
+		if err := trie.Prove(crypto.Keccak256(key.Bytes()), 0, proofDb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetCommittedState retrieves a value from the given account's committed storage trie.
 func (s *StateDB) GetCommittedState(addr common.Address, hash common.Hash) common.Hash {
 	stateObject := s.getStateObject(addr)
@@ -510,7 +564,7 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 		data *Account
 		err  error
 	)
-	if s.snap != nil {
+	if s.snap != nil && s.witness == nil {
 		if metrics.EnabledExpensive {
 			defer func(start time.Time) { s.SnapshotAccountReads += time.Since(start) }(time.Now())
 		}
@@ -534,7 +588,7 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 		}
 	}
 	// If snapshot unavailable or reading from it failed, load from the database
-	if s.snap == nil || err != nil {
+	if s.snap == nil || s.witness != nil || err != nil {
 		if metrics.EnabledExpensive {
 			defer func(start time.Time) { s.AccountReads += time.Since(start) }(time.Now())
 		}
@@ -658,6 +712,7 @@ func (s *StateDB) Copy() *StateDB {
 		preimages:           make(map[common.Hash][]byte, len(s.preimages)),
 		journal:             newJournal(),
 		hasher:              crypto.NewKeccakState(),
+		witness:             s.witness,
 	}
 	// Copy the dirty states, logs, and preimages
 	for addr := range s.journal.dirties {
@@ -714,11 +769,12 @@ func (s *StateDB) Copy() *StateDB {
 	if s.prefetcher != nil {
 		state.prefetcher = s.prefetcher.copy()
 	}
-	if s.snaps != nil {
+	if s.snaps != nil || s.snap != nil {
 		// In order for the miner to be able to use and make additions
 		// to the snapshot tree, we need to copy that aswell.
 		// Otherwise, any block mined by ourselves will cause gaps in the tree,
-		// and force the miner to operate trie-backed only
+		// and force the miner to operate trie-backed only. Historic states
+		// have no snapshot tree, but are served from their snapshot alone.
 		state.snaps = s.snaps
 		state.snap = s.snap
 		// deep copy needed
@@ -811,7 +867,7 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 		addressesToPrefetch = append(addressesToPrefetch, common.CopyBytes(addr[:])) // Copy needed for closure
 	}
 	if s.prefetcher != nil && len(addressesToPrefetch) > 0 {
-		s.prefetcher.prefetch(s.originalRoot, addressesToPrefetch)
+		s.prefetcher.prefetch(common.Hash{}, s.originalRoot, addressesToPrefetch)
 	}
 	// Invalidate journal because reverting across transactions is not allowed.
 	s.clearJournalAndRefund()
@@ -852,7 +908,7 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	// _untouched_. We can check with the prefetcher, if it can give us a trie
 	// which has the same root, but also has some content loaded into it.
 	if prefetcher != nil {
-		if trie := prefetcher.trie(s.originalRoot); trie != nil {
+		if trie := prefetcher.trie(common.Hash{}, s.originalRoot); trie != nil {
 			s.trie = trie
 		}
 	}
@@ -866,7 +922,7 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 		usedAddrs = append(usedAddrs, common.CopyBytes(addr[:])) // Copy needed for closure
 	}
 	if prefetcher != nil {
-		prefetcher.used(s.originalRoot, usedAddrs)
+		prefetcher.used(common.Hash{}, s.originalRoot, usedAddrs)
 	}
 	if len(s.stateObjectsPending) > 0 {
 		s.stateObjectsPending = make(map[common.Address]struct{})
@@ -946,10 +1002,16 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 		s.AccountCommits += time.Since(start)
 	}
 	// If snapshotting is enabled, update the snapshot tree with this new version
+	s.diff = nil
 	if s.snap != nil {
 		if metrics.EnabledExpensive {
 			defer func(start time.Time) { s.SnapshotCommits += time.Since(start) }(time.Now())
 		}
+		// Collect the reverse diff if requested, before the parent layer gets
+		// flattened by the update
+		if s.recordDiff {
+			s.diff = s.collectStateDiff()
+		}
 		// Only update if there's a state transition (skip empty Clique blocks)
 		if parent := s.snap.Root(); parent != root {
 			if err := s.snaps.Update(root, parent, s.snapDestructs, s.snapAccounts, s.snapStorage); err != nil {
@@ -19,6 +19,7 @@ package core
 import (
 	"sync/atomic"
 
+	"github.com/avalanria/go-avalanria/common"
 	"github.com/avalanria/go-avalanria/consensus"
 	"github.com/avalanria/go-avalanria/core/state"
 	"github.com/avalanria/go-avalanria/core/types"
@@ -53,7 +54,7 @@ func (p *statePrefetcher) Prefetch(block *types.Block, statedb *state.StateDB, c
 		gaspool      = new(GasPool).AddGas(block.GasLimit())
 		blockContext = NewEVMBlockContext(header, p.bc, nil)
 		evm          = vm.NewEVM(blockContext, vm.TxContext{}, statedb, p.config, cfg)
-		signer       = types.MakeSigner(p.config, header.Number)
+		signer       = types.MakeSigner(p.config, header.Number, header.Time)
 	)
 	// Iterate over and process the individual transactions
 	byzantium := p.config.IsByzantium(block.Number())
@@ -92,3 +93,21 @@ func precacheTransaction(msg types.Message, config *params.ChainConfig, gaspool
 	_, err := ApplyMessage(evm, msg, gaspool)
 	return err
 }
+
+// prewarmSlots collects the accounts and storage slots to prewarm before
+// executing a block: the recipients of its transactions, the entries declared in
+// their access lists and the commonly accessed slots of the hot contracts.
+func prewarmSlots(block *types.Block, hot *state.HotSlots) map[common.Address][]common.Hash {
+	slots := hot.Slots()
+	for _, tx := range block.Transactions() {
+		if to := tx.To(); to != nil {
+			if _, ok := slots[*to]; !ok {
+				slots[*to] = nil
+			}
+		}
+		for _, tuple := range tx.AccessList() {
+			slots[tuple.Address] = append(slots[tuple.Address], tuple.StorageKeys...)
+		}
+	}
+	return slots
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/avalanria/go-avalanria/consensus"
 	"github.com/avalanria/go-avalanria/consensus/misc"
 	"github.com/avalanria/go-avalanria/core/state"
+	"github.com/avalanria/go-avalanria/core/stateless"
 	"github.com/avalanria/go-avalanria/core/types"
 	"github.com/avalanria/go-avalanria/core/vm"
 	"github.com/avalanria/go-avalanria/crypto"
@@ -56,7 +57,44 @@ func NewStateProcessor(config *params.ChainConfig, bc *BlockChain, engine consen
 // Process returns the receipts and logs accumulated during the process and
 // returns the amount of gas that was used in the process. If any of the
 // transactions failed to execute due to insufficient gas it will return an error.
+//
+// If the statedb is recording a witness, the ancestor headers accessed during
+// the execution are recorded into it too.
 func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	var chain processorChain = p.bc
+	if witness := statedb.Witness(); witness != nil {
+		chain = &witnessChain{processorChain: chain, witness: witness}
+	}
+	return process(p.config, p.engine, chain, block, statedb, cfg)
+}
+
+// processorChain is the chain access needed to process a block, satisfied by
+// both the local blockchain and the headers of an execution witness.
+type processorChain interface {
+	ChainContext
+	consensus.ChainHeaderReader
+}
+
+// witnessChain is a processorChain recording the headers retrieved through it
+// into an execution witness.
+type witnessChain struct {
+	processorChain
+	witness *stateless.Witness
+}
+
+// GetHeader retrieves a block header from the wrapped chain, recording it into
+// the witness.
+func (c *witnessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	header := c.processorChain.GetHeader(hash, number)
+	if header != nil {
+		c.witness.AddHeader(header)
+	}
+	return header
+}
+
+// process runs the transactions of a block on top of the given state, using the
+// chain only for retrieving ancestor headers.
+func process(config *params.ChainConfig, engine consensus.Engine, chain processorChain, block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
 	var (
 		receipts    types.Receipts
 		usedGas     = new(uint64)
@@ -67,19 +105,19 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 		gp          = new(GasPool).AddGas(block.GasLimit())
 	)
 	// Mutate the block and state according to any hard-fork specs
-	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
+	if config.DAOForkSupport && config.DAOForkBlock != nil && config.DAOForkBlock.Cmp(block.Number()) == 0 {
 		misc.ApplyDAOHardFork(statedb)
 	}
-	blockContext := NewEVMBlockContext(header, p.bc, nil)
-	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, p.config, cfg)
+	blockContext := NewEVMBlockContext(header, chain, nil)
+	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, config, cfg)
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
-		msg, err := tx.AsMessage(types.MakeSigner(p.config, header.Number), header.BaseFee)
+		msg, err := tx.AsMessage(types.MakeSigner(config, header.Number, header.Time), header.BaseFee)
 		if err != nil {
 			return nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
 		}
 		statedb.Prepare(tx.Hash(), i)
-		receipt, err := applyTransaction(msg, p.config, p.bc, nil, gp, statedb, blockNumber, blockHash, tx, usedGas, vmenv)
+		receipt, err := applyTransaction(msg, config, chain, nil, gp, statedb, blockNumber, blockHash, tx, usedGas, vmenv)
 		if err != nil {
 			return nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
 		}
@@ -87,7 +125,7 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 		allLogs = append(allLogs, receipt.Logs...)
 	}
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
-	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), block.Uncles())
+	engine.Finalize(chain, header, statedb, block.Transactions(), block.Uncles())
 
 	return receipts, allLogs, *usedGas, nil
 }
@@ -142,7 +180,7 @@ func applyTransaction(msg types.Message, config *params.ChainConfig, bc ChainCon
 // for the transaction, gas used and an error if the transaction failed,
 // indicating the block was invalid.
 func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, cfg vm.Config) (*types.Receipt, error) {
-	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number), header.BaseFee)
+	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number, header.Time), header.BaseFee)
 	if err != nil {
 		return nil, err
 	}
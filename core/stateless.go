@@ -0,0 +1,121 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/consensus"
+	"github.com/avalanria/go-avalanria/core/state"
+	"github.com/avalanria/go-avalanria/core/stateless"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/core/vm"
+	"github.com/avalanria/go-avalanria/params"
+	"github.com/avalanria/go-avalanria/trie"
+)
+
+// ExecuteStateless validates a block using only its parent header and an
+// execution witness instead of the local state: the body is checked against the
+// header, the transactions are executed on top of the pre-state contained in
+// the witness and the resulting post-state is validated against the header.
+//
+// The consensus validity of the header itself is not verified, that is left to
+// the caller as it may require more of the chain than the witness contains.
+func ExecuteStateless(config *params.ChainConfig, engine consensus.Engine, block *types.Block, witness *stateless.Witness) (types.Receipts, error) {
+	header, parent := block.Header(), witness.Parent()
+	if header.ParentHash != parent.Hash() || header.Number.Uint64() != parent.Number.Uint64()+1 {
+		return nil, fmt.Errorf("witness parent mismatch: have #%d [%x..], want #%d [%x..]",
+			parent.Number, parent.Hash().Bytes()[:4], header.Number.Uint64()-1, header.ParentHash.Bytes()[:4])
+	}
+	if hash := types.CalcUncleHash(block.Uncles()); hash != header.UncleHash {
+		return nil, fmt.Errorf("uncle root hash mismatch: have %x, want %x", hash, header.UncleHash)
+	}
+	if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != header.TxHash {
+		return nil, fmt.Errorf("transaction root hash mismatch: have %x, want %x", hash, header.TxHash)
+	}
+	statedb, err := state.New(parent.Root, state.NewDatabase(witness.Database()), nil)
+	if err != nil {
+		return nil, err
+	}
+	chain := newWitnessHeaderChain(config, engine, witness)
+
+	receipts, _, usedGas, err := process(config, engine, chain, block, statedb, vm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if err := statedb.Error(); err != nil {
+		return nil, fmt.Errorf("incomplete witness: %v", err)
+	}
+	if err := validateState(config, engine, chain, block, statedb, receipts, usedGas); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// witnessHeaderChain is a processorChain serving the ancestor headers contained
+// in an execution witness.
+type witnessHeaderChain struct {
+	config  *params.ChainConfig
+	engine  consensus.Engine
+	headers []*types.Header // Parent header first, followed by the further ancestors
+}
+
+// newWitnessHeaderChain creates a header chain over the headers of a witness.
+func newWitnessHeaderChain(config *params.ChainConfig, engine consensus.Engine, witness *stateless.Witness) *witnessHeaderChain {
+	return &witnessHeaderChain{
+		config:  config,
+		engine:  engine,
+		headers: witness.Headers(),
+	}
+}
+
+// Config retrieves the chain configuration.
+func (c *witnessHeaderChain) Config() *params.ChainConfig { return c.config }
+
+// Engine retrieves the consensus engine.
+func (c *witnessHeaderChain) Engine() consensus.Engine { return c.engine }
+
+// CurrentHeader returns the parent header of the block being executed.
+func (c *witnessHeaderChain) CurrentHeader() *types.Header { return c.headers[0] }
+
+// GetHeaderByNumber retrieves an ancestor header from the witness by number.
+func (c *witnessHeaderChain) GetHeaderByNumber(number uint64) *types.Header {
+	parent := c.headers[0].Number.Uint64()
+	if number > parent || parent-number >= uint64(len(c.headers)) {
+		return nil
+	}
+	return c.headers[parent-number]
+}
+
+// GetHeader retrieves an ancestor header from the witness by hash and number.
+func (c *witnessHeaderChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.GetHeaderByNumber(number); header != nil && header.Hash() == hash {
+		return header
+	}
+	return nil
+}
+
+// GetHeaderByHash retrieves an ancestor header from the witness by hash.
+func (c *witnessHeaderChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	for _, header := range c.headers {
+		if header.Hash() == hash {
+			return header
+		}
+	}
+	return nil
+}
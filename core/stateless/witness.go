@@ -0,0 +1,181 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package stateless implements the witnesses allowing blocks to be executed
+// without access to the state database.
+package stateless
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/rlp"
+)
+
+// Witness contains everything needed to execute a block on top of its parent
+// state: the trie nodes and contract codes accessed during the execution, and
+// the ancestor headers needed for the BLOCKHASH opcode.
+//
+// A witness is filled concurrently while recording, all its methods are safe
+// for concurrent use.
+type Witness struct {
+	headers []*types.Header     // Parent header first, followed by the further ancestors accessed
+	codes   map[string]struct{} // Contract codes accessed during the execution
+	state   map[string]struct{} // Trie nodes accessed during the execution
+
+	lock sync.Mutex
+}
+
+// NewWitness creates an empty witness for executing a child of the given block.
+func NewWitness(parent *types.Header) *Witness {
+	return &Witness{
+		headers: []*types.Header{parent},
+		codes:   make(map[string]struct{}),
+		state:   make(map[string]struct{}),
+	}
+}
+
+// Parent returns the header of the block the witness is built on top of.
+func (w *Witness) Parent() *types.Header {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.headers[0]
+}
+
+// Root returns the pre-state root of the witness.
+func (w *Witness) Root() common.Hash {
+	return w.Parent().Root
+}
+
+// Headers returns the ancestor headers contained in the witness, starting with
+// the parent and going backwards.
+func (w *Witness) Headers() []*types.Header {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return append([]*types.Header{}, w.headers...)
+}
+
+// AddHeader adds an ancestor header to the witness, which is only accepted if
+// it's the parent of the oldest one contained already.
+func (w *Witness) AddHeader(header *types.Header) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if oldest := w.headers[len(w.headers)-1]; oldest.ParentHash == header.Hash() {
+		w.headers = append(w.headers, header)
+	}
+}
+
+// AddCode adds a contract code to the witness.
+func (w *Witness) AddCode(code []byte) {
+	if len(code) == 0 {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.codes[string(code)] = struct{}{}
+}
+
+// RecordNode adds a trie node to the witness, implementing trie.Recorder.
+func (w *Witness) RecordNode(blob []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.state[string(blob)] = struct{}{}
+}
+
+// Database creates an in-memory database holding the trie nodes and contract
+// codes of the witness, to be used as the source of the pre-state.
+func (w *Witness) Database() avndb.Database {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	db := rawdb.NewMemoryDatabase()
+	for blob := range w.state {
+		db.Put(crypto.Keccak256([]byte(blob)), []byte(blob))
+	}
+	for code := range w.codes {
+		rawdb.WriteCode(db, crypto.Keccak256Hash([]byte(code)), []byte(code))
+	}
+	return db
+}
+
+// extWitness is the serialisation format of a witness, with the codes and trie
+// nodes sorted to keep the encoding deterministic.
+type extWitness struct {
+	Headers []*types.Header
+	Codes   [][]byte
+	State   [][]byte
+}
+
+// sortedBlobs returns the members of a blob set in ascending order.
+func sortedBlobs(set map[string]struct{}) [][]byte {
+	blobs := make([][]byte, 0, len(set))
+	for blob := range set {
+		blobs = append(blobs, []byte(blob))
+	}
+	sort.Slice(blobs, func(i, j int) bool { return bytes.Compare(blobs[i], blobs[j]) < 0 })
+	return blobs
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (w *Witness) EncodeRLP(wr io.Writer) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return rlp.Encode(wr, &extWitness{
+		Headers: w.headers,
+		Codes:   sortedBlobs(w.codes),
+		State:   sortedBlobs(w.state),
+	})
+}
+
+// DecodeRLP implements rlp.Decoder, checking that the headers form a chain.
+func (w *Witness) DecodeRLP(s *rlp.Stream) error {
+	var ext extWitness
+	if err := s.Decode(&ext); err != nil {
+		return err
+	}
+	if len(ext.Headers) == 0 {
+		return errors.New("witness without parent header")
+	}
+	for i := 1; i < len(ext.Headers); i++ {
+		if ext.Headers[i-1].ParentHash != ext.Headers[i].Hash() {
+			return errors.New("witness headers not chained")
+		}
+	}
+	w.headers = ext.Headers
+	w.codes = make(map[string]struct{}, len(ext.Codes))
+	for _, code := range ext.Codes {
+		w.codes[string(code)] = struct{}{}
+	}
+	w.state = make(map[string]struct{}, len(ext.State))
+	for _, blob := range ext.State {
+		w.state[string(blob)] = struct{}{}
+	}
+	return nil
+}
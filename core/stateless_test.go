@@ -0,0 +1,196 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/consensus/avnash"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/core/stateless"
+	"github.com/avalanria/go-avalanria/core/types"
+	"github.com/avalanria/go-avalanria/core/vm"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/params"
+	"github.com/avalanria/go-avalanria/rlp"
+)
+
+// newStatelessTestChain creates a chain whose blocks call a contract storing the
+// hash of an older block and clearing older storage slots, returning it along
+// with its blocks.
+func newStatelessTestChain(t *testing.T) (*BlockChain, []*types.Block) {
+	var (
+		aa     = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+		engine = avnash.NewFaker()
+		db     = rawdb.NewMemoryDatabase()
+
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000000000000)},
+				// The address 0xAAAA stores blockhash(number-3) at slot number
+				// and clears the slot number-3
+				aa: {
+					Code: []byte{
+						byte(vm.PUSH1), 3, byte(vm.NUMBER), byte(vm.SUB), byte(vm.BLOCKHASH),
+						byte(vm.NUMBER), byte(vm.SSTORE),
+						byte(vm.PUSH1), 0, byte(vm.PUSH1), 3, byte(vm.NUMBER), byte(vm.SUB),
+						byte(vm.SSTORE),
+					},
+					Balance: big.NewInt(0),
+				},
+			},
+		}
+	)
+	for i := 0; i < 100; i++ {
+		gspec.Alloc[common.BigToAddress(big.NewInt(int64(0x10000+i)))] = GenesisAccount{Balance: big.NewInt(1)}
+	}
+	gspec.MustCommit(db)
+
+	// The contract accesses older blocks, so generate the chain block by block on
+	// top of an archive chain serving them
+	cacheConfig := *defaultCacheConfig
+	cacheConfig.TrieDirtyDisabled = true
+
+	chain, err := NewBlockChain(db, &cacheConfig, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	t.Cleanup(chain.Stop)
+
+	var (
+		signer = types.LatestSigner(gspec.Config)
+		blocks []*types.Block
+	)
+	for i := 0; i < 8; i++ {
+		generated, _ := GenerateChain(gspec.Config, chain.CurrentBlock(), engine, db, 1, func(_ int, b *BlockGen) {
+			b.SetCoinbase(common.Address{1})
+
+			tx, _ := types.SignNewTx(key, signer, &types.LegacyTx{
+				Nonce:    b.TxNonce(address),
+				To:       &aa,
+				Gas:      100000,
+				GasPrice: b.header.BaseFee,
+			})
+			b.AddTxWithChain(chain, tx)
+
+			fresh := common.BigToAddress(big.NewInt(int64(0x20000 + i)))
+			tx, _ = types.SignNewTx(key, signer, &types.LegacyTx{
+				Nonce:    b.TxNonce(address),
+				To:       &fresh,
+				Value:    big.NewInt(1),
+				Gas:      params.TxGas,
+				GasPrice: b.header.BaseFee,
+			})
+			b.AddTx(tx)
+		})
+		if n, err := chain.InsertChain(generated); err != nil {
+			t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+		}
+		blocks = append(blocks, generated...)
+	}
+	return chain, blocks
+}
+
+// Tests that the witness recorded while executing a block suffices to execute
+// it again without the state, even after an encoding round trip.
+func TestExecuteStateless(t *testing.T) {
+	chain, blocks := newStatelessTestChain(t)
+
+	for _, block := range blocks {
+		witness, err := chain.ExecutionWitness(block)
+		if err != nil {
+			t.Fatalf("block %d: failed to record witness: %v", block.NumberU64(), err)
+		}
+		// BLOCKHASH(number-3) is the parent hash of the grandparent, if any
+		want := 2
+		if block.NumberU64() < 3 {
+			want = 1
+		}
+		if have := len(witness.Headers()); have != want {
+			t.Errorf("block %d: witness headers mismatch: have %d, want %d", block.NumberU64(), have, want)
+		}
+		blob, err := rlp.EncodeToBytes(witness)
+		if err != nil {
+			t.Fatalf("block %d: failed to encode witness: %v", block.NumberU64(), err)
+		}
+		decoded := new(stateless.Witness)
+		if err := rlp.DecodeBytes(blob, decoded); err != nil {
+			t.Fatalf("block %d: failed to decode witness: %v", block.NumberU64(), err)
+		}
+		receipts, err := ExecuteStateless(chain.Config(), chain.Engine(), block, decoded)
+		if err != nil {
+			t.Fatalf("block %d: stateless execution failed: %v", block.NumberU64(), err)
+		}
+		if len(receipts) != len(block.Transactions()) {
+			t.Fatalf("block %d: receipt count mismatch: have %d, want %d", block.NumberU64(), len(receipts), len(block.Transactions()))
+		}
+	}
+}
+
+// Tests that blocks are rejected if the witness is incomplete or doesn't belong
+// to them.
+func TestExecuteStatelessInvalid(t *testing.T) {
+	chain, blocks := newStatelessTestChain(t)
+
+	block := blocks[len(blocks)-1]
+	witness, err := chain.ExecutionWitness(block)
+	if err != nil {
+		t.Fatalf("failed to record witness: %v", err)
+	}
+	blob, _ := rlp.EncodeToBytes(witness)
+
+	var ext struct {
+		Headers []*types.Header
+		Codes   [][]byte
+		State   [][]byte
+	}
+	if err := rlp.DecodeBytes(blob, &ext); err != nil {
+		t.Fatalf("failed to decode witness: %v", err)
+	}
+	tamper := func(fn func()) *stateless.Witness {
+		rlp.DecodeBytes(blob, &ext)
+		fn()
+		enc, _ := rlp.EncodeToBytes(&ext)
+		w := new(stateless.Witness)
+		if err := rlp.DecodeBytes(enc, w); err != nil {
+			t.Fatalf("failed to decode tampered witness: %v", err)
+		}
+		return w
+	}
+	if _, err := ExecuteStateless(chain.Config(), chain.Engine(), blocks[len(blocks)-2], witness); err == nil {
+		t.Errorf("block executed with the witness of another block")
+	}
+	for i := range ext.State {
+		w := tamper(func() { ext.State = append(ext.State[:i:i], ext.State[i+1:]...) })
+		if _, err := ExecuteStateless(chain.Config(), chain.Engine(), block, w); err == nil {
+			t.Errorf("block executed with trie node %d missing", i)
+		}
+	}
+	w := tamper(func() { ext.Codes = nil })
+	if _, err := ExecuteStateless(chain.Config(), chain.Engine(), block, w); err == nil {
+		t.Errorf("block executed with codes missing")
+	}
+	w = tamper(func() { ext.Headers = ext.Headers[:1] })
+	if _, err := ExecuteStateless(chain.Config(), chain.Engine(), block, w); err == nil {
+		t.Errorf("block executed with ancestor headers missing")
+	}
+}
@@ -1149,7 +1149,7 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 	// because of another transaction (e.g. higher gas price).
 	if reset != nil {
 		pool.demoteUnexecutables()
-		if reset.newHead != nil && pool.chainconfig.IsLondon(new(big.Int).Add(reset.newHead.Number, big.NewInt(1))) {
+		if reset.newHead != nil && pool.chainconfig.IsLondon(new(big.Int).Add(reset.newHead.Number, big.NewInt(1)), uint64(time.Now().Unix())) {
 			pendingBaseFee := misc.CalcBaseFee(pool.chainconfig, reset.newHead)
 			pool.priced.SetBaseFee(pendingBaseFee)
 		}
@@ -1266,11 +1266,12 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	senderCacher.recover(pool.signer, reinject)
 	pool.addTxsLocked(reinject, false)
 
-	// Update all fork indicator by next pending block number.
+	// Update all fork indicator by next pending block number and the current time.
 	next := new(big.Int).Add(newHead.Number, big.NewInt(1))
+	now := uint64(time.Now().Unix())
 	pool.istanbul = pool.chainconfig.IsIstanbul(next)
-	pool.eip2718 = pool.chainconfig.IsBerlin(next)
-	pool.eip1559 = pool.chainconfig.IsLondon(next)
+	pool.eip2718 = pool.chainconfig.IsBerlin(next, now)
+	pool.eip1559 = pool.chainconfig.IsLondon(next, now)
 }
 
 // promoteExecutables moves transactions that have become processable from the
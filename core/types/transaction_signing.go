@@ -36,13 +36,14 @@ type sigCache struct {
 	from   common.Address
 }
 
-// MakeSigner returns a Signer based on the given chain config and block number.
-func MakeSigner(config *params.ChainConfig, blockNumber *big.Int) Signer {
+// MakeSigner returns a Signer based on the given chain config, block number and
+// block timestamp.
+func MakeSigner(config *params.ChainConfig, blockNumber *big.Int, blockTime uint64) Signer {
 	var signer Signer
 	switch {
-	case config.IsLondon(blockNumber):
+	case config.IsLondon(blockNumber, blockTime):
 		signer = NewLondonSigner(config.ChainID)
-	case config.IsBerlin(blockNumber):
+	case config.IsBerlin(blockNumber, blockTime):
 		signer = NewEIP2930Signer(config.ChainID)
 	case config.IsEIP155(blockNumber):
 		signer = NewEIP155Signer(config.ChainID)
@@ -63,10 +64,10 @@ func MakeSigner(config *params.ChainConfig, blockNumber *big.Int) Signer {
 // have the current block number available, use MakeSigner instead.
 func LatestSigner(config *params.ChainConfig) Signer {
 	if config.ChainID != nil {
-		if config.LondonBlock != nil {
+		if config.LondonBlock != nil || config.LondonTime != nil {
 			return NewLondonSigner(config.ChainID)
 		}
-		if config.BerlinBlock != nil {
+		if config.BerlinBlock != nil || config.BerlinTime != nil {
 			return NewEIP2930Signer(config.ChainID)
 		}
 		if config.EIP155Block != nil {
@@ -125,13 +125,18 @@ type EVM struct {
 // NewEVM returns a new EVM. The returned EVM is not thread safe and should
 // only ever be used *once*.
 func NewEVM(blockCtx BlockContext, txCtx TxContext, statedb StateDB, chainConfig *params.ChainConfig, config Config) *EVM {
+	// Forks may be scheduled by time too, so the rules depend on the block timestamp
+	var blockTime uint64
+	if blockCtx.Time != nil {
+		blockTime = blockCtx.Time.Uint64()
+	}
 	evm := &EVM{
 		Context:     blockCtx,
 		TxContext:   txCtx,
 		StateDB:     statedb,
 		Config:      config,
 		chainConfig: chainConfig,
-		chainRules:  chainConfig.Rules(blockCtx.BlockNumber),
+		chainRules:  chainConfig.Rules(blockCtx.BlockNumber, blockTime),
 	}
 	evm.interpreter = NewEVMInterpreter(evm, config)
 	return evm
@@ -479,3 +484,6 @@ func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *
 
 // ChainConfig returns the environment's chain configuration
 func (evm *EVM) ChainConfig() *params.ChainConfig { return evm.chainConfig }
+
+// ChainRules returns the fork rules active in the environment's block
+func (evm *EVM) ChainRules() params.Rules { return evm.chainRules }
@@ -45,6 +45,7 @@ import (
 	"github.com/avalanria/go-avalanria/params"
 	"github.com/avalanria/go-avalanria/rlp"
 	"github.com/avalanria/go-avalanria/rpc"
+	"github.com/avalanria/go-avalanria/trie"
 	"github.com/tyler-smith/go-bip39"
 )
 
@@ -699,6 +700,108 @@ func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Addre
 	}, state.Error()
 }
 
+// MultiProofRequest selects an account, and optionally some of its storage keys,
+// to be proven by GetMultiProof.
+type MultiProofRequest struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []string       `json:"storageKeys"`
+}
+
+// MultiProofResult is the result of GetMultiProof: the values of the requested
+// accounts and storage slots, along with a single deduplicated set of trie nodes
+// proving all of them.
+type MultiProofResult struct {
+	Nodes    []string             `json:"nodes"`
+	Accounts []MultiAccountResult `json:"accounts"`
+}
+
+// MultiAccountResult is an account proven by a MultiProofResult.
+type MultiAccountResult struct {
+	Address     common.Address       `json:"address"`
+	Balance     *hexutil.Big         `json:"balance"`
+	CodeHash    common.Hash          `json:"codeHash"`
+	Nonce       hexutil.Uint64       `json:"nonce"`
+	StorageHash common.Hash          `json:"storageHash"`
+	Storage     []MultiStorageResult `json:"storage"`
+}
+
+// MultiStorageResult is a storage slot proven by a MultiProofResult.
+type MultiStorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+}
+
+const (
+	maxMultiProofAccounts    = 256  // Maximum number of accounts proven by a single GetMultiProof call
+	maxMultiProofStorageKeys = 1024 // Maximum number of storage keys proven by a single GetMultiProof call
+)
+
+// GetMultiProof returns the Merkle-proof for multiple accounts and their storage
+// keys at once. Unlike separate GetProof calls, the trie nodes shared between the
+// proofs are only returned once.
+func (s *PublicBlockChainAPI) GetMultiProof(ctx context.Context, requests []MultiProofRequest, blockNrOrHash rpc.BlockNumberOrHash) (*MultiProofResult, error) {
+	if len(requests) > maxMultiProofAccounts {
+		return nil, fmt.Errorf("too many accounts requested: %d > %d", len(requests), maxMultiProofAccounts)
+	}
+	var keyCount int
+	for _, req := range requests {
+		keyCount += len(req.StorageKeys)
+	}
+	if keyCount > maxMultiProofStorageKeys {
+		return nil, fmt.Errorf("too many storage keys requested: %d > %d", keyCount, maxMultiProofStorageKeys)
+	}
+	state, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	var (
+		proof    = trie.NewMultiProof()
+		addrs    = make([]common.Address, len(requests))
+		accounts = make([]MultiAccountResult, len(requests))
+	)
+	for i, req := range requests {
+		addrs[i] = req.Address
+
+		storageTrie := state.StorageTrie(req.Address)
+		storageHash := types.EmptyRootHash
+		codeHash := state.GetCodeHash(req.Address)
+		storage := make([]MultiStorageResult, len(req.StorageKeys))
+
+		// if we have a storageTrie, (which means the account exists), we can update the storagehash
+		if storageTrie != nil {
+			storageHash = storageTrie.Hash()
+		} else {
+			// no storageTrie means the account does not exist, so the codeHash is the hash of an empty bytearray.
+			codeHash = crypto.Keccak256Hash(nil)
+		}
+		keys := make([]common.Hash, len(req.StorageKeys))
+		for j, key := range req.StorageKeys {
+			keys[j] = common.HexToHash(key)
+			storage[j] = MultiStorageResult{key, (*hexutil.Big)(state.GetState(req.Address, keys[j]).Big())}
+		}
+		if storageTrie != nil && len(keys) > 0 {
+			if err := state.GetStorageMultiProof(req.Address, keys, proof); err != nil {
+				return nil, err
+			}
+		}
+		accounts[i] = MultiAccountResult{
+			Address:     req.Address,
+			Balance:     (*hexutil.Big)(state.GetBalance(req.Address)),
+			CodeHash:    codeHash,
+			Nonce:       hexutil.Uint64(state.GetNonce(req.Address)),
+			StorageHash: storageHash,
+			Storage:     storage,
+		}
+	}
+	if err := state.GetMultiProof(addrs, proof); err != nil {
+		return nil, err
+	}
+	return &MultiProofResult{
+		Nodes:    toHexSlice(proof.Nodes()),
+		Accounts: accounts,
+	}, state.Error()
+}
+
 // GetHeaderByNumber returns the requested canonical block header.
 // * When blockNr is -1 the chain head is returned.
 // * When blockNr is -2 the pending chain head is returned.
@@ -1429,7 +1532,7 @@ func AccessList(ctx context.Context, b Backend, blockNrOrHash rpc.BlockNumberOrH
 		to = crypto.CreateAddress(args.from(), uint64(*args.Nonce))
 	}
 	// Retrieve the precompiles since they don't need to be added to the access list
-	precompiles := vm.ActivePrecompiles(b.ChainConfig().Rules(header.Number))
+	precompiles := vm.ActivePrecompiles(b.ChainConfig().Rules(header.Number, header.Time))
 
 	// Create an initial tracer
 	prevTracer := vm.NewAccessListTracer(nil, args.from(), to, precompiles)
@@ -1607,6 +1710,13 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	if err != nil {
 		return nil, nil
 	}
+	header, err := s.b.HeaderByHash(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, nil
+	}
 	receipts, err := s.b.GetReceipts(ctx, blockHash)
 	if err != nil {
 		return nil, err
@@ -1618,7 +1728,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 
 	// Derive the sender.
 	bigblock := new(big.Int).SetUint64(blockNumber)
-	signer := types.MakeSigner(s.b.ChainConfig(), bigblock)
+	signer := types.MakeSigner(s.b.ChainConfig(), bigblock, header.Time)
 	from, _ := types.Sender(signer, tx)
 
 	fields := map[string]interface{}{
@@ -1636,13 +1746,9 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 		"type":              hexutil.Uint(tx.Type()),
 	}
 	// Assign the effective gas price paid
-	if !s.b.ChainConfig().IsLondon(bigblock) {
+	if !s.b.ChainConfig().IsLondon(bigblock, header.Time) {
 		fields["effectiveGasPrice"] = hexutil.Uint64(tx.GasPrice().Uint64())
 	} else {
-		header, err := s.b.HeaderByHash(ctx, blockHash)
-		if err != nil {
-			return nil, err
-		}
 		gasPrice := new(big.Int).Add(header.BaseFee, tx.EffectiveGasTipValue(header.BaseFee))
 		fields["effectiveGasPrice"] = hexutil.Uint64(gasPrice.Uint64())
 	}
@@ -1690,7 +1796,8 @@ func SubmitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (c
 		return common.Hash{}, err
 	}
 	// Print a log with full tx details for manual investigations and interventions
-	signer := types.MakeSigner(b.ChainConfig(), b.CurrentBlock().Number())
+	head := b.CurrentBlock()
+	signer := types.MakeSigner(b.ChainConfig(), head.Number(), head.Time())
 	from, err := types.Sender(signer, tx)
 	if err != nil {
 		return common.Hash{}, err
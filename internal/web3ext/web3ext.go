@@ -22,6 +22,7 @@ var Modules = map[string]string{
 	"clique":   CliqueJs,
 	"avnash":   EthashJs,
 	"debug":    DebugJs,
+	"ibft":     IBFTJs,
 	"avn":      EthJs,
 	"miner":    MinerJs,
 	"net":      NetJs,
@@ -73,6 +74,12 @@ web3._extend({
 			call: 'clique_status',
 			params: 0
 		}),
+		new web3._extend.Mavnod({
+			name: 'liveness',
+			call: 'clique_liveness',
+			params: 1,
+			inputFormatter: [null]
+		}),
 		new web3._extend.Mavnod({
 			name: 'getSigner',
 			call: 'clique_getSigner',
@@ -89,6 +96,57 @@ web3._extend({
 });
 `
 
+const IBFTJs = `
+web3._extend({
+	property: 'ibft',
+	mavnods: [
+		new web3._extend.Mavnod({
+			name: 'getSnapshot',
+			call: 'ibft_getSnapshot',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Mavnod({
+			name: 'getSnapshotAtHash',
+			call: 'ibft_getSnapshotAtHash',
+			params: 1
+		}),
+		new web3._extend.Mavnod({
+			name: 'getValidators',
+			call: 'ibft_getValidators',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Mavnod({
+			name: 'getValidatorsAtHash',
+			call: 'ibft_getValidatorsAtHash',
+			params: 1
+		}),
+		new web3._extend.Mavnod({
+			name: 'propose',
+			call: 'ibft_propose',
+			params: 2
+		}),
+		new web3._extend.Mavnod({
+			name: 'discard',
+			call: 'ibft_discard',
+			params: 1
+		}),
+		new web3._extend.Mavnod({
+			name: 'status',
+			call: 'ibft_status',
+			params: 0
+		}),
+	],
+	properties: [
+		new web3._extend.Property({
+			name: 'proposals',
+			getter: 'ibft_proposals'
+		}),
+	]
+});
+`
+
 const EthashJs = `
 web3._extend({
 	property: 'avnash',
@@ -141,6 +199,31 @@ web3._extend({
 			call: 'admin_removeTrustedPeer',
 			params: 1
 		}),
+		new web3._extend.Mavnod({
+			name: 'banPeer',
+			call: 'admin_banPeer',
+			params: 2
+		}),
+		new web3._extend.Mavnod({
+			name: 'banSubnet',
+			call: 'admin_banSubnet',
+			params: 2
+		}),
+		new web3._extend.Mavnod({
+			name: 'unban',
+			call: 'admin_unban',
+			params: 1
+		}),
+		new web3._extend.Mavnod({
+			name: 'listBans',
+			call: 'admin_listBans',
+			params: 0
+		}),
+		new web3._extend.Mavnod({
+			name: 'setAllowlist',
+			call: 'admin_setAllowlist',
+			params: 1
+		}),
 		new web3._extend.Mavnod({
 			name: 'exportChain',
 			call: 'admin_exportChain',
@@ -152,6 +235,11 @@ web3._extend({
 			call: 'admin_importChain',
 			params: 1
 		}),
+		new web3._extend.Mavnod({
+			name: 'syncFromCheckpoint',
+			call: 'admin_syncFromCheckpoint',
+			params: 1
+		}),
 		new web3._extend.Mavnod({
 			name: 'sleepBlocks',
 			call: 'admin_sleepBlocks',
@@ -199,6 +287,10 @@ web3._extend({
 			name: 'peers',
 			getter: 'admin_peers'
 		}),
+		new web3._extend.Property({
+			name: 'allowlist',
+			getter: 'admin_allowlist'
+		}),
 		new web3._extend.Property({
 			name: 'datadir',
 			getter: 'admin_datadir'
@@ -448,6 +540,20 @@ web3._extend({
 			params: 2,
 			inputFormatter:[null, null],
 		}),
+		new web3._extend.Mavnod({
+			name: 'pruneState',
+			call: 'debug_pruneState',
+		}),
+		new web3._extend.Mavnod({
+			name: 'pruneStateStatus',
+			call: 'debug_pruneStateStatus',
+		}),
+		new web3._extend.Mavnod({
+			name: 'executionWitness',
+			call: 'debug_executionWitness',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter],
+		}),
 		new web3._extend.Mavnod({
 			name: 'freezeClient',
 			call: 'debug_freezeClient',
@@ -546,6 +652,12 @@ web3._extend({
 			params: 3,
 			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputBlockNumberFormatter]
 		}),
+		new web3._extend.Mavnod({
+			name: 'getMultiProof',
+			call: 'avn_getMultiProof',
+			params: 2,
+			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 		new web3._extend.Mavnod({
 			name: 'createAccessList',
 			call: 'avn_createAccessList',
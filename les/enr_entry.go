@@ -46,7 +46,7 @@ func (avn *LightAvalanria) setupDiscovery() (enode.Iterator, error) {
 
 	// Enable DNS discovery.
 	if len(avn.config.EthDiscoveryURLs) != 0 {
-		client := dnsdisc.NewClient(dnsdisc.Config{})
+		client := dnsdisc.NewClient(dnsdisc.Config{ResolverAddr: avn.config.DiscoveryDNSResolver})
 		dns, err := client.NewIterator(avn.config.EthDiscoveryURLs...)
 		if err != nil {
 			return nil, err
@@ -52,7 +52,7 @@ func (lavn *LightAvalanria) stateAtTransaction(ctx context.Context, block *types
 		return nil, vm.BlockContext{}, statedb, nil
 	}
 	// Recompute transactions up to the target index.
-	signer := types.MakeSigner(lavn.blockchain.Config(), block.Number())
+	signer := types.MakeSigner(lavn.blockchain.Config(), block.Number(), block.Time())
 	for idx, tx := range block.Transactions() {
 		// Assemble the transaction call message and return if the requested offset
 		msg, _ := tx.AsMessage(signer, block.BaseFee())
@@ -311,10 +311,10 @@ func (pool *TxPool) setNewHead(head *types.Header) {
 	m, r := txc.getLists()
 	pool.relay.NewHead(pool.head, m, r)
 
-	// Update fork indicator by next pending block number
+	// Update fork indicator by next pending block number and the current time
 	next := new(big.Int).Add(head.Number, big.NewInt(1))
 	pool.istanbul = pool.config.IsIstanbul(next)
-	pool.eip2718 = pool.config.IsBerlin(next)
+	pool.eip2718 = pool.config.IsBerlin(next, uint64(time.Now().Unix()))
 }
 
 // Stop stops the light transaction pool
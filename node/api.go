@@ -18,8 +18,12 @@ package node
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/avalanria/go-avalanria/common/hexutil"
 	"github.com/avalanria/go-avalanria/crypto"
@@ -125,6 +129,125 @@ func (api *privateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
 	return true, nil
 }
 
+// BanPeer disconnects a remote node and bans it from reconnecting for the given
+// number of seconds. Trusted and static nodes are exempt from bans.
+func (api *privateAdminAPI) BanPeer(url string, seconds uint64) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	node, err := enode.Parse(enode.ValidSchemes, url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	until, err := banExpiry(seconds)
+	if err != nil {
+		return false, err
+	}
+	if err := server.BanNode(node.ID(), until); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// BanSubnet disconnects all remote nodes in an IP network, given in CIDR notation,
+// and bans them from connecting for the given number of seconds. Trusted and
+// static nodes are exempt from bans.
+func (api *privateAdminAPI) BanSubnet(cidr string, seconds uint64) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, fmt.Errorf("invalid subnet: %v", err)
+	}
+	until, err := banExpiry(seconds)
+	if err != nil {
+		return false, err
+	}
+	if err := server.BanSubnet(subnet, until); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Unban lifts the ban of a remote node, given by its enode URL, or of an IP
+// network, given in CIDR notation.
+func (api *privateAdminAPI) Unban(target string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	if strings.Contains(target, "/") {
+		_, subnet, err := net.ParseCIDR(target)
+		if err != nil {
+			return false, fmt.Errorf("invalid subnet: %v", err)
+		}
+		if err := server.UnbanSubnet(subnet); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	node, err := enode.Parse(enode.ValidSchemes, target)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	if err := server.UnbanNode(node.ID()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ListBans retrieves the currently active node and subnet bans, including the
+// nodes banned due to their bad reputation.
+func (api *privateAdminAPI) ListBans() ([]*p2p.BanInfo, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.BansInfo()
+}
+
+// Allowlist retrieves the nodes permitted to connect on a private network, or
+// nil if admission is not restricted.
+func (api *privateAdminAPI) Allowlist() (*p2p.Allowlist, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.Allowlist(), nil
+}
+
+// SetAllowlist replaces the nodes permitted to connect on a private network,
+// disconnecting the peers which are no longer members.
+func (api *privateAdminAPI) SetAllowlist(list p2p.Allowlist) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	if err := server.SetAllowlist(&list); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// banExpiry returns the expiration time of a ban lasting the given number of
+// seconds.
+func banExpiry(seconds uint64) (time.Time, error) {
+	const max = uint64(time.Duration(math.MaxInt64) / time.Second)
+	if seconds == 0 {
+		return time.Time{}, errors.New("ban duration must be positive")
+	}
+	if seconds > max {
+		return time.Time{}, errors.New("ban duration too large")
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second), nil
+}
+
 // PeerEvents creates an RPC subscription which receives peer events from the
 // node's p2p.Server
 func (api *privateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
@@ -19,11 +19,13 @@ package node
 import (
 	"bytes"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/avalanria/go-avalanria/rpc"
 	"github.com/stretchr/testify/assert"
@@ -340,6 +342,23 @@ func checkRPC(url string) bool {
 	return err == nil
 }
 
+// Tests that ban durations out of the representable range are rejected instead
+// of overflowing into the past.
+func TestBanExpiry(t *testing.T) {
+	for _, seconds := range []uint64{0, math.MaxUint64, uint64(math.MaxInt64)/uint64(time.Second) + 1} {
+		if until, err := banExpiry(seconds); err == nil {
+			t.Errorf("%d seconds: expected error, got expiry %v", seconds, until)
+		}
+	}
+	until, err := banExpiry(3600)
+	if err != nil {
+		t.Fatalf("failed to compute expiry: %v", err)
+	}
+	if d := time.Until(until); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("wrong expiry: %v from now", d)
+	}
+}
+
 // string/int pointer helpers.
 func sp(s string) *string { return &s }
 func ip(i int) *int       { return &i }
@@ -50,6 +50,9 @@ var DefaultConfig = Config{
 		ListenAddr: ":30303",
 		MaxPeers:   50,
 		NAT:        nat.Any(),
+
+		// Block propagation gets most of a limited upload bandwidth.
+		UploadWeights: map[string]uint{"avn": 4, "snap": 1},
 	},
 }
 
@@ -0,0 +1,259 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common/hexutil"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/rlp"
+)
+
+// allowlistRefresh is the interval at which the allowlist file is checked for
+// changes.
+const allowlistRefresh = 10 * time.Second
+
+var (
+	errNoAllowlist        = errors.New("allowlist not enabled")
+	errAllowlistSignature = errors.New("invalid allowlist signature")
+	errAllowlistStale     = errors.New("allowlist sequence number not newer than current")
+)
+
+// Allowlist is the set of nodes permitted to connect on a private network. The
+// list may be signed by an admin key, in which case updates must carry increasing
+// sequence numbers.
+type Allowlist struct {
+	Seq       uint64        `json:"seq"`
+	Nodes     []enode.ID    `json:"nodes"`
+	Signature hexutil.Bytes `json:"signature,omitempty"`
+}
+
+// SigHash returns the hash signed by the admin key.
+func (l *Allowlist) SigHash() []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{l.Seq, l.Nodes})
+	return crypto.Keccak256(enc)
+}
+
+// Sign signs the list with the given admin key.
+func (l *Allowlist) Sign(key *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(l.SigHash(), key)
+	if err != nil {
+		return err
+	}
+	l.Signature = sig
+	return nil
+}
+
+// Verify checks that the list is signed by the given admin key.
+func (l *Allowlist) Verify(pubkey *ecdsa.PublicKey) error {
+	if len(l.Signature) != crypto.SignatureLength {
+		return errAllowlistSignature
+	}
+	if !crypto.VerifySignature(crypto.FromECDSAPub(pubkey), l.SigHash(), l.Signature[:64]) {
+		return errAllowlistSignature
+	}
+	return nil
+}
+
+// LoadAllowlist reads an allowlist from a JSON file.
+func LoadAllowlist(file string) (*Allowlist, error) {
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	list := new(Allowlist)
+	if err := json.Unmarshal(blob, list); err != nil {
+		return nil, fmt.Errorf("invalid allowlist %s: %v", file, err)
+	}
+	return list, nil
+}
+
+// SaveAllowlist writes an allowlist to a JSON file, replacing it atomically.
+func SaveAllowlist(file string, list *Allowlist) error {
+	blob, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(blob); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// Allowlist returns the nodes currently permitted to connect, or nil if admission
+// is not restricted.
+func (srv *Server) Allowlist() *Allowlist {
+	srv.allowLock.RLock()
+	defer srv.allowLock.RUnlock()
+
+	return srv.allowlist
+}
+
+// SetAllowlist replaces the nodes permitted to connect, disconnecting the peers
+// which are no longer members. If an admin key is configured, the list must be
+// signed by it and have a higher sequence number than the current one. The list
+// is persisted to the allowlist file.
+func (srv *Server) SetAllowlist(list *Allowlist) error {
+	if srv.AllowlistFile == "" {
+		return errNoAllowlist
+	}
+	// Check the server state before serialising with reloads, as the startup
+	// loads the allowlist with the server lock held
+	srv.lock.Lock()
+	running := srv.running
+	srv.lock.Unlock()
+	if !running {
+		return errServerStopped
+	}
+	srv.allowWrite.Lock()
+	defer srv.allowWrite.Unlock()
+
+	if err := srv.applyAllowlist(list, false); err != nil {
+		return err
+	}
+	srv.disconnectNotAllowed()
+
+	if err := SaveAllowlist(srv.AllowlistFile, list); err != nil {
+		return err
+	}
+	if info, err := os.Stat(srv.AllowlistFile); err == nil {
+		srv.allowLock.Lock()
+		srv.allowModTime = info.ModTime()
+		srv.allowLock.Unlock()
+	}
+	return nil
+}
+
+// loadAllowlist reads the allowlist file if it changed since it was last read,
+// returning whether a new list was activated. The whole reload is serialised
+// with admin updates, so it can't revert one with the stale file contents.
+func (srv *Server) loadAllowlist() (bool, error) {
+	srv.allowWrite.Lock()
+	defer srv.allowWrite.Unlock()
+
+	info, err := os.Stat(srv.AllowlistFile)
+	if err != nil {
+		return false, err
+	}
+	srv.allowLock.RLock()
+	unchanged := srv.allowlist != nil && info.ModTime().Equal(srv.allowModTime)
+	srv.allowLock.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	list, err := LoadAllowlist(srv.AllowlistFile)
+	if err != nil {
+		return false, err
+	}
+	if err := srv.applyAllowlist(list, true); err != nil {
+		return false, err
+	}
+	srv.allowLock.Lock()
+	srv.allowModTime = info.ModTime()
+	srv.allowLock.Unlock()
+	return true, nil
+}
+
+// applyAllowlist verifies and activates a new allowlist. Lists loaded from disk
+// may repeat the current sequence number, updates must increase it.
+func (srv *Server) applyAllowlist(list *Allowlist, reload bool) error {
+	allowed := make(map[enode.ID]struct{}, len(list.Nodes))
+	for _, id := range list.Nodes {
+		allowed[id] = struct{}{}
+	}
+	srv.allowLock.Lock()
+	if srv.AllowlistKey != nil {
+		if err := list.Verify(srv.AllowlistKey); err != nil {
+			srv.allowLock.Unlock()
+			return err
+		}
+		if current := srv.allowlist; current != nil && (list.Seq < current.Seq || (!reload && list.Seq == current.Seq)) {
+			srv.allowLock.Unlock()
+			return errAllowlistStale
+		}
+	}
+	srv.allowlist, srv.allowed = list, allowed
+	srv.allowLock.Unlock()
+
+	srv.log.Info("Updated node allowlist", "seq", list.Seq, "nodes", len(list.Nodes))
+	return nil
+}
+
+// disconnectNotAllowed disconnects the peers which are not on the allowlist.
+func (srv *Server) disconnectNotAllowed() {
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		for id, p := range peers {
+			if !srv.isAllowed(id) {
+				p.Disconnect(DiscNotAllowed)
+			}
+		}
+	})
+}
+
+// isAllowed reports whether a node may connect.
+func (srv *Server) isAllowed(id enode.ID) bool {
+	srv.allowLock.RLock()
+	defer srv.allowLock.RUnlock()
+
+	if srv.allowed == nil {
+		return true
+	}
+	_, ok := srv.allowed[id]
+	return ok
+}
+
+// allowlistLoop picks up changes of the allowlist file.
+func (srv *Server) allowlistLoop() {
+	defer srv.loopWG.Done()
+
+	refresh := time.NewTicker(allowlistRefresh)
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-refresh.C:
+			changed, err := srv.loadAllowlist()
+			if err != nil {
+				srv.log.Warn("Failed to reload node allowlist", "file", srv.AllowlistFile, "err", err)
+			}
+			if changed {
+				srv.disconnectNotAllowed()
+			}
+		case <-srv.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/internal/testlog"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/enr"
+)
+
+// Tests that allowlists can be signed and verified, and that tampering with them
+// is detected.
+func TestAllowlistSignature(t *testing.T) {
+	admin := newkey()
+	list := &Allowlist{Seq: 1, Nodes: []enode.ID{randomID(), randomID()}}
+	if err := list.Verify(&admin.PublicKey); err != errAllowlistSignature {
+		t.Fatalf("unsigned list verified: %v", err)
+	}
+	if err := list.Sign(admin); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Verify(&admin.PublicKey); err != nil {
+		t.Fatalf("signed list not verified: %v", err)
+	}
+	if err := list.Verify(&newkey().PublicKey); err != errAllowlistSignature {
+		t.Fatalf("list verified with wrong key: %v", err)
+	}
+	list.Nodes = append(list.Nodes, randomID())
+	if err := list.Verify(&admin.PublicKey); err != errAllowlistSignature {
+		t.Fatalf("tampered list verified: %v", err)
+	}
+}
+
+// Tests that only nodes on the allowlist may connect, and that the allowlist can
+// be updated through the server and the allowlist file.
+func TestServerAllowlist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2p-allowlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		admin  = newkey()
+		file   = filepath.Join(dir, "allowlist.json")
+		member = randomID()
+		other  = randomID()
+	)
+	signed := func(seq uint64, ids ...enode.ID) *Allowlist {
+		list := &Allowlist{Seq: seq, Nodes: ids}
+		if err := list.Sign(admin); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	if err := SaveAllowlist(file, signed(1, member)); err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{
+		Config: Config{
+			PrivateKey:    newkey(),
+			MaxPeers:      10,
+			NoDial:        true,
+			NoDiscovery:   true,
+			AllowlistFile: file,
+			AllowlistKey:  &admin.PublicKey,
+			Logger:        testlog.Logger(t, log.LvlTrace),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	check := func(id enode.ID, want error) {
+		t.Helper()
+		fd, _ := net.Pipe()
+		tx := newTestTransport(&newkey().PublicKey, fd, nil)
+		c := &conn{fd: fd, transport: tx, flags: inboundConn, node: enode.SignNull(new(enr.Record), id), cont: make(chan error)}
+		if err := srv.checkpoint(c, srv.checkpointPostHandshake); err != want {
+			t.Errorf("wrong error for node %v: have %v, want %v", id, err, want)
+		}
+	}
+	check(member, nil)
+	check(other, DiscNotAllowed)
+
+	// Updates must be signed by the admin key and newer than the current list.
+	if err := srv.SetAllowlist(&Allowlist{Seq: 2, Nodes: []enode.ID{other}}); err != errAllowlistSignature {
+		t.Errorf("wrong error for unsigned update: %v", err)
+	}
+	if err := srv.SetAllowlist(signed(1, other)); err != errAllowlistStale {
+		t.Errorf("wrong error for stale update: %v", err)
+	}
+	if err := srv.SetAllowlist(signed(2, other)); err != nil {
+		t.Fatalf("could not update allowlist: %v", err)
+	}
+	check(member, DiscNotAllowed)
+	check(other, nil)
+	if list, err := LoadAllowlist(file); err != nil || list.Seq != 2 {
+		t.Fatalf("update not persisted: %v %v", list, err)
+	}
+	// Changes of the allowlist file are picked up.
+	if err := SaveAllowlist(file, signed(3, member)); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(file, future, future)
+	if changed, err := srv.loadAllowlist(); !changed || err != nil {
+		t.Fatalf("allowlist file not reloaded: %v", err)
+	}
+	check(member, nil)
+	check(other, DiscNotAllowed)
+	if seq := srv.Allowlist().Seq; seq != 3 {
+		t.Errorf("wrong allowlist seq: have %d, want %d", seq, 3)
+	}
+}
@@ -79,6 +79,9 @@ var (
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNetRestrict      = errors.New("not contained in netrestrict list")
 	errNoPort           = errors.New("node does not provide TCP port")
+	errBanned           = errors.New("banned due to bad reputation")
+	errLowReputation    = errors.New("low reputation")
+	errNotAllowed       = errors.New("not on allowlist")
 )
 
 // dialer creates outbound connections and submits them into Server.
@@ -130,10 +133,12 @@ type dialScheduler struct {
 type dialSetupFunc func(net.Conn, connFlag, *enode.Node) error
 
 type dialConfig struct {
-	self           enode.ID         // our own ID
-	maxDialPeers   int              // maximum number of dialed peers
-	maxActiveDials int              // maximum number of active dials
-	netRestrict    *netutil.Netlist // IP netrestrict list, disabled if nil
+	self           enode.ID            // our own ID
+	maxDialPeers   int                 // maximum number of dialed peers
+	maxActiveDials int                 // maximum number of active dials
+	netRestrict    *netutil.Netlist    // IP netrestrict list, disabled if nil
+	reputation     *reputation         // node reputations, disabled if nil
+	allowed        func(enode.ID) bool // admission check of private networks, disabled if nil
 	resolver       nodeResolver
 	dialer         NodeDialer
 	log            log.Logger
@@ -242,7 +247,14 @@ loop:
 
 		select {
 		case node := <-nodesCh:
-			if err := d.checkDial(node); err != nil {
+			err := d.checkDial(node)
+			if err == nil && d.allowed != nil && !d.allowed(node.ID()) {
+				err = errNotAllowed
+			}
+			if err == nil {
+				err = d.checkReputation(node)
+			}
+			if err != nil {
 				d.log.Trace("Discarding dial candidate", "id", node.ID(), "ip", node.IP(), "reason", err)
 			} else {
 				d.startDial(newDialTask(node, dynDialedConn))
@@ -410,6 +422,22 @@ func (d *dialScheduler) checkDial(n *enode.Node) error {
 	return nil
 }
 
+// checkReputation returns an error if the dynamic dial candidate n should be skipped
+// due to its reputation. Banned nodes are never dialed, nodes with a negative score
+// are skipped with a probability growing towards the ban score.
+func (d *dialScheduler) checkReputation(n *enode.Node) error {
+	if d.reputation == nil {
+		return nil
+	}
+	if d.reputation.banned(n.ID(), n.IP()) {
+		return errBanned
+	}
+	if score := d.reputation.score(n.ID()); score < 0 && d.rand.Float64() < score/banScore {
+		return errLowReputation
+	}
+	return nil
+}
+
 // startStaticDials starts n static dial tasks.
 func (d *dialScheduler) startStaticDials(n int) (started int) {
 	for started = 0; started < n && len(d.staticPool) > 0; started++ {
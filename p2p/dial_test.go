@@ -152,6 +152,45 @@ func TestDialSchedNetRestrict(t *testing.T) {
 	})
 }
 
+// This test checks that banned and badly scored candidates are not dialed.
+func TestDialSchedReputation(t *testing.T) {
+	t.Parallel()
+
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+
+	nodes := []*enode.Node{
+		newNode(uintID(0x01), "127.0.0.1:30303"),
+		newNode(uintID(0x02), "127.0.0.2:30303"),
+		newNode(uintID(0x03), "127.0.0.3:30303"),
+		newNode(uintID(0x04), "127.0.0.4:30303"),
+	}
+	config := dialConfig{
+		reputation:     newReputation(db),
+		maxActiveDials: 10,
+		maxDialPeers:   10,
+	}
+	// Ban the second node, and give the third one a score way past the ban
+	// score without banning it
+	config.reputation.report(nodes[1].ID(), ScoreInvalid)
+	config.reputation.report(nodes[1].ID(), ScoreInvalid)
+	db.UpdateScore(nodes[2].ID(), minScore, time.Now())
+	config.reputation.report(nodes[3].ID(), ScoreUseful)
+
+	runDialTest(t, config, []dialTestRound{
+		{
+			discovered:   nodes,
+			wantNewDials: []*enode.Node{nodes[0], nodes[3]},
+		},
+		{
+			succeeded: []enode.ID{
+				nodes[0].ID(),
+				nodes[3].ID(),
+			},
+		},
+	})
+}
+
 // This test checks that static dials work and obey the limits.
 func TestDialSchedStaticDial(t *testing.T) {
 	t.Parallel()
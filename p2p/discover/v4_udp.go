@@ -45,6 +45,7 @@ var (
 	errClockWarp        = errors.New("reply deadline too far in the future")
 	errClosed           = errors.New("socket closed")
 	errLowPort          = errors.New("low port")
+	errBanned           = errors.New("banned")
 )
 
 const (
@@ -713,6 +714,9 @@ func (t *UDPv4) verifyFindnode(h *packetHandlerV4, from *net.UDPAddr, fromID eno
 		// findnode) to the victim.
 		return errUnknownNode
 	}
+	if t.db.Banned(fromID, from.IP) {
+		return errBanned
+	}
 	return nil
 }
 
@@ -728,7 +732,7 @@ func (t *UDPv4) handleFindnode(h *packetHandlerV4, from *net.UDPAddr, fromID eno
 	p := v4wire.Neighbors{Expiration: uint64(time.Now().Add(expiration).Unix())}
 	var sent bool
 	for _, n := range closest {
-		if netutil.CheckRelayIP(from.IP, n.IP()) == nil {
+		if netutil.CheckRelayIP(from.IP, n.IP()) == nil && !t.db.Banned(n.ID(), n.IP()) {
 			p.Nodes = append(p.Nodes, nodeToRPC(n))
 		}
 		if len(p.Nodes) == v4wire.MaxNeighbors {
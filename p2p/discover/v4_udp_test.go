@@ -304,6 +304,31 @@ func TestUDPv4_findnode(t *testing.T) {
 	waitNeighbors(want)
 }
 
+func TestUDPv4_findnodeBanned(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.close()
+
+	remoteID := v4wire.EncodePubkey(&test.remotekey.PublicKey).ID()
+	test.table.db.UpdateLastPongReceived(remoteID, test.remoteaddr.IP, time.Now())
+
+	// Banned nodes are excluded from the results.
+	banned := wrapNode(enode.NewV4(&newkey().PublicKey, net.IP{10, 13, 0, 1}, 0, 2000))
+	banned.livenessChecks = 1
+	fillTable(test.table, []*node{banned})
+	test.table.db.UpdateBannedUntil(banned.ID(), time.Now().Add(time.Hour))
+
+	test.packetIn(nil, &v4wire.Findnode{Target: testTarget, Expiration: futureExp})
+	test.waitPacketOut(func(p *v4wire.Neighbors, to *net.UDPAddr, hash []byte) {
+		if len(p.Nodes) != 0 {
+			t.Errorf("banned node returned: %v", p.Nodes)
+		}
+	})
+	// Requests of banned nodes are not answered.
+	_, subnet, _ := net.ParseCIDR("10.0.1.0/24")
+	test.table.db.BanSubnet(subnet, time.Now().Add(time.Hour))
+	test.packetIn(errBanned, &v4wire.Findnode{Target: testTarget, Expiration: futureExp})
+}
+
 func TestUDPv4_findnodeMultiReply(t *testing.T) {
 	test := newUDPTest(t)
 	defer test.close()
@@ -0,0 +1,510 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common/mclock"
+	"github.com/avalanria/go-avalanria/p2p/discover/v5wire"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/netutil"
+	"github.com/avalanria/go-avalanria/rlp"
+)
+
+const (
+	topicAdLifetime = 15 * time.Minute // Time an ad stays in the topic table
+	topicQueueLimit = 50               // Maximum number of ads per topic
+	topicTableLimit = 500              // Maximum number of ads in total
+	topicIPLimit    = 5                // Maximum number of ads per topic and /24 subnet
+	topicWaitStep   = 5 * time.Second  // Wait time added for each ad already in the topic queue
+	topicRegWindow  = 10 * time.Second // Time after the wait time during which a ticket is accepted
+
+	topicRegistrars     = 8                // Number of nodes an ad is placed at
+	topicRetryInterval  = time.Minute      // Time before retrying a registration which got rejected everywhere
+	topicSearchInterval = 10 * time.Second // Pause between topic searches which found nothing
+
+	topicQueryResultLimit = totalNodesResponseLimit * nodesResponseItemLimit
+)
+
+var (
+	errInvalidTopic   = errors.New("invalid topic")
+	errInvalidTicket  = errors.New("invalid ticket")
+	errTicketOwner    = errors.New("ticket issued to different node")
+	errTicketEarly    = errors.New("ticket wait time not elapsed")
+	errTicketExpired  = errors.New("ticket expired")
+	errAdEndpoint     = errors.New("ad endpoint does not match sender")
+	errTopicFull      = errors.New("topic queue full")
+	errTopicRejected  = errors.New("topic registration rejected")
+	errTopicWaitLimit = errors.New("topic wait time too long")
+)
+
+// Topic identifies a service nodes can advertise themselves under. Ads for a topic
+// are placed at the nodes closest to the topic hash.
+type Topic [32]byte
+
+// NewTopic returns the topic with the given name.
+func NewTopic(name string) Topic {
+	return Topic(sha256.Sum256([]byte(name)))
+}
+
+// String returns the topic hash in hex.
+func (t Topic) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// topicTable stores the ads registered at the local node. It is only accessed by
+// the dispatch loop of UDPv5.
+type topicTable struct {
+	queues map[Topic]*topicQueue
+	total  int
+}
+
+// topicQueue holds the ads of a single topic, ordered by expiration.
+type topicQueue struct {
+	ads []*topicAd
+	ips netutil.DistinctNetSet
+}
+
+type topicAd struct {
+	node    *enode.Node
+	expires mclock.AbsTime
+}
+
+func newTopicTable() *topicTable {
+	return &topicTable{queues: make(map[Topic]*topicQueue)}
+}
+
+// expire removes the ads which expired by the given time.
+func (tt *topicTable) expire(now mclock.AbsTime) {
+	for topic, q := range tt.queues {
+		for len(q.ads) > 0 && q.ads[0].expires <= now {
+			q.ips.Remove(q.ads[0].node.IP())
+			q.ads = q.ads[1:]
+			tt.total--
+		}
+		if len(q.ads) == 0 {
+			delete(tt.queues, topic)
+		}
+	}
+}
+
+// waitTime returns the time a node has to wait before registering an ad for the
+// topic. The wait time grows with the number of ads in the topic queue, and lasts
+// until an ad expires if the queue or the table is full.
+func (tt *topicTable) waitTime(topic Topic, now mclock.AbsTime) time.Duration {
+	tt.expire(now)
+
+	q := tt.queues[topic]
+	switch {
+	case q != nil && len(q.ads) >= topicQueueLimit:
+		return q.ads[0].expires.Sub(now)
+	case tt.total >= topicTableLimit:
+		oldest := mclock.AbsTime(math.MaxInt64)
+		for _, q := range tt.queues {
+			if q.ads[0].expires < oldest {
+				oldest = q.ads[0].expires
+			}
+		}
+		return oldest.Sub(now)
+	case q != nil:
+		return time.Duration(len(q.ads)) * topicWaitStep
+	default:
+		return 0
+	}
+}
+
+// add registers an ad for the topic, replacing the previous ad of the node.
+func (tt *topicTable) add(topic Topic, n *enode.Node, now mclock.AbsTime) error {
+	tt.expire(now)
+
+	q := tt.queues[topic]
+	if q == nil {
+		q = &topicQueue{ips: netutil.DistinctNetSet{Subnet: tableSubnet, Limit: topicIPLimit}}
+		tt.queues[topic] = q
+	}
+	for i, ad := range q.ads {
+		if ad.node.ID() == n.ID() {
+			q.ips.Remove(ad.node.IP())
+			q.ads = append(q.ads[:i], q.ads[i+1:]...)
+			tt.total--
+			break
+		}
+	}
+	switch {
+	case len(q.ads) >= topicQueueLimit || tt.total >= topicTableLimit:
+		return errTopicFull
+	case !netutil.IsLAN(n.IP()) && !q.ips.Add(n.IP()):
+		return errTopicFull
+	}
+	q.ads = append(q.ads, &topicAd{node: n, expires: now.Add(topicAdLifetime)})
+	tt.total++
+	return nil
+}
+
+// nodes returns the most recently registered nodes of the topic.
+func (tt *topicTable) nodes(topic Topic, now mclock.AbsTime, limit int) []*enode.Node {
+	tt.expire(now)
+
+	q := tt.queues[topic]
+	if q == nil {
+		return nil
+	}
+	var nodes []*enode.Node
+	for i := len(q.ads) - 1; i >= 0 && len(nodes) < limit; i-- {
+		nodes = append(nodes, q.ads[i].node)
+	}
+	return nodes
+}
+
+// topicTicket is issued by registrars to nodes requesting to register an ad. The
+// ticket is authenticated by the registrar, which accepts it after the wait time.
+type topicTicket struct {
+	Topic  Topic
+	ID     enode.ID
+	IP     net.IP
+	Issued uint64 // mclock.AbsTime of the registrar
+	Wait   uint64 // time.Duration
+}
+
+// encodeTicket encodes and authenticates a ticket.
+func (t *UDPv5) encodeTicket(tk *topicTicket) []byte {
+	enc, _ := rlp.EncodeToBytes(tk)
+	mac := hmac.New(sha256.New, t.ticketKey[:])
+	mac.Write(enc)
+	return mac.Sum(enc)
+}
+
+// decodeTicket checks the authenticity of a ticket and decodes it.
+func (t *UDPv5) decodeTicket(ticket []byte) (*topicTicket, error) {
+	if len(ticket) < sha256.Size {
+		return nil, errInvalidTicket
+	}
+	enc, sum := ticket[:len(ticket)-sha256.Size], ticket[len(ticket)-sha256.Size:]
+	mac := hmac.New(sha256.New, t.ticketKey[:])
+	mac.Write(enc)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return nil, errInvalidTicket
+	}
+	tk := new(topicTicket)
+	if err := rlp.DecodeBytes(enc, tk); err != nil {
+		return nil, errInvalidTicket
+	}
+	return tk, nil
+}
+
+// handleRequestTicket issues a ticket for registering an ad.
+func (t *UDPv5) handleRequestTicket(p *v5wire.RequestTicket, fromID enode.ID, fromAddr *net.UDPAddr) {
+	if t.db.Banned(fromID, fromAddr.IP) {
+		t.log.Trace("Ignoring REQUESTTICKET from banned node", "id", fromID, "addr", fromAddr)
+		return
+	}
+	var topic Topic
+	if len(p.Topic) != len(topic) {
+		t.log.Debug("Invalid "+p.Name(), "id", fromID, "addr", fromAddr, "err", errInvalidTopic)
+		return
+	}
+	copy(topic[:], p.Topic)
+
+	now := t.clock.Now()
+	wait := t.topics.waitTime(topic, now)
+	ticket := t.encodeTicket(&topicTicket{Topic: topic, ID: fromID, IP: fromAddr.IP, Issued: uint64(now), Wait: uint64(wait)})
+	t.sendResponse(fromID, fromAddr, &v5wire.Ticket{
+		ReqID:    p.ReqID,
+		Ticket:   ticket,
+		WaitTime: uint64(math.Ceil(wait.Seconds())),
+	})
+}
+
+// handleRegtopic registers an ad if the ticket is valid.
+func (t *UDPv5) handleRegtopic(p *v5wire.Regtopic, fromID enode.ID, fromAddr *net.UDPAddr) {
+	if t.db.Banned(fromID, fromAddr.IP) {
+		t.log.Trace("Ignoring REGTOPIC from banned node", "id", fromID, "addr", fromAddr)
+		return
+	}
+	err := t.registerAd(p, fromID, fromAddr)
+	if err != nil {
+		t.log.Debug("Rejected topic registration", "id", fromID, "addr", fromAddr, "err", err)
+	}
+	t.sendResponse(fromID, fromAddr, &v5wire.Regconfirmation{ReqID: p.ReqID, Registered: err == nil})
+}
+
+// registerAd validates a REGTOPIC request and adds the ad to the topic table.
+func (t *UDPv5) registerAd(p *v5wire.Regtopic, fromID enode.ID, fromAddr *net.UDPAddr) error {
+	tk, err := t.decodeTicket(p.Ticket)
+	if err != nil {
+		return err
+	}
+	if tk.ID != fromID || !tk.IP.Equal(fromAddr.IP) {
+		return errTicketOwner
+	}
+	now := t.clock.Now()
+	start := mclock.AbsTime(tk.Issued).Add(time.Duration(tk.Wait))
+	if now < start {
+		return errTicketEarly
+	}
+	if now > start.Add(topicRegWindow) {
+		return errTicketExpired
+	}
+	if p.ENR == nil {
+		return errAdEndpoint
+	}
+	n, err := enode.New(t.validSchemes, p.ENR)
+	if err != nil {
+		return err
+	}
+	if n.ID() != fromID || !n.IP().Equal(fromAddr.IP) {
+		return errAdEndpoint
+	}
+	return t.topics.add(tk.Topic, n, now)
+}
+
+// handleTopicQuery returns the nodes registered for a topic.
+func (t *UDPv5) handleTopicQuery(p *v5wire.TopicQuery, fromID enode.ID, fromAddr *net.UDPAddr) {
+	if t.db.Banned(fromID, fromAddr.IP) {
+		t.log.Trace("Ignoring TOPICQUERY from banned node", "id", fromID, "addr", fromAddr)
+		return
+	}
+	var topic Topic
+	if len(p.Topic) != len(topic) {
+		t.log.Debug("Invalid "+p.Name(), "id", fromID, "addr", fromAddr, "err", errInvalidTopic)
+		return
+	}
+	copy(topic[:], p.Topic)
+
+	var nodes []*enode.Node
+	for _, n := range t.topics.nodes(topic, t.clock.Now(), topicQueryResultLimit) {
+		if netutil.CheckRelayIP(fromAddr.IP, n.IP()) != nil || t.db.Banned(n.ID(), n.IP()) {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	for _, resp := range packNodes(p.ReqID, nodes) {
+		t.sendResponse(fromID, fromAddr, resp)
+	}
+}
+
+// RegisterTopic starts advertising the local node under the given topic. The ad is
+// placed at the nodes closest to the topic hash and renewed until StopRegisterTopic
+// is called or the transport is closed.
+func (t *UDPv5) RegisterTopic(topic Topic) {
+	t.reglock.Lock()
+	defer t.reglock.Unlock()
+
+	if _, ok := t.regs[topic]; ok || t.closeCtx.Err() != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(t.closeCtx)
+	t.regs[topic] = cancel
+	t.wg.Add(1)
+	go t.topicRegLoop(ctx, topic)
+}
+
+// StopRegisterTopic stops advertising the local node under the given topic. Ads
+// already placed remain until they expire.
+func (t *UDPv5) StopRegisterTopic(topic Topic) {
+	t.reglock.Lock()
+	defer t.reglock.Unlock()
+
+	if cancel, ok := t.regs[topic]; ok {
+		cancel()
+		delete(t.regs, topic)
+	}
+}
+
+// topicRegLoop places ads for a topic at the nodes closest to it, renewing them
+// before they expire.
+func (t *UDPv5) topicRegLoop(ctx context.Context, topic Topic) {
+	defer t.wg.Done()
+
+	for {
+		registrars := t.newLookup(ctx, enode.ID(topic)).run()
+		if len(registrars) > topicRegistrars {
+			registrars = registrars[:topicRegistrars]
+		}
+		var (
+			wg         sync.WaitGroup
+			registered int32
+		)
+		for _, n := range registrars {
+			wg.Add(1)
+			go func(n *enode.Node) {
+				defer wg.Done()
+				if err := t.registerTopic(ctx, n, topic); err != nil {
+					t.log.Trace("Topic registration failed", "topic", topic, "id", n.ID(), "err", err)
+					return
+				}
+				atomic.AddInt32(&registered, 1)
+			}(n)
+		}
+		wg.Wait()
+
+		next := topicRetryInterval
+		if registered > 0 {
+			t.log.Debug("Registered topic", "topic", topic, "registrars", registered)
+			next = topicAdLifetime / 2
+		}
+		timer := t.clock.NewTimer(next)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// registerTopic places an ad for a topic at a single node.
+func (t *UDPv5) registerTopic(ctx context.Context, n *enode.Node, topic Topic) error {
+	ticket, wait, err := t.requestTicket(n, topic)
+	if err != nil {
+		return err
+	}
+	if wait > topicAdLifetime {
+		return errTopicWaitLimit
+	}
+	timer := t.clock.NewTimer(wait)
+	select {
+	case <-timer.C():
+	case <-ctx.Done():
+		timer.Stop()
+		return errClosed
+	}
+	return t.regtopic(n, ticket)
+}
+
+// requestTicket calls REQUESTTICKET on a node and waits for a TICKET response.
+func (t *UDPv5) requestTicket(n *enode.Node, topic Topic) ([]byte, time.Duration, error) {
+	resp := t.call(n, v5wire.TicketMsg, &v5wire.RequestTicket{Topic: topic[:]})
+	defer t.callDone(resp)
+
+	select {
+	case p := <-resp.ch:
+		ticket := p.(*v5wire.Ticket)
+		return ticket.Ticket, time.Duration(ticket.WaitTime) * time.Second, nil
+	case err := <-resp.err:
+		return nil, 0, err
+	}
+}
+
+// regtopic calls REGTOPIC on a node and waits for a REGCONFIRMATION response.
+func (t *UDPv5) regtopic(n *enode.Node, ticket []byte) error {
+	req := &v5wire.Regtopic{Ticket: ticket, ENR: t.localNode.Node().Record()}
+	resp := t.call(n, v5wire.RegconfirmationMsg, req)
+	defer t.callDone(resp)
+
+	select {
+	case p := <-resp.ch:
+		if !p.(*v5wire.Regconfirmation).Registered {
+			return errTopicRejected
+		}
+		return nil
+	case err := <-resp.err:
+		return err
+	}
+}
+
+// topicQuery calls TOPICQUERY on a node and waits for the NODES responses.
+func (t *UDPv5) topicQuery(n *enode.Node, topic Topic) ([]*enode.Node, error) {
+	resp := t.call(n, v5wire.NodesMsg, &v5wire.TopicQuery{Topic: topic[:]})
+	return t.waitForNodes(resp, nil)
+}
+
+// TopicSearch returns an iterator over the nodes advertising the given topic. It
+// repeatedly queries the nodes closest to the topic hash for their ads.
+func (t *UDPv5) TopicSearch(topic Topic) enode.Iterator {
+	ctx, cancel := context.WithCancel(t.closeCtx)
+	return &topicIterator{t: t, topic: topic, ctx: ctx, cancel: cancel}
+}
+
+// topicIterator searches for the nodes advertising a topic.
+type topicIterator struct {
+	t      *UDPv5
+	topic  Topic
+	ctx    context.Context
+	cancel func()
+	buffer []*enode.Node
+	idle   bool // whether the last search found nothing
+}
+
+// Node returns the current node.
+func (it *topicIterator) Node() *enode.Node {
+	if len(it.buffer) == 0 {
+		return nil
+	}
+	return it.buffer[0]
+}
+
+// Next moves to the next node.
+func (it *topicIterator) Next() bool {
+	if len(it.buffer) > 0 {
+		it.buffer = it.buffer[1:]
+	}
+	for len(it.buffer) == 0 {
+		if it.ctx.Err() != nil {
+			it.buffer = nil
+			return false
+		}
+		if it.idle {
+			timer := it.t.clock.NewTimer(topicSearchInterval)
+			select {
+			case <-timer.C():
+			case <-it.ctx.Done():
+				timer.Stop()
+				continue
+			}
+		}
+		it.search()
+		it.idle = len(it.buffer) == 0
+	}
+	return true
+}
+
+// search queries the nodes closest to the topic for their ads.
+func (it *topicIterator) search() {
+	registrars := it.t.newLookup(it.ctx, enode.ID(it.topic)).run()
+	results := make(chan []*enode.Node, len(registrars))
+	for _, n := range registrars {
+		go func(n *enode.Node) {
+			nodes, _ := it.t.topicQuery(n, it.topic)
+			results <- nodes
+		}(n)
+	}
+	seen := make(map[enode.ID]bool)
+	for range registrars {
+		for _, n := range <-results {
+			if !seen[n.ID()] && n.ID() != it.t.Self().ID() {
+				seen[n.ID()] = true
+				it.buffer = append(it.buffer, n)
+			}
+		}
+	}
+}
+
+// Close ends the iterator.
+func (it *topicIterator) Close() {
+	it.cancel()
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common/mclock"
+	"github.com/avalanria/go-avalanria/p2p/discover/v5wire"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/enr"
+)
+
+// This test checks that the topic table enforces its limits and expires ads.
+func TestTopicTable(t *testing.T) {
+	var (
+		tab   = newTopicTable()
+		topic = NewTopic("foo")
+		now   = mclock.AbsTime(0)
+	)
+	nodeAt := func(ip net.IP) *enode.Node {
+		var r enr.Record
+		r.Set(enr.IP(ip))
+		return enode.SignNull(&r, enode.ID{ip[0], ip[1], ip[2], ip[3]})
+	}
+	if wait := tab.waitTime(topic, now); wait != 0 {
+		t.Fatalf("wrong wait time for empty topic: %v", wait)
+	}
+	// Only a few ads per /24 subnet are accepted.
+	for i := 0; i < topicIPLimit; i++ {
+		if err := tab.add(topic, nodeAt(net.IP{8, 8, 8, byte(i)}), now); err != nil {
+			t.Fatalf("ad %d rejected: %v", i, err)
+		}
+	}
+	if err := tab.add(topic, nodeAt(net.IP{8, 8, 8, 100}), now); err != errTopicFull {
+		t.Fatalf("ad beyond subnet limit accepted: %v", err)
+	}
+	// Renewing an ad does not count against the limit.
+	if err := tab.add(topic, nodeAt(net.IP{8, 8, 8, 0}), now); err != nil {
+		t.Fatalf("renewal rejected: %v", err)
+	}
+	if wait := tab.waitTime(topic, now); wait != topicIPLimit*topicWaitStep {
+		t.Fatalf("wrong wait time: have %v, want %v", wait, topicIPLimit*topicWaitStep)
+	}
+	// Fill the topic queue.
+	now = now.Add(time.Minute)
+	for i := topicIPLimit; i < topicQueueLimit; i++ {
+		if err := tab.add(topic, nodeAt(net.IP{10, 0, byte(i), 1}), now); err != nil {
+			t.Fatalf("ad %d rejected: %v", i, err)
+		}
+	}
+	if err := tab.add(topic, nodeAt(net.IP{10, 1, 0, 1}), now); err != errTopicFull {
+		t.Fatalf("ad beyond queue limit accepted: %v", err)
+	}
+	if wait := tab.waitTime(topic, now); wait != topicAdLifetime-time.Minute {
+		t.Fatalf("wrong wait time for full queue: have %v, want %v", wait, topicAdLifetime-time.Minute)
+	}
+	nodes := tab.nodes(topic, now, 3)
+	if len(nodes) != 3 || nodes[0].IP().String() != "10.0.49.1" {
+		t.Fatalf("wrong nodes returned: %v", nodes)
+	}
+	// The first ads expire after their lifetime.
+	now = now.Add(topicAdLifetime - time.Minute)
+	if n := len(tab.nodes(topic, now, topicQueueLimit)); n != topicQueueLimit-topicIPLimit {
+		t.Fatalf("wrong number of ads after expiry: have %d, want %d", n, topicQueueLimit-topicIPLimit)
+	}
+	now = now.Add(time.Minute)
+	if n := len(tab.nodes(topic, now, topicQueueLimit)); n != 0 || tab.total != 0 {
+		t.Fatalf("ads left after expiry: %d", n)
+	}
+}
+
+// This test checks that REQUESTTICKET, REGTOPIC and TOPICQUERY are handled correctly.
+func TestUDPv5_topicHandling(t *testing.T) {
+	t.Parallel()
+	test := newUDPV5Test(t)
+	defer test.close()
+
+	topic := NewTopic("foo")
+	requestTicket := func(reqid byte) (ticket []byte, wait uint64) {
+		test.packetIn(&v5wire.RequestTicket{ReqID: []byte{reqid}, Topic: topic[:]})
+		test.waitPacketOut(func(p *v5wire.Ticket, addr *net.UDPAddr, _ v5wire.Nonce) {
+			ticket, wait = p.Ticket, p.WaitTime
+		})
+		return ticket, wait
+	}
+	regtopic := func(reqid byte, ticket []byte, want bool) {
+		t.Helper()
+		record := test.getNode(test.remotekey, test.remoteaddr).Node().Record()
+		test.packetIn(&v5wire.Regtopic{ReqID: []byte{reqid}, Ticket: ticket, ENR: record})
+		test.waitPacketOut(func(p *v5wire.Regconfirmation, addr *net.UDPAddr, _ v5wire.Nonce) {
+			if p.Registered != want {
+				t.Errorf("wrong registration result for request %d: have %t, want %t", reqid, p.Registered, want)
+			}
+		})
+	}
+
+	// Tampered tickets are rejected.
+	ticket, wait := requestTicket(0)
+	if wait != 0 {
+		t.Fatalf("wrong wait time for empty topic: %d", wait)
+	}
+	tampered := append([]byte{}, ticket...)
+	tampered[0]++
+	regtopic(1, tampered, false)
+
+	// Tickets are bound to the requesting node.
+	otherkey, otheraddr := newkey(), &net.UDPAddr{IP: net.IP{10, 0, 1, 100}, Port: 30303}
+	record := test.getNode(otherkey, otheraddr).Node().Record()
+	test.packetInFrom(otherkey, otheraddr, &v5wire.Regtopic{ReqID: []byte{2}, Ticket: ticket, ENR: record})
+	test.waitPacketOut(func(p *v5wire.Regconfirmation, addr *net.UDPAddr, _ v5wire.Nonce) {
+		if p.Registered {
+			t.Error("ticket of other node accepted")
+		}
+	})
+
+	// A valid ticket registers the node, which is then returned by TOPICQUERY.
+	regtopic(3, ticket, true)
+	test.packetIn(&v5wire.TopicQuery{ReqID: []byte{4}, Topic: topic[:]})
+	test.expectNodes([]byte{4}, 1, []*enode.Node{test.getNode(test.remotekey, test.remoteaddr).Node()})
+
+	// Registering again requires waiting for the ticket.
+	ticket, wait = requestTicket(5)
+	if wait != uint64(topicWaitStep/time.Second) {
+		t.Fatalf("wrong wait time: have %d, want %d", wait, topicWaitStep/time.Second)
+	}
+	regtopic(6, ticket, false)
+
+	// Other topics are empty.
+	other := NewTopic("bar")
+	test.packetIn(&v5wire.TopicQuery{ReqID: []byte{7}, Topic: other[:]})
+	test.expectNodes([]byte{7}, 1, nil)
+}
+
+// Real sockets, real crypto: this test checks that nodes can find each other by topic.
+func TestUDPv5_topicE2E(t *testing.T) {
+	t.Parallel()
+
+	const N = 5
+	var nodes []*UDPv5
+	for i := 0; i < N; i++ {
+		var cfg Config
+		if len(nodes) > 0 {
+			bn := nodes[0].Self()
+			cfg.Bootnodes = []*enode.Node{bn}
+		}
+		node := startLocalhostV5(t, cfg)
+		nodes = append(nodes, node)
+		defer node.Close()
+	}
+	topic := NewTopic("foo")
+	nodes[1].RegisterTopic(topic)
+	defer nodes[1].StopRegisterTopic(topic)
+
+	it := nodes[N-1].TopicSearch(topic)
+	defer it.Close()
+
+	found := make(chan *enode.Node, 1)
+	go func() {
+		if it.Next() {
+			found <- it.Node()
+		}
+	}()
+	select {
+	case n := <-found:
+		if n.ID() != nodes[1].Self().ID() {
+			t.Fatalf("wrong node found: %v", n)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("advertised node not found")
+	}
+}
@@ -194,6 +194,11 @@ func TestUDPv5_findnodeHandling(t *testing.T) {
 	nodes = append(nodes, nodes249...)
 	nodes = append(nodes, nodes248[:10]...)
 	test.expectNodes([]byte{5}, 5, nodes)
+
+	// Banned nodes are excluded from the results.
+	test.table.db.UpdateBannedUntil(nodes253[0].ID(), time.Now().Add(time.Hour))
+	test.packetIn(&v5wire.Findnode{ReqID: []byte{6}, Distances: []uint{253}})
+	test.expectNodes([]byte{6}, 3, nodes253[1:])
 }
 
 func (test *udpV5Test) expectNodes(wantReqID []byte, wantTotal uint8, wantNodes []*enode.Node) {
@@ -53,6 +53,7 @@ type Config struct {
 	RateLimit       float64            // maximum DNS requests / second (default 3)
 	ValidSchemes    enr.IdentityScheme // acceptable ENR identity schemes (default enode.ValidSchemes)
 	Resolver        Resolver           // the DNS resolver to use (defaults to system DNS)
+	ResolverAddr    string             // address of the DNS server to query if Resolver is not set
 	Logger          log.Logger         // destination of client log messages (defaults to root logger)
 }
 
@@ -61,6 +62,22 @@ type Resolver interface {
 	LookupTXT(ctx context.Context, domain string) ([]string, error)
 }
 
+// NewServerResolver creates a resolver which sends all queries to the given DNS server
+// instead of the system-configured ones. This is useful for trees served by a private
+// authoritative server. The port defaults to 53 if addr does not contain one.
+func NewServerResolver(addr string) Resolver {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
 func (cfg Config) withDefaults() Config {
 	const (
 		defaultTimeout   = 5 * time.Second
@@ -83,6 +100,9 @@ func (cfg Config) withDefaults() Config {
 	if cfg.ValidSchemes == nil {
 		cfg.ValidSchemes = enode.ValidSchemes
 	}
+	if cfg.Resolver == nil && cfg.ResolverAddr != "" {
+		cfg.Resolver = NewServerResolver(cfg.ResolverAddr)
+	}
 	if cfg.Resolver == nil {
 		cfg.Resolver = new(net.Resolver)
 	}
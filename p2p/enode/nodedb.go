@@ -21,6 +21,7 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"sync"
@@ -37,11 +38,13 @@ import (
 
 // Keys in the node database.
 const (
-	dbVersionKey   = "version" // Version of the database to flush if changes
-	dbNodePrefix   = "n:"      // Identifier to prefix node entries with
-	dbLocalPrefix  = "local:"
-	dbDiscoverRoot = "v4"
-	dbDiscv5Root   = "v5"
+	dbVersionKey    = "version" // Version of the database to flush if changes
+	dbNodePrefix    = "n:"      // Identifier to prefix node entries with
+	dbLocalPrefix   = "local:"
+	dbBanPrefix     = "ban:"     // Identifier to prefix subnet bans with, followed by the CIDR
+	dbNodeBanPrefix = "nodeban:" // Identifier to prefix node bans with, followed by the ID
+	dbDiscoverRoot  = "v4"
+	dbDiscv5Root    = "v5"
 
 	// These fields are stored per ID and IP, the full key is "n:<ID>:v4:<IP>:findfail".
 	// Use nodeItemKey to create those keys.
@@ -50,6 +53,10 @@ const (
 	dbNodePong      = "lastpong"
 	dbNodeSeq       = "seq"
 
+	// These fields are stored per ID only, using the zero IP in nodeItemKey.
+	dbNodeScore     = "score"
+	dbNodeScoreTime = "scoretime"
+
 	// Local information is keyed by ID only, the full key is "local:<ID>:seq".
 	// Use localItemKey to create those keys.
 	dbLocalSeq = "seq"
@@ -73,6 +80,24 @@ type DB struct {
 	lvl    *leveldb.DB   // Interface to the database itself
 	runner sync.Once     // Ensures we can start at most one expirer
 	quit   chan struct{} // Channel to signal the expiring thread to stop
+
+	subnets     map[string]subnetBan // Cache of the subnet bans, keyed by CIDR
+	subnetsOnce sync.Once            // Ensures the subnet bans are loaded once
+	subnetsLock sync.RWMutex         // Lock protecting the subnet ban cache
+}
+
+// subnetBan is a banned IP network along with its expiration time.
+type subnetBan struct {
+	subnet  *net.IPNet
+	expires time.Time
+}
+
+// Ban is an entry of the ban list, either banning a single node or all nodes in
+// an IP network.
+type Ban struct {
+	ID      *ID        // Banned node, nil for subnet bans
+	Subnet  *net.IPNet // Banned IP network, nil for node bans
+	Expires time.Time  // Time when the ban is lifted
 }
 
 // OpenDB opens a node database for storing and retrieving infos about known peers in the
@@ -315,6 +340,7 @@ func (db *DB) expirer() {
 		select {
 		case <-tick.C:
 			db.expireNodes()
+			db.expireBans()
 		case <-db.quit:
 			return
 		}
@@ -427,6 +453,164 @@ func (db *DB) UpdateFindFailsV5(id ID, ip net.IP, fails int) error {
 	return db.storeInt64(v5Key(id, ip, dbNodeFindFails), int64(fails))
 }
 
+// Score retrieves the reputation score of a node, along with the time it was
+// last updated.
+func (db *DB) Score(id ID) (float64, time.Time) {
+	score := math.Float64frombits(db.fetchUint64(nodeItemKey(id, zeroIP, dbNodeScore)))
+	return score, time.Unix(db.fetchInt64(nodeItemKey(id, zeroIP, dbNodeScoreTime)), 0)
+}
+
+// UpdateScore updates the reputation score of a node.
+func (db *DB) UpdateScore(id ID, score float64, instance time.Time) error {
+	if err := db.storeUint64(nodeItemKey(id, zeroIP, dbNodeScore), math.Float64bits(score)); err != nil {
+		return err
+	}
+	return db.storeInt64(nodeItemKey(id, zeroIP, dbNodeScoreTime), instance.Unix())
+}
+
+// nodeBanKey returns the database key of a node ban. Bans are kept apart from the
+// node entries, so they outlive the expiration of unseen nodes.
+func nodeBanKey(id ID) []byte {
+	return append([]byte(dbNodeBanPrefix), id[:]...)
+}
+
+// BannedUntil retrieves the time until which a node is banned.
+func (db *DB) BannedUntil(id ID) time.Time {
+	return time.Unix(db.fetchInt64(nodeBanKey(id)), 0)
+}
+
+// UpdateBannedUntil updates the time until which a node is banned.
+func (db *DB) UpdateBannedUntil(id ID, instance time.Time) error {
+	return db.storeInt64(nodeBanKey(id), instance.Unix())
+}
+
+// UnbanNode lifts the ban of a node.
+func (db *DB) UnbanNode(id ID) error {
+	return db.lvl.Delete(nodeBanKey(id), nil)
+}
+
+// expireBans deletes the node bans which have already been lifted.
+func (db *DB) expireBans() {
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(dbNodeBanPrefix)), nil)
+	defer it.Release()
+
+	now := time.Now()
+	for it.Next() {
+		if expires, _ := binary.Varint(it.Value()); time.Unix(expires, 0).Before(now) {
+			db.lvl.Delete(it.Key(), nil)
+		}
+	}
+}
+
+// loadSubnetBans populates the subnet ban cache from the database, deleting the
+// expired bans.
+func (db *DB) loadSubnetBans() {
+	db.subnets = make(map[string]subnetBan)
+
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(dbBanPrefix)), nil)
+	defer it.Release()
+
+	now := time.Now()
+	for it.Next() {
+		expires, _ := binary.Varint(it.Value())
+		_, subnet, err := net.ParseCIDR(string(it.Key()[len(dbBanPrefix):]))
+		if err != nil || time.Unix(expires, 0).Before(now) {
+			db.lvl.Delete(it.Key(), nil)
+			continue
+		}
+		db.subnets[subnet.String()] = subnetBan{subnet: subnet, expires: time.Unix(expires, 0)}
+	}
+}
+
+// BanSubnet bans all nodes in an IP network until the given time.
+func (db *DB) BanSubnet(subnet *net.IPNet, until time.Time) error {
+	db.subnetsOnce.Do(db.loadSubnetBans)
+
+	db.subnetsLock.Lock()
+	defer db.subnetsLock.Unlock()
+
+	if err := db.storeInt64([]byte(dbBanPrefix+subnet.String()), until.Unix()); err != nil {
+		return err
+	}
+	db.subnets[subnet.String()] = subnetBan{subnet: subnet, expires: time.Unix(until.Unix(), 0)}
+	return nil
+}
+
+// UnbanSubnet lifts the ban of an IP network.
+func (db *DB) UnbanSubnet(subnet *net.IPNet) error {
+	db.subnetsOnce.Do(db.loadSubnetBans)
+
+	db.subnetsLock.Lock()
+	defer db.subnetsLock.Unlock()
+
+	if err := db.lvl.Delete([]byte(dbBanPrefix+subnet.String()), nil); err != nil {
+		return err
+	}
+	delete(db.subnets, subnet.String())
+	return nil
+}
+
+// SubnetBannedUntil retrieves the time until which an IP address is banned by
+// the subnet bans.
+func (db *DB) SubnetBannedUntil(ip net.IP) time.Time {
+	db.subnetsOnce.Do(db.loadSubnetBans)
+
+	db.subnetsLock.RLock()
+	defer db.subnetsLock.RUnlock()
+
+	var until time.Time
+	for _, ban := range db.subnets {
+		if ban.subnet.Contains(ip) && ban.expires.After(until) {
+			until = ban.expires
+		}
+	}
+	return until
+}
+
+// Banned returns whether a node is currently banned, either by itself or by
+// the subnet of the given IP address.
+func (db *DB) Banned(id ID, ip net.IP) bool {
+	now := time.Now()
+	if now.Before(db.BannedUntil(id)) {
+		return true
+	}
+	return ip != nil && now.Before(db.SubnetBannedUntil(ip))
+}
+
+// Bans retrieves the currently active bans, subnet bans first.
+func (db *DB) Bans() []Ban {
+	db.subnetsOnce.Do(db.loadSubnetBans)
+
+	var (
+		now  = time.Now()
+		bans []Ban
+	)
+	db.subnetsLock.RLock()
+	for _, ban := range db.subnets {
+		if now.Before(ban.expires) {
+			bans = append(bans, Ban{Subnet: ban.subnet, Expires: ban.expires})
+		}
+	}
+	db.subnetsLock.RUnlock()
+
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(dbNodeBanPrefix)), nil)
+	defer it.Release()
+
+	for it.Next() {
+		var id ID
+		if len(it.Key()) != len(dbNodeBanPrefix)+len(id) {
+			continue
+		}
+		copy(id[:], it.Key()[len(dbNodeBanPrefix):])
+
+		expires, _ := binary.Varint(it.Value())
+		if until := time.Unix(expires, 0); now.Before(until) {
+			bans = append(bans, Ban{ID: &id, Expires: until})
+		}
+	}
+	return bans
+}
+
 // LocalSeq retrieves the local record sequence counter.
 func (db *DB) localSeq(id ID) uint64 {
 	return db.fetchUint64(localItemKey(id, dbLocalSeq))
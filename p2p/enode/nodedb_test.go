@@ -154,6 +154,26 @@ func TestDBFetchStore(t *testing.T) {
 	if stored := db.FindFails(node.ID(), node.IP()); stored != num {
 		t.Errorf("find-node fails: value mismatch: have %v, want %v", stored, num)
 	}
+	// Check fetch/store operations on a node reputation object
+	if score, stored := db.Score(node.ID()); score != 0 || stored.Unix() != 0 {
+		t.Errorf("score: non-existing object: %v/%v", score, stored)
+	}
+	if err := db.UpdateScore(node.ID(), -3.5, inst); err != nil {
+		t.Errorf("score: failed to update: %v", err)
+	}
+	if score, stored := db.Score(node.ID()); score != -3.5 || stored.Unix() != inst.Unix() {
+		t.Errorf("score: value mismatch: have %v/%v, want %v/%v", score, stored, -3.5, inst)
+	}
+	// Check fetch/store operations on a node ban object
+	if stored := db.BannedUntil(node.ID()); stored.Unix() != 0 {
+		t.Errorf("ban: non-existing object: %v", stored)
+	}
+	if err := db.UpdateBannedUntil(node.ID(), inst); err != nil {
+		t.Errorf("ban: failed to update: %v", err)
+	}
+	if stored := db.BannedUntil(node.ID()); stored.Unix() != inst.Unix() {
+		t.Errorf("ban: value mismatch: have %v, want %v", stored, inst)
+	}
 	// Check fetch/store operations on an actual node object
 	if stored := db.Node(node.ID()); stored != nil {
 		t.Errorf("node: non-existing object: %v", stored)
@@ -436,15 +456,22 @@ func TestDBExpiration(t *testing.T) {
 		if err := db.UpdateLastPongReceived(seed.node.ID(), seed.node.IP(), seed.pong); err != nil {
 			t.Fatalf("node %d: failed to update bondTime: %v", i, err)
 		}
+		if err := db.UpdateBannedUntil(seed.node.ID(), time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("node %d: failed to ban: %v", i, err)
+		}
 	}
 
 	db.expireNodes()
+	db.expireBans()
 
 	// Check that expired entries have been removed.
 	unixZeroTime := time.Unix(0, 0)
 	for i, seed := range nodeDBExpirationNodes {
 		node := db.Node(seed.node.ID())
 		pong := db.LastPongReceived(seed.node.ID(), seed.node.IP())
+		if !db.Banned(seed.node.ID(), nil) {
+			t.Errorf("node %d (%s) ban should be present after expiration", i, seed.node.ID().TerminalString())
+		}
 		if seed.exp {
 			if seed.storeNode && node != nil {
 				t.Errorf("node %d (%s) shouldn't be present after expiration", i, seed.node.ID().TerminalString())
@@ -473,3 +500,72 @@ func TestDBExpireV5(t *testing.T) {
 	db.UpdateFindFailsV5(ID{}, ip, 4)
 	db.expireNodes()
 }
+
+func TestDBBans(t *testing.T) {
+	root, err := ioutil.TempDir("", "nodedb-")
+	if err != nil {
+		t.Fatalf("failed to create temporary data folder: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	db, err := OpenDB(filepath.Join(root, "database"))
+	if err != nil {
+		t.Fatalf("failed to create persistent database: %v", err)
+	}
+	var (
+		id     = ID{0x01}
+		subnet = mustParseCIDR("10.0.0.0/8")
+		until  = time.Now().Add(time.Hour)
+	)
+	if err := db.UpdateBannedUntil(id, until); err != nil {
+		t.Fatalf("failed to ban node: %v", err)
+	}
+	if err := db.BanSubnet(subnet, until); err != nil {
+		t.Fatalf("failed to ban subnet: %v", err)
+	}
+	if err := db.BanSubnet(mustParseCIDR("192.168.0.0/16"), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("failed to ban subnet")
+	}
+	checkBans := func(db *DB, want int) {
+		t.Helper()
+		if bans := db.Bans(); len(bans) != want {
+			t.Fatalf("ban count mismatch: have %d, want %d", len(bans), want)
+		}
+	}
+	checkBans(db, 2)
+	if !db.Banned(id, nil) {
+		t.Errorf("banned node not banned")
+	}
+	if !db.Banned(ID{0x02}, net.IP{10, 1, 2, 3}) {
+		t.Errorf("node in banned subnet not banned")
+	}
+	if db.Banned(ID{0x02}, net.IP{192, 168, 0, 1}) {
+		t.Errorf("node in expired subnet ban banned")
+	}
+	// Reopen the database and check that the bans were persisted
+	db.Close()
+	if db, err = OpenDB(filepath.Join(root, "database")); err != nil {
+		t.Fatalf("failed to reopen persistent database: %v", err)
+	}
+	defer db.Close()
+
+	checkBans(db, 2)
+	if err := db.UnbanSubnet(subnet); err != nil {
+		t.Fatalf("failed to unban subnet: %v", err)
+	}
+	if err := db.UnbanNode(id); err != nil {
+		t.Fatalf("failed to unban node: %v", err)
+	}
+	checkBans(db, 0)
+	if db.Banned(id, net.IP{10, 1, 2, 3}) {
+		t.Errorf("unbanned node still banned")
+	}
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, subnet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return subnet
+}
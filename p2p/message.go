@@ -326,3 +326,22 @@ func (ev *msgEventer) Close() error {
 	}
 	return nil
 }
+
+// msgDropper wraps a MsgReadWriter and discards the sent messages which the
+// drop function selects, simulating message loss.
+type msgDropper struct {
+	MsgReadWriter
+
+	drop     func(remote enode.ID, proto string, code uint64) bool
+	peerID   enode.ID
+	Protocol string
+}
+
+// WriteMsg discards the message if it is selected for dropping, otherwise it
+// writes it to the underlying MsgReadWriter.
+func (d *msgDropper) WriteMsg(msg Msg) error {
+	if d.drop(d.peerID, d.Protocol, msg.Code) {
+		return msg.Discard()
+	}
+	return d.MsgReadWriter.WriteMsg(msg)
+}
@@ -33,6 +33,9 @@ const (
 
 	// HandleHistName is the prefix of the per-packet serving time histograms.
 	HandleHistName = "p2p/handle"
+
+	// shaperMeterName is the prefix of the per-protocol upload throttling metrics.
+	shaperMeterName = "p2p/shaper/throttled"
 )
 
 var (
@@ -41,6 +44,7 @@ var (
 	egressConnectMeter  = metrics.NewRegisteredMeter("p2p/dials", nil)
 	egressTrafficMeter  = metrics.NewRegisteredMeter(egressMeterName, nil)
 	activePeerGauge     = metrics.NewRegisteredGauge("p2p/peers", nil)
+	shaperDelayTimer    = metrics.NewRegisteredTimer("p2p/shaper/delay", nil)
 )
 
 // meteredConn is a wrapper around a net.Conn that meters both the
@@ -117,6 +117,15 @@ type Peer struct {
 	// events receives message send / receive events if set
 	events   *event.Feed
 	testPipe *MsgPipeRW // for testing
+
+	// dropMsg selects sent messages to be discarded if set
+	dropMsg func(remote enode.ID, proto string, code uint64) bool
+
+	// reputation tracks the score of the peer if set
+	reputation *reputation
+
+	// traffic accounts the protocol messages exchanged with the peer
+	traffic *trafficCounter
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -226,10 +235,27 @@ func newPeer(log log.Logger, conn *conn, protocols []Protocol) *Peer {
 		protoErr: make(chan error, len(protomap)+1), // protocols + pingLoop
 		closed:   make(chan struct{}),
 		log:      log.New("id", conn.node.ID(), "conn", conn.flags),
+		traffic:  newTrafficCounter(),
+	}
+	for _, proto := range protomap {
+		proto.traffic = p.traffic
 	}
 	return p
 }
 
+// Report records an event affecting the reputation of the peer. Peers reported to
+// misbehave too often are disconnected and banned from reconnecting for a while,
+// unless they are trusted or dialed as static nodes.
+func (p *Peer) Report(event ScoreEvent) {
+	if p.reputation == nil {
+		return
+	}
+	if p.reputation.report(p.ID(), event) && !p.rw.is(trustedConn|staticDialedConn) {
+		p.log.Debug("Banning peer due to bad reputation", "event", event)
+		p.Disconnect(DiscUselessPeer)
+	}
+}
+
 func (p *Peer) Log() log.Logger {
 	return p.log
 }
@@ -343,6 +369,7 @@ func (p *Peer) handle(msg Msg) error {
 			metrics.GetOrRegisterMeter(m, nil).Mark(int64(msg.meterSize))
 			metrics.GetOrRegisterMeter(m+"/packets", nil).Mark(1)
 		}
+		p.traffic.add(proto, msg.Code-proto.offset, msg.Size, true)
 		select {
 		case proto.in <- msg:
 			return nil
@@ -401,6 +428,9 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		if p.events != nil {
 			rw = newMsgEventer(rw, p.events, p.ID(), proto.Name, p.Info().Network.RemoteAddress, p.Info().Network.LocalAddress)
 		}
+		if p.dropMsg != nil {
+			rw = &msgDropper{MsgReadWriter: rw, drop: p.dropMsg, peerID: p.ID(), Protocol: proto.Name}
+		}
 		p.log.Trace(fmt.Sprintf("Starting protocol %s/%d", proto.Name, proto.Version))
 		go func() {
 			defer p.wg.Done()
@@ -435,6 +465,9 @@ type protoRW struct {
 	werr   chan<- error    // for write results
 	offset uint64
 	w      MsgWriter
+
+	traffic *trafficCounter // accounts the messages sent
+	shaper  *uploadShaper   // limits the upload bandwidth if set
 }
 
 func (rw *protoRW) WriteMsg(msg Msg) (err error) {
@@ -444,11 +477,22 @@ func (rw *protoRW) WriteMsg(msg Msg) (err error) {
 	msg.meterCap = rw.cap()
 	msg.meterCode = msg.Code
 
+	// Wait for upload bandwidth before taking the write slot, so that throttled
+	// messages don't hold up the other protocols of the peer.
+	if rw.shaper != nil {
+		if err := rw.shaper.wait(rw.Name, msg.Size, rw.closed); err != nil {
+			return err
+		}
+	}
+	code, size := msg.Code, msg.Size
 	msg.Code += rw.offset
 
 	select {
 	case <-rw.wstart:
 		err = rw.w.WriteMsg(msg)
+		if err == nil && rw.traffic != nil {
+			rw.traffic.add(rw, code, size, false)
+		}
 		// Report write status back to Peer.run. It will initiate
 		// shutdown if the error is non-nil and unblock the next write
 		// otherwise. The calling protocol code should exit for errors
@@ -474,11 +518,13 @@ func (rw *protoRW) ReadMsg() (Msg, error) {
 // peer. Sub-protocol independent fields are contained and initialized here, with
 // protocol specifics delegated to all connected sub-protocols.
 type PeerInfo struct {
-	ENR     string   `json:"enr,omitempty"` // Avalanria Node Record
-	Enode   string   `json:"enode"`         // Node URL
-	ID      string   `json:"id"`            // Unique node identifier
-	Name    string   `json:"name"`          // Name of the node, including client type, version, OS, custom data
-	Caps    []string `json:"caps"`          // Protocols advertised by this peer
+	ENR     string       `json:"enr,omitempty"` // Avalanria Node Record
+	Enode   string       `json:"enode"`         // Node URL
+	ID      string       `json:"id"`            // Unique node identifier
+	Name    string       `json:"name"`          // Name of the node, including client type, version, OS, custom data
+	Caps    []string     `json:"caps"`          // Protocols advertised by this peer
+	Score   float64      `json:"score"`         // Reputation score of the peer
+	Traffic *PeerTraffic `json:"traffic"`       // Protocol messages exchanged with the peer
 	Network struct {
 		LocalAddress  string `json:"localAddress"`  // Local endpoint of the TCP data connection
 		RemoteAddress string `json:"remoteAddress"` // Remote endpoint of the TCP data connection
@@ -507,6 +553,10 @@ func (p *Peer) Info() *PeerInfo {
 	if p.Node().Seq() > 0 {
 		info.ENR = p.Node().String()
 	}
+	if p.reputation != nil {
+		info.Score = p.reputation.score(p.ID())
+	}
+	info.Traffic = p.traffic.info()
 	info.Network.LocalAddress = p.LocalAddr().String()
 	info.Network.RemoteAddress = p.RemoteAddr().String()
 	info.Network.Inbound = p.rw.is(inboundConn)
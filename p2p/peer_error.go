@@ -70,6 +70,10 @@ const (
 	DiscSelf
 	DiscReadTimeout
 	DiscSubprotocolError = 0x10
+
+	// DiscNotAllowed is sent to nodes outside of the allowlist of a private
+	// network. It is not part of the devp2p specification.
+	DiscNotAllowed DiscReason = 0x11
 )
 
 var discReasonToString = [...]string{
@@ -86,6 +90,7 @@ var discReasonToString = [...]string{
 	DiscSelf:                "connected to self",
 	DiscReadTimeout:         "read timeout",
 	DiscSubprotocolError:    "subprotocol error",
+	DiscNotAllowed:          "not on allowlist",
 }
 
 func (d DiscReason) String() string {
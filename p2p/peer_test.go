@@ -168,6 +168,52 @@ func TestPeerProtoEncodeMsg(t *testing.T) {
 	}
 }
 
+// Tests that the messages exchanged with a peer are accounted per protocol and
+// message code.
+func TestPeerTraffic(t *testing.T) {
+	proto := Protocol{
+		Name:    "a",
+		Version: 1,
+		Length:  5,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			if err := ExpectMsg(rw, 2, []uint{1}); err != nil {
+				t.Error(err)
+			}
+			if err := SendItems(rw, 1, "foo"); err != nil {
+				t.Error(err)
+			}
+			return nil
+		},
+	}
+	closer, rw, peer, errc := testPeer([]Protocol{proto})
+	defer closer()
+
+	Send(rw, baseProtocolLength+2, []uint{1})
+	if err := ExpectMsg(rw, baseProtocolLength+1, []string{"foo"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err != errProtocolReturned {
+			t.Errorf("peer returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("protocol did not return")
+	}
+	want := &PeerTraffic{
+		TrafficStats: TrafficStats{IngressBytes: 2, IngressPackets: 1, EgressBytes: 5, EgressPackets: 1},
+		Protocols: map[string]map[string]TrafficStats{
+			"a/1": {
+				"0x01": {EgressBytes: 5, EgressPackets: 1},
+				"0x02": {IngressBytes: 2, IngressPackets: 1},
+			},
+		},
+	}
+	if have := peer.Info().Traffic; !reflect.DeepEqual(have, want) {
+		t.Fatalf("traffic mismatch:\nhave %+v\nwant %+v", have, want)
+	}
+}
+
 func TestPeerPing(t *testing.T) {
 	closer, rw, _, _ := testPeer(nil)
 	defer closer()
@@ -198,6 +244,36 @@ func TestPeerDisconnect(t *testing.T) {
 	}
 }
 
+func TestPeerReportBan(t *testing.T) {
+	for _, flag := range []connFlag{0, trustedConn, staticDialedConn} {
+		closer, _, p, disc := testPeer(nil)
+		defer closer()
+
+		db, _ := enode.OpenDB("")
+		defer db.Close()
+		p.reputation = newReputation(db)
+		p.rw.set(flag, true)
+
+		p.Report(ScoreInvalid)
+		p.Report(ScoreInvalid)
+		if !p.reputation.banned(p.ID(), nil) {
+			t.Fatalf("peer (%v) not banned", flag)
+		}
+		select {
+		case reason := <-disc:
+			if flag != 0 {
+				t.Errorf("exempt peer (%v) disconnected: %v", flag, reason)
+			} else if reason != DiscUselessPeer {
+				t.Errorf("run returned wrong reason: got %v, want %v", reason, DiscUselessPeer)
+			}
+		case <-time.After(200 * time.Millisecond):
+			if flag == 0 {
+				t.Error("banned peer not disconnected")
+			}
+		}
+	}
+}
+
 // This test is supposed to verify that Peer can reliably handle
 // multiple causes of disconnection occurring at the same time.
 func TestPeerDisconnectRace(t *testing.T) {
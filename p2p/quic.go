@@ -0,0 +1,577 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/rlp"
+	"github.com/golang/snappy"
+	"github.com/lucas-clemente/quic-go"
+)
+
+const (
+	// quicALPN is the application protocol negotiated in the TLS handshake
+	// of QUIC sessions.
+	quicALPN = "devp2p"
+
+	// quicAuthPrefix is prepended to the session binding signed by both ends
+	// to prove their node identity.
+	quicAuthPrefix = "devp2p quic identity"
+
+	// maxQUICStreams is the number of streams a remote end may open, one for
+	// each protocol it runs.
+	maxQUICStreams = 32
+
+	// maxQUICFrameSize is the maximum size of a message frame, matching RLPx.
+	maxQUICFrameSize = 1<<24 - 1
+
+	// quicNoError is the application error code of regular session shutdowns.
+	// The disconnect reason is sent as a message on the control stream.
+	quicNoError = 0
+)
+
+var (
+	errQUICClosed        = errors.New("QUIC listener closed")
+	errQUICReadTimeout   = errors.New("QUIC read timeout")
+	errQUICNoCertificate = errors.New("QUIC peer presented no certificate")
+	errQUICFrameTooLarge = errors.New("QUIC message frame too large")
+)
+
+// quicConfig holds the QUIC session parameters. Idle sessions time out just like
+// idle RLPx connections do.
+var quicConfig = &quic.Config{
+	MaxIdleTimeout:     frameReadTimeout,
+	MaxIncomingStreams: maxQUICStreams,
+}
+
+// newQUICConfig creates the TLS configuration of QUIC sessions. The certificate
+// is self-signed and ephemeral. TLS only provides encryption, the remote node
+// identity is established by quicTransport.doEncHandshake.
+func newQUICConfig() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates:       []tls.Certificate{{Certificate: [][]byte{cert}, PrivateKey: key}},
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		NextProtos:         []string{quicALPN},
+		MinVersion:         tls.VersionTLS13,
+	}, nil
+}
+
+// quicConn is a QUIC session along with its control stream. It implements
+// net.Conn so sessions can be handled like TCP connections until the transport
+// is created. Reads and writes go to the control stream, Close shuts down the
+// whole session.
+type quicConn struct {
+	quic.Stream
+	sess      quic.Session
+	initiator bool   // whether the session was dialed
+	local     []byte // our TLS certificate
+}
+
+func (c *quicConn) LocalAddr() net.Addr  { return c.sess.LocalAddr() }
+func (c *quicConn) RemoteAddr() net.Addr { return c.sess.RemoteAddr() }
+func (c *quicConn) Close() error         { return c.sess.CloseWithError(quicNoError, "") }
+
+// remoteCertificate returns the TLS certificate presented by the remote end.
+func (c *quicConn) remoteCertificate() ([]byte, error) {
+	certs := c.sess.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 {
+		return nil, errQUICNoCertificate
+	}
+	return certs[0].Raw, nil
+}
+
+// dialQUIC establishes a QUIC session and opens its control stream.
+func dialQUIC(ctx context.Context, addr net.Addr, config *tls.Config) (*quicConn, error) {
+	sess, err := quic.DialAddrContext(ctx, addr.String(), config, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := sess.OpenStreamSync(ctx)
+	if err != nil {
+		sess.CloseWithError(quicNoError, "")
+		return nil, err
+	}
+	return &quicConn{Stream: stream, sess: sess, initiator: true, local: config.Certificates[0].Certificate[0]}, nil
+}
+
+// quicDialer dials nodes over QUIC if their record has a "quic" entry. Nodes
+// without it, and nodes which can't be reached over QUIC, are dialed using the
+// fallback dialer.
+type quicDialer struct {
+	config   *tls.Config
+	fallback NodeDialer
+}
+
+func (d quicDialer) Dial(ctx context.Context, dest *enode.Node) (net.Conn, error) {
+	if port := dest.QUIC(); port != 0 {
+		qctx, cancel := context.WithTimeout(ctx, defaultDialTimeout)
+		fd, err := dialQUIC(qctx, &net.UDPAddr{IP: dest.IP(), Port: port}, d.config)
+		cancel()
+		if err == nil {
+			return fd, nil
+		}
+	}
+	return d.fallback.Dial(ctx, dest)
+}
+
+// quicListener accepts QUIC sessions and hands them out as connections once
+// the dialer has opened the control stream.
+type quicListener struct {
+	ln      quic.Listener
+	config  *tls.Config
+	conns   chan net.Conn
+	pending chan struct{} // limits sessions waiting for their control stream
+	closed  chan struct{}
+	wg      sync.WaitGroup
+}
+
+func listenQUIC(addr string, config *tls.Config) (*quicListener, error) {
+	ln, err := quic.ListenAddr(addr, config, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	l := &quicListener{
+		ln:      ln,
+		config:  config,
+		conns:   make(chan net.Conn),
+		pending: make(chan struct{}, defaultMaxPendingPeers),
+		closed:  make(chan struct{}),
+	}
+	l.wg.Add(1)
+	go l.loop()
+	return l, nil
+}
+
+func (l *quicListener) loop() {
+	defer l.wg.Done()
+	defer close(l.closed)
+
+	for {
+		sess, err := l.ln.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		select {
+		case l.pending <- struct{}{}:
+		default:
+			sess.CloseWithError(quicNoError, "")
+			continue
+		}
+		l.wg.Add(1)
+		go l.accept(sess)
+	}
+}
+
+// accept waits for the control stream of an incoming session.
+func (l *quicListener) accept(sess quic.Session) {
+	defer l.wg.Done()
+	defer func() { <-l.pending }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	stream, err := sess.AcceptStream(ctx)
+	cancel()
+	if err != nil {
+		sess.CloseWithError(quicNoError, "")
+		return
+	}
+	fd := &quicConn{Stream: stream, sess: sess, local: l.config.Certificates[0].Certificate[0]}
+	select {
+	case l.conns <- fd:
+	case <-l.closed:
+		fd.Close()
+	}
+}
+
+// Accept implements net.Listener.
+func (l *quicListener) Accept() (net.Conn, error) {
+	select {
+	case fd := <-l.conns:
+		return fd, nil
+	case <-l.closed:
+		return nil, errQUICClosed
+	}
+}
+
+// Close implements net.Listener. It also terminates all sessions accepted by
+// the listener.
+func (l *quicListener) Close() error {
+	err := l.ln.Close()
+	l.wg.Wait()
+	return err
+}
+
+// Addr implements net.Listener.
+func (l *quicListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// quicTransport is the transport of connections running over QUIC. Base protocol
+// messages are exchanged on the control stream opened by the dialer. Every
+// subprotocol sends its messages on a stream of its own, so packet loss on one
+// protocol's stream doesn't hold up the messages of the others.
+type quicTransport struct {
+	fd       net.Conn // fd is the connection handed to the server, it may wrap conn
+	conn     *quicConn
+	dialDest *ecdsa.PublicKey
+	snappy   bool // set by the protocol handshake
+
+	smu     sync.Mutex
+	streams map[string]*quicStream // outbound streams by protocol name
+
+	streaming bool // set once the stream readers are running
+	in        chan quicFrame
+	closing   chan struct{}
+	closeOnce sync.Once
+	disc      chan struct{} // closed when the remote end sent a disconnect
+	discOnce  sync.Once
+}
+
+// quicStream is an outbound stream of a QUIC session.
+type quicStream struct {
+	mu   sync.Mutex
+	s    quic.Stream
+	wbuf bytes.Buffer
+}
+
+// quicFrame is a message read from one of the streams.
+type quicFrame struct {
+	code     uint64
+	data     []byte
+	wireSize int
+	err      error
+}
+
+func newQUIC(fd net.Conn, conn *quicConn, dialDest *ecdsa.PublicKey) transport {
+	return &quicTransport{
+		fd:       fd,
+		conn:     conn,
+		dialDest: dialDest,
+		streams:  map[string]*quicStream{"": {s: conn.Stream}},
+		in:       make(chan quicFrame),
+		closing:  make(chan struct{}),
+		disc:     make(chan struct{}),
+	}
+}
+
+// doEncHandshake proves the node identities of both ends. The session is
+// already encrypted, so each end only signs the certificates of the TLS
+// handshake with its node key. This binds the identity to the session: a
+// relaying party would have to present its own certificates.
+func (t *quicTransport) doEncHandshake(prv *ecdsa.PrivateKey) (*ecdsa.PublicKey, error) {
+	t.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	remote, err := t.conn.remoteCertificate()
+	if err != nil {
+		return nil, err
+	}
+	dialer, listener := t.conn.local, remote
+	if !t.conn.initiator {
+		dialer, listener = remote, t.conn.local
+	}
+	sig, err := crypto.Sign(quicAuthHash(t.conn.initiator, dialer, listener), prv)
+	if err != nil {
+		return nil, err
+	}
+	werr := make(chan error, 1)
+	go func() {
+		_, err := t.conn.Write(sig)
+		werr <- err
+	}()
+	theirs := make([]byte, crypto.SignatureLength)
+	if _, err := io.ReadFull(t.conn, theirs); err != nil {
+		<-werr // make sure the write terminates too
+		return nil, err
+	}
+	if err := <-werr; err != nil {
+		return nil, fmt.Errorf("write error: %v", err)
+	}
+	pubkey, err := crypto.SigToPub(quicAuthHash(!t.conn.initiator, dialer, listener), theirs)
+	if err != nil {
+		return nil, DiscInvalidIdentity
+	}
+	if t.dialDest != nil && !bytes.Equal(crypto.FromECDSAPub(pubkey), crypto.FromECDSAPub(t.dialDest)) {
+		return nil, DiscUnexpectedIdentity
+	}
+	return pubkey, nil
+}
+
+// quicAuthHash returns the hash signed by one end of a QUIC session to prove its
+// node identity.
+func quicAuthHash(initiator bool, dialer, listener []byte) []byte {
+	role := []byte{0}
+	if initiator {
+		role[0] = 1
+	}
+	return crypto.Keccak256([]byte(quicAuthPrefix), role, crypto.Keccak256(dialer), crypto.Keccak256(listener))
+}
+
+func (t *quicTransport) doProtoHandshake(our *protoHandshake) (their *protoHandshake, err error) {
+	// Writing our handshake happens concurrently, we prefer
+	// returning the handshake read error. If the remote side
+	// disconnects us early with a valid reason, we should return it
+	// as the error so it can be tracked elsewhere.
+	werr := make(chan error, 1)
+	go func() { werr <- Send(t, handshakeMsg, our) }()
+	if their, err = readProtocolHandshake(t); err != nil {
+		<-werr // make sure the write terminates too
+		return nil, err
+	}
+	if err := <-werr; err != nil {
+		return nil, fmt.Errorf("write error: %v", err)
+	}
+	t.snappy = their.Version >= snappyProtocolVersion
+
+	// From here on, messages may arrive on any stream.
+	t.conn.SetReadDeadline(time.Time{})
+	t.streaming = true
+	go t.readStream(t.conn.Stream, true)
+	go t.acceptStreams()
+
+	return their, nil
+}
+
+// acceptStreams starts a reader for every stream opened by the remote end.
+func (t *quicTransport) acceptStreams() {
+	for {
+		s, err := t.conn.sess.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go t.readStream(s, false)
+	}
+}
+
+// readStream reads the messages of a stream and passes them to ReadMsg. Errors
+// of protocol streams are only reported if the stream wasn't closed properly,
+// errors of the control stream always end the connection.
+func (t *quicTransport) readStream(s quic.Stream, control bool) {
+	for {
+		code, data, wireSize, err := readQUICFrame(s, t.snappy)
+		if err == io.EOF && !control {
+			return
+		}
+		if err == nil && control && code == discMsg {
+			t.discOnce.Do(func() { close(t.disc) })
+		}
+		select {
+		case t.in <- quicFrame{code, data, wireSize, err}:
+		case <-t.closing:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *quicTransport) ReadMsg() (Msg, error) {
+	var f quicFrame
+	if !t.streaming {
+		// Before the protocol handshake, only the control stream is used.
+		t.conn.SetReadDeadline(time.Now().Add(frameReadTimeout))
+		f.code, f.data, f.wireSize, f.err = readQUICFrame(t.conn, t.snappy)
+		if f.err == nil && f.code == discMsg {
+			t.discOnce.Do(func() { close(t.disc) })
+		}
+	} else {
+		timeout := time.NewTimer(frameReadTimeout)
+		defer timeout.Stop()
+
+		select {
+		case f = <-t.in:
+		case <-timeout.C:
+			return Msg{}, errQUICReadTimeout
+		case <-t.closing:
+			return Msg{}, io.EOF
+		}
+	}
+	if f.err != nil {
+		return Msg{}, f.err
+	}
+	return Msg{
+		ReceivedAt: time.Now(),
+		Code:       f.code,
+		Size:       uint32(len(f.data)),
+		meterSize:  uint32(f.wireSize),
+		Payload:    bytes.NewReader(f.data),
+	}, nil
+}
+
+func (t *quicTransport) WriteMsg(msg Msg) error {
+	s, err := t.stream(msg.meterCap.Name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Copy message data to write buffer.
+	s.wbuf.Reset()
+	if _, err := io.CopyN(&s.wbuf, msg.Payload, int64(msg.Size)); err != nil {
+		return err
+	}
+
+	// Write the message.
+	s.s.SetWriteDeadline(time.Now().Add(frameWriteTimeout))
+	size, err := writeQUICFrame(s.s, msg.Code, s.wbuf.Bytes(), t.snappy)
+	if err != nil {
+		return err
+	}
+	msg.meterSize = size
+	meterEgress(msg)
+	return nil
+}
+
+// stream returns the outbound stream of a protocol, opening it on first use. Base
+// protocol messages go to the control stream.
+func (t *quicTransport) stream(proto string) (*quicStream, error) {
+	t.smu.Lock()
+	defer t.smu.Unlock()
+
+	if s := t.streams[proto]; s != nil {
+		return s, nil
+	}
+	s, err := t.conn.sess.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	t.streams[proto] = &quicStream{s: s}
+	return t.streams[proto], nil
+}
+
+func (t *quicTransport) close(err error) {
+	t.closeOnce.Do(func() { close(t.closing) })
+
+	// Tell the remote end why we're disconnecting if it didn't disconnect us
+	// first. Closing the session discards unsent data, so wait for the remote
+	// end to act on the message before tearing the session down.
+	if r, ok := err.(DiscReason); ok && r != DiscNetworkError && !t.discReceived() {
+		ctrl, _ := t.stream("")
+		ctrl.mu.Lock()
+		ctrl.wbuf.Reset()
+		rlp.Encode(&ctrl.wbuf, []DiscReason{r})
+		ctrl.s.SetWriteDeadline(time.Now().Add(discWriteTimeout))
+		if _, err := writeQUICFrame(ctrl.s, discMsg, ctrl.wbuf.Bytes(), t.snappy); err == nil {
+			wait := time.NewTimer(discWriteTimeout)
+			select {
+			case <-t.conn.sess.Context().Done():
+			case <-t.disc:
+			case <-wait.C:
+			}
+			wait.Stop()
+		}
+		ctrl.mu.Unlock()
+	}
+	t.fd.Close()
+}
+
+// discReceived reports whether the remote end sent a disconnect message.
+func (t *quicTransport) discReceived() bool {
+	select {
+	case <-t.disc:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeQUICFrame writes a message frame: the three byte size of the frame
+// content, the RLP encoded message code and the (compressed) message data.
+func writeQUICFrame(w io.Writer, code uint64, data []byte, compress bool) (uint32, error) {
+	if len(data) > maxQUICFrameSize {
+		return 0, errQUICFrameTooLarge
+	}
+	if compress {
+		data = snappy.Encode(nil, data)
+	}
+	frame := make([]byte, 3, 3+9+len(data))
+	frame = rlp.AppendUint64(frame, code)
+	frame = append(frame, data...)
+	size := len(frame) - 3
+	if size > maxQUICFrameSize {
+		return 0, errQUICFrameTooLarge
+	}
+	frame[0], frame[1], frame[2] = byte(size>>16), byte(size>>8), byte(size)
+	if _, err := w.Write(frame); err != nil {
+		return 0, err
+	}
+	return uint32(len(data)), nil
+}
+
+// readQUICFrame reads a message frame written by writeQUICFrame.
+func readQUICFrame(r io.Reader, compressed bool) (code uint64, data []byte, wireSize int, err error) {
+	var header [3]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, 0, err
+	}
+	frame := make([]byte, int(header[0])<<16|int(header[1])<<8|int(header[2]))
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return 0, nil, 0, err
+	}
+	code, data, err = rlp.SplitUint64(frame)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("invalid message code: %v", err)
+	}
+	wireSize = len(data)
+	if compressed {
+		size, err := snappy.DecodedLen(data)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		if size > maxQUICFrameSize {
+			return 0, nil, 0, errQUICFrameTooLarge
+		}
+		if data, err = snappy.Decode(nil, data); err != nil {
+			return 0, nil, 0, err
+		}
+	}
+	return code, data, wireSize, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+)
+
+// ScoreEvent is an event affecting the reputation of a peer, reported by the
+// protocols running on it.
+type ScoreEvent int
+
+const (
+	ScoreUseful  ScoreEvent = iota // Peer delivered useful data
+	ScoreTimeout                   // Peer failed to deliver requested data in time
+	ScoreUseless                   // Peer has nothing to offer, e.g. it is on another chain
+	ScoreInvalid                   // Peer delivered invalid data or violated a protocol
+)
+
+var scoreEventNames = [...]string{
+	ScoreUseful:  "useful",
+	ScoreTimeout: "timeout",
+	ScoreUseless: "useless",
+	ScoreInvalid: "invalid",
+}
+
+func (e ScoreEvent) String() string {
+	if e < 0 || int(e) >= len(scoreEventNames) {
+		return fmt.Sprintf("unknown score event %d", int(e))
+	}
+	return scoreEventNames[e]
+}
+
+// scoreWeights are the score changes caused by the individual events.
+var scoreWeights = [...]float64{
+	ScoreUseful:  1,
+	ScoreTimeout: -5,
+	ScoreUseless: -10,
+	ScoreInvalid: -40,
+}
+
+const (
+	maxScore = 100 // Highest reputation score a node can accumulate
+	minScore = -100
+
+	// banScore is the score at or below which a node gets banned. Two invalid
+	// deliveries in quick succession suffice to reach it.
+	banScore = -75
+
+	// banTime is the time a node remains banned after reaching the ban score.
+	banTime = time.Hour
+
+	// scoreHalfLife is the time after which a score decays to half its value,
+	// letting both good and bad reputations fade away.
+	scoreHalfLife = 6 * time.Hour
+)
+
+// reputation tracks the reputation scores of remote nodes, persisted in the node
+// database. Nodes reaching the ban score are banned for a while.
+type reputation struct {
+	db   *enode.DB
+	now  func() time.Time
+	lock sync.Mutex // Lock serialising the score updates
+}
+
+func newReputation(db *enode.DB) *reputation {
+	return &reputation{db: db, now: time.Now}
+}
+
+// score retrieves the current score of a node.
+func (r *reputation) score(id enode.ID) float64 {
+	score, updated := r.db.Score(id)
+	return decayScore(score, r.now().Sub(updated))
+}
+
+// decayScore returns the value a score decays to after the given time.
+func decayScore(score float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return score
+	}
+	return score * math.Exp2(-float64(elapsed)/float64(scoreHalfLife))
+}
+
+// banned returns whether a node is currently banned, either by itself or by the
+// subnet of the given IP address, which may be nil.
+func (r *reputation) banned(id enode.ID, ip net.IP) bool {
+	if r.now().Before(r.db.BannedUntil(id)) {
+		return true
+	}
+	return ip != nil && r.subnetBanned(ip)
+}
+
+// subnetBanned returns whether an IP address is in a currently banned subnet.
+func (r *reputation) subnetBanned(ip net.IP) bool {
+	return r.now().Before(r.db.SubnetBannedUntil(ip))
+}
+
+// forgive clears the bad reputation of a node.
+func (r *reputation) forgive(id enode.ID) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.score(id) >= 0 {
+		return nil
+	}
+	return r.db.UpdateScore(id, 0, r.now())
+}
+
+// report applies an event to the score of a node, banning the node if the score
+// drops to the ban score. It returns whether the node got banned.
+func (r *reputation) report(id enode.ID, event ScoreEvent) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.now()
+	score := r.score(id) + scoreWeights[event]
+	if score > maxScore {
+		score = maxScore
+	}
+	if score < minScore {
+		score = minScore
+	}
+	if err := r.db.UpdateScore(id, score, now); err != nil {
+		log.Warn("Failed to store node score", "id", id, "err", err)
+	}
+	if score > banScore || r.banned(id, nil) {
+		return false
+	}
+	if err := r.db.UpdateBannedUntil(id, now.Add(banTime)); err != nil {
+		log.Warn("Failed to store node ban", "id", id, "err", err)
+	}
+	return true
+}
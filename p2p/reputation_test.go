@@ -0,0 +1,92 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/p2p/enode"
+)
+
+// Tests that reputation scores accumulate, decay over time and are capped.
+func TestReputationScore(t *testing.T) {
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+
+	now := time.Unix(1600000000, 0)
+	rep := newReputation(db)
+	rep.now = func() time.Time { return now }
+
+	id := randomID()
+	for i := 0; i < 10; i++ {
+		rep.report(id, ScoreUseful)
+	}
+	rep.report(id, ScoreTimeout)
+	if score := rep.score(id); score != 5 {
+		t.Fatalf("score mismatch: have %v, want %v", score, 5)
+	}
+	now = now.Add(scoreHalfLife)
+	if score := rep.score(id); score != 2.5 {
+		t.Fatalf("decayed score mismatch: have %v, want %v", score, 2.5)
+	}
+	for i := 0; i < 2*maxScore; i++ {
+		rep.report(id, ScoreUseful)
+	}
+	if score := rep.score(id); score != maxScore {
+		t.Fatalf("capped score mismatch: have %v, want %v", score, maxScore)
+	}
+	// Scores survive a reload from the node database
+	reloaded := newReputation(db)
+	reloaded.now = rep.now
+	if score := reloaded.score(id); score != maxScore {
+		t.Fatalf("reloaded score mismatch: have %v, want %v", score, maxScore)
+	}
+}
+
+// Tests that nodes reaching the ban score are banned for a while.
+func TestReputationBan(t *testing.T) {
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+
+	now := time.Unix(1600000000, 0)
+	rep := newReputation(db)
+	rep.now = func() time.Time { return now }
+
+	id := randomID()
+	if rep.report(id, ScoreInvalid) {
+		t.Fatalf("node banned after a single invalid delivery")
+	}
+	if !rep.report(id, ScoreInvalid) {
+		t.Fatalf("node not banned after repeated invalid deliveries")
+	}
+	if !rep.banned(id, nil) {
+		t.Fatalf("ban not recorded")
+	}
+	// Further events don't renew the ban
+	if rep.report(id, ScoreInvalid) {
+		t.Fatalf("ban renewed while banned")
+	}
+	now = now.Add(banTime)
+	if rep.banned(id, nil) {
+		t.Fatalf("ban not expired")
+	}
+	// The score is still bad, so a single timeout bans again
+	if !rep.report(id, ScoreTimeout) {
+		t.Fatalf("node not banned again after the ban expired")
+	}
+}
@@ -20,6 +20,7 @@ package p2p
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -85,6 +86,24 @@ type Config struct {
 	// Setting DialRatio to zero defaults it to 3.
 	DialRatio int `toml:",omitempty"`
 
+	// MaxUploadRate is the maximum number of protocol message bytes per second
+	// sent to all peers together. Zero means unlimited.
+	MaxUploadRate uint64 `toml:",omitempty"`
+
+	// UploadWeights sets the share of the upload bandwidth each protocol gets
+	// when the upload rate is limited, keyed by protocol name. Protocols without
+	// a weight default to 1.
+	UploadWeights map[string]uint `toml:",omitempty"`
+
+	// AllowlistFile is the path of a JSON file listing the nodes permitted to
+	// connect. If set, connections to and from all other nodes are refused. The
+	// file is re-read when it changes.
+	AllowlistFile string `toml:",omitempty"`
+
+	// AllowlistKey is the admin key the allowlist must be signed with. If nil,
+	// unsigned allowlists are accepted.
+	AllowlistKey *ecdsa.PublicKey `toml:"-"`
+
 	// NoDiscovery can be used to disable the peer discovery mechanism.
 	// Disabling is useful for protocol debugging (manual topology).
 	NoDiscovery bool
@@ -136,6 +155,13 @@ type Config struct {
 	// the server is started.
 	ListenAddr string
 
+	// If QUICListenAddr is set to a non-nil address, the server also accepts
+	// connections over QUIC on this UDP address and advertises its port in
+	// the "quic" entry of the node record. Nodes advertising QUIC are dialed
+	// over it, with TCP as the fallback. The address must not be the one used
+	// for discovery.
+	QUICListenAddr string `toml:",omitempty"`
+
 	// If set to a non-nil value, the given NAT port mapper
 	// is used to make the listening port available to the
 	// Internet.
@@ -152,6 +178,11 @@ type Config struct {
 	// whenever a message is sent to or received from a peer
 	EnableMsgEvents bool
 
+	// If DropMsg is set, it is called for every message sent by a protocol.
+	// Messages for which it returns true are discarded instead of being sent.
+	// This is used to simulate message loss in tests and simulations.
+	DropMsg func(remote enode.ID, proto string, code uint64) bool `toml:"-"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
@@ -173,17 +204,27 @@ type Server struct {
 	running bool
 
 	listener     net.Listener
+	quicListener *quicListener
+	quicTLS      *tls.Config
 	ourHandshake *protoHandshake
 	loopWG       sync.WaitGroup // loop, listenLoop
 	peerFeed     event.Feed
 	log          log.Logger
 
-	nodedb    *enode.DB
-	localnode *enode.LocalNode
-	ntab      *discover.UDPv4
-	DiscV5    *discover.UDPv5
-	discmix   *enode.FairMix
-	dialsched *dialScheduler
+	nodedb     *enode.DB
+	reputation *reputation
+	shaper     *uploadShaper
+	localnode  *enode.LocalNode
+	ntab       *discover.UDPv4
+	DiscV5     *discover.UDPv5
+	discmix    *enode.FairMix
+	dialsched  *dialScheduler
+
+	allowWrite   sync.Mutex   // serialises allowlist updates
+	allowLock    sync.RWMutex // protects the allowlist fields below
+	allowlist    *Allowlist
+	allowed      map[enode.ID]struct{}
+	allowModTime time.Time
 
 	// Channels into the run loop.
 	quit                    chan struct{}
@@ -195,7 +236,8 @@ type Server struct {
 	checkpointPostHandshake chan *conn
 	checkpointAddPeer       chan *conn
 
-	// State of run loop and listenLoop.
+	// State of the listen loops.
+	inboundLock    sync.Mutex
 	inboundHistory expHeap
 }
 
@@ -370,6 +412,78 @@ func (srv *Server) RemoveTrustedPeer(node *enode.Node) {
 	}
 }
 
+// BanNode bans a node from connecting until the given time, disconnecting it if
+// it is currently connected. Trusted and static nodes are exempt from bans.
+func (srv *Server) BanNode(id enode.ID, until time.Time) error {
+	db, err := srv.banList()
+	if err != nil {
+		return err
+	}
+	if err := db.UpdateBannedUntil(id, until); err != nil {
+		return err
+	}
+	srv.disconnectBanned(func(p *Peer) bool { return p.ID() == id })
+	return nil
+}
+
+// BanSubnet bans all nodes in an IP network from connecting until the given time,
+// disconnecting the ones currently connected. Trusted and static nodes are exempt
+// from bans.
+func (srv *Server) BanSubnet(subnet *net.IPNet, until time.Time) error {
+	db, err := srv.banList()
+	if err != nil {
+		return err
+	}
+	if err := db.BanSubnet(subnet, until); err != nil {
+		return err
+	}
+	srv.disconnectBanned(func(p *Peer) bool { return subnet.Contains(p.Node().IP()) })
+	return nil
+}
+
+// UnbanNode lifts the ban of a node, clearing its bad reputation too.
+func (srv *Server) UnbanNode(id enode.ID) error {
+	db, err := srv.banList()
+	if err != nil {
+		return err
+	}
+	if err := db.UnbanNode(id); err != nil {
+		return err
+	}
+	return srv.reputation.forgive(id)
+}
+
+// UnbanSubnet lifts the ban of an IP network.
+func (srv *Server) UnbanSubnet(subnet *net.IPNet) error {
+	db, err := srv.banList()
+	if err != nil {
+		return err
+	}
+	return db.UnbanSubnet(subnet)
+}
+
+// banList returns the node database storing the bans, if the server is running.
+func (srv *Server) banList() (*enode.DB, error) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if !srv.running {
+		return nil, errServerStopped
+	}
+	return srv.nodedb, nil
+}
+
+// disconnectBanned disconnects the peers matching a new ban, unless exempt.
+func (srv *Server) disconnectBanned(match func(*Peer) bool) {
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		for _, p := range peers {
+			if match(p) && !p.rw.is(trustedConn|staticDialedConn) {
+				p.Disconnect(DiscUselessPeer)
+			}
+		}
+	})
+}
+
 // SubscribeEvents subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -400,6 +514,9 @@ func (srv *Server) Stop() {
 		// this unblocks listener Accept
 		srv.listener.Close()
 	}
+	if srv.quicListener != nil {
+		srv.quicListener.Close()
+	}
 	close(srv.quit)
 	srv.lock.Unlock()
 	srv.loopWG.Wait()
@@ -456,7 +573,10 @@ func (srv *Server) Start() (err error) {
 		return errors.New("Server.PrivateKey must be set to a non-nil key")
 	}
 	if srv.newTransport == nil {
-		srv.newTransport = newRLPX
+		srv.newTransport = newTransport
+	}
+	if srv.MaxUploadRate > 0 {
+		srv.shaper = newUploadShaper(srv.clock, srv.MaxUploadRate, srv.UploadWeights)
 	}
 	if srv.listenFunc == nil {
 		srv.listenFunc = net.Listen
@@ -470,6 +590,11 @@ func (srv *Server) Start() (err error) {
 	srv.peerOp = make(chan peerOpFunc)
 	srv.peerOpDone = make(chan struct{})
 
+	if srv.AllowlistFile != "" {
+		if _, err := srv.loadAllowlist(); err != nil {
+			return err
+		}
+	}
 	if err := srv.setupLocalNode(); err != nil {
 		return err
 	}
@@ -478,6 +603,11 @@ func (srv *Server) Start() (err error) {
 			return err
 		}
 	}
+	if srv.QUICListenAddr != "" {
+		if err := srv.setupQUIC(); err != nil {
+			return err
+		}
+	}
 	if err := srv.setupDiscovery(); err != nil {
 		return err
 	}
@@ -485,6 +615,10 @@ func (srv *Server) Start() (err error) {
 
 	srv.loopWG.Add(1)
 	go srv.run()
+	if srv.AllowlistFile != "" {
+		srv.loopWG.Add(1)
+		go srv.allowlistLoop()
+	}
 	return nil
 }
 
@@ -503,6 +637,7 @@ func (srv *Server) setupLocalNode() error {
 		return err
 	}
 	srv.nodedb = db
+	srv.reputation = newReputation(db)
 	srv.localnode = enode.NewLocalNode(db, srv.PrivateKey)
 	srv.localnode.SetFallbackIP(net.IP{127, 0, 0, 1})
 	// TODO: check conflicts
@@ -621,6 +756,8 @@ func (srv *Server) setupDialScheduler() {
 		maxActiveDials: srv.MaxPendingPeers,
 		log:            srv.Logger,
 		netRestrict:    srv.NetRestrict,
+		reputation:     srv.reputation,
+		allowed:        srv.isAllowed,
 		dialer:         srv.Dialer,
 		clock:          srv.clock,
 	}
@@ -630,6 +767,9 @@ func (srv *Server) setupDialScheduler() {
 	if config.dialer == nil {
 		config.dialer = tcpDialer{&net.Dialer{Timeout: defaultDialTimeout}}
 	}
+	if srv.quicTLS != nil {
+		config.dialer = quicDialer{config: srv.quicTLS, fallback: config.dialer}
+	}
 	srv.dialsched = newDialScheduler(config, srv.discmix, srv.SetupConn)
 	for _, n := range srv.StaticNodes {
 		srv.dialsched.addStatic(n)
@@ -677,7 +817,37 @@ func (srv *Server) setupListening() error {
 	}
 
 	srv.loopWG.Add(1)
-	go srv.listenLoop()
+	go srv.listenLoop(listener)
+	return nil
+}
+
+func (srv *Server) setupQUIC() error {
+	config, err := newQUICConfig()
+	if err != nil {
+		return err
+	}
+	listener, err := listenQUIC(srv.QUICListenAddr, config)
+	if err != nil {
+		return err
+	}
+	srv.quicTLS = config
+	srv.quicListener = listener
+	srv.QUICListenAddr = listener.Addr().String()
+
+	// Update the local node record and map the QUIC listening port if NAT is configured.
+	if udp, ok := listener.Addr().(*net.UDPAddr); ok {
+		srv.localnode.Set(enr.QUIC(udp.Port))
+		if !udp.IP.IsLoopback() && srv.NAT != nil {
+			srv.loopWG.Add(1)
+			go func() {
+				nat.Map(srv.NAT, srv.quit, "udp", udp.Port, udp.Port, "avalanria quic")
+				srv.loopWG.Done()
+			}()
+		}
+	}
+
+	srv.loopWG.Add(1)
+	go srv.listenLoop(listener)
 	return nil
 }
 
@@ -802,6 +972,8 @@ running:
 
 func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount int, c *conn) error {
 	switch {
+	case !srv.isAllowed(c.node.ID()):
+		return DiscNotAllowed
 	case !c.is(trustedConn) && len(peers) >= srv.MaxPeers:
 		return DiscTooManyPeers
 	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount >= srv.maxInboundConns():
@@ -810,6 +982,11 @@ func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount in
 		return DiscAlreadyConnected
 	case c.node.ID() == srv.localnode.ID():
 		return DiscSelf
+	case !c.is(trustedConn) && !c.is(staticDialedConn) && srv.reputation.banned(c.node.ID(), c.node.IP()):
+		return DiscUselessPeer
+	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount >= srv.maxInboundConns()/2 && srv.reputation.score(c.node.ID()) < 0:
+		// Half of the inbound slots are reserved for peers without a bad reputation.
+		return DiscTooManyPeers
 	default:
 		return nil
 	}
@@ -827,8 +1004,8 @@ func (srv *Server) addPeerChecks(peers map[enode.ID]*Peer, inboundCount int, c *
 
 // listenLoop runs in its own goroutine and accepts
 // inbound connections.
-func (srv *Server) listenLoop() {
-	srv.log.Debug("TCP listener up", "addr", srv.listener.Addr())
+func (srv *Server) listenLoop(listener net.Listener) {
+	srv.log.Debug("Listener up", "addr", listener.Addr())
 
 	// The slots channel limits accepts of new connections.
 	tokens := defaultMaxPendingPeers
@@ -859,7 +1036,7 @@ func (srv *Server) listenLoop() {
 			lastLog time.Time
 		)
 		for {
-			fd, err = srv.listener.Accept()
+			fd, err = listener.Accept()
 			if netutil.IsTemporaryError(err) {
 				if time.Since(lastLog) > 1*time.Second {
 					srv.log.Debug("Temporary read error", "err", err)
@@ -905,7 +1082,13 @@ func (srv *Server) checkInboundConn(remoteIP net.IP) error {
 	if srv.NetRestrict != nil && !srv.NetRestrict.Contains(remoteIP) {
 		return fmt.Errorf("not in netrestrict list")
 	}
+	// Reject connections from banned subnets.
+	if srv.reputation.subnetBanned(remoteIP) {
+		return fmt.Errorf("banned subnet")
+	}
 	// Reject Internet peers that try too often.
+	srv.inboundLock.Lock()
+	defer srv.inboundLock.Unlock()
 	now := srv.clock.Now()
 	srv.inboundHistory.expire(now, nil)
 	if !netutil.IsLAN(remoteIP) && srv.inboundHistory.contains(remoteIP.String()) {
@@ -994,9 +1177,13 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 func nodeFromConn(pubkey *ecdsa.PublicKey, conn net.Conn) *enode.Node {
 	var ip net.IP
 	var port int
-	if tcp, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
-		ip = tcp.IP
-		port = tcp.Port
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		ip = addr.IP
+		port = addr.Port
+	case *net.UDPAddr:
+		// Inbound QUIC connections don't reveal the TCP port.
+		ip = addr.IP
 	}
 	return enode.NewV4(pubkey, ip, port, port)
 }
@@ -1014,11 +1201,18 @@ func (srv *Server) checkpoint(c *conn, stage chan<- *conn) error {
 
 func (srv *Server) launchPeer(c *conn) *Peer {
 	p := newPeer(srv.log, c, srv.Protocols)
+	p.reputation = srv.reputation
+	if srv.shaper != nil {
+		for _, proto := range p.running {
+			proto.shaper = srv.shaper
+		}
+	}
 	if srv.EnableMsgEvents {
 		// If message events are enabled, pass the peerFeed
 		// to the peer.
 		p.events = &srv.peerFeed
 	}
+	p.dropMsg = srv.DropMsg
 	go srv.runPeer(p)
 	return p
 }
@@ -1119,3 +1313,35 @@ func (srv *Server) PeersInfo() []*PeerInfo {
 	}
 	return infos
 }
+
+// BanInfo represents an entry of the ban list.
+type BanInfo struct {
+	ID      string    `json:"id,omitempty"`     // Banned node identifier
+	Subnet  string    `json:"subnet,omitempty"` // Banned IP network in CIDR notation
+	Expires time.Time `json:"expires"`          // Time when the ban is lifted
+}
+
+// BansInfo returns the currently active node and subnet bans, including the nodes
+// banned due to their bad reputation, ordered by expiration.
+func (srv *Server) BansInfo() ([]*BanInfo, error) {
+	db, err := srv.banList()
+	if err != nil {
+		return nil, err
+	}
+	bans := db.Bans()
+	infos := make([]*BanInfo, 0, len(bans))
+	for _, ban := range bans {
+		info := &BanInfo{Expires: ban.Expires}
+		if ban.ID != nil {
+			info.ID = ban.ID.String()
+		}
+		if ban.Subnet != nil {
+			info.Subnet = ban.Subnet.String()
+		}
+		infos = append(infos, info)
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Expires.Before(infos[j].Expires)
+	})
+	return infos, nil
+}
@@ -300,6 +300,119 @@ func TestServerAtCap(t *testing.T) {
 	}
 }
 
+func TestServerReputation(t *testing.T) {
+	trustedNode := newkey()
+	trustedID := enode.PubkeyToIDV4(&trustedNode.PublicKey)
+	srv := &Server{
+		Config: Config{
+			PrivateKey:   newkey(),
+			MaxPeers:     10,
+			NoDial:       true,
+			NoDiscovery:  true,
+			TrustedNodes: []*enode.Node{newNode(trustedID, "")},
+			Logger:       testlog.Logger(t, log.LvlTrace),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	newconn := func(id enode.ID) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(&trustedNode.PublicKey, fd, nil)
+		node := enode.SignNull(new(enr.Record), id)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, node: node, cont: make(chan error)}
+	}
+	// Banned nodes are rejected, unless trusted.
+	bannedID := randomID()
+	for _, id := range []enode.ID{bannedID, trustedID} {
+		srv.reputation.report(id, ScoreInvalid)
+		srv.reputation.report(id, ScoreInvalid)
+	}
+	if err := srv.checkpoint(newconn(bannedID), srv.checkpointPostHandshake); err != DiscUselessPeer {
+		t.Error("wrong error for banned conn:", err)
+	}
+	if err := srv.checkpoint(newconn(trustedID), srv.checkpointPostHandshake); err != nil {
+		t.Error("unexpected error for banned trusted conn:", err)
+	}
+	// Badly scored nodes are accepted only into the first half of the inbound slots.
+	poorID := randomID()
+	srv.reputation.report(poorID, ScoreUseless)
+	if err := srv.checkpoint(newconn(poorID), srv.checkpointPostHandshake); err != nil {
+		t.Error("unexpected error for badly scored conn:", err)
+	}
+	for i := 0; i < 5; i++ {
+		c := newconn(randomID())
+		if err := srv.checkpoint(c, srv.checkpointAddPeer); err != nil {
+			t.Fatalf("could not add conn %d: %v", i, err)
+		}
+	}
+	if err := srv.checkpoint(newconn(poorID), srv.checkpointPostHandshake); err != DiscTooManyPeers {
+		t.Error("wrong error for badly scored conn:", err)
+	}
+	if err := srv.checkpoint(newconn(randomID()), srv.checkpointPostHandshake); err != nil {
+		t.Error("unexpected error for unscored conn:", err)
+	}
+}
+
+func TestServerBans(t *testing.T) {
+	srv := &Server{
+		Config: Config{
+			PrivateKey:  newkey(),
+			MaxPeers:    10,
+			NoDial:      true,
+			NoDiscovery: true,
+			Logger:      testlog.Logger(t, log.LvlTrace),
+		},
+	}
+	if err := srv.BanNode(randomID(), time.Now().Add(time.Hour)); err != errServerStopped {
+		t.Fatal("wrong error for ban on stopped server:", err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	newconn := func(id enode.ID) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(&newkey().PublicKey, fd, nil)
+		node := enode.SignNull(new(enr.Record), id)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, node: node, cont: make(chan error)}
+	}
+	// Banned nodes are rejected until unbanned.
+	id := randomID()
+	if err := srv.BanNode(id, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("could not ban node: %v", err)
+	}
+	if err := srv.checkpoint(newconn(id), srv.checkpointPostHandshake); err != DiscUselessPeer {
+		t.Error("wrong error for banned conn:", err)
+	}
+	// Connections from banned subnets are rejected until unbanned.
+	_, subnet, _ := net.ParseCIDR("10.1.0.0/16")
+	if err := srv.BanSubnet(subnet, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("could not ban subnet: %v", err)
+	}
+	if err := srv.checkInboundConn(net.IP{10, 1, 2, 3}); err == nil {
+		t.Error("inbound connection from banned subnet accepted")
+	}
+	if bans, _ := srv.BansInfo(); len(bans) != 2 {
+		t.Errorf("ban count mismatch: have %d, want %d", len(bans), 2)
+	}
+	if err := srv.UnbanNode(id); err != nil {
+		t.Fatalf("could not unban node: %v", err)
+	}
+	if err := srv.UnbanSubnet(subnet); err != nil {
+		t.Fatalf("could not unban subnet: %v", err)
+	}
+	if err := srv.checkpoint(newconn(id), srv.checkpointPostHandshake); err != nil {
+		t.Error("unexpected error for unbanned conn:", err)
+	}
+	if err := srv.checkInboundConn(net.IP{10, 1, 2, 3}); err != nil {
+		t.Error("unexpected error for unbanned subnet:", err)
+	}
+}
+
 func TestServerPeerLimits(t *testing.T) {
 	srvkey := newkey()
 	clientkey := newkey()
@@ -600,6 +713,50 @@ func (c *fakeAddrConn) RemoteAddr() net.Addr {
 	return c.remoteAddr
 }
 
+// This test checks that servers connect over QUIC if both support it, and over
+// TCP otherwise.
+func TestServerQUIC(t *testing.T) {
+	start := func(quic bool) *Server {
+		config := Config{
+			Name:        "test",
+			MaxPeers:    10,
+			ListenAddr:  "127.0.0.1:0",
+			NoDiscovery: true,
+			PrivateKey:  newkey(),
+			Logger:      testlog.Logger(t, log.LvlTrace),
+		}
+		if quic {
+			config.QUICListenAddr = "127.0.0.1:0"
+		}
+		srv := &Server{Config: config}
+		if err := srv.Start(); err != nil {
+			t.Fatalf("Could not start server: %v", err)
+		}
+		return srv
+	}
+	tests := []struct {
+		dialer, listener bool
+		network          string
+	}{
+		{dialer: true, listener: true, network: "udp"},
+		{dialer: true, listener: false, network: "tcp"},
+		{dialer: false, listener: true, network: "tcp"},
+	}
+	for i, test := range tests {
+		dialer, listener := start(test.dialer), start(test.listener)
+		if test.listener && listener.Self().QUIC() == 0 {
+			t.Errorf("test %d: node record lacks the quic entry", i)
+		}
+		if !syncAddPeer(dialer, listener.Self()) {
+			t.Errorf("test %d: peer not connected", i)
+		} else if peers := dialer.Peers(); len(peers) != 1 || peers[0].RemoteAddr().Network() != test.network {
+			t.Errorf("test %d: wrong peers %v, want one connected over %s", i, peers, test.network)
+		}
+		dialer.Stop()
+		listener.Stop()
+	}
+}
+
 func syncAddPeer(srv *Server, node *enode.Node) bool {
 	var (
 		ch      = make(chan *PeerEvent)
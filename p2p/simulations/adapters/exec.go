@@ -56,16 +56,25 @@ type ExecAdapter struct {
 	// simulation node are created.
 	BaseDir string
 
+	// links holds the link conditions. The nodes connect to each other through
+	// a relay, which applies them. Message drop rules are applied by the nodes.
+	links *Links
+	relay *linkRelay // started when the first node is created
+
+	mu    sync.Mutex // protects nodes, relay and the node RPC clients
 	nodes map[enode.ID]*ExecNode
 }
 
 // NewExecAdapter returns an ExecAdapter which stores node data in
 // subdirectories of the given base directory
 func NewExecAdapter(baseDir string) *ExecAdapter {
-	return &ExecAdapter{
+	e := &ExecAdapter{
 		BaseDir: baseDir,
+		links:   NewLinks(),
 		nodes:   make(map[enode.ID]*ExecNode),
 	}
+	e.links.changed = e.updateMsgDrops
+	return e
 }
 
 // Name returns the name of the adapter for logging purposes
@@ -73,6 +82,40 @@ func (e *ExecAdapter) Name() string {
 	return "exec-adapter"
 }
 
+// Links returns the link conditions between the nodes.
+func (e *ExecAdapter) Links() *Links {
+	return e.links
+}
+
+// nodeAddr returns the devp2p address of a node, which is used by the relay.
+func (e *ExecAdapter) nodeAddr(id enode.ID) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	node, ok := e.nodes[id]
+	if !ok {
+		return "", fmt.Errorf("unknown node: %s", id)
+	}
+	return fmt.Sprintf("127.0.0.1:%d", node.Config.Node.Port), nil
+}
+
+// updateMsgDrops sends the current message drop rules to all running nodes.
+func (e *ExecAdapter) updateMsgDrops() {
+	e.mu.Lock()
+	nodes := make([]*ExecNode, 0, len(e.nodes))
+	for _, node := range e.nodes {
+		if node.client != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, node := range nodes {
+		if err := node.updateMsgDrops(); err != nil {
+			log.Warn("Can't update message drop rules", "node", node.ID, "err", err)
+		}
+	}
+}
+
 // NewNode returns a new ExecNode using the given config
 func (e *ExecAdapter) NewNode(config *NodeConfig) (Node, error) {
 	if len(config.Lifecycles) == 0 {
@@ -84,6 +127,16 @@ func (e *ExecAdapter) NewNode(config *NodeConfig) (Node, error) {
 		}
 	}
 
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.relay == nil {
+		relay, err := newLinkRelay(e.links, e.nodeAddr)
+		if err != nil {
+			return nil, fmt.Errorf("error starting link relay: %v", err)
+		}
+		e.relay = relay
+	}
+
 	// create the node directory using the first 12 characters of the ID
 	// as Unix socket paths cannot be longer than 256 characters
 	dir := filepath.Join(e.BaseDir, config.ID.String()[:12])
@@ -98,8 +151,9 @@ func (e *ExecAdapter) NewNode(config *NodeConfig) (Node, error) {
 
 	// generate the config
 	conf := &execNodeConfig{
-		Stack: node.DefaultConfig,
-		Node:  config,
+		Stack:     node.DefaultConfig,
+		Node:      config,
+		RelayAddr: e.relay.Addr(),
 	}
 	if config.DataDir != "" {
 		conf.Stack.DataDir = config.DataDir
@@ -107,11 +161,15 @@ func (e *ExecAdapter) NewNode(config *NodeConfig) (Node, error) {
 		conf.Stack.DataDir = filepath.Join(dir, "data")
 	}
 
-	// these parameters are crucial for execadapter node to run correctly
+	// these parameters are crucial for execadapter node to run correctly.
+	// The WebSocket endpoint serves the public APIs of the node's services to
+	// RPC clients of the simulation. The adapter controls the node through its
+	// IPC endpoint, which serves all APIs, including admin and simulation.
 	conf.Stack.WSHost = "127.0.0.1"
 	conf.Stack.WSPort = 0
 	conf.Stack.WSOrigins = []string{"*"}
-	conf.Stack.WSExposeAll = true
+	conf.Stack.WSModules = nil
+	conf.Stack.IPCPath = filepath.Join(dir, "node.ipc")
 	conf.Stack.P2P.EnableMsgEvents = config.EnableMsgEvents
 	conf.Stack.P2P.NoDiscovery = true
 	conf.Stack.P2P.NAT = nil
@@ -176,26 +234,16 @@ func (n *ExecNode) Start(snapshots map[string][]byte) (err error) {
 	confCopy := *n.Config
 	confCopy.Snapshots = snapshots
 	confCopy.PeerAddrs = make(map[string]string)
+	n.adapter.mu.Lock()
 	for id, node := range n.adapter.nodes {
 		confCopy.PeerAddrs[id.String()] = node.wsAddr
 	}
+	n.adapter.mu.Unlock()
+	confCopy.MsgDrops = n.adapter.links.dropRules(n.ID)
 	confData, err := json.Marshal(confCopy)
 	if err != nil {
 		return fmt.Errorf("error generating node config: %s", err)
 	}
-	// expose the admin namespace via websocket if it's not enabled
-	exposed := confCopy.Stack.WSExposeAll
-	if !exposed {
-		for _, api := range confCopy.Stack.WSModules {
-			if api == "admin" {
-				exposed = true
-				break
-			}
-		}
-	}
-	if !exposed {
-		confCopy.Stack.WSModules = append(confCopy.Stack.WSModules, "admin")
-	}
 	// start the one-shot server that waits for startup information
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -219,18 +267,39 @@ func (n *ExecNode) Start(snapshots map[string][]byte) (err error) {
 	if status.Err != "" {
 		return errors.New(status.Err)
 	}
-	client, err := rpc.DialWebsocket(ctx, status.WSEndpoint, "")
+	client, err := rpc.DialIPC(ctx, status.IPCEndpoint)
 	if err != nil {
 		return fmt.Errorf("can't connect to RPC server: %v", err)
 	}
 
 	// Node ready :)
+	n.adapter.mu.Lock()
 	n.client = client
 	n.wsAddr = status.WSEndpoint
+	n.adapter.mu.Unlock()
 	n.Info = status.NodeInfo
+
+	// The link configuration may have changed while the node was starting.
+	if err := n.updateMsgDrops(); err != nil {
+		return fmt.Errorf("can't set message drop rules: %v", err)
+	}
 	return nil
 }
 
+// updateMsgDrops sends the current message drop rules of the node's links
+// to the node.
+func (n *ExecNode) updateMsgDrops() error {
+	n.adapter.mu.Lock()
+	client := n.client
+	n.adapter.mu.Unlock()
+	if client == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return client.CallContext(ctx, nil, "simulation_setMsgDrops", n.adapter.links.dropRules(n.ID))
+}
+
 // waitForStartupJSON runs a one-shot HTTP server to receive a startup report.
 func (n *ExecNode) waitForStartupJSON(ctx context.Context) (string, chan nodeStartupJSON) {
 	var (
@@ -288,10 +357,13 @@ func (n *ExecNode) Stop() error {
 		n.Cmd = nil
 	}()
 
-	if n.client != nil {
-		n.client.Close()
-		n.client = nil
-		n.wsAddr = ""
+	n.adapter.mu.Lock()
+	client := n.client
+	n.client = nil
+	n.wsAddr = ""
+	n.adapter.mu.Unlock()
+	if client != nil {
+		client.Close()
 		n.Info = nil
 	}
 
@@ -351,6 +423,10 @@ func wsCopy(wg *sync.WaitGroup, src, dst *websocket.Conn) {
 		if _, err = io.Copy(w, r); err != nil {
 			return
 		}
+		// Closing the writer flushes the message.
+		if err = w.Close(); err != nil {
+			return
+		}
 	}
 }
 
@@ -371,6 +447,8 @@ type execNodeConfig struct {
 	Node      *NodeConfig       `json:"node"`
 	Snapshots map[string][]byte `json:"snapshots,omitempty"`
 	PeerAddrs map[string]string `json:"peer_addrs,omitempty"`
+	RelayAddr string            `json:"relay_addr,omitempty"`
+	MsgDrops  msgDropRules      `json:"msg_drops"`
 }
 
 func initLogging() {
@@ -423,6 +501,7 @@ func execP2PNode() {
 		status.Err = stackErr.Error()
 	} else {
 		status.WSEndpoint = stack.WSEndpoint()
+		status.IPCEndpoint = stack.IPCEndpoint()
 		status.NodeInfo = stack.Server().NodeInfo()
 	}
 
@@ -470,6 +549,14 @@ func startExecNodeStack() (*node.Node, error) {
 	conf.Stack.P2P.PrivateKey = conf.Node.PrivateKey
 	conf.Stack.Logger = log.New("node.id", conf.Node.ID.String())
 
+	// Connect to other nodes through the relay of the simulation host, which
+	// applies the link conditions, and drop messages as instructed by the host.
+	if conf.RelayAddr != "" {
+		conf.Stack.P2P.Dialer = &relayDialer{addr: conf.RelayAddr, self: conf.Node.ID}
+	}
+	drops := &msgDropTable{rules: conf.MsgDrops}
+	conf.Stack.P2P.DropMsg = drops.drop
+
 	// initialize the devp2p stack
 	stack, err := node.New(&conf.Stack)
 	if err != nil {
@@ -498,11 +585,15 @@ func startExecNodeStack() (*node.Node, error) {
 		services[name] = service
 	}
 
-	// Add the snapshot API.
+	// Add the snapshot and message drop APIs.
 	stack.RegisterAPIs([]rpc.API{{
 		Namespace: "simulation",
 		Version:   "1.0",
 		Service:   SnapshotAPI{services},
+	}, {
+		Namespace: "simulation",
+		Version:   "1.0",
+		Service:   msgDropAPI{drops},
 	}})
 
 	if err = stack.Start(); err != nil {
@@ -518,9 +609,10 @@ const (
 
 // nodeStartupJSON is sent to the simulation host after startup.
 type nodeStartupJSON struct {
-	Err        string
-	WSEndpoint string
-	NodeInfo   *p2p.NodeInfo
+	Err         string
+	WSEndpoint  string
+	IPCEndpoint string
+	NodeInfo    *p2p.NodeInfo
 }
 
 // SnapshotAPI provides an RPC mavnod to create snapshots of services
@@ -544,6 +636,30 @@ func (api SnapshotAPI) Snapshot() (map[string][]byte, error) {
 	return snapshots, nil
 }
 
+// msgDropTable holds the message drop rules of the links of an exec node.
+type msgDropTable struct {
+	mu    sync.RWMutex
+	rules msgDropRules
+}
+
+func (t *msgDropTable) drop(remote enode.ID, proto string, code uint64) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.rules.drop(remote, proto, code)
+}
+
+// msgDropAPI lets the simulation host update the message drop rules of a node
+type msgDropAPI struct {
+	table *msgDropTable
+}
+
+// SetMsgDrops replaces the message drop rules of the node's links.
+func (api msgDropAPI) SetMsgDrops(rules msgDropRules) {
+	api.table.mu.Lock()
+	defer api.table.mu.Unlock()
+	api.table.rules = rules
+}
+
 type wsRPCDialer struct {
 	addrs map[string]string
 }
@@ -38,6 +38,7 @@ import (
 // connects them using net.Pipe
 type SimAdapter struct {
 	pipe       func() (net.Conn, net.Conn, error)
+	links      *Links
 	mtx        sync.RWMutex
 	nodes      map[enode.ID]*SimNode
 	lifecycles LifecycleConstructors
@@ -50,6 +51,7 @@ type SimAdapter struct {
 func NewSimAdapter(services LifecycleConstructors) *SimAdapter {
 	return &SimAdapter{
 		pipe:       pipes.NetPipe,
+		links:      NewLinks(),
 		nodes:      make(map[enode.ID]*SimNode),
 		lifecycles: services,
 	}
@@ -60,6 +62,12 @@ func (s *SimAdapter) Name() string {
 	return "sim-adapter"
 }
 
+// Links returns the link table which controls the conditions of connections
+// between nodes.
+func (s *SimAdapter) Links() *Links {
+	return s.links
+}
+
 // NewNode returns a new SimNode using the given config
 func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 	s.mtx.Lock()
@@ -96,8 +104,11 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 			PrivateKey:      config.PrivateKey,
 			MaxPeers:        math.MaxInt32,
 			NoDiscovery:     true,
-			Dialer:          s,
+			Dialer:          &simDialer{adapter: s, self: id},
 			EnableMsgEvents: config.EnableMsgEvents,
+			DropMsg: func(remote enode.ID, proto string, code uint64) bool {
+				return s.links.DropMsg(id, remote, proto, code)
+			},
 		},
 		ExternalSigner: config.ExternalSigner,
 		Logger:         log.New("node.id", id.String()),
@@ -120,6 +131,12 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 // Dial implements the p2p.NodeDialer interface by connecting to the node using
 // an in-memory net.Pipe
 func (s *SimAdapter) Dial(ctx context.Context, dest *enode.Node) (conn net.Conn, err error) {
+	return s.dial(enode.ID{}, dest)
+}
+
+// dial connects to the dest node. If the source node is known, the connection
+// is subject to the conditions of the link between source and dest.
+func (s *SimAdapter) dial(src enode.ID, dest *enode.Node) (net.Conn, error) {
 	node, ok := s.GetNode(dest.ID())
 	if !ok {
 		return nil, fmt.Errorf("unknown node: %s", dest.ID())
@@ -133,6 +150,16 @@ func (s *SimAdapter) Dial(ctx context.Context, dest *enode.Node) (conn net.Conn,
 	if err != nil {
 		return nil, err
 	}
+	if src != (enode.ID{}) {
+		if pipe2, err = s.links.Wrap(pipe2, src, dest.ID()); err != nil {
+			pipe1.Close()
+			return nil, err
+		}
+		if pipe1, err = s.links.Wrap(pipe1, dest.ID(), src); err != nil {
+			pipe2.Close()
+			return nil, err
+		}
+	}
 	// this is simulated 'listening'
 	// asynchronously call the dialed destination node's p2p server
 	// to set up connection on the 'listening' side
@@ -140,6 +167,17 @@ func (s *SimAdapter) Dial(ctx context.Context, dest *enode.Node) (conn net.Conn,
 	return pipe2, nil
 }
 
+// simDialer dials other simulation nodes on behalf of a node.
+type simDialer struct {
+	adapter *SimAdapter
+	self    enode.ID
+}
+
+// Dial implements the p2p.NodeDialer interface.
+func (d *simDialer) Dial(ctx context.Context, dest *enode.Node) (net.Conn, error) {
+	return d.adapter.dial(d.self, dest)
+}
+
 // DialRPC implements the RPCDialer interface by creating an in-memory RPC
 // client of the given node
 func (s *SimAdapter) DialRPC(id enode.ID) (*rpc.Client, error) {
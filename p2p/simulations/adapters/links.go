@@ -0,0 +1,610 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package adapters
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/avalanria/go-avalanria/p2p/enode"
+)
+
+const (
+	// minRetransmitTimeout is the minimum delay of lost data.
+	minRetransmitTimeout = 200 * time.Millisecond
+
+	// linkQueueSize is the number of writes which can be in flight on a
+	// single connection. Writers block when the queue is full.
+	linkQueueSize = 256
+)
+
+var (
+	errLinkDown   = errors.New("link is down")
+	errLinkClosed = errors.New("use of closed network connection")
+)
+
+// LinkSimulator is implemented by node adapters which can simulate adverse
+// conditions on the links between nodes.
+type LinkSimulator interface {
+	Links() *Links
+}
+
+// LinkConfig describes the conditions of a simulated link between two nodes.
+// The zero value is a perfect link.
+//
+// Conditions apply to each direction of the link separately, i.e. a link
+// with 100ms latency has a round-trip time of 200ms.
+//
+// Simulated links carry reliable streams, so Loss does not discard any data.
+// It only models the retransmission of lost packets: the affected write is
+// delayed by a retransmission timeout, along with all data written after it.
+// Whole devp2p messages are discarded by the Drop rules instead.
+type LinkConfig struct {
+	Latency   time.Duration // delay of all data
+	Jitter    time.Duration // random additional delay, up to this value
+	Bandwidth int           // bytes per second, zero means unlimited
+	Loss      float64       // fraction of writes delayed by a retransmission
+	Drop      []MsgDrop     // rules for discarding devp2p messages
+	Down      bool          // link is cut
+}
+
+// MsgDrop discards devp2p messages sent over a link. A rule matches the messages
+// of the given protocol with one of the given codes. Each matching message is
+// dropped with the given probability.
+type MsgDrop struct {
+	Protocol string   `json:"protocol,omitempty"` // protocol name, empty matches all protocols
+	Codes    []uint64 `json:"codes,omitempty"`    // message codes, empty matches all codes
+	Rate     float64  `json:"rate"`               // fraction of matching messages dropped
+}
+
+// dropMsg reports whether a message should be discarded according to the rules.
+func dropMsg(rules []MsgDrop, proto string, code uint64) bool {
+	for _, d := range rules {
+		if d.match(proto, code) && rand.Float64() < d.Rate {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether the rule applies to a message.
+func (d MsgDrop) match(proto string, code uint64) bool {
+	if d.Protocol != "" && d.Protocol != proto {
+		return false
+	}
+	if len(d.Codes) == 0 {
+		return true
+	}
+	for _, c := range d.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+type linkConfigJSON struct {
+	Latency   string    `json:"latency,omitempty"`
+	Jitter    string    `json:"jitter,omitempty"`
+	Bandwidth int       `json:"bandwidth,omitempty"`
+	Loss      float64   `json:"loss,omitempty"`
+	Drop      []MsgDrop `json:"drop,omitempty"`
+	Down      bool      `json:"down,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Durations are encoded as strings like "100ms".
+func (c LinkConfig) MarshalJSON() ([]byte, error) {
+	enc := linkConfigJSON{Bandwidth: c.Bandwidth, Loss: c.Loss, Drop: c.Drop, Down: c.Down}
+	if c.Latency != 0 {
+		enc.Latency = c.Latency.String()
+	}
+	if c.Jitter != 0 {
+		enc.Jitter = c.Jitter.String()
+	}
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *LinkConfig) UnmarshalJSON(input []byte) error {
+	var dec linkConfigJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	cfg := LinkConfig{Bandwidth: dec.Bandwidth, Loss: dec.Loss, Drop: dec.Drop, Down: dec.Down}
+	var err error
+	if dec.Latency != "" {
+		if cfg.Latency, err = time.ParseDuration(dec.Latency); err != nil {
+			return fmt.Errorf("invalid latency: %v", err)
+		}
+	}
+	if dec.Jitter != "" {
+		if cfg.Jitter, err = time.ParseDuration(dec.Jitter); err != nil {
+			return fmt.Errorf("invalid jitter: %v", err)
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	*c = cfg
+	return nil
+}
+
+func (c LinkConfig) validate() error {
+	switch {
+	case c.Latency < 0:
+		return errors.New("negative latency")
+	case c.Jitter < 0:
+		return errors.New("negative jitter")
+	case c.Bandwidth < 0:
+		return errors.New("negative bandwidth")
+	case c.Loss < 0 || c.Loss >= 1:
+		return errors.New("loss must be in range [0, 1)")
+	}
+	for _, d := range c.Drop {
+		if d.Rate <= 0 || d.Rate > 1 {
+			return errors.New("drop rate must be in range (0, 1]")
+		}
+	}
+	return nil
+}
+
+// perfect reports whether the link delivers all data immediately.
+func (c LinkConfig) perfect() bool {
+	return c.Latency == 0 && c.Jitter == 0 && c.Bandwidth == 0 && c.Loss == 0
+}
+
+// retransmitTimeout returns the extra delay of writes hit by Loss.
+func (c LinkConfig) retransmitTimeout() time.Duration {
+	rto := 2 * (c.Latency + c.Jitter)
+	if rto < minRetransmitTimeout {
+		rto = minRetransmitTimeout
+	}
+	return rto
+}
+
+// LinkState is the current configuration of all links.
+type LinkState struct {
+	Default    LinkConfig              `json:"default"`
+	Links      []LinkInfo              `json:"links"`
+	Partitions map[string][][]enode.ID `json:"partitions"`
+}
+
+// LinkInfo is the configuration of the link between two nodes.
+type LinkInfo struct {
+	One    enode.ID   `json:"one"`
+	Other  enode.ID   `json:"other"`
+	Config LinkConfig `json:"config"`
+}
+
+// linkKey identifies a link. The smaller node ID is always first.
+type linkKey [2]enode.ID
+
+func newLinkKey(one, other enode.ID) linkKey {
+	if bytes.Compare(one[:], other[:]) > 0 {
+		one, other = other, one
+	}
+	return linkKey{one, other}
+}
+
+// Links tracks the conditions of links between simulation nodes and applies them
+// to the connections between the nodes. Links can be configured individually.
+// All other links use the default configuration.
+//
+// Named partitions split the network into groups of nodes. Links between nodes in
+// different groups of a partition are down until the partition is healed. Nodes
+// which are not in any group of a partition are not affected by it.
+type Links struct {
+	mu         sync.Mutex
+	defaults   LinkConfig
+	links      map[linkKey]LinkConfig
+	partitions map[string][][]enode.ID
+	conns      map[*linkConn]struct{}
+
+	// changed is called after the configuration has changed. It is used by
+	// adapters whose nodes apply some of the conditions themselves.
+	changed func()
+}
+
+// NewLinks creates an empty link table where all links are perfect.
+func NewLinks() *Links {
+	return &Links{
+		links:      make(map[linkKey]LinkConfig),
+		partitions: make(map[string][][]enode.ID),
+		conns:      make(map[*linkConn]struct{}),
+	}
+}
+
+// SetDefault sets the configuration of all links which are not configured individually.
+func (l *Links) SetDefault(cfg LinkConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	return l.update(func() error {
+		l.defaults = cfg
+		return nil
+	})
+}
+
+// Set configures the link between two nodes.
+func (l *Links) Set(one, other enode.ID, cfg LinkConfig) error {
+	if one == other {
+		return errors.New("link endpoints are the same node")
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	return l.update(func() error {
+		l.links[newLinkKey(one, other)] = cfg
+		return nil
+	})
+}
+
+// Reset makes the link between two nodes use the default configuration again.
+func (l *Links) Reset(one, other enode.ID) {
+	l.update(func() error {
+		delete(l.links, newLinkKey(one, other))
+		return nil
+	})
+}
+
+// Get returns the current conditions of the link between two nodes.
+func (l *Links) Get(one, other enode.ID) LinkConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.get(newLinkKey(one, other))
+}
+
+func (l *Links) get(key linkKey) LinkConfig {
+	cfg, ok := l.links[key]
+	if !ok {
+		cfg = l.defaults
+	}
+	if !cfg.Down {
+		for _, groups := range l.partitions {
+			if separated(groups, key[0], key[1]) {
+				cfg.Down = true
+				break
+			}
+		}
+	}
+	return cfg
+}
+
+// separated reports whether the nodes are in different groups.
+func separated(groups [][]enode.ID, one, other enode.ID) bool {
+	oneGroup, otherGroup := -1, -1
+	for i, group := range groups {
+		for _, id := range group {
+			if id == one {
+				oneGroup = i
+			}
+			if id == other {
+				otherGroup = i
+			}
+		}
+	}
+	return oneGroup >= 0 && otherGroup >= 0 && oneGroup != otherGroup
+}
+
+// Partition creates a named partition between the given groups of nodes.
+// An existing partition with the same name is replaced.
+func (l *Links) Partition(name string, groups [][]enode.ID) error {
+	if name == "" {
+		return errors.New("partition name is empty")
+	}
+	if len(groups) < 2 {
+		return errors.New("partition needs at least two groups")
+	}
+	seen := make(map[enode.ID]bool)
+	for _, group := range groups {
+		for _, id := range group {
+			if seen[id] {
+				return fmt.Errorf("node %v is in more than one group", id)
+			}
+			seen[id] = true
+		}
+	}
+	return l.update(func() error {
+		l.partitions[name] = groups
+		return nil
+	})
+}
+
+// Heal removes a partition.
+func (l *Links) Heal(name string) error {
+	return l.update(func() error {
+		if _, ok := l.partitions[name]; !ok {
+			return fmt.Errorf("unknown partition %q", name)
+		}
+		delete(l.partitions, name)
+		return nil
+	})
+}
+
+// update applies a change to the configuration and closes the connections
+// whose link went down.
+func (l *Links) update(fn func() error) error {
+	l.mu.Lock()
+	err := fn()
+	if err == nil {
+		l.closeDownConns()
+	}
+	l.mu.Unlock()
+
+	if err == nil && l.changed != nil {
+		l.changed()
+	}
+	return err
+}
+
+// State returns the current configuration of all links.
+func (l *Links) State() *LinkState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := &LinkState{
+		Default:    l.defaults,
+		Links:      make([]LinkInfo, 0, len(l.links)),
+		Partitions: make(map[string][][]enode.ID, len(l.partitions)),
+	}
+	for key, cfg := range l.links {
+		state.Links = append(state.Links, LinkInfo{One: key[0], Other: key[1], Config: cfg})
+	}
+	sort.Slice(state.Links, func(i, j int) bool {
+		a, b := state.Links[i], state.Links[j]
+		if a.One != b.One {
+			return bytes.Compare(a.One[:], b.One[:]) < 0
+		}
+		return bytes.Compare(a.Other[:], b.Other[:]) < 0
+	})
+	for name, groups := range l.partitions {
+		state.Partitions[name] = groups
+	}
+	return state
+}
+
+// DropMsg reports whether a devp2p message sent from one node to another over
+// their link should be discarded.
+func (l *Links) DropMsg(from, to enode.ID, proto string, code uint64) bool {
+	return dropMsg(l.Get(from, to).Drop, proto, code)
+}
+
+// msgDropRules are the message drop rules of the links of a single node.
+type msgDropRules struct {
+	Default []MsgDrop              `json:"default,omitempty"` // rules of links which are not configured
+	Links   map[enode.ID][]MsgDrop `json:"links,omitempty"`   // rules of configured links, by remote node
+}
+
+// drop reports whether a message sent to the remote node should be discarded.
+func (r *msgDropRules) drop(remote enode.ID, proto string, code uint64) bool {
+	rules, ok := r.Links[remote]
+	if !ok {
+		rules = r.Default
+	}
+	return dropMsg(rules, proto, code)
+}
+
+// dropRules returns the message drop rules of all links of a node.
+func (l *Links) dropRules(id enode.ID) msgDropRules {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rules := msgDropRules{
+		Default: l.defaults.Drop,
+		Links:   make(map[enode.ID][]MsgDrop),
+	}
+	for key, cfg := range l.links {
+		switch id {
+		case key[0]:
+			rules.Links[key[1]] = cfg.Drop
+		case key[1]:
+			rules.Links[key[0]] = cfg.Drop
+		}
+	}
+	return rules
+}
+
+// Wrap applies the conditions of the link between local and remote to data
+// written to conn. It fails if the link is down.
+func (l *Links) Wrap(conn net.Conn, local, remote enode.ID) (net.Conn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := newLinkKey(local, remote)
+	if l.get(key).Down {
+		return nil, errLinkDown
+	}
+	c := &linkConn{
+		Conn:   conn,
+		links:  l,
+		key:    key,
+		queue:  make(chan *linkPacket, linkQueueSize),
+		closed: make(chan struct{}),
+	}
+	l.conns[c] = struct{}{}
+	go c.deliverLoop()
+	return c, nil
+}
+
+// closeDownConns closes all connections whose link is down.
+// It must be called with l.mu held.
+func (l *Links) closeDownConns() {
+	for c := range l.conns {
+		if l.get(c.key).Down {
+			delete(l.conns, c)
+			c.close()
+		}
+	}
+}
+
+func (l *Links) removeConn(c *linkConn) {
+	l.mu.Lock()
+	delete(l.conns, c)
+	l.mu.Unlock()
+}
+
+// linkConn is a connection over a simulated link. Data written to the connection
+// is passed to the underlying connection when it arrives at the other end.
+type linkConn struct {
+	net.Conn
+	links *Links
+	key   linkKey
+
+	wmu          sync.Mutex // serializes writes
+	txEnd        time.Time  // when the last write finished transmitting
+	lastDelivery time.Time  // when the last write arrives
+	pending      int32      // number of queued writes, accessed atomically
+
+	queue     chan *linkPacket
+	closed    chan struct{}
+	closeOnce sync.Once
+	errMu     sync.Mutex
+	err       error // delivery failure
+}
+
+type linkPacket struct {
+	data []byte
+	at   time.Time
+}
+
+func (c *linkConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if err := c.error(); err != nil {
+		return 0, err
+	}
+	cfg := c.links.Get(c.key[0], c.key[1])
+	if cfg.Down {
+		c.Close()
+		return 0, errLinkDown
+	}
+	// Perfect links write directly unless older data is still in flight.
+	if cfg.perfect() && atomic.LoadInt32(&c.pending) == 0 {
+		return c.Conn.Write(b)
+	}
+
+	// Data is transmitted after all previous writes, at the speed of the link.
+	// The writer is blocked during transmission.
+	now := time.Now()
+	start := now
+	if c.txEnd.After(now) {
+		start = c.txEnd
+	}
+	c.txEnd = start
+	if cfg.Bandwidth > 0 {
+		c.txEnd = start.Add(time.Duration(len(b)) * time.Second / time.Duration(cfg.Bandwidth))
+	}
+	at := c.txEnd.Add(cfg.Latency)
+	if cfg.Jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(cfg.Jitter))))
+	}
+	if cfg.Loss > 0 && rand.Float64() < cfg.Loss {
+		at = at.Add(cfg.retransmitTimeout())
+	}
+	// Data arrives in order.
+	if at.Before(c.lastDelivery) {
+		at = c.lastDelivery
+	}
+	c.lastDelivery = at
+
+	if err := c.sleep(time.Until(c.txEnd)); err != nil {
+		return 0, err
+	}
+	p := &linkPacket{data: append([]byte(nil), b...), at: at}
+	atomic.AddInt32(&c.pending, 1)
+	select {
+	case c.queue <- p:
+		return len(b), nil
+	case <-c.closed:
+		atomic.AddInt32(&c.pending, -1)
+		return 0, errLinkClosed
+	}
+}
+
+// deliverLoop writes queued data to the underlying connection when it's due.
+func (c *linkConn) deliverLoop() {
+	for {
+		select {
+		case p := <-c.queue:
+			if c.sleep(time.Until(p.at)) != nil {
+				return
+			}
+			_, err := c.Conn.Write(p.data)
+			atomic.AddInt32(&c.pending, -1)
+			if err != nil {
+				c.setError(err)
+				c.Close()
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// sleep waits for the given duration or until the connection is closed.
+func (c *linkConn) sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.closed:
+		return errLinkClosed
+	}
+}
+
+// Close closes the connection. Data which is still in flight is discarded.
+func (c *linkConn) Close() error {
+	c.links.removeConn(c)
+	return c.close()
+}
+
+func (c *linkConn) close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+func (c *linkConn) error() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+func (c *linkConn) setError(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
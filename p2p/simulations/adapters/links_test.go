@@ -0,0 +1,225 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package adapters
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/p2p/enode"
+)
+
+var (
+	linkTestA = enode.ID{1}
+	linkTestB = enode.ID{2}
+	linkTestC = enode.ID{3}
+)
+
+// newLinkPipe creates a connection between two nodes over a simulated link.
+func newLinkPipe(t *testing.T, links *Links, one, other enode.ID) (net.Conn, net.Conn) {
+	p1, p2 := net.Pipe()
+	c1, err := links.Wrap(p1, one, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := links.Wrap(p2, other, one)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c1, c2
+}
+
+func TestLinkLatency(t *testing.T) {
+	links := NewLinks()
+	links.Set(linkTestA, linkTestB, LinkConfig{Latency: 100 * time.Millisecond, Jitter: 20 * time.Millisecond})
+	c1, c2 := newLinkPipe(t, links, linkTestA, linkTestB)
+	defer c1.Close()
+	defer c2.Close()
+
+	// Writes don't block, data arrives in order after the latency.
+	start := time.Now()
+	var want []byte
+	for i := 0; i < 50; i++ {
+		if _, err := c1.Write([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, byte(i))
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("writes blocked for %v", d)
+	}
+	have := make([]byte, len(want))
+	if _, err := io.ReadFull(c2, have); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("data arrived too early, after %v", d)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("data reordered: %v", have)
+	}
+}
+
+func TestLinkBandwidth(t *testing.T) {
+	links := NewLinks()
+	links.SetDefault(LinkConfig{Bandwidth: 100000})
+	c1, c2 := newLinkPipe(t, links, linkTestA, linkTestB)
+	defer c1.Close()
+	defer c2.Close()
+
+	// Transmitting 20kB at 100kB/s takes 200ms.
+	start := time.Now()
+	go func() {
+		for i := 0; i < 20; i++ {
+			c1.Write(make([]byte, 1000))
+		}
+	}()
+	if _, err := io.ReadFull(c2, make([]byte, 20000)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 190*time.Millisecond {
+		t.Errorf("transfer too fast: %v", d)
+	}
+}
+
+func TestLinkPartition(t *testing.T) {
+	links := NewLinks()
+	ab1, ab2 := newLinkPipe(t, links, linkTestA, linkTestB)
+	bc1, bc2 := newLinkPipe(t, links, linkTestB, linkTestC)
+	defer bc1.Close()
+	defer bc2.Close()
+
+	if err := links.Partition("split", [][]enode.ID{{linkTestA}, {linkTestB}}); err != nil {
+		t.Fatal(err)
+	}
+	// Connections across the partition are closed.
+	if _, err := ab2.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read on partitioned connection succeeded")
+	}
+	if _, err := ab1.Write([]byte{1}); err == nil {
+		t.Fatal("write on partitioned connection succeeded")
+	}
+	if _, err := links.Wrap(new(net.TCPConn), linkTestB, linkTestA); err != errLinkDown {
+		t.Fatalf("wrong error for partitioned link: %v", err)
+	}
+	// Node C is not part of the partition.
+	go bc1.Write([]byte{1})
+	if _, err := bc2.Read(make([]byte, 1)); err != nil {
+		t.Fatal("read on unaffected connection failed:", err)
+	}
+
+	want := &LinkState{Links: []LinkInfo{}, Partitions: map[string][][]enode.ID{"split": {{linkTestA}, {linkTestB}}}}
+	if state := links.State(); !reflect.DeepEqual(state, want) {
+		t.Errorf("wrong link state %+v", state)
+	}
+	if err := links.Heal("split"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := links.Get(linkTestA, linkTestB); cfg.Down {
+		t.Fatal("link still down after healing")
+	}
+	if err := links.Heal("split"); err == nil {
+		t.Fatal("healing unknown partition succeeded")
+	}
+}
+
+func TestLinkConfigJSON(t *testing.T) {
+	cfg := LinkConfig{
+		Latency:   150 * time.Millisecond,
+		Jitter:    time.Second,
+		Bandwidth: 1000,
+		Loss:      0.1,
+		Drop:      []MsgDrop{{Protocol: "avn", Codes: []uint64{7}, Rate: 1}},
+	}
+	enc, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"latency":"150ms","jitter":"1s","bandwidth":1000,"loss":0.1,"drop":[{"protocol":"avn","codes":[7],"rate":1}]}`; string(enc) != want {
+		t.Errorf("wrong encoding %s", enc)
+	}
+	var dec LinkConfig
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dec, cfg) {
+		t.Errorf("wrong decoded config %+v", dec)
+	}
+	if err := json.Unmarshal([]byte(`{"loss":1.5}`), &dec); err == nil {
+		t.Error("invalid loss accepted")
+	}
+	if err := json.Unmarshal([]byte(`{"drop":[{"rate":0}]}`), &dec); err == nil {
+		t.Error("invalid drop rate accepted")
+	}
+}
+
+func TestLinkDropMsg(t *testing.T) {
+	links := NewLinks()
+	links.Set(linkTestA, linkTestB, LinkConfig{Drop: []MsgDrop{
+		{Protocol: "avn", Codes: []uint64{1, 7}, Rate: 1},
+		{Protocol: "snap", Rate: 1},
+	}})
+	tests := []struct {
+		from, to enode.ID
+		proto    string
+		code     uint64
+		drop     bool
+	}{
+		{linkTestA, linkTestB, "avn", 7, true},
+		{linkTestB, linkTestA, "avn", 1, true},
+		{linkTestA, linkTestB, "avn", 2, false},
+		{linkTestA, linkTestB, "snap", 2, true},
+		{linkTestA, linkTestB, "les", 7, false},
+		{linkTestA, linkTestC, "avn", 7, false},
+	}
+	for i, tt := range tests {
+		if drop := links.DropMsg(tt.from, tt.to, tt.proto, tt.code); drop != tt.drop {
+			t.Errorf("test %d: wrong drop decision for %s/%d: have %t, want %t", i, tt.proto, tt.code, drop, tt.drop)
+		}
+	}
+}
+
+func TestLinkDropRules(t *testing.T) {
+	links := NewLinks()
+	links.SetDefault(LinkConfig{Drop: []MsgDrop{{Protocol: "snap", Rate: 1}}})
+	links.Set(linkTestA, linkTestB, LinkConfig{Drop: []MsgDrop{{Protocol: "avn", Codes: []uint64{7}, Rate: 1}}})
+	links.Set(linkTestA, linkTestC, LinkConfig{Latency: time.Second})
+
+	// The rules are sent to exec nodes as JSON.
+	enc, err := json.Marshal(links.dropRules(linkTestA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules msgDropRules
+	if err := json.Unmarshal(enc, &rules); err != nil {
+		t.Fatal(err)
+	}
+	for _, remote := range []enode.ID{linkTestB, linkTestC, {4}} {
+		for _, proto := range []string{"avn", "snap"} {
+			have := rules.drop(remote, proto, 7)
+			want := links.DropMsg(linkTestA, remote, proto, 7)
+			if have != want {
+				t.Errorf("wrong drop decision for %v %s/7: have %t, want %t", remote, proto, have, want)
+			}
+		}
+	}
+}
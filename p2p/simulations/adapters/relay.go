@@ -0,0 +1,185 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package adapters
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+)
+
+const (
+	// relayPreambleSize is the size of the header sent by relay clients:
+	// the ID of the dialing node, followed by the ID of the destination.
+	relayPreambleSize = 2 * len(enode.ID{})
+
+	relayHandshakeTimeout = 5 * time.Second
+	relayBufferSize       = 32 * 1024
+)
+
+// linkRelay forwards the devp2p connections of nodes which run outside of the
+// simulation process, applying the conditions of the link between the nodes.
+//
+// A node connects to the relay instead of the destination node and announces
+// both node IDs before the devp2p handshake starts. The relay then dials the
+// destination and copies data between the two connections.
+type linkRelay struct {
+	links    *Links
+	resolve  func(id enode.ID) (string, error) // returns the devp2p address of a node
+	listener net.Listener
+	log      log.Logger
+
+	wg sync.WaitGroup
+}
+
+// newLinkRelay starts a relay listening on a random localhost port.
+func newLinkRelay(links *Links, resolve func(enode.ID) (string, error)) (*linkRelay, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &linkRelay{
+		links:    links,
+		resolve:  resolve,
+		listener: listener,
+		log:      log.New("relay", listener.Addr()),
+	}
+	r.wg.Add(1)
+	go r.acceptLoop()
+	return r, nil
+}
+
+// Addr returns the address of the relay.
+func (r *linkRelay) Addr() string {
+	return r.listener.Addr().String()
+}
+
+// Close stops accepting connections. Relayed connections stay open.
+func (r *linkRelay) Close() {
+	r.listener.Close()
+	r.wg.Wait()
+}
+
+func (r *linkRelay) acceptLoop() {
+	defer r.wg.Done()
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				time.Sleep(50 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		go r.serve(conn)
+	}
+}
+
+func (r *linkRelay) serve(in net.Conn) {
+	var preamble [relayPreambleSize]byte
+	in.SetReadDeadline(time.Now().Add(relayHandshakeTimeout))
+	if _, err := io.ReadFull(in, preamble[:]); err != nil {
+		in.Close()
+		return
+	}
+	in.SetReadDeadline(time.Time{})
+
+	var src, dst enode.ID
+	copy(src[:], preamble[:len(src)])
+	copy(dst[:], preamble[len(src):])
+	out, err := r.dial(src, dst)
+	if err != nil {
+		r.log.Debug("Can't relay connection", "src", src, "dst", dst, "err", err)
+		in.Close()
+		return
+	}
+	// Data written to out travels from src to dst, data written to in the
+	// other way around.
+	if in, err = r.links.Wrap(in, dst, src); err != nil {
+		in.Close()
+		out.Close()
+		return
+	}
+	go relayCopy(out, in)
+	relayCopy(in, out)
+}
+
+func (r *linkRelay) dial(src, dst enode.ID) (net.Conn, error) {
+	addr, err := r.resolve(dst)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", addr, relayHandshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := r.links.Wrap(conn, src, dst)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return wrapped, nil
+}
+
+// relayCopy copies data from src to dst until either connection fails, then
+// closes both. It doesn't use io.Copy because that would bypass the link
+// conditions when dst implements io.ReaderFrom.
+func relayCopy(dst, src net.Conn) {
+	defer dst.Close()
+	defer src.Close()
+	buf := make([]byte, relayBufferSize)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// relayDialer dials other simulation nodes through a relay on behalf of a node.
+type relayDialer struct {
+	addr string
+	self enode.ID
+}
+
+// Dial implements the p2p.NodeDialer interface.
+func (d *relayDialer) Dial(ctx context.Context, dest *enode.Node) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+	var preamble [relayPreambleSize]byte
+	id := dest.ID()
+	copy(preamble[:], d.self[:])
+	copy(preamble[len(d.self):], id[:])
+	if _, err := conn.Write(preamble[:]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/enr"
+)
+
+// relayTest is a relay in front of a single listening node B.
+type relayTest struct {
+	links    *Links
+	relay    *linkRelay
+	listener net.Listener
+	dialer   *relayDialer
+	dest     *enode.Node
+}
+
+func newRelayTest(t *testing.T) *relayTest {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := NewLinks()
+	relay, err := newLinkRelay(links, func(id enode.ID) (string, error) {
+		if id != linkTestB {
+			return "", fmt.Errorf("unknown node: %s", id)
+		}
+		return listener.Addr().String(), nil
+	})
+	if err != nil {
+		listener.Close()
+		t.Fatal(err)
+	}
+	return &relayTest{
+		links:    links,
+		relay:    relay,
+		listener: listener,
+		dialer:   &relayDialer{addr: relay.Addr(), self: linkTestA},
+		dest:     enode.SignNull(new(enr.Record), linkTestB),
+	}
+}
+
+func (rt *relayTest) close() {
+	rt.relay.Close()
+	rt.listener.Close()
+}
+
+// connect dials B from A through the relay.
+func (rt *relayTest) connect(t *testing.T) (a, b net.Conn) {
+	a, err := rt.dialer.Dial(context.Background(), rt.dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err = rt.listener.Accept(); err != nil {
+		a.Close()
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+func TestLinkRelay(t *testing.T) {
+	rt := newRelayTest(t)
+	defer rt.close()
+
+	rt.links.Set(linkTestA, linkTestB, LinkConfig{Latency: 50 * time.Millisecond})
+	a, b := rt.connect(t)
+	defer a.Close()
+	defer b.Close()
+
+	start := time.Now()
+	buf := make([]byte, 4)
+	if _, err := a.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(b, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("wrong data at B: %q, err %v", buf, err)
+	}
+	if _, err := b.Write([]byte("pong")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(a, buf); err != nil || string(buf) != "pong" {
+		t.Fatalf("wrong data at A: %q, err %v", buf, err)
+	}
+	if rtt := time.Since(start); rtt < 100*time.Millisecond {
+		t.Errorf("round trip too fast: %v", rtt)
+	}
+
+	// Both ends are disconnected when the link goes down.
+	if err := rt.links.Partition("split", [][]enode.ID{{linkTestA}, {linkTestB}}); err != nil {
+		t.Fatal(err)
+	}
+	a.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := a.Read(buf); err != io.EOF {
+		t.Errorf("wrong error at A after partition: %v", err)
+	}
+	if _, err := b.Read(buf); err != io.EOF {
+		t.Errorf("wrong error at B after partition: %v", err)
+	}
+}
+
+func TestLinkRelayDown(t *testing.T) {
+	rt := newRelayTest(t)
+	defer rt.close()
+
+	// Connections over a link which is down are closed by the relay.
+	rt.links.Set(linkTestA, linkTestB, LinkConfig{Down: true})
+	a, err := rt.dialer.Dial(context.Background(), rt.dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := a.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("wrong error on connection over down link: %v", err)
+	}
+	a.Close()
+
+	// The nodes can connect again once the link is up.
+	rt.links.Reset(linkTestA, linkTestB)
+	a, b := rt.connect(t)
+	a.Close()
+	b.Close()
+
+	// Unknown nodes can't be reached.
+	rt.dest = enode.SignNull(new(enr.Record), linkTestC)
+	if a, err = rt.dialer.Dial(context.Background(), rt.dest); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := a.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("wrong error on connection to unknown node: %v", err)
+	}
+}
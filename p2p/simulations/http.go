@@ -21,6 +21,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -205,6 +206,42 @@ func (c *Client) DisconnectNode(nodeID, peerID string) error {
 	return c.Delete(fmt.Sprintf("/nodes/%s/conn/%s", nodeID, peerID))
 }
 
+// GetLinks returns the configuration of all links
+func (c *Client) GetLinks() (*adapters.LinkState, error) {
+	state := &adapters.LinkState{}
+	return state, c.Get("/links", state)
+}
+
+// SetDefaultLink sets the conditions of links which are not configured individually
+func (c *Client) SetDefaultLink(config adapters.LinkConfig) error {
+	return c.Post("/links", config, nil)
+}
+
+// SetLink sets the conditions of the link between two nodes
+func (c *Client) SetLink(nodeID, peerID string, config adapters.LinkConfig) error {
+	return c.Post(fmt.Sprintf("/links/%s/%s", nodeID, peerID), config, nil)
+}
+
+// ResetLink makes the link between two nodes use the default conditions
+func (c *Client) ResetLink(nodeID, peerID string) error {
+	return c.Delete(fmt.Sprintf("/links/%s/%s", nodeID, peerID))
+}
+
+// CreatePartition creates a named partition between the given groups of nodes
+func (c *Client) CreatePartition(name string, groups [][]string) error {
+	return c.Post(fmt.Sprintf("/partitions/%s", name), groups, nil)
+}
+
+// HealPartition removes a named partition
+func (c *Client) HealPartition(name string) error {
+	return c.Delete(fmt.Sprintf("/partitions/%s", name))
+}
+
+// RunScenario runs a scenario, returning when all steps are done
+func (c *Client) RunScenario(scenario Scenario) error {
+	return c.Post("/scenario", scenario, nil)
+}
+
 // RPCClient returns an RPC client connected to a node
 func (c *Client) RPCClient(ctx context.Context, nodeID string) (*rpc.Client, error) {
 	baseURL := strings.Replace(c.URL, "http", "ws", 1)
@@ -296,6 +333,13 @@ func NewServer(network *Network) *Server {
 	s.POST("/nodes/:nodeid/conn/:peerid", s.ConnectNode)
 	s.DELETE("/nodes/:nodeid/conn/:peerid", s.DisconnectNode)
 	s.GET("/nodes/:nodeid/rpc", s.NodeRPC)
+	s.GET("/links", s.GetLinks)
+	s.POST("/links", s.SetDefaultLink)
+	s.POST("/links/:nodeid/:peerid", s.SetLink)
+	s.DELETE("/links/:nodeid/:peerid", s.ResetLink)
+	s.POST("/partitions/:name", s.CreatePartition)
+	s.DELETE("/partitions/:name", s.HealPartition)
+	s.POST("/scenario", s.RunScenario)
 
 	return s
 }
@@ -642,6 +686,131 @@ func (s *Server) DisconnectNode(w http.ResponseWriter, req *http.Request) {
 	s.JSON(w, http.StatusOK, node.NodeInfo())
 }
 
+// GetLinks returns the configuration of all links
+func (s *Server) GetLinks(w http.ResponseWriter, req *http.Request) {
+	state, err := s.network.LinkState()
+	if err != nil {
+		http.Error(w, err.Error(), linkErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	s.JSON(w, http.StatusOK, state)
+}
+
+// SetDefaultLink sets the conditions of links which are not configured individually
+func (s *Server) SetDefaultLink(w http.ResponseWriter, req *http.Request) {
+	var config adapters.LinkConfig
+	if err := json.NewDecoder(req.Body).Decode(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.network.SetDefaultLink(config); err != nil {
+		http.Error(w, err.Error(), linkErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	s.JSON(w, http.StatusOK, config)
+}
+
+// SetLink sets the conditions of the link between two nodes
+func (s *Server) SetLink(w http.ResponseWriter, req *http.Request) {
+	node := req.Context().Value("node").(*Node)
+	peer := req.Context().Value("peer").(*Node)
+
+	var config adapters.LinkConfig
+	if err := json.NewDecoder(req.Body).Decode(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.network.SetLink(node.ID(), peer.ID(), config); err != nil {
+		http.Error(w, err.Error(), linkErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	s.JSON(w, http.StatusOK, config)
+}
+
+// ResetLink makes the link between two nodes use the default conditions
+func (s *Server) ResetLink(w http.ResponseWriter, req *http.Request) {
+	node := req.Context().Value("node").(*Node)
+	peer := req.Context().Value("peer").(*Node)
+
+	if err := s.network.ResetLink(node.ID(), peer.ID()); err != nil {
+		http.Error(w, err.Error(), linkErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// CreatePartition creates a named partition between groups of nodes. The request
+// body is a list of groups, each group being a list of node names or IDs.
+func (s *Server) CreatePartition(w http.ResponseWriter, req *http.Request) {
+	name := req.Context().Value("name").(string)
+
+	var refs [][]string
+	if err := json.NewDecoder(req.Body).Decode(&refs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groups := make([][]enode.ID, len(refs))
+	for i := range refs {
+		ids, err := s.network.resolveNodeRefs(refs[i])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		groups[i] = ids
+	}
+
+	if err := s.network.Partition(name, groups); err != nil {
+		http.Error(w, err.Error(), linkErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// HealPartition removes a named partition
+func (s *Server) HealPartition(w http.ResponseWriter, req *http.Request) {
+	name := req.Context().Value("name").(string)
+
+	if err := s.network.Heal(name); err != nil {
+		http.Error(w, err.Error(), linkErrorStatus(err, http.StatusNotFound))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RunScenario runs a scenario, responding when all steps are done
+func (s *Server) RunScenario(w http.ResponseWriter, req *http.Request) {
+	var scenario Scenario
+	if err := json.NewDecoder(req.Body).Decode(&scenario); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.network.RunScenario(req.Context(), scenario); err != nil {
+		http.Error(w, err.Error(), linkErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// linkErrorStatus returns the HTTP status code of a failed link, partition or
+// scenario operation. Networks whose node adapter can't simulate links respond
+// with 501 Not Implemented.
+func linkErrorStatus(err error, status int) int {
+	if errors.Is(err, ErrNoLinkSimulation) {
+		return http.StatusNotImplemented
+	}
+	return status
+}
+
 // Options responds to the OPTIONS HTTP mavnod by returning a 200 OK response
 // with the "Access-Control-Allow-Headers" header set to "Content-Type"
 func (s *Server) Options(w http.ResponseWriter, req *http.Request) {
@@ -708,13 +877,7 @@ func (s *Server) wrapHandler(handler http.HandlerFunc) httprouter.Handle {
 		ctx := req.Context()
 
 		if id := params.ByName("nodeid"); id != "" {
-			var nodeID enode.ID
-			var node *Node
-			if nodeID.UnmarshalText([]byte(id)) == nil {
-				node = s.network.GetNode(nodeID)
-			} else {
-				node = s.network.GetNodeByName(id)
-			}
+			node := s.network.nodeByRef(id)
 			if node == nil {
 				http.NotFound(w, req)
 				return
@@ -723,13 +886,7 @@ func (s *Server) wrapHandler(handler http.HandlerFunc) httprouter.Handle {
 		}
 
 		if id := params.ByName("peerid"); id != "" {
-			var peerID enode.ID
-			var peer *Node
-			if peerID.UnmarshalText([]byte(id)) == nil {
-				peer = s.network.GetNode(peerID)
-			} else {
-				peer = s.network.GetNodeByName(id)
-			}
+			peer := s.network.nodeByRef(id)
 			if peer == nil {
 				http.NotFound(w, req)
 				return
@@ -737,6 +894,10 @@ func (s *Server) wrapHandler(handler http.HandlerFunc) httprouter.Handle {
 			ctx = context.WithValue(ctx, "peer", peer)
 		}
 
+		if name := params.ByName("name"); name != "" {
+			ctx = context.WithValue(ctx, "name", name)
+		}
+
 		handler(w, req.WithContext(ctx))
 	}
 }
@@ -0,0 +1,122 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulations
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/simulations/adapters"
+)
+
+var (
+	// ErrNoLinkSimulation is returned by the link and partition operations when
+	// the node adapter can't control the connections between nodes, i.e. when it
+	// doesn't implement adapters.LinkSimulator.
+	ErrNoLinkSimulation = errors.New("node adapter does not support link simulation")
+)
+
+func (net *Network) links() (*adapters.Links, error) {
+	ls, ok := net.nodeAdapter.(adapters.LinkSimulator)
+	if !ok {
+		return nil, fmt.Errorf("%w (using %s)", ErrNoLinkSimulation, net.nodeAdapter.Name())
+	}
+	return ls.Links(), nil
+}
+
+// checkNodes returns an error if any of the given nodes does not exist.
+func (net *Network) checkNodes(ids ...enode.ID) error {
+	net.lock.RLock()
+	defer net.lock.RUnlock()
+	for _, id := range ids {
+		if net.getNode(id) == nil {
+			return fmt.Errorf("node %v does not exist", id)
+		}
+	}
+	return nil
+}
+
+// LinkState returns the current configuration of all links.
+func (net *Network) LinkState() (*adapters.LinkState, error) {
+	links, err := net.links()
+	if err != nil {
+		return nil, err
+	}
+	return links.State(), nil
+}
+
+// SetDefaultLink sets the conditions of all links which are not
+// configured individually.
+func (net *Network) SetDefaultLink(cfg adapters.LinkConfig) error {
+	links, err := net.links()
+	if err != nil {
+		return err
+	}
+	return links.SetDefault(cfg)
+}
+
+// SetLink sets the conditions of the link between two nodes. Existing
+// connections between the nodes are closed when the link goes down.
+func (net *Network) SetLink(oneID, otherID enode.ID, cfg adapters.LinkConfig) error {
+	links, err := net.links()
+	if err != nil {
+		return err
+	}
+	if err := net.checkNodes(oneID, otherID); err != nil {
+		return err
+	}
+	return links.Set(oneID, otherID, cfg)
+}
+
+// ResetLink makes the link between two nodes use the default conditions.
+func (net *Network) ResetLink(oneID, otherID enode.ID) error {
+	links, err := net.links()
+	if err != nil {
+		return err
+	}
+	links.Reset(oneID, otherID)
+	return nil
+}
+
+// Partition splits the network into the given groups of nodes. Links between
+// nodes in different groups are down until the partition is healed. Nodes which
+// are not in any group are not affected.
+//
+// Multiple partitions can exist at the same time. They are identified by name.
+func (net *Network) Partition(name string, groups [][]enode.ID) error {
+	links, err := net.links()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err := net.checkNodes(group...); err != nil {
+			return err
+		}
+	}
+	return links.Partition(name, groups)
+}
+
+// Heal removes a partition. Nodes reconnect to their static peers
+// according to their usual dial schedule.
+func (net *Network) Heal(name string) error {
+	links, err := net.links()
+	if err != nil {
+		return err
+	}
+	return links.Heal(name)
+}
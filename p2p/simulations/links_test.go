@@ -0,0 +1,287 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/node"
+	"github.com/avalanria/go-avalanria/p2p"
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/simulations/adapters"
+)
+
+func newLinkTestNetwork(t *testing.T) (*Network, []*Node) {
+	adapter := adapters.NewSimAdapter(adapters.LifecycleConstructors{
+		"noopwoop": func(ctx *adapters.ServiceContext, stack *node.Node) (node.Lifecycle, error) {
+			return NewNoopService(nil), nil
+		},
+	})
+	network := NewNetwork(adapter, &NetworkConfig{DefaultService: "noopwoop"})
+	nodes, err := createTestNodes(3, network)
+	if err != nil {
+		network.Shutdown()
+		t.Fatal(err)
+	}
+	return network, nodes
+}
+
+// connUp reports whether two nodes are connected.
+func connUp(net *Network, one, other enode.ID) bool {
+	net.lock.RLock()
+	defer net.lock.RUnlock()
+	conn := net.getConn(one, other)
+	return conn != nil && conn.Up
+}
+
+// waitConn waits until the connection between two nodes has the wanted state.
+func waitConn(t *testing.T, net *Network, one, other enode.ID, up bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if connUp(net, one, other) == up {
+			return
+		}
+	}
+	t.Fatalf("connection %v-%v did not reach state up=%t", one.TerminalString(), other.TerminalString(), up)
+}
+
+func TestNetworkScenario(t *testing.T) {
+	network, nodes := newLinkTestNetwork(t)
+	defer network.Shutdown()
+	var (
+		id0, id1, id2       = nodes[0].ID(), nodes[1].ID(), nodes[2].ID()
+		name0, name1, name2 = nodes[0].Config.Name, nodes[1].Config.Name, nodes[2].Config.Name
+	)
+
+	var scenario Scenario
+	err := json.Unmarshal([]byte(`[
+		{"action": "link", "link": {"latency": "10ms"}},
+		{"action": "link", "nodes": ["`+name1+`", "`+name2+`"], "link": {"bandwidth": 1000000}},
+		{"action": "connect", "nodes": ["`+name0+`", "`+name1+`"]},
+		{"action": "connect", "nodes": ["`+name1+`", "`+name2+`"]}
+	]`), &scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := network.RunScenario(context.Background(), scenario); err != nil {
+		t.Fatal(err)
+	}
+	waitConn(t, network, id0, id1, true)
+	waitConn(t, network, id1, id2, true)
+
+	// Partitioning the network drops connections across the partition.
+	err = network.RunScenario(context.Background(), Scenario{
+		{Action: ScenarioPartition, Name: "split", Groups: [][]string{{name0}, {name1, name2}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitConn(t, network, id0, id1, false)
+	if !connUp(network, id1, id2) {
+		t.Fatal("connection inside partition group dropped")
+	}
+	if err := network.Connect(id0, id2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if connUp(network, id0, id2) {
+		t.Fatal("connection established across partition")
+	}
+
+	state, err := network.LinkState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Default.Latency != 10*time.Millisecond || len(state.Links) != 1 || len(state.Partitions) != 1 {
+		t.Fatalf("wrong link state: %+v", state)
+	}
+
+	// Invalid scenarios are rejected before any step runs.
+	err = network.RunScenario(context.Background(), Scenario{
+		{Action: ScenarioHeal, Name: "split"},
+		{Action: ScenarioConnect, Nodes: []string{name0, "unknown"}},
+	})
+	if err == nil {
+		t.Fatal("scenario with unknown node accepted")
+	}
+	if state, _ := network.LinkState(); len(state.Partitions) != 1 {
+		t.Fatal("partition healed by invalid scenario")
+	}
+	if err := network.Heal("split"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that the drop rules of a link discard whole protocol messages.
+func TestNetworkMsgDrop(t *testing.T) {
+	recv := make(chan uint64, 8)
+	adapter := adapters.NewSimAdapter(adapters.LifecycleConstructors{
+		"drop": func(ctx *adapters.ServiceContext, stack *node.Node) (node.Lifecycle, error) {
+			stack.RegisterProtocols([]p2p.Protocol{{
+				Name:    "drop",
+				Version: 1,
+				Length:  2,
+				Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+					// Send a droppable message ahead of one passing through
+					go func() {
+						p2p.Send(rw, 1, uint(1))
+						p2p.Send(rw, 0, uint(0))
+					}()
+					for {
+						msg, err := rw.ReadMsg()
+						if err != nil {
+							return err
+						}
+						recv <- msg.Code
+						msg.Discard()
+					}
+				},
+			}})
+			return NewNoopService(nil), nil
+		},
+	})
+	network := NewNetwork(adapter, &NetworkConfig{DefaultService: "drop"})
+	defer network.Shutdown()
+	nodes, err := createTestNodes(2, network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := adapters.LinkConfig{Drop: []adapters.MsgDrop{{Protocol: "drop", Codes: []uint64{1}, Rate: 1}}}
+	if err := network.SetLink(nodes[0].ID(), nodes[1].ID(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := network.Connect(nodes[0].ID(), nodes[1].ID()); err != nil {
+		t.Fatal(err)
+	}
+	// Messages arrive in order, so the dropped ones would come first.
+	for i := 0; i < 2; i++ {
+		select {
+		case code := <-recv:
+			if code != 0 {
+				t.Fatalf("received dropped message with code %d", code)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
+
+func TestHTTPLinks(t *testing.T) {
+	network, nodes := newLinkTestNetwork(t)
+	defer network.Shutdown()
+	s := httptest.NewServer(NewServer(network))
+	defer s.Close()
+	client := NewClient(s.URL)
+
+	var (
+		name0, name1 = nodes[0].Config.Name, nodes[1].Config.Name
+		cfg          = adapters.LinkConfig{Latency: 50 * time.Millisecond, Loss: 0.05}
+	)
+	if err := client.SetLink(name0, name1, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreatePartition("split", [][]string{{name0}, {nodes[2].ID().String()}}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := client.GetLinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Links) != 1 || !reflect.DeepEqual(state.Links[0].Config, cfg) {
+		t.Errorf("wrong links: %+v", state.Links)
+	}
+	if groups := state.Partitions["split"]; len(groups) != 2 || groups[1][0] != nodes[2].ID() {
+		t.Errorf("wrong partitions: %+v", state.Partitions)
+	}
+
+	if err := client.HealPartition("split"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.HealPartition("split"); err == nil {
+		t.Fatal("healing unknown partition succeeded")
+	}
+	if err := client.ResetLink(name0, name1); err != nil {
+		t.Fatal(err)
+	}
+	err = client.RunScenario(Scenario{{Action: ScenarioLink, Link: &cfg}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := client.GetLinks(); len(state.Links) != 0 || len(state.Partitions) != 0 || !reflect.DeepEqual(state.Default, cfg) {
+		t.Errorf("wrong final link state: %+v", state)
+	}
+}
+
+// noLinksAdapter is a node adapter which can't simulate links.
+type noLinksAdapter struct {
+	adapters.NodeAdapter
+}
+
+// Tests that the HTTP API reports link simulation as not implemented when the
+// node adapter doesn't support it.
+func TestHTTPLinksUnsupported(t *testing.T) {
+	adapter := noLinksAdapter{adapters.NewSimAdapter(nil)}
+	network := NewNetwork(adapter, &NetworkConfig{})
+	defer network.Shutdown()
+	s := httptest.NewServer(NewServer(network))
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/links")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotImplemented {
+		t.Errorf("wrong status code: have %d, want %d", res.StatusCode, http.StatusNotImplemented)
+	}
+	if _, err := network.LinkState(); !errors.Is(err, ErrNoLinkSimulation) {
+		t.Errorf("wrong error: have %v, want %v", err, ErrNoLinkSimulation)
+	}
+}
+
+// Tests that links of exec adapter networks can be configured.
+func TestExecAdapterLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2p-links-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	network := NewNetwork(adapters.NewExecAdapter(dir), &NetworkConfig{})
+	defer network.Shutdown()
+
+	cfg := adapters.LinkConfig{Latency: 100 * time.Millisecond}
+	if err := network.SetDefaultLink(cfg); err != nil {
+		t.Fatal(err)
+	}
+	state, err := network.LinkState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state.Default, cfg) {
+		t.Errorf("wrong default link: %+v", state.Default)
+	}
+}
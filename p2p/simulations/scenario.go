@@ -0,0 +1,235 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/avalanria/go-avalanria/p2p/enode"
+	"github.com/avalanria/go-avalanria/p2p/simulations/adapters"
+)
+
+// Scenario actions.
+const (
+	ScenarioStart      = "start"      // start nodes
+	ScenarioStop       = "stop"       // stop nodes
+	ScenarioConnect    = "connect"    // connect two nodes
+	ScenarioDisconnect = "disconnect" // disconnect two nodes
+	ScenarioLink       = "link"       // set conditions of the link between two nodes, or the default
+	ScenarioResetLink  = "reset-link" // make the link between two nodes use the default conditions
+	ScenarioPartition  = "partition"  // create a named partition
+	ScenarioHeal       = "heal"       // remove a named partition
+)
+
+// Scenario is a script of network changes which are applied one after another.
+// Scenarios are written as JSON, for example:
+//
+//     [
+//         {"action": "link", "link": {"latency": "50ms", "jitter": "10ms"}},
+//         {"action": "link", "nodes": ["node1", "node2"], "link": {"bandwidth": 100000, "loss": 0.01}},
+//         {"wait": "10s", "action": "partition", "name": "split", "groups": [["node1", "node2"], ["node3"]]},
+//         {"wait": "1m", "action": "heal", "name": "split"}
+//     ]
+//
+// Nodes are referenced by name or ID.
+type Scenario []ScenarioStep
+
+// ScenarioStep is a single step of a scenario. The action is performed after waiting
+// for the given time. Steps without an action only wait.
+type ScenarioStep struct {
+	Wait   time.Duration
+	Action string
+	Nodes  []string             // nodes of start, stop, connect, disconnect, link and reset-link
+	Name   string               // name of partition
+	Groups [][]string           // node groups of partition
+	Link   *adapters.LinkConfig // link conditions
+}
+
+type scenarioStepJSON struct {
+	Wait   string               `json:"wait,omitempty"`
+	Action string               `json:"action,omitempty"`
+	Nodes  []string             `json:"nodes,omitempty"`
+	Name   string               `json:"name,omitempty"`
+	Groups [][]string           `json:"groups,omitempty"`
+	Link   *adapters.LinkConfig `json:"link,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s ScenarioStep) MarshalJSON() ([]byte, error) {
+	enc := scenarioStepJSON{Action: s.Action, Nodes: s.Nodes, Name: s.Name, Groups: s.Groups, Link: s.Link}
+	if s.Wait != 0 {
+		enc.Wait = s.Wait.String()
+	}
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *ScenarioStep) UnmarshalJSON(input []byte) error {
+	var dec scenarioStepJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	step := ScenarioStep{Action: dec.Action, Nodes: dec.Nodes, Name: dec.Name, Groups: dec.Groups, Link: dec.Link}
+	if dec.Wait != "" {
+		wait, err := time.ParseDuration(dec.Wait)
+		if err != nil {
+			return fmt.Errorf("invalid wait: %v", err)
+		}
+		step.Wait = wait
+	}
+	*s = step
+	return nil
+}
+
+// scenarioOp is a scenario step with resolved node references.
+type scenarioOp struct {
+	ScenarioStep
+	nodes  []enode.ID
+	groups [][]enode.ID
+}
+
+// RunScenario applies the steps of a scenario in order. All steps are checked
+// before the first one runs. RunScenario returns when all steps are done, when
+// a step fails or when the context is canceled.
+func (net *Network) RunScenario(ctx context.Context, s Scenario) error {
+	ops := make([]scenarioOp, len(s))
+	for i, step := range s {
+		op, err := net.prepareScenarioStep(step)
+		if err != nil {
+			return fmt.Errorf("invalid scenario step %d: %v", i, err)
+		}
+		ops[i] = op
+	}
+	for i, op := range ops {
+		if op.Wait > 0 {
+			timer := time.NewTimer(op.Wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+		if err := net.runScenarioOp(op); err != nil {
+			return fmt.Errorf("scenario step %d (%s) failed: %w", i, op.Action, err)
+		}
+	}
+	return nil
+}
+
+func (net *Network) prepareScenarioStep(step ScenarioStep) (scenarioOp, error) {
+	op := scenarioOp{ScenarioStep: step}
+	if step.Wait < 0 {
+		return op, fmt.Errorf("negative wait")
+	}
+	var err error
+	if op.nodes, err = net.resolveNodeRefs(step.Nodes); err != nil {
+		return op, err
+	}
+	for _, group := range step.Groups {
+		ids, err := net.resolveNodeRefs(group)
+		if err != nil {
+			return op, err
+		}
+		op.groups = append(op.groups, ids)
+	}
+
+	switch step.Action {
+	case "":
+	case ScenarioStart, ScenarioStop:
+		if len(op.nodes) == 0 {
+			return op, fmt.Errorf("%s needs at least one node", step.Action)
+		}
+	case ScenarioConnect, ScenarioDisconnect, ScenarioResetLink:
+		if len(op.nodes) != 2 {
+			return op, fmt.Errorf("%s needs two nodes", step.Action)
+		}
+	case ScenarioLink:
+		if len(op.nodes) != 0 && len(op.nodes) != 2 {
+			return op, fmt.Errorf("%s needs two nodes or none", step.Action)
+		}
+		if step.Link == nil {
+			return op, fmt.Errorf("%s needs link conditions", step.Action)
+		}
+	case ScenarioPartition, ScenarioHeal:
+		if step.Name == "" {
+			return op, fmt.Errorf("%s needs a name", step.Action)
+		}
+	default:
+		return op, fmt.Errorf("unknown action %q", step.Action)
+	}
+	return op, nil
+}
+
+func (net *Network) runScenarioOp(op scenarioOp) error {
+	switch op.Action {
+	case ScenarioStart:
+		for _, id := range op.nodes {
+			if err := net.Start(id); err != nil {
+				return err
+			}
+		}
+	case ScenarioStop:
+		for _, id := range op.nodes {
+			if err := net.Stop(id); err != nil {
+				return err
+			}
+		}
+	case ScenarioConnect:
+		return net.Connect(op.nodes[0], op.nodes[1])
+	case ScenarioDisconnect:
+		return net.Disconnect(op.nodes[0], op.nodes[1])
+	case ScenarioLink:
+		if len(op.nodes) == 0 {
+			return net.SetDefaultLink(*op.Link)
+		}
+		return net.SetLink(op.nodes[0], op.nodes[1], *op.Link)
+	case ScenarioResetLink:
+		return net.ResetLink(op.nodes[0], op.nodes[1])
+	case ScenarioPartition:
+		return net.Partition(op.Name, op.groups)
+	case ScenarioHeal:
+		return net.Heal(op.Name)
+	}
+	return nil
+}
+
+// resolveNodeRefs returns the IDs of the given nodes, which may be
+// referenced by name or ID.
+func (net *Network) resolveNodeRefs(refs []string) ([]enode.ID, error) {
+	ids := make([]enode.ID, len(refs))
+	for i, ref := range refs {
+		node := net.nodeByRef(ref)
+		if node == nil {
+			return nil, fmt.Errorf("unknown node %q", ref)
+		}
+		ids[i] = node.ID()
+	}
+	return ids, nil
+}
+
+// nodeByRef returns the node with the given name or ID.
+func (net *Network) nodeByRef(ref string) *Node {
+	var id enode.ID
+	if id.UnmarshalText([]byte(ref)) == nil {
+		return net.GetNode(id)
+	}
+	return net.GetNodeByName(ref)
+}
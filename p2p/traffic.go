@@ -0,0 +1,263 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common/mclock"
+	"github.com/avalanria/go-avalanria/metrics"
+)
+
+// TrafficStats contains the amount of protocol messages exchanged with a peer.
+// Sizes are message payload sizes, excluding framing and compression.
+type TrafficStats struct {
+	IngressBytes   uint64 `json:"ingressBytes"`
+	IngressPackets uint64 `json:"ingressPackets"`
+	EgressBytes    uint64 `json:"egressBytes"`
+	EgressPackets  uint64 `json:"egressPackets"`
+}
+
+func (s *TrafficStats) add(size uint32, ingress bool) {
+	if ingress {
+		s.IngressBytes += uint64(size)
+		s.IngressPackets++
+	} else {
+		s.EgressBytes += uint64(size)
+		s.EgressPackets++
+	}
+}
+
+// PeerTraffic contains the protocol message traffic exchanged with a peer, both
+// in total and broken down by protocol and message code.
+type PeerTraffic struct {
+	TrafficStats
+	Protocols map[string]map[string]TrafficStats `json:"protocols"` // Keyed by protocol name/version and message code
+}
+
+// trafficCounter accounts the protocol message traffic of a single peer.
+type trafficCounter struct {
+	lock  sync.Mutex
+	total TrafficStats
+	codes map[trafficKey]*TrafficStats
+}
+
+// trafficKey identifies a message code of a protocol.
+type trafficKey struct {
+	proto string // Protocol name and version
+	code  uint64 // Message code relative to the protocol offset
+}
+
+func newTrafficCounter() *trafficCounter {
+	return &trafficCounter{codes: make(map[trafficKey]*TrafficStats)}
+}
+
+// add accounts a message sent or received on a protocol.
+func (c *trafficCounter) add(proto *protoRW, code uint64, size uint32, ingress bool) {
+	key := trafficKey{proto: fmt.Sprintf("%s/%d", proto.Name, proto.Version), code: code}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.total.add(size, ingress)
+	stats := c.codes[key]
+	if stats == nil {
+		stats = new(TrafficStats)
+		c.codes[key] = stats
+	}
+	stats.add(size, ingress)
+}
+
+// info returns a snapshot of the accounted traffic.
+func (c *trafficCounter) info() *PeerTraffic {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	info := &PeerTraffic{
+		TrafficStats: c.total,
+		Protocols:    make(map[string]map[string]TrafficStats),
+	}
+	for key, stats := range c.codes {
+		codes := info.Protocols[key.proto]
+		if codes == nil {
+			codes = make(map[string]TrafficStats)
+			info.Protocols[key.proto] = codes
+		}
+		codes[fmt.Sprintf("%#02x", key.code)] = *stats
+	}
+	return info
+}
+
+// uploadShaper limits the bandwidth used for sending protocol messages to all peers
+// together. Messages exceeding the limit are queued and released in weighted fair
+// order between the protocols (start-time fair queueing): a protocol may use all
+// the bandwidth while the others are idle, but a busy protocol such as snap serving
+// cannot starve the others, e.g. block propagation, of their share.
+type uploadShaper struct {
+	clock   mclock.Clock
+	rate    float64            // Bytes per second
+	burst   float64            // Bytes which may be sent at once after being idle
+	weights map[string]float64 // Bandwidth share of the protocols, 1 if unset
+
+	lock    sync.Mutex
+	tokens  float64            // Bytes which may be sent right now, negative if overdrawn
+	updated mclock.AbsTime     // Time of the last token refill
+	vtime   float64            // Virtual time, the start tag of the last released message
+	finish  map[string]float64 // Finish tag of the last message of each protocol
+	queue   shaperQueue        // Messages waiting for bandwidth, ordered by start tag
+	timer   mclock.Timer       // Timer releasing the queued messages, nil if none are queued
+}
+
+// shaperRequest is a message waiting for upload bandwidth.
+type shaperRequest struct {
+	start float64       // Start tag of the message in virtual time
+	size  float64       // Size of the message
+	done  chan struct{} // Closed when the message may be sent
+	index int           // Position in the queue, -1 once released
+}
+
+func newUploadShaper(clock mclock.Clock, rate uint64, weights map[string]uint) *uploadShaper {
+	s := &uploadShaper{
+		clock:   clock,
+		rate:    float64(rate),
+		burst:   float64(rate),
+		weights: make(map[string]float64),
+		tokens:  float64(rate),
+		updated: clock.Now(),
+		finish:  make(map[string]float64),
+	}
+	for proto, weight := range weights {
+		if weight > 0 {
+			s.weights[proto] = float64(weight)
+		}
+	}
+	return s
+}
+
+// wait blocks until a message of the given protocol and size may be sent, or the
+// closed channel is closed.
+func (s *uploadShaper) wait(proto string, size uint32, closed <-chan struct{}) error {
+	s.lock.Lock()
+	s.refill()
+
+	weight := s.weights[proto]
+	if weight == 0 {
+		weight = 1
+	}
+	start := math.Max(s.vtime, s.finish[proto])
+	s.finish[proto] = start + float64(size)/weight
+
+	if len(s.queue) == 0 && s.tokens >= 0 {
+		s.tokens -= float64(size)
+		s.vtime = start
+		s.lock.Unlock()
+		return nil
+	}
+	req := &shaperRequest{start: start, size: float64(size), done: make(chan struct{})}
+	heap.Push(&s.queue, req)
+	if s.timer == nil {
+		s.schedule()
+	}
+	s.lock.Unlock()
+
+	if metrics.Enabled {
+		metrics.GetOrRegisterMeter(fmt.Sprintf("%s/%s", shaperMeterName, proto), nil).Mark(int64(size))
+	}
+	queued := s.clock.Now()
+	select {
+	case <-req.done:
+		shaperDelayTimer.Update(time.Duration(s.clock.Now().Sub(queued)))
+		return nil
+	case <-closed:
+		s.lock.Lock()
+		if req.index >= 0 {
+			heap.Remove(&s.queue, req.index)
+		}
+		s.lock.Unlock()
+		return ErrShuttingDown
+	}
+}
+
+// refill adds the tokens accumulated since the last refill.
+func (s *uploadShaper) refill() {
+	now := s.clock.Now()
+	s.tokens += s.rate * float64(now.Sub(s.updated)) / float64(time.Second)
+	if s.tokens > s.burst {
+		s.tokens = s.burst
+	}
+	s.updated = now
+}
+
+// schedule arms the timer to release queued messages once the overdrawn tokens
+// are paid back.
+func (s *uploadShaper) schedule() {
+	var delay time.Duration
+	if s.tokens < 0 {
+		delay = time.Duration(math.Ceil(-s.tokens / s.rate * float64(time.Second)))
+	}
+	s.timer = s.clock.AfterFunc(delay, s.release)
+}
+
+// release sends out queued messages in the order of their start tags as long as
+// there are tokens available.
+func (s *uploadShaper) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.timer = nil
+	s.refill()
+	for len(s.queue) > 0 && s.tokens >= 0 {
+		req := heap.Pop(&s.queue).(*shaperRequest)
+		s.tokens -= req.size
+		s.vtime = req.start
+		close(req.done)
+	}
+	if len(s.queue) > 0 {
+		s.schedule()
+	}
+}
+
+// shaperQueue is a priority queue of messages waiting for upload bandwidth.
+type shaperQueue []*shaperRequest
+
+func (q shaperQueue) Len() int           { return len(q) }
+func (q shaperQueue) Less(i, j int) bool { return q[i].start < q[j].start }
+func (q shaperQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *shaperQueue) Push(x interface{}) {
+	req := x.(*shaperRequest)
+	req.index = len(*q)
+	*q = append(*q, req)
+}
+
+func (q *shaperQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	req := old[n-1]
+	old[n-1] = nil
+	req.index = -1
+	*q = old[:n-1]
+	return req
+}
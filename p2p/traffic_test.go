@@ -0,0 +1,153 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common/mclock"
+)
+
+// Tests that the upload shaper lets messages through immediately until the burst
+// is used up.
+func TestUploadShaperBurst(t *testing.T) {
+	var (
+		clock  = new(mclock.Simulated)
+		shaper = newUploadShaper(clock, 1000, nil)
+		closed = make(chan struct{})
+	)
+	defer close(closed)
+
+	// The last message overdraws the burst.
+	for i := 0; i < 4; i++ {
+		if err := shaper.wait("a", 300, closed); err != nil {
+			t.Fatalf("burst message %d: %v", i, err)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		shaper.wait("a", 300, closed)
+		close(done)
+	}()
+	clock.WaitForTimers(1)
+	select {
+	case <-done:
+		t.Fatal("message sent beyond the burst")
+	default:
+	}
+	// The overdraft is paid back after 200ms.
+	clock.Run(199 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("message sent before the overdraft was paid back")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Run(time.Millisecond)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("message not sent after the overdraft was paid back")
+	}
+}
+
+// Tests that the upload shaper shares the bandwidth between backlogged protocols
+// according to their weights.
+func TestUploadShaperWeights(t *testing.T) {
+	var (
+		clock   = new(mclock.Simulated)
+		shaper  = newUploadShaper(clock, 1000, map[string]uint{"a": 3, "b": 1})
+		closed  = make(chan struct{})
+		results = make(chan string, 16)
+	)
+	defer close(closed)
+
+	// Start out with no bandwidth left.
+	shaper.tokens = -1
+
+	// Queue up messages of both protocols, the busy one first.
+	enqueue := func(proto string) {
+		shaper.lock.Lock()
+		queued := len(shaper.queue)
+		shaper.lock.Unlock()
+
+		go func() {
+			if err := shaper.wait(proto, 300, closed); err == nil {
+				results <- proto
+			}
+		}()
+		for {
+			shaper.lock.Lock()
+			n := len(shaper.queue)
+			shaper.lock.Unlock()
+			if n > queued {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		enqueue("b")
+	}
+	for i := 0; i < 8; i++ {
+		enqueue("a")
+	}
+	// Every step refills the tokens for a single message.
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		clock.Run(300 * time.Millisecond)
+		select {
+		case proto := <-results:
+			counts[proto]++
+		case <-time.After(time.Second):
+			t.Fatalf("message %d not released", i)
+		}
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Fatalf("wrong bandwidth share: a=%d b=%d, want a=6 b=2", counts["a"], counts["b"])
+	}
+	select {
+	case proto := <-results:
+		t.Fatalf("message of %s released without bandwidth", proto)
+	default:
+	}
+}
+
+// Tests that waiting for bandwidth is aborted when the peer shuts down.
+func TestUploadShaperClose(t *testing.T) {
+	var (
+		clock  = new(mclock.Simulated)
+		shaper = newUploadShaper(clock, 1000, nil)
+		closed = make(chan struct{})
+	)
+	if err := shaper.wait("a", 2000, closed); err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error)
+	go func() { errc <- shaper.wait("a", 100, closed) }()
+	clock.WaitForTimers(1)
+	close(closed)
+
+	if err := <-errc; err != ErrShuttingDown {
+		t.Fatalf("wrong error: have %v, want %v", err, ErrShuttingDown)
+	}
+	if len(shaper.queue) != 0 {
+		t.Fatalf("aborted message still queued")
+	}
+	// Releasing the queue afterwards must not block on the aborted message.
+	clock.Run(2 * time.Second)
+}
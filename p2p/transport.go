@@ -51,6 +51,19 @@ type rlpxTransport struct {
 	conn     *rlpx.Conn
 }
 
+// newTransport creates the transport of a connection. Connections carrying a
+// QUIC session use the QUIC transport, all others use RLPx.
+func newTransport(fd net.Conn, dialDest *ecdsa.PublicKey) transport {
+	conn := fd
+	if mc, ok := conn.(*meteredConn); ok {
+		conn = mc.Conn
+	}
+	if qc, ok := conn.(*quicConn); ok {
+		return newQUIC(fd, qc, dialDest)
+	}
+	return newRLPX(fd, dialDest)
+}
+
 func newRLPX(conn net.Conn, dialDest *ecdsa.PublicKey) transport {
 	return &rlpxTransport{conn: rlpx.NewConn(conn, dialDest)}
 }
@@ -95,14 +108,18 @@ func (t *rlpxTransport) WriteMsg(msg Msg) error {
 		return err
 	}
 
-	// Set metrics.
 	msg.meterSize = size
+	meterEgress(msg)
+	return nil
+}
+
+// meterEgress updates the egress metrics of a sent message.
+func meterEgress(msg Msg) {
 	if metrics.Enabled && msg.meterCap.Name != "" { // don't meter non-subprotocol messages
 		m := fmt.Sprintf("%s/%s/%d/%#02x", egressMeterName, msg.meterCap.Name, msg.meterCap.Version, msg.meterCode)
 		metrics.GetOrRegisterMeter(m, nil).Mark(int64(msg.meterSize))
 		metrics.GetOrRegisterMeter(m+"/packets", nil).Mark(1)
 	}
-	return nil
 }
 
 func (t *rlpxTransport) close(err error) {
@@ -17,6 +17,8 @@
 package p2p
 
 import (
+	"context"
+	"crypto/ecdsa"
 	"errors"
 	"reflect"
 	"sync"
@@ -25,9 +27,63 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/avalanria/go-avalanria/crypto"
 	"github.com/avalanria/go-avalanria/p2p/simulations/pipes"
+	"github.com/avalanria/go-avalanria/rlp"
 )
 
+// transportPipe creates both ends of a connection. The dial function creates the
+// transport of the dialer, accept the one of the listener.
+type transportPipe func(t *testing.T) (dial func(dest *ecdsa.PublicKey) (transport, error), accept func() (transport, error))
+
+func rlpxPipe(t *testing.T) (func(*ecdsa.PublicKey) (transport, error), func() (transport, error)) {
+	fd0, fd1, err := pipes.TCPPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func(dest *ecdsa.PublicKey) (transport, error) { return newTransport(fd0, dest), nil }
+	accept := func() (transport, error) { return newTransport(fd1, nil), nil }
+	return dial, accept
+}
+
+func quicPipe(t *testing.T) (func(*ecdsa.PublicKey) (transport, error), func() (transport, error)) {
+	config, err := newQUICConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := listenQUIC("127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	dial := func(dest *ecdsa.PublicKey) (transport, error) {
+		fd, err := dialQUIC(context.Background(), listener.Addr(), config)
+		if err != nil {
+			return nil, err
+		}
+		return newTransport(fd, dest), nil
+	}
+	accept := func() (transport, error) {
+		fd, err := listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		return newTransport(fd, nil), nil
+	}
+	return dial, accept
+}
+
+var transportPipes = map[string]transportPipe{
+	"rlpx": rlpxPipe,
+	"quic": quicPipe,
+}
+
 func TestProtocolHandshake(t *testing.T) {
+	for name, pipe := range transportPipes {
+		t.Run(name, func(t *testing.T) { testProtocolHandshake(t, pipe) })
+	}
+}
+
+func testProtocolHandshake(t *testing.T, pipe transportPipe) {
 	var (
 		prv0, _ = crypto.GenerateKey()
 		pub0    = crypto.FromECDSAPub(&prv0.PublicKey)[1:]
@@ -40,42 +96,50 @@ func TestProtocolHandshake(t *testing.T) {
 		wg sync.WaitGroup
 	)
 
-	fd0, fd1, err := pipes.TCPPipe()
-	if err != nil {
-		t.Fatal(err)
-	}
+	dial, accept := pipe(t)
 
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		defer fd0.Close()
-		frame := newRLPX(fd0, &prv1.PublicKey)
+		frame, err := dial(&prv1.PublicKey)
+		if err != nil {
+			t.Errorf("dial failed: %v", err)
+			return
+		}
 		rpubkey, err := frame.doEncHandshake(prv0)
 		if err != nil {
 			t.Errorf("dial side enc handshake failed: %v", err)
+			frame.close(err)
 			return
 		}
 		if !reflect.DeepEqual(rpubkey, &prv1.PublicKey) {
 			t.Errorf("dial side remote pubkey mismatch: got %v, want %v", rpubkey, &prv1.PublicKey)
+			frame.close(DiscUnexpectedIdentity)
 			return
 		}
 
 		phs, err := frame.doProtoHandshake(hs0)
 		if err != nil {
 			t.Errorf("dial side proto handshake error: %v", err)
+			frame.close(err)
 			return
 		}
 		phs.Rest = nil
 		if !reflect.DeepEqual(phs, hs1) {
 			t.Errorf("dial side proto handshake mismatch:\ngot: %s\nwant: %s\n", spew.Sdump(phs), spew.Sdump(hs1))
+			frame.close(DiscProtocolError)
 			return
 		}
 		frame.close(DiscQuitting)
 	}()
 	go func() {
 		defer wg.Done()
-		defer fd1.Close()
-		rlpx := newRLPX(fd1, nil)
+		rlpx, err := accept()
+		if err != nil {
+			t.Errorf("accept failed: %v", err)
+			return
+		}
+		defer rlpx.close(DiscNetworkError)
 		rpubkey, err := rlpx.doEncHandshake(prv1)
 		if err != nil {
 			t.Errorf("listen side enc handshake failed: %v", err)
@@ -146,3 +210,102 @@ func TestProtocolHandshakeErrors(t *testing.T) {
 		}
 	}
 }
+
+// quicHandshake runs both handshakes on the ends of a QUIC pipe.
+func quicHandshake(t *testing.T, prv0, prv1 *ecdsa.PrivateKey) (dialer, listener transport) {
+	dial, accept := quicPipe(t)
+
+	errc := make(chan error, 1)
+	go func() {
+		var err error
+		if listener, err = accept(); err == nil {
+			if _, err = listener.doEncHandshake(prv1); err == nil {
+				_, err = listener.doProtoHandshake(&protoHandshake{Version: baseProtocolVersion, ID: crypto.FromECDSAPub(&prv1.PublicKey)[1:]})
+			}
+		}
+		errc <- err
+	}()
+	dialer, err := dial(&prv1.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dialer.doEncHandshake(prv0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dialer.doProtoHandshake(&protoHandshake{Version: baseProtocolVersion, ID: crypto.FromECDSAPub(&prv0.PublicKey)[1:]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	return dialer, listener
+}
+
+func TestQUICProtocolStreams(t *testing.T) {
+	prv0, _ := crypto.GenerateKey()
+	prv1, _ := crypto.GenerateKey()
+	dialer, listener := quicHandshake(t, prv0, prv1)
+	defer dialer.close(DiscNetworkError)
+	defer listener.close(DiscNetworkError)
+
+	// Send messages of the base protocol and of two subprotocols.
+	protos := map[uint64]string{pingMsg: "", 16: "a", 32: "b"}
+	for i := uint(0); i < 10; i++ {
+		for code, proto := range protos {
+			size, r, err := rlp.EncodeToReader(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := Msg{Code: code, Size: uint32(size), Payload: r, meterCap: Cap{proto, 1}}
+			if err := dialer.WriteMsg(msg); err != nil {
+				t.Fatalf("write error: %v", err)
+			}
+		}
+	}
+	if n := len(dialer.(*quicTransport).streams); n != len(protos) {
+		t.Errorf("wrong number of streams: got %d, want %d", n, len(protos))
+	}
+
+	// Messages of different protocols may be reordered, but every protocol
+	// must receive its own messages in order.
+	next := make(map[uint64]uint)
+	for i := 0; i < 10*len(protos); i++ {
+		msg, err := listener.ReadMsg()
+		if err != nil {
+			t.Fatalf("read error: %v", err)
+		}
+		var n uint
+		if err := msg.Decode(&n); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if n != next[msg.Code] {
+			t.Fatalf("message %d of code %d out of order, want %d", n, msg.Code, next[msg.Code])
+		}
+		next[msg.Code]++
+	}
+}
+
+func TestQUICUnexpectedIdentity(t *testing.T) {
+	var (
+		prv0, _  = crypto.GenerateKey()
+		prv1, _  = crypto.GenerateKey()
+		other, _ = crypto.GenerateKey()
+	)
+	dial, accept := quicPipe(t)
+
+	go func() {
+		if listener, err := accept(); err == nil {
+			listener.doEncHandshake(prv1)
+			listener.ReadMsg() // wait for the dialer to give up
+			listener.close(DiscNetworkError)
+		}
+	}()
+	dialer, err := dial(&other.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.close(DiscNetworkError)
+	if _, err := dialer.doEncHandshake(prv0); err != DiscUnexpectedIdentity {
+		t.Fatalf("wrong error: got %v, want %v", err, DiscUnexpectedIdentity)
+	}
+}
@@ -247,17 +247,17 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, new(EthashConfig), nil, nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Avalanria core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
-	TestRules       = TestChainConfig.Rules(new(big.Int))
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, new(EthashConfig), nil, nil}
+	TestRules       = TestChainConfig.Rules(new(big.Int), 0)
 )
 
 // TrustedCheckpoint represents a set of post-processed trie roots (CHT and
@@ -338,9 +338,31 @@ type ChainConfig struct {
 
 	CatalystBlock *big.Int `json:"catalystBlock,omitempty"` // Catalyst switch block (nil = no fork, 0 = already on catalyst)
 
+	// Fork scheduling by block timestamp, mutually exclusive with the block based switches
+	BerlinTime *uint64 `json:"berlinTime,omitempty"` // Berlin switch time (nil = no fork by time, 0 = already on berlin)
+	LondonTime *uint64 `json:"londonTime,omitempty"` // London switch time (nil = no fork by time, 0 = already on london)
+
+	// Economic parameter overrides, each entry activated at its fork block
+	BlockRewards      []BlockRewardFork      `json:"blockRewards,omitempty"`      // Proof-of-work block reward schedule (empty = protocol defaults)
+	BaseFeeRecipients []BaseFeeRecipientFork `json:"baseFeeRecipients,omitempty"` // EIP-1559 base fee recipient schedule (empty = burned)
+
 	// Various consensus engines
 	Ethash *EthashConfig `json:"avnash,omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty"`
+	IBFT   *IBFTConfig   `json:"ibft,omitempty"`
+}
+
+// BlockRewardFork overrides the proof-of-work block reward from a given block on.
+type BlockRewardFork struct {
+	Block  *big.Int `json:"block"`  // Block number the reward is activated at
+	Reward *big.Int `json:"reward"` // Block reward in wei for successfully mining a block
+}
+
+// BaseFeeRecipientFork overrides the destination of the EIP-1559 base fee from a
+// given block on.
+type BaseFeeRecipientFork struct {
+	Block     *big.Int        `json:"block"`               // Block number the recipient is activated at
+	Recipient *common.Address `json:"recipient,omitempty"` // Account credited with the base fee (nil = burned)
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
@@ -355,6 +377,11 @@ func (c *EthashConfig) String() string {
 type CliqueConfig struct {
 	Period uint64 `json:"period"` // Number of seconds between blocks to enforce
 	Epoch  uint64 `json:"epoch"`  // Epoch length to reset votes and checkpoint
+
+	// SignerContract is the address of an optional governance contract holding
+	// the authorized signer list. If set, signer membership is read from its
+	// storage at every epoch checkpoint instead of being voted on in headers.
+	SignerContract *common.Address `json:"signerContract,omitempty"`
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -362,6 +389,19 @@ func (c *CliqueConfig) String() string {
 	return "clique"
 }
 
+// IBFTConfig is the consensus engine configs for Istanbul byzantine fault tolerant
+// sealing with instant finality.
+type IBFTConfig struct {
+	Period         uint64 `json:"period"`         // Minimum number of seconds between blocks to enforce
+	Epoch          uint64 `json:"epoch"`          // Epoch length to reset votes and checkpoint
+	RequestTimeout uint64 `json:"requestTimeout"` // Timeout of the first consensus round in milliseconds
+}
+
+// String implements the stringer interface, returning the consensus engine details.
+func (c *IBFTConfig) String() string {
+	return "ibft"
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
@@ -370,10 +410,12 @@ func (c *ChainConfig) String() string {
 		engine = c.Ethash
 	case c.Clique != nil:
 		engine = c.Clique
+	case c.IBFT != nil:
+		engine = c.IBFT
 	default:
 		engine = "unknown"
 	}
-	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v, Muir Glacier: %v, Berlin: %v, London: %v, Engine: %v}",
+	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v, Muir Glacier: %v, Berlin: %v, London: %v, Berlin time: %v, London time: %v, Engine: %v}",
 		c.ChainID,
 		c.HomesteadBlock,
 		c.DAOForkBlock,
@@ -388,6 +430,8 @@ func (c *ChainConfig) String() string {
 		c.MuirGlacierBlock,
 		c.BerlinBlock,
 		c.LondonBlock,
+		timestampString(c.BerlinTime),
+		timestampString(c.LondonTime),
 		engine,
 	)
 }
@@ -444,14 +488,16 @@ func (c *ChainConfig) IsIstanbul(num *big.Int) bool {
 	return isForked(c.IstanbulBlock, num)
 }
 
-// IsBerlin returns whavner num is either equal to the Berlin fork block or greater.
-func (c *ChainConfig) IsBerlin(num *big.Int) bool {
-	return isForked(c.BerlinBlock, num)
+// IsBerlin returns whavner num is either equal to the Berlin fork block or greater,
+// or time is either equal to the Berlin fork time or greater.
+func (c *ChainConfig) IsBerlin(num *big.Int, time uint64) bool {
+	return isForked(c.BerlinBlock, num) || isTimestampForked(c.BerlinTime, time)
 }
 
-// IsLondon returns whavner num is either equal to the London fork block or greater.
-func (c *ChainConfig) IsLondon(num *big.Int) bool {
-	return isForked(c.LondonBlock, num)
+// IsLondon returns whavner num is either equal to the London fork block or greater,
+// or time is either equal to the London fork time or greater.
+func (c *ChainConfig) IsLondon(num *big.Int, time uint64) bool {
+	return isForked(c.LondonBlock, num) || isTimestampForked(c.LondonTime, time)
 }
 
 // IsCatalyst returns whavner num is either equal to the Merge fork block or greater.
@@ -459,20 +505,51 @@ func (c *ChainConfig) IsCatalyst(num *big.Int) bool {
 	return isForked(c.CatalystBlock, num)
 }
 
+// BlockReward returns the block reward override active at the given block, or
+// nil if the protocol defaults apply.
+func (c *ChainConfig) BlockReward(num *big.Int) *big.Int {
+	var reward *big.Int
+	for _, fork := range c.BlockRewards {
+		if isForked(fork.Block, num) {
+			reward = fork.Reward
+		}
+	}
+	return reward
+}
+
+// BaseFeeRecipient returns the account credited with the EIP-1559 base fee at
+// the given block, or nil if it's burned.
+func (c *ChainConfig) BaseFeeRecipient(num *big.Int) *common.Address {
+	var recipient *common.Address
+	for _, fork := range c.BaseFeeRecipients {
+		if isForked(fork.Block, num) {
+			recipient = fork.Recipient
+		}
+	}
+	return recipient
+}
+
 // CheckCompatible checks whavner scheduled fork transitions have been imported
 // with a mismatching chain configuration.
-func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *ConfigCompatError {
-	bhead := new(big.Int).SetUint64(height)
-
+func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64, time uint64) *ConfigCompatError {
+	var (
+		bhead = new(big.Int).SetUint64(height)
+		btime = time
+	)
 	// Iterate checkCompatible to find the lowest conflict.
 	var lasterr *ConfigCompatError
 	for {
-		err := c.checkCompatible(newcfg, bhead)
-		if err == nil || (lasterr != nil && err.RewindTo == lasterr.RewindTo) {
+		err := c.checkCompatible(newcfg, bhead, btime)
+		if err == nil || (lasterr != nil && err.RewindTo == lasterr.RewindTo && err.RewindToTime == lasterr.RewindToTime) {
 			break
 		}
 		lasterr = err
-		bhead.SetUint64(err.RewindTo)
+
+		if err.RewindToTime > 0 {
+			btime = err.RewindToTime
+		} else {
+			bhead.SetUint64(err.RewindTo)
+		}
 	}
 	return lasterr
 }
@@ -481,9 +558,10 @@ func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *Confi
 // to guarantee that forks can be implemented in a different order than on official networks
 func (c *ChainConfig) CheckConfigForkOrder() error {
 	type fork struct {
-		name     string
-		block    *big.Int
-		optional bool // if true, the fork may be nil and next fork is still allowed
+		name      string
+		block     *big.Int // forks up to and including London are block based
+		timestamp *uint64  // forks from Berlin onwards may be scheduled by time instead
+		optional  bool     // if true, the fork may be nil and next fork is still allowed
 	}
 	var lastFork fork
 	for _, cur := range []fork{
@@ -497,31 +575,72 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 		{name: "petersburgBlock", block: c.PetersburgBlock},
 		{name: "istanbulBlock", block: c.IstanbulBlock},
 		{name: "muirGlacierBlock", block: c.MuirGlacierBlock, optional: true},
-		{name: "berlinBlock", block: c.BerlinBlock},
-		{name: "londonBlock", block: c.LondonBlock},
+		{name: "berlin", block: c.BerlinBlock, timestamp: c.BerlinTime},
+		{name: "london", block: c.LondonBlock, timestamp: c.LondonTime},
 	} {
+		if cur.block != nil && cur.timestamp != nil {
+			return fmt.Errorf("unsupported fork scheduling: %v enabled both at block %v and at timestamp %v",
+				cur.name, cur.block, *cur.timestamp)
+		}
 		if lastFork.name != "" {
+			switch {
+			// Next one must be enabled if the previous one was not
+			case lastFork.block == nil && lastFork.timestamp == nil && (cur.block != nil || cur.timestamp != nil):
+				if cur.block != nil {
+					return fmt.Errorf("unsupported fork ordering: %v not enabled, but %v enabled at block %v",
+						lastFork.name, cur.name, cur.block)
+				}
+				return fmt.Errorf("unsupported fork ordering: %v not enabled, but %v enabled at timestamp %v",
+					lastFork.name, cur.name, *cur.timestamp)
+
 			// Next one must be higher number
-			if lastFork.block == nil && cur.block != nil {
-				return fmt.Errorf("unsupported fork ordering: %v not enabled, but %v enabled at %v",
-					lastFork.name, cur.name, cur.block)
-			}
-			if lastFork.block != nil && cur.block != nil {
+			case lastFork.block != nil && cur.block != nil:
 				if lastFork.block.Cmp(cur.block) > 0 {
-					return fmt.Errorf("unsupported fork ordering: %v enabled at %v, but %v enabled at %v",
+					return fmt.Errorf("unsupported fork ordering: %v enabled at block %v, but %v enabled at block %v",
 						lastFork.name, lastFork.block, cur.name, cur.block)
 				}
+			// Next one must be later in time
+			case lastFork.timestamp != nil && cur.timestamp != nil:
+				if *lastFork.timestamp > *cur.timestamp {
+					return fmt.Errorf("unsupported fork ordering: %v enabled at timestamp %v, but %v enabled at timestamp %v",
+						lastFork.name, *lastFork.timestamp, cur.name, *cur.timestamp)
+				}
+			// Timestamp based forks may follow block based ones, but not the other way around
+			case lastFork.timestamp != nil && cur.block != nil:
+				return fmt.Errorf("unsupported fork ordering: %v enabled at timestamp %v, but %v enabled at block %v",
+					lastFork.name, *lastFork.timestamp, cur.name, cur.block)
 			}
 		}
 		// If it was optional and not set, then ignore it
-		if !cur.optional || cur.block != nil {
+		if !cur.optional || cur.block != nil || cur.timestamp != nil {
 			lastFork = cur
 		}
 	}
+	// Ensure the economic parameter schedules are well formed
+	var last *big.Int
+	for i, fork := range c.BlockRewards {
+		if fork.Block == nil || fork.Reward == nil || fork.Reward.Sign() < 0 {
+			return fmt.Errorf("invalid block reward schedule: entry %d incomplete or negative", i)
+		}
+		if last != nil && last.Cmp(fork.Block) >= 0 {
+			return fmt.Errorf("unsupported block reward ordering: %v scheduled after %v", fork.Block, last)
+		}
+		last = fork.Block
+	}
+	last = nil
+	for i, fork := range c.BaseFeeRecipients {
+		if fork.Block == nil {
+			return fmt.Errorf("invalid base fee recipient schedule: entry %d missing block", i)
+		}
+		if last != nil && last.Cmp(fork.Block) >= 0 {
+			return fmt.Errorf("unsupported base fee recipient ordering: %v scheduled after %v", fork.Block, last)
+		}
+		last = fork.Block
+	}
 	return nil
 }
 
-func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *ConfigCompatError {
+func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int, time uint64) *ConfigCompatError {
 	if isForkIncompatible(c.HomesteadBlock, newcfg.HomesteadBlock, head) {
 		return newCompatError("Homestead fork block", c.HomesteadBlock, newcfg.HomesteadBlock)
 	}
@@ -568,9 +687,101 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.LondonBlock, newcfg.LondonBlock, head) {
 		return newCompatError("London fork block", c.LondonBlock, newcfg.LondonBlock)
 	}
+	if isTimestampForkIncompatible(c.BerlinTime, newcfg.BerlinTime, time) {
+		return newTimestampCompatError("Berlin fork timestamp", c.BerlinTime, newcfg.BerlinTime)
+	}
+	if isTimestampForkIncompatible(c.LondonTime, newcfg.LondonTime, time) {
+		return newTimestampCompatError("London fork timestamp", c.LondonTime, newcfg.LondonTime)
+	}
+	if fork, storedblock, newblock := c.rewardScheduleMismatch(newcfg); isForked(fork, head) {
+		return newScheduleCompatError("block reward schedule", fork, storedblock, newblock)
+	}
+	if fork, storedblock, newblock := c.recipientScheduleMismatch(newcfg); isForked(fork, head) {
+		return newScheduleCompatError("base fee recipient schedule", fork, storedblock, newblock)
+	}
 	return nil
 }
 
+// rewardScheduleMismatch returns the first block at which the block rewards of
+// two configurations differ, or nil if they are equivalent, along with the blocks
+// of the first schedule entries differing between them.
+func (c *ChainConfig) rewardScheduleMismatch(newcfg *ChainConfig) (*big.Int, *big.Int, *big.Int) {
+	var forks []*big.Int
+	for _, fork := range c.BlockRewards {
+		forks = append(forks, fork.Block)
+	}
+	for _, fork := range newcfg.BlockRewards {
+		forks = append(forks, fork.Block)
+	}
+	mismatch := firstMismatch(forks, func(num *big.Int) bool {
+		return configNumEqual(c.BlockReward(num), newcfg.BlockReward(num))
+	})
+	if mismatch == nil {
+		return nil, nil, nil
+	}
+	for i := 0; i < len(c.BlockRewards) || i < len(newcfg.BlockRewards); i++ {
+		var stored, updated BlockRewardFork
+		if i < len(c.BlockRewards) {
+			stored = c.BlockRewards[i]
+		}
+		if i < len(newcfg.BlockRewards) {
+			updated = newcfg.BlockRewards[i]
+		}
+		if !configNumEqual(stored.Block, updated.Block) || !configNumEqual(stored.Reward, updated.Reward) {
+			return mismatch, stored.Block, updated.Block
+		}
+	}
+	return mismatch, nil, nil
+}
+
+// recipientScheduleMismatch returns the first block at which the base fee
+// recipients of two configurations differ, or nil if they are equivalent, along
+// with the blocks of the first schedule entries differing between them.
+func (c *ChainConfig) recipientScheduleMismatch(newcfg *ChainConfig) (*big.Int, *big.Int, *big.Int) {
+	var forks []*big.Int
+	for _, fork := range c.BaseFeeRecipients {
+		forks = append(forks, fork.Block)
+	}
+	for _, fork := range newcfg.BaseFeeRecipients {
+		forks = append(forks, fork.Block)
+	}
+	mismatch := firstMismatch(forks, func(num *big.Int) bool {
+		return configAddressEqual(c.BaseFeeRecipient(num), newcfg.BaseFeeRecipient(num))
+	})
+	if mismatch == nil {
+		return nil, nil, nil
+	}
+	for i := 0; i < len(c.BaseFeeRecipients) || i < len(newcfg.BaseFeeRecipients); i++ {
+		var stored, updated BaseFeeRecipientFork
+		if i < len(c.BaseFeeRecipients) {
+			stored = c.BaseFeeRecipients[i]
+		}
+		if i < len(newcfg.BaseFeeRecipients) {
+			updated = newcfg.BaseFeeRecipients[i]
+		}
+		if !configNumEqual(stored.Block, updated.Block) || !configAddressEqual(stored.Recipient, updated.Recipient) {
+			return mismatch, stored.Block, updated.Block
+		}
+	}
+	return mismatch, nil, nil
+}
+
+// firstMismatch returns the lowest of the given transition blocks at which two
+// schedules differ, or nil if they agree on all of them. As schedules only change
+// at their transition blocks, checking those is enough to compare them.
+func firstMismatch(forks []*big.Int, equal func(num *big.Int) bool) *big.Int {
+	var first *big.Int
+	for _, fork := range forks {
+		if fork == nil || equal(fork) {
+			continue
+		}
+		if first == nil || fork.Cmp(first) < 0 {
+			first = fork
+		}
+	}
+	return first
+}
+
 // isForkIncompatible returns true if a fork scheduled at s1 cannot be rescheduled to
 // block s2 because head is already past the fork.
 func isForkIncompatible(s1, s2, head *big.Int) bool {
@@ -585,6 +796,21 @@ func isForked(s, head *big.Int) bool {
 	return s.Cmp(head) <= 0
 }
 
+// isTimestampForkIncompatible returns true if a fork scheduled at timestamp s1
+// cannot be rescheduled to timestamp s2 because head is already past the fork.
+func isTimestampForkIncompatible(s1, s2 *uint64, head uint64) bool {
+	return (isTimestampForked(s1, head) || isTimestampForked(s2, head)) && !configTimestampEqual(s1, s2)
+}
+
+// isTimestampForked returns whavner a fork scheduled at timestamp s is active
+// at the given head timestamp.
+func isTimestampForked(s *uint64, head uint64) bool {
+	if s == nil {
+		return false
+	}
+	return *s <= head
+}
+
 func configNumEqual(x, y *big.Int) bool {
 	if x == nil {
 		return y == nil
@@ -595,14 +821,35 @@ func configNumEqual(x, y *big.Int) bool {
 	return x.Cmp(y) == 0
 }
 
+func configAddressEqual(x, y *common.Address) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return *x == *y
+}
+
+func configTimestampEqual(x, y *uint64) bool {
+	if x == nil {
+		return y == nil
+	}
+	if y == nil {
+		return x == nil
+	}
+	return *x == *y
+}
+
 // ConfigCompatError is raised if the locally-stored blockchain is initialised with a
 // ChainConfig that would alter the past.
 type ConfigCompatError struct {
 	What string
-	// block numbers of the stored and new configurations
+	// block numbers of the stored and new configurations if block based forking
 	StoredConfig, NewConfig *big.Int
+	// timestamps of the stored and new configurations if time based forking
+	StoredTime, NewTime *uint64
 	// the block number to which the local chain must be rewound to correct the error
 	RewindTo uint64
+	// the timestamp to which the local chain must be rewound to correct the error
+	RewindToTime uint64
 }
 
 func newCompatError(what string, storedblock, newblock *big.Int) *ConfigCompatError {
@@ -615,17 +862,60 @@ func newCompatError(what string, storedblock, newblock *big.Int) *ConfigCompatEr
 	default:
 		rew = newblock
 	}
-	err := &ConfigCompatError{what, storedblock, newblock, 0}
+	err := &ConfigCompatError{What: what, StoredConfig: storedblock, NewConfig: newblock}
 	if rew != nil && rew.Sign() > 0 {
 		err.RewindTo = rew.Uint64() - 1
 	}
 	return err
 }
 
+// newScheduleCompatError creates a compatibility error for a schedule of chain
+// parameters diverging at the given block, reporting the blocks of the first
+// differing entries. If the entries only differ in their values, they are named
+// by their shared block.
+func newScheduleCompatError(what string, mismatch, storedblock, newblock *big.Int) *ConfigCompatError {
+	if configNumEqual(storedblock, newblock) {
+		what = fmt.Sprintf("%s entry at block %d", what, storedblock)
+	}
+	err := &ConfigCompatError{What: what, StoredConfig: storedblock, NewConfig: newblock}
+	if mismatch.Sign() > 0 {
+		err.RewindTo = mismatch.Uint64() - 1
+	}
+	return err
+}
+
+func newTimestampCompatError(what string, storedtime, newtime *uint64) *ConfigCompatError {
+	var rew *uint64
+	switch {
+	case storedtime == nil:
+		rew = newtime
+	case newtime == nil || *storedtime < *newtime:
+		rew = storedtime
+	default:
+		rew = newtime
+	}
+	err := &ConfigCompatError{What: what, StoredTime: storedtime, NewTime: newtime}
+	if rew != nil && *rew > 0 {
+		err.RewindToTime = *rew - 1
+	}
+	return err
+}
+
 func (err *ConfigCompatError) Error() string {
+	if err.StoredTime != nil || err.NewTime != nil {
+		return fmt.Sprintf("mismatching %s in database (have timestamp %s, want timestamp %s, rewindto timestamp %d)", err.What, timestampString(err.StoredTime), timestampString(err.NewTime), err.RewindToTime)
+	}
 	return fmt.Sprintf("mismatching %s in database (have %d, want %d, rewindto %d)", err.What, err.StoredConfig, err.NewConfig, err.RewindTo)
 }
 
+// timestampString formats an optional fork timestamp for error reporting.
+func timestampString(t *uint64) string {
+	if t == nil {
+		return "nil"
+	}
+	return fmt.Sprint(*t)
+}
+
 // Rules wraps ChainConfig and is merely syntactic sugar or can be used for functions
 // that do not have or require information about the block.
 //
@@ -639,7 +929,7 @@ type Rules struct {
 }
 
 // Rules ensures c's ChainID is not nil.
-func (c *ChainConfig) Rules(num *big.Int) Rules {
+func (c *ChainConfig) Rules(num *big.Int, time uint64) Rules {
 	chainID := c.ChainID
 	if chainID == nil {
 		chainID = new(big.Int)
@@ -654,8 +944,8 @@ func (c *ChainConfig) Rules(num *big.Int) Rules {
 		IsConstantinople: c.IsConstantinople(num),
 		IsPetersburg:     c.IsPetersburg(num),
 		IsIstanbul:       c.IsIstanbul(num),
-		IsBerlin:         c.IsBerlin(num),
-		IsLondon:         c.IsLondon(num),
+		IsBerlin:         c.IsBerlin(num, time),
+		IsLondon:         c.IsLondon(num, time),
 		IsCatalyst:       c.IsCatalyst(num),
 	}
 }
@@ -20,13 +20,16 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/avalanria/go-avalanria/common"
 )
 
 func TestCheckCompatible(t *testing.T) {
 	type test struct {
-		stored, new *ChainConfig
-		head        uint64
-		wantErr     *ConfigCompatError
+		stored, new   *ChainConfig
+		head          uint64
+		headTimestamp uint64
+		wantErr       *ConfigCompatError
 	}
 	tests := []test{
 		{stored: AllEthashProtocolChanges, new: AllEthashProtocolChanges, head: 0, wantErr: nil},
@@ -87,12 +90,150 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     30,
 			},
 		},
+		{
+			stored:  &ChainConfig{BlockRewards: []BlockRewardFork{{Block: big.NewInt(10), Reward: big.NewInt(1)}}},
+			new:     &ChainConfig{BlockRewards: []BlockRewardFork{{Block: big.NewInt(10), Reward: big.NewInt(1)}, {Block: big.NewInt(50), Reward: big.NewInt(2)}}},
+			head:    40,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{BlockRewards: []BlockRewardFork{{Block: big.NewInt(10), Reward: big.NewInt(1)}, {Block: big.NewInt(20), Reward: big.NewInt(2)}}},
+			new:    &ChainConfig{BlockRewards: []BlockRewardFork{{Block: big.NewInt(10), Reward: big.NewInt(1)}, {Block: big.NewInt(30), Reward: big.NewInt(2)}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "block reward schedule",
+				StoredConfig: big.NewInt(20),
+				NewConfig:    big.NewInt(30),
+				RewindTo:     19,
+			},
+		},
+		{
+			stored: &ChainConfig{BlockRewards: []BlockRewardFork{{Block: big.NewInt(10), Reward: big.NewInt(1)}}},
+			new:    &ChainConfig{BlockRewards: []BlockRewardFork{{Block: big.NewInt(10), Reward: big.NewInt(2)}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "block reward schedule entry at block 10",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(10),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored:  &ChainConfig{BaseFeeRecipients: []BaseFeeRecipientFork{{Block: big.NewInt(10), Recipient: &common.Address{1}}}},
+			new:     &ChainConfig{BaseFeeRecipients: []BaseFeeRecipientFork{{Block: big.NewInt(10), Recipient: &common.Address{1}}}},
+			head:    40,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{BaseFeeRecipients: []BaseFeeRecipientFork{{Block: big.NewInt(10), Recipient: &common.Address{1}}}},
+			new:    &ChainConfig{BaseFeeRecipients: []BaseFeeRecipientFork{{Block: big.NewInt(10), Recipient: &common.Address{1}}, {Block: big.NewInt(30)}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "base fee recipient schedule",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(30),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored:        &ChainConfig{LondonTime: newUint64(10)},
+			new:           &ChainConfig{LondonTime: newUint64(20)},
+			headTimestamp: 9,
+			wantErr:       nil,
+		},
+		{
+			stored:        &ChainConfig{LondonTime: newUint64(10)},
+			new:           &ChainConfig{LondonTime: newUint64(20)},
+			headTimestamp: 25,
+			wantErr: &ConfigCompatError{
+				What:         "London fork timestamp",
+				StoredTime:   newUint64(10),
+				NewTime:      newUint64(20),
+				RewindToTime: 9,
+			},
+		},
+		{
+			stored:        &ChainConfig{BerlinTime: newUint64(10), LondonTime: newUint64(30)},
+			new:           &ChainConfig{BerlinTime: newUint64(20), LondonTime: newUint64(40)},
+			headTimestamp: 50,
+			wantErr: &ConfigCompatError{
+				What:         "Berlin fork timestamp",
+				StoredTime:   newUint64(10),
+				NewTime:      newUint64(20),
+				RewindToTime: 9,
+			},
+		},
+		{
+			stored:        &ChainConfig{LondonBlock: big.NewInt(30)},
+			new:           &ChainConfig{LondonTime: newUint64(1000)},
+			head:          40,
+			headTimestamp: 500,
+			wantErr: &ConfigCompatError{
+				What:         "London fork block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    nil,
+				RewindTo:     29,
+			},
+		},
 	}
 
 	for _, test := range tests {
-		err := test.stored.CheckCompatible(test.new, test.head)
+		err := test.stored.CheckCompatible(test.new, test.head, test.headTimestamp)
 		if !reflect.DeepEqual(err, test.wantErr) {
 			t.Errorf("error mismatch:\nstored: %v\nnew: %v\nhead: %v\nerr: %v\nwant: %v", test.stored, test.new, test.head, err, test.wantErr)
 		}
 	}
 }
+
+func TestTimestampForks(t *testing.T) {
+	config := &ChainConfig{BerlinBlock: big.NewInt(10), LondonTime: newUint64(1000)}
+
+	if config.IsLondon(big.NewInt(100), 999) {
+		t.Errorf("london active before its timestamp")
+	}
+	if !config.IsLondon(big.NewInt(100), 1000) {
+		t.Errorf("london inactive at its timestamp")
+	}
+	if !config.IsBerlin(big.NewInt(10), 0) {
+		t.Errorf("berlin inactive at its block")
+	}
+	if rules := config.Rules(big.NewInt(100), 1000); !rules.IsBerlin || !rules.IsLondon {
+		t.Errorf("rules mismatch: berlin %v, london %v", rules.IsBerlin, rules.IsLondon)
+	}
+}
+
+func TestCheckTimestampForkOrder(t *testing.T) {
+	tests := []struct {
+		berlinBlock, londonBlock *big.Int
+		berlinTime, londonTime   *uint64
+		wantErr                  bool
+	}{
+		{berlinBlock: big.NewInt(10), londonTime: newUint64(1000), wantErr: false},
+		{berlinTime: newUint64(1000), londonTime: newUint64(2000), wantErr: false},
+		{berlinTime: newUint64(2000), londonTime: newUint64(1000), wantErr: true},
+		{berlinTime: newUint64(1000), londonBlock: big.NewInt(10), wantErr: true},
+		{berlinBlock: big.NewInt(10), berlinTime: newUint64(1000), wantErr: true},
+		{londonTime: newUint64(1000), wantErr: true},
+	}
+	for i, tt := range tests {
+		config := &ChainConfig{
+			HomesteadBlock:      big.NewInt(0),
+			EIP150Block:         big.NewInt(0),
+			EIP155Block:         big.NewInt(0),
+			EIP158Block:         big.NewInt(0),
+			ByzantiumBlock:      big.NewInt(0),
+			ConstantinopleBlock: big.NewInt(0),
+			PetersburgBlock:     big.NewInt(0),
+			IstanbulBlock:       big.NewInt(0),
+			BerlinBlock:         tt.berlinBlock,
+			LondonBlock:         tt.londonBlock,
+			BerlinTime:          tt.berlinTime,
+			LondonTime:          tt.londonTime,
+		}
+		if err := config.CheckConfigForkOrder(); (err != nil) != tt.wantErr {
+			t.Errorf("test %d: error mismatch: have %v, want error %v", i, err, tt.wantErr)
+		}
+	}
+}
+
+func newUint64(val uint64) *uint64 { return &val }
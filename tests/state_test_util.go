@@ -186,7 +186,7 @@ func (t *StateTest) RunNoVerify(subtest StateSubtest, vmconfig vm.Config, snapsh
 	snaps, statedb := MakePreState(rawdb.NewMemoryDatabase(), t.json.Pre, snapshotter)
 
 	var baseFee *big.Int
-	if config.IsLondon(new(big.Int)) {
+	if config.IsLondon(new(big.Int), block.Time()) {
 		baseFee = t.json.Env.BaseFee
 		if baseFee == nil {
 			// Retestavn uses `0x10` for genesis baseFee. Therefore, it defaults to
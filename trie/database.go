@@ -26,9 +26,10 @@ import (
 	"time"
 
 	"github.com/VictoriaMetrics/fastcache"
+	"github.com/avalanria/go-avalanria/avndb"
 	"github.com/avalanria/go-avalanria/common"
 	"github.com/avalanria/go-avalanria/core/rawdb"
-	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/crypto"
 	"github.com/avalanria/go-avalanria/log"
 	"github.com/avalanria/go-avalanria/metrics"
 	"github.com/avalanria/go-avalanria/rlp"
@@ -67,13 +68,18 @@ var (
 // behind this split design is to provide read access to RPC handlers and sync
 // servers even while the trie is executing expensive garbage collection.
 type Database struct {
-	diskdb avndb.KeyValueStore // Persistent storage for matured trie nodes
+	diskdb  avndb.KeyValueStore // Persistent storage for matured trie nodes
+	scheme  string              // Scheme the trie nodes are persisted with (hash or path)
+	history uint64              // Number of reverse diffs retained with the path-based scheme
 
 	cleans  *fastcache.Cache            // GC friendly memory cache of clean node RLPs
 	dirties map[common.Hash]*cachedNode // Data and references relationships of dirty trie nodes
 	oldest  common.Hash                 // Oldest tracked node, flush-list head
 	newest  common.Hash                 // Newest tracked node, flush-list tail
 
+	stale      map[common.Hash]*staleEntry // Nodes overwritten on disk by the recent path-based commits
+	staleOrder [][]common.Hash             // Hashes of the stale nodes, grouped by commit
+
 	preimages map[common.Hash][]byte // Preimages of nodes from the secure trie
 
 	gctime  time.Duration      // Time spent on garbage collection since last commit
@@ -147,6 +153,8 @@ type cachedNode struct {
 
 	flushPrev common.Hash // Previous node in the flush-list
 	flushNext common.Hash // Next node in the flush-list
+
+	persisted string // Owner and path the node was last persisted at with the path-based scheme
 }
 
 // cachedNodeSize is the raw size of a cachedNode data structure without any
@@ -274,11 +282,17 @@ func expandNode(hash hashNode, n node) node {
 
 // Config defines all necessary options for database.
 type Config struct {
-	Cache     int    // Memory allowance (MB) to use for caching trie nodes in memory
-	Journal   string // Journal of clean cache to survive node restarts
-	Preimages bool   // Flag whavner the preimage of trie key is recorded
+	Cache        int    // Memory allowance (MB) to use for caching trie nodes in memory
+	Journal      string // Journal of clean cache to survive node restarts
+	Preimages    bool   // Flag whavner the preimage of trie key is recorded
+	Scheme       string // Scheme to persist trie nodes with, defaults to the hash-based one
+	StateHistory uint64 // Number of recent states to retain reverse diffs for with the path-based scheme
 }
 
+// DefaultStateHistory is the default number of reverse diffs retained with the
+// path-based scheme.
+const DefaultStateHistory = 90000
+
 // NewDatabase creates a new trie database to store ephemeral trie content before
 // its written out to disk or garbage collected. No read cache is created, so all
 // data retrievals will hit the underlying disk database.
@@ -299,12 +313,20 @@ func NewDatabaseWithConfig(diskdb avndb.KeyValueStore, config *Config) *Database
 		}
 	}
 	db := &Database{
-		diskdb: diskdb,
-		cleans: cleans,
+		diskdb:  diskdb,
+		scheme:  rawdb.HashScheme,
+		history: DefaultStateHistory,
+		cleans:  cleans,
 		dirties: map[common.Hash]*cachedNode{{}: {
 			children: make(map[common.Hash]uint16),
 		}},
 	}
+	if config != nil && config.Scheme != "" {
+		db.scheme = config.Scheme
+	}
+	if config != nil && config.StateHistory != 0 {
+		db.history = config.StateHistory
+	}
 	if config == nil || config.Preimages { // TODO(karalabe): Flip to default off in the future
 		db.preimages = make(map[common.Hash][]byte)
 	}
@@ -316,6 +338,11 @@ func (db *Database) DiskDB() avndb.KeyValueStore {
 	return db.diskdb
 }
 
+// Scheme returns the scheme the trie nodes are persisted with.
+func (db *Database) Scheme() string {
+	return db.scheme
+}
+
 // insert inserts a collapsed trie node into the memory database.
 // The blob size must be specified to allow proper size tracking.
 // All nodes inserted by this function will be reference tracked
@@ -368,10 +395,13 @@ func (db *Database) insertPreimage(hash common.Hash, preimage []byte) {
 }
 
 // node retrieves a cached trie node from memory, or returns nil if none can be
-// found in the memory cache.
-func (db *Database) node(hash common.Hash) node {
-	// Retrieve the node from the clean cache if available
-	if db.cleans != nil {
+// found in the memory cache. The owner and path of the node are only needed to
+// locate it on disk with the path-based scheme.
+func (db *Database) node(owner common.Hash, path []byte, hash common.Hash) node {
+	// Retrieve the node from the clean cache if available. With the path-based
+	// scheme, state roots are always checked against the disk, as the presence
+	// of a root signals the availability of the whole state.
+	if db.cleans != nil && (db.scheme == rawdb.HashScheme || owner != (common.Hash{}) || len(path) != 0) {
 		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
 			memcacheCleanHitMeter.Mark(1)
 			memcacheCleanReadMeter.Mark(int64(len(enc)))
@@ -390,9 +420,15 @@ func (db *Database) node(hash common.Hash) node {
 	}
 	memcacheDirtyMissMeter.Mark(1)
 
+	// Recent states persisted with the path-based scheme might have been
+	// overwritten on disk, retrieve their nodes from the stale set
+	if enc := db.staleNode(hash); enc != nil {
+		return mustDecodeNode(hash[:], enc)
+	}
+
 	// Content unavailable in memory, attempt to retrieve from disk
-	enc, err := db.diskdb.Get(hash[:])
-	if err != nil || enc == nil {
+	enc := db.diskNode(owner, path, hash)
+	if enc == nil {
 		return nil
 	}
 	if db.cleans != nil {
@@ -403,8 +439,42 @@ func (db *Database) node(hash common.Hash) node {
 	return mustDecodeNode(hash[:], enc)
 }
 
+// nodeBlob retrieves an encoded trie node from memory, or from the persistent
+// database at the given owner and path with the path-based scheme.
+func (db *Database) nodeBlob(owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	if db.scheme == rawdb.HashScheme {
+		return db.Node(hash)
+	}
+	if enc, err := db.Node(hash); err == nil {
+		return enc, nil
+	}
+	if enc := db.diskNode(owner, path, hash); enc != nil {
+		return enc, nil
+	}
+	return nil, errors.New("not found")
+}
+
+// diskNode retrieves an encoded trie node from the persistent database, either
+// by hash or by owner and path, depending on the storage scheme. Nodes stored
+// by path are only returned if they match the requested hash.
+func (db *Database) diskNode(owner common.Hash, path []byte, hash common.Hash) []byte {
+	if db.scheme == rawdb.HashScheme {
+		enc, err := db.diskdb.Get(hash[:])
+		if err != nil || len(enc) == 0 {
+			return nil
+		}
+		return enc
+	}
+	enc := readPathNode(db.diskdb, owner, path)
+	if len(enc) == 0 || crypto.Keccak256Hash(enc) != hash {
+		return nil
+	}
+	return enc
+}
+
 // Node retrieves an encoded cached trie node from memory. If it cannot be found
-// cached, the mavnod queries the persistent database for the content.
+// cached, the mavnod queries the persistent database for the content. With the
+// path-based scheme, nodes cannot be looked up on disk by hash alone.
 func (db *Database) Node(hash common.Hash) ([]byte, error) {
 	// It doesn't make sense to retrieve the metaroot
 	if hash == (common.Hash{}) {
@@ -431,6 +501,12 @@ func (db *Database) Node(hash common.Hash) ([]byte, error) {
 	memcacheDirtyMissMeter.Mark(1)
 
 	// Content unavailable in memory, attempt to retrieve from disk
+	if db.scheme != rawdb.HashScheme {
+		if enc := db.staleNode(hash); enc != nil {
+			return enc, nil
+		}
+		return nil, errors.New("not found")
+	}
 	enc := rawdb.ReadTrieNode(db.diskdb, hash)
 	if len(enc) != 0 {
 		if db.cleans != nil {
@@ -619,9 +695,11 @@ func (db *Database) Cap(limit common.StorageSize) error {
 			}
 		}
 	}
-	// Keep committing nodes from the flush-list until we're below allowance
+	// Keep committing nodes from the flush-list until we're below allowance. The
+	// path-based scheme can only persist complete states, so it only flushes the
+	// preimages here.
 	oldest := db.oldest
-	for size > limit && oldest != (common.Hash{}) {
+	for size > limit && oldest != (common.Hash{}) && db.scheme == rawdb.HashScheme {
 		// Fetch the oldest referenced node and push into the batch
 		node := db.dirties[oldest]
 		rawdb.WriteTrieNode(batch, oldest, node.rlp())
@@ -693,6 +771,9 @@ func (db *Database) Cap(limit common.StorageSize) error {
 // Note, this mavnod is a non-synchronized mutator. It is unsafe to call this
 // concurrently with other mutators.
 func (db *Database) Commit(node common.Hash, report bool, callback func(common.Hash)) error {
+	if db.scheme == rawdb.PathScheme {
+		return db.commitState(node, report, callback)
+	}
 	// Create a database batch to flush persistent data out. It is important that
 	// outside code doesn't see an inconsistent state (referenced data removed from
 	// memory cache during commit but not yet in persistent storage). This is ensured
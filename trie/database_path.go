@@ -0,0 +1,563 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/log"
+	"github.com/avalanria/go-avalanria/rlp"
+)
+
+// staleStateLimit is the number of recent path-based commits the overwritten
+// nodes are kept in memory for, matching the number of recent states the chain
+// keeps in memory. It allows the states built upon older persisted ones to stay
+// accessible after their nodes are overwritten on disk.
+const staleStateLimit = 128
+
+// errStateUnrecoverable is returned if a persisted state is requested to be
+// restored, but the reverse diffs leading to it are not available.
+var errStateUnrecoverable = errors.New("state is not recoverable")
+
+// reverseDiff is the set of trie node changes reverting a state persisted with
+// the path-based scheme to the one persisted before it.
+type reverseDiff struct {
+	Parent common.Hash       // Root of the state the diff reverts to
+	Root   common.Hash       // Root of the state the diff reverts
+	Nodes  []reverseDiffNode // Previous values of all the nodes touched by the state
+}
+
+// reverseDiffNode is the previous value of a single trie node.
+type reverseDiffNode struct {
+	Owner common.Hash // Hash of the account owning the node, empty for the account trie
+	Path  []byte      // Hexary path of the node within its trie
+	Prev  []byte      // Previous value of the node, empty if it didn't exist
+}
+
+// pathAccount is the consensus representation of accounts, decoded from the
+// leaves of the account trie to locate the storage tries owned by them.
+type pathAccount struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// nodeLocation returns the unique identifier of the given owner and path.
+func nodeLocation(owner common.Hash, path []byte) string {
+	return string(owner[:]) + string(path)
+}
+
+// readPathNode retrieves the trie node stored at the given owner and path.
+func readPathNode(db avndb.KeyValueReader, owner common.Hash, path []byte) []byte {
+	if owner == (common.Hash{}) {
+		return rawdb.ReadAccountTrieNode(db, path)
+	}
+	return rawdb.ReadStorageTrieNode(db, owner, path)
+}
+
+// writePathNode stores the trie node at the given owner and path.
+func writePathNode(db avndb.KeyValueWriter, owner common.Hash, path []byte, blob []byte) {
+	if owner == (common.Hash{}) {
+		rawdb.WriteAccountTrieNode(db, path, blob)
+	} else {
+		rawdb.WriteStorageTrieNode(db, owner, path, blob)
+	}
+}
+
+// deletePathNode deletes the trie node stored at the given owner and path.
+func deletePathNode(db avndb.KeyValueWriter, owner common.Hash, path []byte) {
+	if owner == (common.Hash{}) {
+		rawdb.DeleteAccountTrieNode(db, path)
+	} else {
+		rawdb.DeleteStorageTrieNode(db, owner, path)
+	}
+}
+
+// readReverseDiff retrieves and decodes the reverse diff of the given state.
+func readReverseDiff(db avndb.KeyValueReader, id uint64) (*reverseDiff, error) {
+	blob := rawdb.ReadReverseDiff(db, id)
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("reverse diff #%d missing", id)
+	}
+	diff := new(reverseDiff)
+	if err := rlp.DecodeBytes(blob, diff); err != nil {
+		return nil, fmt.Errorf("reverse diff #%d corrupted: %v", id, err)
+	}
+	return diff, nil
+}
+
+// forPathChildren traverses the hierarchy of an expanded trie node, invoking the
+// callbacks for all its hash children and values along with their paths.
+func forPathChildren(n node, path []byte, onChild func(path []byte, hash common.Hash), onValue func(path []byte, value []byte)) {
+	switch n := n.(type) {
+	case *shortNode:
+		forPathChildren(n.Val, concat(path, n.Key...), onChild, onValue)
+	case *fullNode:
+		for i := 0; i < len(n.Children); i++ {
+			if n.Children[i] != nil {
+				forPathChildren(n.Children[i], concat(path, byte(i)), onChild, onValue)
+			}
+		}
+	case hashNode:
+		onChild(path, common.BytesToHash(n))
+	case valueNode:
+		if onValue != nil {
+			onValue(path, n)
+		}
+	}
+}
+
+// persistedState returns the id and root of the latest state persisted with
+// the path-based scheme.
+func (db *Database) persistedState() (uint64, common.Hash, error) {
+	id := rawdb.ReadPersistentStateID(db.diskdb)
+	if id == 0 {
+		return 0, emptyRoot, nil
+	}
+	diff, err := readReverseDiff(db.diskdb, id)
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	return id, diff.Root, nil
+}
+
+// PersistedRoot returns the root of the latest state persisted with the path-based
+// scheme, or the empty root if none was persisted yet.
+func (db *Database) PersistedRoot() common.Hash {
+	if db.scheme != rawdb.PathScheme {
+		return common.Hash{}
+	}
+	_, root, err := db.persistedState()
+	if err != nil {
+		log.Error("Failed to retrieve persisted state", "err", err)
+		return common.Hash{}
+	}
+	return root
+}
+
+// commitState persists an entire state with the path-based scheme, overwriting
+// the nodes of the previously persisted one. The state needs to be built upon
+// the currently persisted one, as only the nodes changed since are written.
+func (db *Database) commitState(root common.Hash, report bool, callback func(common.Hash)) error {
+	start := time.Now()
+
+	id, parent, err := db.persistedState()
+	if err != nil {
+		return err
+	}
+	batch := db.diskdb.NewBatch()
+	if db.preimages != nil {
+		rawdb.WritePreimages(batch, db.preimages)
+	}
+	if root == parent {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		if db.preimages != nil {
+			db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+		}
+		return nil
+	}
+	if _, ok := db.dirties[root]; !ok && root != emptyRoot {
+		return fmt.Errorf("state %x not available in memory", root)
+	}
+	nodes, storage := len(db.dirties), db.dirtiesSize
+
+	// Write all the nodes changed since the last persisted state, recording their
+	// previous values into the reverse diff
+	c := newPathCommitter(db, batch, parent, root, callback)
+	if root == emptyRoot {
+		c.drop(common.Hash{}, nil, nil)
+	} else if err := c.commit(common.Hash{}, nil, root); err != nil {
+		log.Error("Failed to commit trie from trie database", "err", err)
+		return err
+	}
+	c.finalize()
+	blob, err := rlp.EncodeToBytes(c.diff)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteReverseDiff(batch, id+1, blob)
+	rawdb.WriteReverseDiffLookup(batch, root, id+1)
+	rawdb.WritePersistentStateID(batch, id+1)
+
+	// Drop the reverse diffs beyond the retained history, rendering the states
+	// preceding them unrecoverable
+	if id+1 > db.history {
+		for old := id + 1 - db.history; old > 0; old-- {
+			diff, err := readReverseDiff(db.diskdb, old)
+			if err != nil {
+				break
+			}
+			if prev, ok := rawdb.ReadReverseDiffLookup(db.diskdb, diff.Parent); ok && prev == old-1 {
+				rawdb.DeleteReverseDiffLookup(batch, diff.Parent)
+			}
+			rawdb.DeleteReverseDiff(batch, old)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write trie to disk", "err", err)
+		return err
+	}
+	// State persisted, mark the written nodes and release the ones not referenced
+	// by any live state any more
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for i, hash := range c.hashes {
+		if node := db.dirties[hash]; node != nil {
+			node.persisted = c.locations[i]
+		}
+	}
+	db.retainStale(c.diff)
+
+	if node := db.dirties[root]; node != nil && node.parents == 0 {
+		db.reference(root, common.Hash{})
+		db.dereference(root, common.Hash{})
+	}
+	if db.preimages != nil {
+		db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+	}
+	memcacheCommitTimeTimer.Update(time.Since(start))
+	memcacheCommitSizeMeter.Mark(int64(c.size))
+	memcacheCommitNodesMeter.Mark(int64(len(c.hashes)))
+
+	logger := log.Info
+	if !report {
+		logger = log.Debug
+	}
+	logger("Persisted state from memory database", "root", root, "id", id+1, "nodes", len(c.hashes), "size", c.size, "diff", len(c.diff.Nodes),
+		"time", time.Since(start), "gcnodes", db.gcnodes, "gcsize", db.gcsize, "gctime", db.gctime,
+		"released", nodes-len(db.dirties), "releasedsize", storage-db.dirtiesSize, "livenodes", len(db.dirties), "livesize", db.dirtiesSize)
+
+	// Reset the garbage collection statistics
+	db.gcnodes, db.gcsize, db.gctime = 0, 0, 0
+	return nil
+}
+
+// pathCommitter writes the dirty nodes of a state into a database batch with the
+// path-based scheme, tracking the previous values of all the touched nodes.
+type pathCommitter struct {
+	db       *Database
+	batch    avndb.Batch
+	diff     *reverseDiff
+	callback func(common.Hash)
+
+	accounts map[common.Hash]common.Hash // Storage roots of the accounts in the new state nodes
+	previous map[common.Hash]common.Hash // Storage roots of the accounts in the overwritten nodes
+
+	hashes    []common.Hash      // Hashes of the nodes written
+	locations []string           // Locations of the nodes written
+	size      common.StorageSize // Total size of the nodes written
+}
+
+// newPathCommitter creates a committer writing the state with the given root on
+// top of the persisted parent one.
+func newPathCommitter(db *Database, batch avndb.Batch, parent, root common.Hash, callback func(common.Hash)) *pathCommitter {
+	return &pathCommitter{
+		db:       db,
+		batch:    batch,
+		diff:     &reverseDiff{Parent: parent, Root: root},
+		callback: callback,
+		accounts: make(map[common.Hash]common.Hash),
+		previous: make(map[common.Hash]common.Hash),
+	}
+}
+
+// finalize wipes the storage tries of all the accounts deleted or emptied by the
+// committed state.
+func (c *pathCommitter) finalize() {
+	for account, root := range c.previous {
+		if root == emptyRoot {
+			continue
+		}
+		if current, ok := c.accounts[account]; !ok || current == emptyRoot {
+			c.wipe(account)
+		}
+	}
+}
+
+// commit writes the node with the given hash and all its dirty descendants at
+// the given owner and path, dropping the subtries of the previous nodes which
+// are not part of the state any more.
+func (c *pathCommitter) commit(owner common.Hash, path []byte, hash common.Hash) error {
+	// Nodes not cached are unchanged since the last persisted state
+	node, ok := c.db.dirties[hash]
+	if !ok {
+		return nil
+	}
+	loc := nodeLocation(owner, path)
+	if node.persisted == loc {
+		return nil
+	}
+	blob := node.rlp()
+	prev := c.update(owner, path, blob)
+
+	var (
+		live [][]byte
+		err  error
+	)
+	forPathChildren(node.obj(hash), path, func(child []byte, hash common.Hash) {
+		live = append(live, child)
+		if err == nil {
+			err = c.commit(owner, child, hash)
+		}
+	}, func(leaf []byte, value []byte) {
+		// Descend into the storage tries of the updated accounts
+		account, root, ok := c.account(owner, leaf, value)
+		if !ok || err != nil {
+			return
+		}
+		c.accounts[account] = root
+		if root != emptyRoot {
+			err = c.commit(account, nil, root)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	// Drop the subtries of the previous node not contained in the new one
+	c.dropChildren(owner, path, prev, live)
+
+	c.hashes = append(c.hashes, hash)
+	c.locations = append(c.locations, loc)
+	c.size += common.StorageSize(len(path) + len(blob))
+
+	if c.callback != nil {
+		c.callback(hash)
+	}
+	return nil
+}
+
+// account decodes the account stored in the given leaf of the account trie,
+// returning its hash and storage root.
+func (c *pathCommitter) account(owner common.Hash, leaf []byte, value []byte) (common.Hash, common.Hash, bool) {
+	if owner != (common.Hash{}) || len(leaf) != 2*common.HashLength+1 {
+		return common.Hash{}, common.Hash{}, false
+	}
+	var acc pathAccount
+	if err := rlp.DecodeBytes(value, &acc); err != nil {
+		return common.Hash{}, common.Hash{}, false
+	}
+	return common.BytesToHash(hexToKeybytes(leaf)), acc.Root, true
+}
+
+// update overwrites the node at the given owner and path, returning the previous
+// value of it.
+func (c *pathCommitter) update(owner common.Hash, path []byte, blob []byte) []byte {
+	prev := c.record(owner, path)
+	writePathNode(c.batch, owner, path, blob)
+	return prev
+}
+
+// drop deletes the node at the given owner and path along with its subtrie,
+// leaving alone all paths within the live ones.
+func (c *pathCommitter) drop(owner common.Hash, path []byte, live [][]byte) {
+	for _, prefix := range live {
+		if bytes.HasPrefix(path, prefix) {
+			return
+		}
+	}
+	prev := c.record(owner, path)
+	if len(prev) == 0 {
+		return
+	}
+	deletePathNode(c.batch, owner, path)
+	c.dropChildren(owner, path, prev, live)
+}
+
+// dropChildren deletes the subtries referenced by the given previous node, which
+// are not within the live paths. The storage roots of the accounts contained in
+// the previous node are tracked to wipe the storage of deleted ones.
+func (c *pathCommitter) dropChildren(owner common.Hash, path []byte, prev []byte, live [][]byte) {
+	if len(prev) == 0 {
+		return
+	}
+	n, err := decodeNode(nil, prev)
+	if err != nil {
+		return
+	}
+	forPathChildren(n, path, func(child []byte, _ common.Hash) {
+		c.drop(owner, child, live)
+	}, func(leaf []byte, value []byte) {
+		if account, root, ok := c.account(owner, leaf, value); ok {
+			c.previous[account] = root
+		}
+	})
+}
+
+// wipe deletes the entire storage trie of the given account.
+func (c *pathCommitter) wipe(owner common.Hash) {
+	it := rawdb.IterateStorageTrieNodes(c.db.diskdb, owner)
+	defer it.Release()
+
+	for it.Next() {
+		path := common.CopyBytes(it.Key()[len(rawdb.TrieNodeStoragePrefix)+common.HashLength:])
+		c.record(owner, path)
+		deletePathNode(c.batch, owner, path)
+	}
+}
+
+// record tracks the previous value of the node at the given owner and path in
+// the reverse diff, before it's overwritten or deleted.
+func (c *pathCommitter) record(owner common.Hash, path []byte) []byte {
+	prev := readPathNode(c.db.diskdb, owner, path)
+	c.diff.Nodes = append(c.diff.Nodes, reverseDiffNode{
+		Owner: owner,
+		Path:  common.CopyBytes(path),
+		Prev:  prev,
+	})
+	// If the previous node is still cached, it's not persisted here any more
+	if len(prev) > 0 {
+		if node := c.db.dirties[crypto.Keccak256Hash(prev)]; node != nil && node.persisted == nodeLocation(owner, path) {
+			node.persisted = ""
+		}
+	}
+	return prev
+}
+
+// staleEntry is a node overwritten on disk by a recent path-based commit,
+// counting the commits it was overwritten by.
+type staleEntry struct {
+	blob []byte
+	refs int
+}
+
+// staleNode retrieves a node overwritten on disk by a recent path-based commit.
+func (db *Database) staleNode(hash common.Hash) []byte {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if node := db.stale[hash]; node != nil {
+		return node.blob
+	}
+	return nil
+}
+
+// retainStale keeps the nodes overwritten by a commit in memory, releasing the
+// ones overwritten by commits beyond the stale state limit.
+//
+// The caller must hold the write lock of the database.
+func (db *Database) retainStale(diff *reverseDiff) {
+	if db.stale == nil {
+		db.stale = make(map[common.Hash]*staleEntry)
+	}
+	hashes := make([]common.Hash, 0, len(diff.Nodes))
+	for _, node := range diff.Nodes {
+		if len(node.Prev) == 0 {
+			continue
+		}
+		hash := crypto.Keccak256Hash(node.Prev)
+		if stale := db.stale[hash]; stale != nil {
+			stale.refs++
+		} else {
+			db.stale[hash] = &staleEntry{blob: node.Prev, refs: 1}
+		}
+		hashes = append(hashes, hash)
+	}
+	db.staleOrder = append(db.staleOrder, hashes)
+	for len(db.staleOrder) > staleStateLimit {
+		for _, hash := range db.staleOrder[0] {
+			if stale := db.stale[hash]; stale.refs > 1 {
+				stale.refs--
+			} else {
+				delete(db.stale, hash)
+			}
+		}
+		db.staleOrder = db.staleOrder[1:]
+	}
+}
+
+// stateID returns the id of the persisted state with the given root. The empty
+// state precedes all the persisted ones, unless persisted explicitly.
+func (db *Database) stateID(root common.Hash) (uint64, bool) {
+	if id, ok := rawdb.ReadReverseDiffLookup(db.diskdb, root); ok {
+		return id, true
+	}
+	return 0, root == emptyRoot
+}
+
+// Recoverable reports whavner the persisted state can be rolled back to the
+// one with the given root, using the recorded reverse diffs.
+func (db *Database) Recoverable(root common.Hash) bool {
+	if db.scheme != rawdb.PathScheme {
+		return false
+	}
+	id, ok := db.stateID(root)
+	if !ok || id >= rawdb.ReadPersistentStateID(db.diskdb) {
+		return false
+	}
+	return len(rawdb.ReadReverseDiff(db.diskdb, id+1)) > 0
+}
+
+// Recover rolls the persisted state back to the one with the given root, by
+// applying the reverse diffs recorded since. The states built upon any newer
+// persisted state become unavailable.
+//
+// Note, this mavnod is a non-synchronized mutator. It is unsafe to call this
+// concurrently with other mutators.
+func (db *Database) Recover(root common.Hash) error {
+	if !db.Recoverable(root) {
+		return errStateUnrecoverable
+	}
+	var (
+		start     = time.Now()
+		target, _ = db.stateID(root)
+		id        = rawdb.ReadPersistentStateID(db.diskdb)
+	)
+	for ; id > target; id-- {
+		diff, err := readReverseDiff(db.diskdb, id)
+		if err != nil {
+			return err
+		}
+		batch := db.diskdb.NewBatch()
+		for i := len(diff.Nodes) - 1; i >= 0; i-- {
+			node := diff.Nodes[i]
+			if len(node.Prev) == 0 {
+				deletePathNode(batch, node.Owner, node.Path)
+			} else {
+				writePathNode(batch, node.Owner, node.Path, node.Prev)
+			}
+		}
+		rawdb.DeleteReverseDiff(batch, id)
+		if prev, ok := rawdb.ReadReverseDiffLookup(db.diskdb, diff.Root); ok && prev == id {
+			rawdb.DeleteReverseDiffLookup(batch, diff.Root)
+		}
+		rawdb.WritePersistentStateID(batch, id-1)
+		if err := batch.Write(); err != nil {
+			return err
+		}
+	}
+	// The cached nodes might not be persisted where they used to be any more
+	db.lock.Lock()
+	for _, node := range db.dirties {
+		node.persisted = ""
+	}
+	db.lock.Unlock()
+
+	log.Info("Rolled back persisted state", "root", root, "id", target, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
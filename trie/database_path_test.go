@@ -0,0 +1,216 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/core/rawdb"
+	"github.com/avalanria/go-avalanria/avndb"
+	"github.com/avalanria/go-avalanria/rlp"
+)
+
+// pathTestState is a simple state of accounts with storage slots, used to test
+// the path-based scheme.
+type pathTestState map[common.Hash]map[common.Hash][]byte
+
+// commitPathTestState writes the given state into the trie database on top of
+// the given parent, returning the new state root.
+func commitPathTestState(t *testing.T, db *Database, parent common.Hash, state pathTestState) common.Hash {
+	accounts, err := New(parent, db)
+	if err != nil {
+		t.Fatalf("failed to open account trie: %v", err)
+	}
+	for account, slots := range state {
+		root := emptyRoot
+		if blob, _ := accounts.TryGet(account[:]); len(blob) > 0 {
+			var acc pathAccount
+			if err := rlp.DecodeBytes(blob, &acc); err != nil {
+				t.Fatalf("failed to decode account: %v", err)
+			}
+			root = acc.Root
+		}
+		if slots == nil {
+			accounts.TryDelete(account[:])
+			continue
+		}
+		storage, err := NewWithOwner(account, root, db)
+		if err != nil {
+			t.Fatalf("failed to open storage trie: %v", err)
+		}
+		for slot, value := range slots {
+			if value == nil {
+				storage.TryDelete(slot[:])
+			} else {
+				storage.TryUpdate(slot[:], value)
+			}
+		}
+		if root, err = storage.Commit(nil); err != nil {
+			t.Fatalf("failed to commit storage trie: %v", err)
+		}
+		blob, _ := rlp.EncodeToBytes(&pathAccount{Balance: big.NewInt(1), Root: root, CodeHash: emptyState.Bytes()})
+		accounts.TryUpdate(account[:], blob)
+	}
+	root, err := accounts.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit account trie: %v", err)
+	}
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to persist state: %v", err)
+	}
+	return root
+}
+
+// checkPathTestState verifies that the state with the given root is fully
+// available in a fresh trie database and matches the expected content.
+func checkPathTestState(t *testing.T, diskdb avndb.KeyValueStore, root common.Hash, state pathTestState) {
+	t.Helper()
+
+	db := NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+	accounts, err := New(root, db)
+	if err != nil {
+		t.Fatalf("state %x unavailable: %v", root, err)
+	}
+	for account, slots := range state {
+		blob, err := accounts.TryGet(account[:])
+		if err != nil {
+			t.Fatalf("failed to retrieve account %x: %v", account, err)
+		}
+		if slots == nil {
+			if len(blob) != 0 {
+				t.Errorf("deleted account %x present", account)
+			}
+			continue
+		}
+		var acc pathAccount
+		if err := rlp.DecodeBytes(blob, &acc); err != nil {
+			t.Fatalf("failed to decode account %x: %v", account, err)
+		}
+		storage, err := NewWithOwner(account, acc.Root, db)
+		if err != nil {
+			t.Fatalf("storage of account %x unavailable: %v", account, err)
+		}
+		for slot, want := range slots {
+			have, err := storage.TryGet(slot[:])
+			if err != nil {
+				t.Fatalf("failed to retrieve slot %x of account %x: %v", slot, account, err)
+			}
+			if !bytes.Equal(have, want) {
+				t.Errorf("slot %x of account %x mismatch: have %x, want %x", slot, account, have, want)
+			}
+		}
+	}
+}
+
+// Tests that states persisted with the path-based scheme overwrite the previous
+// ones on disk, and that they can be rolled back via the reverse diffs.
+func TestPathSchemeCommitRecover(t *testing.T) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		db     = NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+
+		alice = common.Hash{0x01}
+		bob   = common.Hash{0x02}
+		carol = common.Hash{0x03}
+	)
+	if db.Scheme() != rawdb.PathScheme {
+		t.Fatalf("scheme mismatch: have %s, want %s", db.Scheme(), rawdb.PathScheme)
+	}
+	first := pathTestState{
+		alice: {{0x01}: []byte{0x01}, {0x02}: []byte{0x02}},
+		bob:   {{0x01}: []byte{0x03}, {0x02}: []byte{0x04}, {0x03}: []byte{0x05}},
+		carol: {{0x01}: []byte{0x06}},
+	}
+	root1 := commitPathTestState(t, db, emptyRoot, first)
+	checkPathTestState(t, diskdb, root1, first)
+
+	// Update a slot, delete an account with storage and empty the storage of
+	// another, checking that the stale nodes are dropped
+	update := pathTestState{
+		alice: {{0x01}: []byte{0x07}},
+		bob:   nil,
+		carol: {{0x01}: nil},
+	}
+	root2 := commitPathTestState(t, db, root1, update)
+	second := pathTestState{
+		alice: {{0x01}: []byte{0x07}, {0x02}: []byte{0x02}},
+		bob:   nil,
+		carol: {{0x01}: nil},
+	}
+	checkPathTestState(t, diskdb, root2, second)
+
+	for _, owner := range []common.Hash{bob, carol} {
+		it := rawdb.IterateStorageTrieNodes(diskdb, owner)
+		if it.Next() {
+			t.Errorf("storage of account %x not wiped", owner)
+		}
+		it.Release()
+	}
+	if _, err := New(root1, NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})); err == nil {
+		t.Errorf("overwritten state %x still available on disk", root1)
+	}
+	// The previous state should still be accessible from memory
+	if _, err := New(root1, db); err != nil {
+		t.Errorf("recent state %x unavailable in memory: %v", root1, err)
+	}
+	// Roll back to the first state and check it's restored on disk
+	if db.Recoverable(root2) {
+		t.Errorf("persisted state %x reported recoverable", root2)
+	}
+	if !db.Recoverable(root1) {
+		t.Fatalf("state %x not recoverable", root1)
+	}
+	if err := db.Recover(root1); err != nil {
+		t.Fatalf("failed to recover state: %v", err)
+	}
+	checkPathTestState(t, diskdb, root1, first)
+	if id := rawdb.ReadPersistentStateID(diskdb); id != 1 {
+		t.Errorf("persistent state id mismatch: have %d, want 1", id)
+	}
+	// Roll back to the empty state, ensuring nothing is left behind
+	if err := db.Recover(emptyRoot); err != nil {
+		t.Fatalf("failed to recover empty state: %v", err)
+	}
+	it := diskdb.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		if bytes.HasPrefix(it.Key(), rawdb.TrieNodeAccountPrefix) || bytes.HasPrefix(it.Key(), rawdb.TrieNodeStoragePrefix) {
+			t.Errorf("trie node %x left behind", it.Key())
+		}
+	}
+}
+
+// Tests that the reverse diffs beyond the configured history are dropped.
+func TestPathSchemeHistory(t *testing.T) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		db     = NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme, StateHistory: 2})
+		roots  = []common.Hash{emptyRoot}
+	)
+	for i := 0; i < 4; i++ {
+		state := pathTestState{{byte(i + 1)}: {{0x01}: []byte{byte(i + 1)}}}
+		roots = append(roots, commitPathTestState(t, db, roots[len(roots)-1], state))
+	}
+	for i, root := range roots[:len(roots)-1] {
+		if have, want := db.Recoverable(root), i >= len(roots)-3; have != want {
+			t.Errorf("state #%d recoverability mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
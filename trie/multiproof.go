@@ -0,0 +1,113 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/avalanria/go-avalanria/common"
+	"github.com/avalanria/go-avalanria/crypto"
+	"github.com/avalanria/go-avalanria/avndb"
+)
+
+// MultiProof is a merkle proof for any number of keys, possibly spanning several
+// tries, containing each of the nodes needed to prove them only once. The nodes
+// shared by the paths of the keys, such as the upper levels of a trie, are thus
+// not duplicated.
+//
+// MultiProof implements both the writer proofs are constructed into and the
+// reader they are verified from.
+type MultiProof struct {
+	nodes map[common.Hash][]byte // Deduplicated proof nodes, keyed by hash
+	order []common.Hash          // Node hashes in insertion order, for a stable encoding
+}
+
+// NewMultiProof creates an empty multiproof.
+func NewMultiProof() *MultiProof {
+	return &MultiProof{nodes: make(map[common.Hash][]byte)}
+}
+
+// NewMultiProofFromNodes creates a multiproof from a list of encoded nodes, as
+// returned by Nodes.
+func NewMultiProofFromNodes(nodes [][]byte) *MultiProof {
+	proof := NewMultiProof()
+	for _, blob := range nodes {
+		proof.Put(crypto.Keccak256(blob), blob)
+	}
+	return proof
+}
+
+// Put adds a node to the proof, unless it's already contained.
+func (p *MultiProof) Put(key []byte, value []byte) error {
+	hash := common.BytesToHash(key)
+	if _, ok := p.nodes[hash]; ok {
+		return nil
+	}
+	p.nodes[hash] = common.CopyBytes(value)
+	p.order = append(p.order, hash)
+	return nil
+}
+
+// Delete is not supported, proofs only grow.
+func (p *MultiProof) Delete(key []byte) error {
+	return errors.New("not supported")
+}
+
+// Get retrieves a node from the proof by hash.
+func (p *MultiProof) Get(key []byte) ([]byte, error) {
+	if blob, ok := p.nodes[common.BytesToHash(key)]; ok {
+		return blob, nil
+	}
+	return nil, errors.New("missing proof node")
+}
+
+// Has checks whether a node is contained in the proof.
+func (p *MultiProof) Has(key []byte) (bool, error) {
+	_, ok := p.nodes[common.BytesToHash(key)]
+	return ok, nil
+}
+
+// Len returns the number of distinct nodes in the proof.
+func (p *MultiProof) Len() int {
+	return len(p.order)
+}
+
+// Nodes returns the encoded nodes of the proof, in the order they were added.
+func (p *MultiProof) Nodes() [][]byte {
+	nodes := make([][]byte, len(p.order))
+	for i, hash := range p.order {
+		nodes[i] = p.nodes[hash]
+	}
+	return nodes
+}
+
+// VerifyMultiProof checks a merkle proof for multiple keys of the trie with the
+// given root hash, returning their values in the order of the keys. Keys proven
+// absent have a nil value. An error is returned if the proof is missing any of
+// the nodes needed or contains invalid ones.
+func VerifyMultiProof(rootHash common.Hash, keys [][]byte, proofDb avndb.KeyValueReader) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, err := VerifyProof(rootHash, key, proofDb)
+		if err != nil {
+			return nil, fmt.Errorf("key %x: %v", key, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
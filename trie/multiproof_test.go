@@ -0,0 +1,97 @@
+// Copyright 2021 The go-avalanria Authors
+// This file is part of the go-avalanria library.
+//
+// The go-avalanria library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-avalanria library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-avalanria library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/avalanria/go-avalanria/avndb/memorydb"
+)
+
+// Tests that a multiproof proves all its keys, present and absent, with fewer
+// nodes than the individual proofs, and survives an encoding round trip.
+func TestMultiProof(t *testing.T) {
+	trie, vals := randomTrie(500)
+	root := trie.Hash()
+
+	var (
+		keys  [][]byte
+		want  [][]byte
+		total int
+	)
+	for _, kv := range vals {
+		keys = append(keys, kv.k)
+		want = append(want, kv.v)
+		if len(keys) == 50 {
+			break
+		}
+	}
+	keys = append(keys, randBytes(32))
+	want = append(want, nil)
+
+	for _, key := range keys {
+		proof := memorydb.New()
+		trie.Prove(key, 0, proof)
+		total += proof.Len()
+	}
+	proof := NewMultiProof()
+	for _, key := range keys {
+		if err := trie.Prove(key, 0, proof); err != nil {
+			t.Fatalf("failed to construct multiproof: %v", err)
+		}
+	}
+	if proof.Len() >= total {
+		t.Errorf("multiproof not deduplicated: %d nodes, %d in individual proofs", proof.Len(), total)
+	}
+	values, err := VerifyMultiProof(root, keys, NewMultiProofFromNodes(proof.Nodes()))
+	if err != nil {
+		t.Fatalf("failed to verify multiproof: %v", err)
+	}
+	for i := range keys {
+		if !bytes.Equal(values[i], want[i]) {
+			t.Errorf("key %x: verified value mismatch: have %x, want %x", keys[i], values[i], want[i])
+		}
+	}
+}
+
+// Tests that multiproofs missing any node are rejected.
+func TestBadMultiProof(t *testing.T) {
+	trie, vals := randomTrie(200)
+	root := trie.Hash()
+
+	var keys [][]byte
+	for _, kv := range vals {
+		keys = append(keys, kv.k)
+		if len(keys) == 10 {
+			break
+		}
+	}
+	proof := NewMultiProof()
+	for _, key := range keys {
+		if err := trie.Prove(key, 0, proof); err != nil {
+			t.Fatalf("failed to construct multiproof: %v", err)
+		}
+	}
+	nodes := proof.Nodes()
+	for i := range nodes {
+		partial := append(append([][]byte{}, nodes[:i]...), nodes[i+1:]...)
+		if _, err := VerifyMultiProof(root, keys, NewMultiProofFromNodes(partial)); err == nil {
+			t.Errorf("multiproof verified with node %d missing", i)
+		}
+	}
+}
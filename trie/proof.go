@@ -38,7 +38,10 @@ import (
 func (t *Trie) Prove(key []byte, fromLevel uint, proofDb avndb.KeyValueWriter) error {
 	// Collect all nodes on the path to key.
 	key = keybytesToHex(key)
-	var nodes []node
+	var (
+		nodes []node
+		path  = key
+	)
 	tn := t.root
 	for len(key) > 0 && tn != nil {
 		switch n := tn.(type) {
@@ -57,7 +60,7 @@ func (t *Trie) Prove(key []byte, fromLevel uint, proofDb avndb.KeyValueWriter) e
 			nodes = append(nodes, n)
 		case hashNode:
 			var err error
-			tn, err = t.resolveHash(n, nil)
+			tn, err = t.resolveHash(n, path[:len(path)-len(key)])
 			if err != nil {
 				log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
 				return err
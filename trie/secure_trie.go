@@ -52,10 +52,17 @@ type SecureTrie struct {
 // A new cache generation is created by each call to Commit.
 // cachelimit sets the number of past cache generations to keep.
 func NewSecure(root common.Hash, db *Database) (*SecureTrie, error) {
+	return NewSecureWithOwner(common.Hash{}, root, db)
+}
+
+// NewSecureWithOwner creates a secure trie with an existing root node from a
+// backing database, owned by the account with the given hash. Storage tries
+// need to be opened with their owner to be found with the path-based scheme.
+func NewSecureWithOwner(owner common.Hash, root common.Hash, db *Database) (*SecureTrie, error) {
 	if db == nil {
 		panic("trie.NewSecure called without a database")
 	}
-	trie, err := New(root, db)
+	trie, err := NewWithOwner(owner, root, db)
 	if err != nil {
 		return nil, err
 	}
@@ -166,6 +173,12 @@ func (t *SecureTrie) Hash() common.Hash {
 	return t.trie.Hash()
 }
 
+// SetRecorder sets the recorder notified of all the trie nodes resolved from the
+// database from now on, see Trie.SetRecorder.
+func (t *SecureTrie) SetRecorder(recorder Recorder) {
+	t.trie.SetRecorder(recorder)
+}
+
 // Copy returns a copy of SecureTrie.
 func (t *SecureTrie) Copy() *SecureTrie {
 	cpy := *t
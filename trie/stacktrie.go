@@ -511,3 +511,71 @@ func (st *StackTrie) Commit() (common.Hash, error) {
 	}
 	return common.BytesToHash(st.val), nil
 }
+
+// HashStackTrieRanges returns the root hash of the trie holding all the entries
+// of the given stack tries, the i-th of which may only contain keys starting
+// with the nibble i. It allows hashing a large trie concurrently, split in 16
+// independently built parts. The subtries are consumed and must not be hashed
+// beforehand. Note, the root node of the combined trie is never committed.
+func HashStackTrieRanges(subtries [16]*StackTrie) (common.Hash, error) {
+	var (
+		last  *StackTrie
+		count int
+	)
+	for _, st := range subtries {
+		if st != nil && st.nodeType != emptyNode {
+			last, count = st, count+1
+		}
+	}
+	switch count {
+	case 0:
+		return emptyRoot, nil
+	case 1:
+		// A single subtrie is the entire trie, no branching at the root
+		return last.Hash(), nil
+	}
+	var nodes [17]node
+	for i, st := range subtries {
+		if st == nil || st.nodeType == emptyNode {
+			nodes[i] = nilValueNode
+			continue
+		}
+		child, err := st.trimNibble(byte(i))
+		if err != nil {
+			return common.Hash{}, err
+		}
+		child.hash()
+		if len(child.val) < 32 {
+			nodes[i] = rawNode(child.val)
+		} else {
+			nodes[i] = hashNode(child.val)
+		}
+	}
+	nodes[16] = nilValueNode
+
+	h := newHasher(false)
+	defer returnHasherToPool(h)
+	h.tmp.Reset()
+	if err := rlp.Encode(&h.tmp, nodes); err != nil {
+		return common.Hash{}, err
+	}
+	var root common.Hash
+	h.sha.Reset()
+	h.sha.Write(h.tmp)
+	h.sha.Read(root[:])
+	return root, nil
+}
+
+// trimNibble returns the node of the stack trie located at the path of the given
+// single nibble, given that all the keys of the trie start with that nibble.
+func (st *StackTrie) trimNibble(nibble byte) (*StackTrie, error) {
+	if (st.nodeType != leafNode && st.nodeType != extNode) || len(st.key) == 0 || st.key[0] != nibble {
+		return nil, fmt.Errorf("stack trie has keys outside of range %x", nibble)
+	}
+	if st.nodeType == extNode && len(st.key) == 1 {
+		return st.children[0], nil
+	}
+	st.key = st.key[1:]
+	st.keyOffset++
+	return st, nil
+}
@@ -3,6 +3,7 @@ package trie
 import (
 	"bytes"
 	"math/big"
+	"sort"
 	"testing"
 
 	"github.com/avalanria/go-avalanria/common"
@@ -215,3 +216,58 @@ func TestStacktrieSerialization(t *testing.T) {
 		t.Fatalf("have %#x want %#x", have, want)
 	}
 }
+
+// Tests that stack tries built concurrently per leading nibble hash to the same
+// root as a single stack trie containing all the entries.
+func TestHashStackTrieRanges(t *testing.T) {
+	tests := [][][]byte{
+		nil,
+		{common.FromHex("0x11")},
+		{common.FromHex("0x11"), common.FromHex("0x12")},
+		{common.FromHex("0x11"), common.FromHex("0x21")},
+		{common.FromHex("0x01"), common.FromHex("0x02"), common.FromHex("0xf0")},
+		{common.FromHex("0x0011"), common.FromHex("0x0012"), common.FromHex("0xa0")},
+	}
+	var random [][]byte
+	for i := 0; i < 1000; i++ {
+		random = append(random, crypto.Keccak256(big.NewInt(int64(i)).Bytes()))
+	}
+	tests = append(tests, random)
+
+	for i, keys := range tests {
+		// Sort the keys for the stack tries and pad them to a fixed length
+		var sorted [][]byte
+		for _, key := range keys {
+			sorted = append(sorted, common.RightPadBytes(key, common.HashLength))
+		}
+		sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+		var (
+			whole    = NewStackTrie(nil)
+			subtries [16]*StackTrie
+		)
+		for j := range subtries {
+			subtries[j] = NewStackTrie(nil)
+		}
+		for j, key := range sorted {
+			val := []byte{byte(j + 1)} // Small values to embed nodes
+			whole.TryUpdate(key, val)
+			subtries[key[0]>>4].TryUpdate(key, val)
+		}
+		have, err := HashStackTrieRanges(subtries)
+		if err != nil {
+			t.Fatalf("test %d: failed to hash subtries: %v", i, err)
+		}
+		if want := whole.Hash(); have != want {
+			t.Errorf("test %d: root mismatch: have %x, want %x", i, have, want)
+		}
+	}
+	// Keys outside of their designated subtrie should be rejected
+	var subtries [16]*StackTrie
+	subtries[0], subtries[1] = NewStackTrie(nil), NewStackTrie(nil)
+	subtries[0].TryUpdate(common.RightPadBytes([]byte{0x10}, common.HashLength), []byte{0x01})
+	subtries[1].TryUpdate(common.RightPadBytes([]byte{0x11}, common.HashLength), []byte{0x01})
+	if _, err := HashStackTrieRanges(subtries); err == nil {
+		t.Errorf("misplaced keys accepted")
+	}
+}
@@ -52,14 +52,24 @@ var (
 // for extracting the raw states(leaf nodes) with corresponding paths.
 type LeafCallback func(paths [][]byte, hexpath []byte, leaf []byte, parent common.Hash) error
 
+// Recorder is notified of every encoded trie node resolved from the database,
+// allowing to collect the witness of the accessed state.
+type Recorder interface {
+	RecordNode(blob []byte)
+}
+
 // Trie is a Merkle Patricia Trie.
 // The zero value is an empty trie with no database.
 // Use New to create a trie that sits on top of a database.
 //
 // Trie is not safe for concurrent use.
 type Trie struct {
-	db   *Database
-	root node
+	db    *Database
+	root  node
+	owner common.Hash // Hash of the account owning a storage trie, empty for the account trie
+
+	recorder Recorder // Recorder of the resolved nodes, nil if not recording
+
 	// Keep track of the number leafs which have been inserted since the last
 	// hashing operation. This number will not directly map to the number of
 	// actually unhashed nodes
@@ -78,11 +88,20 @@ func (t *Trie) newFlag() nodeFlag {
 // New will panic if db is nil and returns a MissingNodeError if root does
 // not exist in the database. Accessing the trie loads nodes from db on demand.
 func New(root common.Hash, db *Database) (*Trie, error) {
+	return NewWithOwner(common.Hash{}, root, db)
+}
+
+// NewWithOwner creates a trie with an existing root node from db, owned by the
+// account with the given hash. The owner is only needed to locate the nodes of
+// storage tries persisted with the path-based scheme, for all other tries it is
+// the zero hash.
+func NewWithOwner(owner common.Hash, root common.Hash, db *Database) (*Trie, error) {
 	if db == nil {
 		panic("trie.New called without a database")
 	}
 	trie := &Trie{
-		db: db,
+		db:    db,
+		owner: owner,
 	}
 	if root != (common.Hash{}) && root != emptyRoot {
 		rootnode, err := trie.resolveHash(root[:], nil)
@@ -94,6 +113,21 @@ func New(root common.Hash, db *Database) (*Trie, error) {
 	return trie, nil
 }
 
+// SetRecorder sets the recorder notified of all the nodes resolved from the
+// database from now on. The root node is recorded right away if unmodified, so
+// the recorder is expected to be set before the trie is accessed.
+func (t *Trie) SetRecorder(recorder Recorder) {
+	t.recorder = recorder
+	if recorder == nil || t.root == nil {
+		return
+	}
+	if hash, dirty := t.root.cache(); hash != nil && !dirty {
+		if blob, err := t.db.nodeBlob(t.owner, nil, common.BytesToHash(hash)); err == nil {
+			recorder.RecordNode(blob)
+		}
+	}
+}
+
 // NodeIterator returns an iterator that returns nodes of the trie. Iteration starts at
 // the key after the given start key.
 func (t *Trie) NodeIterator(start []byte) NodeIterator {
@@ -188,7 +222,7 @@ func (t *Trie) tryGetNode(origNode node, path []byte, pos int) (item []byte, new
 		if hash == nil {
 			return nil, origNode, 0, errors.New("non-consensus node")
 		}
-		blob, err := t.db.Node(common.BytesToHash(hash))
+		blob, err := t.db.nodeBlob(t.owner, path, common.BytesToHash(hash))
 		return blob, origNode, 1, err
 	}
 	// Path still needs to be traversed, descend into children
@@ -498,7 +532,15 @@ func (t *Trie) resolve(n node, prefix []byte) (node, error) {
 
 func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	hash := common.BytesToHash(n)
-	if node := t.db.node(hash); node != nil {
+	if t.recorder != nil {
+		blob, err := t.db.nodeBlob(t.owner, prefix, hash)
+		if err != nil {
+			return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
+		}
+		t.recorder.RecordNode(blob)
+		return mustDecodeNode(hash[:], blob), nil
+	}
+	if node := t.db.node(t.owner, prefix, hash); node != nil {
 		return node, nil
 	}
 	return nil, &MissingNodeError{NodeHash: hash, Path: prefix}